@@ -0,0 +1,123 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/goenv"
+)
+
+// cxxFlags are the extra flags to compile C++ files. Exceptions, RTTI and
+// thread-safe statics need support from a C++ runtime library, which TinyGo
+// doesn't link.
+var cxxFlags = []string{"-std=gnu++11", "-fno-exceptions", "-fno-rtti", "-fno-threadsafe-statics"}
+
+// isCXXFile returns whether the given file should be compiled as C++.
+func isCXXFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".cpp", ".cc", ".cxx":
+		return true
+	}
+	return false
+}
+
+// arduinoSources returns the source files of the Arduino core, the board
+// variant and the Arduino libraries given with -arduino-libs, in a stable
+// order.
+func arduinoSources(config *compileopts.Config) ([]string, error) {
+	root := goenv.Get("ARDUINO_DIR")
+	if root == "" {
+		return nil, errors.New("-arduino requires ARDUINO_DIR to be set to the directory of the Arduino platform")
+	}
+	type sourceDir struct {
+		name      string
+		path      string
+		recursive bool // libraries may have sources in subdirectories (such as utility)
+	}
+	coreDir := filepath.Join(root, config.Target.ArduinoCore)
+	dirs := []sourceDir{{"the Arduino core", coreDir, false}}
+	if config.Target.ArduinoVariant != "" {
+		dirs = append(dirs, sourceDir{"the Arduino variant", filepath.Join(root, config.Target.ArduinoVariant), false})
+	}
+	for _, name := range config.Options.ArduinoLibs {
+		dirs = append(dirs, sourceDir{"Arduino library " + name, compileopts.ArduinoLibraryDir(name), true})
+	}
+
+	var sources []string
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir.path); err != nil {
+			return nil, fmt.Errorf("could not find %s: %w", dir.name, err)
+		}
+		err := filepath.Walk(dir.path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path != dir.path && (!dir.recursive || info.Name() == "examples" || strings.HasPrefix(info.Name(), ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if dir.path == coreDir && info.Name() == "main.cpp" {
+				// The Arduino main function calls setup and loop. The program
+				// is started by the TinyGo runtime instead, which calls the
+				// init function of the core (see src/runtime/arduino_core.go).
+				return nil
+			}
+			switch filepath.Ext(path) {
+			case ".c", ".cpp", ".cc", ".cxx", ".S":
+				sources = append(sources, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(sources)
+	return sources, nil
+}
+
+// loadArduino returns a job that creates a static library of the Arduino core
+// of the board and the Arduino libraries given with -arduino-libs. The object
+// files are cached, the library itself is stored in tmpdir.
+func loadArduino(config *compileopts.Config, tmpdir string) (*compileJob, error) {
+	sources, err := arduinoSources(config)
+	if err != nil {
+		return nil, err
+	}
+	cflags := append(config.CFlags(), "-Oz", "-ffunction-sections", "-fdata-sections")
+	archive := filepath.Join(tmpdir, "arduino.a")
+	job := &compileJob{
+		description: "create Arduino core archive",
+		result:      archive,
+		run: func(job *compileJob) error {
+			var objs []string
+			for _, dependency := range job.dependencies {
+				objs = append(objs, dependency.result)
+			}
+			return makeArchive(archive, objs)
+		},
+	}
+	for _, path := range sources {
+		path := path
+		flags := cflags
+		if isCXXFile(path) {
+			flags = append(flags[:len(flags):len(flags)], cxxFlags...)
+		}
+		job.dependencies = append(job.dependencies, &compileJob{
+			description: "compile Arduino file " + path,
+			run: func(job *compileJob) error {
+				result, err := compileAndCacheCFile(path, tmpdir, flags, config.Options.PrintCommands)
+				job.result = result
+				return err
+			},
+		})
+	}
+	return job, nil
+}
@@ -0,0 +1,64 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+)
+
+func TestArduinoSources(t *testing.T) {
+	root, err := ioutil.TempDir("", "tinygo-arduino")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{
+		"cores/arduino/Arduino.h",
+		"cores/arduino/main.cpp",
+		"cores/arduino/wiring.c",
+		"cores/arduino/WString.cpp",
+		"cores/arduino/sub/ignored.c",
+		"variants/standard/pins_arduino.h",
+		"libraries/Wire/src/Wire.cpp",
+		"libraries/Wire/src/utility/twi.c",
+		"libraries/Wire/examples/scanner/scanner.cpp",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldDir := os.Getenv("ARDUINO_DIR")
+	defer os.Setenv("ARDUINO_DIR", oldDir)
+	os.Setenv("ARDUINO_DIR", root)
+
+	config := &compileopts.Config{
+		Options: &compileopts.Options{ArduinoLibs: []string{"Wire"}},
+		Target:  &compileopts.TargetSpec{ArduinoCore: "cores/arduino", ArduinoVariant: "variants/standard"},
+	}
+	sources, err := arduinoSources(config)
+	if err != nil {
+		t.Fatal("could not list Arduino sources:", err)
+	}
+	expected := []string{
+		filepath.Join(root, "cores/arduino/WString.cpp"),
+		filepath.Join(root, "cores/arduino/wiring.c"),
+		filepath.Join(root, "libraries/Wire/src/Wire.cpp"),
+		filepath.Join(root, "libraries/Wire/src/utility/twi.c"),
+	}
+	if !reflect.DeepEqual(sources, expected) {
+		t.Errorf("unexpected Arduino sources:\nexpected: %v\nactual:   %v", expected, sources)
+	}
+
+	config.Options.ArduinoLibs = []string{"Servo"}
+	if _, err := arduinoSources(config); err == nil {
+		t.Error("expected an error for a missing library")
+	}
+}
@@ -36,6 +36,11 @@ type BuildResult struct {
 	// if it should be kept it must be copied or moved away.
 	Binary string
 
+	// A path to the linked executable (usually an ELF file), before it was
+	// converted to the format of Binary. Like Binary, it will be removed after
+	// Build returns.
+	Executable string
+
 	// The directory of the main package. This is useful for testing as the test
 	// binary must be run in the directory of the tested package.
 	MainDir string
@@ -77,12 +82,30 @@ type packageAction struct {
 // The error value may be of type *MultiError. Callers will likely want to check
 // for this case and print such errors individually.
 func Build(pkgName, outpath string, config *compileopts.Config, action func(BuildResult) error) error {
+	cArchive := config.BuildMode() == "c-archive" || config.BuildMode() == "zephyr" || config.BuildMode() == "freertos" || config.BuildMode() == "customos"
+	if cArchive && filepath.Ext(outpath) != ".a" {
+		return fmt.Errorf("-buildmode=%s requires an output file with the .a extension", config.BuildMode())
+	}
+	cShared := config.BuildMode() == "c-shared"
+	sharedExt := ".so"
+	if config.GOOS() == "darwin" {
+		sharedExt = ".dylib"
+	}
+	if cShared && filepath.Ext(outpath) != sharedExt {
+		return fmt.Errorf("-buildmode=c-shared requires an output file with the %s extension", sharedExt)
+	}
+
 	// Create a temporary directory for intermediary files.
 	dir, err := ioutil.TempDir("", "tinygo")
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(dir)
+	if config.Options.Work {
+		// Keep the directory around, for debugging the build.
+		fmt.Fprintf(os.Stderr, "WORK=%s\n", dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
 
 	compilerConfig := &compiler.Config{
 		Triple:          config.Triple(),
@@ -100,6 +123,19 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 		NeedsStackObjects:  config.NeedsStackObjects(),
 		Debug:              config.Debug(),
 		LLVMFeatures:       config.LLVMFeatures(),
+		LightweightFmt:     config.LightweightFmt(),
+		FramePointers:      config.Options.ErrorTrace,
+		PathPrefixMap:      config.PathPrefixMap(),
+		LinkerSections:     config.Target.LinkerSections(),
+	}
+	if compilerConfig.PathPrefixMap != nil {
+		// The standard library is loaded from a merged GOROOT in the cache,
+		// which should also be hidden.
+		goroot, err := loader.GetCachedGoroot(config)
+		if err != nil {
+			return err
+		}
+		compilerConfig.PathPrefixMap[goroot] = "go"
 	}
 
 	// Load the target machine, which is the LLVM object that contains all
@@ -122,6 +158,15 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 		return err
 	}
 
+	// Write the compilation database of the C files, if requested. This is
+	// done before building so that it is also available when the build fails.
+	if config.Options.CompileCommands != "" {
+		err = writeCompileCommands(config.Options.CompileCommands, config, lprogram.Sorted())
+		if err != nil {
+			return err
+		}
+	}
+
 	// The slice of jobs that orchestrates most of the build.
 	// This is somewhat like an in-memory Makefile with each job being a
 	// Makefile target.
@@ -131,21 +176,37 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 	// program so it's pretty fast and doesn't need to be parallelized.
 	program := lprogram.LoadSSA()
 
+	// When building a test binary with coverage enabled, the package under test
+	// (which is imported by the generated main package) is instrumented.
+	var coveredPkgPath string
+	if config.TestConfig.Cover {
+		coveredPkgPath = strings.TrimSuffix(lprogram.MainPkg().ImportPath, ".test")
+	}
+
 	// Add jobs to compile each package.
 	// Packages that have a cache hit will not be compiled again.
 	var packageJobs []*compileJob
 	packageBitcodePaths := make(map[string]string)
 	packageActionIDs := make(map[string]string)
+	packageCompilers := make(map[string]func() error)
+	var cacheHits, cacheMisses int
 	optLevel, sizeLevel, _ := config.OptLevels()
 	for _, pkg := range lprogram.Sorted() {
 		pkg := pkg // necessary to avoid a race condition
 
 		var undefinedGlobals []string
-		for name := range config.Options.GlobalValues[pkg.Pkg.Path()] {
+		for name := range config.GlobalValues()[pkg.Pkg.Path()] {
 			undefinedGlobals = append(undefinedGlobals, name)
 		}
 		sort.Strings(undefinedGlobals)
 
+		pkgConfig := compilerConfig
+		if pkg.ImportPath == coveredPkgPath {
+			coverConfig := *compilerConfig
+			coverConfig.Coverage = true
+			pkgConfig = &coverConfig
+		}
+
 		// Create a cache key: a hash from the action ID below that contains all
 		// the parameters for the build.
 		actionID := packageAction{
@@ -153,7 +214,7 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 			CompilerVersion:  compiler.Version,
 			InterpVersion:    interp.Version,
 			LLVMVersion:      llvm.Version,
-			Config:           compilerConfig,
+			Config:           pkgConfig,
 			CFlags:           pkg.CFlags,
 			FileHashes:       make(map[string]string, len(pkg.FileHashes)),
 			Imports:          make(map[string]string, len(pkg.Pkg.Imports())),
@@ -189,124 +250,153 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 		bitcodePath := filepath.Join(cacheDir, "pkg-"+hex.EncodeToString(hash[:])+".bc")
 		packageBitcodePaths[pkg.ImportPath] = bitcodePath
 
-		// Check whether this package has been compiled before, and if so don't
-		// compile it again.
-		if _, err := os.Stat(bitcodePath); err == nil {
-			// Already cached, don't recreate this package.
-			continue
-		}
+		// Compile the package to a bitcode file in the cache. This is done by
+		// a job if the package isn't cached yet, and again by the link job
+		// below if the cached bitcode file turns out to be unreadable.
+		compilePackage := func() error {
+			// Compile AST to IR. The compiler.CompilePackage function will
+			// build the SSA as needed.
+			mod, errs := compiler.CompilePackage(pkg.ImportPath, pkg, program.Package(pkg.Pkg), machine, pkgConfig, config.DumpSSA())
+			if errs != nil {
+				return newMultiError(errs)
+			}
+			if err := llvm.VerifyModule(mod, llvm.PrintMessageAction); err != nil {
+				return errors.New("verification error after compiling package " + pkg.ImportPath)
+			}
 
-		// The package has not yet been compiled, so create a job to do so.
-		job := &compileJob{
-			description: "compile package " + pkg.ImportPath,
-			run: func(*compileJob) error {
-				// Compile AST to IR. The compiler.CompilePackage function will
-				// build the SSA as needed.
-				mod, errs := compiler.CompilePackage(pkg.ImportPath, pkg, program.Package(pkg.Pkg), machine, compilerConfig, config.DumpSSA())
-				if errs != nil {
-					return newMultiError(errs)
-				}
-				if err := llvm.VerifyModule(mod, llvm.PrintMessageAction); err != nil {
-					return errors.New("verification error after compiling package " + pkg.ImportPath)
+			// Erase all globals that are part of the undefinedGlobals list.
+			// This list comes from the -ldflags="-X pkg.foo=val" option.
+			// Instead of setting the value directly in the AST (which would
+			// mean the value, which may be a secret, is stored in the build
+			// cache), the global itself is left external (undefined) and is
+			// only set at the end of the compilation.
+			pkgInit := mod.NamedFunction(pkg.Pkg.Path() + ".init")
+			for _, name := range undefinedGlobals {
+				globalName := pkg.Pkg.Path() + "." + name
+				global := mod.NamedGlobal(globalName)
+				if global.IsNil() {
+					// Like the Go linker, ignore variables that don't
+					// exist.
+					continue
 				}
-
-				// Erase all globals that are part of the undefinedGlobals list.
-				// This list comes from the -ldflags="-X pkg.foo=val" option.
-				// Instead of setting the value directly in the AST (which would
-				// mean the value, which may be a secret, is stored in the build
-				// cache), the global itself is left external (undefined) and is
-				// only set at the end of the compilation.
-				for _, name := range undefinedGlobals {
-					globalName := pkg.Pkg.Path() + "." + name
-					global := mod.NamedGlobal(globalName)
-					if global.IsNil() {
-						return errors.New("global not found: " + globalName)
+				// Like the Go linker, the value also replaces a constant
+				// initializer (var version = "dev"). Remove the store of
+				// this constant from the package initializer.
+				var stores []llvm.Value
+				for use := global.FirstUse(); !use.IsNil(); use = use.NextUse() {
+					store := use.User()
+					if store.IsAStoreInst().IsNil() || store.Operand(1) != global || store.InstructionParent().Parent() != pkgInit {
+						continue
 					}
-					name := global.Name()
-					newGlobal := llvm.AddGlobal(mod, global.Type().ElementType(), name+".tmp")
-					global.ReplaceAllUsesWith(newGlobal)
-					global.EraseFromParentAsGlobal()
-					newGlobal.SetName(name)
-				}
-
-				// Try to interpret package initializers at compile time.
-				// It may only be possible to do this partially, in which case
-				// it is completed after all IR files are linked.
-				pkgInit := mod.NamedFunction(pkg.Pkg.Path() + ".init")
-				if pkgInit.IsNil() {
-					panic("init not found for " + pkg.Pkg.Path())
-				}
-				err := interp.RunFunc(pkgInit, config.DumpSSA())
-				if err != nil {
-					return err
+					if !store.Operand(0).IsConstant() {
+						continue
+					}
+					stores = append(stores, store)
 				}
-				if err := llvm.VerifyModule(mod, llvm.PrintMessageAction); err != nil {
-					return errors.New("verification error after interpreting " + pkgInit.Name())
+				for _, store := range stores {
+					store.EraseFromParentAsInstruction()
 				}
+				name := global.Name()
+				newGlobal := llvm.AddGlobal(mod, global.Type().ElementType(), name+".tmp")
+				global.ReplaceAllUsesWith(newGlobal)
+				global.EraseFromParentAsGlobal()
+				newGlobal.SetName(name)
+			}
 
-				if sizeLevel >= 2 {
-					// Set the "optsize" attribute to make slightly smaller
-					// binaries at the cost of some performance.
-					kind := llvm.AttributeKindID("optsize")
-					attr := mod.Context().CreateEnumAttribute(kind, 0)
-					for fn := mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
-						fn.AddFunctionAttr(attr)
-					}
-				}
+			// Try to interpret package initializers at compile time.
+			// It may only be possible to do this partially, in which case
+			// it is completed after all IR files are linked.
+			if pkgInit.IsNil() {
+				panic("init not found for " + pkg.Pkg.Path())
+			}
+			err := interp.RunFunc(pkgInit, config.DumpSSA())
+			if err != nil {
+				return err
+			}
+			if err := llvm.VerifyModule(mod, llvm.PrintMessageAction); err != nil {
+				return errors.New("verification error after interpreting " + pkgInit.Name())
+			}
 
-				// Run function passes for each function in the module.
-				// These passes are intended to be run on each function right
-				// after they're created to reduce IR size (and maybe also for
-				// cache locality to improve performance), but for now they're
-				// run here for each function in turn. Maybe this can be
-				// improved in the future.
-				builder := llvm.NewPassManagerBuilder()
-				defer builder.Dispose()
-				builder.SetOptLevel(optLevel)
-				builder.SetSizeLevel(sizeLevel)
-				funcPasses := llvm.NewFunctionPassManagerForModule(mod)
-				defer funcPasses.Dispose()
-				builder.PopulateFunc(funcPasses)
-				funcPasses.InitializeFunc()
+			if sizeLevel >= 2 {
+				// Set the "optsize" attribute to make slightly smaller
+				// binaries at the cost of some performance.
+				kind := llvm.AttributeKindID("optsize")
+				attr := mod.Context().CreateEnumAttribute(kind, 0)
 				for fn := mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
-					if fn.IsDeclaration() {
-						continue
-					}
-					funcPasses.RunFunc(fn)
+					fn.AddFunctionAttr(attr)
 				}
-				funcPasses.FinalizeFunc()
+			}
 
-				// Serialize the LLVM module as a bitcode file.
-				// Write to a temporary path that is renamed to the destination
-				// file to avoid race conditions with other TinyGo invocatiosn
-				// that might also be compiling this package at the same time.
-				f, err := ioutil.TempFile(filepath.Dir(bitcodePath), filepath.Base(bitcodePath))
-				if err != nil {
-					return err
-				}
-				if runtime.GOOS == "windows" {
-					// Work around a problem on Windows.
-					// For some reason, WriteBitcodeToFile causes TinyGo to
-					// exit with the following message:
-					//   LLVM ERROR: IO failure on output stream: Bad file descriptor
-					buf := llvm.WriteBitcodeToMemoryBuffer(mod)
-					defer buf.Dispose()
-					_, err = f.Write(buf.Bytes())
-				} else {
-					// Otherwise, write bitcode directly to the file (probably
-					// faster).
-					err = llvm.WriteBitcodeToFile(mod, f)
-				}
-				if err != nil {
-					// WriteBitcodeToFile doesn't produce a useful error on its
-					// own, so create a somewhat useful error message here.
-					return fmt.Errorf("failed to write bitcode for package %s to file %s", pkg.ImportPath, bitcodePath)
-				}
-				err = f.Close()
-				if err != nil {
-					return err
+			// Run function passes for each function in the module.
+			// These passes are intended to be run on each function right
+			// after they're created to reduce IR size (and maybe also for
+			// cache locality to improve performance), but for now they're
+			// run here for each function in turn. Maybe this can be
+			// improved in the future.
+			builder := llvm.NewPassManagerBuilder()
+			defer builder.Dispose()
+			builder.SetOptLevel(optLevel)
+			builder.SetSizeLevel(sizeLevel)
+			funcPasses := llvm.NewFunctionPassManagerForModule(mod)
+			defer funcPasses.Dispose()
+			builder.PopulateFunc(funcPasses)
+			funcPasses.InitializeFunc()
+			for fn := mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+				if fn.IsDeclaration() {
+					continue
 				}
-				return os.Rename(f.Name(), bitcodePath)
+				funcPasses.RunFunc(fn)
+			}
+			funcPasses.FinalizeFunc()
+
+			// Serialize the LLVM module as a bitcode file.
+			// Write to a temporary path that is renamed to the destination
+			// file to avoid race conditions with other TinyGo invocatiosn
+			// that might also be compiling this package at the same time.
+			f, err := ioutil.TempFile(filepath.Dir(bitcodePath), filepath.Base(bitcodePath))
+			if err != nil {
+				return err
+			}
+			if runtime.GOOS == "windows" {
+				// Work around a problem on Windows.
+				// For some reason, WriteBitcodeToFile causes TinyGo to
+				// exit with the following message:
+				//   LLVM ERROR: IO failure on output stream: Bad file descriptor
+				buf := llvm.WriteBitcodeToMemoryBuffer(mod)
+				defer buf.Dispose()
+				_, err = f.Write(buf.Bytes())
+			} else {
+				// Otherwise, write bitcode directly to the file (probably
+				// faster).
+				err = llvm.WriteBitcodeToFile(mod, f)
+			}
+			if err != nil {
+				// WriteBitcodeToFile doesn't produce a useful error on its
+				// own, so create a somewhat useful error message here.
+				return fmt.Errorf("failed to write bitcode for package %s to file %s", pkg.ImportPath, bitcodePath)
+			}
+			err = f.Close()
+			if err != nil {
+				return err
+			}
+			return os.Rename(f.Name(), bitcodePath)
+		}
+		packageCompilers[pkg.ImportPath] = compilePackage
+
+		// Check whether this package has been compiled before, and if so don't
+		// compile it again.
+		if _, err := os.Stat(bitcodePath); err == nil {
+			// Already cached, don't recreate this package.
+			cacheHits++
+			continue
+		}
+		cacheMisses++
+
+		// The package has not yet been compiled, so create a job to do so.
+		job := &compileJob{
+			description: "compile package " + pkg.ImportPath,
+			run: func(*compileJob) error {
+				return compilePackage()
 			},
 		}
 		jobs = append(jobs, job)
@@ -327,7 +417,40 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 			for _, pkg := range lprogram.Sorted() {
 				pkgMod, err := ctx.ParseBitcodeFile(packageBitcodePaths[pkg.ImportPath])
 				if err != nil {
-					return fmt.Errorf("failed to load bitcode file: %w", err)
+					// The cached bitcode file is unreadable, for example
+					// because it was truncated. Compile the package again,
+					// which replaces the file in the cache.
+					err = packageCompilers[pkg.ImportPath]()
+					if err != nil {
+						return err
+					}
+					pkgMod, err = ctx.ParseBitcodeFile(packageBitcodePaths[pkg.ImportPath])
+					if err != nil {
+						return fmt.Errorf("failed to load bitcode file: %w", err)
+					}
+				}
+				if cArchive && pkg != lprogram.MainPkg() {
+					// The C program may define some of the same symbols as
+					// the runtime, such as main, Reset_Handler or malloc.
+					// Make the functions exported from other packages than
+					// the main package weak, so that those of the C program
+					// take precedence.
+					for fn := pkgMod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+						if !fn.IsDeclaration() && fn.Linkage() == llvm.ExternalLinkage && fn.Visibility() == llvm.DefaultVisibility && fn.Name() != "tinygo_init" {
+							fn.SetLinkage(llvm.WeakAnyLinkage)
+						}
+					}
+				}
+				if cShared && pkg != lprogram.MainPkg() {
+					// Only the functions exported from the main package are
+					// part of the API of the shared library. Hide the others
+					// (such as main in the runtime), so that they don't
+					// conflict with the symbols of the host program.
+					for fn := pkgMod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+						if !fn.IsDeclaration() && fn.Linkage() == llvm.ExternalLinkage {
+							fn.SetVisibility(llvm.HiddenVisibility)
+						}
+					}
 				}
 				err = llvm.LinkModules(mod, pkgMod)
 				if err != nil {
@@ -356,6 +479,14 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 			}
 			irbuilder.CreateRetVoid()
 
+			// Let the runtime know where the coverage data is stored.
+			if coveredPkgPath != "" {
+				err := setCoverageGlobals(mod, coveredPkgPath)
+				if err != nil {
+					return err
+				}
+			}
+
 			// After linking, functions should (as far as possible) be set to
 			// private linkage or internal linkage. The compiler package marks
 			// non-exported functions by setting the visibility to hidden or
@@ -407,7 +538,7 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 	outext := filepath.Ext(outpath)
 	if outext == ".o" || outext == ".bc" || outext == ".ll" {
 		// Run jobs to produce the LLVM module.
-		err := runJobs(jobs)
+		err := runJobs(jobs, config.Options.Parallelism)
 		if err != nil {
 			return err
 		}
@@ -456,13 +587,33 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 	tmppath := executable // final file
 	ldflags := append(config.LDFlags(), "-o", executable)
 
+	// Generate the linker script from the memory layout in the target
+	// specification, if there is one.
+	if config.Target.HasMemoryLayout() {
+		script, err := config.Target.GenerateLinkerScript()
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, "linker.ld")
+		err = ioutil.WriteFile(path, []byte(script), 0666)
+		if err != nil {
+			return err
+		}
+		ldflags = append(ldflags, "-T", path)
+	}
+
 	// Add compiler-rt dependency if needed. Usually this is a simple load from
-	// a cache.
-	if config.Target.RTLib == "compiler-rt" {
-		job, err := CompilerRT.load(config.Triple(), config.CPU(), dir)
+	// a cache. A C archive relies on the libraries of the C program instead.
+	if config.Target.RTLib == "compiler-rt" && !cArchive {
+		job, err := CompilerRT.load(config.Triple(), config.CPU(), config.FloatABI(), dir, config.Options.PrintCommands)
 		if err != nil {
 			return err
 		}
+		if job.run == nil {
+			cacheHits++ // dummy job: cached or precompiled
+		} else {
+			cacheMisses++
+		}
 		jobs = append(jobs, job.dependencies...)
 		jobs = append(jobs, job)
 		linkerDependencies = append(linkerDependencies, job)
@@ -470,12 +621,21 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 
 	// Add libc dependency if needed.
 	root := goenv.Get("TINYGOROOT")
-	switch config.Target.Libc {
+	libc := config.Target.Libc
+	if cArchive {
+		libc = ""
+	}
+	switch libc {
 	case "picolibc":
-		job, err := Picolibc.load(config.Triple(), config.CPU(), dir)
+		job, err := Picolibc.load(config.Triple(), config.CPU(), config.FloatABI(), dir, config.Options.PrintCommands)
 		if err != nil {
 			return err
 		}
+		if job.run == nil {
+			cacheHits++ // dummy job: cached or precompiled
+		} else {
+			cacheMisses++
+		}
 		// The library needs to be compiled (cache miss).
 		jobs = append(jobs, job.dependencies...)
 		jobs = append(jobs, job)
@@ -489,14 +649,17 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 	case "":
 		// no library specified, so nothing to do
 	default:
-		return fmt.Errorf("unknown libc: %s", config.Target.Libc)
+		return fmt.Errorf("unknown libc: %s", libc)
 	}
 
 	// Add jobs to compile extra files. These files are in C or assembly and
 	// contain things like the interrupt vector table and low level operations
 	// such as stack switching.
 	for _, path := range config.ExtraFiles() {
-		abspath := filepath.Join(root, path)
+		abspath := path
+		if !filepath.IsAbs(path) {
+			abspath = filepath.Join(root, path)
+		}
 		job := &compileJob{
 			description: "compile extra file " + path,
 			run: func(job *compileJob) error {
@@ -509,17 +672,30 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 		linkerDependencies = append(linkerDependencies, job)
 	}
 
-	// Add jobs to compile C files in all packages. This is part of CGo.
+	// With -arduino, add a job to compile the Arduino core of the board and the
+	// Arduino libraries given with -arduino-libs into a static library.
+	if config.Arduino() {
+		job, err := loadArduino(config, dir)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, job.dependencies...)
+		jobs = append(jobs, job)
+		linkerDependencies = append(linkerDependencies, job)
+	}
+
+	// Add jobs to compile C and C++ files in all packages. This is part of CGo.
 	// TODO: do this as part of building the package to be able to link the
 	// bitcode files together.
 	for _, pkg := range lprogram.Sorted() {
 		pkg := pkg
-		for _, filename := range pkg.CFiles {
+		for _, filename := range append(pkg.CFiles[:len(pkg.CFiles):len(pkg.CFiles)], pkg.CXXFiles...) {
 			abspath := filepath.Join(pkg.Dir, filename)
+			cflags := cgoFileFlags(pkg, abspath)
 			job := &compileJob{
 				description: "compile CGo file " + abspath,
 				run: func(job *compileJob) error {
-					result, err := compileAndCacheCFile(abspath, dir, pkg.CFlags, config.Options.PrintCommands)
+					result, err := compileAndCacheCFile(abspath, dir, cflags, config.Options.PrintCommands)
 					job.result = result
 					return err
 				},
@@ -535,6 +711,53 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 		ldflags = append(ldflags, lprogram.LDFlags...)
 	}
 
+	// With -panic=trace, the program is first linked with an empty symbol
+	// table, which is replaced with the actual symbol table after linking.
+	symtabPath := filepath.Join(dir, "symtab.o")
+	if config.PanicStrategy() == "trace" {
+		err := writeSymbolTableObject(symtabPath, makeSymbolTable(nil), config.Triple(), machine)
+		if err != nil {
+			return err
+		}
+		ldflags = append(ldflags, symtabPath)
+	}
+
+	// With -buildmode=c-archive, -buildmode=zephyr, -buildmode=freertos or
+	// -buildmode=customos, put all object files in a static library instead of
+	// linking them, and write a header for the exported functions.
+	if cArchive {
+		archive := filepath.Join(dir, "main.a")
+		jobs = append(jobs, &compileJob{
+			description:  "create archive",
+			dependencies: linkerDependencies,
+			result:       archive,
+			run: func(job *compileJob) error {
+				var objs []string
+				for _, dependency := range job.dependencies {
+					objs = append(objs, dependency.result)
+				}
+				return makeArchive(archive, objs)
+			},
+		})
+		err = runJobs(jobs, config.Options.Parallelism)
+		if err != nil {
+			return err
+		}
+		if goenv.Get("GOCACHE") != "off" {
+			addCacheHits(cacheHits, cacheMisses)
+		}
+		err = writeCHeader(strings.TrimSuffix(outpath, ".a")+".h", lprogram.MainPkg(), config.BuildMode())
+		if err != nil {
+			return err
+		}
+		return action(BuildResult{
+			Binary:     archive,
+			Executable: archive,
+			MainDir:    lprogram.MainPkg().Dir,
+			ImportPath: lprogram.MainPkg().ImportPath,
+		})
+	}
+
 	// Create a linker job, which links all object files together and does some
 	// extra stuff that can only be done after linking.
 	jobs = append(jobs, &compileJob{
@@ -547,6 +770,15 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 				}
 				ldflags = append(ldflags, dependency.result)
 			}
+			if strings.HasPrefix(config.Triple(), "avr") {
+				// Use the floating point routines of avr-libc, which are
+				// written in assembly, instead of the (much slower) generic C
+				// versions that some libgcc builds contain. avr-gcc adds
+				// libgcc after all other arguments, so libm needs to be added
+				// explicitly for it to take precedence. The 64-bit division
+				// routines of libgcc are already written in assembly.
+				ldflags = append(ldflags, "-lm")
+			}
 			if config.Options.PrintCommands {
 				fmt.Printf("%s %s\n", config.Target.Linker, strings.Join(ldflags, " "))
 			}
@@ -554,10 +786,22 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 			if err != nil {
 				return &commandError{"failed to link", executable, err}
 			}
+			if config.PanicStrategy() == "trace" {
+				err = addSymbolTable(executable, symtabPath, config.Triple(), machine, func() error {
+					err := link(config.Target.Linker, ldflags...)
+					if err != nil {
+						return &commandError{"failed to link", executable, err}
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
 
 			var calculatedStacks []string
 			var stackSizes map[string]functionStackSize
-			if config.Options.PrintStacks || config.AutomaticStackSize() {
+			if config.Options.PrintStacks || config.AutomaticStackSize() || (config.RAMReport() && config.Scheduler() == "tasks") {
 				// Try to determine stack sizes at compile time.
 				// Don't do this by default as it usually doesn't work on
 				// unsupported architectures.
@@ -575,22 +819,14 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 				}
 			}
 
-			if config.Options.PrintSizes == "short" || config.Options.PrintSizes == "full" {
+			if config.Options.PrintSizes != "" && config.Options.PrintSizes != "none" {
 				sizes, err := loadProgramSize(executable)
 				if err != nil {
 					return err
 				}
-				if config.Options.PrintSizes == "short" {
-					fmt.Printf("   code    data     bss |   flash     ram\n")
-					fmt.Printf("%7d %7d %7d | %7d %7d\n", sizes.Code, sizes.Data, sizes.BSS, sizes.Code+sizes.Data, sizes.Data+sizes.BSS)
-				} else {
-					fmt.Printf("   code  rodata    data     bss |   flash     ram | package\n")
-					for _, name := range sizes.sortedPackageNames() {
-						pkgSize := sizes.Packages[name]
-						fmt.Printf("%7d %7d %7d %7d | %7d %7d | %s\n", pkgSize.Code, pkgSize.ROData, pkgSize.Data, pkgSize.BSS, pkgSize.Flash(), pkgSize.RAM(), name)
-					}
-					fmt.Printf("%7d %7d %7d %7d | %7d %7d | (sum)\n", sizes.Sum.Code, sizes.Sum.ROData, sizes.Sum.Data, sizes.Sum.BSS, sizes.Sum.Flash(), sizes.Sum.RAM())
-					fmt.Printf("%7d       - %7d %7d | %7d %7d | (all)\n", sizes.Code, sizes.Data, sizes.BSS, sizes.Code+sizes.Data, sizes.Data+sizes.BSS)
+				err = printProgramSize(os.Stdout, sizes, config.Options.PrintSizes)
+				if err != nil {
+					return err
 				}
 			}
 
@@ -599,6 +835,28 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 				printStacks(calculatedStacks, stackSizes)
 			}
 
+			// Calculate the worst-case RAM usage: globals, the stacks of all
+			// goroutines and the heap that should remain available.
+			if config.RAMReport() {
+				sizes, err := loadProgramSize(executable)
+				if err != nil {
+					return err
+				}
+				report := makeRAMReport(config, sizes, calculatedStacks, stackSizes)
+				if format := config.Options.RAMReport; format != "" && format != "none" {
+					err = report.print(os.Stdout, format)
+					if err != nil {
+						return err
+					}
+				}
+				if config.Options.RAMCheck {
+					err = report.check()
+					if err != nil {
+						return err
+					}
+				}
+			}
+
 			return nil
 		},
 	})
@@ -606,28 +864,54 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 	// Run all jobs to compile and link the program.
 	// Do this now (instead of after elf-to-hex and similar conversions) as it
 	// is simpler and cannot be parallelized.
-	err = runJobs(jobs)
+	err = runJobs(jobs, config.Options.Parallelism)
 	if err != nil {
 		return err
 	}
 
+	// Keep track of how well the build cache works, as shown by tinygo cache.
+	// This is only done once the build succeeded, so that the packages and
+	// libraries that were counted as misses are now actually in the cache.
+	// These statistics are not critical, so errors are ignored.
+	if goenv.Get("GOCACHE") != "off" {
+		addCacheHits(cacheHits, cacheMisses)
+	}
+
+	// With -buildmode=c-shared, write a header for the exported functions next
+	// to the shared library.
+	if cShared {
+		err = writeCHeader(strings.TrimSuffix(outpath, sharedExt)+".h", lprogram.MainPkg(), "c-shared")
+		if err != nil {
+			return err
+		}
+	}
+
 	// Get an Intel .hex file or .bin file from the .elf file.
 	outputBinaryFormat := config.BinaryFormat(outext)
 	switch outputBinaryFormat {
 	case "elf":
+		if config.Options.MCUboot {
+			return errors.New("-mcuboot requires a .bin or .hex output file")
+		}
 		// do nothing, file is already in ELF format
 	case "hex", "bin":
 		// Extract raw binary, either encoding it as a hex file or as a raw
 		// firmware file.
 		tmppath = filepath.Join(dir, "main"+outext)
-		err := objcopy(executable, tmppath, outputBinaryFormat)
+		if config.Options.PrintCommands {
+			// The conversion is done internally, print the equivalent
+			// objcopy command.
+			objcopyFormat := map[string]string{"hex": "ihex", "bin": "binary"}[outputBinaryFormat]
+			fmt.Printf("objcopy -O %s %s %s\n", objcopyFormat, executable, tmppath)
+		}
+		err := objcopy(executable, tmppath, outputBinaryFormat, config.MergeHexFiles())
 		if err != nil {
 			return err
 		}
 	case "uf2":
 		// Get UF2 from the .elf file.
 		tmppath = filepath.Join(dir, "main"+outext)
-		err := convertELFFileToUF2File(executable, tmppath, config.Target.UF2FamilyID)
+		err := convertELFFileToUF2File(executable, tmppath, config.Target.UF2FamilyID, config.Target.UF2BaseAddress)
 		if err != nil {
 			return err
 		}
@@ -635,7 +919,16 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 		// Special format for the ESP family of chips (parsed by the ROM
 		// bootloader).
 		tmppath = filepath.Join(dir, "main"+outext)
-		err := makeESPFirmareImage(executable, tmppath, outputBinaryFormat)
+		flash := espFlashParams{config.Target.ESPFlashMode, config.Target.ESPFlashFreq, config.Target.ESPFlashSize}
+		err := makeESPFirmareImage(executable, tmppath, outputBinaryFormat, flash)
+		if err != nil {
+			return err
+		}
+	case "mcuboot-bin", "mcuboot-hex":
+		// Image for the MCUboot bootloader: a header with the version, the
+		// program, and a trailer with a hash and an optional signature.
+		tmppath = filepath.Join(dir, "main"+outext)
+		err := makeMCUbootImage(executable, tmppath, outputBinaryFormat, config.Options.ImageVersion, config.Options.ImageKey)
 		if err != nil {
 			return err
 		}
@@ -644,6 +937,7 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 	}
 	return action(BuildResult{
 		Binary:     tmppath,
+		Executable: executable,
 		MainDir:    lprogram.MainPkg().Dir,
 		ImportPath: lprogram.MainPkg().ImportPath,
 	})
@@ -675,11 +969,20 @@ func optimizeProgram(mod llvm.Module, config *compileopts.Config) error {
 	}
 
 	// Insert values from -ldflags="-X ..." into the IR.
-	err = setGlobalValues(mod, config.Options.GlobalValues)
+	err = setGlobalValues(mod, config.GlobalValues())
 	if err != nil {
 		return err
 	}
 
+	// Record allocation sites for runtime/pprof heap profiles and for
+	// allocation tracing.
+	if config.Options.HeapProfile || config.Options.AllocTrace {
+		err := transform.InstrumentHeapProfile(mod)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Browsers cannot handle external functions that have type i64 because it
 	// cannot be represented exactly in JavaScript (JS only has doubles). To
 	// keep functions interoperable, pass int64 types as pointers to
@@ -904,6 +1207,26 @@ func determineStackSizes(mod llvm.Module, executable string) ([]string, map[stri
 	return gowrappers, sizes, nil
 }
 
+// goroutineStackOverhead returns the number of bytes that are added to the
+// calculated stack size of a goroutine. On ARM, Cortex-M is assumed.
+func goroutineStackOverhead(arm bool) uint64 {
+	// Adding 4 for the stack canary. Even though the size may be
+	// automatically determined, stack overflow checking is still important as
+	// the stack size cannot be determined for all goroutines.
+	overhead := uint64(4)
+
+	// Add stack size used by interrupts.
+	if arm {
+		// On Cortex-M, this stack size is 8 words or 32 bytes. This is only to
+		// store the registers that the interrupt may modify, the interrupt will
+		// switch to the interrupt stack (MSP).
+		// Some background:
+		// https://interrupt.memfault.com/blog/cortex-m-rtos-context-switching
+		overhead += 32
+	}
+	return overhead
+}
+
 // modifyStackSizes modifies the .tinygo_stacksizes section with the updated
 // stack size information. Before this modification, all stack sizes in the
 // section assume the default stack size (which is relatively big).
@@ -953,23 +1276,7 @@ func modifyStackSizes(executable string, stackSizeLoads []string, stackSizes map
 		if fn.stackSizeType == stacksize.Bounded {
 			stackSize := uint32(fn.stackSize)
 
-			// Adding 4 for the stack canary. Even though the size may be
-			// automatically determined, stack overflow checking is still
-			// important as the stack size cannot be determined for all
-			// goroutines.
-			stackSize += 4
-
-			// Add stack size used by interrupts.
-			switch elfFile.Machine {
-			case elf.EM_ARM:
-				// On Cortex-M (assumed here), this stack size is 8 words or 32
-				// bytes. This is only to store the registers that the interrupt
-				// may modify, the interrupt will switch to the interrupt stack
-				// (MSP).
-				// Some background:
-				// https://interrupt.memfault.com/blog/cortex-m-rtos-context-switching
-				stackSize += 32
-			}
+			stackSize += uint32(goroutineStackOverhead(elfFile.Machine == elf.EM_ARM))
 
 			// Finally write the stack size to the binary.
 			binary.LittleEndian.PutUint32(data[i*4:], stackSize)
@@ -1,7 +1,9 @@
 package builder
 
 import (
+	"encoding/json"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
@@ -76,6 +78,114 @@ func cacheStore(tmppath, name string, sourceFiles []string) (string, error) {
 	return cachepath, nil
 }
 
+// CacheStats contains statistics about the build cache, as shown by the tinygo
+// cache command.
+type CacheStats struct {
+	Dir    string `json:"dir"`    // cache directory
+	Files  int    `json:"files"`  // number of files in the cache
+	Size   int64  `json:"size"`   // total size of all files in bytes
+	Hits   int    `json:"hits"`   // packages and libraries loaded from the cache
+	Misses int    `json:"misses"` // packages and libraries that had to be built
+}
+
+// cacheStatsPath returns the path of the file in the cache directory where the
+// number of cache hits and misses is stored.
+func cacheStatsPath() string {
+	return filepath.Join(goenv.Get("GOCACHE"), "stats.json")
+}
+
+// ReadCacheStats returns the size of the cache and the number of cache hits and
+// misses since the cache was last cleaned.
+func ReadCacheStats() (CacheStats, error) {
+	stats, err := readCacheHits()
+	if err != nil {
+		return stats, err
+	}
+	stats.Dir = goenv.Get("GOCACHE")
+	err = filepath.Walk(stats.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == stats.Dir {
+				return filepath.SkipDir // no cache directory yet
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			stats.Files++
+			stats.Size += info.Size()
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// readCacheHits reads the number of cache hits and misses stored in the cache
+// directory.
+func readCacheHits() (CacheStats, error) {
+	var stats CacheStats
+	data, err := ioutil.ReadFile(cacheStatsPath())
+	if os.IsNotExist(err) {
+		return stats, nil
+	} else if err != nil {
+		return stats, err
+	}
+	err = json.Unmarshal(data, &stats)
+	return stats, err
+}
+
+// addCacheHits adds the given number of cache hits and misses to the numbers
+// stored in the cache directory. Updates may be lost when multiple builds run
+// at the same time, which is acceptable for these statistics.
+func addCacheHits(hits, misses int) error {
+	stats, err := readCacheHits()
+	if err != nil {
+		// Corrupted statistics file, start over.
+		stats = CacheStats{}
+	}
+	stats.Hits += hits
+	stats.Misses += misses
+	data, err := json.Marshal(CacheStats{Hits: stats.Hits, Misses: stats.Misses})
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(goenv.Get("GOCACHE"), 0777)
+	if err != nil {
+		return err
+	}
+	path := cacheStatsPath()
+	err = ioutil.WriteFile(path+".tmp", data, 0666)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// CleanCache removes the cache directory. If keepLibraries is set, only the
+// compiled packages, C files and other build outputs are removed and the
+// libraries (such as compiler-rt and picolibc), which take a long time to
+// build, are kept.
+func CleanCache(keepLibraries bool) error {
+	dir := goenv.Get("GOCACHE")
+	if !keepLibraries {
+		return os.RemoveAll(dir)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() && filepath.Ext(entry.Name()) == ".a" {
+			continue // library, see Library.load
+		}
+		err := os.RemoveAll(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // copyFile copies the given file from src to dst. It can copy over
 // a possibly already existing file at the destination.
 func copyFile(src, dst string) error {
@@ -0,0 +1,98 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinygo-cache")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(dir)
+	oldCache := os.Getenv("TINYGOCACHE")
+	defer os.Setenv("TINYGOCACHE", oldCache)
+	os.Setenv("TINYGOCACHE", filepath.Join(dir, "cache"))
+
+	// The cache directory doesn't exist yet.
+	stats, err := ReadCacheStats()
+	if err != nil {
+		t.Fatal("could not read cache stats:", err)
+	}
+	if stats.Files != 0 || stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("expected empty cache stats, got %+v", stats)
+	}
+
+	for _, counts := range [][2]int{{3, 2}, {5, 0}} {
+		err := addCacheHits(counts[0], counts[1])
+		if err != nil {
+			t.Fatal("could not update cache stats:", err)
+		}
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "cache", "pkg-test.bc"), make([]byte, 100), 0666)
+	if err != nil {
+		t.Fatal("could not write cache file:", err)
+	}
+	stats, err = ReadCacheStats()
+	if err != nil {
+		t.Fatal("could not read cache stats:", err)
+	}
+	if stats.Hits != 8 || stats.Misses != 2 {
+		t.Errorf("expected 8 hits and 2 misses, got %+v", stats)
+	}
+	if stats.Files != 2 { // pkg-test.bc and stats.json
+		t.Errorf("expected 2 files in the cache, got %+v", stats)
+	}
+}
+
+func TestCleanCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinygo-cache")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(dir)
+	oldCache := os.Getenv("TINYGOCACHE")
+	defer os.Setenv("TINYGOCACHE", oldCache)
+	cacheDir := filepath.Join(dir, "cache")
+	os.Setenv("TINYGOCACHE", cacheDir)
+
+	// Cleaning a cache that doesn't exist yet is not an error.
+	if err := CleanCache(true); err != nil {
+		t.Fatal("could not clean missing cache:", err)
+	}
+
+	for _, name := range []string{"pkg-test.bc", "obj-test.o", "compiler-rt-thumbv7em-none-eabi-cortex-m4.a", "goroot-test/src/x.go"} {
+		path := filepath.Join(cacheDir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0777)
+		if err := ioutil.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal("could not write cache file:", err)
+		}
+	}
+
+	// With -keep-libraries, only the libraries are kept.
+	if err := CleanCache(true); err != nil {
+		t.Fatal("could not clean cache:", err)
+	}
+	entries, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal("could not read cache directory:", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "compiler-rt-thumbv7em-none-eabi-cortex-m4.a" {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("expected only the library to be kept, got %v", names)
+	}
+
+	// By default, the entire cache directory is removed.
+	if err := CleanCache(false); err != nil {
+		t.Fatal("could not clean cache:", err)
+	}
+	if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Errorf("expected the cache directory to be removed, got %v", err)
+	}
+}
@@ -1,7 +1,10 @@
 package builder
 
 import (
+	"path/filepath"
 	"strings"
+
+	"github.com/tinygo-org/tinygo/goenv"
 )
 
 // These are the GENERIC_SOURCES according to CMakeList.txt.
@@ -151,6 +154,32 @@ var aeabiBuiltins = []string{
 	"arm/aeabi_uldivmod.S",
 }
 
+// These are hand-written assembly versions of the most used builtins for
+// ARMv6-M (Cortex-M0 and Cortex-M0+), which has no division instruction and
+// no FPU. The generic C versions are a lot slower on this architecture.
+// They are stored in lib/tinygo-builtins/armv6m. AVR has no such list: the
+// float routines of avr-libc and the 64-bit division of libgcc are already
+// written in assembly for each AVR core, and are linked in by the builder.
+var armv6mBuiltins = []string{
+	"aeabi_fadd.S",
+	"aeabi_fmul.S",
+	"aeabi_idiv.S",
+	"aeabi_ldivmod.S",
+}
+
+// These compiler-rt sources are replaced by armv6mBuiltins.
+var armv6mReplacedBuiltins = map[string]bool{
+	"addsf3.c":             true,
+	"divsi3.c":             true,
+	"mulsf3.c":             true,
+	"subsf3.c":             true,
+	"udivsi3.c":            true,
+	"arm/aeabi_idivmod.S":  true,
+	"arm/aeabi_ldivmod.S":  true,
+	"arm/aeabi_uidivmod.S": true,
+	"arm/aeabi_uldivmod.S": true,
+}
+
 // CompilerRT is a library with symbols required by programs compiled with LLVM.
 // These symbols are for operations that cannot be emitted with a single
 // instruction or a short sequence of instructions for that target.
@@ -165,6 +194,18 @@ var CompilerRT = Library{
 		if strings.HasPrefix(target, "arm") || strings.HasPrefix(target, "thumb") {
 			builtins = append(builtins, aeabiBuiltins...)
 		}
+		if strings.HasPrefix(target, "armv6m") || strings.HasPrefix(target, "thumbv6m") {
+			var filtered []string
+			for _, name := range builtins {
+				if !armv6mReplacedBuiltins[name] {
+					filtered = append(filtered, name)
+				}
+			}
+			builtins = filtered
+			for _, name := range armv6mBuiltins {
+				builtins = append(builtins, filepath.Join(goenv.Get("TINYGOROOT"), "lib/tinygo-builtins/armv6m", name))
+			}
+		}
 		return builtins
 	},
 }
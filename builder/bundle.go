@@ -0,0 +1,397 @@
+package builder
+
+// This file implements tinygo bundle, which copies the parts of TINYGOROOT
+// that are needed to build a single program for a single target into a new
+// directory. The result is a relocatable TINYGOROOT that can be checked in or
+// archived, so that later builds don't depend on the installed TinyGo.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/goenv"
+	"github.com/tinygo-org/tinygo/loader"
+)
+
+// linkerScriptInclude matches INCLUDE commands in linker scripts.
+var linkerScriptInclude = regexp.MustCompile(`(?m)^\s*INCLUDE\s+"?([^"\s]+)"?`)
+
+// Bundle creates a self-contained TINYGOROOT in outdir with everything that is
+// needed to build the given package for the configured target: the tinygo
+// executable itself, the Clang headers, the TinyGo standard library overrides
+// with only the device packages that are used, the target specification and
+// linker scripts, and the sources (or precompiled archives) of the C libraries
+// that are linked in. The output directory must not exist or be empty.
+func Bundle(config *compileopts.Config, pkgName, outdir string) error {
+	root := goenv.Get("TINYGOROOT")
+	if entries, err := ioutil.ReadDir(outdir); err == nil && len(entries) != 0 {
+		return fmt.Errorf("bundle: output directory %s is not empty", outdir)
+	}
+	b := &bundler{root: root, outdir: outdir, files: make(map[string]struct{})}
+
+	// The tinygo executable. The bundle is found automatically when it is run
+	// from the bin/ directory of the bundle.
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exeName := "tinygo"
+	if runtime.GOOS == "windows" {
+		exeName += ".exe"
+	}
+	err = b.copyFile(executable, filepath.Join(outdir, "bin", exeName))
+	if err != nil {
+		return err
+	}
+
+	// The Clang headers, which are needed for CGo and C files.
+	if config.ClangHeaders == "" {
+		return errors.New("bundle: could not find the Clang headers")
+	}
+	err = b.copyDir(config.ClangHeaders, filepath.Join(outdir, "lib", "clang", "include"), nil)
+	if err != nil {
+		return err
+	}
+
+	// The TinyGo source directory, except for the device packages which make
+	// up most of it. Only the ones that are imported are copied. The device/arm
+	// package is always included, as it is used to recognize a TINYGOROOT.
+	devicePackages := map[string]struct{}{"device/arm": {}}
+	deps, err := listDependencies(config, pkgName)
+	if err != nil {
+		return err
+	}
+	for _, dep := range deps {
+		if strings.HasPrefix(dep, "device/") {
+			devicePackages[dep] = struct{}{}
+		}
+	}
+	err = b.copyDir(filepath.Join(root, "src"), filepath.Join(outdir, "src"), func(path string) bool {
+		return filepath.ToSlash(path) != "device"
+	})
+	if err != nil {
+		return err
+	}
+	for dep := range devicePackages {
+		err = b.copyDir(filepath.Join(root, "src", dep), filepath.Join(outdir, "src", dep), func(string) bool {
+			return false // only this package, not the ones below it
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// The target specification, including the targets it inherits from.
+	if config.Options.Target != "" && config.Options.Target != "simulator" {
+		err = b.copyTarget(config.Options.Target)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Files referenced by the target: linker scripts (and the linker scripts
+	// they include), extra C and assembly files, hex files to merge and any
+	// file or directory passed in the compiler or linker flags.
+	if config.Target.HasMemoryLayout() {
+		script, err := config.Target.GenerateLinkerScript()
+		if err != nil {
+			return err
+		}
+		err = b.copyLinkerScriptIncludes(script)
+		if err != nil {
+			return err
+		}
+	} else if config.Target.LinkerScript != "" {
+		err = b.copyLinkerScript(config.Target.LinkerScript)
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range config.ExtraFiles() {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+		err = b.copyPath(path)
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range config.MergeHexFiles() {
+		err = b.copyPath(path)
+		if err != nil {
+			return err
+		}
+	}
+	flags := append(config.CFlags(), config.LDFlags()...)
+	for _, flag := range flags {
+		for _, prefix := range []string{"-I", "-isystem", "-L"} {
+			flag = strings.TrimPrefix(flag, prefix)
+		}
+		err = b.copyPath(flag)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The C libraries that are linked into the program.
+	var libraries []*Library
+	if config.Target.RTLib == "compiler-rt" {
+		libraries = append(libraries, &CompilerRT)
+	}
+	switch config.Target.Libc {
+	case "picolibc":
+		libraries = append(libraries, &Picolibc)
+	case "wasi-libc":
+		err = b.copyPath(filepath.Join(root, "lib/wasi-libc/sysroot"))
+		if err != nil {
+			return err
+		}
+	}
+	for _, lib := range libraries {
+		err = b.copyLibrary(lib, config.Triple())
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(b.missing) != 0 {
+		sort.Strings(b.missing)
+		return fmt.Errorf("bundle: could not find the following files in %s:\n\t%s", root, strings.Join(b.missing, "\n\t"))
+	}
+	return nil
+}
+
+// listDependencies returns the import paths of the given package and all its
+// dependencies, as seen for the configured target.
+func listDependencies(config *compileopts.Config, pkgName string) ([]string, error) {
+	cmd, err := loader.List(config, []string{"-deps", "-f", "{{.ImportPath}}"}, []string{pkgName})
+	if err != nil {
+		return nil, err
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("bundle: failed to list dependencies of %s: %w", pkgName, err)
+	}
+	var deps []string
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		deps = append(deps, scanner.Text())
+	}
+	return deps, scanner.Err()
+}
+
+// bundler keeps track of the files copied into a bundle.
+type bundler struct {
+	root    string
+	outdir  string
+	files   map[string]struct{} // files that were already copied
+	missing []string            // files that were referenced but don't exist
+}
+
+// copyPath copies the given file or directory into the bundle, if it is
+// inside TINYGOROOT. Other paths (for example files of the project itself)
+// are left alone.
+func (b *bundler) copyPath(path string) error {
+	rel, err := filepath.Rel(b.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") || filepath.IsAbs(rel) {
+		return nil
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			b.missing = append(b.missing, filepath.ToSlash(rel))
+			return nil
+		}
+		return err
+	}
+	if st.IsDir() {
+		return b.copyDir(path, filepath.Join(b.outdir, rel), nil)
+	}
+	return b.copyFile(path, filepath.Join(b.outdir, rel))
+}
+
+// copyDir copies all files in the src directory to dst. Subdirectories are
+// only copied if recurse returns true for them (or if recurse is nil). The
+// path passed to recurse is relative to src.
+func (b *bundler) copyDir(src, dst string, recurse func(path string) bool) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if rel != "." && recurse != nil && !recurse(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return b.copyFile(path, filepath.Join(dst, rel))
+	})
+}
+
+// copyFile copies a single file, keeping its permissions. Files that were
+// already copied are skipped.
+func (b *bundler) copyFile(src, dst string) error {
+	if _, ok := b.files[dst]; ok {
+		return nil
+	}
+	b.files[dst] = struct{}{}
+	inf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer inf.Close()
+	st, err := inf.Stat()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(dst), 0777)
+	if err != nil {
+		return err
+	}
+	outf, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, st.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(outf, inf)
+	if err != nil {
+		outf.Close()
+		return err
+	}
+	return outf.Close()
+}
+
+// copyTarget copies the target specification with the given name or path and
+// the targets it inherits from into the targets/ directory of the bundle.
+// Targets outside TINYGOROOT are assumed to be part of the project and are not
+// copied, but the built-in targets they inherit from are.
+func (b *bundler) copyTarget(name string) error {
+	path := name
+	if !strings.HasSuffix(name, ".json") {
+		path = compileopts.FindTarget(name)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(name, ".json") {
+		// The target may also come from a directory in TINYGOTARGETS, store
+		// it in the targets/ directory so it is found in the bundle.
+		err = b.copyFile(path, filepath.Join(b.outdir, "targets", filepath.Base(path)))
+		if err != nil {
+			return err
+		}
+	}
+	var spec struct {
+		Inherits []string `json:"inherits"`
+	}
+	err = json.Unmarshal(data, &spec)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, inherited := range spec.Inherits {
+		if strings.HasSuffix(inherited, ".json") && !filepath.IsAbs(inherited) {
+			// Paths of inherited targets are relative to the working
+			// directory, like the target passed on the command line.
+			inherited, err = filepath.Abs(inherited)
+			if err != nil {
+				return err
+			}
+		}
+		err = b.copyTarget(inherited)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyLinkerScript copies the given linker script, relative to TINYGOROOT,
+// and all the linker scripts it includes.
+func (b *bundler) copyLinkerScript(name string) error {
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(b.root, name)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	err = b.copyPath(path)
+	if err != nil {
+		return err
+	}
+	return b.copyLinkerScriptIncludes(string(data))
+}
+
+// copyLinkerScriptIncludes copies the linker scripts included by the given
+// linker script.
+func (b *bundler) copyLinkerScriptIncludes(script string) error {
+	for _, match := range linkerScriptInclude.FindAllStringSubmatch(script, -1) {
+		path := match[1]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(b.root, path)
+		}
+		if _, ok := b.files[filepath.Join(b.outdir, strings.TrimPrefix(path, b.root))]; ok {
+			continue // already copied, avoid include loops
+		}
+		err := b.copyLinkerScript(path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyLibrary copies the precompiled archive of the library for the given
+// target if there is one, and otherwise the directories with its sources and
+// headers so that it can be built from the bundle.
+func (b *bundler) copyLibrary(lib *Library, target string) error {
+	precompiledPath := filepath.Join(b.root, "pkg", target, lib.name+".a")
+	if _, err := os.Stat(precompiledPath); err == nil {
+		err = b.copyPath(precompiledPath)
+		if err != nil {
+			return err
+		}
+	}
+	// The sources are always needed for float ABIs other than soft float,
+	// and the headers are needed for CGo.
+	dirs := make(map[string]struct{})
+	for _, path := range lib.sourcePaths(target) {
+		dirs[filepath.Dir(path)] = struct{}{}
+	}
+	cflags := lib.cflags()
+	for i, flag := range cflags {
+		if strings.HasPrefix(flag, "-I") {
+			dirs[filepath.Clean(flag[2:])] = struct{}{}
+		} else if flag == "-internal-isystem" && i+2 < len(cflags) {
+			// -Xclang -internal-isystem -Xclang <dir>
+			dirs[filepath.Clean(cflags[i+2])] = struct{}{}
+		}
+	}
+	for dir := range dirs {
+		err := b.copyPath(dir)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBundleLinkerScript(t *testing.T) {
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outdir, err := ioutil.TempDir("", "tinygo-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outdir)
+
+	b := &bundler{root: root, outdir: outdir, files: make(map[string]struct{})}
+	err = b.copyLinkerScript("targets/atsamd51j20a.ld")
+	if err != nil {
+		t.Fatal("could not copy linker script:", err)
+	}
+	// The linker script itself and the one it includes must be copied.
+	for _, name := range []string{"targets/atsamd51j20a.ld", "targets/arm.ld"} {
+		if _, err := os.Stat(filepath.Join(outdir, name)); err != nil {
+			t.Errorf("expected %s in the bundle: %v", name, err)
+		}
+	}
+	if len(b.files) != 2 {
+		t.Errorf("expected 2 files in the bundle, got %d", len(b.files))
+	}
+	if len(b.missing) != 0 {
+		t.Errorf("unexpected missing files: %v", b.missing)
+	}
+}
@@ -0,0 +1,207 @@
+package builder
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"io/ioutil"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/loader"
+)
+
+// writeCHeader writes the C header for a program built with
+// -buildmode=c-archive, -buildmode=c-shared, -buildmode=zephyr,
+// -buildmode=freertos or -buildmode=customos, with the declarations of the functions exported from the
+// main package using //export.
+func writeCHeader(path string, pkg *loader.Package, buildMode string) error {
+	header, err := cHeader(pkg.Files, pkg.Pkg, buildMode)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(header), 0666)
+}
+
+// cHeader returns the contents of the C header for the given package.
+func cHeader(files []*ast.File, pkg *types.Package, buildMode string) (string, error) {
+	var declarations []string
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.FuncDecl)
+			if !ok || decl.Doc == nil {
+				continue
+			}
+			exportName := ""
+			for _, comment := range decl.Doc.List {
+				parts := strings.Fields(comment.Text)
+				if len(parts) == 2 && (parts[0] == "//export" || parts[0] == "//go:export") {
+					exportName = parts[1]
+				}
+			}
+			if exportName == "" {
+				continue
+			}
+			if decl.Recv != nil {
+				return "", fmt.Errorf("%s: methods cannot be exported", exportName)
+			}
+			fn := pkg.Scope().Lookup(decl.Name.Name).(*types.Func)
+			declaration, err := cFunctionDeclaration(exportName, fn.Type().(*types.Signature))
+			if err != nil {
+				return "", err
+			}
+			declarations = append(declarations, declaration)
+		}
+	}
+
+	buf := &strings.Builder{}
+	buf.WriteString(`/* Code generated by tinygo build -buildmode=` + buildMode + `. DO NOT EDIT. */
+
+#pragma once
+
+#include <stdbool.h>
+#include <stdint.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+`)
+	switch buildMode {
+	case "c-shared":
+		buf.WriteString(`/* The Go runtime is initialized when the library is loaded. The functions
+ * below must not be called from multiple threads at the same time.
+ */
+
+`)
+	case "zephyr":
+		buf.WriteString(`/* The Go program is started in its own Zephyr thread by the shim in
+ * targets/zephyr.c, which must be linked into the Zephyr application together
+ * with this library. The functions below may only be called from that thread,
+ * for example from C functions that are called by the Go program.
+ */
+
+`)
+	case "freertos":
+		buf.WriteString(`/* Start the Go program in its own FreeRTOS task. This is implemented by the
+ * shim in targets/freertos.c, which must be linked into the FreeRTOS
+ * application together with this library. Call it once, after the FreeRTOS
+ * scheduler has been started (for example from app_main on ESP-IDF). The
+ * functions below may only be called from the task of the Go program.
+ */
+void tinygo_freertos_start(void);
+
+`)
+	case "customos":
+		buf.WriteString(`/* Run the Go program. The OS must call this once, from the thread that runs
+ * all goroutines, and link this library together with the OS backend that
+ * implements the tinygo_os_* functions (see src/runtime/runtime_customos.go).
+ * It returns when main.main returns.
+ */
+void tinygo_os_main(void);
+
+`)
+	default:
+		buf.WriteString(`/* Initialize the heap and run the Go package initializers. This must be
+ * called once, after the startup code of the C program has initialized the
+ * .data and .bss sections, and before calling any other function declared in
+ * this header. The linker script must define the _heap_start, _heap_end,
+ * _globals_start, _globals_end and _stack_top symbols used by the Go runtime.
+ */
+void tinygo_init(void);
+
+`)
+	}
+	for _, declaration := range declarations {
+		buf.WriteString(declaration)
+		buf.WriteString("\n")
+	}
+	buf.WriteString(`
+#ifdef __cplusplus
+}
+#endif
+`)
+	return buf.String(), nil
+}
+
+// cFunctionDeclaration returns the C declaration of an exported function with
+// the given signature.
+func cFunctionDeclaration(name string, sig *types.Signature) (string, error) {
+	result := "void"
+	switch sig.Results().Len() {
+	case 0:
+	case 1:
+		var err error
+		result, err = cTypeName(sig.Results().At(0).Type())
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+	default:
+		return "", fmt.Errorf("%s: exported functions can have at most one result", name)
+	}
+	var params []string
+	for i := 0; i < sig.Params().Len(); i++ {
+		param := sig.Params().At(i)
+		typeName, err := cTypeName(param.Type())
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+		paramName := param.Name()
+		if paramName == "" || paramName == "_" {
+			paramName = fmt.Sprintf("p%d", i)
+		}
+		if strings.HasSuffix(typeName, "*") {
+			params = append(params, typeName+paramName)
+		} else {
+			params = append(params, typeName+" "+paramName)
+		}
+	}
+	if len(params) == 0 {
+		params = []string{"void"}
+	}
+	return fmt.Sprintf("%s %s(%s);", result, name, strings.Join(params, ", ")), nil
+}
+
+// cTypeName returns the C type that corresponds to the given Go type in the C
+// calling convention. Only basic types and pointers are supported.
+func cTypeName(typ types.Type) (string, error) {
+	switch typ := typ.Underlying().(type) {
+	case *types.Basic:
+		switch typ.Kind() {
+		case types.Bool:
+			return "bool", nil
+		case types.Int8:
+			return "int8_t", nil
+		case types.Int16:
+			return "int16_t", nil
+		case types.Int32:
+			return "int32_t", nil
+		case types.Int64:
+			return "int64_t", nil
+		case types.Uint8:
+			return "uint8_t", nil
+		case types.Uint16:
+			return "uint16_t", nil
+		case types.Uint32:
+			return "uint32_t", nil
+		case types.Uint64:
+			return "uint64_t", nil
+		case types.Int:
+			// In TinyGo, int is as big as a pointer.
+			return "intptr_t", nil
+		case types.Uint, types.Uintptr:
+			return "uintptr_t", nil
+		case types.Float32:
+			return "float", nil
+		case types.Float64:
+			return "double", nil
+		case types.UnsafePointer:
+			return "void *", nil
+		}
+	case *types.Pointer:
+		if elem, err := cTypeName(typ.Elem()); err == nil && !strings.HasSuffix(elem, "*") {
+			return elem + " *", nil
+		}
+		return "void *", nil
+	}
+	return "", fmt.Errorf("type %s is not supported in exported functions", typ)
+}
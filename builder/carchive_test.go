@@ -0,0 +1,105 @@
+package builder
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func TestCArchiveHeader(t *testing.T) {
+	const source = `package main
+
+import "unsafe"
+
+type Celsius float32
+
+//export add
+func add(a, b int32) int32 { return a + b }
+
+//go:export reset_counter
+func resetCounter() {}
+
+//export convert
+func convert(buf *byte, size uintptr, temp Celsius, data unsafe.Pointer) bool { return false }
+
+// notExported is not part of the header.
+func notExported(s string) {}
+
+func main() {}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", source, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := types.Config{Importer: unsafeImporter{}}
+	pkg, err := config.Check("main", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := cHeader([]*ast.File{file}, pkg, "c-archive")
+	if err != nil {
+		t.Fatal("could not create header:", err)
+	}
+	for _, expected := range []string{
+		"void tinygo_init(void);",
+		"int32_t add(int32_t a, int32_t b);",
+		"void reset_counter(void);",
+		"bool convert(uint8_t *buf, uintptr_t size, float temp, void *data);",
+	} {
+		if !strings.Contains(header, expected) {
+			t.Errorf("header does not contain %q:\n%s", expected, header)
+		}
+	}
+	if strings.Contains(header, "notExported") {
+		t.Error("header contains a function that is not exported")
+	}
+
+	// A shared library is initialized by the dynamic loader.
+	header, err = cHeader([]*ast.File{file}, pkg, "c-shared")
+	if err != nil {
+		t.Fatal("could not create header:", err)
+	}
+	if strings.Contains(header, "tinygo_init") || !strings.Contains(header, "int32_t add(int32_t a, int32_t b);") {
+		t.Errorf("unexpected header for -buildmode=c-shared:\n%s", header)
+	}
+
+	// A Zephyr program is started by the shim in its own thread.
+	header, err = cHeader([]*ast.File{file}, pkg, "zephyr")
+	if err != nil {
+		t.Fatal("could not create header:", err)
+	}
+	if strings.Contains(header, "tinygo_init") || !strings.Contains(header, "targets/zephyr.c") {
+		t.Errorf("unexpected header for -buildmode=zephyr:\n%s", header)
+	}
+	header, err = cHeader([]*ast.File{file}, pkg, "freertos")
+	if err != nil {
+		t.Fatal("could not create header:", err)
+	}
+	if !strings.Contains(header, "void tinygo_freertos_start(void);") {
+		t.Errorf("unexpected header for -buildmode=freertos:\n%s", header)
+	}
+	header, err = cHeader([]*ast.File{file}, pkg, "customos")
+	if err != nil {
+		t.Fatal("could not create header:", err)
+	}
+	if strings.Contains(header, "tinygo_init") || !strings.Contains(header, "void tinygo_os_main(void);") {
+		t.Errorf("unexpected header for -buildmode=customos:\n%s", header)
+	}
+
+	// Strings can't be passed to C.
+	_, err = cFunctionDeclaration("foo", types.NewSignature(nil, types.NewTuple(types.NewVar(token.NoPos, nil, "s", types.Typ[types.String])), nil, false))
+	if err == nil {
+		t.Error("expected an error for a string parameter")
+	}
+}
+
+// unsafeImporter only imports the unsafe package.
+type unsafeImporter struct{}
+
+func (unsafeImporter) Import(path string) (*types.Package, error) {
+	return types.Unsafe, nil
+}
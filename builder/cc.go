@@ -18,6 +18,7 @@ import (
 	"unicode"
 
 	"github.com/tinygo-org/tinygo/goenv"
+	"github.com/tinygo-org/tinygo/loader"
 	"tinygo.org/x/go-llvm"
 )
 
@@ -121,11 +122,11 @@ func compileAndCacheCFile(abspath, tmpdir string, cflags []string, printCommands
 	flags := append([]string{}, cflags...)                                   // copy cflags
 	flags = append(flags, "-MD", "-MV", "-MTdeps", "-MF", depTmpFile.Name()) // autogenerate dependencies
 	flags = append(flags, "-c", "-o", objTmpFile.Name(), abspath)
-	if strings.ToLower(filepath.Ext(abspath)) == ".s" {
-		// If this is an assembly file (.s or .S, lowercase or uppercase), then
-		// we'll need to add -Qunused-arguments because many parameters are
-		// relevant to C, not assembly. And with -Werror, having meaningless
-		// flags (for the assembler) is a compiler error.
+	if isAssemblyFile(abspath) {
+		// If this is an assembly file, then we'll need to add
+		// -Qunused-arguments because many parameters are relevant to C, not
+		// assembly. And with -Werror, having meaningless flags (for the
+		// assembler) is a compiler error.
 		flags = append(flags, "-Qunused-arguments")
 	}
 	if printCommands {
@@ -185,6 +186,22 @@ func compileAndCacheCFile(abspath, tmpdir string, cflags []string, printCommands
 	return outpath, nil
 }
 
+// isAssemblyFile returns whether the file is an assembly file (.s or .S,
+// lowercase or uppercase).
+func isAssemblyFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".s"
+}
+
+// cgoFileFlags returns the flags to compile the given C or C++ file of a CGo
+// package with.
+func cgoFileFlags(pkg *loader.Package, abspath string) []string {
+	cflags := pkg.CFlags
+	if isCXXFile(abspath) {
+		cflags = append(cflags[:len(cflags):len(cflags)], cxxFlags...)
+	}
+	return cflags
+}
+
 // Create a cache path (a path in GOCACHE) to store the output of a compiler
 // job. This path is based on the dep file name (which is a hash of metadata
 // including compiler flags) and the hash of all input files in the paths slice.
@@ -0,0 +1,64 @@
+package builder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/goenv"
+	"github.com/tinygo-org/tinygo/loader"
+)
+
+// compileCommand is a single entry in a compile_commands.json file, as
+// described in https://clang.llvm.org/docs/JSONCompilationDatabase.html.
+type compileCommand struct {
+	Directory string   `json:"directory"`
+	File      string   `json:"file"`
+	Arguments []string `json:"arguments"`
+}
+
+// writeCompileCommands writes a compilation database with the clang
+// invocations used to build the C and assembly files of the program: the
+// extra files of the target and the C and C++ files of CGo packages. This allows
+// tools like clangd to understand the C side of a program. The flags are the
+// same as used by compileAndCacheCFile, apart from the output files.
+func writeCompileCommands(path string, config *compileopts.Config, packages []*loader.Package) error {
+	root := goenv.Get("TINYGOROOT")
+	commands := []compileCommand{}
+	addCommand := func(dir, abspath string, cflags []string) {
+		args := append([]string{"clang"}, cflags...)
+		if config.ClangHeaders != "" {
+			// The Clang headers are added by runCCompiler when using the
+			// built-in Clang.
+			args = append(args, "-I"+config.ClangHeaders)
+		}
+		args = append(args, "-c", abspath)
+		if isAssemblyFile(abspath) {
+			args = append(args, "-Qunused-arguments")
+		}
+		commands = append(commands, compileCommand{
+			Directory: dir,
+			File:      abspath,
+			Arguments: args,
+		})
+	}
+	for _, path := range config.ExtraFiles() {
+		abspath := path
+		if !filepath.IsAbs(path) {
+			abspath = filepath.Join(root, path)
+		}
+		addCommand(root, abspath, config.CFlags())
+	}
+	for _, pkg := range packages {
+		for _, filename := range append(pkg.CFiles[:len(pkg.CFiles):len(pkg.CFiles)], pkg.CXXFiles...) {
+			abspath := filepath.Join(pkg.Dir, filename)
+			addCommand(pkg.Dir, abspath, cgoFileFlags(pkg, abspath))
+		}
+	}
+	data, err := json.MarshalIndent(commands, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0666)
+}
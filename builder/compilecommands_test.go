@@ -0,0 +1,70 @@
+package builder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/loader"
+)
+
+// Test the compilation database for the extra files of a target and the C and
+// C++ files of a CGo package.
+func TestCompileCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinygo-compile-commands")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config, err := NewConfig(&compileopts.Options{Target: "cortex-m-qemu"})
+	if err != nil {
+		t.Fatal("could not load target:", err)
+	}
+	config.ClangHeaders = ""
+	pkg := &loader.Package{
+		PackageJSON: loader.PackageJSON{
+			Dir:      dir,
+			CFiles:   []string{"a.c"},
+			CXXFiles: []string{"b.cpp"},
+		},
+		CFlags: []string{"-DFOO"},
+	}
+	path := filepath.Join(dir, "compile_commands.json")
+	err = writeCompileCommands(path, config, []*loader.Package{pkg})
+	if err != nil {
+		t.Fatal("could not write compile commands:", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal("could not read compile commands:", err)
+	}
+	var commands []compileCommand
+	if err := json.Unmarshal(data, &commands); err != nil {
+		t.Fatal("could not parse compile commands:", err)
+	}
+	if len(commands) != len(config.ExtraFiles())+2 {
+		t.Fatalf("expected %d commands, got %d", len(config.ExtraFiles())+2, len(commands))
+	}
+
+	// Assembly files need -Qunused-arguments, just like in the build.
+	for _, command := range commands[:len(config.ExtraFiles())] {
+		args := command.Arguments
+		if isAssemblyFile(command.File) && args[len(args)-1] != "-Qunused-arguments" {
+			t.Errorf("%s: expected -Qunused-arguments, got %v", command.File, args)
+		}
+	}
+
+	// C++ files are compiled with the extra C++ flags.
+	expected := []compileCommand{
+		{Directory: dir, File: filepath.Join(dir, "a.c"), Arguments: []string{"clang", "-DFOO", "-c", filepath.Join(dir, "a.c")}},
+		{Directory: dir, File: filepath.Join(dir, "b.cpp"), Arguments: append(append([]string{"clang", "-DFOO"}, cxxFlags...), "-c", filepath.Join(dir, "b.cpp"))},
+	}
+	if got := commands[len(config.ExtraFiles()):]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected commands for CGo files:\n%v\nexpected:\n%v", got, expected)
+	}
+}
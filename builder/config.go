@@ -3,6 +3,7 @@ package builder
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/tinygo-org/tinygo/compileopts"
 	"github.com/tinygo-org/tinygo/goenv"
@@ -18,11 +19,295 @@ func NewConfig(options *compileopts.Options) (*compileopts.Config, error) {
 		return nil, err
 	}
 
+	if len(options.Args) != 0 || len(options.Env) != 0 || options.SettingsAddress != "" {
+		isBaremetal := false
+		for _, tag := range spec.BuildTags {
+			if tag == "baremetal" {
+				isBaremetal = true
+			}
+		}
+		if !isBaremetal {
+			return nil, errors.New("-args, -env and -settings-addr are only supported on baremetal targets")
+		}
+	}
+
+	if options.ErrorTrace && strings.HasPrefix(spec.Triple, "wasm") {
+		// LLVM does not support llvm.returnaddress on WebAssembly.
+		return nil, errors.New("-errortrace is not supported on WebAssembly")
+	}
+
+	if options.DeadlockTrace && strings.HasPrefix(spec.Triple, "wasm") {
+		// Same as above: blocking calls are recorded with llvm.returnaddress.
+		return nil, errors.New("-deadlocktrace is not supported on WebAssembly")
+	}
+
+	if options.PanicStrategy == "trace" {
+		// The runtime needs to know how to find return addresses on the stack.
+		supported := false
+		for _, tag := range spec.BuildTags {
+			if tag == "cortexm" || tag == "tinygo.riscv" {
+				supported = true
+			}
+		}
+		if !supported {
+			return nil, errors.New("-panic=trace is only supported on Cortex-M and RISC-V targets")
+		}
+	}
+
+	if options.StackCanary {
+		for _, tag := range spec.BuildTags {
+			if tag == "gameboyadvance" {
+				// The linker script has separate IRQ and user stacks and no
+				// _stack_size symbol to find the bottom of the system stack.
+				return nil, errors.New("-stackcanary is not supported on the Game Boy Advance")
+			}
+		}
+	}
+
+	if options.ReadOnlyText {
+		isCortexM := false
+		for _, tag := range spec.BuildTags {
+			if tag == "cortexm" {
+				isCortexM = true
+			}
+			if tag == "mimxrt1062" {
+				// The runtime configures the MPU itself on this chip.
+				return nil, errors.New("-readonlytext is not supported on the MIMXRT1062")
+			}
+		}
+		if !isCortexM {
+			return nil, errors.New("-readonlytext is only supported on Cortex-M targets")
+		}
+	}
+
+	if options.StackUsage {
+		if scheduler := (&compileopts.Config{Options: options, Target: spec}).Scheduler(); scheduler != "tasks" {
+			// The scheduler is not set on the command line (that is checked in
+			// Options.Verify), but the target defaults to a different one.
+			return nil, fmt.Errorf("-stackusage is not supported with -scheduler=%s, use -scheduler=tasks", scheduler)
+		}
+	}
+
+	if options.TraceHooks == "itm" || options.TraceHooks == "systemview" {
+		isCortexM := false
+		for _, tag := range spec.BuildTags {
+			if tag == "cortexm" {
+				isCortexM = true
+			}
+		}
+		if !isCortexM {
+			return nil, fmt.Errorf("-trace-hooks=%s is only supported on Cortex-M targets", options.TraceHooks)
+		}
+		if options.TraceHooks == "itm" && isARMv6M(spec.Triple) {
+			// Cortex-M0 and Cortex-M0+ don't have an ITM.
+			return nil, errors.New("-trace-hooks=itm is not supported on Cortex-M0 targets")
+		}
+		scheduler := (&compileopts.Config{Options: options, Target: spec}).Scheduler()
+		if options.TraceHooks == "systemview" && scheduler != "tasks" {
+			// Goroutines are only registered as SystemView tasks when they
+			// are started by the tasks scheduler.
+			return nil, errors.New("-trace-hooks=systemview requires -scheduler=tasks")
+		}
+	}
+
+	if options.Serial == "itm" {
+		isCortexM := false
+		for _, tag := range spec.BuildTags {
+			if tag == "cortexm" {
+				isCortexM = true
+			}
+		}
+		if !isCortexM || isARMv6M(spec.Triple) {
+			// Cortex-M0 and Cortex-M0+ don't have an ITM.
+			return nil, errors.New("-serial=itm is only supported on Cortex-M3 and higher")
+		}
+	}
+
+	if options.CoreDump == "serial" {
+		isCortexM := false
+		for _, tag := range spec.BuildTags {
+			if tag == "cortexm" {
+				isCortexM = true
+			}
+		}
+		if !isCortexM {
+			// The registers and memory layout of the dump are Cortex-M specific.
+			return nil, errors.New("-coredump is only supported on Cortex-M targets")
+		}
+	}
+
+	if options.CrashLogSize != 0 {
+		isCortexM := false
+		for _, tag := range spec.BuildTags {
+			if tag == "cortexm" {
+				isCortexM = true
+			}
+			if tag == "mimxrt1062" {
+				// This chip has its own linker script, without .noinit.
+				return nil, errors.New("-crashlog-size is not supported on the MIMXRT1062")
+			}
+		}
+		if !isCortexM {
+			// The crash log is placed in the .noinit section of arm.ld.
+			return nil, errors.New("-crashlog-size is only supported on Cortex-M targets")
+		}
+		if options.CrashLogSize%4 != 0 {
+			return nil, errors.New("-crashlog-size must be a multiple of 4")
+		}
+	}
+
+	if spec.RelocateVectors != nil && *spec.RelocateVectors {
+		isCortexM := false
+		for _, tag := range spec.BuildTags {
+			if tag == "cortexm" {
+				isCortexM = true
+			}
+			if tag == "mimxrt1062" {
+				// The runtime sets VTOR itself on this chip.
+				return nil, errors.New("relocate-vectors is not supported on the MIMXRT1062")
+			}
+		}
+		if !isCortexM {
+			return nil, errors.New("relocate-vectors is only supported on Cortex-M targets")
+		}
+		if spec.CPU == "cortex-m0" {
+			// The Cortex-M0 has no VTOR, unlike the Cortex-M0+ (where it is
+			// optional, but present on all supported chips).
+			return nil, errors.New("relocate-vectors is not supported on the Cortex-M0, which has no vector table offset register")
+		}
+	}
+
+	if options.HeapRegions != "" && options.HeapRegions != "all" {
+		// Only use some of the heap regions of the target, for example to keep
+		// RAM that is not accessible by DMA (like CCM RAM) out of the heap.
+		var selected []compileopts.HeapRegion
+		if options.HeapRegions != "none" {
+			for _, name := range strings.Split(options.HeapRegions, ",") {
+				found := false
+				for _, region := range spec.HeapRegions {
+					if region.Name == name {
+						selected = append(selected, region)
+						found = true
+					}
+				}
+				if !found {
+					return nil, fmt.Errorf("-heap-regions: the target has no heap region named %q", name)
+				}
+			}
+		}
+		spec.HeapRegions = selected
+	}
+
+	if len(spec.HeapRegions) != 0 {
+		isBaremetal := false
+		for _, tag := range spec.BuildTags {
+			if tag == "baremetal" {
+				isBaremetal = true
+			}
+		}
+		if !isBaremetal {
+			// Other systems allocate the heap from the OS.
+			return nil, errors.New("heap-regions is only supported on baremetal targets")
+		}
+		if _, err := spec.HeapRegionLayout(); err != nil {
+			return nil, err
+		}
+		switch gc := (&compileopts.Config{Options: options, Target: spec}).GC(); gc {
+		case "leaking", "extalloc":
+			// Only the conservative GC knows about heap regions.
+			return nil, fmt.Errorf("heap-regions is not supported with -gc=%s, use -heap-regions=none to build without them", gc)
+		}
+	}
+
+	if options.MCUboot {
+		if _, err := parseMCUbootVersion(options.ImageVersion); err != nil {
+			return nil, err
+		}
+	} else if options.ImageVersion != "" || options.ImageKey != "" {
+		return nil, errors.New("-image-version and -image-key are only used with -mcuboot")
+	}
+
+	if spec.AppOffset != "" && !spec.HasMemoryLayout() {
+		// The offset is only applied to a generated linker script.
+		return nil, errors.New("app-offset requires the memory layout (flash-size, ram-origin and ram-size) in the target")
+	}
+
+	if options.BuildMode == "c-archive" {
+		isBaremetal := false
+		for _, tag := range spec.BuildTags {
+			if tag == "baremetal" {
+				isBaremetal = true
+			}
+		}
+		if strings.HasPrefix(spec.Triple, "wasm") || (!isBaremetal && spec.GOOS != "linux") {
+			// The archive is created from ELF object files, and on a hosted
+			// system the runtime needs to find the stack of the calling
+			// thread, which is only implemented for Linux.
+			return nil, errors.New("-buildmode=c-archive is only supported on Linux and baremetal targets")
+		}
+	}
+
+	if options.BuildMode == "c-shared" {
+		isHosted := spec.GOOS == "linux" || spec.GOOS == "darwin"
+		for _, tag := range spec.BuildTags {
+			if tag == "baremetal" || tag == "wasm" {
+				isHosted = false
+			}
+		}
+		if !isHosted {
+			// Shared libraries are loaded by the dynamic loader of the OS.
+			return nil, errors.New("-buildmode=c-shared is only supported on Linux and macOS")
+		}
+	}
+
+	buildMode := options.BuildMode
+	if buildMode == "" {
+		buildMode = spec.BuildMode
+	}
+	if buildMode == "" {
+		buildMode = "default"
+	}
+	for _, rtos := range []struct{ tag, name, example string }{
+		{"zephyr", "Zephyr", "zephyr-cortex-m4"},
+		{"freertos", "FreeRTOS", "esp32-freertos"},
+		{"customos", "custom OS", "customos-cortex-m4"},
+	} {
+		hasTag := false
+		for _, tag := range spec.BuildTags {
+			if tag == rtos.tag {
+				hasTag = true
+			}
+		}
+		if buildMode == rtos.tag && !hasTag {
+			return nil, fmt.Errorf("-buildmode=%s is only supported on %s targets, such as -target=%s", rtos.tag, rtos.name, rtos.example)
+		}
+		if hasTag && buildMode != rtos.tag {
+			// The program is started by the RTOS, so it can only be linked
+			// into an application of that RTOS.
+			return nil, fmt.Errorf("-buildmode=%s is not supported on %s targets", buildMode, rtos.name)
+		}
+	}
+
+	if options.Arduino || len(options.ArduinoLibs) != 0 {
+		if spec.ArduinoCore == "" {
+			return nil, errors.New("-arduino is not supported on this target: it doesn't specify an Arduino core")
+		}
+		if buildMode != "default" {
+			return nil, fmt.Errorf("-arduino is not supported with -buildmode=%s", buildMode)
+		}
+	}
+
 	if options.OpenOCDCommands != nil {
 		// Override the OpenOCDCommands from the target spec if specified on
 		// the command-line
 		spec.OpenOCDCommands = options.OpenOCDCommands
 	}
+	if options.OCDTransport != "" {
+		spec.OpenOCDTransport = options.OCDTransport
+	}
+	if options.OCDSpeed != 0 {
+		spec.OpenOCDSpeed = options.OCDSpeed
+	}
 
 	goroot := goenv.Get("GOROOT")
 	if goroot == "" {
@@ -47,3 +332,9 @@ func NewConfig(options *compileopts.Options) (*compileopts.Config, error) {
 		TestConfig:     options.TestConfig,
 	}, nil
 }
+
+// isARMv6M returns whether the given LLVM target triple is for the Cortex-M0 or
+// Cortex-M0+, which don't have an ITM.
+func isARMv6M(triple string) bool {
+	return strings.HasPrefix(triple, "armv6m") || strings.HasPrefix(triple, "thumbv6m")
+}
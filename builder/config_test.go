@@ -0,0 +1,148 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+)
+
+func TestRelocateVectorsCPU(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinygo-targets")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		cpu string
+		err string
+	}{
+		{"cortex-m0", "relocate-vectors is not supported on the Cortex-M0, which has no vector table offset register"},
+		{"cortex-m0plus", ""},
+		{"cortex-m3", ""},
+	} {
+		path := filepath.Join(dir, tc.cpu+".json")
+		err := ioutil.WriteFile(path, []byte(`{"inherits": ["`+tc.cpu+`"], "relocate-vectors": true}`), 0666)
+		if err != nil {
+			t.Fatal("could not write target:", err)
+		}
+		_, err = NewConfig(&compileopts.Options{Target: path})
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.cpu, err)
+		} else if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%s: expected error %q, got %v", tc.cpu, tc.err, err)
+		}
+	}
+}
+
+func TestHeapRegionsOption(t *testing.T) {
+	for _, tc := range []struct {
+		gc          string
+		heapRegions string
+		numRegions  int
+		err         string
+	}{
+		{"", "", 1, ""},
+		{"conservative", "all", 1, ""},
+		{"", "ccm", 1, ""},
+		{"", "none", 0, ""},
+		{"", "sram2", 0, `-heap-regions: the target has no heap region named "sram2"`},
+		{"leaking", "", 0, "heap-regions is not supported with -gc=leaking, use -heap-regions=none to build without them"},
+		{"extalloc", "", 0, "heap-regions is not supported with -gc=extalloc, use -heap-regions=none to build without them"},
+		{"leaking", "none", 0, ""},
+	} {
+		name := "gc=" + tc.gc + ",heap-regions=" + tc.heapRegions
+		config, err := NewConfig(&compileopts.Options{Target: "stm32f4disco", GC: tc.gc, HeapRegions: tc.heapRegions})
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%s: expected error %q, got %v", name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		} else if len(config.Target.HeapRegions) != tc.numRegions {
+			t.Errorf("%s: expected %d heap regions, got %d", name, tc.numRegions, len(config.Target.HeapRegions))
+		}
+	}
+}
+
+func TestStackCanaryOption(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		err    string
+	}{
+		{"cortex-m-qemu", ""},
+		{"arduino", ""}, // _stack_size is defined with --defsym
+		{"gameboy-advance", "-stackcanary is not supported on the Game Boy Advance"},
+	} {
+		_, err := NewConfig(&compileopts.Options{Target: tc.target, StackCanary: true})
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.target, err)
+		} else if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%s: expected error %q, got %v", tc.target, tc.err, err)
+		}
+	}
+}
+
+func TestTraceHooksOption(t *testing.T) {
+	for _, tc := range []struct {
+		target    string
+		hooks     string
+		scheduler string
+		err       string
+	}{
+		{"cortex-m-qemu", "itm", "", ""},
+		{"cortex-m-qemu", "systemview", "", ""},
+		{"cortex-m-qemu", "systemview", "coroutines", "-trace-hooks=systemview requires -scheduler=tasks"},
+		{"microbit", "itm", "", "-trace-hooks=itm is not supported on Cortex-M0 targets"},
+		{"arduino", "systemview", "", "-trace-hooks=systemview is only supported on Cortex-M targets"},
+	} {
+		_, err := NewConfig(&compileopts.Options{Target: tc.target, TraceHooks: tc.hooks, Scheduler: tc.scheduler})
+		if tc.err == "" && err != nil {
+			t.Errorf("%s -trace-hooks=%s: unexpected error: %v", tc.target, tc.hooks, err)
+		} else if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%s -trace-hooks=%s: expected error %q, got %v", tc.target, tc.hooks, tc.err, err)
+		}
+	}
+}
+
+func TestSerialITMOption(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		err    string
+	}{
+		{"cortex-m-qemu", ""},
+		{"microbit", "-serial=itm is only supported on Cortex-M3 and higher"},
+		{"arduino", "-serial=itm is only supported on Cortex-M3 and higher"},
+	} {
+		_, err := NewConfig(&compileopts.Options{Target: tc.target, Serial: "itm"})
+		if tc.err == "" && err != nil {
+			t.Errorf("%s -serial=itm: unexpected error: %v", tc.target, err)
+		} else if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%s -serial=itm: expected error %q, got %v", tc.target, tc.err, err)
+		}
+	}
+}
+
+func TestStackUsageOption(t *testing.T) {
+	for _, tc := range []struct {
+		target    string
+		scheduler string
+		err       string
+	}{
+		{"cortex-m-qemu", "", ""},
+		{"wasm", "", "-stackusage is not supported with -scheduler=coroutines, use -scheduler=tasks"},
+		{"cortex-m-qemu", "none", "-stackusage is not supported with -scheduler=none, use -scheduler=tasks"},
+	} {
+		_, err := NewConfig(&compileopts.Options{Target: tc.target, Scheduler: tc.scheduler, StackUsage: true})
+		if tc.err == "" && err != nil {
+			t.Errorf("%s -scheduler=%s: unexpected error: %v", tc.target, tc.scheduler, err)
+		} else if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%s -scheduler=%s: expected error %q, got %v", tc.target, tc.scheduler, tc.err, err)
+		}
+	}
+}
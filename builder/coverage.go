@@ -0,0 +1,50 @@
+package builder
+
+import (
+	"errors"
+
+	"github.com/tinygo-org/tinygo/compiler"
+	"github.com/tinygo-org/tinygo/compiler/llvmutil"
+	"tinygo.org/x/go-llvm"
+)
+
+// setCoverageGlobals enables coverage output in the runtime and points the
+// runtime coverage globals to the coverage counters and block table of the
+// given package, as created by the compiler. The counters stay empty if the
+// package has not been instrumented (for example, because it only contains
+// test files).
+func setCoverageGlobals(mod llvm.Module, pkgPath string) error {
+	runtimeEnabled := mod.NamedGlobal("runtime.coverageEnabled")
+	runtimeCounters := mod.NamedGlobal("runtime.coverageCounters")
+	runtimeBlocks := mod.NamedGlobal("runtime.coverageBlocks")
+	if runtimeEnabled.IsNil() || runtimeCounters.IsNil() || runtimeBlocks.IsNil() {
+		return errors.New("coverage: could not find runtime coverage globals")
+	}
+	runtimeEnabled.SetInitializer(llvm.ConstInt(runtimeEnabled.Type().ElementType(), 1, false))
+
+	countersName, blocksName := compiler.CoverageGlobalNames(pkgPath)
+	counters := mod.NamedGlobal(countersName)
+	blocks := mod.NamedGlobal(blocksName)
+	if counters.IsNil() || blocks.IsNil() {
+		return nil
+	}
+
+	// The counters are a []byte slice: a {ptr, len, cap} struct.
+	zero := llvm.ConstInt(mod.Context().Int32Type(), 0, false)
+	numCounters := uint64(counters.Type().ElementType().ArrayLength())
+	sliceType := runtimeCounters.Type().ElementType()
+	lenType := sliceType.StructElementTypes()[1]
+	runtimeCounters.SetInitializer(llvmutil.ConstStruct(sliceType, []llvm.Value{
+		llvm.ConstInBoundsGEP(counters, []llvm.Value{zero, zero}),
+		llvm.ConstInt(lenType, numCounters, false),
+		llvm.ConstInt(lenType, numCounters, false),
+	}))
+
+	// The block table is a string: a {ptr, len} struct.
+	stringType := runtimeBlocks.Type().ElementType()
+	runtimeBlocks.SetInitializer(llvmutil.ConstStruct(stringType, []llvm.Value{
+		llvm.ConstInBoundsGEP(blocks, []llvm.Value{zero, zero}),
+		llvm.ConstInt(stringType.StructElementTypes()[1], uint64(blocks.Type().ElementType().ArrayLength()), false),
+	}))
+	return nil
+}
@@ -30,7 +30,15 @@ type espImageSegment struct {
 // https://github.com/espressif/esptool/wiki/Firmware-Image-Format
 // https://github.com/espressif/esp-idf/blob/8fbb63c2a701c22ccf4ce249f43aded73e134a34/components/bootloader_support/include/esp_image_format.h#L58
 // https://github.com/espressif/esptool/blob/master/esptool.py
-func makeESPFirmareImage(infile, outfile, format string) error {
+//
+// The SPI flash parameters in the header are set from the target, so that the
+// image can be written to flash as-is without esptool.py.
+func makeESPFirmareImage(infile, outfile, format string, flash espFlashParams) error {
+	spiMode, spiSpeedSize, err := flash.header(format)
+	if err != nil {
+		return err
+	}
+
 	inf, err := elf.Open(infile)
 	if err != nil {
 		return err
@@ -96,8 +104,8 @@ func makeESPFirmareImage(infile, outfile, format string) error {
 		}{
 			magic:          0xE9,
 			segment_count:  byte(len(segments)),
-			spi_mode:       0, // irrelevant, replaced by esptool when flashing
-			spi_speed_size: 0, // spi_speed, spi_size: replaced by esptool when flashing
+			spi_mode:       spiMode,
+			spi_speed_size: spiSpeedSize,
 			entry_addr:     uint32(inf.Entry),
 			wp_pin:         0xEE, // disable WP pin
 			hash_appended:  true, // add a SHA256 hash
@@ -115,8 +123,8 @@ func makeESPFirmareImage(infile, outfile, format string) error {
 		}{
 			magic:          0xE9,
 			segment_count:  byte(len(segments)),
-			spi_mode:       0,    // irrelevant, replaced by esptool when flashing
-			spi_speed_size: 0x20, // spi_speed, spi_size: replaced by esptool when flashing
+			spi_mode:       spiMode,
+			spi_speed_size: spiSpeedSize,
 			entry_addr:     uint32(inf.Entry),
 		})
 	default:
@@ -151,3 +159,68 @@ func makeESPFirmareImage(infile, outfile, format string) error {
 	// Write the image to the output file.
 	return ioutil.WriteFile(outfile, outf.Bytes(), 0666)
 }
+
+// espFlashParams are the SPI flash parameters stored in the image header,
+// which are used by the ROM bootloader to read the rest of the image. They
+// use the same names as the esptool.py --flash_mode, --flash_freq and
+// --flash_size flags. Empty values select the esptool.py defaults (qio, 40m
+// and 1MB).
+type espFlashParams struct {
+	mode string
+	freq string
+	size string
+}
+
+// Values of the SPI flash parameters in the image header, copied from
+// esptool.py.
+var (
+	espFlashModes = map[string]uint8{"qio": 0, "qout": 1, "dio": 2, "dout": 3}
+	espFlashFreqs = map[string]uint8{"40m": 0x0, "26m": 0x1, "20m": 0x2, "80m": 0xf}
+	espFlashSizes = map[string]map[string]uint8{
+		"esp32": {
+			"1MB":  0x00,
+			"2MB":  0x10,
+			"4MB":  0x20,
+			"8MB":  0x30,
+			"16MB": 0x40,
+		},
+		"esp8266": {
+			"512KB":  0x00,
+			"256KB":  0x10,
+			"1MB":    0x20,
+			"2MB":    0x30,
+			"4MB":    0x40,
+			"2MB-c1": 0x50,
+			"4MB-c1": 0x60,
+			"8MB":    0x80,
+			"16MB":   0x90,
+		},
+	}
+)
+
+// header returns the spi_mode and spi_speed_size bytes of the image header.
+func (p espFlashParams) header(format string) (spiMode, spiSpeedSize uint8, err error) {
+	mode, freq, size := p.mode, p.freq, p.size
+	if mode == "" {
+		mode = "qio"
+	}
+	if freq == "" {
+		freq = "40m"
+	}
+	if size == "" {
+		size = "1MB"
+	}
+	spiMode, ok := espFlashModes[mode]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown ESP flash mode: %#v", mode)
+	}
+	speed, ok := espFlashFreqs[freq]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown ESP flash frequency: %#v", freq)
+	}
+	sizeBits, ok := espFlashSizes[format][size]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown ESP flash size for %s: %#v", format, size)
+	}
+	return spiMode, speed | sizeBits, nil
+}
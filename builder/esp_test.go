@@ -0,0 +1,35 @@
+package builder
+
+import "testing"
+
+func TestESPFlashHeader(t *testing.T) {
+	for _, tc := range []struct {
+		format       string
+		params       espFlashParams
+		spiMode      uint8
+		spiSpeedSize uint8
+		err          string
+	}{
+		{"esp32", espFlashParams{}, 0, 0x00, ""},
+		{"esp32", espFlashParams{"dout", "80m", ""}, 3, 0x0f, ""},
+		{"esp32", espFlashParams{"dio", "40m", "4MB"}, 2, 0x20, ""},
+		{"esp8266", espFlashParams{}, 0, 0x20, ""},
+		{"esp8266", espFlashParams{"qio", "26m", "4MB-c1"}, 0, 0x61, ""},
+		{"esp32", espFlashParams{"fast", "", ""}, 0, 0, `unknown ESP flash mode: "fast"`},
+		{"esp32", espFlashParams{"", "60m", ""}, 0, 0, `unknown ESP flash frequency: "60m"`},
+		{"esp32", espFlashParams{"", "", "512KB"}, 0, 0, `unknown ESP flash size for esp32: "512KB"`},
+	} {
+		spiMode, spiSpeedSize, err := tc.params.header(tc.format)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%s %v: expected error %#v, got %v", tc.format, tc.params, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %v: unexpected error: %v", tc.format, tc.params, err)
+		} else if spiMode != tc.spiMode || spiSpeedSize != tc.spiSpeedSize {
+			t.Errorf("%s %v: expected 0x%02x 0x%02x, got 0x%02x 0x%02x", tc.format, tc.params, tc.spiMode, tc.spiSpeedSize, spiMode, spiSpeedSize)
+		}
+	}
+}
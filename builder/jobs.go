@@ -70,14 +70,20 @@ func (job *compileJob) readyToRun() bool {
 // It runs all jobs in the order of the slice, as long as all dependencies have
 // already run. Therefore, if some jobs are preferred to run before others, they
 // should be ordered as such in this slice.
-func runJobs(jobs []*compileJob) error {
+// At most parallelism jobs are run at the same time. If parallelism is zero or
+// less, the number of CPUs is used instead.
+func runJobs(jobs []*compileJob, parallelism int) error {
+	if parallelism < 1 {
+		parallelism = runtime.NumCPU()
+	}
+
 	// Create channels to communicate with the workers.
 	doneChan := make(chan *compileJob)
 	workerChan := make(chan *compileJob)
 	defer close(workerChan)
 
 	// Start a number of workers.
-	for i := 0; i < runtime.NumCPU(); i++ {
+	for i := 0; i < parallelism; i++ {
 		if jobRunnerDebug {
 			fmt.Println("## starting worker", i)
 		}
@@ -92,7 +98,7 @@ func runJobs(jobs []*compileJob) error {
 	for {
 		// If there are free workers, try starting a new job (if one is
 		// available). If it succeeds, try again to fill the entire worker pool.
-		if numRunningJobs < runtime.NumCPU() {
+		if numRunningJobs < parallelism {
 			jobToRun := nextJob(jobs)
 			if jobToRun != nil {
 				// Start job.
@@ -1,6 +1,7 @@
 package builder
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,7 +20,8 @@ type Library struct {
 	// The source directory, relative to TINYGOROOT.
 	sourceDir string
 
-	// The source files, relative to sourceDir.
+	// The source files, relative to sourceDir (unless they are absolute
+	// paths).
 	sources func(target string) []string
 }
 
@@ -33,6 +35,10 @@ func (l *Library) sourcePaths(target string) []string {
 	sources := l.sources(target)
 	paths := make([]string, len(sources))
 	for i, name := range sources {
+		if filepath.IsAbs(name) {
+			paths[i] = name
+			continue
+		}
 		paths[i] = filepath.Join(l.fullPath(), name)
 	}
 	return paths
@@ -40,38 +46,54 @@ func (l *Library) sourcePaths(target string) []string {
 
 // Load the library archive, possibly generating and caching it if needed.
 // The resulting file is stored in the provided tmpdir, which is expected to be
-// removed after the Load call.
-func (l *Library) Load(target, tmpdir string) (path string, err error) {
-	job, err := l.load(target, "", tmpdir)
+// removed after the Load call. At most parallelism files are compiled at the
+// same time, or the number of CPUs if it is zero.
+func (l *Library) Load(target, tmpdir string, parallelism int) (path string, err error) {
+	job, err := l.load(target, "", "", tmpdir, false)
 	if err != nil {
 		return "", err
 	}
 	jobs := append([]*compileJob{job}, job.dependencies...)
-	err = runJobs(jobs)
+	err = runJobs(jobs, parallelism)
 	return job.result, err
 }
 
-// load returns a compile job to build this library file for the given target
-// and CPU. It may return a dummy compileJob if the library build is already
-// cached. The path is stored as job.result but is only valid if the job and
-// job.dependencies have been run.
+// load returns a compile job to build this library file for the given target,
+// CPU and floating point ABI. It may return a dummy compileJob if the library
+// build is already cached. The path is stored as job.result but is only valid
+// if the job and job.dependencies have been run.
 // The provided tmpdir will be used to store intermediary files and possibly the
-// output archive file, it is expected to be removed after use.
-func (l *Library) load(target, cpu, tmpdir string) (job *compileJob, err error) {
-	// Try to load a precompiled library.
-	precompiledPath := filepath.Join(goenv.Get("TINYGOROOT"), "pkg", target, l.name+".a")
-	if _, err := os.Stat(precompiledPath); err == nil {
-		// Found a precompiled library for this OS/architecture. Return the path
-		// directly.
-		return dummyCompileJob(precompiledPath), nil
+// output archive file, it is expected to be removed after use. When
+// printCommands is set, the compiler invocations are printed (-x).
+func (l *Library) load(target, cpu, floatABI, tmpdir string, printCommands bool) (job *compileJob, err error) {
+	isARM := strings.HasPrefix(target, "arm") || strings.HasPrefix(target, "thumb")
+	if isARM && floatABI == "" {
+		// The default, see compileopts.Config.FloatABI.
+		floatABI = "soft"
 	}
 
-	var outfile string
+	// Try to load a precompiled library. These are built for a generic CPU
+	// using the soft float ABI, so they can't be used for other float ABIs.
+	if floatABI == "" || floatABI == "soft" {
+		precompiledPath := filepath.Join(goenv.Get("TINYGOROOT"), "pkg", target, l.name+".a")
+		if _, err := os.Stat(precompiledPath); err == nil {
+			// Found a precompiled library for this OS/architecture. Return the
+			// path directly.
+			return dummyCompileJob(precompiledPath), nil
+		}
+	}
+
+	// The name of the library in the cache includes all parameters that
+	// affect the resulting archive, so that different variants don't
+	// overwrite each other.
+	outfile := l.name + "-" + target
 	if cpu != "" {
-		outfile = l.name + "-" + target + "-" + cpu + ".a"
-	} else {
-		outfile = l.name + "-" + target + ".a"
+		outfile += "-" + cpu
 	}
+	if floatABI != "" {
+		outfile += "-" + floatABI
+	}
+	outfile += ".a"
 
 	// Try to fetch this library from the cache.
 	if path, err := cacheLoad(outfile, l.sourcePaths(target)); path != "" || err != nil {
@@ -90,13 +112,16 @@ func (l *Library) load(target, cpu, tmpdir string) (job *compileJob, err error)
 	// Precalculate the flags to the compiler invocation.
 	// Note: -fdebug-prefix-map is necessary to make the output archive
 	// reproducible. Otherwise the temporary directory is stored in the archive
-	// itself, which varies each run.
-	args := append(l.cflags(), "-c", "-Oz", "-g", "-ffunction-sections", "-fdata-sections", "-Wno-macro-redefined", "--target="+target, "-fdebug-prefix-map="+dir+"="+remapDir)
+	// itself, which varies each run. For the same reason TINYGOROOT is replaced
+	// the same way as with -trimpath (see compileopts.Config.PathPrefixMap),
+	// both in debug info and in __FILE__. This is done for every build, as the
+	// archive is cached and shared between builds with and without -trimpath.
+	args := append(l.cflags(), "-c", "-Oz", "-g", "-ffunction-sections", "-fdata-sections", "-Wno-macro-redefined", "--target="+target, "-fdebug-prefix-map="+dir+"="+remapDir, "-ffile-prefix-map="+goenv.Get("TINYGOROOT")+"=tinygo")
 	if cpu != "" {
 		args = append(args, "-mcpu="+cpu)
 	}
-	if strings.HasPrefix(target, "arm") || strings.HasPrefix(target, "thumb") {
-		args = append(args, "-fshort-enums", "-fomit-frame-pointer", "-mfloat-abi=soft")
+	if isARM {
+		args = append(args, "-fshort-enums", "-fomit-frame-pointer", "-mfloat-abi="+floatABI)
 	}
 	if strings.HasPrefix(target, "riscv32-") {
 		args = append(args, "-march=rv32imac", "-mabi=ilp32", "-fforce-enable-int128")
@@ -136,6 +161,9 @@ func (l *Library) load(target, cpu, tmpdir string) (job *compileJob, err error)
 				var compileArgs []string
 				compileArgs = append(compileArgs, args...)
 				compileArgs = append(compileArgs, "-o", objpath, srcpath)
+				if printCommands {
+					fmt.Printf("clang %s\n", strings.Join(compileArgs, " "))
+				}
 				err := runCCompiler(compileArgs...)
 				if err != nil {
 					return &commandError{"failed to build", srcpath, err}
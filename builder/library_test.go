@@ -0,0 +1,70 @@
+package builder
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test that a library built from two different TINYGOROOT directories results
+// in the same archive, so that TINYGOROOT doesn't end up in the output.
+func TestLibraryReproducible(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-library")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Use __FILE__ and debug info, which both contain the source path.
+	source := []byte("const char *file(void) { return __FILE__; }\n")
+	lib := &Library{
+		name:      "testlib",
+		cflags:    func() []string { return nil },
+		sourceDir: "lib/testlib",
+		sources:   func(target string) []string { return []string{"file.c"} },
+	}
+
+	defer os.Setenv("TINYGOROOT", os.Getenv("TINYGOROOT"))
+	defer os.Setenv("TINYGOCACHE", os.Getenv("TINYGOCACHE"))
+	var archives [][]byte
+	for _, name := range []string{"root1", "root-two"} {
+		root := filepath.Join(tmpdir, name)
+		// The files that make goenv accept this directory as TINYGOROOT.
+		for _, path := range []string{"src/runtime/internal/sys/zversion.go", "src/device/arm/arm.go", "lib/testlib/file.c"} {
+			path = filepath.Join(root, path)
+			err := os.MkdirAll(filepath.Dir(path), 0777)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ioutil.WriteFile(path, source, 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		os.Setenv("TINYGOROOT", root)
+		os.Setenv("TINYGOCACHE", filepath.Join(root, "cache"))
+
+		builddir := filepath.Join(root, "build")
+		err := os.Mkdir(builddir, 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, err := lib.Load("thumbv7em-unknown-unknown-eabi", builddir, 1)
+		if err != nil {
+			t.Fatalf("could not build library in %s: %s", root, err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte(root)) {
+			t.Errorf("library built in %s contains the path to TINYGOROOT", root)
+		}
+		archives = append(archives, data)
+	}
+	if !bytes.Equal(archives[0], archives[1]) {
+		t.Error("library differs when built from a different TINYGOROOT")
+	}
+}
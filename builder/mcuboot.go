@@ -0,0 +1,253 @@
+package builder
+
+// This file creates firmware images for MCUboot, a secure bootloader that
+// verifies the application (and installs upgrades) before starting it.
+//
+// The image format is documented here:
+// https://docs.mcuboot.com/design.html#image-format
+//
+// An image consists of a header, the program as a raw binary, and a trailer of
+// TLV (type-length-value) records with a SHA-256 hash of the header and binary
+// and optionally a signature. This is the same format that imgtool.py creates.
+// The program must be linked to start directly after the header, which means
+// that the app-offset of the target must be the start of the image slot plus
+// mcubootHeaderSize.
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/marcinbor85/gohex"
+)
+
+const (
+	mcubootImageMagic   = 0x96f3b83d
+	mcubootTLVInfoMagic = 0x6907
+
+	// Size of the header, including padding. The program starts after it, so
+	// it must be a multiple of the alignment of the vector table.
+	mcubootHeaderSize = 0x200
+)
+
+// TLV types in the image trailer.
+const (
+	mcubootTLVKeyHash  = 0x01 // SHA-256 of the public key
+	mcubootTLVSHA256   = 0x10 // SHA-256 of the header and program
+	mcubootTLVECDSA256 = 0x22 // ECDSA P-256 signature of the hash (ASN.1)
+	mcubootTLVED25519  = 0x24 // ed25519 signature of the hash
+)
+
+// mcubootVersion is the version of an image, in the format of the header.
+type mcubootVersion struct {
+	Major    uint8
+	Minor    uint8
+	Revision uint16
+	Build    uint32
+}
+
+// parseMCUbootVersion parses an image version in the format accepted by
+// imgtool.py: major.minor.revision+build, where all but the major version are
+// optional. An empty string is version 0.0.0.
+func parseMCUbootVersion(s string) (mcubootVersion, error) {
+	var version mcubootVersion
+	if s == "" {
+		return version, nil
+	}
+	invalid := fmt.Errorf("invalid image version %#v: expected major.minor.revision+build", s)
+	numbers := s
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		build, err := strconv.ParseUint(s[i+1:], 10, 32)
+		if err != nil {
+			return version, invalid
+		}
+		version.Build = uint32(build)
+		numbers = s[:i]
+	}
+	parts := strings.Split(numbers, ".")
+	if len(parts) > 3 {
+		return version, invalid
+	}
+	for i, part := range parts {
+		bits := 8
+		if i == 2 {
+			bits = 16
+		}
+		n, err := strconv.ParseUint(part, 10, bits)
+		if err != nil {
+			return version, invalid
+		}
+		switch i {
+		case 0:
+			version.Major = uint8(n)
+		case 1:
+			version.Minor = uint8(n)
+		case 2:
+			version.Revision = uint16(n)
+		}
+	}
+	return version, nil
+}
+
+// readMCUbootKey reads a private key to sign images with from a PEM file, as
+// created by imgtool.py keygen. Supported are ed25519 and ECDSA P-256 keys.
+func readMCUbootKey(path string) (crypto.Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: not a PEM file", path)
+	}
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: expected a private key, got %s", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%s: only ECDSA keys on the P-256 curve are supported", path)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported key type %T (expected ed25519 or ECDSA P-256)", path, key)
+	}
+}
+
+// makeMCUbootImage converts an input ELF file to a signed image for MCUboot,
+// as a raw binary or as an Intel hex file at the address of the image slot.
+// If keyPath is empty, the image is not signed: it only contains a hash.
+func makeMCUbootImage(infile, outfile, format, version, keyPath string) error {
+	addr, data, err := extractROM(infile)
+	if err != nil {
+		return err
+	}
+	if addr < mcubootHeaderSize {
+		return fmt.Errorf("program starts at 0x%x, which leaves no room for the MCUboot header (set app-offset to the start of the image slot + 0x%x)", addr, mcubootHeaderSize)
+	}
+	imageVersion, err := parseMCUbootVersion(version)
+	if err != nil {
+		return err
+	}
+	var key crypto.Signer
+	if keyPath != "" {
+		key, err = readMCUbootKey(keyPath)
+		if err != nil {
+			return err
+		}
+	}
+	image, err := createMCUbootImage(data, imageVersion, key)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "mcuboot-bin":
+		return ioutil.WriteFile(outfile, image, 0644)
+	case "mcuboot-hex":
+		mem := gohex.NewMemory()
+		err := mem.AddBinary(uint32(addr-mcubootHeaderSize), image)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(outfile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return mem.DumpIntelHex(f, 16)
+	default:
+		panic("unreachable")
+	}
+}
+
+// createMCUbootImage adds the MCUboot header and trailer to the given program,
+// and signs it if a key is given.
+func createMCUbootImage(program []byte, version mcubootVersion, key crypto.Signer) ([]byte, error) {
+	// Write the header, followed by padding up to the start of the program.
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, struct {
+		Magic          uint32
+		LoadAddr       uint32
+		HeaderSize     uint16
+		ProtectTLVSize uint16
+		ImageSize      uint32
+		Flags          uint32
+		Version        mcubootVersion
+		Padding        uint32
+	}{
+		Magic:      mcubootImageMagic,
+		HeaderSize: mcubootHeaderSize,
+		ImageSize:  uint32(len(program)),
+		Version:    version,
+	})
+	buf.Write(make([]byte, mcubootHeaderSize-buf.Len()))
+	buf.Write(program)
+
+	// The hash covers the header and the program. The signature is created
+	// from the hash, not from the image itself.
+	hash := sha256.Sum256(buf.Bytes())
+	var tlvs []byte
+	addTLV := func(kind uint8, value []byte) {
+		tlvs = append(tlvs, kind, 0, uint8(len(value)), uint8(len(value)>>8))
+		tlvs = append(tlvs, value...)
+	}
+	addTLV(mcubootTLVSHA256, hash[:])
+	if key != nil {
+		// The bootloader checks whether the image is signed with one of its
+		// keys by comparing this hash to the hash of its public keys.
+		publicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		keyHash := sha256.Sum256(publicKey)
+		addTLV(mcubootTLVKeyHash, keyHash[:])
+
+		switch key.(type) {
+		case ed25519.PrivateKey:
+			signature, err := key.Sign(rand.Reader, hash[:], crypto.Hash(0))
+			if err != nil {
+				return nil, err
+			}
+			addTLV(mcubootTLVED25519, signature)
+		case *ecdsa.PrivateKey:
+			signature, err := key.Sign(rand.Reader, hash[:], crypto.SHA256)
+			if err != nil {
+				return nil, err
+			}
+			addTLV(mcubootTLVECDSA256, signature)
+		default:
+			return nil, errors.New("unsupported key type for MCUboot image")
+		}
+	}
+
+	// Write the trailer: the TLV info header (with the size of all TLVs,
+	// including this header), followed by the TLVs.
+	binary.Write(buf, binary.LittleEndian, [2]uint16{mcubootTLVInfoMagic, uint16(4 + len(tlvs))})
+	buf.Write(tlvs)
+	return buf.Bytes(), nil
+}
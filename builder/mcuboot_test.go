@@ -0,0 +1,127 @@
+package builder
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"testing"
+)
+
+func TestParseMCUbootVersion(t *testing.T) {
+	for _, tc := range []struct {
+		version  string
+		expected mcubootVersion
+		ok       bool
+	}{
+		{"", mcubootVersion{}, true},
+		{"1", mcubootVersion{Major: 1}, true},
+		{"1.2", mcubootVersion{Major: 1, Minor: 2}, true},
+		{"1.2.300+40000", mcubootVersion{1, 2, 300, 40000}, true},
+		{"2+5", mcubootVersion{Major: 2, Build: 5}, true},
+		{"256.0.0", mcubootVersion{}, false},
+		{"1.2.3.4", mcubootVersion{}, false},
+		{"1.x", mcubootVersion{}, false},
+		{"1.2+", mcubootVersion{}, false},
+	} {
+		version, err := parseMCUbootVersion(tc.version)
+		if (err == nil) != tc.ok {
+			t.Errorf("%#v: expected ok=%v, got error %v", tc.version, tc.ok, err)
+		} else if tc.ok && version != tc.expected {
+			t.Errorf("%#v: expected %+v, got %+v", tc.version, tc.expected, version)
+		}
+	}
+}
+
+func TestCreateMCUbootImage(t *testing.T) {
+	program := bytes.Repeat([]byte{0xaa}, 1000)
+	version := mcubootVersion{1, 2, 3, 4}
+	ed25519Key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("could not generate key:", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		key     crypto.Signer
+		sigType uint8
+	}{
+		{"unsigned", nil, 0},
+		{"ed25519", ed25519Key, mcubootTLVED25519},
+		{"ecdsa", ecdsaKey, mcubootTLVECDSA256},
+	} {
+		image, err := createMCUbootImage(program, version, tc.key)
+		if err != nil {
+			t.Errorf("%s: could not create image: %v", tc.name, err)
+			continue
+		}
+
+		// Check the header.
+		if magic := binary.LittleEndian.Uint32(image[0:]); magic != mcubootImageMagic {
+			t.Errorf("%s: unexpected magic 0x%x", tc.name, magic)
+		}
+		if size := binary.LittleEndian.Uint16(image[8:]); size != mcubootHeaderSize {
+			t.Errorf("%s: unexpected header size 0x%x", tc.name, size)
+		}
+		if size := binary.LittleEndian.Uint32(image[12:]); size != uint32(len(program)) {
+			t.Errorf("%s: unexpected image size %d", tc.name, size)
+		}
+		if !bytes.Equal(image[20:28], []byte{1, 2, 3, 0, 4, 0, 0, 0}) {
+			t.Errorf("%s: unexpected version %v", tc.name, image[20:28])
+		}
+		if !bytes.Equal(image[mcubootHeaderSize:mcubootHeaderSize+len(program)], program) {
+			t.Errorf("%s: program is not stored after the header", tc.name)
+		}
+
+		// Read the TLVs in the trailer.
+		trailer := image[mcubootHeaderSize+len(program):]
+		if magic := binary.LittleEndian.Uint16(trailer); magic != mcubootTLVInfoMagic {
+			t.Errorf("%s: unexpected TLV info magic 0x%x", tc.name, magic)
+			continue
+		}
+		if size := binary.LittleEndian.Uint16(trailer[2:]); int(size) != len(trailer) {
+			t.Errorf("%s: TLV size is %d, expected %d", tc.name, size, len(trailer))
+		}
+		tlvs := map[uint8][]byte{}
+		for tlv := trailer[4:]; len(tlv) >= 4; {
+			length := int(binary.LittleEndian.Uint16(tlv[2:]))
+			tlvs[tlv[0]] = tlv[4 : 4+length]
+			tlv = tlv[4+length:]
+		}
+
+		hash := sha256.Sum256(image[:mcubootHeaderSize+len(program)])
+		if !bytes.Equal(tlvs[mcubootTLVSHA256], hash[:]) {
+			t.Errorf("%s: invalid image hash", tc.name)
+		}
+		if tc.key == nil {
+			if len(tlvs) != 1 {
+				t.Errorf("%s: expected only a hash, got %d TLVs", tc.name, len(tlvs))
+			}
+			continue
+		}
+		if len(tlvs[mcubootTLVKeyHash]) != sha256.Size {
+			t.Errorf("%s: missing key hash", tc.name)
+		}
+		signature := tlvs[tc.sigType]
+		switch key := tc.key.(type) {
+		case ed25519.PrivateKey:
+			if !ed25519.Verify(key.Public().(ed25519.PublicKey), hash[:], signature) {
+				t.Errorf("%s: invalid signature", tc.name)
+			}
+		case *ecdsa.PrivateKey:
+			var sig struct{ R, S *big.Int }
+			if _, err := asn1.Unmarshal(signature, &sig); err != nil {
+				t.Errorf("%s: could not parse signature: %v", tc.name, err)
+			} else if !ecdsa.Verify(&key.PublicKey, hash[:], sig.R, sig.S) {
+				t.Errorf("%s: invalid signature", tc.name)
+			}
+		}
+	}
+}
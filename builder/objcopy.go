@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"sort"
+	"strconv"
 
 	"github.com/marcinbor85/gohex"
 )
@@ -32,12 +33,34 @@ func (s progSlice) Len() int           { return len(s) }
 func (s progSlice) Less(i, j int) bool { return s[i].Paddr < s[j].Paddr }
 func (s progSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
+// romSegment is a contiguous part of a firmware image.
+type romSegment struct {
+	addr uint64
+	data []byte
+}
+
 // extractROM extracts a firmware image and the first load address from the
-// given ELF file. It tries to emulate the behavior of objcopy.
+// given ELF file. It tries to emulate the behavior of objcopy. The image must be
+// contiguous, see extractROMSegments for images that are not.
 func extractROM(path string) (uint64, []byte, error) {
+	segments, err := extractROMSegments(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(segments) != 1 {
+		return 0, nil, objcopyError{"ROM segments are non-contiguous: " + path, nil}
+	}
+	return segments[0].addr, segments[0].data, nil
+}
+
+// extractROMSegments extracts a firmware image from the given ELF file, as a
+// list of contiguous segments sorted by address. Small gaps between segments
+// are zero-filled, larger gaps (for example, between an application and a
+// separate region for settings) start a new segment.
+func extractROMSegments(path string) ([]romSegment, error) {
 	f, err := elf.Open(path)
 	if err != nil {
-		return 0, nil, objcopyError{"failed to open ELF file to extract text segment", err}
+		return nil, objcopyError{"failed to open ELF file to extract text segment", err}
 	}
 	defer f.Close()
 
@@ -67,75 +90,120 @@ func extractROM(path string) (uint64, []byte, error) {
 		progs = append(progs, prog)
 	}
 	if len(progs) == 0 {
-		return 0, nil, objcopyError{"file does not contain ROM segments: " + path, nil}
+		return nil, objcopyError{"file does not contain ROM segments: " + path, nil}
 	}
 	sort.Sort(progs)
 
-	var rom []byte
+	var segments []romSegment
 	for _, prog := range progs {
-		romEnd := progs[0].Paddr + uint64(len(rom))
-		if prog.Paddr > romEnd && prog.Paddr < romEnd+16 {
-			// Sometimes, the linker seems to insert a bit of padding between
-			// segments. Simply zero-fill these parts.
-			rom = append(rom, make([]byte, prog.Paddr-romEnd)...)
-		}
-		if prog.Paddr != progs[0].Paddr+uint64(len(rom)) {
-			diff := prog.Paddr - (progs[0].Paddr + uint64(len(rom)))
-			if diff > maxPadBytes {
-				return 0, nil, objcopyError{"ROM segments are non-contiguous: " + path, nil}
-			}
-			// Pad the difference
-			rom = append(rom, make([]byte, diff)...)
-		}
 		data, err := ioutil.ReadAll(prog.Open())
 		if err != nil {
-			return 0, nil, objcopyError{"failed to extract segment from ELF file: " + path, err}
+			return nil, objcopyError{"failed to extract segment from ELF file: " + path, err}
 		}
-		rom = append(rom, data...)
+		if len(segments) != 0 {
+			segment := &segments[len(segments)-1]
+			romEnd := segment.addr + uint64(len(segment.data))
+			if prog.Paddr >= romEnd && prog.Paddr-romEnd <= maxPadBytes {
+				// Sometimes, the linker inserts a bit of padding between
+				// segments (for example for page alignment). Simply zero-fill
+				// these parts.
+				segment.data = append(segment.data, make([]byte, prog.Paddr-romEnd)...)
+				segment.data = append(segment.data, data...)
+				continue
+			}
+		}
+		segments = append(segments, romSegment{prog.Paddr, data})
 	}
-	if progs[0].Paddr < startAddr {
+	if first := &segments[0]; first.addr < startAddr && startAddr-first.addr < uint64(len(first.data)) {
 		// The lowest memory address is before the first section. This means
 		// that there is some extra data loaded at the start of the image that
 		// should be discarded.
 		// Example: ELF files where .text doesn't start at address 0 because
 		// there is a bootloader at the start.
-		return startAddr, rom[startAddr-progs[0].Paddr:], nil
-	} else {
-		return progs[0].Paddr, rom, nil
+		first.data = first.data[startAddr-first.addr:]
+		first.addr = startAddr
 	}
+	return segments, nil
 }
 
 // objcopy converts an ELF file to a different (simpler) output file format:
-// .bin or .hex. It extracts only the .text section.
-func objcopy(infile, outfile, binaryFormat string) error {
-	f, err := os.OpenFile(outfile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+// .bin or .hex. It extracts only the parts that are loaded into ROM. The
+// contents of the Intel hex files in mergeFiles (such as a bootloader or the
+// SoftDevice on nRF chips) are merged into the output, which fails if they
+// overlap with the program. Gaps between segments in a .bin file are filled
+// with 0xff, the value of erased flash.
+func objcopy(infile, outfile, binaryFormat string, mergeFiles []string) error {
+	segments, err := extractROMSegments(infile)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	mem := gohex.NewMemory()
+	for _, segment := range segments {
+		err := mem.AddBinary(uint32(segment.addr), segment.data)
+		if err != nil {
+			return objcopyError{"failed to add segment at 0x" + strconv.FormatUint(segment.addr, 16), err}
+		}
+	}
+	for _, path := range mergeFiles {
+		err := mergeHexFile(mem, path)
+		if err != nil {
+			return objcopyError{"failed to merge " + path, err}
+		}
+	}
 
-	// Read the .text segment.
-	addr, data, err := extractROM(infile)
+	f, err := os.OpenFile(outfile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
 	// Write to the file, in the correct format.
 	switch binaryFormat {
 	case "hex":
 		// Intel hex file, includes the firmware start address.
-		mem := gohex.NewMemory()
-		err := mem.AddBinary(uint32(addr), data)
-		if err != nil {
-			return objcopyError{"failed to create .hex file", err}
-		}
 		return mem.DumpIntelHex(f, 16)
 	case "bin":
 		// The start address is not stored in raw firmware files (therefore you
 		// should use .hex files in most cases).
-		_, err := f.Write(data)
+		memSegments := mem.GetDataSegments()
+		sort.Slice(memSegments, func(i, j int) bool {
+			return memSegments[i].Address < memSegments[j].Address
+		})
+		start := memSegments[0].Address
+		last := memSegments[len(memSegments)-1]
+		end := last.Address + uint32(len(last.Data))
+		if end-start > maxBinarySize {
+			return objcopyError{"firmware is too large for a .bin file (use a .hex file instead): 0x" + strconv.FormatUint(uint64(start), 16) + "-0x" + strconv.FormatUint(uint64(end), 16), nil}
+		}
+		_, err := f.Write(mem.ToBinary(start, end-start, 0xff))
 		return err
 	default:
 		panic("unreachable")
 	}
 }
+
+// maxBinarySize is the largest .bin file objcopy will write. Firmware with
+// segments that are further apart (such as a program in flash and data at a
+// RAM address) can only be stored in a .hex file.
+const maxBinarySize = 64 * 1024 * 1024
+
+// mergeHexFile adds the contents of the Intel hex file at path to mem.
+func mergeHexFile(mem *gohex.Memory, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	other := gohex.NewMemory()
+	err = other.ParseIntelHex(f)
+	if err != nil {
+		return err
+	}
+	for _, segment := range other.GetDataSegments() {
+		err := mem.AddBinary(segment.Address, segment.Data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package builder
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/marcinbor85/gohex"
+)
+
+// testSegment is a loadable segment in an ELF file written by writeTestELF.
+type testSegment struct {
+	addr        uint64 // load address (and virtual address)
+	sectionAddr uint64 // address of the section in the segment, if not addr
+	data        string
+}
+
+// writeTestELF writes a minimal 32-bit ARM ELF file with a program header and
+// a section for each segment, and a section name table (which older versions
+// of debug/elf require).
+func writeTestELF(t *testing.T, path string, segments []testSegment) {
+	const (
+		headerSize  = 52
+		progSize    = 32
+		sectionSize = 40
+	)
+	dataOffset := headerSize + progSize*len(segments)
+	dataSize := 0
+	for _, segment := range segments {
+		dataSize += len(segment.data)
+	}
+	const shstrtab = "\x00.shstrtab\x00"
+	header := elf.Header32{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_ARM),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     headerSize,
+		Shoff:     uint32(dataOffset + dataSize + len(shstrtab)),
+		Ehsize:    headerSize,
+		Phentsize: progSize,
+		Phnum:     uint16(len(segments)),
+		Shentsize: sectionSize,
+		Shnum:     uint16(len(segments) + 2),
+		Shstrndx:  uint16(len(segments) + 1),
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS32)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, header)
+	offset := dataOffset
+	for _, segment := range segments {
+		binary.Write(buf, binary.LittleEndian, elf.Prog32{
+			Type:   uint32(elf.PT_LOAD),
+			Off:    uint32(offset),
+			Vaddr:  uint32(segment.addr),
+			Paddr:  uint32(segment.addr),
+			Filesz: uint32(len(segment.data)),
+			Memsz:  uint32(len(segment.data)),
+			Flags:  uint32(elf.PF_R),
+		})
+		offset += len(segment.data)
+	}
+	for _, segment := range segments {
+		buf.WriteString(segment.data)
+	}
+	buf.WriteString(shstrtab)
+	binary.Write(buf, binary.LittleEndian, elf.Section32{}) // null section
+	offset = dataOffset
+	for _, segment := range segments {
+		addr := segment.sectionAddr
+		if addr == 0 {
+			addr = segment.addr
+		}
+		binary.Write(buf, binary.LittleEndian, elf.Section32{
+			Type:  uint32(elf.SHT_PROGBITS),
+			Flags: uint32(elf.SHF_ALLOC),
+			Addr:  uint32(addr),
+			Off:   uint32(offset) + uint32(addr-segment.addr),
+			Size:  uint32(len(segment.data)) - uint32(addr-segment.addr),
+		})
+		offset += len(segment.data)
+	}
+	binary.Write(buf, binary.LittleEndian, elf.Section32{
+		Name: 1,
+		Type: uint32(elf.SHT_STRTAB),
+		Off:  uint32(dataOffset + dataSize),
+		Size: uint32(len(shstrtab)),
+	})
+	err := ioutil.WriteFile(path, buf.Bytes(), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractROMSegments(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-objcopy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	for _, tc := range []struct {
+		name     string
+		segments []testSegment
+		expected []romSegment
+	}{
+		{
+			name:     "single",
+			segments: []testSegment{{addr: 0x1000, data: "abcd"}},
+			expected: []romSegment{{0x1000, []byte("abcd")}},
+		},
+		{
+			name:     "padding",
+			segments: []testSegment{{addr: 0x1000, data: "ab"}, {addr: 0x1008, data: "cd"}},
+			expected: []romSegment{{0x1000, []byte("ab\x00\x00\x00\x00\x00\x00cd")}},
+		},
+		{
+			name:     "gap",
+			segments: []testSegment{{addr: 0x1000, data: "ab"}, {addr: 0x10000, data: "cd"}},
+			expected: []romSegment{{0x1000, []byte("ab")}, {0x10000, []byte("cd")}},
+		},
+		{
+			name:     "unsorted",
+			segments: []testSegment{{addr: 0x20000, data: "cd"}, {addr: 0x1000, data: "ab"}},
+			expected: []romSegment{{0x1000, []byte("ab")}, {0x20000, []byte("cd")}},
+		},
+		{
+			name:     "leading data",
+			segments: []testSegment{{addr: 0x1000, sectionAddr: 0x1002, data: "xxab"}},
+			expected: []romSegment{{0x1002, []byte("ab")}},
+		},
+	} {
+		path := filepath.Join(tmpdir, tc.name+".elf")
+		writeTestELF(t, path, tc.segments)
+		segments, err := extractROMSegments(path)
+		if err != nil {
+			t.Errorf("%s: could not extract segments: %s", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(segments, tc.expected) {
+			t.Errorf("%s: expected segments %v, got %v", tc.name, tc.expected, segments)
+		}
+	}
+}
+
+func TestObjcopyMergeHex(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-objcopy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	executable := filepath.Join(tmpdir, "program.elf")
+	writeTestELF(t, executable, []testSegment{{addr: 0x1000, data: "prog"}})
+
+	// writeHex writes an Intel hex file with the given data at addr.
+	writeHex := func(name string, addr uint32, data string) string {
+		mem := gohex.NewMemory()
+		if err := mem.AddBinary(addr, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		buf := &bytes.Buffer{}
+		if err := mem.DumpIntelHex(buf, 16); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(tmpdir, name)
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	bootloader := writeHex("bootloader.hex", 0x0, "boot")
+	settings := writeHex("settings.hex", 0x2000, "conf")
+
+	// A .bin file is filled with 0xff between the program and the merged
+	// files.
+	binPath := filepath.Join(tmpdir, "out.bin")
+	err = objcopy(executable, binPath, "bin", []string{bootloader, settings})
+	if err != nil {
+		t.Fatal("could not write .bin file:", err)
+	}
+	bin, err := ioutil.ReadFile(binPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "boot" + strings.Repeat("\xff", 0x1000-4) + "prog" + strings.Repeat("\xff", 0x1000-4) + "conf"
+	if string(bin) != expected {
+		t.Errorf("unexpected .bin file of %d bytes", len(bin))
+	}
+
+	// A .hex file contains the same data at the same addresses.
+	hexPath := filepath.Join(tmpdir, "out.hex")
+	err = objcopy(executable, hexPath, "hex", []string{bootloader, settings})
+	if err != nil {
+		t.Fatal("could not write .hex file:", err)
+	}
+	f, err := os.Open(hexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	mem := gohex.NewMemory()
+	if err := mem.ParseIntelHex(f); err != nil {
+		t.Fatal("could not parse .hex file:", err)
+	}
+	if data := mem.ToBinary(0, 0x2004, 0xff); string(data) != expected {
+		t.Error("unexpected .hex file contents")
+	}
+
+	// A merged file may not overlap with the program.
+	overlap := writeHex("overlap.hex", 0x1002, "xx")
+	err = objcopy(executable, filepath.Join(tmpdir, "overlap.bin"), "bin", []string{overlap})
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to merge "+overlap) {
+		t.Errorf("expected an error for overlapping data, got %v", err)
+	}
+}
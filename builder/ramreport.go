@@ -0,0 +1,145 @@
+package builder
+
+// This file combines the stack size analysis and the sizes of globals into a
+// report of the worst-case RAM usage of a program.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/stacksize"
+)
+
+// ramReport is the worst-case RAM usage of a program, as far as it can be
+// determined at link time. It is printed with -ram-report and checked with
+// -ram-check. Every go statement is counted as a single goroutine, so the total
+// is only a lower bound when a go statement runs more than once, for example in
+// a loop.
+type ramReport struct {
+	RAM         uint64           `json:"ram"`          // RAM of the target, or 0 if unknown
+	Globals     uint64           `json:"globals"`      // data and bss, including the system stack
+	SystemStack uint64           `json:"system-stack"` // stack usage of the reset handler, excluding interrupts
+	Goroutines  []goroutineStack `json:"goroutines"`
+	HeapReserve uint64           `json:"heap-reserve"` // heap space that must remain available (-heap-reserve)
+	Total       uint64           `json:"total"`        // globals, goroutine stacks and heap reserve
+}
+
+// goroutineStack is the stack requirement of a single goroutine start site.
+// Each goroutine started from the same site is counted once.
+type goroutineStack struct {
+	Function  string `json:"function"`
+	StackSize uint64 `json:"stack-size"`       // the stack allocated by the runtime
+	Bounded   bool   `json:"bounded"`          // false if the default stack size is used
+	Reason    string `json:"reason,omitempty"` // why the default stack size is used
+}
+
+// makeRAMReport calculates the worst-case RAM usage of the program from the
+// sizes of the globals and the stack sizes as determined by
+// determineStackSizes. The goroutine stacks are the sizes that the runtime
+// allocates: the calculated stack size with the overhead that
+// modifyStackSizes adds when the stack size is determined automatically, and
+// the default stack size otherwise.
+func makeRAMReport(config *compileopts.Config, sizes *programSize, calculatedStacks []string, stackSizes map[string]functionStackSize) *ramReport {
+	_, ram := config.Target.MemorySizes()
+	report := &ramReport{
+		RAM:         ram,
+		Globals:     sizes.Data + sizes.BSS,
+		HeapReserve: config.Options.HeapReserve,
+		Goroutines:  []goroutineStack{},
+	}
+	report.Total = report.Globals + report.HeapReserve
+	// Like the ELF machine in modifyStackSizes (GOARCH is also arm on AVR).
+	isARM := strings.HasPrefix(config.Triple(), "arm") || strings.HasPrefix(config.Triple(), "thumb")
+	for _, name := range calculatedStacks {
+		fn := stackSizes[name]
+		if name == "Reset_Handler" {
+			// The system stack is already reserved in the globals (as bss).
+			if fn.stackSizeType == stacksize.Bounded {
+				report.SystemStack = fn.stackSize
+			}
+			continue
+		}
+		if config.Scheduler() != "tasks" {
+			// Goroutines don't have their own stack.
+			continue
+		}
+		goroutine := goroutineStack{
+			Function:  fn.humanName,
+			StackSize: fn.stackSize + goroutineStackOverhead(isARM),
+			Bounded:   fn.stackSizeType == stacksize.Bounded,
+		}
+		if !config.AutomaticStackSize() {
+			// All goroutines get the same stack size.
+			goroutine.StackSize = config.Target.DefaultStackSize
+			goroutine.Bounded = false
+			goroutine.Reason = "automatic stack sizes are not used on this target"
+		} else if !goroutine.Bounded {
+			// The runtime uses the default stack size for these goroutines.
+			goroutine.StackSize = config.Target.DefaultStackSize
+			switch fn.stackSizeType {
+			case stacksize.Unknown:
+				goroutine.Reason = fmt.Sprintf("%s does not have stack frame information", fn.missingStackSize)
+			case stacksize.Recursive:
+				goroutine.Reason = fmt.Sprintf("%s may call itself", fn.missingStackSize)
+			case stacksize.IndirectCall:
+				goroutine.Reason = fmt.Sprintf("%s calls a function pointer", fn.missingStackSize)
+			}
+		}
+		report.Goroutines = append(report.Goroutines, goroutine)
+		report.Total += goroutine.StackSize
+	}
+	return report
+}
+
+// print writes the report to w, either as a table (text) or as JSON.
+func (r *ramReport) print(w io.Writer, format string) error {
+	switch format {
+	case "text":
+		fmt.Fprintf(w, "%-32s %s\n", "ram usage", "bytes")
+		fmt.Fprintf(w, "%-32s %d\n", "globals (incl. system stack)", r.Globals)
+		if r.SystemStack != 0 {
+			fmt.Fprintf(w, "%-32s %d (excluding interrupts)\n", "  system stack usage", r.SystemStack)
+		}
+		for _, goroutine := range r.Goroutines {
+			if goroutine.Bounded {
+				fmt.Fprintf(w, "%-32s %d\n", "goroutine "+goroutine.Function, goroutine.StackSize)
+			} else {
+				fmt.Fprintf(w, "%-32s %d (default, %s)\n", "goroutine "+goroutine.Function, goroutine.StackSize, goroutine.Reason)
+			}
+		}
+		fmt.Fprintf(w, "%-32s %d\n", "heap reserve", r.HeapReserve)
+		if len(r.Goroutines) != 0 {
+			fmt.Fprintf(w, "goroutines are counted once per go statement, so the total is a lower bound if a go statement runs more than once\n")
+		}
+		if r.RAM != 0 {
+			fmt.Fprintf(w, "%-32s %d of %d (%d%%)\n", "total", r.Total, r.RAM, r.Total*100/r.RAM)
+		} else {
+			fmt.Fprintf(w, "%-32s %d (RAM size of the target unknown)\n", "total", r.Total)
+		}
+	case "json":
+		data, err := json.MarshalIndent(r, "", "\t")
+		if err != nil {
+			return err
+		}
+		w.Write(append(data, '\n'))
+	default:
+		return fmt.Errorf("unknown RAM report format: %s", format)
+	}
+	return nil
+}
+
+// check returns an error if the worst-case RAM usage does not fit in the RAM
+// of the target.
+func (r *ramReport) check() error {
+	if r.RAM == 0 {
+		return errors.New("cannot check RAM usage: RAM size of the target is unknown")
+	}
+	if r.Total > r.RAM {
+		return fmt.Errorf("worst-case RAM usage of %d bytes exceeds the %d bytes of RAM by %d bytes (see -ram-report=text)", r.Total, r.RAM, r.Total-r.RAM)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package builder
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/stacksize"
+)
+
+func TestRAMReport(t *testing.T) {
+	autoStackSize := true
+	noAutoStackSize := false
+	sizes := &programSize{Data: 100, BSS: 2948}
+	stackSizes := map[string]functionStackSize{
+		"Reset_Handler":        {humanName: "Reset_Handler", stackSize: 300, stackSizeType: stacksize.Bounded},
+		"main.blink$gowrapper": {humanName: "main.blink", stackSize: 200, stackSizeType: stacksize.Bounded},
+		"main.serve$gowrapper": {humanName: "main.serve", stackSizeType: stacksize.IndirectCall, missingStackSize: &stacksize.CallNode{}},
+	}
+	calculatedStacks := []string{"Reset_Handler", "main.blink$gowrapper", "main.serve$gowrapper"}
+	for _, tc := range []struct {
+		triple        string
+		autoStackSize *bool
+		scheduler     string
+		stacks        []uint64 // stack size of each goroutine
+	}{
+		// The stack canary and the registers stored by interrupts on
+		// Cortex-M are added to the calculated stack size, like in
+		// modifyStackSizes.
+		{"thumbv7em-unknown-unknown-eabi", &autoStackSize, "tasks", []uint64{200 + 4 + 32, 2048}},
+		{"riscv32-unknown-none", &autoStackSize, "tasks", []uint64{200 + 4, 2048}},
+		// Without automatic stack sizes, all goroutines get the default stack
+		// size.
+		{"thumbv7em-unknown-unknown-eabi", &noAutoStackSize, "tasks", []uint64{2048, 2048}},
+		{"thumbv7em-unknown-unknown-eabi", nil, "tasks", []uint64{2048, 2048}},
+		// Coroutines don't have a stack.
+		{"thumbv7em-unknown-unknown-eabi", &autoStackSize, "coroutines", nil},
+	} {
+		config := &compileopts.Config{
+			Options: &compileopts.Options{HeapReserve: 1024, Scheduler: tc.scheduler},
+			Target: &compileopts.TargetSpec{
+				Triple:           tc.triple,
+				FlashSize:        "256K",
+				RAMOrigin:        "0x20000000",
+				RAMSize:          "8K",
+				DefaultStackSize: 2048,
+				AutoStackSize:    tc.autoStackSize,
+			},
+		}
+		report := makeRAMReport(config, sizes, calculatedStacks, stackSizes)
+		if report.RAM != 8192 || report.SystemStack != 300 || len(report.Goroutines) != len(tc.stacks) {
+			t.Errorf("%s, %s: unexpected RAM report: %+v", tc.triple, tc.scheduler, report)
+			continue
+		}
+		total := uint64(100 + 2948 + 1024)
+		for i, stackSize := range tc.stacks {
+			total += stackSize
+			if report.Goroutines[i].StackSize != stackSize {
+				t.Errorf("%s, %s: expected stack size %d for %s, got %d", tc.triple, tc.scheduler, stackSize, report.Goroutines[i].Function, report.Goroutines[i].StackSize)
+			}
+		}
+		if len(tc.stacks) != 0 && report.Goroutines[1].Bounded {
+			t.Errorf("%s, %s: expected the default stack size for an unbounded goroutine: %+v", tc.triple, tc.scheduler, report.Goroutines[1])
+		}
+		if report.Total != total {
+			t.Errorf("%s, %s: expected a total of %d bytes, got %d", tc.triple, tc.scheduler, total, report.Total)
+		}
+	}
+
+	config := &compileopts.Config{
+		Options: &compileopts.Options{HeapReserve: 1024, Scheduler: "tasks"},
+		Target: &compileopts.TargetSpec{
+			Triple:           "thumbv7em-unknown-unknown-eabi",
+			FlashSize:        "256K",
+			RAMOrigin:        "0x20000000",
+			RAMSize:          "8K",
+			DefaultStackSize: 2048,
+			AutoStackSize:    &autoStackSize,
+		},
+	}
+	report := makeRAMReport(config, sizes, calculatedStacks, stackSizes)
+	if err := report.check(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := report.print(buf, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "lower bound") {
+		t.Errorf("expected a note that goroutines are counted once:\n%s", buf.String())
+	}
+
+	report.Total = 9000
+	if err := report.check(); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("expected an error for exceeding the RAM, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package builder
+
+// This file implements tinygo size-diff, which compares the sizes of two
+// builds.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// SizeDiff prints the difference in size between two builds. Each build is
+// either an ELF file or a JSON file as written by -size=json. The format is
+// either full (per package) or symbols (per symbol, largest change first).
+func SizeDiff(w io.Writer, oldPath, newPath, format string) error {
+	oldSizes, err := loadSizeFile(oldPath)
+	if err != nil {
+		return err
+	}
+	newSizes, err := loadSizeFile(newPath)
+	if err != nil {
+		return err
+	}
+	return printSizeDiff(w, oldSizes, newSizes, format)
+}
+
+// loadSizeFile loads the program size from an ELF file or from a JSON file
+// written by -size=json.
+func loadSizeFile(path string) (*programSize, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		// Not JSON, so it should be an ELF file.
+		return loadProgramSize(path)
+	}
+	var input jsonProgramSize
+	err = json.Unmarshal(data, &input)
+	if err != nil {
+		return nil, fmt.Errorf("could not read sizes from %s: %w", path, err)
+	}
+	sizes := &programSize{
+		Packages: make(map[string]*packageSize),
+		Code:     input.Code,
+		Data:     input.Data,
+		BSS:      input.BSS,
+	}
+	for _, pkg := range input.Packages {
+		sizes.Packages[pkg.Name] = &packageSize{
+			Code:   pkg.Code,
+			ROData: pkg.ROData,
+			Data:   pkg.Data,
+			BSS:    pkg.BSS,
+		}
+	}
+	for _, symbol := range input.Symbols {
+		sizes.Symbols = append(sizes.Symbols, symbolSize(symbol))
+	}
+	return sizes, nil
+}
+
+// printSizeDiff prints the difference between two program sizes. Packages and
+// symbols that didn't change in size are not printed.
+func printSizeDiff(w io.Writer, oldSizes, newSizes *programSize, format string) error {
+	switch format {
+	case "full":
+		names := make(map[string]struct{})
+		for name := range oldSizes.Packages {
+			names[name] = struct{}{}
+		}
+		for name := range newSizes.Packages {
+			names[name] = struct{}{}
+		}
+		sortedNames := make([]string, 0, len(names))
+		for name := range names {
+			sortedNames = append(sortedNames, name)
+		}
+		sort.Strings(sortedNames)
+		fmt.Fprintf(w, "   flash      ram | package\n")
+		for _, name := range sortedNames {
+			oldSize := oldSizes.Packages[name]
+			if oldSize == nil {
+				oldSize = &packageSize{}
+			}
+			newSize := newSizes.Packages[name]
+			if newSize == nil {
+				newSize = &packageSize{}
+			}
+			flash := sizeDelta(oldSize.Flash(), newSize.Flash())
+			ram := sizeDelta(oldSize.RAM(), newSize.RAM())
+			if flash == 0 && ram == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "%+8d %+8d | %s\n", flash, ram, name)
+		}
+		flash := sizeDelta(oldSizes.Code+oldSizes.Data, newSizes.Code+newSizes.Data)
+		ram := sizeDelta(oldSizes.Data+oldSizes.BSS, newSizes.Data+newSizes.BSS)
+		fmt.Fprintf(w, "%+8d %+8d | (all)\n", flash, ram)
+	case "symbols":
+		type symbolKey struct {
+			name, pkg, kind string
+		}
+		type symbolDiff struct {
+			symbolKey
+			oldSize, newSize uint64
+		}
+		diffs := make(map[symbolKey]*symbolDiff)
+		for _, symbol := range oldSizes.Symbols {
+			key := symbolKey{symbol.Name, symbol.Package, symbol.Kind}
+			if diffs[key] == nil {
+				diffs[key] = &symbolDiff{symbolKey: key}
+			}
+			diffs[key].oldSize += symbol.Size
+		}
+		for _, symbol := range newSizes.Symbols {
+			key := symbolKey{symbol.Name, symbol.Package, symbol.Kind}
+			if diffs[key] == nil {
+				diffs[key] = &symbolDiff{symbolKey: key}
+			}
+			diffs[key].newSize += symbol.Size
+		}
+		var changed []*symbolDiff
+		for _, diff := range diffs {
+			if diff.oldSize != diff.newSize {
+				changed = append(changed, diff)
+			}
+		}
+		sort.Slice(changed, func(i, j int) bool {
+			deltaI := abs(sizeDelta(changed[i].oldSize, changed[i].newSize))
+			deltaJ := abs(sizeDelta(changed[j].oldSize, changed[j].newSize))
+			if deltaI != deltaJ {
+				return deltaI > deltaJ
+			}
+			return changed[i].name < changed[j].name
+		})
+		fmt.Fprintf(w, "   delta     old     new kind   | package | symbol\n")
+		for _, diff := range changed {
+			fmt.Fprintf(w, "%+8d %7d %7d %-6s | %s | %s\n", sizeDelta(diff.oldSize, diff.newSize), diff.oldSize, diff.newSize, diff.kind, diff.pkg, diff.name)
+		}
+	default:
+		return fmt.Errorf("unknown size-diff format: %#v", format)
+	}
+	return nil
+}
+
+// sizeDelta returns the (signed) difference between two sizes.
+func sizeDelta(oldSize, newSize uint64) int64 {
+	return int64(newSize) - int64(oldSize)
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
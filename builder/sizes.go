@@ -1,7 +1,12 @@
 package builder
 
 import (
+	"debug/dwarf"
 	"debug/elf"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
 	"sort"
 	"strings"
 )
@@ -9,6 +14,7 @@ import (
 // programSize contains size statistics per package of a compiled program.
 type programSize struct {
 	Packages map[string]*packageSize
+	Symbols  []symbolSize
 	Sum      *packageSize
 	Code     uint64
 	Data     uint64
@@ -27,7 +33,8 @@ func (ps *programSize) sortedPackageNames() []string {
 }
 
 // packageSize contains the size of a package, calculated from the linked object
-// file.
+// file. Code that was not written in Go is grouped by library (such as
+// "C picolibc") or by source file.
 type packageSize struct {
 	Code   uint64
 	ROData uint64
@@ -35,6 +42,15 @@ type packageSize struct {
 	BSS    uint64
 }
 
+// symbolSize is the size of a single function or global in the linked object
+// file.
+type symbolSize struct {
+	Name    string
+	Package string
+	Kind    string // code, rodata, data, or bss
+	Size    uint64
+}
+
 // Flash usage in regular microcontrollers.
 func (ps *packageSize) Flash() uint64 {
 	return ps.Code + ps.ROData + ps.Data
@@ -128,35 +144,43 @@ func loadProgramSize(path string) (*programSize, error) {
 	}
 	sort.Sort(symbolList(symbols))
 
+	// The DWARF debug information (if present) tells which symbols were
+	// compiled from C or assembly.
+	files := &sourceFiles{}
+	if data, err := file.DWARF(); err == nil {
+		files = loadSourceFiles(data)
+	}
+
 	sizes := map[string]*packageSize{}
+	var symbolSizes []symbolSize
 	var lastSymbolValue uint64
 	for _, symbol := range symbols {
 		symType := elf.ST_TYPE(symbol.Info)
 		//bind := elf.ST_BIND(symbol.Info)
 		section := file.Sections[symbol.Section]
-		pkgName := "(bootstrap)"
-		symName := strings.TrimLeft(symbol.Name, "(*")
-		dot := strings.IndexByte(symName, '.')
-		if dot > 0 {
-			pkgName = symName[:dot]
-		}
+		pkgName := symbolPackage(symbol, files)
 		pkgSize := sizes[pkgName]
 		if pkgSize == nil {
 			pkgSize = &packageSize{}
 			sizes[pkgName] = pkgSize
 		}
 		if lastSymbolValue != symbol.Value || lastSymbolValue == 0 {
+			kind := "rodata"
 			if symType == elf.STT_FUNC {
+				kind = "code"
 				pkgSize.Code += symbol.Size
 			} else if section.Flags&elf.SHF_WRITE != 0 {
 				if section.Type == elf.SHT_NOBITS {
+					kind = "bss"
 					pkgSize.BSS += symbol.Size
 				} else {
+					kind = "data"
 					pkgSize.Data += symbol.Size
 				}
 			} else {
 				pkgSize.ROData += symbol.Size
 			}
+			symbolSizes = append(symbolSizes, symbolSize{symbol.Name, pkgName, kind, symbol.Size})
 		}
 		lastSymbolValue = symbol.Value
 	}
@@ -169,5 +193,177 @@ func loadProgramSize(path string) (*programSize, error) {
 		sum.BSS += pkg.BSS
 	}
 
-	return &programSize{Packages: sizes, Code: sumCode, Data: sumData, BSS: sumBSS, Sum: sum}, nil
+	return &programSize{Packages: sizes, Symbols: symbolSizes, Code: sumCode, Data: sumData, BSS: sumBSS, Sum: sum}, nil
+}
+
+// compileUnit is the address range of a DWARF compile unit that was not
+// compiled from Go.
+type compileUnit struct {
+	low, high uint64
+	name      string // source file
+}
+
+// sourceFiles maps addresses to the C or assembly source file they were
+// compiled from, based on DWARF debug information.
+type sourceFiles struct {
+	code []compileUnit     // address ranges of functions
+	data map[uint64]string // addresses of global variables
+}
+
+// loadSourceFiles reads all compile units in the DWARF data that were not
+// produced by TinyGo itself, so that symbols from C and assembly files can be
+// attributed to those files.
+func loadSourceFiles(data *dwarf.Data) *sourceFiles {
+	files := &sourceFiles{data: map[uint64]string{}}
+	r := data.Reader()
+	var name string // name of the current compile unit, if it is not Go
+	for {
+		entry, err := r.Next()
+		if err != nil || entry == nil {
+			break
+		}
+		switch entry.Tag {
+		case dwarf.TagCompileUnit:
+			producer, _ := entry.Val(dwarf.AttrProducer).(string)
+			name, _ = entry.Val(dwarf.AttrName).(string)
+			if producer == "TinyGo" || name == "" {
+				name = ""
+				r.SkipChildren()
+				continue
+			}
+			ranges, err := data.Ranges(entry)
+			if err != nil {
+				continue
+			}
+			for _, rng := range ranges {
+				files.code = append(files.code, compileUnit{rng[0], rng[1], name})
+			}
+		case dwarf.TagVariable:
+			// Global variables have a location of the form DW_OP_addr <addr>.
+			location, ok := entry.Val(dwarf.AttrLocation).([]byte)
+			size := r.AddressSize()
+			if !ok || len(location) < 1+size || location[0] != 0x03 || name == "" {
+				continue
+			}
+			var addr uint64
+			for i := size; i >= 1; i-- {
+				addr = addr<<8 | uint64(location[i]) // little endian
+			}
+			files.data[addr] = name
+		}
+	}
+	return files
+}
+
+// symbolPackage returns the name of the package a symbol belongs to. For Go
+// symbols, this is the package path. For C and assembly symbols this is the
+// library it is part of (such as "C picolibc") or the source file.
+func symbolPackage(symbol elf.Symbol, files *sourceFiles) string {
+	name := files.data[symbol.Value]
+	if name == "" {
+		for _, unit := range files.code {
+			if symbol.Value >= unit.low && symbol.Value < unit.high {
+				name = unit.name
+				break
+			}
+		}
+	}
+	if name != "" {
+		path := filepath.ToSlash(name)
+		for _, lib := range []string{"picolibc", "compiler-rt", "wasi-libc"} {
+			if strings.Contains(path, "/"+lib+"/") {
+				return "C " + lib
+			}
+		}
+		return "C " + filepath.Base(name)
+	}
+	symName := strings.TrimLeft(symbol.Name, "(*")
+	dot := strings.IndexByte(symName, '.')
+	if dot > 0 {
+		return symName[:dot]
+	}
+	return "(bootstrap)"
+}
+
+// jsonProgramSize is the format of -size=json. It can be read back by tinygo
+// size-diff.
+type jsonProgramSize struct {
+	Code     uint64        `json:"code"`
+	Data     uint64        `json:"data"`
+	BSS      uint64        `json:"bss"`
+	Flash    uint64        `json:"flash"`
+	RAM      uint64        `json:"ram"`
+	Packages []jsonPackage `json:"packages"`
+	Symbols  []jsonSymbol  `json:"symbols"`
+}
+
+type jsonPackage struct {
+	Name   string `json:"name"`
+	Code   uint64 `json:"code"`
+	ROData uint64 `json:"rodata"`
+	Data   uint64 `json:"data"`
+	BSS    uint64 `json:"bss"`
+	Flash  uint64 `json:"flash"`
+	RAM    uint64 `json:"ram"`
+}
+
+type jsonSymbol struct {
+	Name    string `json:"name"`
+	Package string `json:"package"`
+	Kind    string `json:"kind"`
+	Size    uint64 `json:"size"`
+}
+
+// printProgramSize prints the size of the program in the given format: short,
+// full (per package), symbols (per symbol, largest first) or json (everything,
+// in a machine readable format).
+func printProgramSize(w io.Writer, sizes *programSize, format string) error {
+	switch format {
+	case "short":
+		fmt.Fprintf(w, "   code    data     bss |   flash     ram\n")
+		fmt.Fprintf(w, "%7d %7d %7d | %7d %7d\n", sizes.Code, sizes.Data, sizes.BSS, sizes.Code+sizes.Data, sizes.Data+sizes.BSS)
+	case "full":
+		fmt.Fprintf(w, "   code  rodata    data     bss |   flash     ram | package\n")
+		for _, name := range sizes.sortedPackageNames() {
+			pkgSize := sizes.Packages[name]
+			fmt.Fprintf(w, "%7d %7d %7d %7d | %7d %7d | %s\n", pkgSize.Code, pkgSize.ROData, pkgSize.Data, pkgSize.BSS, pkgSize.Flash(), pkgSize.RAM(), name)
+		}
+		fmt.Fprintf(w, "%7d %7d %7d %7d | %7d %7d | (sum)\n", sizes.Sum.Code, sizes.Sum.ROData, sizes.Sum.Data, sizes.Sum.BSS, sizes.Sum.Flash(), sizes.Sum.RAM())
+		fmt.Fprintf(w, "%7d       - %7d %7d | %7d %7d | (all)\n", sizes.Code, sizes.Data, sizes.BSS, sizes.Code+sizes.Data, sizes.Data+sizes.BSS)
+	case "symbols":
+		symbols := append([]symbolSize(nil), sizes.Symbols...)
+		sort.SliceStable(symbols, func(i, j int) bool {
+			if symbols[i].Size != symbols[j].Size {
+				return symbols[i].Size > symbols[j].Size
+			}
+			return symbols[i].Name < symbols[j].Name
+		})
+		fmt.Fprintf(w, "   size kind   | package | symbol\n")
+		for _, symbol := range symbols {
+			fmt.Fprintf(w, "%7d %-6s | %s | %s\n", symbol.Size, symbol.Kind, symbol.Package, symbol.Name)
+		}
+	case "json":
+		output := jsonProgramSize{
+			Code:     sizes.Code,
+			Data:     sizes.Data,
+			BSS:      sizes.BSS,
+			Flash:    sizes.Code + sizes.Data,
+			RAM:      sizes.Data + sizes.BSS,
+			Packages: []jsonPackage{},
+			Symbols:  []jsonSymbol{},
+		}
+		for _, name := range sizes.sortedPackageNames() {
+			pkgSize := sizes.Packages[name]
+			output.Packages = append(output.Packages, jsonPackage{name, pkgSize.Code, pkgSize.ROData, pkgSize.Data, pkgSize.BSS, pkgSize.Flash(), pkgSize.RAM()})
+		}
+		for _, symbol := range sizes.Symbols {
+			output.Symbols = append(output.Symbols, jsonSymbol(symbol))
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(output)
+	default:
+		return fmt.Errorf("unknown size format: %#v", format)
+	}
+	return nil
 }
@@ -0,0 +1,151 @@
+package builder
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/json"
+	"testing"
+)
+
+func TestPrintProgramSize(t *testing.T) {
+	sizes := &programSize{
+		Packages: map[string]*packageSize{
+			"runtime":    {Code: 1000, ROData: 100, BSS: 200},
+			"C picolibc": {Code: 300, Data: 8},
+		},
+		Symbols: []symbolSize{
+			{"runtime.alloc", "runtime", "code", 600},
+			{"memcpy", "C picolibc", "code", 300},
+			{"runtime.heapStart", "runtime", "bss", 200},
+		},
+		Sum:  &packageSize{Code: 1300, ROData: 100, Data: 8, BSS: 200},
+		Code: 1400,
+		Data: 8,
+		BSS:  200,
+	}
+
+	buf := &bytes.Buffer{}
+	if err := printProgramSize(buf, sizes, "symbols"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "" +
+		"   size kind   | package | symbol\n" +
+		"    600 code   | runtime | runtime.alloc\n" +
+		"    300 code   | C picolibc | memcpy\n" +
+		"    200 bss    | runtime | runtime.heapStart\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected symbols output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	if err := printProgramSize(buf, sizes, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var output struct {
+		Flash    uint64
+		Packages []struct {
+			Name  string
+			Flash uint64
+		}
+		Symbols []struct {
+			Name string
+			Kind string
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &output); err != nil {
+		t.Fatal("could not parse JSON output:", err)
+	}
+	if output.Flash != 1408 || len(output.Packages) != 2 || len(output.Symbols) != 3 {
+		t.Fatalf("unexpected JSON output: %s", buf.String())
+	}
+	if output.Packages[0].Name != "C picolibc" || output.Packages[0].Flash != 308 {
+		t.Errorf("unexpected first package: %+v", output.Packages[0])
+	}
+	if output.Symbols[1].Name != "memcpy" || output.Symbols[1].Kind != "code" {
+		t.Errorf("unexpected second symbol: %+v", output.Symbols[1])
+	}
+}
+
+func TestPrintSizeDiff(t *testing.T) {
+	oldSizes := &programSize{
+		Packages: map[string]*packageSize{
+			"runtime": {Code: 1000, BSS: 200},
+			"main":    {Code: 100},
+		},
+		Symbols: []symbolSize{
+			{"runtime.alloc", "runtime", "code", 600},
+			{"main.main", "main", "code", 100},
+		},
+		Code: 1100,
+		BSS:  200,
+	}
+	newSizes := &programSize{
+		Packages: map[string]*packageSize{
+			"runtime": {Code: 1000, BSS: 200},
+			"main":    {Code: 150, Data: 4},
+			"fmt":     {Code: 2000},
+		},
+		Symbols: []symbolSize{
+			{"runtime.alloc", "runtime", "code", 600},
+			{"main.main", "main", "code", 150},
+			{"fmt.Println", "fmt", "code", 2000},
+		},
+		Code: 3150,
+		Data: 4,
+		BSS:  200,
+	}
+
+	buf := &bytes.Buffer{}
+	if err := printSizeDiff(buf, oldSizes, newSizes, "full"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "" +
+		"   flash      ram | package\n" +
+		"   +2000       +0 | fmt\n" +
+		"     +54       +4 | main\n" +
+		"   +2054       +4 | (all)\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected package diff:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	if err := printSizeDiff(buf, oldSizes, newSizes, "symbols"); err != nil {
+		t.Fatal(err)
+	}
+	expected = "" +
+		"   delta     old     new kind   | package | symbol\n" +
+		"   +2000       0    2000 code   | fmt | fmt.Println\n" +
+		"     +50     100     150 code   | main | main.main\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected symbol diff:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestSymbolPackage(t *testing.T) {
+	files := &sourceFiles{
+		code: []compileUnit{
+			{0x1000, 0x1100, "/src/picolibc/newlib/libc/string/memcpy.c"},
+			{0x1100, 0x1200, "/home/user/project/lib.c"},
+			{0x1100, 0x1180, "/home/user/project/other.c"}, // overlaps lib.c
+		},
+		data: map[uint64]string{
+			0x2000: "/home/user/project/lib.c",
+		},
+	}
+	for _, tc := range []struct {
+		symbol elf.Symbol
+		pkg    string
+	}{
+		{elf.Symbol{Name: "memcpy", Value: 0x1010}, "C picolibc"},
+		{elf.Symbol{Name: "lib_func", Value: 0x1100}, "C lib.c"},
+		{elf.Symbol{Name: "lib_func2", Value: 0x1180}, "C lib.c"},
+		{elf.Symbol{Name: "lib_var", Value: 0x2000}, "C lib.c"},
+		{elf.Symbol{Name: "runtime.alloc", Value: 0x3000}, "runtime"},
+		{elf.Symbol{Name: "(*machine.UART).Write", Value: 0x3100}, "machine"},
+		{elf.Symbol{Name: "Reset_Handler", Value: 0x3200}, "(bootstrap)"},
+	} {
+		if pkg := symbolPackage(tc.symbol, files); pkg != tc.pkg {
+			t.Errorf("symbol %s at 0x%x: expected package %q, got %q", tc.symbol.Name, tc.symbol.Value, tc.pkg, pkg)
+		}
+	}
+}
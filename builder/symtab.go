@@ -0,0 +1,155 @@
+package builder
+
+// This file implements the symbol table that is included in the firmware with
+// -panic=trace, so that the runtime can print the names of the functions in
+// the call chain on a panic.
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"tinygo.org/x/go-llvm"
+)
+
+// Name of the global (and section) with the symbol table, as used by the
+// runtime.
+const symbolTableName = "tinygo_symtab"
+
+// readFunctionSymbols returns the function symbols of the given executable,
+// sorted by address. On ARM, the Thumb bit is cleared from the addresses.
+func readFunctionSymbols(executable string) ([]elf.Symbol, error) {
+	f, err := elf.Open(executable)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	allSymbols, err := f.Symbols()
+	if err != nil {
+		return nil, err
+	}
+	var symbols []elf.Symbol
+	for _, symbol := range allSymbols {
+		if elf.ST_TYPE(symbol.Info) != elf.STT_FUNC || symbol.Size == 0 || symbol.Name == "" {
+			continue
+		}
+		if f.Machine == elf.EM_ARM {
+			symbol.Value &^= 1
+		}
+		symbols = append(symbols, symbol)
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return symbols[i].Value < symbols[j].Value
+	})
+	return symbols, nil
+}
+
+// makeSymbolTable creates the symbol table in the format read by the runtime
+// (see src/runtime/panictrace.go), all values are little endian uint32:
+//
+//     count
+//     count * {address, size, name offset}
+//     names, each terminated by a NUL byte
+//
+// The name offset is relative to the start of the table.
+func makeSymbolTable(symbols []elf.Symbol) []byte {
+	var names bytes.Buffer
+	nameOffsets := make(map[string]uint32)
+	namesStart := 4 + len(symbols)*12
+	buf := make([]byte, namesStart)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(symbols)))
+	for i, symbol := range symbols {
+		offset, ok := nameOffsets[symbol.Name]
+		if !ok {
+			offset = uint32(namesStart + names.Len())
+			nameOffsets[symbol.Name] = offset
+			names.WriteString(symbol.Name)
+			names.WriteByte(0)
+		}
+		entry := buf[4+i*12:]
+		binary.LittleEndian.PutUint32(entry[0:], uint32(symbol.Value))
+		binary.LittleEndian.PutUint32(entry[4:], uint32(symbol.Size))
+		binary.LittleEndian.PutUint32(entry[8:], offset)
+	}
+	return append(buf, names.Bytes()...)
+}
+
+// writeSymbolTableObject writes an object file with the given symbol table in
+// the .tinygo_symtab section.
+func writeSymbolTableObject(path string, table []byte, triple string, machine llvm.TargetMachine) error {
+	ctx := llvm.NewContext()
+	defer ctx.Dispose()
+	mod := ctx.NewModule(symbolTableName)
+	defer mod.Dispose()
+	mod.SetTarget(triple)
+	targetData := machine.CreateTargetData()
+	defer targetData.Dispose()
+	mod.SetDataLayout(targetData.String())
+
+	value := ctx.ConstString(string(table), false)
+	global := llvm.AddGlobal(mod, value.Type(), symbolTableName)
+	global.SetInitializer(value)
+	global.SetGlobalConstant(true)
+	global.SetSection("." + symbolTableName)
+	global.SetAlignment(4)
+
+	buf, err := machine.EmitToMemoryBuffer(mod, llvm.ObjectFile)
+	if err != nil {
+		return err
+	}
+	defer buf.Dispose()
+	return ioutil.WriteFile(path, buf.Bytes(), 0666)
+}
+
+// maxSymbolTableLinks is the number of times the executable is linked again
+// in addSymbolTable before giving up on a stable layout.
+const maxSymbolTableLinks = 4
+
+// addSymbolTable replaces the empty symbol table in the linked executable with
+// the actual symbol table, by writing the object file at path and linking
+// again. The symbol table is placed after the code so normally no function
+// moves, but if the linker script does move them (for example because of
+// alignment) the table is regenerated and linked again until the addresses of
+// the functions are the same as the ones in the table.
+func addSymbolTable(executable, path, triple string, machine llvm.TargetMachine, relink func() error) error {
+	symbols, err := readFunctionSymbols(executable)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < maxSymbolTableLinks; i++ {
+		err = writeSymbolTableObject(path, makeSymbolTable(symbols), triple, machine)
+		if err != nil {
+			return err
+		}
+		err = relink()
+		if err != nil {
+			return err
+		}
+		newSymbols, err := readFunctionSymbols(executable)
+		if err != nil {
+			return err
+		}
+		if sameSymbolAddresses(symbols, newSymbols) {
+			return nil
+		}
+		symbols = newSymbols
+	}
+	return fmt.Errorf("-panic=trace: the function addresses kept changing after adding the symbol table, make sure the linker script places the .%s section after the code", symbolTableName)
+}
+
+// sameSymbolAddresses returns whether both lists contain the same functions at
+// the same addresses.
+func sameSymbolAddresses(a, b []elf.Symbol) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Value != b[i].Value || a[i].Size != b[i].Size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package builder
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+)
+
+func TestMakeSymbolTable(t *testing.T) {
+	symbols := []elf.Symbol{
+		{Name: "main.main", Value: 0x1000, Size: 0x20},
+		{Name: "runtime.run", Value: 0x1020, Size: 0x10},
+		{Name: "main.main", Value: 0x1040, Size: 0x08}, // a duplicate (local) name
+	}
+	table := makeSymbolTable(symbols)
+	word := func(offset uint32) uint32 {
+		return binary.LittleEndian.Uint32(table[offset:])
+	}
+	name := func(offset uint32) string {
+		end := bytes.IndexByte(table[offset:], 0)
+		if end < 0 {
+			t.Fatalf("name at offset %d is not NUL terminated", offset)
+		}
+		return string(table[offset : offset+uint32(end)])
+	}
+
+	if count := word(0); count != uint32(len(symbols)) {
+		t.Fatalf("expected %d symbols, got %d", len(symbols), count)
+	}
+	for i, symbol := range symbols {
+		entry := 4 + uint32(i)*12
+		if word(entry) != uint32(symbol.Value) || word(entry+4) != uint32(symbol.Size) {
+			t.Errorf("entry %d: expected address 0x%x size %d, got 0x%x size %d", i, symbol.Value, symbol.Size, word(entry), word(entry+4))
+		}
+		if got := name(word(entry + 8)); got != symbol.Name {
+			t.Errorf("entry %d: expected name %q, got %q", i, symbol.Name, got)
+		}
+	}
+	if word(4+8) != word(4+2*12+8) {
+		t.Error("duplicate names are stored more than once")
+	}
+	if expected := 4 + 3*12 + len("main.main\x00runtime.run\x00"); len(table) != expected {
+		t.Errorf("expected a table of %d bytes, got %d", expected, len(table))
+	}
+
+	// Look up addresses the same way findSymbol in src/runtime/panictrace.go
+	// does: a binary search over the entries.
+	for _, tc := range []struct {
+		addr uint32
+		name string
+	}{
+		{0x0fff, ""},
+		{0x1000, "main.main"},
+		{0x101f, "main.main"},
+		{0x1020, "runtime.run"},
+		{0x102f, "runtime.run"},
+		{0x1030, ""}, // gap between functions
+		{0x1047, "main.main"},
+		{0x1048, ""},
+	} {
+		got := ""
+		low, high := uint32(0), word(0)
+		for low < high {
+			mid := low + (high-low)/2
+			entry := 4 + mid*12
+			if word(entry) > tc.addr {
+				high = mid
+			} else if tc.addr >= word(entry)+word(entry+4) {
+				low = mid + 1
+			} else {
+				got = name(word(entry + 8))
+				break
+			}
+		}
+		if got != tc.name {
+			t.Errorf("address 0x%x: expected %q, got %q", tc.addr, tc.name, got)
+		}
+	}
+
+	if table := makeSymbolTable(nil); len(table) != 4 || binary.LittleEndian.Uint32(table) != 0 {
+		t.Errorf("expected an empty table to only contain a zero count, got %v", table)
+	}
+}
+
+func TestSameSymbolAddresses(t *testing.T) {
+	a := []elf.Symbol{{Name: "a", Value: 0x100, Size: 4}, {Name: "b", Value: 0x104, Size: 8}}
+	for _, tc := range []struct {
+		b    []elf.Symbol
+		same bool
+	}{
+		{[]elf.Symbol{{Name: "a", Value: 0x100, Size: 4}, {Name: "b", Value: 0x104, Size: 8}}, true},
+		{[]elf.Symbol{{Name: "a", Value: 0x100, Size: 4}, {Name: "b", Value: 0x108, Size: 8}}, false},
+		{[]elf.Symbol{{Name: "a", Value: 0x100, Size: 4}, {Name: "c", Value: 0x104, Size: 8}}, false},
+		{[]elf.Symbol{{Name: "a", Value: 0x100, Size: 4}}, false},
+	} {
+		if same := sameSymbolAddresses(a, tc.b); same != tc.same {
+			t.Errorf("sameSymbolAddresses(%v, %v): expected %v, got %v", a, tc.b, tc.same, same)
+		}
+	}
+}
@@ -10,18 +10,31 @@ package builder
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io/ioutil"
 	"strconv"
 )
 
-// convertELFFileToUF2File converts an ELF file to a UF2 file.
-func convertELFFileToUF2File(infile, outfile string, uf2FamilyID string) error {
+// convertELFFileToUF2File converts an ELF file to a UF2 file. If a base address
+// is given, the firmware must not start below it to avoid overwriting the
+// bootloader.
+func convertELFFileToUF2File(infile, outfile string, uf2FamilyID, uf2BaseAddress string) error {
 	// Read the .text segment.
 	targetAddress, data, err := extractROM(infile)
 	if err != nil {
 		return err
 	}
 
+	if uf2BaseAddress != "" {
+		baseAddress, err := strconv.ParseUint(uf2BaseAddress, 0, 32)
+		if err != nil {
+			return fmt.Errorf("invalid UF2 base address %#v: %w", uf2BaseAddress, err)
+		}
+		if targetAddress < baseAddress {
+			return fmt.Errorf("firmware starts at 0x%x, which is below the UF2 base address 0x%x and would overwrite the bootloader", targetAddress, baseAddress)
+		}
+	}
+
 	output, _, err := convertBinToUF2(data, uint32(targetAddress), uf2FamilyID)
 	if err != nil {
 		return err
@@ -117,7 +130,7 @@ func (b *uf2Block) Bytes() []byte {
 
 // IncrementAddress moves the target address pointer forward by count bytes.
 func (b *uf2Block) IncrementAddress(count uint32) {
-	b.targetAddr += b.payloadSize
+	b.targetAddr += count
 }
 
 // SetData sets the data to be used for the current block.
@@ -0,0 +1,36 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestConvertBinToUF2(t *testing.T) {
+	input := bytes.Repeat([]byte{0xaa}, 600) // three blocks, the last one partial
+	output, numBlocks, err := convertBinToUF2(input, 0x2000, "0x68ED2B88")
+	if err != nil {
+		t.Fatal("could not convert:", err)
+	}
+	if numBlocks != 3 || len(output) != 3*512 {
+		t.Fatalf("expected 3 blocks of 512 bytes, got %d blocks in %d bytes", numBlocks, len(output))
+	}
+	for i := 0; i < numBlocks; i++ {
+		block := output[i*512 : (i+1)*512]
+		word := func(offset int) uint32 {
+			return binary.LittleEndian.Uint32(block[offset:])
+		}
+		if word(0) != uf2MagicStart0 || word(4) != uf2MagicStart1 || word(508) != uf2MagicEnd {
+			t.Errorf("block %d: invalid magic numbers", i)
+		}
+		if word(8) != flagFamilyIDPresent || word(28) != 0x68ED2B88 {
+			t.Errorf("block %d: unexpected flags 0x%x or family ID 0x%x", i, word(8), word(28))
+		}
+		if addr := word(12); addr != 0x2000+uint32(i)*256 {
+			t.Errorf("block %d: expected target address 0x%x, got 0x%x", i, 0x2000+i*256, addr)
+		}
+		if word(16) != 256 || word(20) != uint32(i) || word(24) != 3 {
+			t.Errorf("block %d: unexpected payload size %d, block number %d or number of blocks %d", i, word(16), word(20), word(24))
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package builder
+
+import (
+	"go/types"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/compiler"
+	"github.com/tinygo-org/tinygo/loader"
+	"github.com/tinygo-org/tinygo/vet"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Vet loads the given package for the configured target and runs the checks
+// of the vet package on it. Only the package itself is checked, not its
+// dependencies.
+func Vet(config *compileopts.Config, pkgName string) ([]vet.Diagnostic, error) {
+	// The target machine is only needed for the type sizes, which must match
+	// the target to load the program in the same way as a build would.
+	machine, err := compiler.NewTargetMachine(&compiler.Config{
+		Triple:          config.Triple(),
+		CPU:             config.CPU(),
+		Features:        config.Features(),
+		GOOS:            config.GOOS(),
+		GOARCH:          config.GOARCH(),
+		CodeModel:       config.CodeModel(),
+		RelocationModel: config.RelocationModel(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lprogram, err := loader.Load(config, []string{pkgName}, config.ClangHeaders, types.Config{
+		Sizes: compiler.Sizes(machine),
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = lprogram.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	program := lprogram.LoadSSA()
+	pkg := program.Package(lprogram.MainPkg().Pkg)
+	pkg.Build()
+	return vet.Run(program, []*ssa.Package{pkg}), nil
+}
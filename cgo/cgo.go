@@ -12,10 +12,13 @@ package cgo
 // source file parsing.
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
 	"go/scanner"
 	"go/token"
+	"os"
+	"os/exec"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -36,6 +39,7 @@ type cgoPackage struct {
 	missingSymbols  map[string]struct{}
 	constants       map[string]constantInfo
 	functions       map[string]*functionInfo
+	exports         map[string]token.Pos // Go functions exported with //export
 	globals         map[string]globalInfo
 	typedefs        map[string]*typedefInfo
 	elaboratedTypes map[string]*elaboratedTypeInfo
@@ -84,15 +88,20 @@ type elaboratedTypeInfo struct {
 	unionAlign int64 // union alignment in bytes
 }
 
-// bitfieldInfo contains information about a single bitfield in a struct. It
-// keeps information about the start, end, and the special (renamed) base field
-// of this bitfield.
+// bitfieldInfo contains information about a single bitfield in a struct or
+// union. It keeps information about the start, end, and the special (renamed)
+// base field of this bitfield.
 type bitfieldInfo struct {
-	field    *ast.Field
-	name     string
-	pos      token.Pos
-	startBit int64
-	endBit   int64 // may be 0 meaning "until the end of the field"
+	field         *ast.Field
+	name          string
+	pos           token.Pos
+	startBit      int64
+	endBit        int64    // first bit after the bitfield
+	storageSize   int64    // size of the base field in bits
+	storageSigned bool     // base field is a signed integer
+	signed        bool     // bitfield is signed, so the value must be sign-extended
+	union         bool     // base field is a member of a union
+	typeExpr      ast.Expr // type of the bitfield if it differs from the base field
 }
 
 // enumInfo contains information about an enum in the C.
@@ -161,7 +170,10 @@ typedef unsigned long long  _Cgo_ulonglong;
 // files, the CFLAGS and LDFLAGS found in #cgo lines, and a map of file hashes
 // of the accessed C header files. If there is one or more error, it returns
 // these in the []error slice but still modifies the AST.
-func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string) (*ast.File, []string, []string, map[string][]byte, []error) {
+//
+// The tags are the build tags (including GOOS and GOARCH) that are used to
+// evaluate the build constraints in #cgo lines.
+func Process(files []*ast.File, dir string, fset *token.FileSet, cflags, tags []string) (*ast.File, []string, []string, map[string][]byte, []error) {
 	p := &cgoPackage{
 		dir:             dir,
 		fset:            fset,
@@ -169,6 +181,7 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 		missingSymbols:  map[string]struct{}{},
 		constants:       map[string]constantInfo{},
 		functions:       map[string]*functionInfo{},
+		exports:         map[string]token.Pos{},
 		globals:         map[string]globalInfo{},
 		typedefs:        map[string]*typedefInfo{},
 		elaboratedTypes: map[string]*elaboratedTypeInfo{},
@@ -339,15 +352,16 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 					continue
 				}
 
-				if len(fields) > 1 {
-					p.addErrorAfter(comment.Slash, comment.Text[:lineStart+5], "not implemented: build constraints in #cgo line")
+				if !matchCgoConstraint(fields[:len(fields)-1], tags) {
+					// This line is for a different OS, architecture or
+					// target.
 					continue
 				}
 
 				name := fields[len(fields)-1]
-				value := line[colon+1:]
+				value := strings.ReplaceAll(line[colon+1:], "${SRCDIR}", packagePath)
 				switch name {
-				case "CFLAGS":
+				case "CFLAGS", "CPPFLAGS":
 					flags, err := shlex.Split(value)
 					if err != nil {
 						// TODO: find the exact location where the error happened.
@@ -373,6 +387,31 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 					}
 					makePathsAbsolute(flags, packagePath)
 					p.ldflags = append(p.ldflags, flags...)
+				case "CXXFLAGS", "FFLAGS":
+					// C++ and Fortran files are not compiled as part of a
+					// package, so these flags are unused. Accept them so that
+					// packages that also support the gc toolchain still work.
+				case "pkg-config":
+					names, err := shlex.Split(value)
+					if err != nil {
+						p.addErrorAfter(comment.Slash, comment.Text[:lineStart+colon+1], "failed to parse #cgo pkg-config line: "+err.Error())
+						continue
+					}
+					pkgCFlags, pkgLDFlags, err := pkgConfig(names)
+					if err != nil {
+						p.addErrorAfter(comment.Slash, comment.Text[:lineStart+colon+1], err.Error())
+						continue
+					}
+					if err := checkCompilerFlags("CFLAGS", pkgCFlags); err != nil {
+						p.addErrorAfter(comment.Slash, comment.Text[:lineStart+colon+1], "pkg-config --cflags: "+err.Error())
+						continue
+					}
+					if err := checkLinkerFlags("LDFLAGS", pkgLDFlags); err != nil {
+						p.addErrorAfter(comment.Slash, comment.Text[:lineStart+colon+1], "pkg-config --libs: "+err.Error())
+						continue
+					}
+					p.cflags = append(p.cflags, pkgCFlags...)
+					p.ldflags = append(p.ldflags, pkgLDFlags...)
 				default:
 					startPos := strings.LastIndex(line[4:colon], name) + 4
 					p.addErrorAfter(comment.Slash, comment.Text[:lineStart+startPos], "invalid #cgo line: "+name)
@@ -404,6 +443,12 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 	// Declare functions found by libclang.
 	p.addFuncDecls()
 
+	// Find Go functions that are exported to C but not declared in C, so that
+	// they can be used as C function pointers.
+	for _, f := range files {
+		p.findExports(f)
+	}
+
 	// Declare stub function pointer values found by libclang.
 	p.addFuncPtrDecls()
 
@@ -436,6 +481,83 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 	return p.generated, p.cflags, p.ldflags, p.visitedFiles, p.errors
 }
 
+// matchCgoConstraint returns whether the build constraint of a #cgo line (the
+// fields before the directive name) is satisfied by the given build tags. It
+// uses the same syntax as // +build lines: the line applies if any of the
+// space-separated options matches, where an option is a comma-separated list
+// of tags that must all match and a tag may be negated with "!". For example:
+//
+//     #cgo linux,!baremetal darwin LDFLAGS: -lm
+//
+// A line without build constraint always applies.
+func matchCgoConstraint(options []string, tags []string) bool {
+	if len(options) == 0 {
+		return true
+	}
+	for _, option := range options {
+		match := true
+		for _, term := range strings.Split(option, ",") {
+			negate := strings.HasPrefix(term, "!")
+			term = strings.TrimPrefix(term, "!")
+			found := false
+			for _, tag := range tags {
+				if tag == term {
+					found = true
+					break
+				}
+			}
+			if term == "" || found == negate {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// pkgConfig runs pkg-config (or the program in $PKG_CONFIG) for the given
+// packages and returns the compiler and linker flags for them.
+func pkgConfig(names []string) (cflags, ldflags []string, err error) {
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("missing package name in #cgo pkg-config line")
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, "-") {
+			return nil, nil, fmt.Errorf("invalid pkg-config package name: %s", name)
+		}
+	}
+	command := os.Getenv("PKG_CONFIG")
+	if command == "" {
+		command = "pkg-config"
+	}
+	run := func(flag string) ([]string, error) {
+		stderr := &bytes.Buffer{}
+		cmd := exec.Command(command, append([]string{flag, "--"}, names...)...)
+		cmd.Stderr = stderr
+		out, err := cmd.Output()
+		if err != nil {
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" {
+				msg = err.Error()
+			}
+			return nil, fmt.Errorf("%s %s %s: %s", command, flag, strings.Join(names, " "), msg)
+		}
+		return shlex.Split(string(out))
+	}
+	cflags, err = run("--cflags")
+	if err != nil {
+		return nil, nil, err
+	}
+	ldflags, err = run("--libs")
+	if err != nil {
+		return nil, nil, err
+	}
+	return cflags, ldflags, nil
+}
+
 // makePathsAbsolute converts some common path compiler flags (-I, -L) from
 // relative flags into absolute flags, if they are relative. This is necessary
 // because the C compiler is usually not invoked from the package path.
@@ -518,6 +640,36 @@ func (p *cgoPackage) addFuncDecls() {
 				Type: arg.typeExpr,
 			}
 		}
+		if fn.variadic && len(fn.args) != 0 {
+			// Variadic C function like printf. The extra arguments are passed
+			// as a ...interface{} parameter in Go, which is lowered by the
+			// compiler to C variadic arguments. Functions without a prototype
+			// (with no parameters) are also variadic in C, but can't be
+			// called with arguments.
+			decl.Type.Params.List = append(args, &ast.Field{
+				Names: []*ast.Ident{
+					&ast.Ident{
+						NamePos: fn.pos,
+						Name:    "$args",
+						Obj: &ast.Object{
+							Kind: ast.Var,
+							Name: "$args",
+							Decl: decl,
+						},
+					},
+				},
+				Type: &ast.Ellipsis{
+					Ellipsis: fn.pos,
+					Elt: &ast.InterfaceType{
+						Interface: fn.pos,
+						Methods: &ast.FieldList{
+							Opening: fn.pos,
+							Closing: fn.pos,
+						},
+					},
+				},
+			})
+		}
 		p.generated.Decls = append(p.generated.Decls, decl)
 	}
 }
@@ -532,13 +684,16 @@ func (p *cgoPackage) addFuncDecls() {
 //         // ...
 //     )
 func (p *cgoPackage) addFuncPtrDecls() {
-	if len(p.functions) == 0 {
+	if len(p.functions) == 0 && len(p.exports) == 0 {
 		return
 	}
-	names := make([]string, 0, len(p.functions))
+	names := make([]string, 0, len(p.functions)+len(p.exports))
 	for name := range p.functions {
 		names = append(names, name)
 	}
+	for name := range p.exports {
+		names = append(names, name)
+	}
 	sort.Strings(names)
 	for _, name := range names {
 		gen := &ast.GenDecl{
@@ -547,24 +702,27 @@ func (p *cgoPackage) addFuncPtrDecls() {
 			Lparen: token.NoPos,
 			Rparen: token.NoPos,
 		}
-		fn := p.functions[name]
+		pos := p.exports[name]
+		if fn, ok := p.functions[name]; ok {
+			pos = fn.pos
+		}
 		obj := &ast.Object{
 			Kind: ast.Typ,
 			Name: "C." + name + "$funcaddr",
 		}
 		valueSpec := &ast.ValueSpec{
 			Names: []*ast.Ident{&ast.Ident{
-				NamePos: fn.pos,
+				NamePos: pos,
 				Name:    "C." + name + "$funcaddr",
 				Obj:     obj,
 			}},
 			Type: &ast.SelectorExpr{
 				X: &ast.Ident{
-					NamePos: fn.pos,
+					NamePos: pos,
 					Name:    "unsafe",
 				},
 				Sel: &ast.Ident{
-					NamePos: fn.pos,
+					NamePos: pos,
 					Name:    "Pointer",
 				},
 			},
@@ -773,7 +931,14 @@ func (p *cgoPackage) addElaboratedTypes() {
 		typeExpr := typ.typeExpr
 		if typ.unionSize != 0 {
 			// Create getters/setters.
+		fields:
 			for _, field := range typ.typeExpr.Fields.List {
+				for _, bitfield := range typ.bitfields {
+					if bitfield.field == field {
+						// Bitfields get their own getters and setters.
+						continue fields
+					}
+				}
 				if len(field.Names) != 1 {
 					p.addError(typ.pos, fmt.Sprintf("union must have field with a single name, it has %d names", len(field.Names)))
 					continue
@@ -989,47 +1154,91 @@ func (p *cgoPackage) createUnionAccessor(field *ast.Field, typeName string) {
 //     func (s *C.struct_foo) bitfield_b() byte {
 //         return (s.__bitfield_1 >> 5) & 0x1
 //     }
+//
+// Signed bitfields are sign-extended by shifting them to the top of the field
+// first:
+//
+//     func (s *C.struct_foo) bitfield_c() C.int {
+//         return s.__bitfield_1 << 24 >> 28
+//     }
 func (p *cgoPackage) createBitfieldGetter(bitfield bitfieldInfo, typeName string) {
 	// The value to return from the getter.
 	// Not complete: this is just an expression to get the complete field.
-	var result ast.Expr = &ast.SelectorExpr{
-		X: &ast.Ident{
-			NamePos: bitfield.pos,
-			Name:    "s",
-			Obj:     nil,
-		},
-		Sel: &ast.Ident{
-			NamePos: bitfield.pos,
-			Name:    bitfield.field.Names[0].Name,
-		},
-	}
-	if bitfield.startBit != 0 {
-		// Shift to the right by .startBit so that fields that come before are
-		// shifted off.
-		result = &ast.BinaryExpr{
-			X:     result,
-			OpPos: bitfield.pos,
-			Op:    token.SHR,
-			Y: &ast.BasicLit{
-				ValuePos: bitfield.pos,
-				Kind:     token.INT,
-				Value:    strconv.FormatInt(bitfield.startBit, 10),
-			},
+	result := p.bitfieldStorage(bitfield)
+	width := bitfield.endBit - bitfield.startBit
+	if bitfield.signed {
+		if bitfield.endBit != bitfield.storageSize {
+			// Shift to the left so that fields that come after this field
+			// are shifted off.
+			result = &ast.BinaryExpr{
+				X:     result,
+				OpPos: bitfield.pos,
+				Op:    token.SHL,
+				Y: &ast.BasicLit{
+					ValuePos: bitfield.pos,
+					Kind:     token.INT,
+					Value:    strconv.FormatInt(bitfield.storageSize-bitfield.endBit, 10),
+				},
+			}
+		}
+		if !bitfield.storageSigned {
+			// Convert to a signed integer, so that the sign bit is extended
+			// in the shift below.
+			result = &ast.CallExpr{
+				Fun: &ast.Ident{
+					NamePos: bitfield.pos,
+					Name:    "int" + strconv.FormatInt(bitfield.storageSize, 10),
+				},
+				Args: []ast.Expr{result},
+			}
+		}
+		if width != bitfield.storageSize {
+			// Shift to the right (arithmetic shift, which extends the sign
+			// bit) so that fields that come before are shifted off.
+			result = &ast.BinaryExpr{
+				X:     result,
+				OpPos: bitfield.pos,
+				Op:    token.SHR,
+				Y: &ast.BasicLit{
+					ValuePos: bitfield.pos,
+					Kind:     token.INT,
+					Value:    strconv.FormatInt(bitfield.storageSize-width, 10),
+				},
+			}
+		}
+	} else {
+		if bitfield.startBit != 0 {
+			// Shift to the right by .startBit so that fields that come before
+			// are shifted off.
+			result = &ast.BinaryExpr{
+				X:     result,
+				OpPos: bitfield.pos,
+				Op:    token.SHR,
+				Y: &ast.BasicLit{
+					ValuePos: bitfield.pos,
+					Kind:     token.INT,
+					Value:    strconv.FormatInt(bitfield.startBit, 10),
+				},
+			}
+		}
+		if bitfield.endBit != bitfield.storageSize || bitfield.storageSigned {
+			// Mask off the high bits so that fields that come after this field
+			// (or the extended sign bit) are masked off.
+			result = &ast.BinaryExpr{
+				X:     result,
+				OpPos: bitfield.pos,
+				Op:    token.AND,
+				Y:     bitfieldMask(bitfield, (uint64(1)<<uint64(width))-1),
+			}
 		}
 	}
-	if bitfield.endBit != 0 {
-		// Mask off the high bits so that fields that come after this field are
-		// masked off.
-		and := (uint64(1) << uint64(bitfield.endBit-bitfield.startBit)) - 1
-		result = &ast.BinaryExpr{
-			X:     result,
-			OpPos: bitfield.pos,
-			Op:    token.AND,
-			Y: &ast.BasicLit{
-				ValuePos: bitfield.pos,
-				Kind:     token.INT,
-				Value:    "0x" + strconv.FormatUint(and, 16),
-			},
+	resultType := bitfield.field.Type
+	if bitfield.typeExpr != nil {
+		// The bitfield has a different type than the field it is stored in.
+		resultType = bitfield.typeExpr
+		result = &ast.CallExpr{
+			Fun:  resultType,
+			Args: []ast.Expr{result},
 		}
 	}
 
@@ -1075,7 +1284,7 @@ func (p *cgoPackage) createBitfieldGetter(bitfield bitfieldInfo, typeName string
 			Results: &ast.FieldList{
 				List: []*ast.Field{
 					&ast.Field{
-						Type: bitfield.field.Type,
+						Type: resultType,
 					},
 				},
 			},
@@ -1099,76 +1308,42 @@ func (p *cgoPackage) createBitfieldGetter(bitfield bitfieldInfo, typeName string
 // createBitfieldSetter creates a bitfield setter function like the following:
 //
 //     func (s *C.struct_foo) set_bitfield_b(value byte) {
-//         s.__bitfield_1 = s.__bitfield_1 ^ 0x60 | ((value & 1) << 5)
-//     }
-//
-// Or the following:
-//
-//     func (s *C.struct_foo) set_bitfield_c(value byte) {
-//         s.__bitfield_1 = s.__bitfield_1 & 0x3f | (value << 6)
+//         s.__bitfield_1 = s.__bitfield_1&^0x20 | value&0x1<<5
 //     }
 func (p *cgoPackage) createBitfieldSetter(bitfield bitfieldInfo, typeName string) {
-	// The full field with all bitfields.
-	var field ast.Expr = &ast.SelectorExpr{
-		X: &ast.Ident{
-			NamePos: bitfield.pos,
-			Name:    "s",
-			Obj:     nil,
-		},
-		Sel: &ast.Ident{
-			NamePos: bitfield.pos,
-			Name:    bitfield.field.Names[0].Name,
-		},
-	}
 	// The value to insert into the field.
 	var valueToInsert ast.Expr = &ast.Ident{
 		NamePos: bitfield.pos,
 		Name:    "value",
 	}
-
-	if bitfield.endBit != 0 {
-		// Make sure the value is in range with a mask.
-		valueToInsert = &ast.BinaryExpr{
-			X:     valueToInsert,
-			OpPos: bitfield.pos,
-			Op:    token.AND,
-			Y: &ast.BasicLit{
-				ValuePos: bitfield.pos,
-				Kind:     token.INT,
-				Value:    "0x" + strconv.FormatUint((uint64(1)<<uint64(bitfield.endBit-bitfield.startBit))-1, 16),
-			},
-		}
-		// Create a mask for the AND NOT operation.
-		mask := ((uint64(1) << uint64(bitfield.endBit-bitfield.startBit)) - 1) << uint64(bitfield.startBit)
-		// Zero the bits in the field that will soon be inserted.
-		field = &ast.BinaryExpr{
-			X:     field,
-			OpPos: bitfield.pos,
-			Op:    token.AND_NOT,
-			Y: &ast.BasicLit{
-				ValuePos: bitfield.pos,
-				Kind:     token.INT,
-				Value:    "0x" + strconv.FormatUint(mask, 16),
-			},
-		}
-	} else { // bitfield.endBit == 0
-		// We don't know exactly how many high bits should be zeroed. So we do
-		// something different: keep the low bits with a mask and OR the new
-		// value with it.
-		mask := (uint64(1) << uint64(bitfield.startBit)) - 1
-		// Extract the lower bits.
-		field = &ast.BinaryExpr{
-			X:     field,
-			OpPos: bitfield.pos,
-			Op:    token.AND,
-			Y: &ast.BasicLit{
-				ValuePos: bitfield.pos,
-				Kind:     token.INT,
-				Value:    "0x" + strconv.FormatUint(mask, 16),
-			},
+	valueType := bitfield.field.Type
+	if bitfield.typeExpr != nil {
+		// The bitfield has a different type than the field it is stored in.
+		valueType = bitfield.typeExpr
+		valueToInsert = &ast.CallExpr{
+			Fun:  bitfield.field.Type,
+			Args: []ast.Expr{valueToInsert},
 		}
 	}
 
+	// Make sure the value is in range with a mask.
+	width := bitfield.endBit - bitfield.startBit
+	valueToInsert = &ast.BinaryExpr{
+		X:     valueToInsert,
+		OpPos: bitfield.pos,
+		Op:    token.AND,
+		Y:     bitfieldMask(bitfield, (uint64(1)<<uint64(width))-1),
+	}
+
+	// Zero the bits in the field that will soon be inserted.
+	mask := ((uint64(1) << uint64(width)) - 1) << uint64(bitfield.startBit)
+	var field ast.Expr = &ast.BinaryExpr{
+		X:     p.bitfieldStorage(bitfield),
+		OpPos: bitfield.pos,
+		Op:    token.AND_NOT,
+		Y:     bitfieldMask(bitfield, mask),
+	}
+
 	// Bitwise OR with the new value (after the new value has been shifted).
 	field = &ast.BinaryExpr{
 		X:     field,
@@ -1232,7 +1407,7 @@ func (p *cgoPackage) createBitfieldSetter(bitfield bitfieldInfo, typeName string
 								Obj:     nil,
 							},
 						},
-						Type: bitfield.field.Type,
+						Type: valueType,
 					},
 				},
 				Closing: bitfield.pos,
@@ -1243,17 +1418,7 @@ func (p *cgoPackage) createBitfieldSetter(bitfield bitfieldInfo, typeName string
 			List: []ast.Stmt{
 				&ast.AssignStmt{
 					Lhs: []ast.Expr{
-						&ast.SelectorExpr{
-							X: &ast.Ident{
-								NamePos: bitfield.pos,
-								Name:    "s",
-								Obj:     nil,
-							},
-							Sel: &ast.Ident{
-								NamePos: bitfield.pos,
-								Name:    bitfield.field.Names[0].Name,
-							},
-						},
+						p.bitfieldStorage(bitfield),
 					},
 					TokPos: bitfield.pos,
 					Tok:    token.ASSIGN,
@@ -1268,6 +1433,84 @@ func (p *cgoPackage) createBitfieldSetter(bitfield bitfieldInfo, typeName string
 	p.generated.Decls = append(p.generated.Decls, setter)
 }
 
+// bitfieldStorage returns an expression for the field in which the given
+// bitfield is stored, for use in a getter or setter with receiver s. This is
+// s.__bitfield_1 for structs, and for unions it is a cast of the union storage:
+//
+//     *(*C.uchar)(unsafe.Pointer(&s.$union))
+func (p *cgoPackage) bitfieldStorage(bitfield bitfieldInfo) ast.Expr {
+	if !bitfield.union {
+		return &ast.SelectorExpr{
+			X: &ast.Ident{
+				NamePos: bitfield.pos,
+				Name:    "s",
+				Obj:     nil,
+			},
+			Sel: &ast.Ident{
+				NamePos: bitfield.pos,
+				Name:    bitfield.field.Names[0].Name,
+			},
+		}
+	}
+	return &ast.StarExpr{
+		Star: bitfield.pos,
+		X: &ast.CallExpr{
+			Lparen: bitfield.pos,
+			Fun: &ast.ParenExpr{
+				Lparen: bitfield.pos,
+				X: &ast.StarExpr{
+					X: bitfield.field.Type,
+				},
+				Rparen: bitfield.pos,
+			},
+			Args: []ast.Expr{
+				&ast.CallExpr{
+					Fun: &ast.SelectorExpr{
+						X:   &ast.Ident{Name: "unsafe"},
+						Sel: &ast.Ident{Name: "Pointer"},
+					},
+					Args: []ast.Expr{
+						&ast.UnaryExpr{
+							Op: token.AND,
+							X: &ast.SelectorExpr{
+								X: &ast.Ident{
+									NamePos: bitfield.pos,
+									Name:    "s",
+								},
+								Sel: &ast.Ident{
+									NamePos: bitfield.pos,
+									Name:    "$union",
+								},
+							},
+						},
+					},
+				},
+			},
+			Rparen: bitfield.pos,
+		},
+	}
+}
+
+// bitfieldMask returns a literal for the given mask, that can be used in
+// operations on the field the bitfield is stored in. If this field is signed
+// and the mask includes the sign bit, the mask is written as a negative number
+// to avoid an overflow.
+func bitfieldMask(bitfield bitfieldInfo, mask uint64) *ast.BasicLit {
+	value := "0x" + strconv.FormatUint(mask, 16)
+	if bitfield.storageSigned && mask>>uint64(bitfield.storageSize-1)&1 != 0 {
+		negated := -mask
+		if bitfield.storageSize < 64 {
+			negated &= uint64(1)<<uint64(bitfield.storageSize) - 1
+		}
+		value = "-0x" + strconv.FormatUint(negated, 16)
+	}
+	return &ast.BasicLit{
+		ValuePos: bitfield.pos,
+		Kind:     token.INT,
+		Value:    value,
+	}
+}
+
 // addEnumTypes adds C enums to the AST. For example, the following C code:
 //
 //     enum option {
@@ -1337,6 +1580,38 @@ func (p *cgoPackage) findMissingCGoNames(cursor *astutil.Cursor) bool {
 	return true
 }
 
+// findExports finds all Go functions in the file that are exported to C with
+// //export and are referenced as C.name, but that are not declared in the CGo
+// preamble. A C declaration is not necessary to take the address of such a
+// function, so these are added as function pointers as well:
+//
+//     //export compare
+//     func compare(a, b unsafe.Pointer) C.int { ... }
+//
+//     C.qsort(base, n, size, C.compare)
+func (p *cgoPackage) findExports(f *ast.File) {
+	for _, decl := range f.Decls {
+		decl, ok := decl.(*ast.FuncDecl)
+		if !ok || decl.Recv != nil || decl.Doc == nil {
+			continue
+		}
+		for _, comment := range decl.Doc.List {
+			parts := strings.Fields(comment.Text)
+			if len(parts) != 2 || (parts[0] != "//export" && parts[0] != "//go:export") {
+				continue
+			}
+			name := parts[1]
+			if _, ok := p.missingSymbols[name]; !ok {
+				continue // not used from Go as C.name
+			}
+			if _, ok := p.functions[name]; ok {
+				continue // declared in C, handled by addFuncPtrDecls
+			}
+			p.exports[name] = decl.Name.Pos()
+		}
+	}
+}
+
 // walker replaces all "C".<something> expressions to literal "C.<something>"
 // expressions. Such expressions are impossible to write in Go (a dot cannot be
 // used in the middle of a name) so in practice all C identifiers live in a
@@ -1367,6 +1642,8 @@ func (p *cgoPackage) walker(cursor *astutil.Cursor) bool {
 			name := "C." + node.Sel.Name
 			if _, ok := p.functions[node.Sel.Name]; ok {
 				name += "$funcaddr"
+			} else if _, ok := p.exports[node.Sel.Name]; ok {
+				name += "$funcaddr"
 			}
 			cursor.Replace(&ast.Ident{
 				NamePos: x.NamePos,
@@ -53,6 +53,9 @@ CXTranslationUnit tinygo_clang_Cursor_getTranslationUnit(GoCXCursor c);
 long long tinygo_clang_getEnumConstantDeclValue(GoCXCursor c);
 CXType tinygo_clang_getEnumDeclIntegerType(GoCXCursor c);
 unsigned tinygo_clang_Cursor_isBitField(GoCXCursor c);
+int tinygo_clang_getFieldDeclBitWidth(GoCXCursor c);
+long long tinygo_clang_Cursor_getOffsetOfField(GoCXCursor c);
+unsigned tinygo_clang_Cursor_isAnonymousRecordDecl(GoCXCursor c);
 
 int tinygo_clang_globals_visitor(GoCXCursor c, GoCXCursor parent, CXClientData client_data);
 int tinygo_clang_struct_visitor(GoCXCursor c, GoCXCursor parent, CXClientData client_data);
@@ -639,19 +642,19 @@ func (p *cgoPackage) makeASTRecordType(cursor C.GoCXCursor, pos token.Pos) *elab
 		Opening: pos,
 		Closing: pos,
 	}
-	var bitfieldList []bitfieldInfo
-	inBitfield := false
-	bitfieldNum := 0
-	ref := storedRefs.Put(struct {
-		fieldList    *ast.FieldList
-		pkg          *cgoPackage
-		inBitfield   *bool
-		bitfieldNum  *int
-		bitfieldList *[]bitfieldInfo
-	}{fieldList, p, &inBitfield, &bitfieldNum, &bitfieldList})
+	typ := C.tinygo_clang_getCursorType(cursor)
+	state := &recordVisitorState{
+		fieldList: fieldList,
+		pkg:       p,
+		union:     C.tinygo_clang_getCursorKind(cursor) == C.CXCursor_UnionDecl,
+		size:      int64(C.clang_Type_getSizeOf(typ)) * 8,
+	}
+	ref := storedRefs.Put(state)
 	defer storedRefs.Remove(ref)
 	C.tinygo_clang_visitChildren(cursor, C.CXCursorVisitor(C.tinygo_clang_struct_visitor), C.CXClientData(ref))
+	state.flushBitfields(state.size)
 	renameFieldKeywords(fieldList)
+	bitfieldList := state.bitfieldList
 	switch C.tinygo_clang_getCursorKind(cursor) {
 	case C.CXCursor_StructDecl:
 		return &elaboratedTypeInfo{
@@ -675,11 +678,10 @@ func (p *cgoPackage) makeASTRecordType(cursor C.GoCXCursor, pos token.Pos) *elab
 			// Useless union, treat it as a regular struct.
 			return typeInfo
 		}
-		if bitfieldList != nil {
-			// This is valid C... but please don't do this.
-			p.addError(pos, "bitfield in a union is not supported")
+		for i := range bitfieldList {
+			// Bitfields in a union are all stored at the start of the union.
+			bitfieldList[i].union = true
 		}
-		typ := C.tinygo_clang_getCursorType(cursor)
 		alignInBytes := int64(C.clang_Type_getAlignOf(typ))
 		sizeInBytes := int64(C.clang_Type_getSizeOf(typ))
 		if sizeInBytes == 0 {
@@ -701,26 +703,225 @@ func (p *cgoPackage) makeASTRecordType(cursor C.GoCXCursor, pos token.Pos) *elab
 	}
 }
 
+// recordVisitorState is the state that is kept while visiting the fields of a
+// struct or union in tinygo_clang_struct_visitor.
+type recordVisitorState struct {
+	fieldList    *ast.FieldList
+	pkg          *cgoPackage
+	union        bool
+	size         int64 // size of the record in bits
+	end          int64 // end of the last field in bits
+	bitEnd       int64 // end of the last field or bitfield in bits
+	anonNum      int
+	bitfieldNum  int
+	bitfieldList []bitfieldInfo
+	pending      []pendingBitfield
+}
+
+// pendingBitfield is a bitfield that has been seen in a struct, but that has
+// not yet been assigned a field to be stored in. This can only be done once
+// the offset of the next field is known.
+type pendingBitfield struct {
+	name   string
+	pos    token.Pos
+	typ    C.CXType
+	offset int64 // offset in the record in bits
+	width  int64
+}
+
+// addField adds a regular field (not a bitfield) to the record.
+func (s *recordVisitorState) addField(name string, pos token.Pos, typ C.CXType, offset int64) {
+	field := &ast.Field{
+		Type: s.pkg.makeASTType(typ, pos),
+	}
+	field.Names = []*ast.Ident{
+		&ast.Ident{
+			NamePos: pos,
+			Name:    name,
+			Obj: &ast.Object{
+				Kind: ast.Var,
+				Name: name,
+				Decl: field,
+			},
+		},
+	}
+	s.fieldList.List = append(s.fieldList.List, field)
+	if !s.union {
+		s.end = offset + int64(C.clang_Type_getSizeOf(typ))*8
+		s.bitEnd = s.end
+	}
+}
+
+// flushBitfields creates fields for all pending bitfields, which must be stored
+// before the given offset (in bits). Consecutive bitfields are stored in the
+// same field if possible, using the declared type of the first bitfield. If
+// that type doesn't fit, the smallest integer type that does fit is used
+// instead.
+func (s *recordVisitorState) flushBitfields(limit int64) {
+	for len(s.pending) != 0 {
+		first := s.pending[0]
+		storageSigned := isSignedType(first.typ)
+		fits := func(start, size int64) bool {
+			return start >= s.end && start+size <= limit && first.offset+first.width <= start+size
+		}
+
+		// Determine the type of the field in which to store the bitfields.
+		var storageType ast.Expr
+		declared := false
+		size := int64(C.clang_Type_getSizeOf(first.typ)) * 8
+		start := first.offset - first.offset%size
+		if isIntegerType(first.typ) && fits(start, size) {
+			storageType = s.pkg.makeASTType(first.typ, first.pos)
+			declared = true
+		} else {
+			for _, size = range []int64{8, 16, 32, 64} {
+				start = first.offset - first.offset%size
+				if fits(start, size) {
+					name := "uint" + strconv.FormatInt(size, 10)
+					if storageSigned {
+						name = "int" + strconv.FormatInt(size, 10)
+					}
+					storageType = &ast.Ident{
+						NamePos: first.pos,
+						Name:    name,
+					}
+					break
+				}
+			}
+		}
+		if storageType == nil {
+			s.pkg.addError(first.pos, fmt.Sprintf("could not determine the layout of bitfield %s", first.name))
+			s.pending = s.pending[1:]
+			continue
+		}
+
+		if start > s.end {
+			// There are unnamed bitfields before this bitfield, that take up
+			// some space. Add explicit padding.
+			s.fieldList.List = append(s.fieldList.List, &ast.Field{
+				Names: []*ast.Ident{
+					&ast.Ident{
+						NamePos: first.pos,
+						Name:    "_",
+					},
+				},
+				Type: &ast.ArrayType{
+					Len: &ast.BasicLit{
+						ValuePos: first.pos,
+						Kind:     token.INT,
+						Value:    strconv.FormatInt((start-s.end)/8, 10),
+					},
+					Elt: &ast.Ident{
+						NamePos: first.pos,
+						Name:    "uint8",
+					},
+				},
+			})
+		}
+
+		// Add the field to store the bitfields in.
+		s.bitfieldNum++
+		name := "__bitfield_" + strconv.Itoa(s.bitfieldNum)
+		field := &ast.Field{
+			Type: storageType,
+		}
+		field.Names = []*ast.Ident{
+			&ast.Ident{
+				NamePos: first.pos,
+				Name:    name,
+				Obj: &ast.Object{
+					Kind: ast.Var,
+					Name: name,
+					Decl: field,
+				},
+			},
+		}
+		s.fieldList.List = append(s.fieldList.List, field)
+		if !s.union {
+			s.end = start + size
+		}
+
+		// Add all bitfields that fit in this field.
+		for len(s.pending) != 0 {
+			bitfield := s.pending[0]
+			if bitfield.offset < start || bitfield.offset+bitfield.width > start+size {
+				break
+			}
+			info := bitfieldInfo{
+				field:         field,
+				name:          bitfield.name,
+				pos:           bitfield.pos,
+				startBit:      bitfield.offset - start,
+				endBit:        bitfield.offset - start + bitfield.width,
+				storageSize:   size,
+				storageSigned: storageSigned,
+				signed:        isSignedType(bitfield.typ),
+			}
+			if C.clang_getCanonicalType(bitfield.typ).kind != C.CXType_Bool && (!declared || C.clang_equalTypes(bitfield.typ, first.typ) == 0) {
+				// The getter and setter should use the declared type of the
+				// bitfield, not the type of the field it is stored in.
+				info.typeExpr = s.pkg.makeASTType(bitfield.typ, bitfield.pos)
+			}
+			s.bitfieldList = append(s.bitfieldList, info)
+			s.pending = s.pending[1:]
+		}
+	}
+}
+
+// isIntegerType returns whether the given C type is an integer type (including
+// enums), that can be used as the type of a field to store bitfields in.
+func isIntegerType(typ C.CXType) bool {
+	switch C.clang_getCanonicalType(typ).kind {
+	case C.CXType_Char_U, C.CXType_UChar, C.CXType_UShort, C.CXType_UInt, C.CXType_ULong, C.CXType_ULongLong,
+		C.CXType_Char_S, C.CXType_SChar, C.CXType_Short, C.CXType_Int, C.CXType_Long, C.CXType_LongLong,
+		C.CXType_Enum:
+		return true
+	}
+	return false
+}
+
+// isSignedType returns whether the given C type is a signed integer type.
+func isSignedType(typ C.CXType) bool {
+	switch C.clang_getCanonicalType(typ).kind {
+	case C.CXType_Char_S, C.CXType_SChar, C.CXType_Short, C.CXType_Int, C.CXType_Long, C.CXType_LongLong, C.CXType_Int128:
+		return true
+	}
+	return false
+}
+
 //export tinygo_clang_struct_visitor
 func tinygo_clang_struct_visitor(c, parent C.GoCXCursor, client_data C.CXClientData) C.int {
-	passed := storedRefs.Get(unsafe.Pointer(client_data)).(struct {
-		fieldList    *ast.FieldList
-		pkg          *cgoPackage
-		inBitfield   *bool
-		bitfieldNum  *int
-		bitfieldList *[]bitfieldInfo
-	})
-	fieldList := passed.fieldList
-	p := passed.pkg
-	inBitfield := passed.inBitfield
-	bitfieldNum := passed.bitfieldNum
-	bitfieldList := passed.bitfieldList
+	state := storedRefs.Get(unsafe.Pointer(client_data)).(*recordVisitorState)
+	p := state.pkg
 	pos := p.getCursorPosition(c)
 	switch cursorKind := C.tinygo_clang_getCursorKind(c); cursorKind {
 	case C.CXCursor_FieldDecl:
 		// Expected. This is a regular field.
 	case C.CXCursor_StructDecl, C.CXCursor_UnionDecl:
-		// Ignore. The next field will be the struct/union itself.
+		if C.tinygo_clang_Cursor_isAnonymousRecordDecl(c) == 0 {
+			// Ignore. The next field will be the struct/union itself.
+			return C.CXChildVisit_Continue
+		}
+		// Anonymous struct or union, like this:
+		//     struct {
+		//         union {
+		//             int a;
+		//             float b;
+		//         };
+		//     }
+		// It is added as a field named anon0, anon1, etc (like the gc
+		// implementation of cgo). It is placed directly after the previous
+		// field, with the alignment of the struct or union.
+		typ := C.tinygo_clang_getCursorType(c)
+		var offset int64
+		if !state.union {
+			align := int64(C.clang_Type_getAlignOf(typ)) * 8
+			offset = (state.bitEnd + align - 1) / align * align
+			state.flushBitfields(offset)
+		}
+		name := "anon" + strconv.Itoa(state.anonNum)
+		state.anonNum++
+		state.addField(name, pos, typ, offset)
 		return C.CXChildVisit_Continue
 	default:
 		cursorKindSpelling := getString(C.clang_getCursorKindSpelling(cursorKind))
@@ -729,63 +930,36 @@ func tinygo_clang_struct_visitor(c, parent C.GoCXCursor, client_data C.CXClientD
 	}
 	name := getString(C.tinygo_clang_getCursorSpelling(c))
 	if name == "" {
-		// Assume this is a bitfield of 0 bits.
-		// Warning: this is not necessarily true!
+		// This is either an unnamed bitfield (used for padding) or the field
+		// of an anonymous struct or union, which has already been added.
 		return C.CXChildVisit_Continue
 	}
 	typ := C.tinygo_clang_getCursorType(c)
-	field := &ast.Field{
-		Type: p.makeASTType(typ, p.getCursorPosition(c)),
-	}
-	offsetof := int64(C.clang_Type_getOffsetOf(C.tinygo_clang_getCursorType(parent), C.CString(name)))
-	alignOf := int64(C.clang_Type_getAlignOf(typ) * 8)
-	bitfieldOffset := offsetof % alignOf
-	if bitfieldOffset != 0 {
-		if C.tinygo_clang_Cursor_isBitField(c) != 1 {
-			p.addError(pos, "expected a bitfield")
-			return C.CXChildVisit_Continue
-		}
-		if !*inBitfield {
-			*bitfieldNum++
-		}
-		bitfieldName := "__bitfield_" + strconv.Itoa(*bitfieldNum)
-		prevField := fieldList.List[len(fieldList.List)-1]
-		if !*inBitfield {
-			// The previous element also was a bitfield, but wasn't noticed
-			// then. Add it now.
-			*inBitfield = true
-			*bitfieldList = append(*bitfieldList, bitfieldInfo{
-				field:    prevField,
-				name:     prevField.Names[0].Name,
-				startBit: 0,
-				pos:      prevField.Names[0].NamePos,
-			})
-			prevField.Names[0].Name = bitfieldName
-			prevField.Names[0].Obj.Name = bitfieldName
-		}
-		prevBitfield := &(*bitfieldList)[len(*bitfieldList)-1]
-		prevBitfield.endBit = bitfieldOffset
-		*bitfieldList = append(*bitfieldList, bitfieldInfo{
-			field:    prevField,
-			name:     name,
-			startBit: bitfieldOffset,
-			pos:      pos,
+	offset := int64(C.tinygo_clang_Cursor_getOffsetOfField(c))
+	if C.tinygo_clang_Cursor_isBitField(c) == 1 {
+		// Bitfields are stored in a field that is created once the next
+		// regular field is found, so that the storage doesn't overlap with
+		// it.
+		width := int64(C.tinygo_clang_getFieldDeclBitWidth(c))
+		state.pending = append(state.pending, pendingBitfield{
+			name:   name,
+			pos:    pos,
+			typ:    typ,
+			offset: offset,
+			width:  width,
 		})
+		if offset+width > state.bitEnd {
+			state.bitEnd = offset + width
+		}
+		if state.union {
+			state.flushBitfields(state.size)
+		}
 		return C.CXChildVisit_Continue
 	}
-	*inBitfield = false
-	field.Names = []*ast.Ident{
-		&ast.Ident{
-			NamePos: pos,
-			Name:    name,
-			Obj: &ast.Object{
-				Kind: ast.Var,
-				Name: name,
-				Decl: field,
-			},
-		},
+	if !state.union {
+		state.flushBitfields(offset)
 	}
-	fieldList.List = append(fieldList.List, field)
+	state.addField(name, pos, typ, offset)
 	return C.CXChildVisit_Continue
 }
 
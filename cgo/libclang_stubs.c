@@ -67,4 +67,16 @@ CXType tinygo_clang_getEnumDeclIntegerType(CXCursor c) {
 
 unsigned tinygo_clang_Cursor_isBitField(CXCursor c) {
 	return clang_Cursor_isBitField(c);
-}
\ No newline at end of file
+}
+
+int tinygo_clang_getFieldDeclBitWidth(CXCursor c) {
+	return clang_getFieldDeclBitWidth(c);
+}
+
+long long tinygo_clang_Cursor_getOffsetOfField(CXCursor c) {
+	return clang_Cursor_getOffsetOfField(c);
+}
+
+unsigned tinygo_clang_Cursor_isAnonymousRecordDecl(CXCursor c) {
+	return clang_Cursor_isAnonymousRecordDecl(c);
+}
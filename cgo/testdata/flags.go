@@ -28,6 +28,23 @@ package main
 // This flag is not valid ldflags
 #cgo LDFLAGS: -does-not-exists
 
+// Build constraints.
+#cgo arm CFLAGS: -DARM_ONLY=1
+#cgo !arm CFLAGS: -DNOT_ARM=1
+#cgo linux,!cortexm darwin CFLAGS: -DHOST_ONLY=1
+#cgo amd64 linux,cortexm CPPFLAGS: -DCORTEXM_LINUX=1
+#cgo !arm NOFLAGS: -foo
+
+#if !defined(ARM_ONLY) || !defined(CORTEXM_LINUX)
+#warning constrained flag must be defined
+#endif
+#if defined(NOT_ARM) || defined(HOST_ONLY)
+#warning constrained flag must not be defined
+#endif
+
+// Invalid pkg-config package name.
+#cgo pkg-config: -invalid
+
 */
 import "C"
 
@@ -2,6 +2,7 @@
 //     testdata/flags.go:5:7: invalid #cgo line: NOFLAGS
 //     testdata/flags.go:8:13: invalid flag: -fdoes-not-exist
 //     testdata/flags.go:29:14: invalid flag: -does-not-exists
+//     testdata/flags.go:46:17: invalid pkg-config package name: -invalid
 
 package main
 
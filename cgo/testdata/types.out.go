@@ -5,7 +5,7 @@ import "unsafe"
 var _ unsafe.Pointer
 
 func C.variadic0() //go:variadic
-func C.variadic2(x C.int, y C.int) //go:variadic
+func C.variadic2(x C.int, y C.int, $args ...interface{}) //go:variadic
 var C.variadic0$funcaddr unsafe.Pointer
 var C.variadic2$funcaddr unsafe.Pointer
 
@@ -82,16 +82,28 @@ func (s *C.struct_4) set_bitfield_b(value C.uchar) {
 func (s *C.struct_4) bitfield_c() C.uchar {
 	return s.__bitfield_1 >> 6
 }
-func (s *C.struct_4) set_bitfield_c(value C.uchar,
-
-) { s.__bitfield_1 = s.__bitfield_1&0x3f | value<<6 }
+func (s *C.struct_4) set_bitfield_c(value C.uchar) {
+	s.__bitfield_1 = s.__bitfield_1&^0xc0 | value&0x3<<6
+}
+func (s *C.struct_4) bitfield_d() C.uchar {
+	return s.__bitfield_2 & 0x3f
+}
+func (s *C.struct_4) set_bitfield_d(value C.uchar) {
+	s.__bitfield_2 = s.__bitfield_2&^0x3f | value&0x3f<<0
+}
+func (s *C.struct_4) bitfield_e() C.uchar {
+	return s.__bitfield_3 & 0x7
+}
+func (s *C.struct_4) set_bitfield_e(value C.uchar) {
+	s.__bitfield_3 = s.__bitfield_3&^0x7 | value&0x7<<0
+}
 
 type C.struct_4 struct {
 	start        C.uchar
 	__bitfield_1 C.uchar
 
-	d C.uchar
-	e C.uchar
+	__bitfield_2 C.uchar
+	__bitfield_3 C.uchar
 }
 type C.struct_point3d struct {
 	x C.int
@@ -5,10 +5,14 @@ package compileopts
 import (
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/google/shlex"
 	"github.com/tinygo-org/tinygo/goenv"
 )
 
@@ -32,6 +36,24 @@ func (c *Config) CPU() string {
 	return c.Target.CPU
 }
 
+// FloatABI returns the floating point ABI of the target as passed to Clang
+// with -mfloat-abi (soft, softfp or hard). Like in Clang, the last flag wins,
+// so that a target can override the float ABI of the target it inherits from.
+// ARM targets that don't specify one return soft, which is also what the
+// libraries are built with by default, so that both end up with the same name
+// in the cache. Other targets return the empty string.
+func (c *Config) FloatABI() string {
+	for i := len(c.Target.CFlags) - 1; i >= 0; i-- {
+		if flag := c.Target.CFlags[i]; strings.HasPrefix(flag, "-mfloat-abi=") {
+			return flag[len("-mfloat-abi="):]
+		}
+	}
+	if strings.HasPrefix(c.Triple(), "arm") || strings.HasPrefix(c.Triple(), "thumb") {
+		return "soft"
+	}
+	return ""
+}
+
 // Features returns a list of features this CPU supports. For example, for a
 // RISC-V processor, that could be ["+a", "+c", "+m"]. For many targets, an
 // empty list will be returned.
@@ -59,6 +81,60 @@ func (c *Config) BuildTags() []string {
 	for i := 1; i <= c.GoMinorVersion; i++ {
 		tags = append(tags, fmt.Sprintf("go1.%d", i))
 	}
+	if c.Options.HeapProfile {
+		tags = append(tags, "heapprofile")
+	}
+	if c.Options.AllocTrace {
+		tags = append(tags, "alloctrace")
+	}
+	if c.Options.StackUsage {
+		tags = append(tags, "stackusage")
+	}
+	if c.Options.GDB {
+		tags = append(tags, "gdb")
+	}
+	if c.Options.ErrorTrace {
+		tags = append(tags, "errortrace")
+	}
+	if c.Options.DeadlockTrace {
+		tags = append(tags, "deadlocktrace")
+	}
+	if c.Options.InterruptCheck {
+		tags = append(tags, "interruptcheck")
+	}
+	if c.Options.StackCanary {
+		tags = append(tags, "stackcanary")
+	}
+	if c.Options.ReadOnlyText {
+		tags = append(tags, "readonlytext")
+	}
+	if c.RelocateVectors() {
+		tags = append(tags, "relocatevectors")
+	}
+	if len(c.Target.HeapRegions) != 0 {
+		tags = append(tags, "heapregions")
+	}
+	switch c.BuildMode() {
+	case "c-archive":
+		tags = append(tags, "buildmode.carchive")
+	case "c-shared":
+		tags = append(tags, "buildmode.cshared")
+	}
+	if c.Arduino() {
+		tags = append(tags, "arduino.core")
+	}
+	if c.PanicStrategy() == "trace" {
+		tags = append(tags, "panictrace")
+	}
+	if hooks := c.TraceHooks(); hooks != "none" {
+		tags = append(tags, "tracehooks."+hooks)
+	}
+	if serial := c.Serial(); serial != "default" {
+		tags = append(tags, "serial."+serial)
+	}
+	if coreDump := c.CoreDump(); coreDump != "none" {
+		tags = append(tags, "coredump."+coreDump)
+	}
 	if extraTags := strings.Fields(c.Options.Tags); len(extraTags) != 0 {
 		tags = append(tags, extraTags...)
 	}
@@ -106,6 +182,11 @@ func (c *Config) Scheduler() string {
 	if c.Options.Scheduler != "" {
 		return c.Options.Scheduler
 	}
+	if c.BuildMode() == "c-archive" || c.BuildMode() == "c-shared" {
+		// Exported functions are called by the C program, outside of any
+		// goroutine, so there is no scheduler that could run.
+		return "none"
+	}
 	if c.Target.Scheduler != "" {
 		return c.Target.Scheduler
 	}
@@ -113,6 +194,100 @@ func (c *Config) Scheduler() string {
 	return "coroutines"
 }
 
+// BuildMode returns the kind of output to produce: "default" for an executable,
+// "c-archive" for a static library with a C header, to be linked into a C
+// program, "c-shared" for a shared library with a C header, to be loaded by
+// a program on the host, or "zephyr", "freertos" and "customos" for a static
+// library that is linked into a Zephyr, FreeRTOS or custom OS application and
+// runs the Go program in its own thread.
+func (c *Config) BuildMode() string {
+	if c.Options.BuildMode != "" {
+		return c.Options.BuildMode
+	}
+	if c.Target.BuildMode != "" {
+		return c.Target.BuildMode
+	}
+	return "default"
+}
+
+// OSPackage returns the import path of the package that implements the OS
+// backend for targets with the customos build tag, or the empty string if
+// there is none. This package is included in the build as if it were imported
+// by the main package.
+func (c *Config) OSPackage() string {
+	return c.Target.OSPackage
+}
+
+// Arduino returns whether the Arduino core of the board (and possibly some
+// Arduino libraries) should be compiled and linked into the program, so that
+// it can call Arduino C++ code through extern "C" functions.
+func (c *Config) Arduino() bool {
+	return c.Options.Arduino || len(c.Options.ArduinoLibs) != 0
+}
+
+// ArduinoIncludeDirs returns the directories with the headers of the Arduino
+// core, the board variant and the Arduino libraries given with -arduino-libs.
+// These are also the directories with the source files to compile.
+func (c *Config) ArduinoIncludeDirs() []string {
+	root := goenv.Get("ARDUINO_DIR")
+	dirs := []string{filepath.Join(root, c.Target.ArduinoCore)}
+	if c.Target.ArduinoVariant != "" {
+		dirs = append(dirs, filepath.Join(root, c.Target.ArduinoVariant))
+	}
+	for _, name := range c.Options.ArduinoLibs {
+		dirs = append(dirs, ArduinoLibraryDir(name))
+	}
+	return dirs
+}
+
+// ArduinoLibraryDir returns the source directory of the Arduino library with
+// the given name. Libraries that come with the Arduino platform (such as Wire
+// and SPI) are preferred over libraries installed by the user. Libraries in the
+// current format have their sources in the src directory, older libraries have
+// them in the top level directory.
+func ArduinoLibraryDir(name string) string {
+	var candidates []string
+	for _, dir := range []string{filepath.Join(goenv.Get("ARDUINO_DIR"), "libraries"), goenv.Get("ARDUINO_LIBRARIES")} {
+		candidates = append(candidates, filepath.Join(dir, name, "src"), filepath.Join(dir, name))
+	}
+	for _, dir := range candidates {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	// Not found, this is reported when compiling the library.
+	return candidates[0]
+}
+
+// TraceHooks returns where scheduler and interrupt events are streamed to while
+// the program runs: "none", "itm" (an ITM stimulus port) or "systemview"
+// (SEGGER SystemView).
+func (c *Config) TraceHooks() string {
+	if c.Options.TraceHooks != "" {
+		return c.Options.TraceHooks
+	}
+	return "none"
+}
+
+// Serial returns where the output of print and os.Stdout goes: "default" for
+// the usual serial console of the target (UART or USB) or "itm" for ITM
+// stimulus port 0, which is usually captured by the debugger over SWO.
+func (c *Config) Serial() string {
+	if c.Options.Serial != "" {
+		return c.Options.Serial
+	}
+	return "default"
+}
+
+// CoreDump returns where a core dump is written on a panic or fault: "none"
+// (no core dump) or "serial" (the console).
+func (c *Config) CoreDump() string {
+	if c.Options.CoreDump != "" {
+		return c.Options.CoreDump
+	}
+	return "none"
+}
+
 // OptLevels returns the optimization level (0-2), size level (0-2), and inliner
 // threshold as used in the LLVM optimization pipeline.
 func (c *Config) OptLevels() (optLevel, sizeLevel int, inlinerThreshold uint) {
@@ -160,8 +335,9 @@ func (c *Config) FuncImplementation() string {
 }
 
 // PanicStrategy returns the panic strategy selected for this target. Valid
-// values are "print" (print the panic value, then exit) or "trap" (issue a trap
-// instruction).
+// values are "print" (print the panic value, then exit), "trace" (like print,
+// but also print the call chain using a symbol table stored in flash) or "trap"
+// (issue a trap instruction).
 func (c *Config) PanicStrategy() string {
 	return c.Options.PanicStrategy
 }
@@ -176,6 +352,34 @@ func (c *Config) AutomaticStackSize() bool {
 	return false
 }
 
+// RelocateVectors returns whether the vector table offset register should be
+// set to the vector table of the program at startup. This is needed for
+// programs that are started by a bootloader that leaves it pointing at its own
+// vector table.
+func (c *Config) RelocateVectors() bool {
+	return c.Target.RelocateVectors != nil && *c.Target.RelocateVectors
+}
+
+// RAMReport returns whether the worst-case RAM usage should be calculated at
+// link time, to print it (-ram-report) or to check it (-ram-check).
+func (c *Config) RAMReport() bool {
+	return (c.Options.RAMReport != "" && c.Options.RAMReport != "none") || c.Options.RAMCheck
+}
+
+// ProgramMemoryData returns whether constant globals should be moved to a
+// separate address space for program memory, where possible. This is the case
+// on AVR, where flash can't be read with ordinary load instructions.
+func (c *Config) ProgramMemoryData() bool {
+	return strings.HasPrefix(c.Triple(), "avr")
+}
+
+// ReadOnlyDataInRAM returns whether the linker script of the target places
+// read-only data (.rodata) in RAM, so that it is copied from flash at startup
+// like other initialized data.
+func (c *Config) ReadOnlyDataInRAM() bool {
+	return strings.HasPrefix(c.Triple(), "avr") || strings.HasPrefix(c.Triple(), "xtensa")
+}
+
 // CFlags returns the flags to pass to the C compiler. This is necessary for CGo
 // preprocessing.
 func (c *Config) CFlags() []string {
@@ -188,12 +392,43 @@ func (c *Config) CFlags() []string {
 		cflags = append(cflags, "-nostdlibinc", "-Xclang", "-internal-isystem", "-Xclang", filepath.Join(root, "lib", "picolibc", "newlib", "libc", "include"))
 		cflags = append(cflags, "-I"+filepath.Join(root, "lib/picolibc-include"))
 	}
+	if c.Arduino() {
+		cflags = append(cflags, c.Target.ArduinoCFlags...)
+		for _, dir := range c.ArduinoIncludeDirs() {
+			cflags = append(cflags, "-I"+dir)
+		}
+	}
 	if c.Debug() {
 		cflags = append(cflags, "-g")
 	}
+	if c.BuildMode() == "c-shared" {
+		cflags = append(cflags, "-fPIC")
+	}
+	if prefixMap := c.PathPrefixMap(); prefixMap != nil {
+		var prefixes []string
+		for prefix := range prefixMap {
+			prefixes = append(prefixes, prefix)
+		}
+		sort.Strings(prefixes)
+		for _, prefix := range prefixes {
+			cflags = append(cflags, "-ffile-prefix-map="+prefix+"="+prefixMap[prefix])
+		}
+	}
 	return cflags
 }
 
+// CGoCFlags returns the extra flags for the C compiler from the CGO_CFLAGS
+// environment variable, for example the include paths of an SDK that is used
+// from CGo. Like the #cgo CFLAGS lines, they only apply to packages that use
+// CGo and are split like a shell would split them.
+func (c *Config) CGoCFlags() ([]string, error) {
+	flags, err := shlex.Split(goenv.Get("CGO_CFLAGS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CGO_CFLAGS: %w", err)
+	}
+	return flags, nil
+}
+
 // LDFlags returns the flags to pass to the linker. A few more flags are needed
 // (like the one for the compiler runtime), but this represents the majority of
 // the flags.
@@ -202,15 +437,46 @@ func (c *Config) LDFlags() []string {
 	// Merge and adjust LDFlags.
 	var ldflags []string
 	for _, flag := range c.Target.LDFlags {
+		if flag == "-no-pie" && c.BuildMode() == "c-shared" {
+			continue
+		}
 		ldflags = append(ldflags, strings.ReplaceAll(flag, "{root}", root))
 	}
+	if c.BuildMode() == "c-shared" {
+		// Let the dynamic loader initialize the runtime when the library is
+		// loaded. The runtime uses pthreads to find the stack of the thread
+		// that calls into the library.
+		if c.GOOS() == "darwin" {
+			ldflags = append(ldflags, "-shared", "-Wl,-init,_tinygo_init")
+		} else {
+			ldflags = append(ldflags, "-shared", "-Wl,-init,tinygo_init", "-lpthread")
+		}
+	}
 	ldflags = append(ldflags, "-L", root)
-	if c.Target.LinkerScript != "" {
+	if c.Options.CrashLogSize != 0 {
+		// Reserve space for the crash log at the start of .noinit (see
+		// targets/arm.ld).
+		ldflags = append(ldflags, "--defsym=_crashlog_size="+strconv.FormatUint(c.Options.CrashLogSize, 10))
+	}
+	if c.Target.LinkerScript != "" && !c.Target.HasMemoryLayout() {
+		// Targets with a memory layout use a generated linker script instead,
+		// which is added by the builder.
 		ldflags = append(ldflags, "-T", c.Target.LinkerScript)
 	}
 	return ldflags
 }
 
+// MergeHexFiles returns the list of Intel hex files (such as a bootloader) that
+// should be merged into the firmware image when it is written as a .hex or .bin
+// file. The {root} string is replaced with the TinyGo root directory.
+func (c *Config) MergeHexFiles() []string {
+	var files []string
+	for _, path := range c.Target.MergeHex {
+		files = append(files, strings.ReplaceAll(path, "{root}", goenv.Get("TINYGOROOT")))
+	}
+	return files
+}
+
 // ExtraFiles returns the list of extra files to be built and linked with the
 // executable. This can include extra C and assembly files.
 func (c *Config) ExtraFiles() []string {
@@ -235,9 +501,38 @@ func (c *Config) Debug() bool {
 	return c.Options.Debug
 }
 
+// PathPrefixMap returns the file system paths that should be replaced in the
+// output when building with -trimpath, mapped to their replacement. This makes
+// the output independent of where TinyGo, Go and the program are stored, so
+// that builds are reproducible. It returns nil when -trimpath isn't used.
+func (c *Config) PathPrefixMap() map[string]string {
+	if !c.Options.TrimPath {
+		return nil
+	}
+	prefixMap := map[string]string{
+		goenv.Get("TINYGOROOT"): "tinygo",
+		goenv.Get("GOROOT"):     "go",
+	}
+	if wd, err := os.Getwd(); err == nil {
+		prefixMap[wd] = "."
+	}
+	delete(prefixMap, "") // in case GOROOT couldn't be found
+	return prefixMap
+}
+
 // BinaryFormat returns an appropriate binary format, based on the file
 // extension and the configured binary format in the target JSON file.
 func (c *Config) BinaryFormat(ext string) string {
+	if c.Options.MCUboot {
+		// Image with a header and a (signed) trailer for the MCUboot
+		// bootloader, either raw or as a hex file at the slot address.
+		switch ext {
+		case ".bin":
+			return "mcuboot-bin"
+		case ".hex":
+			return "mcuboot-hex"
+		}
+	}
 	switch ext {
 	case ".bin", ".gba", ".nro":
 		// The simplest format possible: dump everything in a raw binary file.
@@ -268,7 +563,7 @@ func (c *Config) Programmer() (method, openocdInterface string) {
 	case "":
 		// No configuration supplied.
 		return c.Target.FlashMethod, c.Target.OpenOCDInterface
-	case "openocd", "msd", "command":
+	case "openocd", "msd", "command", "jlink", "bmp", "dfu", "ota", "stlink-direct":
 		// The -programmer flag only specifies the flash method.
 		return c.Options.Programmer, c.Target.OpenOCDInterface
 	default:
@@ -278,15 +573,25 @@ func (c *Config) Programmer() (method, openocdInterface string) {
 	}
 }
 
+// validOpenOCDTransports lists the transports that can be selected for OpenOCD.
+// Which ones are supported depends on the debug adapter.
+var validOpenOCDTransports = []string{"swd", "jtag", "hla_swd", "hla_jtag", "dapdirect_swd", "dapdirect_jtag"}
+
 // OpenOCDConfiguration returns a list of command line arguments to OpenOCD.
 // This list of command-line arguments is based on the various OpenOCD-related
-// flags in the target specification.
+// flags in the target specification. The debug adapter may be a name of an
+// interface config that comes with OpenOCD (such as cmsis-dap or stlink) or a
+// path to a custom .cfg file, for example for FTDI based adapters.
 func (c *Config) OpenOCDConfiguration() (args []string, err error) {
 	_, openocdInterface := c.Programmer()
 	if openocdInterface == "" {
 		return nil, errors.New("OpenOCD programmer not set")
 	}
-	if !regexp.MustCompile("^[\\p{L}0-9_-]+$").MatchString(openocdInterface) {
+	if strings.HasSuffix(openocdInterface, ".cfg") {
+		args = []string{"-f", filepath.ToSlash(openocdInterface)}
+	} else if regexp.MustCompile("^[\\p{L}0-9_-]+$").MatchString(openocdInterface) {
+		args = []string{"-f", "interface/" + openocdInterface + ".cfg"}
+	} else {
 		return nil, fmt.Errorf("OpenOCD programmer has an invalid name: %#v", openocdInterface)
 	}
 	if c.Target.OpenOCDTarget == "" {
@@ -295,10 +600,9 @@ func (c *Config) OpenOCDConfiguration() (args []string, err error) {
 	if !regexp.MustCompile("^[\\p{L}0-9_-]+$").MatchString(c.Target.OpenOCDTarget) {
 		return nil, fmt.Errorf("OpenOCD target has an invalid name: %#v", c.Target.OpenOCDTarget)
 	}
-	if c.Target.OpenOCDTransport != "" && c.Target.OpenOCDTransport != "swd" {
+	if c.Target.OpenOCDTransport != "" && !isInArray(validOpenOCDTransports, c.Target.OpenOCDTransport) {
 		return nil, fmt.Errorf("unknown OpenOCD transport: %#v", c.Target.OpenOCDTransport)
 	}
-	args = []string{"-f", "interface/" + openocdInterface + ".cfg"}
 	for _, cmd := range c.Target.OpenOCDCommands {
 		args = append(args, "-c", cmd)
 	}
@@ -306,9 +610,140 @@ func (c *Config) OpenOCDConfiguration() (args []string, err error) {
 		args = append(args, "-c", "transport select "+c.Target.OpenOCDTransport)
 	}
 	args = append(args, "-f", "target/"+c.Target.OpenOCDTarget+".cfg")
+	if c.Target.OpenOCDSpeed != 0 {
+		// Target configs often set a default speed, so this must come after
+		// the target config.
+		args = append(args, "-c", "adapter speed "+strconv.FormatUint(uint64(c.Target.OpenOCDSpeed), 10))
+	}
 	return args, nil
 }
 
+// OpenOCDSWOCommands returns the OpenOCD commands that capture the SWO output
+// of the chip and make the data of the enabled ITM stimulus ports available on
+// the given TCP port. They must be run after OpenOCD has been initialized.
+func (c *Config) OpenOCDSWOCommands(tcpPort int) ([]string, error) {
+	if c.Target.SWOTraceClock == 0 {
+		return nil, errors.New("SWO capture requires the core clock of the chip, but swo-trace-clock is not set in the target")
+	}
+	// OpenOCD names the TPIU after the chip, use the first (and usually only)
+	// one.
+	tpiu := "[lindex [tpiu names] 0]"
+	return []string{
+		tpiu + " configure -protocol uart -output :" + strconv.Itoa(tcpPort) + " -traceclk " + strconv.FormatUint(uint64(c.Target.SWOTraceClock), 10),
+		tpiu + " enable",
+		"itm port 0 on",
+	}, nil
+}
+
+// JLinkConfiguration returns the command line arguments to JLinkExe and
+// JLinkGDBServer that select the device and the debug interface, based on the
+// J-Link related flags in the target specification.
+func (c *Config) JLinkConfiguration() (args []string, err error) {
+	if c.Target.JLinkDevice == "" {
+		return nil, errors.New("J-Link device not set")
+	}
+	if !regexp.MustCompile("^[\\p{L}0-9_.-]+$").MatchString(c.Target.JLinkDevice) {
+		return nil, fmt.Errorf("J-Link device has an invalid name: %#v", c.Target.JLinkDevice)
+	}
+	jlinkInterface := c.Target.JLinkInterface
+	switch jlinkInterface {
+	case "":
+		jlinkInterface = "SWD"
+	case "SWD", "JTAG":
+	default:
+		return nil, fmt.Errorf("unknown J-Link interface: %#v", jlinkInterface)
+	}
+	return []string{"-device", c.Target.JLinkDevice, "-if", jlinkInterface, "-speed", "auto"}, nil
+}
+
+// DFUConfiguration returns the command line arguments to dfu-util, based on
+// the DFU related flags in the target specification. The binary to flash must
+// be appended using --download.
+func (c *Config) DFUConfiguration() (args []string, err error) {
+	args, err = c.dfuDeviceArgs()
+	if err != nil {
+		return nil, err
+	}
+	if c.Target.DFUAddress != "" {
+		// Leave DFU mode after flashing, to start the program.
+		if c.Options.FlashErase {
+			// Erase the entire chip first (DfuSe extension).
+			args = append(args, "--dfuse-address", c.Target.DFUAddress+":mass-erase:force:leave")
+		} else {
+			args = append(args, "--dfuse-address", c.Target.DFUAddress+":leave")
+		}
+	} else {
+		args = append(args, "--reset")
+	}
+	return args, nil
+}
+
+// DFUUploadConfiguration returns the arguments to dfu-util to read the first
+// length bytes of the flash memory of the device. The --upload flag with the
+// output file must be added by the caller.
+func (c *Config) DFUUploadConfiguration(length uint64) (args []string, err error) {
+	args, err = c.dfuDeviceArgs()
+	if err != nil {
+		return nil, err
+	}
+	if c.Target.DFUAddress != "" {
+		args = append(args, "--dfuse-address", c.Target.DFUAddress+":"+strconv.FormatUint(length, 10))
+	} else {
+		args = append(args, "--upload-size", strconv.FormatUint(length, 10))
+	}
+	return args, nil
+}
+
+// dfuDeviceArgs returns the dfu-util arguments to select the device and the
+// alternate setting, after validating the DFU properties of the target.
+func (c *Config) dfuDeviceArgs() (args []string, err error) {
+	if c.Target.DFUDevice != "" {
+		if !regexp.MustCompile("^[0-9a-fA-F]{4}:[0-9a-fA-F]{4}$").MatchString(c.Target.DFUDevice) {
+			return nil, fmt.Errorf("DFU device must be in the form vid:pid: %#v", c.Target.DFUDevice)
+		}
+		args = append(args, "--device", c.Target.DFUDevice)
+	}
+	args = append(args, "--alt", strconv.FormatUint(uint64(c.Target.DFUAltSetting), 10))
+	if c.Target.DFUAddress != "" && !regexp.MustCompile("^0x[0-9a-fA-F]+$").MatchString(c.Target.DFUAddress) {
+		return nil, fmt.Errorf("DFU address must be a hexadecimal number: %#v", c.Target.DFUAddress)
+	}
+	return args, nil
+}
+
+// RenodeScript returns a Renode script (.resc) that loads the given ELF file in
+// the platform of the target and runs it. All lines written to the UART of the
+// target are printed to stdout, and Renode exits once the program has printed
+// the result of a test or has panicked. If exitAddress is not zero, Renode also
+// exits when the program reaches this address, which is where the program ends
+// up when main returns. If gdbPort is not zero, the program is not started but
+// a GDB server is started on this port instead.
+func (c *Config) RenodeScript(executable string, gdbPort int, exitAddress uint64) (string, error) {
+	if c.Target.RenodePlatform == "" {
+		return "", errors.New("renode-platform not configured in the target specification")
+	}
+	if c.Target.RenodeUART == "" {
+		return "", errors.New("renode-uart not configured in the target specification")
+	}
+	platform := strings.ReplaceAll(c.Target.RenodePlatform, "{root}", goenv.Get("TINYGOROOT"))
+	lines := []string{
+		"mach create",
+		"machine LoadPlatformDescription @" + platform,
+		"sysbus LoadELF @" + executable,
+		c.Target.RenodeUART + ` AddLineHook "" "print line; (line in ('PASS', 'FAIL') or line.startswith('panic: ')) and Antmicro.Renode.Emulator.Exit()"`,
+	}
+	// Extra commands, for example to set the values of simulated sensors.
+	lines = append(lines, c.Target.RenodeScript...)
+	if gdbPort != 0 {
+		lines = append(lines, "machine StartGdbServer "+strconv.Itoa(gdbPort))
+	} else {
+		if exitAddress != 0 {
+			lines = append(lines, fmt.Sprintf(`sysbus.cpu AddHook 0x%x "Antmicro.Renode.Emulator.Exit()"`, exitAddress))
+		}
+		lines = append(lines, "start")
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
 // CodeModel returns the code model used on this platform.
 func (c *Config) CodeModel() string {
 	if c.Target.CodeModel != "" {
@@ -324,6 +759,10 @@ func (c *Config) RelocationModel() string {
 	if c.Target.RelocationModel != "" {
 		return c.Target.RelocationModel
 	}
+	if c.BuildMode() == "c-shared" {
+		// Code in a shared library can be loaded at any address.
+		return "pic"
+	}
 
 	return "static"
 }
@@ -341,7 +780,52 @@ func (c *Config) LLVMFeatures() string {
 	return c.Options.LLVMFeatures
 }
 
+// LightweightFmt returns whether simple calls to fmt.Printf, fmt.Println and
+// fmt.Sprintf should be lowered to direct print calls (-fmt=light), so that the
+// fmt package can often be left out of the binary entirely.
+func (c *Config) LightweightFmt() bool {
+	return c.Options.Fmt == "light"
+}
+
+// GlobalValues returns the string globals that are set after linking: the ones
+// from -ldflags="-X ..." and, on baremetal targets, the runtime globals with the
+// command line arguments, environment variables, settings region address and
+// heap regions that are baked into the image.
+func (c *Config) GlobalValues() map[string]map[string]string {
+	if len(c.Options.Args) == 0 && len(c.Options.Env) == 0 && c.Options.SettingsAddress == "" && len(c.Target.HeapRegions) == 0 {
+		return c.Options.GlobalValues
+	}
+	globals := make(map[string]map[string]string, len(c.Options.GlobalValues)+1)
+	for pkgPath, values := range c.Options.GlobalValues {
+		globals[pkgPath] = values
+	}
+	runtimeValues := make(map[string]string)
+	for name, value := range globals["runtime"] {
+		runtimeValues[name] = value
+	}
+	if len(c.Options.Args) != 0 {
+		runtimeValues["buildArgs"] = strings.Join(c.Options.Args, "\x00")
+	}
+	if len(c.Options.Env) != 0 {
+		runtimeValues["buildEnv"] = strings.Join(c.Options.Env, "\x00")
+	}
+	if c.Options.SettingsAddress != "" {
+		runtimeValues["settingsAddress"] = c.Options.SettingsAddress
+	}
+	if len(c.Target.HeapRegions) != 0 {
+		// The layout has already been checked in builder.NewConfig.
+		runtimeValues["heapRegions"], _ = c.Target.HeapRegionLayout()
+	}
+	globals["runtime"] = runtimeValues
+	return globals
+}
+
 type TestConfig struct {
 	CompileTestBinary bool
-	// TODO: Filter the test functions to run, include verbose flag, etc
+	Verbose           bool   // -v: print all test results and log output
+	Short             bool   // -short: tell long-running tests to shorten their run time
+	RunRegexp         string // -run: only run tests matching this regexp
+	Cover             bool   // -cover: instrument the tested package for code coverage
+	CoverProfile      string // -coverprofile: append coverage data to this file
+	Flash             bool   // -flash: run the test on a device instead of on the host
 }
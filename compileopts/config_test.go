@@ -0,0 +1,288 @@
+package compileopts
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/goenv"
+)
+
+func TestDFUConfiguration(t *testing.T) {
+	tests := []struct {
+		target TargetSpec
+		args   []string
+		err    string
+	}{
+		{TargetSpec{}, []string{"--alt", "0", "--reset"}, ""},
+		{TargetSpec{DFUDevice: "0483:df11", DFUAddress: "0x08000000"}, []string{"--device", "0483:df11", "--alt", "0", "--dfuse-address", "0x08000000:leave"}, ""},
+		{TargetSpec{DFUDevice: "28e9:0189", DFUAltSetting: 1}, []string{"--device", "28e9:0189", "--alt", "1", "--reset"}, ""},
+		{TargetSpec{DFUDevice: "0483"}, nil, `DFU device must be in the form vid:pid: "0483"`},
+		{TargetSpec{DFUAddress: "8000000"}, nil, `DFU address must be a hexadecimal number: "8000000"`},
+	}
+	for _, tc := range tests {
+		target := tc.target
+		config := &Config{Options: &Options{}, Target: &target}
+		args, err := config.DFUConfiguration()
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%+v: expected error %#v, got %v", tc.target, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %v", tc.target, err)
+		} else if !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%+v: expected %v, got %v", tc.target, tc.args, args)
+		}
+	}
+}
+
+func TestDFUUploadConfiguration(t *testing.T) {
+	tests := []struct {
+		target TargetSpec
+		args   []string
+	}{
+		{TargetSpec{DFUDevice: "0483:df11", DFUAddress: "0x08000000"}, []string{"--device", "0483:df11", "--alt", "0", "--dfuse-address", "0x08000000:65536"}},
+		{TargetSpec{DFUDevice: "28e9:0189", DFUAltSetting: 1}, []string{"--device", "28e9:0189", "--alt", "1", "--upload-size", "65536"}},
+	}
+	for _, tc := range tests {
+		target := tc.target
+		config := &Config{Options: &Options{}, Target: &target}
+		args, err := config.DFUUploadConfiguration(65536)
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %v", tc.target, err)
+		} else if !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%+v: expected %v, got %v", tc.target, tc.args, args)
+		}
+	}
+}
+
+func TestJLinkConfiguration(t *testing.T) {
+	tests := []struct {
+		device, iface string
+		args          []string
+		err           string
+	}{
+		{device: "nRF52840_xxAA", args: []string{"-device", "nRF52840_xxAA", "-if", "SWD", "-speed", "auto"}},
+		{device: "fe310", iface: "JTAG", args: []string{"-device", "fe310", "-if", "JTAG", "-speed", "auto"}},
+		{device: "", err: "J-Link device not set"},
+		{device: "nrf52; rm -rf", err: `J-Link device has an invalid name: "nrf52; rm -rf"`},
+		{device: "STM32F103C8", iface: "cJTAG", err: `unknown J-Link interface: "cJTAG"`},
+	}
+	for _, tc := range tests {
+		config := &Config{
+			Options: &Options{},
+			Target:  &TargetSpec{JLinkDevice: tc.device, JLinkInterface: tc.iface},
+		}
+		args, err := config.JLinkConfiguration()
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("device %#v: expected error %#v, got %v", tc.device, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("device %#v: unexpected error: %v", tc.device, err)
+		} else if !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("device %#v: expected %v, got %v", tc.device, tc.args, args)
+		}
+	}
+}
+
+func TestRenodeScript(t *testing.T) {
+	config := &Config{Options: &Options{}, Target: &TargetSpec{
+		RenodePlatform: "platforms/cpus/nrf52840.repl",
+		RenodeUART:     "sysbus.uart0",
+		RenodeScript:   []string{"sysbus.twi0.sensor Temperature 25"},
+	}}
+	script, err := config.RenodeScript("/tmp/test.elf", 0, 0)
+	if err != nil {
+		t.Fatal("could not create script:", err)
+	}
+	lines := strings.Split(script, "\n")
+	if lines[1] != "machine LoadPlatformDescription @platforms/cpus/nrf52840.repl" || lines[2] != "sysbus LoadELF @/tmp/test.elf" || !strings.HasPrefix(lines[3], "sysbus.uart0 AddLineHook ") {
+		t.Errorf("unexpected script:\n%s", script)
+	}
+	if lines[4] != "sysbus.twi0.sensor Temperature 25" || lines[5] != "start" {
+		t.Errorf("unexpected end of script:\n%s", script)
+	}
+
+	// Renode exits when the program reaches the exit address.
+	script, err = config.RenodeScript("/tmp/test.elf", 0, 0x1234)
+	if err != nil {
+		t.Fatal("could not create script:", err)
+	}
+	if !strings.HasSuffix(script, "\nsysbus.cpu AddHook 0x1234 \"Antmicro.Renode.Emulator.Exit()\"\nstart\n") {
+		t.Errorf("expected an exit hook before starting:\n%s", script)
+	}
+
+	script, err = config.RenodeScript("/tmp/test.elf", 3333, 0x1234)
+	if err != nil {
+		t.Fatal("could not create script:", err)
+	}
+	if !strings.HasSuffix(script, "\nmachine StartGdbServer 3333\n") || strings.Contains(script, "AddHook 0x") {
+		t.Errorf("expected a GDB server to be started:\n%s", script)
+	}
+
+	config.Target.RenodeUART = ""
+	if _, err := config.RenodeScript("/tmp/test.elf", 0, 0); err == nil {
+		t.Error("expected an error without renode-uart")
+	}
+}
+
+func TestTrimPathCFlags(t *testing.T) {
+	config := &Config{Options: &Options{}, Target: &TargetSpec{}}
+	for _, flag := range config.CFlags() {
+		if strings.HasPrefix(flag, "-ffile-prefix-map=") {
+			t.Errorf("unexpected flag without -trimpath: %s", flag)
+		}
+	}
+
+	config.Options.TrimPath = true
+	var prefixMaps []string
+	for _, flag := range config.CFlags() {
+		if strings.HasPrefix(flag, "-ffile-prefix-map=") {
+			prefixMaps = append(prefixMaps, flag)
+		}
+	}
+	if len(prefixMaps) != len(config.PathPrefixMap()) {
+		t.Errorf("expected a -ffile-prefix-map flag for every prefix, got %v", prefixMaps)
+	}
+	if config.PathPrefixMap()[goenv.Get("TINYGOROOT")] != "tinygo" {
+		t.Errorf("TINYGOROOT is not replaced: %v", config.PathPrefixMap())
+	}
+}
+
+func TestRelocateVectors(t *testing.T) {
+	hasTag := func(config *Config) bool {
+		for _, tag := range config.BuildTags() {
+			if tag == "relocatevectors" {
+				return true
+			}
+		}
+		return false
+	}
+	config := &Config{Options: &Options{}, Target: &TargetSpec{}}
+	if config.RelocateVectors() || hasTag(config) {
+		t.Error("vector table is relocated without relocate-vectors")
+	}
+	relocate := true
+	config.Target.RelocateVectors = &relocate
+	if !config.RelocateVectors() || !hasTag(config) {
+		t.Error("vector table is not relocated with relocate-vectors")
+	}
+}
+
+func TestCGoCFlags(t *testing.T) {
+	oldCFlags := os.Getenv("CGO_CFLAGS")
+	defer os.Setenv("CGO_CFLAGS", oldCFlags)
+	os.Setenv("CGO_CFLAGS", `-I/opt/sdk/include  -I"/opt/my sdk/include" -DSDK=1`)
+
+	config := &Config{Options: &Options{}, Target: &TargetSpec{CFlags: []string{"-Oz"}}}
+	if cflags := config.CFlags(); !reflect.DeepEqual(cflags, []string{"-Oz"}) {
+		t.Errorf("CGO_CFLAGS should not be used outside of CGo, got: %v", cflags)
+	}
+	cgoCFlags, err := config.CGoCFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cgoCFlags, []string{"-I/opt/sdk/include", "-I/opt/my sdk/include", "-DSDK=1"}) {
+		t.Errorf("unexpected flags with CGO_CFLAGS: %v", cgoCFlags)
+	}
+
+	os.Setenv("CGO_CFLAGS", `-I"/opt/sdk`)
+	if _, err := config.CGoCFlags(); err == nil {
+		t.Error("expected an error for an unterminated quote in CGO_CFLAGS")
+	}
+}
+
+func TestFloatABI(t *testing.T) {
+	for _, tc := range []struct {
+		triple   string
+		cflags   []string
+		floatABI string
+	}{
+		{"thumbv6m-unknown-unknown-eabi", nil, "soft"},
+		{"thumbv7em-unknown-unknown-eabi", []string{"-mfloat-abi=soft"}, "soft"},
+		{"thumbv7em-unknown-unknown-eabi", []string{"-mfloat-abi=hard"}, "hard"},
+		{"thumbv7em-unknown-unknown-eabi", []string{"-mfloat-abi=soft", "-Oz", "-mfloat-abi=softfp"}, "softfp"},
+		{"riscv32-unknown-none", nil, ""},
+	} {
+		config := &Config{Options: &Options{}, Target: &TargetSpec{Triple: tc.triple, CFlags: tc.cflags}}
+		if floatABI := config.FloatABI(); floatABI != tc.floatABI {
+			t.Errorf("%s %v: expected float ABI %q, got %q", tc.triple, tc.cflags, tc.floatABI, floatABI)
+		}
+	}
+
+	// Zephyr applications use the hard float ABI when the FPU is enabled.
+	for _, tc := range []struct {
+		target   string
+		triple   string
+		floatABI string
+	}{
+		{"zephyr-cortex-m4", "armv7em-none-eabi", "soft"},
+		{"zephyr-cortex-m4f", "armv7em-none-eabihf", "hard"},
+	} {
+		spec, err := LoadTarget(tc.target)
+		if err != nil {
+			t.Fatal("could not load target:", err)
+		}
+		config := &Config{Options: &Options{}, Target: spec}
+		if config.Triple() != tc.triple || config.FloatABI() != tc.floatABI {
+			t.Errorf("%s: expected %s with float ABI %q, got %s with float ABI %q", tc.target, tc.triple, tc.floatABI, config.Triple(), config.FloatABI())
+		}
+	}
+}
+
+func TestOpenOCDConfiguration(t *testing.T) {
+	tests := []struct {
+		target TargetSpec
+		args   []string
+		err    string
+	}{
+		{TargetSpec{OpenOCDInterface: "cmsis-dap", OpenOCDTarget: "nrf52"}, []string{"-f", "interface/cmsis-dap.cfg", "-f", "target/nrf52.cfg"}, ""},
+		{TargetSpec{OpenOCDInterface: "ftdi/my-probe.cfg", OpenOCDTarget: "nrf52", OpenOCDTransport: "jtag", OpenOCDSpeed: 4000}, []string{"-f", "ftdi/my-probe.cfg", "-c", "transport select jtag", "-f", "target/nrf52.cfg", "-c", "adapter speed 4000"}, ""},
+		{TargetSpec{OpenOCDInterface: "stlink", OpenOCDTarget: "stm32f4x", OpenOCDTransport: "hla_swd"}, []string{"-f", "interface/stlink.cfg", "-c", "transport select hla_swd", "-f", "target/stm32f4x.cfg"}, ""},
+		{TargetSpec{OpenOCDInterface: "stlink", OpenOCDTarget: "stm32f4x", OpenOCDTransport: "spi"}, nil, `unknown OpenOCD transport: "spi"`},
+		{TargetSpec{OpenOCDInterface: "my probe", OpenOCDTarget: "stm32f4x"}, nil, `OpenOCD programmer has an invalid name: "my probe"`},
+	}
+	for _, tc := range tests {
+		target := tc.target
+		config := &Config{Options: &Options{}, Target: &target}
+		args, err := config.OpenOCDConfiguration()
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%+v: expected error %#v, got %v", tc.target, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %v", tc.target, err)
+		} else if !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%+v: expected %v, got %v", tc.target, tc.args, args)
+		}
+	}
+}
+
+func TestOpenOCDSWOCommands(t *testing.T) {
+	config := &Config{Options: &Options{}, Target: &TargetSpec{SWOTraceClock: 72000000}}
+	commands, err := config.OpenOCDSWOCommands(3344)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	expected := []string{
+		"[lindex [tpiu names] 0] configure -protocol uart -output :3344 -traceclk 72000000",
+		"[lindex [tpiu names] 0] enable",
+		"itm port 0 on",
+	}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("expected %v, got %v", expected, commands)
+	}
+
+	config.Target.SWOTraceClock = 0
+	if _, err := config.OpenOCDSWOCommands(3344); err == nil {
+		t.Error("expected an error without swo-trace-clock")
+	}
+}
@@ -0,0 +1,397 @@
+package compileopts
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/tinygo-org/tinygo/goenv"
+)
+
+// Names of the MEMORY regions in the linker scripts of TinyGo that contain the
+// program code and the RAM.
+var (
+	flashRegionNames = []string{"FLASH_TEXT", "FLASH", "rom"}
+	ramRegionNames   = []string{"RAM", "DRAM"}
+)
+
+var (
+	linkerScriptComment    = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	linkerScriptInclude    = regexp.MustCompile(`INCLUDE\s+"?([^"\s]+)"?`)
+	linkerScriptAssignment = regexp.MustCompile(`(?m)^\s*([A-Za-z_][A-Za-z0-9_]*)\s*=\s*([^;]+);`)
+	linkerScriptRegion     = regexp.MustCompile(`(?m)^\s*([A-Za-z_][A-Za-z0-9_]*)\s*(?:\([^)]*\))?\s*:\s*ORIGIN\s*=\s*([^,]+),\s*LENGTH\s*=\s*([^\n]+)$`)
+	linkerFlagDefsym       = regexp.MustCompile(`^(?:-Wl,)?--defsym[= ]([A-Za-z_][A-Za-z0-9_]*)=(.+)$`)
+	linkerScriptSection    = regexp.MustCompile(`(?s)(\.[A-Za-z0-9_.]+|/DISCARD/)\s*(\(NOLOAD\))?\s*:\s*(?:AT\s*\([^)]*\)\s*)?\{(.*?)\}`)
+	linkerScriptInput      = regexp.MustCompile(`\*\(([^()]*)\)`)
+)
+
+// LinkerSection is an input section that is placed by the linker script of a
+// target, which can be used with the //go:section pragma.
+type LinkerSection struct {
+	Pattern string // input section name, possibly with wildcards (.data.*)
+	NoLoad  bool   // not loaded from the binary: in a NOLOAD section or in .bss
+}
+
+// linkerScriptTemplate is the template of the linker script that is generated
+// for targets that describe their memory layout in the target specification.
+// The section placement comes from the linker script in the "linkerscript"
+// property, which is included at the end.
+var linkerScriptTemplate = template.Must(template.New("linkerscript").Parse(`/* Generated by TinyGo from the target specification. */
+
+MEMORY
+{
+    FLASH_TEXT (rw) : ORIGIN = {{.FlashOrigin}} + {{.AppOffset}}, LENGTH = {{.FlashSize}} - {{.AppOffset}}
+    RAM (xrw)       : ORIGIN = {{.RAMOrigin}}, LENGTH = {{.RAMSize}}
+}
+
+_stack_size = {{.SystemStackSize}};
+{{if .LinkerScript}}
+INCLUDE "{{.LinkerScript}}"
+{{end}}`))
+
+// HasMemoryLayout returns whether the target specification describes the
+// memory layout of the chip, in which case the linker script is generated
+// using GenerateLinkerScript.
+func (spec *TargetSpec) HasMemoryLayout() bool {
+	return spec.FlashSize != ""
+}
+
+// GenerateLinkerScript returns a linker script with the memory regions,
+// bootloader offset and system stack size taken from the target specification.
+// The script in the "linkerscript" property only needs to contain the section
+// placement, so that chip variants with a different amount of flash or RAM
+// don't need their own linker script.
+func (spec *TargetSpec) GenerateLinkerScript() (string, error) {
+	if spec.RAMOrigin == "" || spec.RAMSize == "" {
+		return "", errors.New("target specifies flash-size but not ram-origin and ram-size")
+	}
+	layout := *spec
+	if layout.FlashOrigin == "" {
+		layout.FlashOrigin = "0"
+	}
+	if layout.AppOffset == "" {
+		layout.AppOffset = "0"
+	}
+	if layout.SystemStackSize == "" {
+		layout.SystemStackSize = "2K"
+	}
+	buf := &strings.Builder{}
+	err := linkerScriptTemplate.Execute(buf, &layout)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// MemorySizes returns the size of the flash and RAM of this target, as far as
+// they can be determined from the linker script. Sizes that cannot be
+// determined (for example because the target doesn't use a linker script) are
+// returned as zero.
+func (spec *TargetSpec) MemorySizes() (flash, ram uint64) {
+	symbols, _, lengths := spec.memoryRegions()
+	flash = memoryRegionSize(flashRegionNames, lengths, symbols)
+	ram = memoryRegionSize(ramRegionNames, lengths, symbols)
+	return flash, ram
+}
+
+// FlashRegion returns the start address and the size of the part of the flash
+// memory that contains the program (excluding a bootloader, if there is one).
+// The size is zero if it cannot be determined.
+func (spec *TargetSpec) FlashRegion() (origin, size uint64) {
+	symbols, origins, lengths := spec.memoryRegions()
+	for _, name := range flashRegionNames {
+		if _, ok := lengths[name]; !ok {
+			continue
+		}
+		start, ok1 := evalLinkerExpr(origins[name], symbols)
+		length, ok2 := evalLinkerExpr(lengths[name], symbols)
+		if ok1 && ok2 {
+			return start, length
+		}
+	}
+	return 0, 0
+}
+
+// maxHeapRegions is the maximum number of extra heap regions, which is the size
+// of the region table in the runtime (see src/runtime/gc_heapregions.go).
+const maxHeapRegions = 8
+
+// HeapRegionLayout returns the heap regions of the target as they are passed to
+// the runtime: a NUL separated list of the regions in the order the allocator
+// should try them. Every region is written as start-end in hexadecimal,
+// prefixed with "ext:" for external memory, except for the main heap, which is
+// written as "heap". An empty string is returned if the target doesn't have
+// extra heap regions.
+func (spec *TargetSpec) HeapRegionLayout() (string, error) {
+	if len(spec.HeapRegions) == 0 {
+		return "", nil
+	}
+	if len(spec.HeapRegions) > maxHeapRegions {
+		return "", fmt.Errorf("too many heap regions: %d (the maximum is %d)", len(spec.HeapRegions), maxHeapRegions)
+	}
+	type heapRegion struct {
+		name       string
+		start, end uint64
+		priority   int
+		external   bool
+	}
+	var regions []heapRegion
+	for _, region := range spec.HeapRegions {
+		start, ok := evalLinkerExpr(region.Origin, nil)
+		if !ok || start == 0 {
+			// An allocation at address 0 would be a nil pointer.
+			return "", fmt.Errorf("heap region %s: invalid origin %q", region.Name, region.Origin)
+		}
+		size, ok := evalLinkerExpr(region.Size, nil)
+		if !ok || size == 0 {
+			return "", fmt.Errorf("heap region %s: invalid size %q", region.Name, region.Size)
+		}
+		for _, other := range regions {
+			if start < other.end && other.start < start+size {
+				return "", fmt.Errorf("heap region %s overlaps with heap region %s", region.Name, other.name)
+			}
+		}
+		regions = append(regions, heapRegion{region.Name, start, start + size, region.Priority, region.External})
+	}
+
+	// The main heap has priority 0. It goes before regions with the same
+	// priority.
+	regions = append([]heapRegion{{name: "heap"}}, regions...)
+	sort.SliceStable(regions, func(i, j int) bool {
+		return regions[i].priority > regions[j].priority
+	})
+	var entries []string
+	for _, region := range regions {
+		switch {
+		case region.end == 0:
+			entries = append(entries, "heap")
+		case region.external:
+			entries = append(entries, fmt.Sprintf("ext:%#x-%#x", region.start, region.end))
+		default:
+			entries = append(entries, fmt.Sprintf("%#x-%#x", region.start, region.end))
+		}
+	}
+	return strings.Join(entries, "\x00"), nil
+}
+
+// memoryRegions returns the symbols defined in the linker script and the
+// (unevaluated) origin and length of each memory region.
+func (spec *TargetSpec) memoryRegions() (symbols map[string]uint64, origins, lengths map[string]string) {
+	root := goenv.Get("TINYGOROOT")
+	symbols = make(map[string]uint64)
+	origins = make(map[string]string)
+	lengths = make(map[string]string)
+
+	// The memory layout may be given in the target specification, in which
+	// case it takes precedence over the regions in the linker script.
+	if spec.HasMemoryLayout() {
+		origins["FLASH_TEXT"] = "0"
+		if spec.FlashOrigin != "" {
+			origins["FLASH_TEXT"] = spec.FlashOrigin
+		}
+		lengths["FLASH_TEXT"] = spec.FlashSize
+		if spec.AppOffset != "" {
+			origins["FLASH_TEXT"] += " + " + spec.AppOffset
+			lengths["FLASH_TEXT"] += " - " + spec.AppOffset
+		}
+		if spec.RAMSize != "" {
+			origins["RAM"] = spec.RAMOrigin
+			lengths["RAM"] = spec.RAMSize
+		}
+		return symbols, origins, lengths
+	}
+
+	// Symbols may also be defined on the linker command line.
+	for _, flag := range spec.LDFlags {
+		if match := linkerFlagDefsym.FindStringSubmatch(flag); match != nil {
+			if value, ok := evalLinkerExpr(match[2], symbols); ok {
+				symbols[match[1]] = value
+			}
+		}
+	}
+
+	var scripts []string
+	if spec.LinkerScript != "" {
+		scripts = append(scripts, spec.LinkerScript)
+	}
+	for i, flag := range spec.LDFlags {
+		if flag == "-T" && i+1 < len(spec.LDFlags) {
+			scripts = append(scripts, spec.LDFlags[i+1])
+		}
+	}
+	for _, script := range scripts {
+		readLinkerScript(root, script, symbols, origins, lengths, 0)
+	}
+	return symbols, origins, lengths
+}
+
+// LinkerSections returns the input sections that are placed by the linker
+// scripts of this target, in the order they appear in the linker scripts. It
+// returns nil if the target has no linker script that can be read.
+func (spec *TargetSpec) LinkerSections() []LinkerSection {
+	var scripts []string
+	if spec.LinkerScript != "" {
+		scripts = append(scripts, spec.LinkerScript)
+	}
+	for i, flag := range spec.LDFlags {
+		if flag == "-T" && i+1 < len(spec.LDFlags) {
+			scripts = append(scripts, spec.LDFlags[i+1])
+		}
+	}
+	var sections []LinkerSection
+	for _, script := range scripts {
+		readLinkerSections(goenv.Get("TINYGOROOT"), script, &sections, 0)
+	}
+	return sections
+}
+
+// FindLinkerSection returns the input section that a section with the given
+// name is placed in, if there is one. The first matching input section is
+// returned, as the linker does.
+func FindLinkerSection(sections []LinkerSection, name string) (LinkerSection, bool) {
+	if name == "" {
+		return LinkerSection{}, false
+	}
+	for _, section := range sections {
+		if matched, _ := path.Match(section.Pattern, name); matched {
+			return section, true
+		}
+	}
+	return LinkerSection{}, false
+}
+
+// readLinkerSections reads the input sections from the output section
+// descriptions in the given linker script and the files it includes.
+func readLinkerSections(root, path string, sections *[]LinkerSection, depth int) {
+	if depth > 8 {
+		return // include loop
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return // not all linker scripts exist (some are generated)
+	}
+	text := linkerScriptComment.ReplaceAllString(string(data), "")
+	for _, match := range linkerScriptInclude.FindAllStringSubmatch(text, -1) {
+		readLinkerSections(root, match[1], sections, depth+1)
+	}
+	for _, match := range linkerScriptSection.FindAllStringSubmatch(text, -1) {
+		if match[1] == "/DISCARD/" {
+			continue
+		}
+		for _, input := range linkerScriptInput.FindAllStringSubmatch(match[3], -1) {
+			for _, pattern := range strings.Fields(input[1]) {
+				if pattern == "COMMON" {
+					continue
+				}
+				// The .bss section is cleared by the startup code instead of
+				// loaded from the binary, just like a NOLOAD section.
+				*sections = append(*sections, LinkerSection{
+					Pattern: pattern,
+					NoLoad:  match[2] != "" || match[1] == ".bss",
+				})
+			}
+		}
+	}
+}
+
+// readLinkerScript reads symbol assignments and the origins and lengths of
+// memory regions from the given linker script and the files it includes.
+func readLinkerScript(root, path string, symbols map[string]uint64, origins, lengths map[string]string, depth int) {
+	if depth > 8 {
+		return // include loop
+	}
+	data, err := ioutil.ReadFile(filepath.Join(root, path))
+	if err != nil {
+		return // not all linker scripts exist (some are generated)
+	}
+	text := linkerScriptComment.ReplaceAllString(string(data), "")
+	for _, match := range linkerScriptAssignment.FindAllStringSubmatch(text, -1) {
+		if value, ok := evalLinkerExpr(match[2], symbols); ok {
+			symbols[match[1]] = value
+		}
+	}
+	for _, match := range linkerScriptRegion.FindAllStringSubmatch(text, -1) {
+		origins[match[1]] = match[2]
+		lengths[match[1]] = match[3]
+	}
+	for _, match := range linkerScriptInclude.FindAllStringSubmatch(text, -1) {
+		readLinkerScript(root, match[1], symbols, origins, lengths, depth+1)
+	}
+}
+
+// memoryRegionSize returns the length of the first region in names that is
+// defined and that can be evaluated, or zero if there is none.
+func memoryRegionSize(names []string, lengths map[string]string, symbols map[string]uint64) uint64 {
+	for _, name := range names {
+		if expr, ok := lengths[name]; ok {
+			if value, ok := evalLinkerExpr(expr, symbols); ok {
+				return value
+			}
+		}
+	}
+	return 0
+}
+
+// evalLinkerExpr evaluates a simple linker script expression: a sum or
+// difference of numbers (possibly with a K or M suffix) and symbols.
+func evalLinkerExpr(expr string, symbols map[string]uint64) (uint64, bool) {
+	expr = strings.TrimSpace(expr)
+	var result uint64
+	sign := uint64(1)
+	for {
+		end := strings.IndexAny(expr, "+-")
+		term := strings.TrimSpace(expr)
+		if end >= 0 {
+			term = strings.TrimSpace(expr[:end])
+		}
+		value, ok := evalLinkerTerm(term, symbols)
+		if !ok {
+			return 0, false
+		}
+		result += sign * value
+		if end < 0 {
+			break
+		}
+		if expr[end] == '-' {
+			sign = ^uint64(0) // -1, so that the multiplication above subtracts
+		} else {
+			sign = 1
+		}
+		expr = expr[end+1:]
+	}
+	return result, true
+}
+
+// evalLinkerTerm evaluates a single number or symbol.
+func evalLinkerTerm(term string, symbols map[string]uint64) (uint64, bool) {
+	if term == "" {
+		return 0, false
+	}
+	if value, ok := symbols[term]; ok {
+		return value, true
+	}
+	multiplier := uint64(1)
+	switch term[len(term)-1] {
+	case 'K', 'k':
+		multiplier = 1024
+		term = term[:len(term)-1]
+	case 'M', 'm':
+		multiplier = 1024 * 1024
+		term = term[:len(term)-1]
+	}
+	value, err := strconv.ParseUint(term, 0, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value * multiplier, true
+}
@@ -3,15 +3,22 @@ package compileopts
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 var (
 	validGCOptions            = []string{"none", "leaking", "extalloc", "conservative"}
 	validSchedulerOptions     = []string{"none", "tasks", "coroutines"}
-	validPrintSizeOptions     = []string{"none", "short", "full"}
-	validPanicStrategyOptions = []string{"print", "trap"}
+	validPrintSizeOptions     = []string{"none", "short", "full", "symbols", "json"}
+	validRAMReportOptions     = []string{"none", "text", "json"}
+	validPanicStrategyOptions = []string{"print", "trap", "trace"}
 	validOptOptions           = []string{"none", "0", "1", "2", "s", "z"}
+	validFmtOptions           = []string{"full", "light"}
+	validBuildModeOptions     = []string{"default", "c-archive", "c-shared", "zephyr", "freertos", "customos"}
+	validTraceHooksOptions    = []string{"none", "itm", "systemview"}
+	validSerialOptions        = []string{"default", "itm"}
+	validCoreDumpOptions      = []string{"none", "serial"}
 )
 
 // Options contains extra options to give to the compiler. These options are
@@ -29,14 +36,51 @@ type Options struct {
 	Debug           bool
 	PrintSizes      string
 	PrintAllocs     *regexp.Regexp // regexp string
+	PrintAllocsJSON bool           // print -print-allocs output as JSON
 	PrintStacks     bool
+	StackUsage      bool // measure the peak stack usage of goroutines at runtime
+	GDB             bool // build for tinygo gdb: keep a list of goroutines for runtime-gdb.py
+	HeapProfile     bool
+	AllocTrace      bool
+	ErrorTrace      bool
+	DeadlockTrace   bool // record what goroutines block on and print it on a deadlock
+	InterruptCheck  bool // panic on heap allocations, blocking and sleeping in interrupt handlers
+	StackCanary     bool // check canary words at the bottom of every stack on each context switch
+	ReadOnlyText    bool // make code and read-only data read-only with the MPU at startup
 	Tags            string
 	WasmAbi         string
 	GlobalValues    map[string]map[string]string // map[pkgpath]map[varname]value
 	TestConfig      TestConfig
 	Programmer      string
 	OpenOCDCommands []string
+	OCDTransport    string // override the OpenOCD transport (swd, jtag, ...)
+	OCDSpeed        uint32 // override the OpenOCD adapter speed in kHz
 	LLVMFeatures    string
+	Fmt             string
+	Args            []string // os.Args to bake into the image (baremetal only)
+	Env             []string // environment variables (KEY=VALUE) to bake into the image (baremetal only)
+	SettingsAddress string   // address of the settings region in flash (baremetal only)
+	HeapRegions     string   // heap regions of the target to use: all (the default), none, or a comma separated list of names
+	Parallelism     int      // number of compile jobs to run at the same time
+	TrimPath        bool     // remove file system paths from the output (reproducible builds)
+	Work            bool     // keep the temporary build directory and print its path
+	RAMReport       string   // print the worst-case RAM usage (none, text, json)
+	RAMCheck        bool     // fail the build if the worst-case RAM usage exceeds the RAM
+	HeapReserve     uint64   // heap space to include in the worst-case RAM usage
+	CrashLogSize    uint64   // size of the crash log in RAM that survives a reset (runtime/crashlog)
+	PrintRAMData    bool     // print initialized globals that are copied to RAM at startup
+	MCUboot         bool     // write a .bin or .hex file as an image for the MCUboot bootloader
+	ImageVersion    string   // version of the MCUboot image (major.minor.revision+build)
+	ImageKey        string   // PEM file with the private key to sign the MCUboot image with
+	FlashVerify     bool     // verify the flash contents after flashing
+	FlashErase      bool     // erase the entire chip before flashing
+	CompileCommands string   // path of a compile_commands.json file to write for the C files
+	BuildMode       string   // default (executable), c-archive (static library for a C program), c-shared (shared library), zephyr, freertos or customos (static library for a Zephyr, FreeRTOS or custom OS application)
+	TraceHooks      string   // none, itm or systemview: where to stream scheduler and interrupt events
+	Serial          string   // default (the serial console of the target) or itm (ITM stimulus port 0, over SWO)
+	CoreDump        string   // none or serial: where to write a core dump on a panic or fault
+	Arduino         bool     // compile and link the Arduino core of the board
+	ArduinoLibs     []string // Arduino libraries to compile and link, implies Arduino
 }
 
 // Verify performs a validation on the given options, raising an error if options are not valid.
@@ -59,6 +103,11 @@ func (o *Options) Verify() error {
 		}
 	}
 
+	if o.StackUsage && o.Scheduler != "" && o.Scheduler != "tasks" {
+		// Only the stacks of the tasks scheduler are painted and measured.
+		return fmt.Errorf("-stackusage is not supported with -scheduler=%s, use -scheduler=tasks", o.Scheduler)
+	}
+
 	if o.PrintSizes != "" {
 		valid := isInArray(validPrintSizeOptions, o.PrintSizes)
 		if !valid {
@@ -68,6 +117,12 @@ func (o *Options) Verify() error {
 		}
 	}
 
+	if o.RAMReport != "" {
+		if !isInArray(validRAMReportOptions, o.RAMReport) {
+			return fmt.Errorf("invalid -ram-report=%s: valid values are %s", o.RAMReport, strings.Join(validRAMReportOptions, ", "))
+		}
+	}
+
 	if o.PanicStrategy != "" {
 		valid := isInArray(validPanicStrategyOptions, o.PanicStrategy)
 		if !valid {
@@ -83,6 +138,61 @@ func (o *Options) Verify() error {
 		}
 	}
 
+	if o.Fmt != "" {
+		if !isInArray(validFmtOptions, o.Fmt) {
+			return fmt.Errorf("invalid -fmt=%s: valid values are %s", o.Fmt, strings.Join(validFmtOptions, ", "))
+		}
+	}
+
+	if o.BuildMode != "" {
+		if !isInArray(validBuildModeOptions, o.BuildMode) {
+			return fmt.Errorf("invalid -buildmode=%s: valid values are %s", o.BuildMode, strings.Join(validBuildModeOptions, ", "))
+		}
+	}
+
+	if o.TraceHooks != "" {
+		if !isInArray(validTraceHooksOptions, o.TraceHooks) {
+			return fmt.Errorf("invalid -trace-hooks=%s: valid values are %s", o.TraceHooks, strings.Join(validTraceHooksOptions, ", "))
+		}
+	}
+
+	if o.Serial != "" {
+		if !isInArray(validSerialOptions, o.Serial) {
+			return fmt.Errorf("invalid -serial=%s: valid values are %s", o.Serial, strings.Join(validSerialOptions, ", "))
+		}
+	}
+
+	if o.CoreDump != "" {
+		if !isInArray(validCoreDumpOptions, o.CoreDump) {
+			return fmt.Errorf("invalid -coredump=%s: valid values are %s", o.CoreDump, strings.Join(validCoreDumpOptions, ", "))
+		}
+	}
+
+	for _, arg := range o.Args {
+		if strings.IndexByte(arg, 0) >= 0 {
+			return fmt.Errorf("invalid -args: argument %q contains a NUL byte", arg)
+		}
+	}
+
+	for _, env := range o.Env {
+		if strings.IndexByte(env, '=') <= 0 || strings.IndexByte(env, 0) >= 0 {
+			return fmt.Errorf("invalid -env=%s: expected KEY=VALUE", env)
+		}
+	}
+
+	if o.SettingsAddress != "" {
+		// Only decimal and 0x prefixed hexadecimal addresses are accepted.
+		var err error
+		if strings.HasPrefix(o.SettingsAddress, "0x") || strings.HasPrefix(o.SettingsAddress, "0X") {
+			_, err = strconv.ParseUint(o.SettingsAddress[2:], 16, 64)
+		} else {
+			_, err = strconv.ParseUint(o.SettingsAddress, 10, 64)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid -settings-addr=%s: not a valid address", o.SettingsAddress)
+		}
+	}
+
 	return nil
 }
 
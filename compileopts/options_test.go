@@ -11,8 +11,12 @@ func TestVerifyOptions(t *testing.T) {
 
 	expectedGCError := errors.New(`invalid gc option 'incorrect': valid values are none, leaking, extalloc, conservative`)
 	expectedSchedulerError := errors.New(`invalid scheduler option 'incorrect': valid values are none, tasks, coroutines`)
-	expectedPrintSizeError := errors.New(`invalid size option 'incorrect': valid values are none, short, full`)
-	expectedPanicStrategyError := errors.New(`invalid panic option 'incorrect': valid values are print, trap`)
+	expectedPrintSizeError := errors.New(`invalid size option 'incorrect': valid values are none, short, full, symbols, json`)
+	expectedPanicStrategyError := errors.New(`invalid panic option 'incorrect': valid values are print, trap, trace`)
+	expectedFmtError := errors.New(`invalid -fmt=incorrect: valid values are full, light`)
+	expectedEnvError := errors.New(`invalid -env=FOO: expected KEY=VALUE`)
+	expectedSettingsAddressError := errors.New(`invalid -settings-addr=flash: not a valid address`)
+	expectedStackUsageError := errors.New(`-stackusage is not supported with -scheduler=coroutines, use -scheduler=tasks`)
 
 	testCases := []struct {
 		name          string
@@ -104,6 +108,18 @@ func TestVerifyOptions(t *testing.T) {
 				PrintSizes: "full",
 			},
 		},
+		{
+			name: "PrintSizeOptionSymbols",
+			opts: compileopts.Options{
+				PrintSizes: "symbols",
+			},
+		},
+		{
+			name: "PrintSizeOptionJSON",
+			opts: compileopts.Options{
+				PrintSizes: "json",
+			},
+		},
 		{
 			name: "InvalidPanicOption",
 			opts: compileopts.Options{
@@ -123,6 +139,67 @@ func TestVerifyOptions(t *testing.T) {
 				PanicStrategy: "trap",
 			},
 		},
+		{
+			name: "InvalidFmtOption",
+			opts: compileopts.Options{
+				Fmt: "incorrect",
+			},
+			expectedError: expectedFmtError,
+		},
+		{
+			name: "FmtOptionFull",
+			opts: compileopts.Options{
+				Fmt: "full",
+			},
+		},
+		{
+			name: "FmtOptionLight",
+			opts: compileopts.Options{
+				Fmt: "light",
+			},
+		},
+		{
+			name: "ArgsAndEnv",
+			opts: compileopts.Options{
+				Args: []string{"-verbose", "sensor"},
+				Env:  []string{"FOO=bar", "EMPTY="},
+			},
+		},
+		{
+			name: "InvalidEnv",
+			opts: compileopts.Options{
+				Env: []string{"FOO"},
+			},
+			expectedError: expectedEnvError,
+		},
+		{
+			name: "SettingsAddress",
+			opts: compileopts.Options{
+				SettingsAddress: "0x3f000",
+			},
+		},
+		{
+			name: "InvalidSettingsAddress",
+			opts: compileopts.Options{
+				SettingsAddress: "flash",
+			},
+			expectedError: expectedSettingsAddressError,
+		},
+		{
+			name: "StackUsageTasks",
+			opts: compileopts.Options{
+				StackUsage: true,
+				Scheduler:  "tasks",
+			},
+		},
+		{
+			name: "StackUsageCoroutines",
+			opts: compileopts.Options{
+				StackUsage: true,
+				Scheduler:  "coroutines",
+			},
+			expectedError: expectedStackUsageError,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -3,9 +3,11 @@ package compileopts
 // This file loads a target specification from a JSON file.
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -39,24 +41,77 @@ type TargetSpec struct {
 	CFlags           []string `json:"cflags"`
 	LDFlags          []string `json:"ldflags"`
 	LinkerScript     string   `json:"linkerscript"`
+	FlashOrigin      string   `json:"flash-origin"`      // start of the flash memory (default 0)
+	FlashSize        string   `json:"flash-size"`        // size of the flash memory, generate a linker script when set
+	RAMOrigin        string   `json:"ram-origin"`        // start of the RAM
+	RAMSize          string   `json:"ram-size"`          // size of the RAM
+	AppOffset        string   `json:"app-offset"`        // start of the application in flash, below it is the bootloader
+	RelocateVectors  *bool    `json:"relocate-vectors"`  // point VTOR at the vector table at startup (Cortex-M only)
+	SystemStackSize  string   `json:"system-stack-size"` // size of the system stack (default 2K)
 	ExtraFiles       []string `json:"extra-files"`
+	MergeHex         []string `json:"merge-hex"`
 	Emulator         []string `json:"emulator" override:"copy"` // inherited Emulator must not be append
 	FlashCommand     string   `json:"flash-command"`
+	EraseCommand     string   `json:"erase-command"` // command to erase the chip (and clear readout protection) with flash-method command
 	GDB              []string `json:"gdb"`
 	PortReset        string   `json:"flash-1200-bps-reset"`
+	SerialBaudRate   uint32   `json:"serial-baud-rate"` // baud rate of the serial console, used by tinygo monitor
 	FlashMethod      string   `json:"flash-method"`
 	FlashVolume      string   `json:"msd-volume-name"`
 	FlashFilename    string   `json:"msd-firmware-name"`
 	UF2FamilyID      string   `json:"uf2-family-id"`
+	UF2BaseAddress   string   `json:"uf2-base-address"` // start of the application in flash, below it is the bootloader
 	BinaryFormat     string   `json:"binary-format"`
+	ESPFlashMode     string   `json:"esp-flash-mode"` // SPI flash mode (qio, qout, dio, dout)
+	ESPFlashFreq     string   `json:"esp-flash-freq"` // SPI flash frequency (40m, 26m, 20m, 80m)
+	ESPFlashSize     string   `json:"esp-flash-size"` // SPI flash size (1MB, 2MB, 4MB, ...)
 	OpenOCDInterface string   `json:"openocd-interface"`
 	OpenOCDTarget    string   `json:"openocd-target"`
 	OpenOCDTransport string   `json:"openocd-transport"`
+	OpenOCDSpeed     uint32   `json:"openocd-speed"` // adapter speed in kHz
 	OpenOCDCommands  []string `json:"openocd-commands"`
+	OpenOCDErase     []string `json:"openocd-erase-commands" override:"copy"` // commands to erase the chip, possibly clearing readout protection
+	SWOTraceClock    uint32   `json:"swo-trace-clock"`                        // core clock in Hz when running the program, for SWO capture (-serial=itm)
 	JLinkDevice      string   `json:"jlink-device"`
+	JLinkInterface   string   `json:"jlink-interface"`
+	DFUDevice        string   `json:"dfu-device"`  // USB vendor and product ID of the DFU bootloader (vid:pid)
+	DFUAltSetting    uint32   `json:"dfu-alt"`     // alternate setting of the flash memory
+	DFUAddress       string   `json:"dfu-address"` // flash address for devices using the DfuSe extension (STM32)
+	RenodePlatform   string   `json:"renode-platform"`
+	RenodeUART       string   `json:"renode-uart"`
+	RenodeScript     []string `json:"renode-script"`
 	CodeModel        string   `json:"code-model"`
 	RelocationModel  string   `json:"relocation-model"`
 	WasmAbi          string   `json:"wasm-abi"`
+	BuildMode        string   `json:"build-mode"`      // default build mode, for targets that can't produce an executable
+	ArduinoCore      string   `json:"arduino-core"`    // directory of the Arduino core, relative to ARDUINO_DIR
+	ArduinoVariant   string   `json:"arduino-variant"` // directory of the Arduino board variant, relative to ARDUINO_DIR
+	ArduinoCFlags    []string `json:"arduino-cflags"`  // extra flags to compile the Arduino core, such as -DF_CPU=16000000L
+	OSPackage        string   `json:"os-package"`      // package that implements the OS backend of the customos runtime
+
+	// Extra RAM regions (such as CCM or DTCM RAM) that are added to the heap.
+	HeapRegions []HeapRegion `json:"heap-regions"`
+}
+
+// HeapRegion is a memory region that is used by the heap, in addition to the
+// RAM that remains after the data, BSS and stack sections have been placed by
+// the linker. The origin and size use the same syntax as the memory layout
+// properties (for example "0x10000000" and "64K"). Heap regions are only
+// supported by the conservative GC, and can be left out of the heap with the
+// -heap-regions flag.
+type HeapRegion struct {
+	Name   string `json:"name"`
+	Origin string `json:"origin"`
+	Size   string `json:"size"`
+
+	// The allocator tries regions with a higher priority first. The main heap
+	// has priority 0, so regions with a negative priority are only used when
+	// the main heap is full.
+	Priority int `json:"priority"`
+
+	// External memory (such as PSRAM or SDRAM) is only used after the program
+	// has initialized it with runtime/extmem.Init.
+	External bool `json:"external"`
 }
 
 // overrideProperties overrides all properties that are set in child into itself using reflection.
@@ -115,22 +170,53 @@ func (spec *TargetSpec) load(r io.Reader) error {
 
 // loadFromGivenStr loads the TargetSpec from the given string that could be:
 // - targets/ directory inside the compiler sources
+// - one of the directories listed in TINYGOTARGETS, which take precedence over
+//   the targets/ directory
 // - a relative or absolute path to custom (project specific) target specification .json file;
 //   the Inherits[] could contain the files from target folder (ex. stm32f4disco)
 //   as well as path to custom files (ex. myAwesomeProject.json)
+// The string {targetdir} in the file is replaced with the directory of the file,
+// so that custom targets can refer to their own linker scripts and other files.
 func (spec *TargetSpec) loadFromGivenStr(str string) error {
 	path := ""
 	if strings.HasSuffix(str, ".json") {
 		path, _ = filepath.Abs(str)
 	} else {
-		path = filepath.Join(goenv.Get("TINYGOROOT"), "targets", strings.ToLower(str)+".json")
+		path = FindTarget(str)
 	}
-	fp, err := os.Open(path)
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
 	}
-	defer fp.Close()
-	return spec.load(fp)
+	data = bytes.ReplaceAll(data, []byte("{targetdir}"), []byte(filepath.ToSlash(filepath.Dir(path))))
+	return spec.load(bytes.NewReader(data))
+}
+
+// TargetDirs returns the directories with target specifications, in order of
+// precedence: first the ones listed in TINYGOTARGETS and then the built-in
+// targets/ directory.
+func TargetDirs() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(goenv.Get("TINYGOTARGETS")) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return append(dirs, filepath.Join(goenv.Get("TINYGOROOT"), "targets"))
+}
+
+// FindTarget returns the path of the .json file of the given target name. If
+// the target doesn't exist, the path in the built-in targets/ directory is
+// returned.
+func FindTarget(name string) string {
+	dirs := TargetDirs()
+	for _, dir := range dirs {
+		path := filepath.Join(dir, strings.ToLower(name)+".json")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dirs[len(dirs)-1], strings.ToLower(name)+".json")
 }
 
 // resolveInherits loads inherited targets, recursively.
@@ -159,7 +245,7 @@ func (spec *TargetSpec) resolveInherits() error {
 
 // Load a target specification.
 func LoadTarget(target string) (*TargetSpec, error) {
-	if target == "" {
+	if target == "" || target == "simulator" {
 		// Configure based on GOOS/GOARCH environment variables (falling back to
 		// runtime.GOOS/runtime.GOARCH), and generate a LLVM target based on it.
 		goos := goenv.Get("GOOS")
@@ -173,11 +259,17 @@ func LoadTarget(target string) (*TargetSpec, error) {
 		if llvmarch == "" {
 			llvmarch = goarch
 		}
-		target = llvmarch + "--" + llvmos
+		triple := llvmarch + "--" + llvmos
 		if goarch == "arm" {
-			target += "-gnueabihf"
+			triple += "-gnueabihf"
+		}
+		spec, err := defaultTarget(goos, goarch, triple)
+		if err == nil && target == "simulator" {
+			// Run on the host, with simulated peripherals in the machine
+			// package.
+			spec.BuildTags = append(spec.BuildTags, "simulator")
 		}
-		return defaultTarget(goos, goarch, target)
+		return spec, err
 	}
 
 	// See whether there is a target specification for this target (e.g.
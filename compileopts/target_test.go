@@ -1,7 +1,11 @@
 package compileopts
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -84,3 +88,238 @@ func TestOverrideProperties(t *testing.T) {
 	}
 
 }
+
+func TestMemorySizes(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		flash  uint64
+		ram    uint64
+	}{
+		{"pca10040", 512 * 1024, 64 * 1024},
+		{"itsybitsy-m0", 0x40000 - 0x2000, 0x8000},
+		{"esp32", 0, 328 * 1024},
+		{"wasm", 0, 0},
+	} {
+		spec, err := LoadTarget(tc.target)
+		if err != nil {
+			t.Fatal("could not load target:", err)
+		}
+		flash, ram := spec.MemorySizes()
+		if flash != tc.flash || ram != tc.ram {
+			t.Errorf("%s: expected flash=%d ram=%d, got flash=%d ram=%d", tc.target, tc.flash, tc.ram, flash, ram)
+		}
+	}
+}
+
+func TestFlashRegion(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		origin uint64
+		size   uint64
+	}{
+		{"pca10040", 0, 512 * 1024},
+		{"itsybitsy-m0", 0x2000, 0x40000 - 0x2000},
+		{"itsybitsy-m4", 0x4000, 0x80000 - 0x4000},
+		{"wasm", 0, 0},
+	} {
+		spec, err := LoadTarget(tc.target)
+		if err != nil {
+			t.Fatal("could not load target:", err)
+		}
+		origin, size := spec.FlashRegion()
+		if origin != tc.origin || size != tc.size {
+			t.Errorf("%s: expected origin=%#x size=%#x, got origin=%#x size=%#x", tc.target, tc.origin, tc.size, origin, size)
+		}
+	}
+}
+
+func TestLinkerSections(t *testing.T) {
+	for _, tc := range []struct {
+		target  string
+		section string
+		found   bool
+		noLoad  bool
+	}{
+		{"nucleo-f722ze", ".dma", true, true},
+		{"nucleo-f722ze", ".itcm", true, false},
+		{"nucleo-f722ze", ".noinit", true, true},
+		{"nucleo-f722ze", ".noinit.buf", true, true},
+		{"nucleo-f722ze", ".ramfuncs", true, false},
+		{"nucleo-f722ze", ".bss.x", true, true},
+		{"nucleo-f722ze", ".sram2", false, false},
+		{"cortex-m-qemu", ".ramfuncs", true, false},
+		{"cortex-m-qemu", ".dma", false, false},
+		{"wasm", ".data", false, false},
+	} {
+		spec, err := LoadTarget(tc.target)
+		if err != nil {
+			t.Fatal("could not load target:", err)
+		}
+		section, found := FindLinkerSection(spec.LinkerSections(), tc.section)
+		if found != tc.found || section.NoLoad != tc.noLoad {
+			t.Errorf("%s: expected section %s found=%v noload=%v, got found=%v noload=%v", tc.target, tc.section, tc.found, tc.noLoad, found, section.NoLoad)
+		}
+	}
+}
+
+func TestEraseCommand(t *testing.T) {
+	// Recovering a chip erases everything, including a bootloader, so only
+	// boards that are flashed with a debug probe may have an erase command.
+	for _, tc := range []struct {
+		target  string
+		command string
+	}{
+		{"pca10031", "nrfjprog -f nrf51 --recover"},
+		{"pca10056", "nrfjprog -f nrf52 --recover"},
+		{"nrf52840", ""},
+		{"pca10059", ""},
+		{"feather-nrf52840", ""},
+	} {
+		spec, err := LoadTarget(tc.target)
+		if err != nil {
+			t.Fatal("could not load target:", err)
+		}
+		if spec.EraseCommand != tc.command {
+			t.Errorf("%s: expected erase command %q, got %q", tc.target, tc.command, spec.EraseCommand)
+		}
+	}
+}
+
+func TestGenerateLinkerScript(t *testing.T) {
+	spec, err := LoadTarget("atsamd21g18a")
+	if err != nil {
+		t.Fatal("could not load target:", err)
+	}
+	if !spec.HasMemoryLayout() {
+		t.Fatal("expected atsamd21g18a to have a memory layout")
+	}
+	script, err := spec.GenerateLinkerScript()
+	if err != nil {
+		t.Fatal("could not generate linker script:", err)
+	}
+	for _, line := range []string{
+		"FLASH_TEXT (rw) : ORIGIN = 0 + 0x2000, LENGTH = 256K - 0x2000",
+		"RAM (xrw)       : ORIGIN = 0x20000000, LENGTH = 32K",
+		"_stack_size = 2K;",
+		`INCLUDE "targets/arm.ld"`,
+	} {
+		if !strings.Contains(script, line) {
+			t.Errorf("generated linker script does not contain %q:\n%s", line, script)
+		}
+	}
+
+	spec.RAMSize = ""
+	if _, err := spec.GenerateLinkerScript(); err == nil {
+		t.Error("expected an error for a memory layout without RAM size")
+	}
+}
+
+func TestEvalLinkerExpr(t *testing.T) {
+	symbols := map[string]uint64{"__flash_size": 0x8000, "_bootloader_size": 512}
+	for _, tc := range []struct {
+		expr  string
+		value uint64
+		ok    bool
+	}{
+		{"64K", 64 * 1024, true},
+		{"32M", 32 * 1024 * 1024, true},
+		{"32K-96", 32*1024 - 96, true},
+		{"0x00000000+0x2000", 0x2000, true},
+		{"200K + 128K", 328 * 1024, true},
+		{"__flash_size - _bootloader_size", 0x8000 - 512, true},
+		{"ORIGIN(RAM) + LENGTH(RAM)", 0, false},
+		{"", 0, false},
+	} {
+		value, ok := evalLinkerExpr(tc.expr, symbols)
+		if value != tc.value || ok != tc.ok {
+			t.Errorf("%#v: expected %d (ok=%v), got %d (ok=%v)", tc.expr, tc.value, tc.ok, value, ok)
+		}
+	}
+}
+
+func TestHeapRegionLayout(t *testing.T) {
+	for _, tc := range []struct {
+		regions []HeapRegion
+		layout  string
+		err     string
+	}{
+		{nil, "", ""},
+		{
+			[]HeapRegion{{Name: "ccm", Origin: "0x10000000", Size: "64K", Priority: -1}},
+			"heap\x000x10000000-0x10010000", "",
+		},
+		{
+			[]HeapRegion{
+				{Name: "sram2", Origin: "0x2007c000", Size: "16K"},
+				{Name: "dtcm", Origin: "0x20000000", Size: "64K", Priority: 1},
+			},
+			"0x20000000-0x20010000\x00heap\x000x2007c000-0x20080000", "",
+		},
+		{
+			[]HeapRegion{
+				{Name: "psram", Origin: "0x3f800000", Size: "4M", Priority: -2, External: true},
+				{Name: "sram", Origin: "0x3ffe0000", Size: "64K", Priority: -1},
+			},
+			"heap\x000x3ffe0000-0x3fff0000\x00ext:0x3f800000-0x3fc00000", "",
+		},
+		{
+			[]HeapRegion{{Name: "itcm", Origin: "0", Size: "16K"}},
+			"", "heap region itcm: invalid origin \"0\"",
+		},
+		{
+			[]HeapRegion{{Name: "ccm", Origin: "0x10000000", Size: "0"}},
+			"", "heap region ccm: invalid size \"0\"",
+		},
+		{
+			[]HeapRegion{
+				{Name: "a", Origin: "0x10000000", Size: "64K"},
+				{Name: "b", Origin: "0x1000f000", Size: "4K"},
+			},
+			"", "heap region b overlaps with heap region a",
+		},
+	} {
+		spec := &TargetSpec{HeapRegions: tc.regions}
+		layout, err := spec.HeapRegionLayout()
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%v: expected error %q, got %v", tc.regions, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.regions, err)
+		} else if layout != tc.layout {
+			t.Errorf("%v: expected layout %q, got %q", tc.regions, tc.layout, layout)
+		}
+	}
+}
+
+func TestLoadTargetFromTargetDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinygo-targets")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "myboard.json"), []byte(`{
+	"inherits": ["arduino"],
+	"linkerscript": "{targetdir}/myboard.ld"
+}`), 0666)
+	if err != nil {
+		t.Fatal("could not write target file:", err)
+	}
+
+	oldTargets := os.Getenv("TINYGOTARGETS")
+	defer os.Setenv("TINYGOTARGETS", oldTargets)
+	os.Setenv("TINYGOTARGETS", dir)
+
+	spec, err := LoadTarget("MyBoard")
+	if err != nil {
+		t.Fatal("could not load custom target:", err)
+	}
+	if spec.CPU != "atmega328p" {
+		t.Errorf("custom target did not inherit CPU: got %q", spec.CPU)
+	}
+	if expected := filepath.ToSlash(dir) + "/myboard.ld"; spec.LinkerScript != expected {
+		t.Errorf("expected linker script %q, got %q", expected, spec.LinkerScript)
+	}
+}
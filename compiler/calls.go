@@ -1,8 +1,10 @@
 package compiler
 
 import (
+	"go/token"
 	"go/types"
 	"strconv"
+	"strings"
 
 	"golang.org/x/tools/go/ssa"
 	"tinygo.org/x/go-llvm"
@@ -295,3 +297,59 @@ func (b *builder) collapseFormalParamInternal(t llvm.Type, fields []llvm.Value)
 		return fields[0], fields[1:]
 	}
 }
+
+// createCVariadicArgs returns the values passed in the ...interface{} parameter
+// of a variadic C function (such as printf), as they would be passed by a C
+// compiler. C applies the default argument promotions to variadic arguments:
+// bool and integers smaller than int are extended to int and float is passed
+// as double. Note that int is 16 bits and double is 32 bits on AVR, so there a
+// float64 is truncated instead. Other types are passed unchanged, the backend
+// takes care of the calling convention (for example, aligning 64-bit values to
+// an even register pair on ARM).
+func (b *builder) createCVariadicArgs(slice ssa.Value, pos token.Pos) ([]llvm.Value, error) {
+	values, ok := variadicInterfaceArgs(b.currentBlock, slice)
+	if !ok {
+		return nil, b.makeError(pos, "variadic arguments of a C function must be passed directly, not as a slice")
+	}
+	intType := b.ctx.Int32Type()
+	doubleType := b.ctx.DoubleType()
+	if strings.HasPrefix(b.Triple, "avr") {
+		intType = b.ctx.Int16Type()
+		doubleType = b.ctx.FloatType()
+	}
+	args := make([]llvm.Value, len(values))
+	for i, value := range values {
+		arg := b.getValue(value)
+		switch typ := value.Type().Underlying().(type) {
+		case *types.Basic:
+			info := typ.Info()
+			switch {
+			case info&types.IsBoolean != 0:
+				arg = b.CreateZExt(arg, intType, "")
+			case info&types.IsInteger != 0:
+				if arg.Type().IntTypeWidth() >= intType.IntTypeWidth() {
+					break
+				}
+				if info&types.IsUnsigned != 0 {
+					arg = b.CreateZExt(arg, intType, "")
+				} else {
+					arg = b.CreateSExt(arg, intType, "")
+				}
+			case typ.Kind() == types.Float32 && doubleType.TypeKind() == llvm.DoubleTypeKind:
+				arg = b.CreateFPExt(arg, doubleType, "")
+			case typ.Kind() == types.Float64 && doubleType.TypeKind() == llvm.FloatTypeKind:
+				arg = b.CreateFPTrunc(arg, doubleType, "")
+			case info&types.IsFloat != 0, typ.Kind() == types.UnsafePointer:
+				// Passed unchanged.
+			default:
+				return nil, b.makeError(pos, "unsupported type for variadic argument of a C function: "+value.Type().String())
+			}
+		case *types.Pointer:
+			// Passed unchanged.
+		default:
+			return nil, b.makeError(pos, "unsupported type for variadic argument of a C function: "+value.Type().String())
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
@@ -14,6 +14,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/tinygo-org/tinygo/compileopts"
 	"github.com/tinygo-org/tinygo/compiler/llvmutil"
 	"github.com/tinygo-org/tinygo/loader"
 	"golang.org/x/tools/go/ssa"
@@ -60,6 +61,17 @@ type Config struct {
 	NeedsStackObjects  bool
 	Debug              bool // Whether to emit debug information in the LLVM module.
 	LLVMFeatures       string
+	LightweightFmt     bool // Lower simple fmt calls to print calls (-fmt=light).
+	Coverage           bool // Instrument basic blocks for code coverage (-cover).
+	FramePointers      bool // Keep the frame pointer in all functions (-errortrace).
+
+	// File system path prefixes to replace in debug information, for
+	// reproducible builds (-trimpath).
+	PathPrefixMap map[string]string
+
+	// Input sections placed by the linker script of the target, to check the
+	// //go:section pragmas against. They are not checked if this is empty.
+	LinkerSections []compileopts.LinkerSection
 }
 
 // compilerContext contains function-independent data that should still be
@@ -83,7 +95,10 @@ type compilerContext struct {
 	program          *ssa.Program
 	diagnostics      []error
 	astComments      map[string]*ast.CommentGroup
+	embedGlobals     map[string][]*loader.EmbedFile
 	runtimePkg       *types.Package
+	coverageCounters []llvm.Value // placeholder globals, see createCoverageCounter
+	coverageBlocks   []string     // description of each coverage counter
 }
 
 // newCompilerContext returns a new compiler context ready for use, most
@@ -150,6 +165,10 @@ type builder struct {
 	deferExprFuncs    map[ssa.Value]int
 	selectRecvBuf     map[*ssa.Select]llvm.Value
 	deferBuiltinFuncs map[ssa.Value]deferBuiltin
+	openDeferBits     llvm.Value // bitmask of executed defer statements, if defers are open-coded
+	openDeferIndex    map[*ssa.Defer]int
+	openDefers        []openDefer
+	openDeferRuns     []openDeferRun
 }
 
 func newBuilder(c *compilerContext, irbuilder llvm.Builder, f *ssa.Function) *builder {
@@ -275,6 +294,10 @@ func CompilePackage(moduleName string, pkg *loader.Package, ssaPkg *ssa.Package,
 
 	// Load comments such as //go:extern on globals.
 	c.loadASTComments(pkg)
+	c.checkLinknames(pkg)
+	c.checkPragmas(pkg)
+	c.checkSections(ssaPkg)
+	c.embedGlobals = pkg.EmbedGlobals
 
 	// Predeclare the runtime.alloc function, which is used by the wordpack
 	// functionality.
@@ -284,6 +307,7 @@ func CompilePackage(moduleName string, pkg *loader.Package, ssaPkg *ssa.Package,
 	irbuilder := c.ctx.NewBuilder()
 	defer irbuilder.Dispose()
 	c.createPackage(irbuilder, ssaPkg)
+	c.createCoverageTables(pkg.Pkg.Path())
 
 	// see: https://reviews.llvm.org/D18355
 	if c.Debug {
@@ -681,7 +705,7 @@ func (c *compilerContext) attachDebugInfoRaw(f *ssa.Function, llvmFn llvm.Value,
 // one.
 func (c *compilerContext) getDIFile(filename string) llvm.Metadata {
 	if _, ok := c.difiles[filename]; !ok {
-		dir, file := filepath.Split(filename)
+		dir, file := filepath.Split(c.trimPath(filename))
 		if dir != "" {
 			dir = dir[:len(dir)-1]
 		}
@@ -690,6 +714,25 @@ func (c *compilerContext) getDIFile(filename string) llvm.Metadata {
 	return c.difiles[filename]
 }
 
+// trimPath replaces the longest prefix of filename that is listed in
+// PathPrefixMap with its replacement. It returns filename unmodified if there
+// is no such prefix.
+func (c *compilerContext) trimPath(filename string) string {
+	longest := ""
+	for prefix := range c.PathPrefixMap {
+		if len(prefix) <= len(longest) {
+			continue
+		}
+		if filename == prefix || strings.HasPrefix(filename, prefix+string(filepath.Separator)) {
+			longest = prefix
+		}
+	}
+	if longest == "" {
+		return filename
+	}
+	return filepath.Join(c.PathPrefixMap[longest], filename[len(longest):])
+}
+
 // createPackage builds the LLVM IR for all types, methods, and global variables
 // in the given package.
 func (c *compilerContext) createPackage(irbuilder llvm.Builder, pkg *ssa.Package) {
@@ -760,7 +803,11 @@ func (c *compilerContext) createPackage(irbuilder llvm.Builder, pkg *ssa.Package
 			info := c.getGlobalInfo(member)
 			if !info.extern {
 				global := c.getGlobal(member)
-				global.SetInitializer(llvm.ConstNull(global.Type().ElementType()))
+				if files, ok := c.embedGlobals[member.Name()]; ok {
+					c.createEmbedGlobal(member, global, files)
+				} else {
+					global.SetInitializer(llvm.ConstNull(global.Type().ElementType()))
+				}
 				global.SetVisibility(llvm.HiddenVisibility)
 			}
 		}
@@ -806,6 +853,12 @@ func (b *builder) createFunction() {
 		b.llvmFn.AddFunctionAttr(noinline)
 	}
 
+	if b.FramePointers {
+		// Used to follow the call chain when an error is created, see
+		// src/internal/errortrace.
+		b.llvmFn.AddFunctionAttr(b.ctx.CreateStringAttribute("frame-pointer", "all"))
+	}
+
 	// Add debug info, if needed.
 	if b.Debug {
 		if b.fn.Synthetic == "package initializer" {
@@ -896,13 +949,20 @@ func (b *builder) createFunction() {
 	}
 
 	// Fill blocks with instructions.
+	cover := b.shouldCover()
 	for _, block := range b.fn.DomPreorder() {
 		if b.DumpSSA {
 			fmt.Printf("%d: %s:\n", block.Index, block.Comment)
 		}
 		b.SetInsertPointAtEnd(b.blockEntries[block])
 		b.currentBlock = block
+		needsCoverageCounter := cover
 		for _, instr := range block.Instrs {
+			if _, ok := instr.(*ssa.Phi); !ok && needsCoverageCounter {
+				// Insert the coverage counter after all phi nodes.
+				b.createCoverageCounter(block)
+				needsCoverageCounter = false
+			}
 			if instr, ok := instr.(*ssa.DebugRef); ok {
 				if !b.Debug {
 					continue
@@ -941,6 +1001,11 @@ func (b *builder) createFunction() {
 		}
 	}
 
+	// Create the deferred calls, now that all defer statements are known.
+	if !b.openDeferBits.IsNil() {
+		b.createOpenDeferRuns()
+	}
+
 	// Resolve phi nodes
 	for _, phi := range b.phis {
 		block := phi.ssa.Block()
@@ -1128,7 +1193,7 @@ func (b *builder) createInstruction(instr ssa.Instruction) {
 			b.CreateRet(retVal)
 		}
 	case *ssa.RunDefers:
-		b.createRunDefers()
+		b.createRunDefers(instr)
 	case *ssa.Send:
 		b.createChanSend(instr)
 	case *ssa.Store:
@@ -1325,6 +1390,7 @@ func (b *builder) createFunctionCall(instr *ssa.CallCommon) (llvm.Value, error)
 	// Try to call the function directly for trivially static calls.
 	var callee, context llvm.Value
 	exported := false
+	cVariadic := false
 	if fn := instr.StaticCallee(); fn != nil {
 		// Direct function call, either to a named or anonymous (directly
 		// applied) function call. If it is anonymous, it may be a closure.
@@ -1338,13 +1404,17 @@ func (b *builder) createFunctionCall(instr *ssa.CallCommon) (llvm.Value, error)
 			return b.createInlineAsm(instr.Args)
 		case name == "device.AsmFull" || name == "device/arm.AsmFull" || name == "device/arm64.AsmFull" || name == "device/avr.AsmFull" || name == "device/riscv.AsmFull":
 			return b.createInlineAsmFull(instr)
+		case name == "device.AsmExt" || name == "device/arm.AsmExt" || name == "device/arm64.AsmExt" || name == "device/avr.AsmExt" || name == "device/riscv.AsmExt":
+			return b.createInlineAsmExt(instr, true)
+		case name == "device.AsmExtPure" || name == "device/arm.AsmExtPure" || name == "device/arm64.AsmExtPure" || name == "device/avr.AsmExtPure" || name == "device/riscv.AsmExtPure":
+			return b.createInlineAsmExt(instr, false)
 		case strings.HasPrefix(name, "device/arm.SVCall"):
 			return b.emitSVCall(instr.Args)
 		case strings.HasPrefix(name, "device/arm64.SVCall"):
 			return b.emitSV64Call(instr.Args)
 		case strings.HasPrefix(name, "(device/riscv.CSR)."):
 			return b.emitCSROperation(instr)
-		case strings.HasPrefix(name, "syscall.Syscall"):
+		case isSyscallFunction(fn):
 			return b.createSyscall(instr)
 		case strings.HasPrefix(name, "runtime/volatile.Load"):
 			return b.createVolatileLoad(instr)
@@ -1380,6 +1450,7 @@ func (b *builder) createFunctionCall(instr *ssa.CallCommon) (llvm.Value, error)
 			panic("StaticCallee returned an unexpected value")
 		}
 		exported = info.exported
+		cVariadic = info.variadic && fn.Signature.Variadic()
 	} else if call, ok := instr.Value.(*ssa.Builtin); ok {
 		// Builtin function (append, close, delete, etc.).)
 		var argTypes []types.Type
@@ -1398,10 +1469,22 @@ func (b *builder) createFunctionCall(instr *ssa.CallCommon) (llvm.Value, error)
 		b.createNilCheck(instr.Value, callee, "fpcall")
 	}
 
+	args := instr.Args
+	if cVariadic {
+		// The last argument holds the variadic arguments of a C function.
+		args = args[:len(args)-1]
+	}
 	var params []llvm.Value
-	for _, param := range instr.Args {
+	for _, param := range args {
 		params = append(params, b.getValue(param))
 	}
+	if cVariadic {
+		varargs, err := b.createCVariadicArgs(instr.Args[len(instr.Args)-1], instr.Pos())
+		if err != nil {
+			return llvm.Value{}, err
+		}
+		params = append(params, varargs...)
+	}
 
 	if !exported {
 		// This function takes a context parameter.
@@ -1480,6 +1563,11 @@ func (b *builder) createExpr(expr ssa.Value) (llvm.Value, error) {
 		y := b.getValue(expr.Y)
 		return b.createBinOp(expr.Op, expr.X.Type(), expr.Y.Type(), x, y, expr.Pos())
 	case *ssa.Call:
+		if b.LightweightFmt {
+			if value, ok := b.createLightweightFmtCall(expr); ok {
+				return value, nil
+			}
+		}
 		return b.createFunctionCall(expr.Common())
 	case *ssa.ChangeInterface:
 		// Do not change between interface types: always use the underlying
@@ -2687,7 +2775,14 @@ func (b *builder) createUnOp(unop *ssa.UnOp) (llvm.Value, error) {
 			// function pointer itself.
 			globalName := b.getGlobalInfo(unop.X.(*ssa.Global)).linkName
 			name := globalName[:len(globalName)-len("$funcaddr")]
-			fn := b.getFunction(b.fn.Pkg.Members["C."+name].(*ssa.Function))
+			var fn llvm.Value
+			if member, ok := b.fn.Pkg.Members["C."+name].(*ssa.Function); ok {
+				fn = b.getFunction(member)
+			} else if member := b.getExportedFunction(name); member != nil {
+				// Go function exported with //export that is not declared
+				// in the CGo preamble.
+				fn = b.getFunction(member)
+			}
 			if fn.IsNil() {
 				return llvm.Value{}, b.makeError(unop.Pos(), "cgo function not found: "+name)
 			}
@@ -63,6 +63,8 @@ func TestCompiler(t *testing.T) {
 		"float.go",
 		"interface.go",
 		"func.go",
+		"pragma.go",
+		"inlineasm.go",
 	}
 
 	for _, testCase := range tests {
@@ -0,0 +1,115 @@
+package compiler
+
+// This file implements code coverage instrumentation (tinygo test -cover).
+//
+// Every basic block in the instrumented package gets a counter, which is set
+// at the start of the block. The counters of a package are stored in a single
+// array, together with a table that describes the source range of each block.
+// The runtime prints both at the end of a test run (in the coverage profile
+// format used by the go tool), so that the host can build a coverage report
+// from the program output. This also works when the output comes from a
+// serial port, for tests running on real hardware.
+
+import (
+	"fmt"
+	"go/token"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// Names of the globals with the coverage counters and the coverage block table
+// of an instrumented package, relative to the package path.
+const (
+	coverageCountersSuffix = "$coverage.counters"
+	coverageBlocksSuffix   = "$coverage.blocks"
+)
+
+// CoverageGlobalNames returns the names of the global with the coverage counters
+// ([n x i8]) and the global with the block table ([m x i8], one line per
+// counter) for the given package.
+func CoverageGlobalNames(pkgPath string) (counters, blocks string) {
+	return pkgPath + coverageCountersSuffix, pkgPath + coverageBlocksSuffix
+}
+
+// shouldCover returns whether the basic blocks of this function should be
+// instrumented. Only functions that appear in the source code are instrumented,
+// and tests themselves are left alone.
+func (b *builder) shouldCover() bool {
+	if !b.Coverage || b.fn.Synthetic != "" || b.fn.Syntax() == nil {
+		return false
+	}
+	file := b.program.Fset.File(b.fn.Pos())
+	return file != nil && !strings.HasSuffix(file.Name(), "_test.go")
+}
+
+// createCoverageCounter inserts a coverage counter for the given block at the
+// current insert position. The block is described by the range of source
+// positions of its instructions, where the number of source lines is used as
+// the number of statements. Blocks without any position information (such as
+// the blocks that run deferred calls) are not instrumented.
+func (b *builder) createCoverageCounter(block *ssa.BasicBlock) {
+	var start, end token.Position
+	lines := make(map[int]struct{})
+	for _, instr := range block.Instrs {
+		if !instr.Pos().IsValid() {
+			continue
+		}
+		pos := b.program.Fset.Position(instr.Pos())
+		if start.Filename == "" {
+			start, end = pos, pos
+		}
+		if pos.Filename != start.Filename {
+			continue
+		}
+		if pos.Line < start.Line || pos.Line == start.Line && pos.Column < start.Column {
+			start = pos
+		}
+		if pos.Line > end.Line || pos.Line == end.Line && pos.Column > end.Column {
+			end = pos
+		}
+		lines[pos.Line] = struct{}{}
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	// Describe this block in the same way as lines in a coverage profile.
+	filename := b.fn.Pkg.Pkg.Path() + "/" + filepath.Base(start.Filename)
+	b.coverageBlocks = append(b.coverageBlocks, fmt.Sprintf("%s:%d.%d,%d.%d %d", filename, start.Line, start.Column, end.Line, end.Column+1, len(lines)))
+
+	// Create a placeholder global for the counter. It is replaced with an
+	// element of the counters array once all functions have been created.
+	counter := llvm.AddGlobal(b.mod, b.ctx.Int8Type(), "coverage.counter")
+	b.coverageCounters = append(b.coverageCounters, counter)
+	b.CreateStore(llvm.ConstInt(b.ctx.Int8Type(), 1, false), counter)
+}
+
+// createCoverageTables creates the counters array and the block table for the
+// current package, and replaces the placeholder counter globals with elements
+// of the counters array.
+func (c *compilerContext) createCoverageTables(pkgPath string) {
+	if len(c.coverageCounters) == 0 {
+		return
+	}
+	countersName, blocksName := CoverageGlobalNames(pkgPath)
+	countersType := llvm.ArrayType(c.ctx.Int8Type(), len(c.coverageCounters))
+	counters := llvm.AddGlobal(c.mod, countersType, countersName)
+	counters.SetInitializer(llvm.ConstNull(countersType))
+	counters.SetVisibility(llvm.HiddenVisibility)
+	zero := llvm.ConstInt(c.ctx.Int32Type(), 0, false)
+	for i, placeholder := range c.coverageCounters {
+		index := llvm.ConstInt(c.ctx.Int32Type(), uint64(i), false)
+		placeholder.ReplaceAllUsesWith(llvm.ConstInBoundsGEP(counters, []llvm.Value{zero, index}))
+		placeholder.EraseFromParentAsGlobal()
+	}
+
+	blocksInitializer := c.ctx.ConstString(strings.Join(c.coverageBlocks, "\n"), false)
+	blocks := llvm.AddGlobal(c.mod, blocksInitializer.Type(), blocksName)
+	blocks.SetInitializer(blocksInitializer)
+	blocks.SetGlobalConstant(true)
+	blocks.SetAlignment(1)
+	blocks.SetVisibility(llvm.HiddenVisibility)
+}
@@ -12,9 +12,18 @@ package compiler
 //   * On return, runtime.rundefers is called which calls all deferred functions
 //     from the head of the linked list until it has gone through all defer
 //     frames.
+//
+// Most functions only have a few defer statements, none of which are in a
+// loop. In that case the defers are open-coded instead, which is a lot cheaper:
+//   * Every defer statement has its own defer frame in the entry block, and a
+//     bit in a bitmask (also in the entry block) that is set when the defer
+//     statement is executed.
+//   * On return, the bit of every defer statement is checked in reverse order,
+//     and the deferred function is called directly if it is set.
 
 import (
 	"go/types"
+	"sort"
 
 	"github.com/tinygo-org/tinygo/compiler/llvmutil"
 	"golang.org/x/tools/go/ssa"
@@ -32,12 +41,85 @@ func (b *builder) deferInitFunc() {
 	b.deferExprFuncs = make(map[ssa.Value]int)
 	b.deferBuiltinFuncs = make(map[ssa.Value]deferBuiltin)
 
+	if sites := openDeferSites(b.fn); sites != nil {
+		// Create the bitmask of defer statements that have been executed.
+		b.openDeferIndex = make(map[*ssa.Defer]int)
+		for i, site := range sites {
+			b.openDeferIndex[site] = i
+		}
+		b.openDefers = make([]openDefer, len(sites))
+		b.openDeferBits = b.CreateAlloca(b.ctx.Int8Type(), "deferBits")
+		b.CreateStore(llvm.ConstInt(b.ctx.Int8Type(), 0, false), b.openDeferBits)
+		return
+	}
+
 	// Create defer list pointer.
 	deferType := llvm.PointerType(b.getLLVMRuntimeType("_defer"), 0)
 	b.deferPtr = b.CreateAlloca(deferType, "deferPtr")
 	b.CreateStore(llvm.ConstPointerNull(deferType), b.deferPtr)
 }
 
+// maxOpenDefers is the maximum number of defer statements in a function with
+// open-coded defers: one for every bit in the bitmask.
+const maxOpenDefers = 8
+
+// openDefer is a single defer statement in a function with open-coded defers.
+type openDefer struct {
+	callback interface{} // deferred function, like in allDeferFuncs
+	frame    llvm.Value  // alloca with the defer frame
+}
+
+// openDeferRun is a RunDefers instruction in a function with open-coded
+// defers. The deferred calls are only created once all defer statements have
+// been compiled, between the start and end blocks.
+type openDeferRun struct {
+	instr      *ssa.RunDefers
+	start, end llvm.BasicBlock
+}
+
+// openDeferSites returns the defer statements of the function in the order in
+// which they may be executed, or nil if the defers of this function cannot be
+// open-coded. This is the case when there are too many of them or when a defer
+// statement is in a loop, so that it may be executed a variable number of
+// times.
+func openDeferSites(fn *ssa.Function) []*ssa.Defer {
+	// Number the blocks in postorder. Because none of the defer statements is
+	// in a loop, a defer statement that is executed before another is always
+	// in a block with a higher number (or in the same block).
+	visited := make(map[*ssa.BasicBlock]bool)
+	postorder := make(map[*ssa.BasicBlock]int)
+	var visit func(block *ssa.BasicBlock)
+	visit = func(block *ssa.BasicBlock) {
+		visited[block] = true
+		for _, succ := range block.Succs {
+			if !visited[succ] {
+				visit(succ)
+			}
+		}
+		postorder[block] = len(postorder)
+	}
+	visit(fn.Blocks[0])
+
+	var sites []*ssa.Defer
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			if instr, ok := instr.(*ssa.Defer); ok {
+				if isInLoop(block) {
+					return nil
+				}
+				sites = append(sites, instr)
+			}
+		}
+	}
+	if len(sites) > maxOpenDefers {
+		return nil
+	}
+	sort.SliceStable(sites, func(i, j int) bool {
+		return postorder[sites[i].Block()] > postorder[sites[j].Block()]
+	})
+	return sites
+}
+
 // isInLoop checks if there is a path from a basic block to itself.
 func isInLoop(start *ssa.BasicBlock) bool {
 	// Use a breadth-first search to scan backwards through the block graph.
@@ -76,9 +158,15 @@ func isInLoop(start *ssa.BasicBlock) bool {
 // returns.
 func (b *builder) createDefer(instr *ssa.Defer) {
 	// The pointer to the previous defer struct, which we will replace to
-	// make a linked list.
-	next := b.CreateLoad(b.deferPtr, "defer.next")
+	// make a linked list. Open-coded defers are not part of a linked list.
+	var next llvm.Value
+	if b.openDeferBits.IsNil() {
+		next = b.CreateLoad(b.deferPtr, "defer.next")
+	} else {
+		next = llvm.ConstPointerNull(llvm.PointerType(b.getLLVMRuntimeType("_defer"), 0))
+	}
 
+	var callbackIndex int
 	var values []llvm.Value
 	valueTypes := []llvm.Type{b.uintptrType, next.Type()}
 	if instr.Call.IsInvoke() {
@@ -90,7 +178,8 @@ func (b *builder) createDefer(instr *ssa.Defer) {
 			b.deferInvokeFuncs[methodName] = len(b.allDeferFuncs)
 			b.allDeferFuncs = append(b.allDeferFuncs, &instr.Call)
 		}
-		callback := llvm.ConstInt(b.uintptrType, uint64(b.deferInvokeFuncs[methodName]), false)
+		callbackIndex = b.deferInvokeFuncs[methodName]
+		callback := llvm.ConstInt(b.uintptrType, uint64(callbackIndex), false)
 
 		// Collect all values to be put in the struct (starting with
 		// runtime._defer fields, followed by the call parameters).
@@ -111,7 +200,8 @@ func (b *builder) createDefer(instr *ssa.Defer) {
 			b.deferFuncs[callee] = len(b.allDeferFuncs)
 			b.allDeferFuncs = append(b.allDeferFuncs, callee)
 		}
-		callback := llvm.ConstInt(b.uintptrType, uint64(b.deferFuncs[callee]), false)
+		callbackIndex = b.deferFuncs[callee]
+		callback := llvm.ConstInt(b.uintptrType, uint64(callbackIndex), false)
 
 		// Collect all values to be put in the struct (starting with
 		// runtime._defer fields).
@@ -138,7 +228,8 @@ func (b *builder) createDefer(instr *ssa.Defer) {
 			b.deferClosureFuncs[fn] = len(b.allDeferFuncs)
 			b.allDeferFuncs = append(b.allDeferFuncs, makeClosure)
 		}
-		callback := llvm.ConstInt(b.uintptrType, uint64(b.deferClosureFuncs[fn]), false)
+		callbackIndex = b.deferClosureFuncs[fn]
+		callback := llvm.ConstInt(b.uintptrType, uint64(callbackIndex), false)
 
 		// Collect all values to be put in the struct (starting with
 		// runtime._defer fields, followed by all parameters including the
@@ -169,7 +260,8 @@ func (b *builder) createDefer(instr *ssa.Defer) {
 			}
 			b.allDeferFuncs = append(b.allDeferFuncs, instr.Call.Value)
 		}
-		callback := llvm.ConstInt(b.uintptrType, uint64(b.deferBuiltinFuncs[instr.Call.Value].callback), false)
+		callbackIndex = b.deferBuiltinFuncs[instr.Call.Value].callback
+		callback := llvm.ConstInt(b.uintptrType, uint64(callbackIndex), false)
 
 		// Collect all values to be put in the struct (starting with
 		// runtime._defer fields).
@@ -187,7 +279,8 @@ func (b *builder) createDefer(instr *ssa.Defer) {
 			b.allDeferFuncs = append(b.allDeferFuncs, &instr.Call)
 		}
 
-		callback := llvm.ConstInt(b.uintptrType, uint64(b.deferExprFuncs[instr.Call.Value]), false)
+		callbackIndex = b.deferExprFuncs[instr.Call.Value]
+		callback := llvm.ConstInt(b.uintptrType, uint64(callbackIndex), false)
 
 		// Collect all values to be put in the struct (starting with
 		// runtime._defer fields, followed by all parameters including the
@@ -208,6 +301,25 @@ func (b *builder) createDefer(instr *ssa.Defer) {
 		deferFrame = b.CreateInsertValue(deferFrame, value, i, "")
 	}
 
+	if !b.openDeferBits.IsNil() {
+		// Open-coded defer: store the defer frame in its own alloca and mark
+		// this defer statement as executed.
+		index := b.openDeferIndex[instr]
+		alloca := llvmutil.CreateEntryBlockAlloca(b.Builder, deferFrameType, "defer.alloca")
+		if b.NeedsStackObjects {
+			b.trackPointer(alloca)
+		}
+		b.CreateStore(deferFrame, alloca)
+		b.openDefers[index] = openDefer{
+			callback: b.allDeferFuncs[callbackIndex],
+			frame:    alloca,
+		}
+		bits := b.CreateLoad(b.openDeferBits, "defer.bits")
+		bits = b.CreateOr(bits, llvm.ConstInt(b.ctx.Int8Type(), 1<<uint(index), false), "")
+		b.CreateStore(bits, b.openDeferBits)
+		return
+	}
+
 	// Put this struct in an allocation.
 	var alloca llvm.Value
 	if !isInLoop(instr.Block()) {
@@ -231,7 +343,18 @@ func (b *builder) createDefer(instr *ssa.Defer) {
 }
 
 // createRunDefers emits code to run all deferred functions.
-func (b *builder) createRunDefers() {
+func (b *builder) createRunDefers(instr *ssa.RunDefers) {
+	if !b.openDeferBits.IsNil() {
+		// Not all defer statements may have been compiled yet, so the
+		// deferred calls are created later in createOpenDeferRuns.
+		start := b.ctx.AddBasicBlock(b.llvmFn, "rundefers.open")
+		end := b.ctx.AddBasicBlock(b.llvmFn, "rundefers.end")
+		b.CreateBr(start)
+		b.openDeferRuns = append(b.openDeferRuns, openDeferRun{instr, start, end})
+		b.SetInsertPointAtEnd(end)
+		return
+	}
+
 	// Add a loop like the following:
 	//     for stack != nil {
 	//         _stack := stack
@@ -286,170 +409,219 @@ func (b *builder) createRunDefers() {
 		block := b.ctx.AddBasicBlock(b.llvmFn, "rundefers.callback")
 		sw.AddCase(llvm.ConstInt(b.uintptrType, uint64(i), false), block)
 		b.SetInsertPointAtEnd(block)
-		switch callback := callback.(type) {
-		case *ssa.CallCommon:
-			// Call on an value or interface value.
-
-			// Get the real defer struct type and cast to it.
-			valueTypes := []llvm.Type{b.uintptrType, llvm.PointerType(b.getLLVMRuntimeType("_defer"), 0)}
-
-			if !callback.IsInvoke() {
-				//Expect funcValue to be passed through the defer frame.
-				valueTypes = append(valueTypes, b.getFuncType(callback.Signature()))
-			} else {
-				//Expect typecode
-				valueTypes = append(valueTypes, b.uintptrType, b.i8ptrType)
-			}
+		b.createDeferredCall(callback, deferData)
 
-			for _, arg := range callback.Args {
-				valueTypes = append(valueTypes, b.getLLVMType(arg.Type()))
-			}
+		// Branch back to the start of the loop.
+		b.CreateBr(loophead)
+	}
 
-			deferFrameType := b.ctx.StructType(valueTypes, false)
-			deferFramePtr := b.CreateBitCast(deferData, llvm.PointerType(deferFrameType, 0), "deferFrame")
+	// Create default unreachable block:
+	//     default:
+	//         unreachable
+	//     }
+	b.SetInsertPointAtEnd(unreachable)
+	b.CreateUnreachable()
 
-			// Extract the params from the struct (including receiver).
-			forwardParams := []llvm.Value{}
-			zero := llvm.ConstInt(b.ctx.Int32Type(), 0, false)
-			for i := 2; i < len(valueTypes); i++ {
-				gep := b.CreateInBoundsGEP(deferFramePtr, []llvm.Value{zero, llvm.ConstInt(b.ctx.Int32Type(), uint64(i), false)}, "gep")
-				forwardParam := b.CreateLoad(gep, "param")
-				forwardParams = append(forwardParams, forwardParam)
-			}
+	// End of loop.
+	b.SetInsertPointAtEnd(end)
+}
 
-			var fnPtr llvm.Value
-
-			if !callback.IsInvoke() {
-				// Isolate the func value.
-				funcValue := forwardParams[0]
-				forwardParams = forwardParams[1:]
-
-				//Get function pointer and context
-				fp, context := b.decodeFuncValue(funcValue, callback.Signature())
-				fnPtr = fp
-
-				//Pass context
-				forwardParams = append(forwardParams, context)
-			} else {
-				// Isolate the typecode.
-				typecode := forwardParams[0]
-				forwardParams = forwardParams[1:]
-				fnPtr = b.getInvokePtr(callback, typecode)
-
-				// Add the context parameter. An interface call cannot also be a
-				// closure but we have to supply the parameter anyway for platforms
-				// with a strict calling convention.
-				forwardParams = append(forwardParams, llvm.Undef(b.i8ptrType))
+// createOpenDeferRuns creates the deferred calls of every RunDefers instruction
+// in a function with open-coded defers, once all defer statements have been
+// compiled. The deferred functions are called in the reverse order of the
+// defer statements, if they have been executed.
+func (b *builder) createOpenDeferRuns() {
+	for _, run := range b.openDeferRuns {
+		if b.Debug {
+			pos := b.program.Fset.Position(run.instr.Pos())
+			b.SetCurrentDebugLocation(uint(pos.Line), uint(pos.Column), b.difunc, llvm.Metadata{})
+		}
+		b.SetInsertPointAtEnd(run.start)
+		for i := len(b.openDefers) - 1; i >= 0; i-- {
+			site := b.openDefers[i]
+			if site.frame.IsNil() {
+				// This defer statement wasn't compiled, so it can't have been
+				// executed either.
+				continue
 			}
 
-			// Parent coroutine handle.
-			forwardParams = append(forwardParams, llvm.Undef(b.i8ptrType))
+			// Check whether the defer statement was executed:
+			//     if bits & (1 << i) != 0 {
+			//         bits &^= 1 << i
+			//         // run deferred call
+			//     }
+			mask := llvm.ConstInt(b.ctx.Int8Type(), 1<<uint(i), false)
+			bits := b.CreateLoad(b.openDeferBits, "defer.bits")
+			isSet := b.CreateICmp(llvm.IntNE, b.CreateAnd(bits, mask, ""), llvm.ConstInt(b.ctx.Int8Type(), 0, false), "")
+			call := b.ctx.AddBasicBlock(b.llvmFn, "rundefers.call")
+			next := b.ctx.AddBasicBlock(b.llvmFn, "rundefers.next")
+			b.CreateCondBr(isSet, call, next)
+
+			b.SetInsertPointAtEnd(call)
+			b.CreateStore(b.CreateAnd(bits, llvm.ConstNot(mask), ""), b.openDeferBits)
+			b.createDeferredCall(site.callback, site.frame)
+			b.CreateBr(next)
+
+			b.SetInsertPointAtEnd(next)
+		}
+		b.CreateBr(run.end)
+	}
+}
 
-			b.createCall(fnPtr, forwardParams, "")
+// createDeferredCall emits a single deferred call. The parameters are loaded
+// from the defer frame that deferData points to, which was created by
+// createDefer for the given callback.
+func (b *builder) createDeferredCall(callback interface{}, deferData llvm.Value) {
+	switch callback := callback.(type) {
+	case *ssa.CallCommon:
+		// Call on an value or interface value.
+
+		// Get the real defer struct type and cast to it.
+		valueTypes := []llvm.Type{b.uintptrType, llvm.PointerType(b.getLLVMRuntimeType("_defer"), 0)}
+
+		if !callback.IsInvoke() {
+			//Expect funcValue to be passed through the defer frame.
+			valueTypes = append(valueTypes, b.getFuncType(callback.Signature()))
+		} else {
+			//Expect typecode
+			valueTypes = append(valueTypes, b.uintptrType, b.i8ptrType)
+		}
 
-		case *ssa.Function:
-			// Direct call.
+		for _, arg := range callback.Args {
+			valueTypes = append(valueTypes, b.getLLVMType(arg.Type()))
+		}
 
-			// Get the real defer struct type and cast to it.
-			valueTypes := []llvm.Type{b.uintptrType, llvm.PointerType(b.getLLVMRuntimeType("_defer"), 0)}
-			for _, param := range getParams(callback.Signature) {
-				valueTypes = append(valueTypes, b.getLLVMType(param.Type()))
-			}
-			deferFrameType := b.ctx.StructType(valueTypes, false)
-			deferFramePtr := b.CreateBitCast(deferData, llvm.PointerType(deferFrameType, 0), "deferFrame")
-
-			// Extract the params from the struct.
-			forwardParams := []llvm.Value{}
-			zero := llvm.ConstInt(b.ctx.Int32Type(), 0, false)
-			for i := range getParams(callback.Signature) {
-				gep := b.CreateInBoundsGEP(deferFramePtr, []llvm.Value{zero, llvm.ConstInt(b.ctx.Int32Type(), uint64(i+2), false)}, "gep")
-				forwardParam := b.CreateLoad(gep, "param")
-				forwardParams = append(forwardParams, forwardParam)
-			}
+		deferFrameType := b.ctx.StructType(valueTypes, false)
+		deferFramePtr := b.CreateBitCast(deferData, llvm.PointerType(deferFrameType, 0), "deferFrame")
 
-			// Plain TinyGo functions add some extra parameters to implement async functionality and function recievers.
-			// These parameters should not be supplied when calling into an external C/ASM function.
-			if !b.getFunctionInfo(callback).exported {
-				// Add the context parameter. We know it is ignored by the receiving
-				// function, but we have to pass one anyway.
-				forwardParams = append(forwardParams, llvm.Undef(b.i8ptrType))
+		// Extract the params from the struct (including receiver).
+		forwardParams := []llvm.Value{}
+		zero := llvm.ConstInt(b.ctx.Int32Type(), 0, false)
+		for i := 2; i < len(valueTypes); i++ {
+			gep := b.CreateInBoundsGEP(deferFramePtr, []llvm.Value{zero, llvm.ConstInt(b.ctx.Int32Type(), uint64(i), false)}, "gep")
+			forwardParam := b.CreateLoad(gep, "param")
+			forwardParams = append(forwardParams, forwardParam)
+		}
 
-				// Parent coroutine handle.
-				forwardParams = append(forwardParams, llvm.Undef(b.i8ptrType))
-			}
+		var fnPtr llvm.Value
 
-			// Call real function.
-			b.createCall(b.getFunction(callback), forwardParams, "")
+		if !callback.IsInvoke() {
+			// Isolate the func value.
+			funcValue := forwardParams[0]
+			forwardParams = forwardParams[1:]
 
-		case *ssa.MakeClosure:
-			// Get the real defer struct type and cast to it.
-			fn := callback.Fn.(*ssa.Function)
-			valueTypes := []llvm.Type{b.uintptrType, llvm.PointerType(b.getLLVMRuntimeType("_defer"), 0)}
-			params := fn.Signature.Params()
-			for i := 0; i < params.Len(); i++ {
-				valueTypes = append(valueTypes, b.getLLVMType(params.At(i).Type()))
-			}
-			valueTypes = append(valueTypes, b.i8ptrType) // closure
-			deferFrameType := b.ctx.StructType(valueTypes, false)
-			deferFramePtr := b.CreateBitCast(deferData, llvm.PointerType(deferFrameType, 0), "deferFrame")
-
-			// Extract the params from the struct.
-			forwardParams := []llvm.Value{}
-			zero := llvm.ConstInt(b.ctx.Int32Type(), 0, false)
-			for i := 2; i < len(valueTypes); i++ {
-				gep := b.CreateInBoundsGEP(deferFramePtr, []llvm.Value{zero, llvm.ConstInt(b.ctx.Int32Type(), uint64(i), false)}, "")
-				forwardParam := b.CreateLoad(gep, "param")
-				forwardParams = append(forwardParams, forwardParam)
-			}
+			//Get function pointer and context
+			fp, context := b.decodeFuncValue(funcValue, callback.Signature())
+			fnPtr = fp
+
+			//Pass context
+			forwardParams = append(forwardParams, context)
+		} else {
+			// Isolate the typecode.
+			typecode := forwardParams[0]
+			forwardParams = forwardParams[1:]
+			fnPtr = b.getInvokePtr(callback, typecode)
+
+			// Add the context parameter. An interface call cannot also be a
+			// closure but we have to supply the parameter anyway for platforms
+			// with a strict calling convention.
+			forwardParams = append(forwardParams, llvm.Undef(b.i8ptrType))
+		}
+
+		// Parent coroutine handle.
+		forwardParams = append(forwardParams, llvm.Undef(b.i8ptrType))
+
+		b.createCall(fnPtr, forwardParams, "")
+
+	case *ssa.Function:
+		// Direct call.
+
+		// Get the real defer struct type and cast to it.
+		valueTypes := []llvm.Type{b.uintptrType, llvm.PointerType(b.getLLVMRuntimeType("_defer"), 0)}
+		for _, param := range getParams(callback.Signature) {
+			valueTypes = append(valueTypes, b.getLLVMType(param.Type()))
+		}
+		deferFrameType := b.ctx.StructType(valueTypes, false)
+		deferFramePtr := b.CreateBitCast(deferData, llvm.PointerType(deferFrameType, 0), "deferFrame")
+
+		// Extract the params from the struct.
+		forwardParams := []llvm.Value{}
+		zero := llvm.ConstInt(b.ctx.Int32Type(), 0, false)
+		for i := range getParams(callback.Signature) {
+			gep := b.CreateInBoundsGEP(deferFramePtr, []llvm.Value{zero, llvm.ConstInt(b.ctx.Int32Type(), uint64(i+2), false)}, "gep")
+			forwardParam := b.CreateLoad(gep, "param")
+			forwardParams = append(forwardParams, forwardParam)
+		}
+
+		// Plain TinyGo functions add some extra parameters to implement async functionality and function recievers.
+		// These parameters should not be supplied when calling into an external C/ASM function.
+		if !b.getFunctionInfo(callback).exported {
+			// Add the context parameter. We know it is ignored by the receiving
+			// function, but we have to pass one anyway.
+			forwardParams = append(forwardParams, llvm.Undef(b.i8ptrType))
 
 			// Parent coroutine handle.
 			forwardParams = append(forwardParams, llvm.Undef(b.i8ptrType))
+		}
 
-			// Call deferred function.
-			b.createCall(b.getFunction(fn), forwardParams, "")
-		case *ssa.Builtin:
-			db := b.deferBuiltinFuncs[callback]
+		// Call real function.
+		b.createCall(b.getFunction(callback), forwardParams, "")
 
-			//Get parameter types
-			valueTypes := []llvm.Type{b.uintptrType, llvm.PointerType(b.getLLVMRuntimeType("_defer"), 0)}
+	case *ssa.MakeClosure:
+		// Get the real defer struct type and cast to it.
+		fn := callback.Fn.(*ssa.Function)
+		valueTypes := []llvm.Type{b.uintptrType, llvm.PointerType(b.getLLVMRuntimeType("_defer"), 0)}
+		params := fn.Signature.Params()
+		for i := 0; i < params.Len(); i++ {
+			valueTypes = append(valueTypes, b.getLLVMType(params.At(i).Type()))
+		}
+		valueTypes = append(valueTypes, b.i8ptrType) // closure
+		deferFrameType := b.ctx.StructType(valueTypes, false)
+		deferFramePtr := b.CreateBitCast(deferData, llvm.PointerType(deferFrameType, 0), "deferFrame")
+
+		// Extract the params from the struct.
+		forwardParams := []llvm.Value{}
+		zero := llvm.ConstInt(b.ctx.Int32Type(), 0, false)
+		for i := 2; i < len(valueTypes); i++ {
+			gep := b.CreateInBoundsGEP(deferFramePtr, []llvm.Value{zero, llvm.ConstInt(b.ctx.Int32Type(), uint64(i), false)}, "")
+			forwardParam := b.CreateLoad(gep, "param")
+			forwardParams = append(forwardParams, forwardParam)
+		}
 
-			//Get signature from call results
-			params := callback.Type().Underlying().(*types.Signature).Params()
-			for i := 0; i < params.Len(); i++ {
-				valueTypes = append(valueTypes, b.getLLVMType(params.At(i).Type()))
-			}
+		// Parent coroutine handle.
+		forwardParams = append(forwardParams, llvm.Undef(b.i8ptrType))
 
-			deferFrameType := b.ctx.StructType(valueTypes, false)
-			deferFramePtr := b.CreateBitCast(deferData, llvm.PointerType(deferFrameType, 0), "deferFrame")
+		// Call deferred function.
+		b.createCall(b.getFunction(fn), forwardParams, "")
+	case *ssa.Builtin:
+		db := b.deferBuiltinFuncs[callback]
 
-			// Extract the params from the struct.
-			var argValues []llvm.Value
-			zero := llvm.ConstInt(b.ctx.Int32Type(), 0, false)
-			for i := 0; i < params.Len(); i++ {
-				gep := b.CreateInBoundsGEP(deferFramePtr, []llvm.Value{zero, llvm.ConstInt(b.ctx.Int32Type(), uint64(i+2), false)}, "gep")
-				forwardParam := b.CreateLoad(gep, "param")
-				argValues = append(argValues, forwardParam)
-			}
+		//Get parameter types
+		valueTypes := []llvm.Type{b.uintptrType, llvm.PointerType(b.getLLVMRuntimeType("_defer"), 0)}
 
-			_, err := b.createBuiltin(db.argTypes, argValues, db.callName, db.pos)
-			if err != nil {
-				b.diagnostics = append(b.diagnostics, err)
-			}
-		default:
-			panic("unknown deferred function type")
+		//Get signature from call results
+		params := callback.Type().Underlying().(*types.Signature).Params()
+		for i := 0; i < params.Len(); i++ {
+			valueTypes = append(valueTypes, b.getLLVMType(params.At(i).Type()))
 		}
 
-		// Branch back to the start of the loop.
-		b.CreateBr(loophead)
-	}
+		deferFrameType := b.ctx.StructType(valueTypes, false)
+		deferFramePtr := b.CreateBitCast(deferData, llvm.PointerType(deferFrameType, 0), "deferFrame")
 
-	// Create default unreachable block:
-	//     default:
-	//         unreachable
-	//     }
-	b.SetInsertPointAtEnd(unreachable)
-	b.CreateUnreachable()
+		// Extract the params from the struct.
+		var argValues []llvm.Value
+		zero := llvm.ConstInt(b.ctx.Int32Type(), 0, false)
+		for i := 0; i < params.Len(); i++ {
+			gep := b.CreateInBoundsGEP(deferFramePtr, []llvm.Value{zero, llvm.ConstInt(b.ctx.Int32Type(), uint64(i+2), false)}, "gep")
+			forwardParam := b.CreateLoad(gep, "param")
+			argValues = append(argValues, forwardParam)
+		}
 
-	// End of loop.
-	b.SetInsertPointAtEnd(end)
+		_, err := b.createBuiltin(db.argTypes, argValues, db.callName, db.pos)
+		if err != nil {
+			b.diagnostics = append(b.diagnostics, err)
+		}
+	default:
+		panic("unknown deferred function type")
+	}
 }
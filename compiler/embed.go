@@ -0,0 +1,188 @@
+package compiler
+
+// This file implements the //go:embed directive: it creates the initializers of
+// globals with embedded files. The files themselves have been read by the
+// loader.
+
+import (
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/loader"
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// createEmbedGlobal sets the initializer of a global with a //go:embed
+// directive. The contents of strings and embed.FS files are stored in constant
+// globals, so that they stay in flash (or other read-only memory) instead of
+// being copied to RAM. A []byte can be modified, so it is stored like other
+// initialized global data.
+func (c *compilerContext) createEmbedGlobal(member *ssa.Global, global llvm.Value, files []*loader.EmbedFile) {
+	typ := member.Type().(*types.Pointer).Elem()
+	name := global.Name()
+	switch underlying := typ.Underlying().(type) {
+	case *types.Basic:
+		// string
+		global.SetInitializer(c.createEmbedString(name+"$embed", files[0].Data))
+	case *types.Slice:
+		// []byte
+		data := files[0].Data
+		bufPtr := llvm.ConstNull(c.i8ptrType)
+		if len(data) != 0 {
+			buf := c.makeGlobalArray(data, name+"$embed", c.ctx.Int8Type())
+			buf.SetLinkage(llvm.InternalLinkage)
+			buf.SetAlignment(1)
+			zero := llvm.ConstInt(c.ctx.Int32Type(), 0, false)
+			bufPtr = llvm.ConstInBoundsGEP(buf, []llvm.Value{zero, zero})
+		}
+		bufLen := llvm.ConstInt(c.uintptrType, uint64(len(data)), false)
+		global.SetInitializer(c.ctx.ConstStruct([]llvm.Value{bufPtr, bufLen, bufLen}, false))
+	case *types.Struct:
+		// embed.FS
+		c.createEmbedFS(member, global, underlying, files)
+	}
+}
+
+// createEmbedString returns a constant string with the given contents. The
+// contents are stored in a constant global with the given name.
+func (c *compilerContext) createEmbedString(name string, data []byte) llvm.Value {
+	strPtr := llvm.ConstNull(c.i8ptrType)
+	if len(data) != 0 {
+		global := llvm.AddGlobal(c.mod, llvm.ArrayType(c.ctx.Int8Type(), len(data)), name)
+		global.SetInitializer(c.ctx.ConstString(string(data), false))
+		global.SetLinkage(llvm.InternalLinkage)
+		global.SetGlobalConstant(true)
+		global.SetUnnamedAddr(true)
+		global.SetAlignment(1)
+		zero := llvm.ConstInt(c.ctx.Int32Type(), 0, false)
+		strPtr = llvm.ConstInBoundsGEP(global, []llvm.Value{zero, zero})
+	}
+	strLen := llvm.ConstInt(c.uintptrType, uint64(len(data)), false)
+	return llvm.ConstNamedStruct(c.getLLVMRuntimeType("_string"), []llvm.Value{strPtr, strLen})
+}
+
+// createEmbedFS sets the initializer of an embed.FS global. The embed package
+// (as of Go 1.16) defines it as follows:
+//
+//     type FS struct {
+//         files *[]file
+//     }
+//
+//     type file struct {
+//         name string
+//         data string
+//         hash [16]byte // truncated SHA256 hash
+//     }
+//
+// The file list and everything it refers to is constant.
+func (c *compilerContext) createEmbedFS(member *ssa.Global, global llvm.Value, fsStruct *types.Struct, files []*loader.EmbedFile) {
+	// Check that the embed package has the expected layout.
+	var fileType types.Type
+	if fsStruct.NumFields() == 1 {
+		if ptr, ok := fsStruct.Field(0).Type().(*types.Pointer); ok {
+			if slice, ok := ptr.Elem().(*types.Slice); ok {
+				if st, ok := slice.Elem().Underlying().(*types.Struct); ok && st.NumFields() == 3 {
+					fileType = slice.Elem()
+				}
+			}
+		}
+	}
+	if fileType == nil {
+		c.addError(member.Pos(), "unsupported embed.FS implementation")
+		return
+	}
+	llvmFileType := c.getLLVMType(fileType)
+
+	name := global.Name()
+	var fileValues []llvm.Value
+	for i, entry := range embedFSEntries(files) {
+		prefix := name + "$embed." + strconv.Itoa(i)
+		fileValues = append(fileValues, llvm.ConstNamedStruct(llvmFileType, []llvm.Value{
+			c.createEmbedString(prefix+".name", []byte(entry.name)),
+			c.createEmbedString(prefix+".data", entry.data),
+			c.ctx.ConstString(string(entry.hash[:]), false),
+		}))
+	}
+
+	// Create the []file slice that FS.files points to.
+	filesArray := llvm.AddGlobal(c.mod, llvm.ArrayType(llvmFileType, len(fileValues)), name+"$embed.files")
+	filesArray.SetInitializer(llvm.ConstArray(llvmFileType, fileValues))
+	filesArray.SetLinkage(llvm.InternalLinkage)
+	filesArray.SetGlobalConstant(true)
+	filesArray.SetUnnamedAddr(true)
+	zero := llvm.ConstInt(c.ctx.Int32Type(), 0, false)
+	filesLen := llvm.ConstInt(c.uintptrType, uint64(len(fileValues)), false)
+	filesSlice := c.ctx.ConstStruct([]llvm.Value{
+		llvm.ConstInBoundsGEP(filesArray, []llvm.Value{zero, zero}),
+		filesLen,
+		filesLen,
+	}, false)
+	filesSliceGlobal := llvm.AddGlobal(c.mod, filesSlice.Type(), name+"$embed.slice")
+	filesSliceGlobal.SetInitializer(filesSlice)
+	filesSliceGlobal.SetLinkage(llvm.InternalLinkage)
+	filesSliceGlobal.SetGlobalConstant(true)
+	filesSliceGlobal.SetUnnamedAddr(true)
+
+	fs := llvm.ConstNamedStruct(global.Type().ElementType(), []llvm.Value{filesSliceGlobal})
+	global.SetInitializer(fs)
+}
+
+// embedFSEntry is a single file or directory in an embed.FS.
+type embedFSEntry struct {
+	name string // ends in a slash for directories
+	data []byte
+	hash [16]byte
+}
+
+// embedFSEntries returns the entries of an embed.FS with the given files. Every
+// directory that contains a file is included as well. The entries are sorted
+// by directory and then by name, like the embed package expects so that it can
+// find them with a binary search.
+func embedFSEntries(files []*loader.EmbedFile) []embedFSEntry {
+	var entries []embedFSEntry
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		entries = append(entries, embedFSEntry{
+			name: file.Name,
+			data: file.Data,
+			hash: file.Hash,
+		})
+		for dir := embedDir(file.Name); dir != "." && !dirs[dir]; dir = embedDir(dir) {
+			dirs[dir] = true
+			entries = append(entries, embedFSEntry{name: dir + "/"})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		dirI, elemI := embedSplit(entries[i].name)
+		dirJ, elemJ := embedSplit(entries[j].name)
+		if dirI != dirJ {
+			return dirI < dirJ
+		}
+		return elemI < elemJ
+	})
+	return entries
+}
+
+// embedDir returns the directory of a file name (without trailing slash), or
+// "." if the file is in the root directory.
+func embedDir(name string) string {
+	i := strings.LastIndexByte(name, '/')
+	if i < 0 {
+		return "."
+	}
+	return name[:i]
+}
+
+// embedSplit splits an entry name into its directory and base name, the same
+// way as the embed package.
+func embedSplit(name string) (dir, elem string) {
+	name = strings.TrimSuffix(name, "/")
+	i := strings.LastIndexByte(name, '/')
+	if i < 0 {
+		return ".", name
+	}
+	return name[:i], name[i+1:]
+}
@@ -0,0 +1,289 @@
+package compiler
+
+// This file implements the lightweight fmt mode (-fmt=light). In this mode,
+// simple calls to fmt.Printf, fmt.Println and fmt.Sprintf are lowered to
+// direct calls to the runtime print functions or to string concatenation. If
+// all calls in a program can be lowered this way, the fmt package (and with it
+// most of reflect) is not linked in at all, which saves a lot of flash space on
+// small chips.
+//
+// Only calls where the output is known to be identical to what the fmt package
+// would produce are lowered. Everything else (unsupported verbs, flags, width
+// or precision, arguments with methods, non-constant format strings, etc.) is
+// left as a regular call to the fmt package.
+//
+// The runtime print functions may buffer their output (in libc or in the
+// runtime), while fmt writes directly to os.Stdout. Therefore the output is
+// flushed after every lowered call, so that it isn't reordered with the output
+// of calls that are not lowered.
+
+import (
+	"go/constant"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// fmtPiece is a single piece of a parsed format string: either a literal string
+// or a verb that consumes one argument.
+type fmtPiece struct {
+	text string // literal text, if verb is 0
+	verb byte   // verb character such as 'd', or 0 for literal text
+}
+
+// parseLightweightFormat splits a format string into literal text and verbs.
+// It returns false if the format string contains anything that isn't supported
+// in the lightweight fmt mode.
+func parseLightweightFormat(format string) ([]fmtPiece, bool) {
+	var pieces []fmtPiece
+	var text strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			text.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(format) {
+			// Trailing percent sign, fmt prints %!(NOVERB).
+			return nil, false
+		}
+		switch verb := format[i]; verb {
+		case '%':
+			text.WriteByte('%')
+		case 'd', 's', 't', 'v':
+			if text.Len() != 0 {
+				pieces = append(pieces, fmtPiece{text: text.String()})
+				text.Reset()
+			}
+			pieces = append(pieces, fmtPiece{verb: verb})
+		default:
+			// Flags, width, precision, argument indices and all other verbs.
+			return nil, false
+		}
+	}
+	if text.Len() != 0 {
+		pieces = append(pieces, fmtPiece{text: text.String()})
+	}
+	return pieces, true
+}
+
+// lightweightFmtVerbSupported returns whether the given verb can be used on a
+// value of the given type in the lightweight fmt mode.
+func lightweightFmtVerbSupported(verb byte, typ types.Type) bool {
+	if types.NewMethodSet(typ).Len() != 0 {
+		// The type might implement fmt.Stringer, fmt.Formatter, or error.
+		return false
+	}
+	basic, ok := typ.Underlying().(*types.Basic)
+	if !ok {
+		return false
+	}
+	if basic.Kind() == types.Uintptr {
+		// The print builtin prints uintptr values in hexadecimal.
+		return false
+	}
+	info := basic.Info()
+	switch verb {
+	case 'd':
+		return info&types.IsInteger != 0
+	case 's':
+		return info&types.IsString != 0
+	case 't':
+		return info&types.IsBoolean != 0
+	case 'v':
+		return info&(types.IsInteger|types.IsString|types.IsBoolean) != 0
+	default:
+		return false
+	}
+}
+
+// variadicInterfaceArgs returns the values passed in the variadic ...interface{}
+// parameter of a call, before they were converted to an interface. It returns
+// false if the slice wasn't constructed in the usual way (in the block of the
+// call), in which case the call can't be lowered.
+func variadicInterfaceArgs(block *ssa.BasicBlock, slice ssa.Value) ([]ssa.Value, bool) {
+	if c, ok := slice.(*ssa.Const); ok && c.IsNil() {
+		// No variadic arguments.
+		return nil, true
+	}
+	sliceExpr, ok := slice.(*ssa.Slice)
+	if !ok || sliceExpr.Low != nil || sliceExpr.High != nil || sliceExpr.Max != nil {
+		return nil, false
+	}
+	alloc, ok := sliceExpr.X.(*ssa.Alloc)
+	if !ok || alloc.Block() != block {
+		return nil, false
+	}
+	array, ok := alloc.Type().Underlying().(*types.Pointer).Elem().Underlying().(*types.Array)
+	if !ok {
+		return nil, false
+	}
+	values := make([]ssa.Value, array.Len())
+	for _, ref := range *alloc.Referrers() {
+		if ref == sliceExpr {
+			continue
+		}
+		indexAddr, ok := ref.(*ssa.IndexAddr)
+		if !ok {
+			return nil, false
+		}
+		index, ok := indexAddr.Index.(*ssa.Const)
+		if !ok || len(*indexAddr.Referrers()) != 1 {
+			return nil, false
+		}
+		store, ok := (*indexAddr.Referrers())[0].(*ssa.Store)
+		if !ok || store.Addr != indexAddr {
+			return nil, false
+		}
+		makeInterface, ok := store.Val.(*ssa.MakeInterface)
+		if !ok {
+			return nil, false
+		}
+		i := index.Int64()
+		if values[i] != nil {
+			// Stored twice to the same index.
+			return nil, false
+		}
+		values[i] = makeInterface.X
+	}
+	if len(*sliceExpr.Referrers()) != 1 {
+		// The slice is used for something else than this call.
+		return nil, false
+	}
+	for _, value := range values {
+		if value == nil {
+			// Not all values are set.
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// createLightweightFmtCall tries to lower a call to the fmt package to direct
+// print calls or string concatenation. It returns false if the call cannot be
+// lowered, in which case a regular call must be created.
+func (b *builder) createLightweightFmtCall(call *ssa.Call) (llvm.Value, bool) {
+	fn := call.Common().StaticCallee()
+	if fn == nil || fn.Pkg == nil || fn.Pkg.Pkg.Path() != "fmt" {
+		return llvm.Value{}, false
+	}
+	args := call.Common().Args
+	switch fn.Name() {
+	case "Printf", "Sprintf":
+		format, ok := args[0].(*ssa.Const)
+		if !ok || format.Value == nil || format.Value.Kind() != constant.String {
+			return llvm.Value{}, false
+		}
+		pieces, ok := parseLightweightFormat(constant.StringVal(format.Value))
+		if !ok {
+			return llvm.Value{}, false
+		}
+		values, ok := variadicInterfaceArgs(call.Block(), args[1])
+		if !ok {
+			return llvm.Value{}, false
+		}
+		numVerbs := 0
+		for _, piece := range pieces {
+			if piece.verb == 0 {
+				continue
+			}
+			if numVerbs >= len(values) || !lightweightFmtVerbSupported(piece.verb, values[numVerbs].Type()) {
+				return llvm.Value{}, false
+			}
+			numVerbs++
+		}
+		if numVerbs != len(values) {
+			// Extra arguments, fmt prints %!(EXTRA ...).
+			return llvm.Value{}, false
+		}
+		if fn.Name() == "Sprintf" {
+			return b.createLightweightSprintf(pieces, values), true
+		}
+		if len(*call.Referrers()) != 0 {
+			// The number of bytes written isn't known at compile time.
+			return llvm.Value{}, false
+		}
+		valueIndex := 0
+		for _, piece := range pieces {
+			if piece.verb == 0 {
+				b.createLightweightPrint(ssa.NewConst(constant.MakeString(piece.text), types.Typ[types.String]))
+				continue
+			}
+			b.createLightweightPrint(values[valueIndex])
+			valueIndex++
+		}
+		b.createRuntimeCall("printflush", nil, "")
+	case "Println":
+		values, ok := variadicInterfaceArgs(call.Block(), args[0])
+		if !ok || len(*call.Referrers()) != 0 {
+			return llvm.Value{}, false
+		}
+		for _, value := range values {
+			if !lightweightFmtVerbSupported('v', value.Type()) {
+				return llvm.Value{}, false
+			}
+		}
+		for i, value := range values {
+			if i != 0 {
+				b.createRuntimeCall("printspace", nil, "")
+			}
+			b.createLightweightPrint(value)
+		}
+		b.createRuntimeCall("printnl", nil, "")
+		b.createRuntimeCall("printflush", nil, "")
+	default:
+		return llvm.Value{}, false
+	}
+	// The result of Printf and Println isn't used (checked above), so return a
+	// dummy value.
+	return llvm.Undef(b.getLLVMType(call.Type())), true
+}
+
+// createLightweightPrint prints a single value (of a type accepted by
+// lightweightFmtVerbSupported) using the runtime print functions.
+func (b *builder) createLightweightPrint(value ssa.Value) {
+	_, err := b.createBuiltin([]types.Type{value.Type()}, []llvm.Value{b.getValue(value)}, "print", value.Pos())
+	if err != nil {
+		// All types passed here are supported by the print builtin.
+		panic(err)
+	}
+}
+
+// createLightweightSprintf creates the string that fmt.Sprintf would produce,
+// by concatenating literal text with formatted values.
+func (b *builder) createLightweightSprintf(pieces []fmtPiece, values []ssa.Value) llvm.Value {
+	result := b.createConst(b.info.linkName, ssa.NewConst(constant.MakeString(""), types.Typ[types.String]))
+	valueIndex := 0
+	for i, piece := range pieces {
+		var str llvm.Value
+		if piece.verb == 0 {
+			str = b.createConst(b.info.linkName, ssa.NewConst(constant.MakeString(piece.text), types.Typ[types.String]))
+		} else {
+			value := values[valueIndex]
+			valueIndex++
+			llvmValue := b.getValue(value)
+			basic := value.Type().Underlying().(*types.Basic)
+			switch {
+			case basic.Info()&types.IsString != 0:
+				str = llvmValue
+			case basic.Info()&types.IsBoolean != 0:
+				str = b.createRuntimeCall("formatBool", []llvm.Value{llvmValue}, "")
+			case basic.Info()&types.IsUnsigned != 0:
+				llvmValue = b.CreateZExtOrBitCast(llvmValue, b.ctx.Int64Type(), "")
+				str = b.createRuntimeCall("formatUint", []llvm.Value{llvmValue}, "")
+			default:
+				llvmValue = b.CreateSExtOrBitCast(llvmValue, b.ctx.Int64Type(), "")
+				str = b.createRuntimeCall("formatInt", []llvm.Value{llvmValue}, "")
+			}
+		}
+		if i == 0 {
+			result = str
+			continue
+		}
+		result = b.createRuntimeCall("stringConcat", []llvm.Value{result, str}, "")
+	}
+	return result
+}
@@ -0,0 +1,36 @@
+package compiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLightweightFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		pieces []fmtPiece
+		ok     bool
+	}{
+		{"", nil, true},
+		{"hello\n", []fmtPiece{{text: "hello\n"}}, true},
+		{"%d", []fmtPiece{{verb: 'd'}}, true},
+		{"x=%d, y=%v\n", []fmtPiece{{text: "x="}, {verb: 'd'}, {text: ", y="}, {verb: 'v'}, {text: "\n"}}, true},
+		{"100%% %s", []fmtPiece{{text: "100% "}, {verb: 's'}}, true},
+		{"%t%s", []fmtPiece{{verb: 't'}, {verb: 's'}}, true},
+		{"%5d", nil, false},
+		{"%x", nil, false},
+		{"%.2f", nil, false},
+		{"%[1]d", nil, false},
+		{"trailing %", nil, false},
+	}
+	for _, tc := range tests {
+		pieces, ok := parseLightweightFormat(tc.format)
+		if ok != tc.ok {
+			t.Errorf("format %q: expected ok=%v, got ok=%v", tc.format, tc.ok, ok)
+			continue
+		}
+		if !reflect.DeepEqual(pieces, tc.pieces) {
+			t.Errorf("format %q: expected %v, got %v", tc.format, tc.pieces, pieces)
+		}
+	}
+}
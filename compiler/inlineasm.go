@@ -5,6 +5,7 @@ package compiler
 import (
 	"fmt"
 	"go/constant"
+	"go/types"
 	"regexp"
 	"strconv"
 	"strings"
@@ -126,6 +127,207 @@ func (b *builder) createInlineAsmFull(instr *ssa.CallCommon) (llvm.Value, error)
 	}
 }
 
+// This is a compiler builtin, which emits inline assembly with explicit operand
+// constraints, similar to GCC extended asm. It can be one of:
+//
+//     func AsmExt(asm, constraints string, operands ...interface{})
+//     func AsmExtPure(asm, constraints string, operands ...interface{})
+//
+// The asm and constraints parameters must be constant strings. The constraints
+// string is a comma separated list in the LLVM inline assembly format: first
+// the outputs (like "=r"), then the inputs (like "r" or "0"), then the
+// clobbers (like "~{memory}"). There must be exactly one operand for each
+// output and input constraint, in the same order. Output operands must be
+// pointers that receive the output value, input operands are passed by value.
+// An input that is tied to an output (like "0") must have the same type as
+// that output.
+//
+// The operands are referenced from the asm string as $0, $1, etc. A literal $
+// is written as $$.
+//
+// AsmExt is assumed to have side effects, while AsmExtPure may be removed or
+// merged with other identical calls by the optimizer.
+func (b *builder) createInlineAsmExt(instr *ssa.CallCommon, sideEffects bool) (llvm.Value, error) {
+	asmConst, ok := instr.Args[0].(*ssa.Const)
+	if !ok {
+		return llvm.Value{}, b.makeError(instr.Pos(), "inline assembly must be a constant string")
+	}
+	constraintsConst, ok := instr.Args[1].(*ssa.Const)
+	if !ok {
+		return llvm.Value{}, b.makeError(instr.Pos(), "inline assembly constraints must be a constant string")
+	}
+	asm := constant.StringVal(asmConst.Value)
+	constraints := constant.StringVal(constraintsConst.Value)
+	operands, err := b.getInlineAsmOperands(instr)
+	if err != nil {
+		return llvm.Value{}, err
+	}
+
+	// Check the constraints, and sort them into outputs, inputs and clobbers
+	// (which must come in this order).
+	var numOutputs, numInputs, numClobbers int
+	var inputConstraints []string
+	if constraints != "" {
+		for _, constraint := range strings.Split(constraints, ",") {
+			switch {
+			case constraint == "":
+				return llvm.Value{}, b.makeError(instr.Pos(), "empty constraint in inline assembly")
+			case strings.HasPrefix(constraint, "~"):
+				if !strings.HasPrefix(constraint, "~{") || !strings.HasSuffix(constraint, "}") {
+					return llvm.Value{}, b.makeError(instr.Pos(), "invalid clobber in inline assembly: "+constraint)
+				}
+				numClobbers++
+			case numClobbers != 0:
+				return llvm.Value{}, b.makeError(instr.Pos(), "inline assembly clobbers must come after all operands: "+constraint)
+			case strings.HasPrefix(constraint, "="):
+				if numInputs != 0 {
+					return llvm.Value{}, b.makeError(instr.Pos(), "inline assembly outputs must come before inputs: "+constraint)
+				}
+				numOutputs++
+			default:
+				numInputs++
+				inputConstraints = append(inputConstraints, constraint)
+			}
+		}
+	}
+	if len(operands) != numOutputs+numInputs {
+		return llvm.Value{}, b.makeError(instr.Pos(), fmt.Sprintf("inline assembly constraints need %d operands, got %d", numOutputs+numInputs, len(operands)))
+	}
+
+	// Check that all operands referenced in the asm string exist.
+	// A $$ is a literal $, not an operand reference.
+	for _, match := range regexp.MustCompile(`\$(\$|\{?([0-9]+))`).FindAllStringSubmatch(asm, -1) {
+		if match[1] == "$" {
+			continue
+		}
+		n, _ := strconv.Atoi(match[2])
+		if n >= len(operands) {
+			return llvm.Value{}, b.makeError(instr.Pos(), fmt.Sprintf("inline assembly refers to operand $%d, but there are only %d operands", n, len(operands)))
+		}
+	}
+
+	// Determine the types of all operands.
+	var outputTypes, argTypes []llvm.Type
+	var outputPointers, args []llvm.Value
+	for i, operand := range operands {
+		typ := operand.Type()
+		if i < numOutputs {
+			ptr, ok := typ.Underlying().(*types.Pointer)
+			if !ok {
+				return llvm.Value{}, b.makeError(instr.Pos(), fmt.Sprintf("inline assembly output operand %d must be a pointer, got %s", i, typ))
+			}
+			typ = ptr.Elem()
+		}
+		if !isInlineAsmType(typ) {
+			return llvm.Value{}, b.makeError(instr.Pos(), fmt.Sprintf("inline assembly operand %d has unsupported type %s", i, typ))
+		}
+		if i < numOutputs {
+			outputTypes = append(outputTypes, b.getLLVMType(typ))
+			outputPointers = append(outputPointers, b.getValue(operand))
+		} else {
+			// An input that is tied to an output (such as "0") uses the same
+			// register, so it must have the same type.
+			if tied, err := strconv.Atoi(inputConstraints[i-numOutputs]); err == nil {
+				if tied >= numOutputs {
+					return llvm.Value{}, b.makeError(instr.Pos(), fmt.Sprintf("inline assembly input operand %d is tied to output operand %d, which does not exist", i, tied))
+				}
+				outputType := operands[tied].Type().Underlying().(*types.Pointer).Elem()
+				if !types.Identical(typ, outputType) {
+					return llvm.Value{}, b.makeError(instr.Pos(), fmt.Sprintf("inline assembly input operand %d has type %s, but is tied to output operand %d of type %s", i, typ, tied, outputType))
+				}
+			}
+			value := b.getValue(operand)
+			argTypes = append(argTypes, value.Type())
+			args = append(args, value)
+		}
+	}
+
+	// Create the inline assembly call. Multiple outputs are returned as a
+	// struct.
+	var outputType llvm.Type
+	switch len(outputTypes) {
+	case 0:
+		outputType = b.ctx.VoidType()
+	case 1:
+		outputType = outputTypes[0]
+	default:
+		outputType = b.ctx.StructType(outputTypes, false)
+	}
+	fnType := llvm.FunctionType(outputType, argTypes, false)
+	target := llvm.InlineAsm(fnType, asm, constraints, sideEffects, false, 0)
+	result := b.CreateCall(target, args, "")
+
+	// Store the outputs.
+	for i, ptr := range outputPointers {
+		b.createNilCheck(operands[i], ptr, "store")
+		value := result
+		if len(outputPointers) > 1 {
+			value = b.CreateExtractValue(result, i, "")
+		}
+		b.CreateStore(value, ptr)
+	}
+	return llvm.Value{}, nil
+}
+
+// getInlineAsmOperands returns the values passed in the variadic operands
+// parameter of AsmExt and AsmExtPure. They must be passed directly, not as an
+// existing slice.
+func (b *builder) getInlineAsmOperands(instr *ssa.CallCommon) ([]ssa.Value, error) {
+	switch arg := instr.Args[2].(type) {
+	case *ssa.Const:
+		// No operands (nil slice).
+		return nil, nil
+	case *ssa.Slice:
+		alloc, ok := arg.X.(*ssa.Alloc)
+		if !ok {
+			break
+		}
+		arrayType := alloc.Type().Underlying().(*types.Pointer).Elem().Underlying().(*types.Array)
+		operands := make([]ssa.Value, arrayType.Len())
+		for _, ref := range *alloc.Referrers() {
+			indexAddr, ok := ref.(*ssa.IndexAddr)
+			if !ok {
+				continue
+			}
+			index, ok := indexAddr.Index.(*ssa.Const)
+			if !ok {
+				return nil, b.makeError(instr.Pos(), "inline assembly operands must be passed directly")
+			}
+			for _, ref := range *indexAddr.Referrers() {
+				store, ok := ref.(*ssa.Store)
+				if !ok {
+					continue
+				}
+				value, ok := store.Val.(*ssa.MakeInterface)
+				if !ok {
+					return nil, b.makeError(instr.Pos(), "invalid inline assembly operand: "+store.Val.String())
+				}
+				operands[index.Int64()] = value.X
+			}
+		}
+		for _, operand := range operands {
+			if operand == nil {
+				return nil, b.makeError(instr.Pos(), "inline assembly operands must be passed directly")
+			}
+		}
+		return operands, nil
+	}
+	return nil, b.makeError(instr.Pos(), "inline assembly operands must be passed directly")
+}
+
+// isInlineAsmType returns whether values of the given type can be used as an
+// inline assembly operand: integers, floats and pointers.
+func isInlineAsmType(typ types.Type) bool {
+	switch typ := typ.Underlying().(type) {
+	case *types.Basic:
+		return typ.Info()&(types.IsInteger|types.IsFloat) != 0 || typ.Kind() == types.UnsafePointer
+	case *types.Pointer:
+		return true
+	default:
+		return false
+	}
+}
+
 // This is a compiler builtin which emits an inline SVCall instruction. It can
 // be one of:
 //
@@ -166,3 +166,13 @@ func SplitBasicBlock(builder llvm.Builder, afterInst llvm.Value, insertAfter llv
 
 	return newBlock
 }
+
+// ConstStruct creates a constant struct of the given struct type, which may be
+// a named struct type (as used for Go slices and strings) or a literal struct
+// type.
+func ConstStruct(t llvm.Type, values []llvm.Value) llvm.Value {
+	if t.StructName() != "" {
+		return llvm.ConstNamedStruct(t, values)
+	}
+	return llvm.ConstStruct(values, false)
+}
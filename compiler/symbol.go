@@ -7,9 +7,11 @@ import (
 	"go/ast"
 	"go/token"
 	"go/types"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/tinygo-org/tinygo/compileopts"
 	"github.com/tinygo-org/tinygo/loader"
 	"golang.org/x/tools/go/ssa"
 	"tinygo.org/x/go-llvm"
@@ -28,6 +30,7 @@ type functionInfo struct {
 	nobounds   bool       // go:nobounds
 	variadic   bool       // go:variadic (CGo only)
 	inline     inlineType // go:inline
+	section    string     // go:section
 }
 
 type inlineType int
@@ -71,8 +74,14 @@ func (c *compilerContext) getFunction(fn *ssa.Function) llvm.Value {
 		retType = c.ctx.StructType(results, false)
 	}
 
+	params := getParams(fn.Signature)
+	if info.variadic && fn.Signature.Variadic() {
+		// The ...interface{} parameter of a variadic C function is not a real
+		// parameter: the values in it are passed as C variadic arguments.
+		params = params[:len(params)-1]
+	}
 	var paramInfos []paramInfo
-	for _, param := range getParams(fn.Signature) {
+	for _, param := range params {
 		paramType := c.getLLVMType(param.Type())
 		paramFragmentInfos := c.expandFormalParamType(paramType, param.Name(), param.Type())
 		paramInfos = append(paramInfos, paramFragmentInfos...)
@@ -92,6 +101,9 @@ func (c *compilerContext) getFunction(fn *ssa.Function) llvm.Value {
 
 	fnType := llvm.FunctionType(retType, paramTypes, info.variadic)
 	llvmFn = llvm.AddFunction(c.mod, info.linkName, fnType)
+	if info.section != "" {
+		llvmFn.SetSection(info.section)
+	}
 	if strings.HasPrefix(c.Triple, "wasm") {
 		// C functions without prototypes like this:
 		//   void foo();
@@ -219,6 +231,23 @@ func (c *compilerContext) getFunctionInfo(f *ssa.Function) functionInfo {
 	return info
 }
 
+// getExportedFunction returns the function in the package of the function
+// being built that is exported to C under the given name with //export, or nil
+// if there is no such function.
+func (b *builder) getExportedFunction(name string) *ssa.Function {
+	for _, member := range b.fn.Pkg.Members {
+		fn, ok := member.(*ssa.Function)
+		if !ok || strings.HasPrefix(fn.Name(), "C.") {
+			continue
+		}
+		info := b.getFunctionInfo(fn)
+		if info.exported && info.module == "" && info.linkName == name {
+			return fn
+		}
+	}
+	return nil
+}
+
 // parsePragmas is used by getFunctionInfo to parse function pragmas such as
 // //export or //go:noinline.
 func (info *functionInfo) parsePragmas(f *ssa.Function) {
@@ -257,6 +286,13 @@ func (info *functionInfo) parsePragmas(f *ssa.Function) {
 				info.module = parts[1]
 			case "//go:inline":
 				info.inline = inlineHint
+			case "//go:section":
+				// Place the function in a specific section, for example to
+				// run it from RAM. Invalid pragmas are reported by
+				// checkPragmas.
+				if section, ok := parseSectionPragma(parts); ok {
+					info.section = section
+				}
 			case "//go:noinline":
 				info.inline = inlineNone
 			case "//go:linkname":
@@ -322,9 +358,10 @@ func getParams(sig *types.Signature) []*types.Var {
 // linkName is equal to .RelString(nil) on a global and extern is false, but for
 // some symbols this is different (due to //go:extern for example).
 type globalInfo struct {
-	linkName string // go:extern
-	extern   bool   // go:extern
+	linkName string // go:extern, go:linkname
+	extern   bool   // go:extern, go:linkname
 	align    int    // go:align
+	section  string // go:section
 }
 
 // loadASTComments loads comments on globals from the AST, for use later in the
@@ -354,6 +391,47 @@ func (c *compilerContext) loadASTComments(pkg *loader.Package) {
 	}
 }
 
+// checkLinknames reports invalid //go:linkname pragmas in the given package.
+// The pragma has the form //go:linkname localname importpath.name and is only
+// applied when it is placed in the doc comment of the function or global
+// variable it refers to, but like in gc it may appear anywhere in a file. The
+// single-argument form (//go:linkname localname) is accepted but has no effect.
+//
+// The following is checked for the two-argument form:
+//   - The package must import "unsafe". Unlike gc, which requires the import
+//     in the file with the pragma, this is checked per package: many files
+//     in the runtime use //go:linkname without importing "unsafe" themselves.
+//   - The local name must be a function or variable declared at package level
+//     in this package.
+// The target of the link name is not checked, as it may be defined in a
+// package that is compiled later or in assembly.
+func (c *compilerContext) checkLinknames(pkg *loader.Package) {
+	for _, file := range pkg.Files {
+		for _, group := range file.Comments {
+			for _, comment := range group.List {
+				parts := strings.Fields(comment.Text)
+				if len(parts) == 0 || parts[0] != "//go:linkname" {
+					continue
+				}
+				switch {
+				case len(parts) == 2:
+					// Nothing to check.
+				case len(parts) != 3:
+					c.addError(comment.Pos(), "usage: //go:linkname localname [linkname]")
+				case !hasUnsafeImport(pkg.Pkg):
+					c.addError(comment.Pos(), `//go:linkname only allowed in packages that import "unsafe"`)
+				default:
+					switch pkg.Pkg.Scope().Lookup(parts[1]).(type) {
+					case *types.Func, *types.Var:
+					default:
+						c.addError(comment.Pos(), "//go:linkname must refer to declared function or variable")
+					}
+				}
+			}
+		}
+	}
+}
+
 // getGlobal returns a LLVM IR global value for a Go SSA global. It is added to
 // the LLVM IR if it has not been added already.
 func (c *compilerContext) getGlobal(g *ssa.Global) llvm.Value {
@@ -363,22 +441,17 @@ func (c *compilerContext) getGlobal(g *ssa.Global) llvm.Value {
 		typ := g.Type().(*types.Pointer).Elem()
 		llvmType := c.getLLVMType(typ)
 		llvmGlobal = llvm.AddGlobal(c.mod, llvmType, info.linkName)
+		if info.section != "" && !info.extern {
+			llvmGlobal.SetSection(info.section)
+		}
 
-		// Set alignment from the //go:align comment.
-		var alignInBits uint32
+		// Set alignment from the //go:align comment. Invalid alignments have
+		// been reported by checkPragmas.
 		alignment := c.targetData.ABITypeAlignment(llvmType)
 		if info.align > alignment {
 			alignment = info.align
 		}
-		if alignment <= 0 || alignment&(alignment-1) != 0 {
-			// Check for power-of-two (or 0).
-			// See: https://stackoverflow.com/a/108360
-			c.addError(g.Pos(), "global variable alignment must be a positive power of two")
-		} else {
-			// Set the alignment only when it is a power of two.
-			alignInBits = uint32(alignment) ^ uint32(alignment-1)
-			llvmGlobal.SetAlignment(alignment)
-		}
+		llvmGlobal.SetAlignment(alignment)
 
 		if c.Debug && !info.extern {
 			// Add debug info.
@@ -391,7 +464,7 @@ func (c *compilerContext) getGlobal(g *ssa.Global) llvm.Value {
 				Type:        c.getDIType(typ),
 				LocalToUnit: false,
 				Expr:        c.dibuilder.CreateExpression(nil),
-				AlignInBits: alignInBits,
+				AlignInBits: uint32(alignment) * 8,
 			})
 			llvmGlobal.AddMetadata(0, diglobal)
 		}
@@ -413,7 +486,7 @@ func (c *compilerContext) getGlobalInfo(g *ssa.Global) globalInfo {
 		// others).
 		doc := c.astComments[info.linkName]
 		if doc != nil {
-			info.parsePragmas(doc)
+			info.parsePragmas(doc, g)
 		}
 	}
 	return info
@@ -421,7 +494,7 @@ func (c *compilerContext) getGlobalInfo(g *ssa.Global) globalInfo {
 
 // Parse //go: pragma comments from the source. In particular, it parses the
 // //go:extern pragma on globals.
-func (info *globalInfo) parsePragmas(doc *ast.CommentGroup) {
+func (info *globalInfo) parsePragmas(doc *ast.CommentGroup, g *ssa.Global) {
 	for _, comment := range doc.List {
 		if !strings.HasPrefix(comment.Text, "//go:") {
 			continue
@@ -433,13 +506,167 @@ func (info *globalInfo) parsePragmas(doc *ast.CommentGroup) {
 			if len(parts) == 2 {
 				info.linkName = parts[1]
 			}
+		case "//go:linkname":
+			if len(parts) != 3 || parts[1] != g.Name() {
+				continue
+			}
+			// A global with //go:linkname refers to a global defined in
+			// another package (usually the runtime), so it must not be
+			// defined here as well. Like on functions, this is only allowed
+			// in packages that import "unsafe".
+			if hasUnsafeImport(g.Pkg.Pkg) {
+				info.linkName = parts[2]
+				info.extern = true
+			}
 		case "//go:align":
-			align, err := strconv.Atoi(parts[1])
-			if err == nil {
+			// Invalid pragmas are reported by checkPragmas.
+			if align, ok := parseAlignPragma(parts); ok {
 				info.align = align
 			}
+		case "//go:section":
+			if section, ok := parseSectionPragma(parts); ok {
+				info.section = section
+			}
+		}
+	}
+}
+
+// checkPragmas reports invalid //go:section and //go:align pragmas in the given
+// package. The //go:section pragma has the form //go:section name, where the
+// name may be quoted like a Go string: //go:section ".ramfuncs". The name must
+// be placed by the linker script of the target, otherwise the linker would put
+// it in some arbitrary place. The //go:align pragma has the form //go:align n,
+// where n is a power of two. It is only supported on globals.
+func (c *compilerContext) checkPragmas(pkg *loader.Package) {
+	for _, file := range pkg.Files {
+		// Collect the doc comments of functions, to reject pragmas that would
+		// otherwise be silently ignored on them.
+		funcDocs := map[*ast.CommentGroup]bool{}
+		for _, decl := range file.Decls {
+			if decl, ok := decl.(*ast.FuncDecl); ok && decl.Doc != nil {
+				funcDocs[decl.Doc] = true
+			}
+		}
+		for _, group := range file.Comments {
+			for _, comment := range group.List {
+				parts := strings.Fields(comment.Text)
+				if len(parts) == 0 {
+					continue
+				}
+				switch parts[0] {
+				case "//go:section":
+					if section, ok := parseSectionPragma(parts); !ok {
+						c.addError(comment.Pos(), "usage: //go:section name")
+					} else if _, ok := compileopts.FindLinkerSection(c.LinkerSections, section); !ok && len(c.LinkerSections) != 0 {
+						c.addError(comment.Pos(), "unknown section "+strconv.Quote(section)+": it is not placed by the linker script of this target")
+					}
+				case "//go:align":
+					if funcDocs[group] {
+						c.addError(comment.Pos(), "//go:align is not supported on functions")
+					} else if len(parts) != 2 {
+						c.addError(comment.Pos(), "usage: //go:align n")
+					} else if _, ok := parseAlignPragma(parts); !ok {
+						c.addError(comment.Pos(), "global variable alignment must be a positive power of two")
+					}
+				}
+			}
+		}
+	}
+}
+
+// checkSections reports functions and initialized globals that are placed in a
+// section that is not loaded from the binary, such as .noinit: functions in
+// such a section would never be there, and globals would lose their initial
+// value.
+func (c *compilerContext) checkSections(pkg *ssa.Package) {
+	if len(c.LinkerSections) == 0 {
+		return
+	}
+
+	// Find the globals that are initialized by the package initializer.
+	initialized := map[*ssa.Global]bool{}
+	if fn := pkg.Func("init"); fn != nil {
+		for _, block := range fn.Blocks {
+			for _, instr := range block.Instrs {
+				if store, ok := instr.(*ssa.Store); ok {
+					if g := storedGlobal(store.Addr); g != nil {
+						initialized[g] = true
+					}
+				}
+			}
+		}
+	}
+
+	var members []ssa.Member
+	for _, member := range pkg.Members {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Pos() < members[j].Pos()
+	})
+	for _, member := range members {
+		switch member := member.(type) {
+		case *ssa.Function:
+			info := c.getFunctionInfo(member)
+			if section, ok := compileopts.FindLinkerSection(c.LinkerSections, info.section); ok && section.NoLoad && member.Blocks != nil {
+				c.addError(member.Pos(), "function "+member.Name()+" is placed in section "+strconv.Quote(info.section)+", which is not loaded from the binary")
+			}
+		case *ssa.Global:
+			info := c.getGlobalInfo(member)
+			if section, ok := compileopts.FindLinkerSection(c.LinkerSections, info.section); ok && section.NoLoad && !info.extern && initialized[member] {
+				c.addError(member.Pos(), "global "+member.Name()+" is placed in section "+strconv.Quote(info.section)+", which is not loaded from the binary, so it cannot have an initial value")
+			}
+		}
+	}
+}
+
+// storedGlobal returns the global that contains the given address, or nil if
+// it is not (part of) a global.
+func storedGlobal(addr ssa.Value) *ssa.Global {
+	for {
+		switch value := addr.(type) {
+		case *ssa.Global:
+			return value
+		case *ssa.FieldAddr:
+			addr = value.X
+		case *ssa.IndexAddr:
+			addr = value.X
+		default:
+			return nil
+		}
+	}
+}
+
+// parseAlignPragma returns the alignment of a //go:align pragma, which has
+// already been split in fields. It returns false if the pragma is invalid.
+func parseAlignPragma(parts []string) (int, bool) {
+	if len(parts) != 2 {
+		return 0, false
+	}
+	align, err := strconv.Atoi(parts[1])
+	if err != nil || align <= 0 || align&(align-1) != 0 {
+		// Check for power-of-two (or 0).
+		// See: https://stackoverflow.com/a/108360
+		return 0, false
+	}
+	return align, true
+}
+
+// parseSectionPragma returns the section name of a //go:section pragma, which
+// has already been split in fields. It returns false if the pragma is invalid.
+func parseSectionPragma(parts []string) (string, bool) {
+	if len(parts) != 2 {
+		return "", false
+	}
+	section := parts[1]
+	if section[0] == '"' || section[0] == '`' {
+		unquoted, err := strconv.Unquote(section)
+		if err != nil {
+			return "", false
 		}
+		section = unquoted
 	}
+	return section, section != ""
 }
 
 // Get all methods of a type.
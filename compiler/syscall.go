@@ -1,18 +1,60 @@
 package compiler
 
 // This file implements the syscall.Syscall and syscall.Syscall6 instructions as
-// compiler builtins.
+// compiler builtins. The same is done for the other system call primitives that
+// are normally implemented in assembly, such as syscall.RawSyscall and the
+// equivalent functions in golang.org/x/sys/unix.
 
 import (
+	"fmt"
 	"strconv"
 
 	"golang.org/x/tools/go/ssa"
 	"tinygo.org/x/go-llvm"
 )
 
+// isSyscallFunction returns whether calls to the given function should be
+// lowered to an inline system call instruction.
+func isSyscallFunction(fn *ssa.Function) bool {
+	if fn.Pkg == nil || fn.Signature.Recv() != nil {
+		return false
+	}
+	switch fn.Pkg.Pkg.Path() {
+	case "syscall":
+		switch fn.Name() {
+		case "Syscall", "Syscall6", "Syscall9", "RawSyscall", "RawSyscall6", "RawSyscall9", "rawSyscallNoError":
+			return true
+		}
+	case "golang.org/x/sys/unix":
+		if fn.Blocks != nil {
+			// Implemented in Go, for example using libc on macOS.
+			return false
+		}
+		switch fn.Name() {
+		case "Syscall", "Syscall6", "RawSyscall", "RawSyscall6", "SyscallNoError", "RawSyscallNoError":
+			return true
+		}
+	}
+	return false
+}
+
 // createSyscall emits an inline system call instruction, depending on the
-// target OS/arch.
+// target OS/arch. The raw variants (that don't notify the scheduler) are
+// lowered in the same way, as TinyGo never preempts goroutines. Variants
+// without an error result (such as syscall.rawSyscallNoError) only return the
+// first two values.
 func (b *builder) createSyscall(call *ssa.CallCommon) (llvm.Value, error) {
+	// The maximum number of arguments (excluding the system call number) that
+	// are passed in registers, see the register lists below.
+	maxArgs := 6
+	if b.GOARCH == "arm" {
+		maxArgs = 7 // r0-r6, the system call number is passed in r7
+	}
+	if len(call.Args)-1 > maxArgs {
+		// For example syscall.Syscall9, which is only used on some systems
+		// that pass the remaining arguments on the stack.
+		return llvm.Value{}, b.makeError(call.Pos(), fmt.Sprintf("system calls with more than %d arguments are not supported on %s/%s", maxArgs, b.GOOS, b.GOARCH))
+	}
 	num := b.getValue(call.Args[0])
 	var syscallResult llvm.Value
 	switch {
@@ -46,9 +88,6 @@ func (b *builder) createSyscall(call *ssa.CallCommon) (llvm.Value, error) {
 				"{r10}",
 				"{r8}",
 				"{r9}",
-				"{r11}",
-				"{r12}",
-				"{r13}",
 			}[i]
 			llvmValue := b.getValue(arg)
 			args = append(args, llvmValue)
@@ -151,6 +190,14 @@ func (b *builder) createSyscall(call *ssa.CallCommon) (llvm.Value, error) {
 	default:
 		return llvm.Value{}, b.makeError(call.Pos(), "unknown GOOS/GOARCH for syscall: "+b.GOOS+"/"+b.GOARCH)
 	}
+	zero := llvm.ConstInt(b.uintptrType, 0, false)
+	if call.Signature().Results().Len() == 2 {
+		// System call that cannot fail.
+		retval := llvm.Undef(b.ctx.StructType([]llvm.Type{b.uintptrType, b.uintptrType}, false))
+		retval = b.CreateInsertValue(retval, syscallResult, 0, "")
+		retval = b.CreateInsertValue(retval, zero, 1, "")
+		return retval, nil
+	}
 	switch b.GOOS {
 	case "linux", "freebsd":
 		// Return values: r0, r1 uintptr, err Errno
@@ -160,7 +207,6 @@ func (b *builder) createSyscall(call *ssa.CallCommon) (llvm.Value, error) {
 		//         err = -syscallResult
 		//     }
 		//     return syscallResult, 0, err
-		zero := llvm.ConstInt(b.uintptrType, 0, false)
 		inrange1 := b.CreateICmp(llvm.IntSLT, syscallResult, llvm.ConstInt(b.uintptrType, 0, false), "")
 		inrange2 := b.CreateICmp(llvm.IntSGT, syscallResult, llvm.ConstInt(b.uintptrType, 0xfffffffffffff000, true), "") // -4096
 		hasError := b.CreateAnd(inrange1, inrange2, "")
@@ -178,7 +224,6 @@ func (b *builder) createSyscall(call *ssa.CallCommon) (llvm.Value, error) {
 		//         err = syscallResult
 		//     }
 		//     return syscallResult, 0, err
-		zero := llvm.ConstInt(b.uintptrType, 0, false)
 		hasError := b.CreateICmp(llvm.IntNE, syscallResult, llvm.ConstInt(b.uintptrType, 0, false), "")
 		errResult := b.CreateSelect(hasError, syscallResult, zero, "syscallError")
 		retval := llvm.Undef(b.ctx.StructType([]llvm.Type{b.uintptrType, b.uintptrType, b.uintptrType}, false))
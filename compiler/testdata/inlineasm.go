@@ -0,0 +1,27 @@
+package main
+
+// This file tests inline assembly with explicit operand constraints. The
+// assembly itself is not checked by the compiler, only the constraints and
+// operands are.
+
+import "device"
+
+func asmExtNoOperands() {
+	device.AsmExt("nop", "~{memory}")
+}
+
+func asmExtLiteralDollar(x uint32) {
+	device.AsmExt("# $$foo $0", "r", x)
+}
+
+func asmExtPureOutput(result *uint32, x uint32) {
+	device.AsmExtPure("local.get $1\n\tlocal.set $0", "=r,r", result, x)
+}
+
+func asmExtPureTied(result *uint32, x uint32) {
+	device.AsmExtPure("i32.const 1\n\ti32.add $0", "=r,0", result, x)
+}
+
+func asmExtMultipleOutputs(lo, hi *uint32, x uint64) {
+	device.AsmExtPure("# $0 $1 $2", "=r,=r,r", lo, hi, x)
+}
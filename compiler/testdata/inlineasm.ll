@@ -0,0 +1,145 @@
+; ModuleID = 'inlineasm.go'
+source_filename = "inlineasm.go"
+target datalayout = "e-m:e-p:32:32-i64:64-n32:64-S128"
+target triple = "wasm32--wasi"
+
+%runtime.typecodeID = type { %runtime.typecodeID*, i32, %runtime.interfaceMethodInfo*, %runtime.typecodeID* }
+%runtime.interfaceMethodInfo = type { i8*, i32 }
+
+@"reflect/types.type:basic:uint32" = linkonce_odr constant %runtime.typecodeID { %runtime.typecodeID* null, i32 0, %runtime.interfaceMethodInfo* null, %runtime.typecodeID* @"reflect/types.type:pointer:basic:uint32" }
+@"reflect/types.type:pointer:basic:uint32" = linkonce_odr constant %runtime.typecodeID { %runtime.typecodeID* @"reflect/types.type:basic:uint32", i32 0, %runtime.interfaceMethodInfo* null, %runtime.typecodeID* null }
+@"reflect/types.type:basic:uint64" = linkonce_odr constant %runtime.typecodeID { %runtime.typecodeID* null, i32 0, %runtime.interfaceMethodInfo* null, %runtime.typecodeID* @"reflect/types.type:pointer:basic:uint64" }
+@"reflect/types.type:pointer:basic:uint64" = linkonce_odr constant %runtime.typecodeID { %runtime.typecodeID* @"reflect/types.type:basic:uint64", i32 0, %runtime.interfaceMethodInfo* null, %runtime.typecodeID* null }
+
+declare noalias nonnull i8* @runtime.alloc(i32, i8*, i8*)
+
+define hidden void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ret void
+}
+
+define hidden void @main.asmExtNoOperands(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  call void asm sideeffect "nop", "~{memory}"() #0
+  ret void
+}
+
+define hidden void @main.asmExtLiteralDollar(i32 %x, i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %varargs = call i8* @runtime.alloc(i32 8, i8* undef, i8* null)
+  %pack.int = inttoptr i32 %x to i8*
+  %.repack = bitcast i8* %varargs to i32*
+  store i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:basic:uint32" to i32), i32* %.repack, align 4
+  %.repack1 = getelementptr inbounds i8, i8* %varargs, i32 4
+  %0 = bitcast i8* %.repack1 to i8**
+  store i8* %pack.int, i8** %0, align 4
+  call void asm sideeffect "# $$foo $0", "r"(i32 %x) #0
+  ret void
+}
+
+define hidden void @main.asmExtPureOutput(i32* dereferenceable_or_null(4) %result, i32 %x, i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %varargs = call i8* @runtime.alloc(i32 16, i8* undef, i8* null)
+  %.repack = bitcast i8* %varargs to i32*
+  store i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:pointer:basic:uint32" to i32), i32* %.repack, align 4
+  %.repack1 = getelementptr inbounds i8, i8* %varargs, i32 4
+  %0 = bitcast i8* %.repack1 to i32**
+  store i32* %result, i32** %0, align 4
+  %1 = getelementptr inbounds i8, i8* %varargs, i32 8
+  %pack.int = inttoptr i32 %x to i8*
+  %.repack3 = bitcast i8* %1 to i32*
+  store i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:basic:uint32" to i32), i32* %.repack3, align 4
+  %.repack4 = getelementptr inbounds i8, i8* %varargs, i32 12
+  %2 = bitcast i8* %.repack4 to i8**
+  store i8* %pack.int, i8** %2, align 4
+  %3 = call i32 asm "local.get $1\0A\09local.set $0", "=r,r"(i32 %x) #0
+  %4 = icmp eq i32* %result, null
+  br i1 %4, label %store.throw, label %store.next
+
+store.throw:                                      ; preds = %entry
+  call void @runtime.nilPanic(i8* undef, i8* null)
+  unreachable
+
+store.next:                                       ; preds = %entry
+  store i32 %3, i32* %result, align 4
+  ret void
+}
+
+declare void @runtime.nilPanic(i8*, i8*)
+
+define hidden void @main.asmExtPureTied(i32* dereferenceable_or_null(4) %result, i32 %x, i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %varargs = call i8* @runtime.alloc(i32 16, i8* undef, i8* null)
+  %.repack = bitcast i8* %varargs to i32*
+  store i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:pointer:basic:uint32" to i32), i32* %.repack, align 4
+  %.repack1 = getelementptr inbounds i8, i8* %varargs, i32 4
+  %0 = bitcast i8* %.repack1 to i32**
+  store i32* %result, i32** %0, align 4
+  %1 = getelementptr inbounds i8, i8* %varargs, i32 8
+  %pack.int = inttoptr i32 %x to i8*
+  %.repack3 = bitcast i8* %1 to i32*
+  store i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:basic:uint32" to i32), i32* %.repack3, align 4
+  %.repack4 = getelementptr inbounds i8, i8* %varargs, i32 12
+  %2 = bitcast i8* %.repack4 to i8**
+  store i8* %pack.int, i8** %2, align 4
+  %3 = call i32 asm "i32.const 1\0A\09i32.add $0", "=r,0"(i32 %x) #0
+  %4 = icmp eq i32* %result, null
+  br i1 %4, label %store.throw, label %store.next
+
+store.throw:                                      ; preds = %entry
+  call void @runtime.nilPanic(i8* undef, i8* null)
+  unreachable
+
+store.next:                                       ; preds = %entry
+  store i32 %3, i32* %result, align 4
+  ret void
+}
+
+define hidden void @main.asmExtMultipleOutputs(i32* dereferenceable_or_null(4) %lo, i32* dereferenceable_or_null(4) %hi, i64 %x, i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %varargs = call i8* @runtime.alloc(i32 24, i8* undef, i8* null)
+  %.repack = bitcast i8* %varargs to i32*
+  store i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:pointer:basic:uint32" to i32), i32* %.repack, align 4
+  %.repack4 = getelementptr inbounds i8, i8* %varargs, i32 4
+  %0 = bitcast i8* %.repack4 to i32**
+  store i32* %lo, i32** %0, align 4
+  %1 = getelementptr inbounds i8, i8* %varargs, i32 8
+  %.repack6 = bitcast i8* %1 to i32*
+  store i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:pointer:basic:uint32" to i32), i32* %.repack6, align 4
+  %.repack7 = getelementptr inbounds i8, i8* %varargs, i32 12
+  %2 = bitcast i8* %.repack7 to i32**
+  store i32* %hi, i32** %2, align 4
+  %3 = getelementptr inbounds i8, i8* %varargs, i32 16
+  %4 = call i8* @runtime.alloc(i32 8, i8* undef, i8* null)
+  %5 = bitcast i8* %4 to i64*
+  store i64 %x, i64* %5, align 8
+  %.repack9 = bitcast i8* %3 to i32*
+  store i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:basic:uint64" to i32), i32* %.repack9, align 4
+  %.repack10 = getelementptr inbounds i8, i8* %varargs, i32 20
+  %6 = bitcast i8* %.repack10 to i8**
+  store i8* %4, i8** %6, align 4
+  %7 = call { i32, i32 } asm "# $0 $1 $2", "=r,=r,r"(i64 %x) #0
+  %8 = icmp eq i32* %lo, null
+  br i1 %8, label %store.throw, label %store.next
+
+store.throw:                                      ; preds = %entry
+  call void @runtime.nilPanic(i8* undef, i8* null)
+  unreachable
+
+store.next:                                       ; preds = %entry
+  %9 = extractvalue { i32, i32 } %7, 0
+  store i32 %9, i32* %lo, align 4
+  %10 = icmp eq i32* %hi, null
+  br i1 %10, label %store.throw2, label %store.next3
+
+store.throw2:                                     ; preds = %store.next
+  call void @runtime.nilPanic(i8* undef, i8* null)
+  unreachable
+
+store.next3:                                      ; preds = %store.next
+  %11 = extractvalue { i32, i32 } %7, 1
+  store i32 %11, i32* %hi, align 4
+  ret void
+}
+
+attributes #0 = { nounwind }
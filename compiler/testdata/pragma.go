@@ -0,0 +1,14 @@
+package main
+
+// Put a function in a custom section.
+//go:section .special_function_section
+func functionInSection() {
+}
+
+// Put a global in a custom section. The name may be quoted.
+//go:section ".special_global_section"
+var globalInSection uint32
+
+// Align a global to a larger alignment than its type requires.
+//go:align 1024
+var alignedGlobal [4]uint32
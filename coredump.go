@@ -0,0 +1,371 @@
+package main
+
+// This file implements tinygo coredump, which loads a core dump written by a
+// program built with -coredump=serial into GDB. GDB can't read these dumps
+// directly, so a small read-only GDB server is started that serves the
+// registers and memory from the dump (and the read-only data from the ELF
+// file), and GDB is connected to it.
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+)
+
+// coreDumpRegisterCount is the number of registers in a core dump: r0-r12, sp,
+// lr, pc and xpsr.
+const coreDumpRegisterCount = 17
+
+// coreDumpTargetXML describes the registers of a core dump to GDB, in the same
+// order as they're stored in the dump.
+const coreDumpTargetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target>
+  <architecture>arm</architecture>
+  <feature name="org.gnu.gdb.arm.m-profile">
+    <reg name="r0" bitsize="32"/>
+    <reg name="r1" bitsize="32"/>
+    <reg name="r2" bitsize="32"/>
+    <reg name="r3" bitsize="32"/>
+    <reg name="r4" bitsize="32"/>
+    <reg name="r5" bitsize="32"/>
+    <reg name="r6" bitsize="32"/>
+    <reg name="r7" bitsize="32"/>
+    <reg name="r8" bitsize="32"/>
+    <reg name="r9" bitsize="32"/>
+    <reg name="r10" bitsize="32"/>
+    <reg name="r11" bitsize="32"/>
+    <reg name="r12" bitsize="32"/>
+    <reg name="sp" bitsize="32" type="data_ptr"/>
+    <reg name="lr" bitsize="32"/>
+    <reg name="pc" bitsize="32" type="code_ptr"/>
+    <reg name="xpsr" bitsize="32"/>
+  </feature>
+</target>
+`
+
+// coreDump is a parsed core dump.
+type coreDump struct {
+	regs    []uint32
+	regions []coreDumpRegion
+}
+
+// coreDumpRegion is a region of RAM that was written to the core dump. Bytes
+// that were left out of the dump are zero.
+type coreDumpRegion struct {
+	start uint32
+	data  []byte
+}
+
+// parseCoreDump reads a core dump from r, which may contain other output as
+// well (for example a log of the serial console). If there are multiple core
+// dumps, the last complete one is returned.
+func parseCoreDump(r io.Reader) (*coreDump, error) {
+	const prefix = "tinygo-coredump: "
+	var dump, current *coreDump
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		index := strings.Index(line, prefix)
+		if index < 0 {
+			continue
+		}
+		fields := strings.Fields(line[index+len(prefix):])
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "begin" {
+			if len(fields) != 2 || fields[1] != "1" {
+				return nil, fmt.Errorf("line %d: unsupported core dump version", lineNum)
+			}
+			current = &coreDump{}
+			continue
+		}
+		if current == nil {
+			continue // the start of the dump is missing
+		}
+		switch fields[0] {
+		case "regs":
+			if len(fields) != coreDumpRegisterCount+1 {
+				return nil, fmt.Errorf("line %d: expected %d registers", lineNum, coreDumpRegisterCount)
+			}
+			for _, field := range fields[1:] {
+				value, err := strconv.ParseUint(field, 16, 32)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNum, err)
+				}
+				current.regs = append(current.regs, uint32(value))
+			}
+		case "region":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("line %d: invalid region", lineNum)
+			}
+			start, err1 := strconv.ParseUint(fields[1], 16, 32)
+			end, err2 := strconv.ParseUint(fields[2], 16, 32)
+			if err1 != nil || err2 != nil || end < start {
+				return nil, fmt.Errorf("line %d: invalid region", lineNum)
+			}
+			current.regions = append(current.regions, coreDumpRegion{
+				start: uint32(start),
+				data:  make([]byte, end-start),
+			})
+		case "mem":
+			if len(fields) != 3 || len(current.regions) == 0 {
+				return nil, fmt.Errorf("line %d: invalid memory line", lineNum)
+			}
+			addr, err := strconv.ParseUint(fields[1], 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			data, err := hex.DecodeString(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			region := current.regions[len(current.regions)-1]
+			if uint32(addr) < region.start || uint64(addr)+uint64(len(data)) > uint64(region.start)+uint64(len(region.data)) {
+				return nil, fmt.Errorf("line %d: memory outside of region", lineNum)
+			}
+			copy(region.data[uint32(addr)-region.start:], data)
+		case "end":
+			if current.regs == nil {
+				return nil, fmt.Errorf("line %d: core dump without registers", lineNum)
+			}
+			dump = current
+			current = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if dump == nil {
+		return nil, errors.New("no complete core dump found")
+	}
+	return dump, nil
+}
+
+// coreDumpMemory reads memory of a program from a core dump, and from the ELF
+// file of the program for memory that is not part of the dump (code and
+// read-only data).
+type coreDumpMemory struct {
+	dump  *coreDump
+	progs []*elf.Prog
+}
+
+// read returns size bytes at the given address. Bytes that are not known are
+// returned as zero.
+func (m *coreDumpMemory) read(addr, size uint32) []byte {
+	buf := make([]byte, size)
+	for i := uint32(0); i < size; i++ {
+		buf[i] = m.readByte(addr + i)
+	}
+	return buf
+}
+
+func (m *coreDumpMemory) readByte(addr uint32) byte {
+	for _, region := range m.dump.regions {
+		if addr >= region.start && addr-region.start < uint32(len(region.data)) {
+			return region.data[addr-region.start]
+		}
+	}
+	for _, prog := range m.progs {
+		if uint64(addr) >= prog.Vaddr && uint64(addr) < prog.Vaddr+prog.Filesz {
+			var b [1]byte
+			prog.ReadAt(b[:], int64(uint64(addr)-prog.Vaddr))
+			return b[0]
+		}
+	}
+	return 0
+}
+
+// serveCoreDump implements a minimal GDB server on conn, that serves the
+// registers and memory of a core dump. It returns when GDB disconnects.
+func serveCoreDump(conn io.ReadWriter, mem *coreDumpMemory) error {
+	r := bufio.NewReader(conn)
+	noAck := false
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if c != '$' {
+			continue // acknowledgements and interrupts
+		}
+		packet, err := r.ReadString('#')
+		if err != nil {
+			return err
+		}
+		packet = packet[:len(packet)-1]
+		if _, err := io.ReadFull(r, make([]byte, 2)); err != nil { // checksum
+			return err
+		}
+		if !noAck {
+			if _, err := conn.Write([]byte{'+'}); err != nil {
+				return err
+			}
+		}
+		reply, done := coreDumpReply(packet, mem)
+		if packet == "QStartNoAckMode" {
+			noAck = true
+		}
+		var checksum byte
+		for i := 0; i < len(reply); i++ {
+			checksum += reply[i]
+		}
+		if _, err := fmt.Fprintf(conn, "$%s#%02x", reply, checksum); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// coreDumpReply returns the reply to a single GDB packet, and whether GDB is
+// disconnecting.
+func coreDumpReply(packet string, mem *coreDumpMemory) (reply string, done bool) {
+	regs := mem.dump.regs
+	switch {
+	case packet == "?":
+		return "S05", false // stopped by SIGTRAP
+	case packet == "g":
+		buf := &bytes.Buffer{}
+		for _, reg := range regs {
+			binary.Write(buf, binary.LittleEndian, reg)
+		}
+		return hex.EncodeToString(buf.Bytes()), false
+	case strings.HasPrefix(packet, "p"):
+		n, err := strconv.ParseUint(packet[1:], 16, 32)
+		if err != nil || n >= uint64(len(regs)) {
+			return "E01", false
+		}
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], regs[n])
+		return hex.EncodeToString(buf[:]), false
+	case strings.HasPrefix(packet, "m"):
+		parts := strings.Split(packet[1:], ",")
+		if len(parts) != 2 {
+			return "E01", false
+		}
+		addr, err1 := strconv.ParseUint(parts[0], 16, 32)
+		size, err2 := strconv.ParseUint(parts[1], 16, 32)
+		if err1 != nil || err2 != nil || size > 0x1000 {
+			return "E01", false
+		}
+		return hex.EncodeToString(mem.read(uint32(addr), uint32(size))), false
+	case strings.HasPrefix(packet, "qSupported"):
+		return "PacketSize=4000;qXfer:features:read+;QStartNoAckMode+", false
+	case strings.HasPrefix(packet, "qXfer:features:read:target.xml:"):
+		parts := strings.Split(strings.TrimPrefix(packet, "qXfer:features:read:target.xml:"), ",")
+		if len(parts) != 2 {
+			return "E01", false
+		}
+		offset, err1 := strconv.ParseUint(parts[0], 16, 32)
+		length, err2 := strconv.ParseUint(parts[1], 16, 32)
+		if err1 != nil || err2 != nil {
+			return "E01", false
+		}
+		if offset >= uint64(len(coreDumpTargetXML)) {
+			return "l", false
+		}
+		data := coreDumpTargetXML[offset:]
+		if uint64(len(data)) > length {
+			return "m" + data[:length], false
+		}
+		return "l" + data, false
+	case packet == "QStartNoAckMode", strings.HasPrefix(packet, "H"):
+		return "OK", false
+	case packet == "qAttached":
+		return "1", false
+	case packet == "qfThreadInfo":
+		return "m1", false
+	case packet == "qsThreadInfo":
+		return "l", false
+	case packet == "qC":
+		return "QC1", false
+	case packet == "D", packet == "k":
+		return "OK", true
+	case strings.HasPrefix(packet, "G"), strings.HasPrefix(packet, "P"), strings.HasPrefix(packet, "M"),
+		strings.HasPrefix(packet, "X"), strings.HasPrefix(packet, "c"), strings.HasPrefix(packet, "s"):
+		// A core dump can't be modified or resumed.
+		return "E01", false
+	}
+	return "", false // not supported
+}
+
+// CoreDump loads the core dump in the given file, which may be a log of the
+// serial console, into GDB together with the executable that wrote it.
+func CoreDump(executable, dumpPath string, config *compileopts.Config) error {
+	f, err := os.Open(dumpPath)
+	if err != nil {
+		return err
+	}
+	dump, err := parseCoreDump(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", dumpPath, err)
+	}
+
+	ef, err := elf.Open(executable)
+	if err != nil {
+		return err
+	}
+	defer ef.Close()
+	if ef.Machine != elf.EM_ARM {
+		return fmt.Errorf("%s: core dumps are only supported on Cortex-M", executable)
+	}
+	mem := &coreDumpMemory{dump: dump}
+	for _, prog := range ef.Progs {
+		if prog.Type == elf.PT_LOAD {
+			mem.progs = append(mem.progs, prog)
+		}
+	}
+
+	gdb, err := config.Target.LookupGDB()
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		err = serveCoreDump(conn, mem)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "core dump server:", err)
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	cmd := executeCommand(config.Options, gdb, executable, "-ex", "target remote :"+strconv.Itoa(port))
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return &commandError{"failed to run gdb with", executable, err}
+	}
+	return nil
+}
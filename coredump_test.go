@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCoreDump(t *testing.T) {
+	log := strings.Join([]string{
+		"hello",
+		"tinygo-coredump: begin 1",
+		"tinygo-coredump: regs 1 2 3 4 5 6 7 8 9 a b c d 20000ff0 e f 21000000",
+		"tinygo-coredump: region 20000000 20000040",
+		"tinygo-coredump: mem 20000000 01020304",
+		"panic: runtime error: nil pointer dereference",
+		"[tinygo-coredump: mem 20000020 aabb",
+		"tinygo-coredump: end",
+		"tinygo-coredump: begin 1", // incomplete, ignored
+		"tinygo-coredump: regs 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0",
+		"",
+	}, "\r\n")
+	dump, err := parseCoreDump(strings.NewReader(log))
+	if err != nil {
+		t.Fatal("failed to parse core dump:", err)
+	}
+	if len(dump.regs) != coreDumpRegisterCount || dump.regs[0] != 1 || dump.regs[13] != 0x20000ff0 || dump.regs[16] != 0x21000000 {
+		t.Errorf("unexpected registers: %x", dump.regs)
+	}
+	if len(dump.regions) != 1 || dump.regions[0].start != 0x20000000 || len(dump.regions[0].data) != 0x40 {
+		t.Fatalf("unexpected regions: %+v", dump.regions)
+	}
+
+	mem := &coreDumpMemory{dump: dump}
+	for _, tc := range []struct {
+		packet string
+		reply  string
+	}{
+		{"m20000000,4", "01020304"},
+		{"m2000001f,3", "00aabb"},
+		{"m1fffffff,2", "0001"},   // outside the dump
+		{"p0", "01000000"},        // r0
+		{"pf", "0f000000"},        // pc
+		{"p11", "E01"},            // no such register
+		{"M20000000,1:ff", "E01"}, // read-only
+		{"vMustReplyEmpty", ""},
+	} {
+		reply, done := coreDumpReply(tc.packet, mem)
+		if reply != tc.reply || done {
+			t.Errorf("packet %q: expected reply %q, got %q", tc.packet, tc.reply, reply)
+		}
+	}
+	if reply, _ := coreDumpReply("g", mem); len(reply) != coreDumpRegisterCount*8 || !strings.HasPrefix(reply, "0100000002000000") {
+		t.Errorf("unexpected g reply: %q", reply)
+	}
+	if _, done := coreDumpReply("D", mem); !done {
+		t.Error("expected D to end the session")
+	}
+}
+
+func TestParseCoreDumpIncomplete(t *testing.T) {
+	_, err := parseCoreDump(strings.NewReader("tinygo-coredump: begin 1\ntinygo-coredump: regs 0\n"))
+	if err == nil {
+		t.Error("expected an error for a truncated core dump")
+	}
+	_, err = parseCoreDump(strings.NewReader("tinygo-coredump: begin 1\n"))
+	if err == nil || err.Error() != "no complete core dump found" {
+		t.Errorf("unexpected error for a core dump without end: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Prefix of lines with coverage data, and the line that follows the coverage
+// data, as printed after the test result by a test binary that was built with
+// -cover. These must match the constants in src/testing/coverage.go.
+const (
+	coverageLinePrefix = "tinygo-coverage: "
+	coverageEndLine    = "tinygo-coverage-end"
+)
+
+// coverageWriter is an io.Writer that strips the coverage data from the output
+// of a test binary and passes all other output through to out. The output can
+// come from anywhere, including a serial port: it is only parsed line by line.
+type coverageWriter struct {
+	out    io.Writer
+	line   []byte   // current (incomplete) line
+	blocks []string // collected coverage profile lines
+}
+
+// Write implements io.Writer.
+func (w *coverageWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		w.line = append(w.line, c)
+		if c != '\n' {
+			continue
+		}
+		err := w.flushLine()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flushLine processes the current line, either by storing it as coverage data
+// or by writing it to the output.
+func (w *coverageWriter) flushLine() error {
+	line := w.line
+	w.line = w.line[:0]
+	if bytes.HasPrefix(line, []byte(coverageLinePrefix)) {
+		block := strings.TrimRight(string(line[len(coverageLinePrefix):]), "\r\n")
+		w.blocks = append(w.blocks, block)
+		return nil
+	}
+	if string(bytes.TrimRight(line, "\r\n")) == coverageEndLine {
+		return nil
+	}
+	_, err := w.out.Write(line)
+	return err
+}
+
+// Flush writes any remaining output that doesn't end in a newline.
+func (w *coverageWriter) Flush() error {
+	if len(w.line) == 0 {
+		return nil
+	}
+	return w.flushLine()
+}
+
+// stripCoverageData removes the coverage data from the given test output, so
+// that the test result is the last line again.
+func stripCoverageData(output string) string {
+	lines := strings.SplitAfter(output, "\n")
+	var stripped []string
+	for _, line := range lines {
+		if strings.HasPrefix(line, coverageLinePrefix) || strings.TrimRight(line, "\r\n") == coverageEndLine {
+			continue
+		}
+		stripped = append(stripped, line)
+	}
+	return strings.Join(stripped, "")
+}
+
+// coverage returns the percentage of covered statements, in total and per
+// file.
+func (w *coverageWriter) coverage() (total float64, files map[string]float64, err error) {
+	type stmts struct{ covered, total int }
+	var sum stmts
+	perFile := make(map[string]*stmts)
+	for _, block := range w.blocks {
+		// Each block is of the form "file:line.col,line.col numStmt count".
+		fields := strings.Fields(block)
+		if len(fields) != 3 || strings.LastIndexByte(fields[0], ':') < 0 {
+			return 0, nil, fmt.Errorf("invalid coverage data: %#v", block)
+		}
+		numStmt, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			return 0, nil, fmt.Errorf("invalid coverage data: %#v", block)
+		}
+		file := fields[0][:strings.LastIndexByte(fields[0], ':')]
+		if perFile[file] == nil {
+			perFile[file] = &stmts{}
+		}
+		perFile[file].total += numStmt
+		sum.total += numStmt
+		if count != 0 {
+			perFile[file].covered += numStmt
+			sum.covered += numStmt
+		}
+	}
+	percent := func(s stmts) float64 {
+		if s.total == 0 {
+			return 0
+		}
+		return float64(s.covered) / float64(s.total) * 100
+	}
+	files = make(map[string]float64, len(perFile))
+	for file, s := range perFile {
+		files[file] = percent(*s)
+	}
+	return percent(sum), files, nil
+}
+
+// printFileCoverage prints the coverage per file, sorted by file name.
+func printFileCoverage(files map[string]float64) {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("\t%s\t%.1f%%\n", name, files[name])
+	}
+}
+
+// writeProfile appends the collected coverage data to the given coverage
+// profile, which must already exist and start with a mode line.
+func (w *coverageWriter) writeProfile(profile string) error {
+	f, err := os.OpenFile(profile, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	for _, block := range w.blocks {
+		_, err := fmt.Fprintln(f, block)
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
@@ -0,0 +1,208 @@
+package main
+
+// This file implements the selection of a device when multiple boards are
+// connected: listing the connected devices (tinygo flash -list-devices),
+// selecting a device by its USB serial number and remembering the last used
+// device for each project directory.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
+)
+
+// serialDevice is the serial port of a connected device. All fields except
+// for the port name may be empty when they cannot be determined.
+type serialDevice struct {
+	Port         string
+	VID          string
+	PID          string
+	SerialNumber string
+	Product      string
+}
+
+// listSerialDevices returns the serial ports of all connected USB devices.
+func listSerialDevices() ([]serialDevice, error) {
+	var devices []serialDevice
+	var ports []string
+	var err error
+	switch runtime.GOOS {
+	case "freebsd":
+		ports, err = filepath.Glob("/dev/cuaU*")
+	case "darwin", "linux", "windows":
+		var portsList []*enumerator.PortDetails
+		portsList, err = enumerator.GetDetailedPortsList()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range portsList {
+			if p.IsUSB {
+				devices = append(devices, serialDevice{
+					Port:         p.Name,
+					VID:          p.VID,
+					PID:          p.PID,
+					SerialNumber: p.SerialNumber,
+					Product:      p.Product,
+				})
+			}
+		}
+
+		if len(devices) == 0 {
+			// fallback
+			switch runtime.GOOS {
+			case "darwin":
+				ports, err = filepath.Glob("/dev/cu.usb*")
+			case "linux":
+				ports, err = filepath.Glob("/dev/ttyACM*")
+			case "windows":
+				ports, err = serial.GetPortsList()
+			}
+		}
+	default:
+		return nil, errors.New("unable to search for a default USB device to be flashed on this OS")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, port := range ports {
+		devices = append(devices, serialDevice{Port: port})
+	}
+	return devices, nil
+}
+
+// ListDevices prints the connected devices that can be selected with the
+// -port flag, either by port name or by serial number. The device that was
+// last used in the current directory is marked.
+func ListDevices(w io.Writer) error {
+	devices, err := listSerialDevices()
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return errors.New("no serial ports available")
+	}
+	last, hasLast := lastUsedDevice(devices)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "port\tid\tserial number\tproduct\t")
+	for _, device := range devices {
+		id := ""
+		if device.VID != "" {
+			id = strings.ToLower(device.VID + ":" + device.PID)
+		}
+		note := ""
+		if hasLast && device == last {
+			note = "(last used)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", device.Port, id, device.SerialNumber, device.Product, note)
+	}
+	return tw.Flush()
+}
+
+// isPortName returns whether the given -port value is the name of a serial
+// port (as opposed to a serial number).
+func isPortName(name string) bool {
+	if strings.ContainsAny(name, `/\`) {
+		return true
+	}
+	return runtime.GOOS == "windows" && strings.HasPrefix(strings.ToUpper(name), "COM")
+}
+
+// lastDevicesPath returns the path of the file in which the last used device
+// of each project directory is stored.
+func lastDevicesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tinygo", "devices.json"), nil
+}
+
+// readLastDevices reads the last used devices, as a map from project
+// directory to serial number (or port name if the device has no serial
+// number). It returns an empty map if the file doesn't exist.
+func readLastDevices(path string) map[string]string {
+	lastDevices := make(map[string]string)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return lastDevices
+	}
+	json.Unmarshal(data, &lastDevices)
+	return lastDevices
+}
+
+// writeLastDevice stores the device as the last used device for the given
+// project directory.
+func writeLastDevice(path, dir string, device serialDevice) error {
+	lastDevices := readLastDevices(path)
+	id := device.SerialNumber
+	if id == "" {
+		id = device.Port
+	}
+	if lastDevices[dir] == id {
+		return nil
+	}
+	lastDevices[dir] = id
+	data, err := json.MarshalIndent(lastDevices, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0666)
+}
+
+// findLastDevice returns the device that was last used for the given project
+// directory, if it is one of the given devices.
+func findLastDevice(path, dir string, devices []serialDevice) (serialDevice, bool) {
+	id := readLastDevices(path)[dir]
+	if id == "" {
+		return serialDevice{}, false
+	}
+	for _, device := range devices {
+		if (device.SerialNumber != "" && device.SerialNumber == id) || device.Port == id {
+			return device, true
+		}
+	}
+	return serialDevice{}, false
+}
+
+// rememberDevice stores the device as the last used device for the current
+// directory. Errors are ignored, as this is only a convenience.
+func rememberDevice(device serialDevice) {
+	path, err := lastDevicesPath()
+	if err != nil {
+		return
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	writeLastDevice(path, dir, device)
+}
+
+// lastUsedDevice returns the device that was last used in the current
+// directory, if it is still connected.
+func lastUsedDevice(devices []serialDevice) (serialDevice, bool) {
+	path, err := lastDevicesPath()
+	if err != nil {
+		return serialDevice{}, false
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return serialDevice{}, false
+	}
+	return findLastDevice(path, dir, devices)
+}
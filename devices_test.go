@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLastDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinygo-devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tinygo", "devices.json")
+
+	// Three identical boards, except for the serial number.
+	devices := []serialDevice{
+		{Port: "/dev/ttyACM0", VID: "2341", PID: "8057", SerialNumber: "AAAA"},
+		{Port: "/dev/ttyACM1", VID: "2341", PID: "8057", SerialNumber: "BBBB"},
+		{Port: "/dev/ttyACM2", VID: "2341", PID: "8057"},
+	}
+
+	if _, ok := findLastDevice(path, "/project1", devices); ok {
+		t.Error("found a last used device before any device was used")
+	}
+
+	err = writeLastDevice(path, "/project1", devices[1])
+	if err != nil {
+		t.Fatal("could not store last used device:", err)
+	}
+	err = writeLastDevice(path, "/project2", devices[2])
+	if err != nil {
+		t.Fatal("could not store last used device:", err)
+	}
+
+	// The device is found by serial number, even when it is connected to
+	// another port.
+	reordered := []serialDevice{devices[2], devices[0], {Port: "/dev/ttyACM3", SerialNumber: "BBBB"}}
+	device, ok := findLastDevice(path, "/project1", reordered)
+	if !ok || device.Port != "/dev/ttyACM3" {
+		t.Errorf("expected /dev/ttyACM3 as last used device of project1, got %#v", device)
+	}
+
+	// Devices without serial number are found by port name.
+	device, ok = findLastDevice(path, "/project2", devices)
+	if !ok || device.Port != "/dev/ttyACM2" {
+		t.Errorf("expected /dev/ttyACM2 as last used device of project2, got %#v", device)
+	}
+
+	// A device that is no longer connected is not returned.
+	if _, ok := findLastDevice(path, "/project1", devices[:1]); ok {
+		t.Error("found a last used device that is not connected")
+	}
+	if _, ok := findLastDevice(path, "/project3", devices); ok {
+		t.Error("found a last used device for an unknown project")
+	}
+}
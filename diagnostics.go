@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io"
+
+	"github.com/tinygo-org/tinygo/builder"
+	"github.com/tinygo-org/tinygo/interp"
+	"github.com/tinygo-org/tinygo/loader"
+	"github.com/tinygo-org/tinygo/transform"
+)
+
+// diagnostic is a single compiler error in a form that is easy to consume by
+// tools such as editors, as printed with the -json flag.
+type diagnostic struct {
+	ImportPath string `json:"package,omitempty"`
+	File       string `json:"file,omitempty"`
+	Line       int    `json:"line,omitempty"`
+	Column     int    `json:"column,omitempty"`
+	Message    string `json:"message"`
+}
+
+// compilerDiagnostics converts the error returned by the compiler to a list of
+// diagnostics. The importPath is the package the error belongs to, if known.
+func compilerDiagnostics(importPath string, err error) []diagnostic {
+	switch err := err.(type) {
+	case types.Error:
+		return []diagnostic{newDiagnostic(importPath, err.Fset.Position(err.Pos), err.Msg)}
+	case scanner.Error:
+		return []diagnostic{newDiagnostic(importPath, err.Pos, err.Msg)}
+	case scanner.ErrorList:
+		var diagnostics []diagnostic
+		for _, scannerErr := range err {
+			diagnostics = append(diagnostics, compilerDiagnostics(importPath, *scannerErr)...)
+		}
+		return diagnostics
+	case *interp.Error:
+		return []diagnostic{newDiagnostic(err.ImportPath, err.Pos, err.Err.Error())}
+	case transform.CoroutinesError:
+		return []diagnostic{newDiagnostic(importPath, err.Pos, err.Msg)}
+	case loader.Errors:
+		var diagnostics []diagnostic
+		for _, pkgErr := range err.Errs {
+			diagnostics = append(diagnostics, compilerDiagnostics(err.Pkg.ImportPath, pkgErr)...)
+		}
+		return diagnostics
+	case loader.Error:
+		return []diagnostic{newDiagnostic(err.ImportStack[0], err.Err.Pos, err.Err.Msg)}
+	case *builder.MultiError:
+		var diagnostics []diagnostic
+		for _, err := range err.Errs {
+			diagnostics = append(diagnostics, compilerDiagnostics(importPath, err)...)
+		}
+		return diagnostics
+	default:
+		return []diagnostic{{ImportPath: importPath, Message: err.Error()}}
+	}
+}
+
+// newDiagnostic creates a diagnostic at the given position. The position may
+// be invalid, in which case only the message is set.
+func newDiagnostic(importPath string, pos token.Position, msg string) diagnostic {
+	d := diagnostic{
+		ImportPath: importPath,
+		Message:    msg,
+	}
+	if pos.IsValid() {
+		d.File = pos.Filename
+		d.Line = pos.Line
+		d.Column = pos.Column
+	}
+	return d
+}
+
+// printDiagnostics writes the diagnostics of the given compiler error to w as a
+// stream of JSON objects, one per line.
+func printDiagnostics(w io.Writer, err error) error {
+	encoder := json.NewEncoder(w)
+	for _, d := range compilerDiagnostics("", err) {
+		if err := encoder.Encode(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
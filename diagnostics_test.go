@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"go/scanner"
+	"go/token"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/builder"
+	"github.com/tinygo-org/tinygo/loader"
+)
+
+func TestPrintDiagnostics(t *testing.T) {
+	err := &builder.MultiError{Errs: []error{
+		loader.Errors{
+			Pkg: &loader.Package{PackageJSON: loader.PackageJSON{ImportPath: "example.com/foo"}},
+			Errs: []error{
+				scanner.Error{Pos: token.Position{Filename: "foo.go", Line: 3, Column: 5}, Msg: "undeclared name: x"},
+			},
+		},
+		errors.New("linker failed"),
+	}}
+	buf := &bytes.Buffer{}
+	if err := printDiagnostics(buf, err); err != nil {
+		t.Fatal("could not print diagnostics:", err)
+	}
+	expected := `{"package":"example.com/foo","file":"foo.go","line":3,"column":5,"message":"undeclared name: x"}
+{"message":"linker failed"}
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected diagnostics:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+// This file tests the error messages of the compiler, by building the files in
+// testdata/errors and comparing the errors with the expected errors listed at
+// the bottom of each file.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+)
+
+func TestErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		target string
+	}{
+		{"align.go", ""},
+		{"asm.go", "cortex-m-qemu"},
+		{"section.go", "cortex-m-qemu"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			testErrorMessages(t, "./testdata/errors/"+tc.name, tc.target)
+		})
+	}
+}
+
+// testErrorMessages builds the given file for the given target and checks
+// that the build fails with exactly the errors listed in the "// ERROR: "
+// comments of the file.
+func testErrorMessages(t *testing.T, filename, target string) {
+	// Parse expected error messages.
+	expected := readErrorMessages(t, filename)
+
+	// Try to build a binary (this should fail with an error).
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	err = runBuild(filename, filepath.Join(tmpdir, "out"), &compileopts.Options{
+		Target: target,
+		Opt:    "z",
+	})
+	if err == nil {
+		t.Fatal("expected to get a compiler error")
+	}
+
+	// Write error message out as plain text.
+	var lines []string
+	printCompilerError(func(args ...interface{}) {
+		var parts []string
+		for _, arg := range args {
+			switch arg := arg.(type) {
+			case string:
+				parts = append(parts, arg)
+			case error:
+				parts = append(parts, arg.Error())
+			}
+		}
+		line := strings.Join(parts, " ")
+		line = strings.Replace(line, filepath.Join("testdata", "errors")+string(filepath.Separator), "", -1)
+		lines = append(lines, line)
+	}, err)
+	actual := strings.Join(lines, "\n")
+
+	// Check whether the error is as expected.
+	if actual != expected {
+		t.Errorf("expected error:\n%s\ngot:\n%s", indentText(expected, "> "), indentText(actual, "> "))
+	}
+}
+
+// readErrorMessages returns the expected error messages of a test file: the
+// text after each "// ERROR: " comment, one message per line.
+func readErrorMessages(t *testing.T, file string) string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal("could not read input file:", err)
+	}
+
+	var errors []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "// ERROR: ") {
+			errors = append(errors, strings.TrimRight(line[len("// ERROR: "):], "\r\n"))
+		}
+	}
+	return strings.Join(errors, "\n")
+}
+
+// indentText prefixes every line of the text with the given prefix.
+func indentText(text, indent string) string {
+	return indent + strings.Replace(text, "\n", "\n"+indent, -1)
+}
@@ -19,7 +19,12 @@ var Keys = []string{
 	"GOPATH",
 	"GOCACHE",
 	"CGO_ENABLED",
+	"CGO_CFLAGS",
 	"TINYGOROOT",
+	"TINYGOCACHE",
+	"TINYGOTARGETS",
+	"ARDUINO_DIR",
+	"ARDUINO_LIBRARIES",
 }
 
 // TINYGOROOT is the path to the final location for checking tinygo files. If
@@ -51,8 +56,12 @@ func Get(name string) string {
 		// fallback
 		home := getHomeDir()
 		return filepath.Join(home, "go")
-	case "GOCACHE":
-		// Get the cache directory, usually ~/.cache/tinygo
+	case "GOCACHE", "TINYGOCACHE":
+		// Get the cache directory, usually ~/.cache/tinygo. It can be changed
+		// with the TINYGOCACHE environment variable.
+		if dir := os.Getenv("TINYGOCACHE"); dir != "" {
+			return dir
+		}
 		dir, err := os.UserCacheDir()
 		if err != nil {
 			panic("could not find cache dir: " + err.Error())
@@ -65,8 +74,28 @@ func Get(name string) string {
 		}
 		// Default to enabling CGo.
 		return "1"
+	case "CGO_CFLAGS":
+		// Extra flags for the C compiler, for example the include paths of an
+		// SDK that is used from CGo.
+		return os.Getenv("CGO_CFLAGS")
 	case "TINYGOROOT":
 		return sourceDir()
+	case "TINYGOTARGETS":
+		// List of directories with custom target specifications, separated
+		// like PATH. These take precedence over the built-in targets.
+		return os.Getenv("TINYGOTARGETS")
+	case "ARDUINO_DIR":
+		// Directory of the Arduino platform (with the cores, variants and
+		// libraries directories) that is used with -arduino, for example
+		// ~/.arduino15/packages/arduino/hardware/avr/1.8.6.
+		return os.Getenv("ARDUINO_DIR")
+	case "ARDUINO_LIBRARIES":
+		// Directory with the Arduino libraries that were installed by the
+		// user, usually ~/Arduino/libraries.
+		if dir := os.Getenv("ARDUINO_LIBRARIES"); dir != "" {
+			return dir
+		}
+		return filepath.Join(getHomeDir(), "Arduino", "libraries")
 	default:
 		return ""
 	}
@@ -227,6 +227,12 @@ func (r *runner) run(fn *function, params []value, parentMem *memoryView, indent
 				// means that monotonic time in the time package is counted from
 				// time.Time{}.Sub(1), which should be fine.
 				locals[inst.localIndex] = literalValue{uint64(0)}
+			case callFn.name == "llvm.returnaddress" || callFn.name == "llvm.frameaddress.p0i8":
+				// Used by errors.New and fmt.Errorf with -errortrace. There is
+				// no meaningful return or frame address at compile time, so
+				// return nil (which means the address is unknown) instead of
+				// running the whole package initializer at runtime.
+				locals[inst.localIndex] = newRawValue(r.pointerSize)
 			case callFn.name == "runtime.alloc":
 				// Allocate heap memory. At compile time, this is instead done
 				// by creating a global variable.
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"io"
+)
+
+// decodeITM reads the ITM packets captured from the SWO pin of a Cortex-M chip
+// from r, and writes the data of the software packets that were sent on the
+// given stimulus port to w. All other packets (other ports, hardware source
+// packets, timestamps, synchronization and overflow packets) are skipped.
+//
+// See the ARMv7-M Architecture Reference Manual, appendix D4 "Debug ITM and
+// DWT Packet Protocol".
+func decodeITM(r io.Reader, w io.Writer, port int) error {
+	br := bufio.NewReader(r)
+	var payload [4]byte
+	for {
+		header, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch {
+		case header == 0x00 || header == 0x80:
+			// Part of a synchronization packet (a run of zero bits followed by
+			// a one bit).
+		case header == 0x70:
+			// Overflow packet: some packets were lost.
+		case header&0x03 != 0:
+			// Source packet, with 1, 2 or 4 bytes of payload. A truncated
+			// packet at the end of the input is ignored.
+			size := [4]int{0, 1, 2, 4}[header&0x03]
+			if _, err := io.ReadFull(br, payload[:size]); err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					return nil
+				}
+				return err
+			}
+			if header&0x04 == 0 && int(header>>3) == port {
+				// Software source packet (written to a stimulus port).
+				if _, err := w.Write(payload[:size]); err != nil {
+					return err
+				}
+			}
+		default:
+			// Protocol packet (timestamp or extension). If the continuation
+			// bit is set, it is followed by payload bytes until one of them
+			// doesn't have the continuation bit set.
+			for b := header; b&0x80 != 0; {
+				b, err = br.ReadByte()
+				if err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
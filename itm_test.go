@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodeITM(t *testing.T) {
+	input := []byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x80, // synchronization packet
+		0x01, 'h', // port 0, 1 byte
+		0x01, 'i', // port 0, 1 byte
+		0xc0, 0x85, 0x01, // local timestamp with two payload bytes
+		0x0b, 0x01, 0x02, 0x03, 0x04, // port 1, 4 bytes (skipped)
+		0x02, '!', '\n', // port 0, 2 bytes
+		0x70,       // overflow
+		0x05, 0xaa, // hardware source packet (skipped)
+		0x94, 0x81, 0x01, // global timestamp
+		0x03, 'o', 'k', '.', '\n', // port 0, 4 bytes
+		0x01, // truncated packet at the end
+	}
+	buf := &bytes.Buffer{}
+	err := decodeITM(bytes.NewReader(input), buf, 0)
+	if err != nil {
+		t.Fatal("could not decode ITM data:", err)
+	}
+	if buf.String() != "hi!\nok.\n" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}
@@ -0,0 +1,274 @@
+package loader
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EmbedFile is a file that is embedded in the program with a //go:embed
+// directive.
+type EmbedFile struct {
+	Name string   // path relative to the package directory, using forward slashes
+	Data []byte   // contents of the file
+	Hash [16]byte // truncated SHA-256 hash, as used by the embed package
+}
+
+// extractEmbedLines looks for //go:embed directives in the package, checks
+// that they are valid and reads the files they refer to into EmbedGlobals. The
+// files that match the patterns of the package have already been listed by
+// `go list` in EmbedFiles.
+func (p *Package) extractEmbedLines() []error {
+	var errs []error
+	addError := func(pos token.Pos, msg string) {
+		errs = append(errs, types.Error{
+			Fset: p.program.fset,
+			Pos:  pos,
+			Msg:  msg,
+		})
+	}
+	for _, file := range p.Files {
+		// Directives that are not directly above a single var declaration
+		// are an error.
+		used := make(map[*ast.Comment]bool)
+
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.ValueSpec)
+				doc := spec.Doc
+				if doc == nil && !decl.Lparen.IsValid() {
+					doc = decl.Doc
+				}
+				if doc == nil {
+					continue
+				}
+				var patterns []string
+				var directivePos token.Pos
+				for _, comment := range doc.List {
+					if !strings.HasPrefix(comment.Text, "//go:embed ") {
+						continue
+					}
+					used[comment] = true
+					if !directivePos.IsValid() {
+						directivePos = comment.Pos()
+					}
+					parsed, err := parseEmbedPatterns(comment.Text[len("//go:embed "):])
+					if err != nil {
+						addError(comment.Pos(), "invalid go:embed: "+err.Error())
+						continue
+					}
+					patterns = append(patterns, parsed...)
+				}
+				if !directivePos.IsValid() {
+					continue
+				}
+				if !hasEmbedImport(file) {
+					addError(directivePos, `go:embed only allowed in Go files that import "embed"`)
+					continue
+				}
+				if len(spec.Names) != 1 {
+					addError(directivePos, "go:embed cannot apply to multiple vars")
+					continue
+				}
+				if len(spec.Values) != 0 {
+					addError(directivePos, "go:embed cannot apply to var with initializer")
+					continue
+				}
+				name := spec.Names[0]
+				typ := p.info.Defs[name].Type()
+				isFS := isEmbedFS(typ)
+				if !isFS && !isStringOrBytes(typ) {
+					addError(name.Pos(), "go:embed cannot apply to var of type "+typ.String())
+					continue
+				}
+				files, err := p.embedFiles(patterns, isFS)
+				if err != nil {
+					addError(directivePos, err.Error())
+					continue
+				}
+				if !isFS && len(files) != 1 {
+					addError(directivePos, "invalid go:embed: multiple files for type "+typ.String())
+					continue
+				}
+				if p.EmbedGlobals == nil {
+					p.EmbedGlobals = make(map[string][]*EmbedFile)
+				}
+				p.EmbedGlobals[name.Name] = files
+			}
+		}
+
+		for _, group := range file.Comments {
+			for _, comment := range group.List {
+				if strings.HasPrefix(comment.Text, "//go:embed ") && !used[comment] {
+					addError(comment.Pos(), "misplaced go:embed directive")
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// embedFiles reads the files listed by `go list` that match one of the given
+// patterns. Only an embed.FS can contain directories, and every pattern must
+// match at least one file.
+func (p *Package) embedFiles(patterns []string, allowDirs bool) ([]*EmbedFile, error) {
+	var files []*EmbedFile
+	patternMatched := make([]bool, len(patterns))
+	for _, name := range p.EmbedFiles {
+		matched := false
+		for i, pattern := range patterns {
+			match, inDir := matchEmbedPattern(pattern, name)
+			if match && inDir && !allowDirs {
+				return nil, errors.New("pattern " + pattern + ": cannot embed directory " + path.Dir(name) + ": not an embed.FS")
+			}
+			if match {
+				patternMatched[i] = true
+				matched = true
+			}
+		}
+		if !matched {
+			continue
+		}
+		filePath := filepath.Join(p.Dir, filepath.FromSlash(name))
+		data, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		// Rebuild the package when an embedded file changes.
+		sum := sha512.Sum512_224(data)
+		p.FileHashes[filePath] = sum[:]
+
+		file := &EmbedFile{
+			Name: name,
+			Data: data,
+		}
+		hash := sha256.Sum256(data)
+		copy(file.Hash[:], hash[:])
+		files = append(files, file)
+	}
+	for i, pattern := range patterns {
+		if !patternMatched[i] {
+			return nil, errors.New("pattern " + pattern + ": no matching files found")
+		}
+	}
+	return files, nil
+}
+
+// matchEmbedPattern returns whether the file matches the pattern, either
+// directly or because it is inside a directory that matches the pattern. Files
+// inside a directory are skipped if their name (or the name of a directory in
+// between) starts with '.' or '_', like the go command does.
+func matchEmbedPattern(pattern, file string) (match, inDir bool) {
+	name := file
+	for {
+		if ok, _ := path.Match(pattern, name); ok {
+			if name == file {
+				return true, false
+			}
+			for _, elem := range strings.Split(file[len(name)+1:], "/") {
+				if elem[0] == '.' || elem[0] == '_' {
+					return false, false
+				}
+			}
+			return true, true
+		}
+		i := strings.LastIndexByte(name, '/')
+		if i < 0 {
+			return false, false
+		}
+		name = name[:i]
+	}
+}
+
+// parseEmbedPatterns splits the arguments of a //go:embed directive into
+// patterns. Patterns are separated by spaces and may be quoted as a Go string
+// literal.
+func parseEmbedPatterns(args string) ([]string, error) {
+	var patterns []string
+	for {
+		args = strings.TrimLeftFunc(args, unicode.IsSpace)
+		if args == "" {
+			break
+		}
+		var pattern string
+		switch args[0] {
+		case '"', '`':
+			i := 1
+			for ; i < len(args); i++ {
+				if args[0] == '"' && args[i] == '\\' {
+					i++ // skip escaped character
+					continue
+				}
+				if args[i] == args[0] {
+					break
+				}
+			}
+			if i >= len(args) {
+				return nil, errors.New("unterminated quoted string")
+			}
+			unquoted, err := strconv.Unquote(args[:i+1])
+			if err != nil {
+				return nil, errors.New("invalid quoted string: " + args[:i+1])
+			}
+			pattern = unquoted
+			args = args[i+1:]
+		default:
+			i := strings.IndexFunc(args, unicode.IsSpace)
+			if i < 0 {
+				i = len(args)
+			}
+			pattern = args[:i]
+			args = args[i:]
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.New("invalid pattern syntax: " + pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("no patterns")
+	}
+	return patterns, nil
+}
+
+// hasEmbedImport returns whether the file imports the embed package.
+func hasEmbedImport(file *ast.File) bool {
+	for _, spec := range file.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err == nil && path == "embed" {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmbedFS returns whether the type is embed.FS.
+func isEmbedFS(typ types.Type) bool {
+	named, ok := typ.(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "embed" && named.Obj().Name() == "FS"
+}
+
+// isStringOrBytes returns whether the type is a string or a byte slice (or a
+// named type with one of those as the underlying type).
+func isStringOrBytes(typ types.Type) bool {
+	switch typ := typ.Underlying().(type) {
+	case *types.Basic:
+		return typ.Kind() == types.String
+	case *types.Slice:
+		elem, ok := typ.Elem().Underlying().(*types.Basic)
+		return ok && elem.Kind() == types.Byte
+	}
+	return false
+}
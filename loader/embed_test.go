@@ -0,0 +1,80 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Test the files selected by //go:embed patterns, from the files listed by
+// `go list` in EmbedFiles.
+func TestEmbedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinygo-embed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	embedFiles := []string{"a.txt", "dir/b.txt", "dir/sub/c.txt"}
+	for _, name := range embedFiles {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0777)
+		err := ioutil.WriteFile(path, []byte(name), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		patterns  []string
+		allowDirs bool
+		files     []string
+		err       string
+	}{
+		{patterns: []string{"a.txt"}, files: []string{"a.txt"}},
+		{patterns: []string{"*.txt", "dir/b.txt"}, files: []string{"a.txt", "dir/b.txt"}},
+		{patterns: []string{"dir"}, allowDirs: true, files: []string{"dir/b.txt", "dir/sub/c.txt"}},
+		{patterns: []string{"dir"}, err: "pattern dir: cannot embed directory dir: not an embed.FS"},
+		{patterns: []string{"a.txt", "missing*"}, err: "pattern missing*: no matching files found"},
+	} {
+		p := &Package{
+			PackageJSON: PackageJSON{Dir: dir, EmbedFiles: embedFiles},
+			FileHashes:  make(map[string][]byte),
+		}
+		files, err := p.embedFiles(tc.patterns, tc.allowDirs)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%v: expected error %q, got %v", tc.patterns, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.patterns, err)
+			continue
+		}
+		var names []string
+		for _, file := range files {
+			names = append(names, file.Name)
+			if string(file.Data) != file.Name {
+				t.Errorf("%v: unexpected contents of %s: %q", tc.patterns, file.Name, file.Data)
+			}
+		}
+		if !reflect.DeepEqual(names, tc.files) {
+			t.Errorf("%v: expected files %v, got %v", tc.patterns, tc.files, names)
+		}
+	}
+}
+
+// Test that the files embedded by *_test.go files are added to the test
+// packages, also when `go list` already lists (some of) them.
+func TestMergeEmbedFiles(t *testing.T) {
+	merged := mergeEmbedFiles([]string{"b.txt", "testdata/x.txt"}, []string{"a.txt", "testdata/x.txt"})
+	expected := []string{"a.txt", "b.txt", "testdata/x.txt"}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %v, got %v", expected, merged)
+	}
+	if merged := mergeEmbedFiles(nil, nil); merged != nil {
+		t.Errorf("expected no files, got %v", merged)
+	}
+}
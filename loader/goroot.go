@@ -92,6 +92,12 @@ func GetCachedGoroot(config *compileopts.Config) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	// The compressed case mapping tables of the unicode package are generated
+	// from this GOROOT, so that they match its Unicode version.
+	err = writeCaseTables(goroot, filepath.Join(tmpgoroot, "src", "unicode", "casemap_tables.go"))
+	if err != nil {
+		return "", err
+	}
 	err = os.Rename(tmpgoroot, cachedgoroot)
 	if err != nil {
 		if os.IsExist(err) {
@@ -139,6 +145,7 @@ func mergeDirectory(goroot, tinygoroot, tmpgoroot, importPath string, overrides
 		if err != nil {
 			return err
 		}
+		tinygoFiles := map[string]bool{}
 		for _, e := range tinygoEntries {
 			if e.IsDir() {
 				// A directory, so merge this thing.
@@ -148,6 +155,7 @@ func mergeDirectory(goroot, tinygoroot, tmpgoroot, importPath string, overrides
 				}
 			} else {
 				// A file, so symlink this.
+				tinygoFiles[e.Name()] = true
 				newname := filepath.Join(tmpgoroot, "src", importPath, e.Name())
 				oldname := filepath.Join(tinygoroot, "src", importPath, e.Name())
 				err := symlink(oldname, newname)
@@ -165,8 +173,27 @@ func mergeDirectory(goroot, tinygoroot, tmpgoroot, importPath string, overrides
 		}
 		for _, e := range gorootEntries {
 			if !e.IsDir() {
-				// Don't merge in files from Go. Otherwise we'd end up with a
-				// weird syscall package with files from both roots.
+				if filesToOverride[importPath+"/"] {
+					// Only some files in this package are replaced by TinyGo,
+					// take all other files from Go.
+					if tinygoFiles[e.Name()] {
+						continue
+					}
+				} else if len(tinygoFiles) != 0 {
+					// Don't merge in files from Go. Otherwise we'd end up
+					// with a weird syscall package with files from both
+					// roots.
+					continue
+				}
+				// TinyGo only overrides some subdirectories of this
+				// directory (for example crypto/rand in crypto), so keep the
+				// package in this directory itself.
+				newname := filepath.Join(tmpgoroot, "src", importPath, e.Name())
+				oldname := filepath.Join(goroot, "src", importPath, e.Name())
+				err := symlink(oldname, newname)
+				if err != nil {
+					return err
+				}
 				continue
 			}
 			if _, ok := overrides[path.Join(importPath, e.Name())+"/"]; ok {
@@ -201,18 +228,25 @@ func needsSyscallPackage(buildTags []string) bool {
 func pathsToOverride(needsSyscallPackage bool) map[string]bool {
 	paths := map[string]bool{
 		"/":                     true,
+		"crypto/":               true,
+		"crypto/rand/":          false,
 		"device/":               false,
+		"errors/":               true,
 		"examples/":             false,
+		"fmt/":                  true,
 		"internal/":             true,
 		"internal/bytealg/":     false,
+		"internal/errortrace/":  false,
 		"internal/reflectlite/": false,
 		"internal/task/":        false,
 		"machine/":              false,
 		"os/":                   true,
 		"reflect/":              false,
 		"runtime/":              false,
+		"strconv/":              true,
 		"sync/":                 true,
 		"testing/":              true,
+		"unicode/":              true,
 	}
 	if needsSyscallPackage {
 		paths["syscall/"] = true // include syscall/js
@@ -220,6 +254,17 @@ func pathsToOverride(needsSyscallPackage bool) map[string]bool {
 	return paths
 }
 
+// Packages in which TinyGo replaces individual files instead of the whole
+// package. A file in the TinyGo root replaces the file with the same name in the
+// Go root, all other files are taken from the Go root. These packages must also
+// be listed (as merged directories) in pathsToOverride.
+var filesToOverride = map[string]bool{
+	"errors/":  true, // errors.go
+	"fmt/":     true, // errors.go
+	"strconv/": true, // ftoa.go
+	"unicode/": true, // letter.go
+}
+
 // symlink creates a symlink or something similar. On Unix-like systems, it
 // always creates a symlink. On Windows, it tries to create a symlink and if
 // that fails, creates a hardlink or directory junction instead.
@@ -16,6 +16,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -51,6 +52,12 @@ type PackageJSON struct {
 	GoFiles  []string
 	CgoFiles []string
 	CFiles   []string
+	CXXFiles []string
+
+	// Embedded files
+	EmbedFiles      []string
+	TestEmbedFiles  []string
+	XTestEmbedFiles []string
 
 	// Dependency information
 	Imports   []string
@@ -74,6 +81,10 @@ type Package struct {
 	CFlags     []string // CFlags used during CGo preprocessing (only set if CGo is used)
 	Pkg        *types.Package
 	info       types.Info
+
+	// Files embedded with //go:embed, by the name of the global they are
+	// embedded in.
+	EmbedGlobals map[string][]*EmbedFile
 }
 
 // Load loads the given package with all dependencies (including the runtime
@@ -98,6 +109,13 @@ func Load(config *compileopts.Config, inputPkgs []string, clangHeaders string, t
 		fset:         token.NewFileSet(),
 	}
 
+	// Include the package that implements the OS backend, if the target
+	// needs one. It is listed first so that the main package stays the last
+	// package in the list.
+	if osPackage := config.OSPackage(); osPackage != "" {
+		inputPkgs = append([]string{osPackage}, inputPkgs...)
+	}
+
 	// List the dependencies of this package, in raw JSON format.
 	extraArgs := []string{"-json", "-deps"}
 	if config.TestConfig.CompileTestBinary {
@@ -192,6 +210,16 @@ func Load(config *compileopts.Config, inputPkgs []string, clangHeaders string, t
 			// breakage to //go:linkname. Additionally, the duplicated package
 			// slows down the build and so is best removed.
 			if pkg.ForTest != "" && strings.HasSuffix(pkg.ImportPath, " ["+pkg.ForTest+".test]") {
+				if tested, ok := p.Packages[pkg.ForTest]; ok {
+					// Files embedded by the *_test.go files are listed
+					// separately in the package under test, not always in
+					// EmbedFiles of the test packages.
+					if pkg.Name == tested.Name {
+						pkg.EmbedFiles = mergeEmbedFiles(pkg.EmbedFiles, tested.TestEmbedFiles)
+					} else {
+						pkg.EmbedFiles = mergeEmbedFiles(pkg.EmbedFiles, tested.XTestEmbedFiles)
+					}
+				}
 				newImportPath := pkg.ImportPath[:len(pkg.ImportPath)-len(" ["+pkg.ForTest+".test]")]
 				if _, ok := p.Packages[newImportPath]; ok {
 					// Delete the previous package (that this package overrides).
@@ -219,6 +247,23 @@ func Load(config *compileopts.Config, inputPkgs []string, clangHeaders string, t
 	return p, nil
 }
 
+// mergeEmbedFiles returns the sorted list of files that are in either list,
+// without duplicates.
+func mergeEmbedFiles(files, extra []string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, list := range [][]string{files, extra} {
+		for _, file := range list {
+			if !seen[file] {
+				seen[file] = true
+				merged = append(merged, file)
+			}
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
 // getOriginalPath looks whether this path is in the generated GOROOT and if so,
 // replaces the path with the original path (in GOROOT or TINYGOROOT). Otherwise
 // the input path is returned.
@@ -358,6 +403,9 @@ func (p *Package) Check() error {
 		}
 		return Errors{p, typeErrors}
 	}
+	if errs := p.extractEmbedLines(); len(errs) != 0 {
+		return Errors{p, errs}
+	}
 	p.Pkg = typesPkg
 	return nil
 }
@@ -390,11 +438,17 @@ func (p *Package) parseFiles() ([]*ast.File, error) {
 	if len(p.CgoFiles) != 0 {
 		var initialCFlags []string
 		initialCFlags = append(initialCFlags, p.program.config.CFlags()...)
+		cgoCFlags, err := p.program.config.CGoCFlags()
+		if err != nil {
+			return nil, err
+		}
+		initialCFlags = append(initialCFlags, cgoCFlags...)
 		initialCFlags = append(initialCFlags, "-I"+p.Dir)
 		if p.program.clangHeaders != "" {
 			initialCFlags = append(initialCFlags, "-Xclang", "-internal-isystem", "-Xclang", p.program.clangHeaders)
 		}
-		generated, cflags, ldflags, accessedFiles, errs := cgo.Process(files, p.program.workingDir, p.program.fset, initialCFlags)
+		tags := append([]string{p.program.config.GOOS(), p.program.config.GOARCH(), "cgo"}, p.program.config.BuildTags()...)
+		generated, cflags, ldflags, accessedFiles, errs := cgo.Process(files, p.program.workingDir, p.program.fset, initialCFlags, tags)
 		p.CFlags = append(initialCFlags, cflags...)
 		for path, hash := range accessedFiles {
 			p.FileHashes[path] = hash
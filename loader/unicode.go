@@ -0,0 +1,302 @@
+package loader
+
+// This file generates the compressed case mapping tables for the unicode
+// package in the TinyGo standard library overlay (src/unicode/casemap.go). They
+// are derived from the CaseRanges table in the unicode package of the GOROOT
+// in use, so that they always match its Unicode version (unicode.Version).
+//
+// The upstream unicode.CaseRanges table is a slice of CaseRange structs of 20
+// bytes each. Instead, the case ranges are split into blocks of 256 runes and
+// delta encoded into a byte string. Looking up a rune is done in two levels: a
+// table with one byte per block gives the number of the block (or 0 for blocks
+// without case ranges), which is used to find the start of the data for this
+// block. Only the ranges of this single block need to be decoded.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+)
+
+// Number of runes in a block (as a shift), see caseBlockShift in
+// src/unicode/casemap.go.
+const caseBlockShift = 8
+
+// Kinds of case ranges, see src/unicode/casemap.go.
+const (
+	caseKindUpperLower    = iota // alternating upper and lower case runes
+	caseKindUpperLowerOdd        // same, but starting with a lower case rune
+	caseKindUpper                // upper case runes: {0, x, 0}
+	caseKindLower                // lower case runes: {x, 0, x}
+	caseKindOther                // any other delta: {x, y, z}
+)
+
+// Indices into the delta of a case range, and the special delta value for
+// alternating upper and lower case runes, as in the unicode package.
+const (
+	upperCase  = 0
+	lowerCase  = 1
+	titleCase  = 2
+	upperLower = 0x10FFFF + 1
+)
+
+// caseRange is a range of the CaseRanges table, possibly split at a block
+// boundary.
+type caseRange struct {
+	lo, hi rune
+	kind   byte
+	delta  [3]rune
+}
+
+// writeCaseTables reads the CaseRanges table from the unicode package in the
+// given GOROOT and writes the compressed tables to outpath.
+func writeCaseTables(goroot, outpath string) error {
+	ranges, version, err := readCaseRanges(filepath.Join(goroot, "src", "unicode", "tables.go"))
+	if err != nil {
+		return err
+	}
+	data, err := caseTables(ranges, version)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outpath, data, 0666)
+}
+
+// readCaseRanges parses the given tables.go file of the unicode package and
+// returns the ranges of its CaseRanges table and its Unicode version.
+func readCaseRanges(path string) ([]caseRange, string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	var ranges []caseRange
+	var version string
+	for _, decl := range file.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range decl.Specs {
+			spec, ok := spec.(*ast.ValueSpec)
+			if !ok || len(spec.Names) != 1 || len(spec.Values) != 1 {
+				continue
+			}
+			switch spec.Names[0].Name {
+			case "Version":
+				lit, ok := spec.Values[0].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return nil, "", fmt.Errorf("%s: unexpected unicode.Version", path)
+				}
+				version, _ = strconv.Unquote(lit.Value)
+			case "_CaseRanges":
+				table, ok := spec.Values[0].(*ast.CompositeLit)
+				if !ok {
+					return nil, "", fmt.Errorf("%s: unexpected CaseRanges table", path)
+				}
+				for _, elt := range table.Elts {
+					cr, err := parseCaseRange(elt)
+					if err != nil {
+						return nil, "", fmt.Errorf("%s: %w", path, err)
+					}
+					ranges = append(ranges, cr)
+				}
+			}
+		}
+	}
+	if version == "" || len(ranges) == 0 {
+		return nil, "", fmt.Errorf("%s: could not find the CaseRanges table", path)
+	}
+	return ranges, version, nil
+}
+
+// parseCaseRange parses a single entry of the CaseRanges table, such as
+// {0x0041, 0x005A, d{0, 32, 0}}.
+func parseCaseRange(expr ast.Expr) (caseRange, error) {
+	errInvalid := errors.New("unexpected entry in CaseRanges table")
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok || len(lit.Elts) != 3 {
+		return caseRange{}, errInvalid
+	}
+	lo, err1 := parseRune(lit.Elts[0])
+	hi, err2 := parseRune(lit.Elts[1])
+	delta, ok := lit.Elts[2].(*ast.CompositeLit)
+	if err1 != nil || err2 != nil || !ok || len(delta.Elts) != 3 {
+		return caseRange{}, errInvalid
+	}
+	cr := caseRange{lo: lo, hi: hi}
+	for i, elt := range delta.Elts {
+		value, err := parseRune(elt)
+		if err != nil {
+			return caseRange{}, errInvalid
+		}
+		cr.delta[i] = value
+	}
+	return cr, nil
+}
+
+// parseRune parses an integer constant in the CaseRanges table, which may be
+// negative or the UpperLower constant.
+func parseRune(expr ast.Expr) (rune, error) {
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		value, err := strconv.ParseInt(expr.Value, 0, 32)
+		return rune(value), err
+	case *ast.UnaryExpr:
+		value, err := parseRune(expr.X)
+		if expr.Op != token.SUB {
+			return 0, errors.New("unexpected operator")
+		}
+		return -value, err
+	case *ast.Ident:
+		if expr.Name == "UpperLower" {
+			return upperLower, nil
+		}
+	}
+	return 0, errors.New("unexpected expression")
+}
+
+// caseTables returns the source code of casemap_tables.go for the given case
+// ranges.
+func caseTables(ranges []caseRange, version string) ([]byte, error) {
+	// Split all ranges at block boundaries, so that every block can be decoded
+	// on its own.
+	var blocks [][]caseRange
+	for _, cr := range ranges {
+		lo, hi := cr.lo, cr.hi
+		for lo <= hi {
+			block := int(lo >> caseBlockShift)
+			end := rune(block+1)<<caseBlockShift - 1
+			if end > hi {
+				end = hi
+			}
+			r := caseRange{lo: lo, hi: end, delta: cr.delta}
+			switch delta := cr.delta; {
+			case delta[upperCase] == upperLower:
+				r.kind = caseKindUpperLower
+				if (lo-cr.lo)%2 != 0 {
+					r.kind = caseKindUpperLowerOdd
+				}
+			case delta[upperCase] == 0 && delta[titleCase] == 0:
+				r.kind = caseKindUpper
+			case delta[lowerCase] == 0 && delta[upperCase] == delta[titleCase]:
+				r.kind = caseKindLower
+			default:
+				r.kind = caseKindOther
+			}
+			for len(blocks) <= block {
+				blocks = append(blocks, nil)
+			}
+			blocks[block] = append(blocks[block], r)
+			lo = end + 1
+		}
+	}
+
+	// Encode each block as a list of (gap, length, kind, deltas) entries,
+	// where the gap is the distance from the end of the previous range (or
+	// the start of the block) and the length is the number of runes in the
+	// range minus one.
+	var caseData, blockNumbers, index []byte
+	for i, block := range blocks {
+		if len(block) == 0 {
+			blockNumbers = append(blockNumbers, 0)
+			continue
+		}
+		if len(index)/2 >= 0xff {
+			return nil, errors.New("too many blocks for 8-bit block numbers")
+		}
+		offset := len(caseData)
+		if offset > 0xffff {
+			return nil, errors.New("case data too big for 16-bit index")
+		}
+		index = append(index, byte(offset), byte(offset>>8))
+		blockNumbers = append(blockNumbers, byte(len(index)/2))
+		next := rune(i) << caseBlockShift
+		for _, cr := range block {
+			caseData = appendUvarint(caseData, uint32(cr.lo-next))
+			caseData = appendUvarint(caseData, uint32(cr.hi-cr.lo))
+			caseData = append(caseData, cr.kind)
+			switch cr.kind {
+			case caseKindUpper:
+				caseData = appendVarint(caseData, cr.delta[lowerCase])
+			case caseKindLower:
+				caseData = appendVarint(caseData, cr.delta[upperCase])
+			case caseKindOther:
+				for _, delta := range cr.delta {
+					caseData = appendVarint(caseData, delta)
+				}
+			}
+			next = cr.hi + 1
+		}
+	}
+	// Add the end of the last block.
+	index = append(index, byte(len(caseData)), byte(len(caseData)>>8))
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, `// Code generated by TinyGo from the CaseRanges table of Unicode %s; DO NOT EDIT.
+
+package unicode
+
+// Size of the upstream CaseRanges table: %d ranges (%d bytes).
+// Size of the compressed tables: %d bytes.
+
+const caseBlockShift = %d
+
+// Block number for each block of runes, or 0 if there are no case ranges in
+// the block. Runes beyond the end of this table have no case mapping.
+const caseBlocks = %s
+
+// Start of the data for each (non-empty) block in caseData, as little endian
+// 16-bit offsets. The entry after the last block is the end of caseData.
+const caseIndex = %s
+
+// Delta encoded case ranges, see casemap.go for the format.
+const caseData = %s
+`, version, len(ranges), len(ranges)*20, len(blockNumbers)+len(index)+len(caseData), caseBlockShift, formatByteString(blockNumbers), formatByteString(index), formatByteString(caseData))
+	return format.Source(buf.Bytes())
+}
+
+// appendUvarint appends x as a variable length integer with 7 bits per byte,
+// least significant group first.
+func appendUvarint(buf []byte, x uint32) []byte {
+	for x >= 0x80 {
+		buf = append(buf, byte(x)|0x80)
+		x >>= 7
+	}
+	return append(buf, byte(x))
+}
+
+// appendVarint appends x as a zigzag encoded variable length integer.
+func appendVarint(buf []byte, x rune) []byte {
+	return appendUvarint(buf, uint32(x<<1)^uint32(x>>31))
+}
+
+// formatByteString formats data as a string literal, split over multiple lines
+// to keep the generated file readable.
+func formatByteString(data []byte) string {
+	buf := &bytes.Buffer{}
+	for i := 0; i < len(data); i += 32 {
+		end := i + 32
+		if end > len(data) {
+			end = len(data)
+		}
+		if i != 0 {
+			buf.WriteString(" +\n\t")
+		}
+		buf.WriteByte('"')
+		for _, c := range data[i:end] {
+			fmt.Fprintf(buf, "\\x%02x", c)
+		}
+		buf.WriteByte('"')
+	}
+	if len(data) == 0 {
+		return `""`
+	}
+	return buf.String()
+}
@@ -0,0 +1,40 @@
+package loader
+
+import (
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"unicode"
+)
+
+// Test that the case ranges are read correctly from the GOROOT of the Go
+// toolchain running this test, by comparing them with its unicode package.
+func TestReadCaseRanges(t *testing.T) {
+	ranges, version, err := readCaseRanges(filepath.Join(runtime.GOROOT(), "src", "unicode", "tables.go"))
+	if err != nil {
+		t.Fatal("could not read case ranges:", err)
+	}
+	if version != unicode.Version {
+		t.Errorf("expected Unicode version %s, got %s", unicode.Version, version)
+	}
+	if len(ranges) != len(unicode.CaseRanges) {
+		t.Fatalf("expected %d case ranges, got %d", len(unicode.CaseRanges), len(ranges))
+	}
+	for i, cr := range unicode.CaseRanges {
+		if ranges[i].lo != rune(cr.Lo) || ranges[i].hi != rune(cr.Hi) || ranges[i].delta != cr.Delta {
+			t.Errorf("case range %d: expected %v, got %v", i, cr, ranges[i])
+		}
+	}
+
+	// The generated tables must be valid Go code.
+	data, err := caseTables(ranges, version)
+	if err != nil {
+		t.Fatal("could not create case tables:", err)
+	}
+	_, err = parser.ParseFile(token.NewFileSet(), "casemap_tables.go", data, 0)
+	if err != nil {
+		t.Error("generated case tables do not parse:", err)
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"debug/elf"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,24 +12,30 @@ import (
 	"go/types"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/google/shlex"
+	"github.com/marcinbor85/gohex"
 	"github.com/mattn/go-colorable"
 	"github.com/tinygo-org/tinygo/builder"
 	"github.com/tinygo-org/tinygo/compileopts"
 	"github.com/tinygo-org/tinygo/goenv"
 	"github.com/tinygo-org/tinygo/interp"
 	"github.com/tinygo-org/tinygo/loader"
+	"github.com/tinygo-org/tinygo/stlink"
 	"github.com/tinygo-org/tinygo/transform"
+	"github.com/tinygo-org/tinygo/vet"
 	"tinygo.org/x/go-llvm"
 
 	"go.bug.st/serial"
@@ -137,16 +146,39 @@ func Build(pkgName, outpath string, options *compileopts.Options) error {
 }
 
 // Test runs the tests in the given package. Returns whether the test passed and
-// possibly an error if the test failed to run.
-func Test(pkgName string, options *compileopts.Options, testCompileOnly bool, outpath string) (bool, error) {
+// possibly an error if the test failed to run. With -flash, the test is flashed
+// to the device and its output is read from the serial port (see
+// runDeviceTest).
+func Test(pkgName, port string, options *compileopts.Options, testCompileOnly bool, outpath string) (bool, error) {
 	options.TestConfig.CompileTestBinary = true
+	if options.TestConfig.Flash && len(options.Args) == 0 {
+		// A device has no command line, so bake the test flags into the
+		// binary instead. The options are copied, as they are shared by all
+		// packages that are tested.
+		copied := *options
+		copied.Args = testFlags(options.TestConfig)
+		options = &copied
+	}
 	config, err := builder.NewConfig(options)
 	if err != nil {
 		return false, err
 	}
 
+	// With -flash, build a binary that can be flashed to the device.
+	var flashMethod, fileExt string
+	buildOutpath := outpath
+	if config.TestConfig.Flash {
+		flashMethod, fileExt, err = flashFileExt(config)
+		if err != nil {
+			return false, err
+		}
+		if buildOutpath == "" {
+			buildOutpath = fileExt
+		}
+	}
+
 	var passed bool
-	err = builder.Build(pkgName, outpath, config, func(result builder.BuildResult) error {
+	err = builder.Build(pkgName, buildOutpath, config, func(result builder.BuildResult) error {
 		if testCompileOnly || outpath != "" {
 			// Write test binary to the specified file name.
 			if outpath == "" {
@@ -161,21 +193,53 @@ func Test(pkgName string, options *compileopts.Options, testCompileOnly bool, ou
 			return nil
 		}
 
-		// Run the test.
+		// Run the test. With -cover, the coverage data is filtered out of
+		// the test output.
+		var stdout io.Writer = os.Stdout
+		var cover *coverageWriter
+		if config.TestConfig.Cover {
+			cover = &coverageWriter{out: os.Stdout}
+			stdout = cover
+		}
 		start := time.Now()
 		var err error
-		passed, err = runPackageTest(config, result)
+		if config.TestConfig.Flash {
+			passed, err = runDeviceTest(config, result, flashMethod, fileExt, port, stdout)
+		} else {
+			passed, err = runPackageTest(config, result, stdout)
+		}
 		if err != nil {
 			return err
 		}
 		duration := time.Since(start)
 
+		var coverage string
+		var fileCoverage map[string]float64
+		if cover != nil {
+			err := cover.Flush()
+			if err != nil {
+				return err
+			}
+			var total float64
+			total, fileCoverage, err = cover.coverage()
+			if err != nil {
+				return err
+			}
+			coverage = fmt.Sprintf("\tcoverage: %.1f%% of statements", total)
+		}
+
 		// Print the result.
 		importPath := strings.TrimSuffix(result.ImportPath, ".test")
 		if passed {
-			fmt.Printf("ok  \t%s\t%.3fs\n", importPath, duration.Seconds())
+			fmt.Printf("ok  \t%s\t%.3fs%s\n", importPath, duration.Seconds(), coverage)
 		} else {
-			fmt.Printf("FAIL\t%s\t%.3fs\n", importPath, duration.Seconds())
+			fmt.Printf("FAIL\t%s\t%.3fs%s\n", importPath, duration.Seconds(), coverage)
+		}
+		if cover != nil {
+			printFileCoverage(fileCoverage)
+			if config.TestConfig.CoverProfile != "" {
+				return cover.writeProfile(config.TestConfig.CoverProfile)
+			}
 		}
 		return nil
 	})
@@ -187,14 +251,33 @@ func Test(pkgName string, options *compileopts.Options, testCompileOnly bool, ou
 	return passed, err
 }
 
+// testFlags returns the flags to pass to the test binary, such as -test.v.
+func testFlags(testConfig compileopts.TestConfig) []string {
+	var flags []string
+	if testConfig.Verbose {
+		flags = append(flags, "-test.v")
+	}
+	if testConfig.Short {
+		flags = append(flags, "-test.short")
+	}
+	if testConfig.RunRegexp != "" {
+		flags = append(flags, "-test.run="+testConfig.RunRegexp)
+	}
+	return flags
+}
+
 // runPackageTest runs a test binary that was previously built. The return
 // values are whether the test passed and any errors encountered while trying to
-// run the binary.
-func runPackageTest(config *compileopts.Config, result builder.BuildResult) (bool, error) {
+// run the binary. All output of the test binary is written to stdout.
+func runPackageTest(config *compileopts.Config, result builder.BuildResult, stdout io.Writer) (bool, error) {
+	// Pass the test flags to the test binary. This only works on targets with
+	// command line arguments, not on baremetal targets.
+	flags := testFlags(config.TestConfig)
+
 	if len(config.Target.Emulator) == 0 {
 		// Run directly.
-		cmd := executeCommand(config.Options, result.Binary)
-		cmd.Stdout = os.Stdout
+		cmd := executeCommand(config.Options, result.Binary, flags...)
+		cmd.Stdout = stdout
 		cmd.Stderr = os.Stderr
 		cmd.Dir = result.MainDir
 		err := cmd.Run()
@@ -209,20 +292,32 @@ func runPackageTest(config *compileopts.Config, result builder.BuildResult) (boo
 		return true, nil
 	} else {
 		// Run in an emulator.
-		args := append(config.Target.Emulator[1:], result.Binary)
+		args, err := emulatorArgs(config, result, 0)
+		if err != nil {
+			return false, err
+		}
+		isBaremetal := false
+		for _, tag := range config.BuildTags() {
+			if tag == "baremetal" {
+				isBaremetal = true
+			}
+		}
+		if !isBaremetal {
+			args = append(args, flags...)
+		}
 		cmd := executeCommand(config.Options, config.Target.Emulator[0], args...)
 		buf := &bytes.Buffer{}
-		w := io.MultiWriter(os.Stdout, buf)
+		w := io.MultiWriter(stdout, buf)
 		cmd.Stdout = w
 		cmd.Stderr = os.Stderr
-		err := cmd.Run()
+		err = cmd.Run()
 		if err != nil {
 			if err, ok := err.(*exec.ExitError); !ok || !err.Exited() {
 				// Workaround for QEMU which always exits with an error.
 				return false, &commandError{"failed to run emulator with", result.Binary, err}
 			}
 		}
-		testOutput := string(buf.Bytes())
+		testOutput := stripCoverageData(string(buf.Bytes()))
 		if testOutput == "PASS\n" || strings.HasSuffix(testOutput, "\nPASS\n") {
 			// Test passed.
 			return true, nil
@@ -234,17 +329,212 @@ func runPackageTest(config *compileopts.Config, result builder.BuildResult) (boo
 	}
 }
 
-// Flash builds and flashes the built binary to the given serial port.
-func Flash(pkgName, port string, options *compileopts.Options) error {
+// Maximum time a test may run on a device. Unlike a test that runs on the host
+// or in an emulator there is no process that exits, so a test that hangs would
+// otherwise block forever.
+const deviceTestTimeout = 10 * time.Minute
+
+// runDeviceTest flashes a test binary that was previously built to the device
+// and reads the test output from its serial port, until the test passes or
+// fails. The return values are whether the test passed and any errors
+// encountered while flashing or reading the output. All output of the test is
+// written to stdout.
+//
+// The serial port is opened before flashing, so that no output is lost when
+// the test starts running right after flashing. That isn't possible when the
+// flash method uses the serial port itself: then it is opened afterwards.
+func runDeviceTest(config *compileopts.Config, result builder.BuildResult, flashMethod, fileExt, port string, stdout io.Writer) (bool, error) {
+	var p serial.Port
+	var err error
+	if !flashUsesSerialPort(config, flashMethod) {
+		p, err = openSerialPort(port, config)
+		if err != nil {
+			return false, err
+		}
+		defer p.Close()
+	}
+	err = flashBinary(config, result, flashMethod, fileExt, port)
+	if err != nil {
+		return false, err
+	}
+	if p == nil {
+		p, err = openSerialPort(port, config)
+		if err != nil {
+			return false, err
+		}
+		defer p.Close()
+	}
+
+	// Closing the port makes the read below return with an error.
+	timer := time.AfterFunc(deviceTestTimeout, func() {
+		p.Close()
+	})
+	passed, err := readDeviceTestResult(p, stdout, config.TestConfig.Cover)
+	if !timer.Stop() {
+		return false, fmt.Errorf("test did not finish within %s", deviceTestTimeout)
+	}
+	return passed, err
+}
+
+// flashUsesSerialPort returns whether flashBinary opens the serial port, to
+// reset the device into the bootloader or to pass it to the flash command.
+func flashUsesSerialPort(config *compileopts.Config, flashMethod string) bool {
+	switch flashMethod {
+	case "openocd", "jlink", "bmp", "ota", "stlink-direct":
+		return false
+	case "", "command":
+		if strings.Contains(config.Target.FlashCommand, "{port}") || (config.Options.FlashErase && strings.Contains(config.Target.EraseCommand, "{port}")) {
+			return true
+		}
+	}
+	return config.Target.PortReset == "true"
+}
+
+// readDeviceTestResult copies the test output read from r to w, until the test
+// has passed or failed. A test fails when it prints FAIL, or when it panics or
+// faults as the device won't print anything after that. With cover set, the
+// coverage data that follows PASS or FAIL is copied as well.
+func readDeviceTestResult(r io.Reader, w io.Writer, cover bool) (bool, error) {
+	br := bufio.NewReader(r)
+	passed, done := false, false
+	for {
+		line, err := br.ReadString('\n')
+		if _, err := io.WriteString(w, line); err != nil {
+			return false, err
+		}
+		switch line = strings.TrimRight(line, "\r\n"); {
+		case done:
+			if line == coverageEndLine {
+				return passed, nil
+			}
+		case line == "PASS", line == "FAIL":
+			passed, done = line == "PASS", true
+			if !cover {
+				return passed, nil
+			}
+		case strings.HasPrefix(line, "panic: "), strings.HasPrefix(line, "fatal error: "):
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("could not read test output: %w", err)
+		}
+	}
+}
+
+// emulatorArgs returns the arguments for the emulator of the target (the first
+// element of the emulator list in the target specification) to run the built
+// program. Most emulators get the binary as the last argument, but Renode needs
+// a script to set up the platform: it is written next to the binary. If gdbPort
+// is not zero, Renode starts a GDB server on this port instead of running the
+// program directly. Otherwise, Renode exits when the program calls
+// runtime.abort, which happens when main returns.
+func emulatorArgs(config *compileopts.Config, result builder.BuildResult, gdbPort int) ([]string, error) {
+	emulator := config.Target.Emulator
+	if config.Target.RenodePlatform == "" {
+		args := append([]string{}, emulator[1:]...)
+		return append(args, result.Binary), nil
+	}
+	var exitAddress uint64
+	if gdbPort == 0 {
+		exitAddress = functionAddress(result.Executable, "runtime.abort")
+	}
+	script, err := config.RenodeScript(result.Executable, gdbPort, exitAddress)
+	if err != nil {
+		return nil, err
+	}
+	scriptPath := result.Executable + ".resc"
+	err = ioutil.WriteFile(scriptPath, []byte(script), 0666)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{}, emulator[1:]...)
+	return append(args, scriptPath), nil
+}
+
+// functionAddress returns the address of the given function in an ELF file, or
+// 0 if it can't be found.
+func functionAddress(executable, name string) uint64 {
+	f, err := elf.Open(executable)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	symbols, err := f.Symbols()
+	if err != nil {
+		return 0
+	}
+	for _, symbol := range symbols {
+		if symbol.Name == name && elf.ST_TYPE(symbol.Info) == elf.STT_FUNC {
+			if f.Machine == elf.EM_ARM {
+				// Clear the Thumb bit.
+				return symbol.Value &^ 1
+			}
+			return symbol.Value
+		}
+	}
+	return 0
+}
+
+// Flash builds and flashes the built binary to the given serial port. When
+// monitor is set, the serial console of the device is opened afterwards (see
+// Monitor).
+func Flash(pkgName, port string, monitor bool, options *compileopts.Options) error {
 	config, err := builder.NewConfig(options)
 	if err != nil {
 		return err
 	}
 
 	// determine the type of file to compile
-	var fileExt string
+	flashMethod, fileExt, err := flashFileExt(config)
+	if err != nil {
+		return err
+	}
 
-	flashMethod, _ := config.Programmer()
+	if config.Options.FlashVerify {
+		switch flashMethod {
+		case "openocd", "jlink", "bmp", "stlink-direct":
+			// OpenOCD verifies with the verify option of the program
+			// command. J-Link verifies every flash download and the flash
+			// sequence for the Black Magic Probe includes compare-sections.
+			// The built-in ST-Link driver reads back the flash.
+		default:
+			return fmt.Errorf("flash verification is not supported with flash method %s", flashMethod)
+		}
+	}
+
+	if config.Options.FlashErase {
+		switch {
+		case flashMethod == "openocd" || flashMethod == "jlink" || flashMethod == "bmp" || flashMethod == "stlink-direct":
+			// These programmers can always erase the chip.
+		case (flashMethod == "command" || flashMethod == "") && config.Target.EraseCommand != "":
+			// The target specifies a command to erase the chip.
+		case flashMethod == "dfu" && config.Target.DFUAddress != "":
+			// DfuSe devices support a mass erase.
+		default:
+			return fmt.Errorf("chip erase is not supported with flash method %s for this target", flashMethod)
+		}
+	}
+
+	return builder.Build(pkgName, fileExt, config, func(result builder.BuildResult) error {
+		err := flashBinary(config, result, flashMethod, fileExt, port)
+		if err != nil {
+			return err
+		}
+		rememberFlashedProgram(result.Executable, config)
+
+		if monitor {
+			// The serial port may take a moment to reappear after the device
+			// has been reset.
+			return Monitor(result.Executable, port, "", config)
+		}
+		return nil
+	})
+}
+
+// flashFileExt returns the flash method to use for the given configuration and
+// the file extension (such as ".hex") of the binary it needs.
+func flashFileExt(config *compileopts.Config) (flashMethod, fileExt string, err error) {
+	flashMethod, _ = config.Programmer()
 	switch flashMethod {
 	case "command", "":
 		switch {
@@ -257,126 +547,213 @@ func Flash(pkgName, port string, options *compileopts.Options) error {
 		case strings.Contains(config.Target.FlashCommand, "{uf2}"):
 			fileExt = ".uf2"
 		default:
-			return errors.New("invalid target file - did you forget the {hex} token in the 'flash-command' section?")
+			return "", "", errors.New("invalid target file - did you forget the {hex} token in the 'flash-command' section?")
 		}
 	case "msd":
 		if config.Target.FlashFilename == "" {
-			return errors.New("invalid target file: flash-method was set to \"msd\" but no msd-firmware-name was set")
+			return "", "", errors.New("invalid target file: flash-method was set to \"msd\" but no msd-firmware-name was set")
 		}
 		fileExt = filepath.Ext(config.Target.FlashFilename)
-	case "openocd":
+	case "openocd", "jlink", "stlink-direct":
 		fileExt = ".hex"
+	case "bmp":
+		fileExt = ".elf"
+	case "dfu", "ota":
+		fileExt = ".bin"
 	case "native":
-		return errors.New("unknown flash method \"native\" - did you miss a -target flag?")
+		return "", "", errors.New("unknown flash method \"native\" - did you miss a -target flag?")
 	default:
-		return errors.New("unknown flash method: " + flashMethod)
+		return "", "", errors.New("unknown flash method: " + flashMethod)
 	}
 
-	return builder.Build(pkgName, fileExt, config, func(result builder.BuildResult) error {
-		// do we need port reset to put MCU into bootloader mode?
-		if config.Target.PortReset == "true" && flashMethod != "openocd" {
-			port, err := getDefaultPort(strings.FieldsFunc(port, func(c rune) bool { return c == ',' }))
+	return flashMethod, fileExt, nil
+}
+
+// flashBinary flashes the binary in result (which must be of type fileExt) to
+// the device using the given flash method.
+func flashBinary(config *compileopts.Config, result builder.BuildResult, flashMethod, fileExt, port string) error {
+	// do we need port reset to put MCU into bootloader mode?
+	if config.Target.PortReset == "true" && flashMethod != "openocd" && flashMethod != "jlink" && flashMethod != "bmp" && flashMethod != "ota" && flashMethod != "stlink-direct" {
+		port, err := getDefaultPort(strings.FieldsFunc(port, func(c rune) bool { return c == ',' }))
+		if err != nil {
+			return err
+		}
+
+		err = touchSerialPortAt1200bps(port)
+		if err != nil {
+			return &commandError{"failed to reset port", result.Binary, err}
+		}
+		// give the target MCU a chance to restart into bootloader
+		time.Sleep(3 * time.Second)
+	}
+
+	// this flashing method copies the binary data to a Mass Storage Device (msd)
+	switch flashMethod {
+	case "", "command":
+		// Create the command.
+		flashCmd := config.Target.FlashCommand
+		fileToken := "{" + fileExt[1:] + "}"
+		flashCmd = strings.ReplaceAll(flashCmd, fileToken, result.Binary)
+
+		if strings.Contains(flashCmd, "{port}") || (config.Options.FlashErase && strings.Contains(config.Target.EraseCommand, "{port}")) {
+			var err error
+			port, err = getDefaultPort(strings.FieldsFunc(port, func(c rune) bool { return c == ',' }))
 			if err != nil {
 				return err
 			}
+		}
+
+		flashCmd = strings.ReplaceAll(flashCmd, "{port}", port)
 
-			err = touchSerialPortAt1200bps(port)
+		if config.Options.FlashErase {
+			// Erase the chip first, using a separate command.
+			eraseCmd := strings.ReplaceAll(config.Target.EraseCommand, "{port}", port)
+			err := runFlashCommand(config, eraseCmd)
 			if err != nil {
-				return &commandError{"failed to reset port", result.Binary, err}
+				return &commandError{"failed to erase", result.Binary, err}
 			}
-			// give the target MCU a chance to restart into bootloader
-			time.Sleep(3 * time.Second)
 		}
 
-		// this flashing method copies the binary data to a Mass Storage Device (msd)
-		switch flashMethod {
-		case "", "command":
-			// Create the command.
-			flashCmd := config.Target.FlashCommand
-			fileToken := "{" + fileExt[1:] + "}"
-			flashCmd = strings.ReplaceAll(flashCmd, fileToken, result.Binary)
-
-			if strings.Contains(flashCmd, "{port}") {
-				var err error
-				port, err = getDefaultPort(strings.FieldsFunc(port, func(c rune) bool { return c == ',' }))
-				if err != nil {
-					return err
-				}
-			}
-
-			flashCmd = strings.ReplaceAll(flashCmd, "{port}", port)
-
-			// Execute the command.
-			var cmd *exec.Cmd
-			switch runtime.GOOS {
-			case "windows":
-				command := strings.Split(flashCmd, " ")
-				if len(command) < 2 {
-					return errors.New("invalid flash command")
-				}
-				cmd = executeCommand(config.Options, command[0], command[1:]...)
-			default:
-				cmd = executeCommand(config.Options, "/bin/sh", "-c", flashCmd)
+		err := runFlashCommand(config, flashCmd)
+		if err != nil {
+			return &commandError{"failed to flash", result.Binary, err}
+		}
+	case "msd":
+		switch fileExt {
+		case ".uf2":
+			err := flashUF2UsingMSD(config.Target.FlashVolume, result.Binary, config.Options)
+			if err != nil {
+				return &commandError{"failed to flash", result.Binary, err}
 			}
-
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			cmd.Dir = goenv.Get("TINYGOROOT")
-			err := cmd.Run()
+		case ".hex":
+			err := flashHexUsingMSD(config.Target.FlashVolume, result.Binary, config.Options)
 			if err != nil {
 				return &commandError{"failed to flash", result.Binary, err}
 			}
-			return nil
-		case "msd":
-			switch fileExt {
-			case ".uf2":
-				err := flashUF2UsingMSD(config.Target.FlashVolume, result.Binary, config.Options)
-				if err != nil {
-					return &commandError{"failed to flash", result.Binary, err}
-				}
-				return nil
-			case ".hex":
-				err := flashHexUsingMSD(config.Target.FlashVolume, result.Binary, config.Options)
-				if err != nil {
-					return &commandError{"failed to flash", result.Binary, err}
-				}
-				return nil
-			default:
-				return errors.New("mass storage device flashing currently only supports uf2 and hex")
+		default:
+			return errors.New("mass storage device flashing currently only supports uf2 and hex")
+		}
+	case "openocd":
+		args, err := config.OpenOCDConfiguration()
+		if err != nil {
+			return err
+		}
+		if config.Options.FlashErase {
+			args = append(args, "-c", "init", "-c", "reset halt")
+			eraseCommands := config.Target.OpenOCDErase
+			if len(eraseCommands) == 0 {
+				// Generic erase, which works for most chips without readout
+				// protection.
+				eraseCommands = []string{"flash erase_sector 0 0 last"}
 			}
-		case "openocd":
-			args, err := config.OpenOCDConfiguration()
-			if err != nil {
-				return err
+			for _, cmd := range eraseCommands {
+				args = append(args, "-c", cmd)
 			}
+		}
+		if config.Options.FlashVerify {
+			args = append(args, "-c", "program "+filepath.ToSlash(result.Binary)+" verify reset exit")
+		} else {
 			args = append(args, "-c", "program "+filepath.ToSlash(result.Binary)+" reset exit")
-			cmd := executeCommand(config.Options, "openocd", args...)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			err = cmd.Run()
-			if err != nil {
-				return &commandError{"failed to flash", result.Binary, err}
+		}
+		cmd := executeCommand(config.Options, "openocd", args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+		if err != nil {
+			return &commandError{"failed to flash", result.Binary, err}
+		}
+	case "jlink":
+		err := flashUsingJLink(result.Binary, config)
+		if err != nil {
+			return &commandError{"failed to flash", result.Binary, err}
+		}
+	case "stlink-direct":
+		err := flashUsingSTLink(result.Binary, config)
+		if err != nil {
+			return &commandError{"failed to flash", result.Binary, err}
+		}
+	case "dfu":
+		args, err := config.DFUConfiguration()
+		if err != nil {
+			return err
+		}
+		args = append(args, "--download", result.Binary)
+		cmd := executeCommand(config.Options, "dfu-util", args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+		if err != nil {
+			return &commandError{"failed to flash", result.Binary, err}
+		}
+	case "ota":
+		// The port is the network address of the device.
+		err := flashOTA(port, result.Binary)
+		if err != nil {
+			return &commandError{"failed to flash", result.Binary, err}
+		}
+	case "bmp":
+		gdb, err := config.Target.LookupGDB()
+		if err != nil {
+			return err
+		}
+		bmpPort, err := getBMPPort(port)
+		if err != nil {
+			return err
+		}
+		// Flash using the GDB server of the probe and start the program. The
+		// flash contents are always verified with compare-sections, which
+		// only prints a warning on a mismatch so the output is checked.
+		args := []string{"-batch", result.Binary}
+		for _, cmd := range bmpGDBCommands(bmpPort) {
+			if cmd == "load" && config.Options.FlashErase {
+				args = append(args, "-ex", "monitor erase_mass")
 			}
-			return nil
-		default:
-			return fmt.Errorf("unknown flash method: %s", flashMethod)
+			args = append(args, "-ex", cmd)
 		}
-	})
+		args = append(args, "-ex", "compare-sections", "-ex", "kill")
+		output := &bytes.Buffer{}
+		cmd := executeCommand(config.Options, gdb, args...)
+		cmd.Stdout = io.MultiWriter(os.Stdout, output)
+		cmd.Stderr = io.MultiWriter(os.Stderr, output)
+		err = cmd.Run()
+		if err == nil {
+			err = checkCompareSections(output.Bytes())
+		}
+		if err != nil {
+			return &commandError{"failed to flash", result.Binary, err}
+		}
+	default:
+		return fmt.Errorf("unknown flash method: %s", flashMethod)
+	}
+	return nil
 }
 
 // FlashGDB compiles and flashes a program to a microcontroller (just like
 // Flash) but instead of resetting the target, it will drop into a GDB shell.
 // You can then set breakpoints, run the GDB `continue` command to start, hit
-// Ctrl+C to break the running program, etc.
+// Ctrl+C to break the running program, etc. The debugger is either "gdb" or
+// "lldb".
 //
 // Note: this command is expected to execute just before exiting, as it
 // modifies global state.
-func FlashGDB(pkgName string, ocdOutput bool, options *compileopts.Options) error {
+func FlashGDB(debugger, pkgName, port string, ocdOutput bool, options *compileopts.Options) error {
+	if debugger == "gdb" {
+		// Keep a list of goroutines for the GDB extension (runtime-gdb.py).
+		options.GDB = true
+	}
 	config, err := builder.NewConfig(options)
 	if err != nil {
 		return err
 	}
-	gdb, err := config.Target.LookupGDB()
+	var debuggerPath string
+	switch debugger {
+	case "gdb":
+		debuggerPath, err = config.Target.LookupGDB()
+	case "lldb":
+		debuggerPath, err = lookupLLDB()
+	default:
+		err = fmt.Errorf("unknown debugger: %s", debugger)
+	}
 	if err != nil {
 		return err
 	}
@@ -385,9 +762,11 @@ func FlashGDB(pkgName string, ocdOutput bool, options *compileopts.Options) erro
 		// Find a good way to run GDB.
 		gdbInterface, openocdInterface := config.Programmer()
 		switch gdbInterface {
-		case "msd", "command", "":
+		case "msd", "command", "stlink-direct", "":
 			if len(config.Target.Emulator) != 0 {
-				if config.Target.Emulator[0] == "mgba" {
+				if config.Target.RenodePlatform != "" {
+					gdbInterface = "renode"
+				} else if config.Target.Emulator[0] == "mgba" {
 					gdbInterface = "mgba"
 				} else if config.Target.Emulator[0] == "simavr" {
 					gdbInterface = "simavr"
@@ -409,11 +788,24 @@ func FlashGDB(pkgName string, ocdOutput bool, options *compileopts.Options) erro
 		// Run the GDB server, if necessary.
 		var gdbCommands []string
 		var daemon *exec.Cmd
+		captureSWO := false
 		switch gdbInterface {
 		case "native":
 			// Run GDB directly.
 		case "openocd":
 			gdbCommands = append(gdbCommands, "target remote :3333", "monitor halt", "load", "monitor reset halt")
+			if config.Serial() == "itm" {
+				// Capture the SWO output and show what is printed on ITM
+				// stimulus port 0, as it would be shown by tinygo monitor.
+				commands, err := config.OpenOCDSWOCommands(swoTCPPort)
+				if err != nil {
+					return err
+				}
+				for _, cmd := range commands {
+					gdbCommands = append(gdbCommands, "monitor "+cmd)
+				}
+				captureSWO = true
+			}
 
 			// We need a separate debugging daemon for on-chip debugging.
 			args, err := config.OpenOCDConfiguration()
@@ -435,7 +827,11 @@ func FlashGDB(pkgName string, ocdOutput bool, options *compileopts.Options) erro
 			gdbCommands = append(gdbCommands, "target remote :2331", "load", "monitor reset halt")
 
 			// We need a separate debugging daemon for on-chip debugging.
-			daemon = executeCommand(config.Options, "JLinkGDBServer", "-device", config.Target.JLinkDevice)
+			args, err := config.JLinkConfiguration()
+			if err != nil {
+				return err
+			}
+			daemon = executeCommand(config.Options, "JLinkGDBServer", args...)
 			if ocdOutput {
 				// Make it clear which output is from the daemon.
 				w := &ColorWriter{
@@ -446,6 +842,17 @@ func FlashGDB(pkgName string, ocdOutput bool, options *compileopts.Options) erro
 				daemon.Stdout = w
 				daemon.Stderr = w
 			}
+		case "bmp":
+			// The Black Magic Probe runs a GDB server itself, so there is no
+			// need for a daemon.
+			if debugger == "lldb" {
+				return errors.New("lldb cannot connect to the GDB server of a Black Magic Probe over a serial port, use gdb instead")
+			}
+			bmpPort, err := getBMPPort(port)
+			if err != nil {
+				return err
+			}
+			gdbCommands = append(gdbCommands, bmpGDBCommands(bmpPort)...)
 		case "qemu":
 			gdbCommands = append(gdbCommands, "target remote :1234")
 
@@ -462,6 +869,17 @@ func FlashGDB(pkgName string, ocdOutput bool, options *compileopts.Options) erro
 			daemon = executeCommand(config.Options, config.Target.Emulator[0], args...)
 			daemon.Stdout = os.Stdout
 			daemon.Stderr = os.Stderr
+		case "renode":
+			gdbCommands = append(gdbCommands, "target remote :3333")
+
+			// Run in Renode, which starts the program once GDB connects.
+			args, err := emulatorArgs(config, result, 3333)
+			if err != nil {
+				return err
+			}
+			daemon = executeCommand(config.Options, config.Target.Emulator[0], args...)
+			daemon.Stdout = os.Stdout
+			daemon.Stderr = os.Stderr
 		case "mgba":
 			gdbCommands = append(gdbCommands, "target remote :2345")
 
@@ -508,6 +926,10 @@ func FlashGDB(pkgName string, ocdOutput bool, options *compileopts.Options) erro
 			}()
 		}
 
+		if captureSWO {
+			go printSWOOutput(swoTCPPort)
+		}
+
 		// Ignore Ctrl-C, it must be passed on to GDB.
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt)
@@ -516,69 +938,464 @@ func FlashGDB(pkgName string, ocdOutput bool, options *compileopts.Options) erro
 			}
 		}()
 
-		// Construct and execute a gdb command.
-		// By default: gdb -ex run <binary>
-		// Exit GDB with Ctrl-D.
-		params := []string{result.Binary}
-		for _, cmd := range gdbCommands {
-			params = append(params, "-ex", cmd)
+		// Construct and execute a gdb or lldb command.
+		// By default: gdb -ex run <binary>
+		// Exit the debugger with Ctrl-D.
+		params := []string{result.Binary}
+		switch debugger {
+		case "gdb":
+			if config.Scheduler() == "tasks" {
+				// Load the GDB extension that lists goroutines (info
+				// goroutines) and shows their stacks (goroutine 2 bt).
+				params = append(params, "-ex", "source "+filepath.Join(goenv.Get("TINYGOROOT"), "src", "runtime", "runtime-gdb.py"))
+			}
+			for _, cmd := range gdbCommands {
+				params = append(params, "-ex", cmd)
+			}
+		case "lldb":
+			params = append(params, "--arch", config.Triple())
+			for _, cmd := range lldbCommands(gdbCommands) {
+				params = append(params, "--one-line", cmd)
+			}
+		}
+		cmd := executeCommand(config.Options, debuggerPath, params...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		if err != nil {
+			return &commandError{"failed to run " + debugger + " with", result.Binary, err}
+		}
+		return nil
+	})
+}
+
+// swoTCPPort is the TCP port on which OpenOCD makes the captured SWO data
+// available with -serial=itm.
+const swoTCPPort = 3344
+
+// printSWOOutput connects to the SWO output of OpenOCD on the given TCP port
+// and prints everything sent on ITM stimulus port 0 to stdout. OpenOCD only
+// starts listening once GDB has configured the TPIU, so connecting is retried
+// for a while.
+func printSWOOutput(tcpPort int) {
+	address := "localhost:" + strconv.Itoa(tcpPort)
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		defer conn.Close()
+		err = decodeITM(conn, os.Stdout, 0)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "SWO capture failed:", err)
+		}
+		return
+	}
+	fmt.Fprintln(os.Stderr, "could not connect to the SWO output of OpenOCD at", address)
+}
+
+// lldbCommands converts the GDB commands used to connect to a GDB server to
+// the equivalent LLDB commands.
+func lldbCommands(gdbCommands []string) []string {
+	var commands []string
+	for _, cmd := range gdbCommands {
+		switch {
+		case strings.HasPrefix(cmd, "target remote "):
+			cmd = "gdb-remote " + strings.TrimPrefix(cmd, "target remote ")
+		case strings.HasPrefix(cmd, "monitor "):
+			// LLDB has no monitor command, but the same packet can be sent
+			// directly.
+			cmd = "process plugin packet monitor " + strings.TrimPrefix(cmd, "monitor ")
+		case cmd == "load":
+			cmd = "target modules load --load --slide 0"
+		}
+		commands = append(commands, cmd)
+	}
+	return commands
+}
+
+// lookupLLDB looks up an lldb executable, preferring the one that matches the
+// LLVM version TinyGo was built with.
+func lookupLLDB() (string, error) {
+	candidates := []string{"lldb-" + strings.Split(llvm.Version, ".")[0], "lldb"}
+	for _, name := range candidates {
+		if _, err := exec.LookPath(name); err == nil {
+			return name, nil
+		}
+	}
+	return "", errors.New("no lldb found (tried " + strings.Join(candidates, ", ") + ")")
+}
+
+// Run compiles and runs the given program. Depending on the target provided in
+// the options, it will run the program directly on the host or will run it in
+// an emulator. For example, -target=wasm will cause the binary to be run inside
+// of a WebAssembly VM.
+func Run(pkgName string, options *compileopts.Options) error {
+	config, err := builder.NewConfig(options)
+	if err != nil {
+		return err
+	}
+
+	return builder.Build(pkgName, ".elf", config, func(result builder.BuildResult) error {
+		if len(config.Target.Emulator) == 0 {
+			// Run directly.
+			cmd := executeCommand(config.Options, result.Binary)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			err := cmd.Run()
+			if err != nil {
+				if err, ok := err.(*exec.ExitError); ok && err.Exited() {
+					// Workaround for QEMU which always exits with an error.
+					return nil
+				}
+				return &commandError{"failed to run compiled binary", result.Binary, err}
+			}
+			return nil
+		} else {
+			// Run in an emulator.
+			args, err := emulatorArgs(config, result, 0)
+			if err != nil {
+				return err
+			}
+			cmd := executeCommand(config.Options, config.Target.Emulator[0], args...)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			err = cmd.Run()
+			if err != nil {
+				if err, ok := err.(*exec.ExitError); ok && err.Exited() {
+					// Workaround for QEMU which always exits with an error.
+					return nil
+				}
+				return &commandError{"failed to run emulator with", result.Binary, err}
+			}
+			return nil
+		}
+	})
+}
+
+// flashUsingJLink flashes the given hex file using a SEGGER J-Link probe, by
+// running a command script with J-Link Commander.
+func flashUsingJLink(hexfile string, config *compileopts.Config) error {
+	args, err := config.JLinkConfiguration()
+	if err != nil {
+		return err
+	}
+
+	// The script is stored next to the hex file, in the temporary build
+	// directory.
+	commands := []string{"r", "h"}
+	if config.Options.FlashErase {
+		commands = append(commands, "erase")
+	}
+	commands = append(commands, "loadfile "+filepath.ToSlash(hexfile), "r", "g", "qc")
+	script := strings.Join(commands, "\n") + "\n"
+	scriptPath := filepath.Join(filepath.Dir(hexfile), "flash.jlink")
+	err = ioutil.WriteFile(scriptPath, []byte(script), 0666)
+	if err != nil {
+		return err
+	}
+
+	// J-Link Commander is called JLink.exe on Windows.
+	command := "JLinkExe"
+	if runtime.GOOS == "windows" {
+		command = "JLink"
+	}
+	args = append(args, "-autoconnect", "1", "-nogui", "1", "-ExitOnError", "1", "-CommanderScript", scriptPath)
+	cmd := executeCommand(config.Options, command, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// flashUsingSTLink flashes the given hex file to an STM32 chip using the
+// built-in ST-Link driver, so that OpenOCD doesn't need to be installed.
+func flashUsingSTLink(hexfile string, config *compileopts.Config) error {
+	f, err := os.Open(hexfile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	mem := gohex.NewMemory()
+	err = mem.ParseIntelHex(f)
+	if err != nil {
+		return err
+	}
+	segments := mem.GetDataSegments()
+	if len(segments) == 0 {
+		return errors.New("nothing to flash")
+	}
+
+	// Flash the program as a single block, so that pages shared by two
+	// segments are only erased once.
+	start := segments[0].Address
+	last := segments[len(segments)-1]
+	image := mem.ToBinary(start, last.Address+uint32(len(last.Data))-start, 0xff)
+
+	dev, err := stlink.Open()
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+	if config.Options.FlashErase {
+		err = dev.MassErase()
+		if err != nil {
+			return err
+		}
+	}
+	err = dev.Flash(start, image)
+	if err != nil {
+		return err
+	}
+	if config.Options.FlashVerify {
+		err = dev.Verify(start, image)
+		if err != nil {
+			return err
+		}
+	}
+	return dev.Reset()
+}
+
+// runFlashCommand runs a flash-command or erase-command from the target
+// specification in the TinyGo root directory.
+func runFlashCommand(config *compileopts.Config, command string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		fields := strings.Split(command, " ")
+		if len(fields) < 2 {
+			return errors.New("invalid flash command")
+		}
+		cmd = executeCommand(config.Options, fields[0], fields[1:]...)
+	default:
+		cmd = executeCommand(config.Options, "/bin/sh", "-c", command)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir = goenv.Get("TINYGOROOT")
+	return cmd.Run()
+}
+
+// FlashRead reads the program currently stored in the flash memory of the
+// device and writes it to outpath as a raw binary. Only the part of the flash
+// memory that contains the program is read, not the bootloader.
+func FlashRead(outpath, port string, options *compileopts.Options) error {
+	config, err := builder.NewConfig(options)
+	if err != nil {
+		return err
+	}
+	flashMethod, _ := config.Programmer()
+	origin, size := config.Target.FlashRegion()
+	if size == 0 {
+		return errors.New("cannot read flash: size of the flash memory of this target is unknown")
+	}
+	outpath, err = filepath.Abs(outpath)
+	if err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	switch flashMethod {
+	case "stlink-direct":
+		// No external command is needed to read the flash.
+		return readUsingSTLink(outpath, origin, size)
+	case "openocd":
+		args, err := config.OpenOCDConfiguration()
+		if err != nil {
+			return err
 		}
-		cmd := executeCommand(config.Options, gdb, params...)
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		err := cmd.Run()
+		args = append(args, "-c", "init", "-c", "reset halt", "-c", fmt.Sprintf("dump_image %s 0x%x 0x%x", filepath.ToSlash(outpath), origin, size), "-c", "reset run", "-c", "shutdown")
+		cmd = executeCommand(config.Options, "openocd", args...)
+	case "jlink":
+		args, err := config.JLinkConfiguration()
 		if err != nil {
-			return &commandError{"failed to run gdb with", result.Binary, err}
+			return err
 		}
-		return nil
-	})
+		script := strings.Join([]string{
+			"r",
+			"h",
+			fmt.Sprintf("savebin %s 0x%x 0x%x", filepath.ToSlash(outpath), origin, size),
+			"r",
+			"g",
+			"qc",
+		}, "\n") + "\n"
+		tmpdir, err := ioutil.TempDir("", "tinygo")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpdir)
+		scriptPath := filepath.Join(tmpdir, "read.jlink")
+		err = ioutil.WriteFile(scriptPath, []byte(script), 0666)
+		if err != nil {
+			return err
+		}
+		command := "JLinkExe"
+		if runtime.GOOS == "windows" {
+			command = "JLink"
+		}
+		args = append(args, "-autoconnect", "1", "-nogui", "1", "-ExitOnError", "1", "-CommanderScript", scriptPath)
+		cmd = executeCommand(config.Options, command, args...)
+	case "dfu":
+		// The device must already be in DFU mode.
+		args, err := config.DFUUploadConfiguration(size)
+		if err != nil {
+			return err
+		}
+		os.Remove(outpath) // dfu-util refuses to overwrite files
+		args = append(args, "--upload", outpath)
+		cmd = executeCommand(config.Options, "dfu-util", args...)
+	case "bmp":
+		gdb, err := config.Target.LookupGDB()
+		if err != nil {
+			return err
+		}
+		bmpPort, err := getBMPPort(port)
+		if err != nil {
+			return err
+		}
+		args := []string{"-batch"}
+		for _, cmd := range bmpGDBCommands(bmpPort) {
+			if cmd == "load" {
+				// Don't flash the program, only read it.
+				continue
+			}
+			args = append(args, "-ex", cmd)
+		}
+		args = append(args, "-ex", fmt.Sprintf("dump binary memory %s 0x%x 0x%x", filepath.ToSlash(outpath), origin, origin+size), "-ex", "kill")
+		cmd = executeCommand(config.Options, gdb, args...)
+	default:
+		return fmt.Errorf("reading the flash is not supported with flash method %s", flashMethod)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return &commandError{"failed to read flash", outpath, err}
+	}
+	return nil
 }
 
-// Run compiles and runs the given program. Depending on the target provided in
-// the options, it will run the program directly on the host or will run it in
-// an emulator. For example, -target=wasm will cause the binary to be run inside
-// of a WebAssembly VM.
-func Run(pkgName string, options *compileopts.Options) error {
-	config, err := builder.NewConfig(options)
+// readUsingSTLink reads size bytes of flash memory at the given address using
+// the built-in ST-Link driver and writes them to outpath.
+func readUsingSTLink(outpath string, address, size uint64) error {
+	dev, err := stlink.Open()
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+	err = dev.Halt()
+	if err != nil {
+		return err
+	}
+	data := make([]byte, size)
+	err = dev.ReadMemory(uint32(address), data)
+	if err != nil {
+		return &commandError{"failed to read flash", outpath, err}
+	}
+	err = dev.Reset()
 	if err != nil {
 		return err
 	}
+	return ioutil.WriteFile(outpath, data, 0666)
+}
 
-	return builder.Build(pkgName, ".elf", config, func(result builder.BuildResult) error {
-		if len(config.Target.Emulator) == 0 {
-			// Run directly.
-			cmd := executeCommand(config.Options, result.Binary)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			err := cmd.Run()
-			if err != nil {
-				if err, ok := err.(*exec.ExitError); ok && err.Exited() {
-					// Workaround for QEMU which always exits with an error.
-					return nil
+// bmpGDBCommands returns the GDB commands to connect to a Black Magic Probe on
+// the given serial port, attach to the target and load the program.
+func bmpGDBCommands(port string) []string {
+	return []string{
+		"target extended-remote " + port,
+		"monitor swdp_scan",
+		"attach 1",
+		"load",
+	}
+}
+
+// checkCompareSections returns an error if the output of the GDB
+// compare-sections command shows that a section of the flash doesn't match the
+// program. GDB only prints a warning in that case and still exits with status
+// zero.
+func checkCompareSections(output []byte) error {
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.Contains(line, "MIS-MATCHED") {
+			return errors.New("flash verification failed: " + strings.TrimSpace(line))
+		}
+	}
+	return nil
+}
+
+// getBMPPort returns the serial port of the GDB server of a Black Magic Probe.
+// If no port was specified, it looks for a connected probe.
+func getBMPPort(port string) (string, error) {
+	if port != "" {
+		return getDefaultPort(strings.FieldsFunc(port, func(c rune) bool { return c == ',' }))
+	}
+	portsList, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return "", err
+	}
+	// The probe has two serial ports: the first one is the GDB server, the
+	// second one is a UART.
+	var ports []string
+	for _, p := range portsList {
+		if p.IsUSB && strings.EqualFold(p.VID, "1d50") && strings.EqualFold(p.PID, "6018") {
+			ports = append(ports, p.Name)
+		}
+	}
+	if len(ports) == 0 {
+		return "", errors.New("unable to locate a Black Magic Probe - use -port flag")
+	}
+	sortPortNames(ports)
+	return ports[0], nil
+}
+
+// sortPortNames sorts serial port names so that numbers in them are sorted by
+// value, for example COM9 before COM10 and /dev/ttyACM2 before /dev/ttyACM10.
+func sortPortNames(ports []string) {
+	sort.Slice(ports, func(i, j int) bool {
+		a, b := ports[i], ports[j]
+		for a != "" && b != "" {
+			if isDigit(a[0]) && isDigit(b[0]) {
+				// Compare the numbers at the start of both names by value:
+				// without leading zeros, a shorter number is smaller.
+				numA, restA := splitNumber(a)
+				numB, restB := splitNumber(b)
+				if len(numA) != len(numB) {
+					return len(numA) < len(numB)
 				}
-				return &commandError{"failed to run compiled binary", result.Binary, err}
-			}
-			return nil
-		} else {
-			// Run in an emulator.
-			args := append(config.Target.Emulator[1:], result.Binary)
-			cmd := executeCommand(config.Options, config.Target.Emulator[0], args...)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			err := cmd.Run()
-			if err != nil {
-				if err, ok := err.(*exec.ExitError); ok && err.Exited() {
-					// Workaround for QEMU which always exits with an error.
-					return nil
+				if numA != numB {
+					return numA < numB
 				}
-				return &commandError{"failed to run emulator with", result.Binary, err}
+				a, b = restA, restB
+				continue
 			}
-			return nil
+			if a[0] != b[0] {
+				return a[0] < b[0]
+			}
+			a, b = a[1:], b[1:]
 		}
+		if a == "" && b == "" {
+			// Only leading zeros differ, for example COM03 and COM3.
+			return ports[i] < ports[j]
+		}
+		return len(a) < len(b)
 	})
 }
 
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// splitNumber splits the string into the number at the start (without leading
+// zeros) and the rest of the string.
+func splitNumber(s string) (number, rest string) {
+	end := 0
+	for end < len(s) && isDigit(s[end]) {
+		end++
+	}
+	return strings.TrimLeft(s[:end], "0"), s[end:]
+}
+
 func touchSerialPortAt1200bps(port string) (err error) {
 	retryCount := 3
 	for i := 0; i < retryCount; i++ {
@@ -696,64 +1513,52 @@ func windowsFindUSBDrive(volume string, options *compileopts.Options) (string, e
 	return "", errors.New("unable to locate a USB device to be flashed")
 }
 
-// getDefaultPort returns the default serial port depending on the operating system.
+// getDefaultPort returns the default serial port depending on the operating
+// system. The candidates may be port names or USB serial numbers. If no
+// candidates are given and multiple devices are connected, the device that was
+// last used in the current directory is selected.
 func getDefaultPort(portCandidates []string) (port string, err error) {
-	if len(portCandidates) == 1 {
-		return portCandidates[0], nil
-	}
-
-	var ports []string
-	switch runtime.GOOS {
-	case "freebsd":
-		ports, err = filepath.Glob("/dev/cuaU*")
-	case "darwin", "linux", "windows":
-		var portsList []*enumerator.PortDetails
-		portsList, err = enumerator.GetDetailedPortsList()
-		if err != nil {
-			return "", err
-		}
-
-		for _, p := range portsList {
-			if p.IsUSB {
-				ports = append(ports, p.Name)
-			}
-		}
-
-		if ports == nil || len(ports) == 0 {
-			// fallback
-			switch runtime.GOOS {
-			case "darwin":
-				ports, err = filepath.Glob("/dev/cu.usb*")
-			case "linux":
-				ports, err = filepath.Glob("/dev/ttyACM*")
-			case "windows":
-				ports, err = serial.GetPortsList()
+	if len(portCandidates) == 1 && isPortName(portCandidates[0]) {
+		// The port is used as given, even if it isn't listed (such as a
+		// pseudo-terminal). It is still remembered if it is a known device.
+		port := portCandidates[0]
+		if devices, err := listSerialDevices(); err == nil {
+			for _, device := range devices {
+				if device.Port == port {
+					rememberDevice(device)
+				}
 			}
 		}
-	default:
-		return "", errors.New("unable to search for a default USB device to be flashed on this OS")
+		return port, nil
 	}
 
+	devices, err := listSerialDevices()
 	if err != nil {
 		return "", err
-	} else if ports == nil {
-		return "", errors.New("unable to locate a serial port")
-	} else if len(ports) == 0 {
+	} else if len(devices) == 0 {
 		return "", errors.New("no serial ports available")
 	}
+	var ports []string
+	for _, device := range devices {
+		ports = append(ports, device.Port)
+	}
 
 	if len(portCandidates) == 0 {
-		if len(ports) == 1 {
-			return ports[0], nil
-		} else {
-			return "", errors.New("multiple serial ports available - use -port flag, available ports are " + strings.Join(ports, ", "))
+		if len(devices) == 1 {
+			return devices[0].Port, nil
 		}
+		if device, ok := lastUsedDevice(devices); ok {
+			fmt.Fprintf(os.Stderr, "using %s, the last used device in this directory (see tinygo flash -list-devices)\n", device.Port)
+			return device.Port, nil
+		}
+		return "", errors.New("multiple serial ports available - use -port flag with a port name or serial number (see tinygo flash -list-devices), available ports are " + strings.Join(ports, ", "))
 	}
 
 	for _, ps := range portCandidates {
-		for _, p := range ports {
-			if p == ps {
-				return p, nil
+		for _, device := range devices {
+			if device.Port == ps || (device.SerialNumber != "" && strings.EqualFold(device.SerialNumber, ps)) {
+				rememberDevice(device)
+				return device.Port, nil
 			}
 		}
 	}
@@ -771,9 +1576,20 @@ func usage() {
 	fmt.Fprintln(os.Stderr, "  test:  test packages")
 	fmt.Fprintln(os.Stderr, "  flash: compile and flash to the device")
 	fmt.Fprintln(os.Stderr, "  gdb:   run/flash and immediately enter GDB")
+	fmt.Fprintln(os.Stderr, "  lldb:  run/flash and immediately enter LLDB")
+	fmt.Fprintln(os.Stderr, "  monitor: open the serial console of the device")
+	fmt.Fprintln(os.Stderr, "  symbolize: decode the addresses of a panic in captured output using the ELF file")
+	fmt.Fprintln(os.Stderr, "  coredump: load a core dump (from -coredump) into GDB together with the ELF file")
 	fmt.Fprintln(os.Stderr, "  env:   list environment variables used during build")
 	fmt.Fprintln(os.Stderr, "  list:  run go list using the TinyGo root")
+	fmt.Fprintln(os.Stderr, "  targets: list the supported targets (optionally filtered, or as JSON)")
+	fmt.Fprintln(os.Stderr, "  info:  show the build configuration of a target (use -json to configure editors)")
 	fmt.Fprintln(os.Stderr, "  clean: empty cache directory ("+goenv.Get("GOCACHE")+")")
+	fmt.Fprintln(os.Stderr, "  cache: show the size of the cache and how often it was used")
+	fmt.Fprintln(os.Stderr, "  trace: convert runtime/trace output to the Chrome trace format")
+	fmt.Fprintln(os.Stderr, "  size-diff: compare the size of two builds (ELF files or -size=json output)")
+	fmt.Fprintln(os.Stderr, "  vet:   report code that is dangerous or slow on microcontrollers")
+	fmt.Fprintln(os.Stderr, "  bundle: copy the parts of TinyGo needed to build a package into a relocatable TINYGOROOT")
 	fmt.Fprintln(os.Stderr, "  help:  print this help text")
 	fmt.Fprintln(os.Stderr, "\nflags:")
 	flag.PrintDefaults()
@@ -862,8 +1678,15 @@ func printCompilerError(logln func(...interface{}), err error) {
 	}
 }
 
+// Print compiler errors as JSON diagnostics instead of as text (-json).
+var jsonDiagnostics bool
+
 func handleCompilerError(err error) {
 	if err != nil {
+		if jsonDiagnostics {
+			printDiagnostics(os.Stdout, err)
+			os.Exit(1)
+		}
 		printCompilerError(func(args ...interface{}) {
 			fmt.Fprintln(os.Stderr, args...)
 		}, err)
@@ -900,21 +1723,42 @@ func (m globalValuesFlag) Set(value string) error {
 	return nil
 }
 
+// envFlag is the type for the -env flag, which can be specified multiple times
+// to set multiple environment variables.
+type envFlag []string
+
+func (f *envFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *envFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
 // parseGoLinkFlag parses the -ldflags parameter. Its primary purpose right now
-// is the -X flag, for setting the value of global string variables.
-func parseGoLinkFlag(flagsString string) (map[string]map[string]string, error) {
-	set := flag.NewFlagSet("link", flag.ExitOnError)
+// is the -X flag, for setting the value of global string variables. The -s and
+// -w flags of the Go linker are also accepted: they both disable debug
+// information, which is returned as stripDebug.
+func parseGoLinkFlag(flagsString string) (globalValues map[string]map[string]string, stripDebug bool, err error) {
+	set := flag.NewFlagSet("link", flag.ContinueOnError)
+	set.SetOutput(ioutil.Discard)
 	globalVarValues := make(globalValuesFlag)
 	set.Var(globalVarValues, "X", "Set the value of the string variable to the given value.")
+	omitSymbols := set.Bool("s", false, "Omit the symbol table and debug information.")
+	omitDWARF := set.Bool("w", false, "Omit the DWARF symbol table.")
 	flags, err := shlex.Split(flagsString)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	err = set.Parse(flags)
 	if err != nil {
-		return nil, err
+		return nil, false, fmt.Errorf("invalid -ldflags: %w", err)
 	}
-	return map[string]map[string]string(globalVarValues), nil
+	if set.NArg() != 0 {
+		return nil, false, fmt.Errorf("invalid -ldflags: unexpected argument %#v", set.Arg(0))
+	}
+	return map[string]map[string]string(globalVarValues), *omitSymbols || *omitDWARF, nil
 }
 
 func main() {
@@ -927,38 +1771,106 @@ func main() {
 
 	opt := flag.String("opt", "z", "optimization level: 0, 1, 2, s, z")
 	gc := flag.String("gc", "", "garbage collector to use (none, leaking, extalloc, conservative)")
-	panicStrategy := flag.String("panic", "print", "panic strategy (print, trap)")
+	panicStrategy := flag.String("panic", "print", "panic strategy (print, trace, trap)")
 	scheduler := flag.String("scheduler", "", "which scheduler to use (none, coroutines, tasks)")
 	printIR := flag.Bool("printir", false, "print LLVM IR")
 	dumpSSA := flag.Bool("dumpssa", false, "dump internal Go SSA")
 	verifyIR := flag.Bool("verifyir", false, "run extra verification steps on LLVM IR")
 	tags := flag.String("tags", "", "a space-separated list of extra build tags")
-	target := flag.String("target", "", "LLVM target | .json file with TargetSpec")
-	printSize := flag.String("size", "", "print sizes (none, short, full)")
+	target := flag.String("target", "", "LLVM target | .json file with TargetSpec | simulator (host with simulated peripherals)")
+	printSize := flag.String("size", "", "print sizes (none, short, full, symbols, json)")
 	printStacks := flag.Bool("print-stacks", false, "print stack sizes of goroutines")
+	stackUsage := flag.Bool("stackusage", false, "paint goroutine stacks so that their peak usage can be read at runtime with runtime/debug.ReadStackUsage (-scheduler=tasks only)")
+	ramReport := flag.String("ram-report", "", "print the worst-case RAM usage of globals and goroutine stacks (none, text, json)")
+	ramCheck := flag.Bool("ram-check", false, "fail the build if the worst-case RAM usage exceeds the RAM of the target")
+	printRAMData := flag.Bool("print-ramdata", false, "print initialized globals that are copied to RAM at startup, and why (string data always stays in RAM as strings are passed by pointer)")
+	heapReserve := flag.Uint64("heap-reserve", 0, "heap space in bytes to include in the worst-case RAM usage (-ram-report, -ram-check)")
+	heapProfile := flag.Bool("heapprofile", false, "record heap allocation sites for runtime/pprof heap profiles")
+	allocTrace := flag.Bool("alloctrace", false, "record heap allocation sites so that allocations can be traced at runtime with runtime/debug.SetAllocTrace")
+	errorTrace := flag.Bool("errortrace", false, "record where errors are created by errors.New and fmt.Errorf, and print this on panic")
+	deadlockTrace := flag.Bool("deadlocktrace", false, "record what goroutines block on, and print each blocked goroutine when all goroutines are blocked")
+	interruptCheck := flag.Bool("interruptcheck", false, "panic with the name of the interrupt handler when it allocates heap memory, blocks on a channel or sleeps (for debug builds)")
+	crashLogSize := flag.Uint64("crashlog-size", 0, "size in bytes of the crash log in RAM that survives a reset (see runtime/crashlog) (Cortex-M only)")
+	stackCanary := flag.Bool("stackcanary", false, "put canary words at the bottom of the system stack and goroutine stacks, and check them on every context switch")
+	readOnlyText := flag.Bool("readonlytext", false, "make code and read-only data read-only with the MPU at startup, so that stray writes fault (Cortex-M only, ignored without an ARMv6-M/ARMv7-M MPU)")
 	printAllocsString := flag.String("print-allocs", "", "regular expression of functions for which heap allocations should be printed")
 	printCommands := flag.Bool("x", false, "Print commands")
+	buildMode := flag.String("buildmode", "", "build mode to use: default (executable), c-archive (static library and C header for //export functions, to link into a C program), c-shared (shared library and C header for //export functions, on Linux and macOS), zephyr, freertos or customos (static library to link into a Zephyr, FreeRTOS or custom OS application)")
+	serialConsole := flag.String("serial", "", "where print and os.Stdout output goes: default (the serial console of the board) or itm (ITM stimulus port 0 over SWO, shown by tinygo gdb) (Cortex-M3 and higher only)")
+	coreDump := flag.String("coredump", "", "write a core dump on a panic or fault, to be loaded with tinygo coredump: none or serial (the console) (Cortex-M only)")
+	traceHooks := flag.String("trace-hooks", "", "stream scheduler and interrupt events while running: none, itm (ITM stimulus port 1) or systemview (SEGGER SystemView) (Cortex-M only)")
+	arduino := flag.Bool("arduino", false, "compile and link the Arduino core of the board, to call Arduino C++ code through extern \"C\" functions (needs ARDUINO_DIR)")
+	arduinoLibs := flag.String("arduino-libs", "", "Arduino libraries to compile and link, separated by commas (implies -arduino)")
+	compileCommands := flag.String("compile-commands", "", "write the clang invocations for the C files of the program to this compile_commands.json file (for clangd)")
+	work := flag.Bool("work", false, "print the name of the temporary build directory and do not delete it when exiting")
 	nodebug := flag.Bool("no-debug", false, "disable DWARF debug symbol generation")
+	trimpath := flag.Bool("trimpath", false, "remove file system paths from the resulting executable, for reproducible builds")
 	ocdCommandsString := flag.String("ocd-commands", "", "OpenOCD commands, overriding target spec (can specify multiple separated by commas)")
 	ocdOutput := flag.Bool("ocd-output", false, "print OCD daemon output during debug")
-	port := flag.String("port", "", "flash port (can specify multiple candidates separated by commas)")
+	ocdTransport := flag.String("ocd-transport", "", "OpenOCD transport, overriding target spec (swd, jtag, hla_swd, ...)")
+	ocdSpeed := flag.Uint("ocd-speed", 0, "OpenOCD adapter speed in kHz, overriding target spec")
+	port := flag.String("port", "", "flash port or USB serial number of the device (can specify multiple candidates separated by commas), or the network address of the device with -programmer=ota")
 	programmer := flag.String("programmer", "", "which hardware programmer to use")
 	ldflags := flag.String("ldflags", "", "Go link tool compatible ldflags")
 	wasmAbi := flag.String("wasm-abi", "", "WebAssembly ABI conventions: js (no i64 params) or generic")
 	llvmFeatures := flag.String("llvm-features", "", "comma separated LLVM features to enable")
+	bakedArgs := flag.String("args", "", "command line arguments (os.Args) to bake into the image (baremetal only)")
+	var bakedEnv envFlag
+	flag.Var(&bakedEnv, "env", "environment variable (KEY=VALUE) to bake into the image, can be repeated (baremetal only)")
+	mcuboot := flag.Bool("mcuboot", false, "write .bin and .hex files as an image for the MCUboot bootloader (link the program at the image slot + 0x200 with app-offset)")
+	imageVersion := flag.String("image-version", "", "version of the MCUboot image: major.minor.revision+build (with -mcuboot)")
+	imageKey := flag.String("image-key", "", "PEM file with an ed25519 or ECDSA P-256 private key to sign the MCUboot image with (with -mcuboot)")
+	settingsAddress := flag.String("settings-addr", "", "address of a settings region in flash with extra arguments and environment variables (baremetal only)")
+	heapRegions := flag.String("heap-regions", "all", "extra heap regions of the target to use: all, none, or a comma separated list of names (for example to keep CCM RAM, which is not accessible by DMA, out of the heap)")
+	parallelism := flag.Int("p", runtime.NumCPU(), "the number of build jobs that can run in parallel")
+	fmtMode := flag.String("fmt", "full", "fmt implementation: full, or light (lower simple Printf/Sprintf calls to print calls)")
 
 	var flagJSON, flagDeps *bool
-	if command == "help" || command == "list" {
+	switch command {
+	case "help", "list", "targets", "info", "cache", "vet":
 		flagJSON = flag.Bool("json", false, "print data in JSON format")
+	case "build", "run", "test", "flash", "gdb", "lldb":
+		flagJSON = flag.Bool("json", false, "print compiler errors and -print-allocs output in JSON format")
+	}
+	if command == "help" || command == "list" {
 		flagDeps = flag.Bool("deps", false, "")
 	}
+	var flagArch, flagFlashMethod *string
+	if command == "help" || command == "targets" {
+		flagArch = flag.String("arch", "", "only list targets with this GOARCH or LLVM architecture (targets)")
+		flagFlashMethod = flag.String("flash-method", "", "only list targets with this flash method (targets)")
+	}
 	var outpath string
-	if command == "help" || command == "build" || command == "build-library" || command == "test" {
-		flag.StringVar(&outpath, "o", "", "output filename")
+	if command == "help" || command == "build" || command == "build-library" || command == "bundle" || command == "test" || command == "trace" {
+		flag.StringVar(&outpath, "o", "", "output filename (output directory for bundle)")
+	}
+	var flagKeepLibraries *bool
+	if command == "help" || command == "clean" {
+		flagKeepLibraries = flag.Bool("keep-libraries", false, "only remove build outputs from the cache and keep the cached libraries (clean)")
+	}
+	var monitor, flashVerify, flashErase, flashListDevices *bool
+	var flashReadPath *string
+	if command == "help" || command == "flash" {
+		monitor = flag.Bool("monitor", false, "open the serial console of the device after flashing (see tinygo monitor)")
+		flashListDevices = flag.Bool("list-devices", false, "list the connected devices that can be selected with -port instead of flashing")
+		flashVerify = flag.Bool("verify", false, "verify the flash contents after flashing (openocd, jlink, bmp, stlink-direct)")
+		flashErase = flag.Bool("erase", false, "erase the entire chip before flashing, clearing readout protection where supported")
+		flashReadPath = flag.String("read", "", "read the current firmware of the device into this .bin file instead of flashing (openocd, jlink, dfu, bmp, stlink-direct)")
 	}
-	var testCompileOnlyFlag *bool
+	var monitorCrashLog *string
+	if command == "help" || command == "monitor" {
+		monitorCrashLog = flag.String("crashlog", "", "append the crash logs printed by the device (see runtime/crashlog) to this file (monitor)")
+	}
+	var testCompileOnlyFlag, testVerboseFlag, testShortFlag, testCoverFlag, testFlashFlag *bool
+	var testRunRegexp, testCoverProfile *string
 	if command == "help" || command == "test" {
 		testCompileOnlyFlag = flag.Bool("c", false, "compile the test binary but do not run it")
+		testVerboseFlag = flag.Bool("v", false, "verbose: print additional output")
+		testShortFlag = flag.Bool("short", false, "short: run smaller test suite to save time")
+		testRunRegexp = flag.String("run", "", "run: regexp of tests to run")
+		testCoverFlag = flag.Bool("cover", false, "cover: enable coverage analysis")
+		testCoverProfile = flag.String("coverprofile", "", "cover: write a coverage profile to the given file (implies -cover)")
+		testFlashFlag = flag.Bool("flash", false, "flash the test binary to the device and read the result from its serial port")
 	}
 
 	// Early command processing, before commands are interpreted by the Go flag
@@ -974,7 +1886,11 @@ func main() {
 	}
 
 	flag.CommandLine.Parse(os.Args[2:])
-	globalVarValues, err := parseGoLinkFlag(*ldflags)
+	switch command {
+	case "build", "run", "test", "flash", "gdb", "lldb":
+		jsonDiagnostics = *flagJSON
+	}
+	globalVarValues, stripDebug, err := parseGoLinkFlag(*ldflags)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -993,6 +1909,16 @@ func main() {
 	if *ocdCommandsString != "" {
 		ocdCommands = strings.Split(*ocdCommandsString, ",")
 	}
+	var arduinoLibNames []string
+	if *arduinoLibs != "" {
+		arduinoLibNames = strings.Split(*arduinoLibs, ",")
+	}
+
+	args, err := shlex.Split(*bakedArgs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "could not parse -args:", err)
+		os.Exit(1)
+	}
 
 	options := &compileopts.Options{
 		Target:          *target,
@@ -1003,17 +1929,51 @@ func main() {
 		PrintIR:         *printIR,
 		DumpSSA:         *dumpSSA,
 		VerifyIR:        *verifyIR,
-		Debug:           !*nodebug,
+		Debug:           !*nodebug && !stripDebug,
 		PrintSizes:      *printSize,
 		PrintStacks:     *printStacks,
+		StackUsage:      *stackUsage,
+		HeapProfile:     *heapProfile,
+		AllocTrace:      *allocTrace,
+		ErrorTrace:      *errorTrace,
+		DeadlockTrace:   *deadlockTrace,
+		InterruptCheck:  *interruptCheck,
+		StackCanary:     *stackCanary,
+		CrashLogSize:    *crashLogSize,
+		ReadOnlyText:    *readOnlyText,
 		PrintAllocs:     printAllocs,
+		PrintAllocsJSON: jsonDiagnostics,
 		PrintCommands:   *printCommands,
 		Tags:            *tags,
 		GlobalValues:    globalVarValues,
 		WasmAbi:         *wasmAbi,
 		Programmer:      *programmer,
 		OpenOCDCommands: ocdCommands,
+		OCDTransport:    *ocdTransport,
+		OCDSpeed:        uint32(*ocdSpeed),
 		LLVMFeatures:    *llvmFeatures,
+		Fmt:             *fmtMode,
+		Args:            args,
+		Env:             bakedEnv,
+		SettingsAddress: *settingsAddress,
+		HeapRegions:     *heapRegions,
+		Parallelism:     *parallelism,
+		TrimPath:        *trimpath,
+		Work:            *work,
+		RAMReport:       *ramReport,
+		CompileCommands: *compileCommands,
+		BuildMode:       *buildMode,
+		TraceHooks:      *traceHooks,
+		Serial:          *serialConsole,
+		CoreDump:        *coreDump,
+		RAMCheck:        *ramCheck,
+		HeapReserve:     *heapReserve,
+		PrintRAMData:    *printRAMData,
+		MCUboot:         *mcuboot,
+		ImageVersion:    *imageVersion,
+		ImageKey:        *imageKey,
+		Arduino:         *arduino,
+		ArduinoLibs:     arduinoLibNames,
 	}
 
 	os.Setenv("CC", "clang -target="+*target)
@@ -1076,26 +2036,131 @@ func main() {
 			handleCompilerError(err)
 		}
 		defer os.RemoveAll(tmpdir)
-		path, err := lib.Load(*target, tmpdir)
+		path, err := lib.Load(*target, tmpdir, *parallelism)
 		handleCompilerError(err)
 		err = copyFile(path, outpath)
 		if err != nil {
 			handleCompilerError(err)
 		}
-	case "flash", "gdb":
+	case "vet":
+		pkgName := "."
+		if flag.NArg() == 1 {
+			pkgName = filepath.ToSlash(flag.Arg(0))
+		} else if flag.NArg() > 1 {
+			fmt.Fprintln(os.Stderr, "vet only accepts a single positional argument: package name, but multiple were specified")
+			usage()
+			os.Exit(1)
+		}
+		config, err := builder.NewConfig(options)
+		handleCompilerError(err)
+		diagnostics, err := builder.Vet(config, pkgName)
+		handleCompilerError(err)
+		if *flagJSON {
+			if diagnostics == nil {
+				diagnostics = []vet.Diagnostic{}
+			}
+			data, err := json.MarshalIndent(diagnostics, "", "\t")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "could not print diagnostics:", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(data))
+		} else {
+			for _, d := range diagnostics {
+				d.File = tryToMakePathRelative(d.File)
+				fmt.Fprintln(os.Stderr, d)
+			}
+		}
+		if len(diagnostics) != 0 {
+			os.Exit(1)
+		}
+	case "bundle":
+		if outpath == "" {
+			fmt.Fprintln(os.Stderr, "No output directory supplied (-o).")
+			usage()
+			os.Exit(1)
+		}
+		pkgName := "."
+		if flag.NArg() == 1 {
+			pkgName = filepath.ToSlash(flag.Arg(0))
+		} else if flag.NArg() > 1 {
+			fmt.Fprintln(os.Stderr, "bundle only accepts a single positional argument: package name, but multiple were specified")
+			usage()
+			os.Exit(1)
+		}
+		config, err := builder.NewConfig(options)
+		handleCompilerError(err)
+		err = builder.Bundle(config, pkgName, outpath)
+		handleCompilerError(err)
+		fmt.Printf("Created a TinyGo bundle in %s, build with:\n", outpath)
+		fmt.Printf("  %s build -target=%s\n", filepath.Join(outpath, "bin", "tinygo"), options.Target)
+		if goVersion, err := goenv.GorootVersionString(goenv.Get("GOROOT")); err == nil {
+			fmt.Println("The bundle still needs a Go toolchain, it was created with", goVersion)
+		}
+	case "flash", "gdb", "lldb":
 		pkgName := filepath.ToSlash(flag.Arg(0))
 		if command == "flash" {
-			err := Flash(pkgName, *port, options)
+			if *flashListDevices {
+				err := ListDevices(os.Stdout)
+				handleCompilerError(err)
+				return
+			}
+			if *flashReadPath != "" {
+				err := FlashRead(*flashReadPath, *port, options)
+				handleCompilerError(err)
+				return
+			}
+			options.FlashVerify = *flashVerify
+			options.FlashErase = *flashErase
+			err := Flash(pkgName, *port, *monitor, options)
 			handleCompilerError(err)
 		} else {
 			if !options.Debug {
-				fmt.Fprintln(os.Stderr, "Debug disabled while running gdb?")
+				fmt.Fprintln(os.Stderr, "Debug disabled while running "+command+"?")
 				usage()
 				os.Exit(1)
 			}
-			err := FlashGDB(pkgName, *ocdOutput, options)
+			err := FlashGDB(command, pkgName, *port, *ocdOutput, options)
+			handleCompilerError(err)
+		}
+	case "monitor":
+		// Open the serial console of the device. An ELF file of the program
+		// running on the device may be passed to decode panics.
+		if flag.NArg() > 1 {
+			fmt.Fprintln(os.Stderr, "usage: tinygo monitor [-target=<target>] [-port=<port>] [executable]")
+			os.Exit(1)
+		}
+		config, err := builder.NewConfig(options)
+		handleCompilerError(err)
+		err = Monitor(flag.Arg(0), *port, *monitorCrashLog, config)
+		handleCompilerError(err)
+	case "symbolize":
+		// Decode the addresses in the output of a program, for example a log
+		// captured from the serial port, using the ELF file of the program.
+		if flag.NArg() != 1 && flag.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, "usage: tinygo symbolize executable [logfile]")
+			os.Exit(1)
+		}
+		input := io.Reader(os.Stdin)
+		if flag.NArg() == 2 {
+			f, err := os.Open(flag.Arg(1))
 			handleCompilerError(err)
+			defer f.Close()
+			input = f
 		}
+		err := Symbolize(flag.Arg(0), input, os.Stdout)
+		handleCompilerError(err)
+	case "coredump":
+		// Inspect the state of a program that panicked or faulted, from the
+		// core dump it wrote (usually in a log of the serial console).
+		if flag.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, "usage: tinygo coredump [-target=<target>] executable dumpfile")
+			os.Exit(1)
+		}
+		config, err := builder.NewConfig(options)
+		handleCompilerError(err)
+		err = CoreDump(flag.Arg(0), flag.Arg(1), config)
+		handleCompilerError(err)
 	case "run":
 		if flag.NArg() != 1 {
 			fmt.Fprintln(os.Stderr, "No package specified.")
@@ -1113,10 +2178,21 @@ func main() {
 		if len(pkgNames) == 0 {
 			pkgNames = []string{"."}
 		}
+		options.TestConfig.Verbose = *testVerboseFlag
+		options.TestConfig.Short = *testShortFlag
+		options.TestConfig.RunRegexp = *testRunRegexp
+		options.TestConfig.Cover = *testCoverFlag || *testCoverProfile != ""
+		options.TestConfig.CoverProfile = *testCoverProfile
+		options.TestConfig.Flash = *testFlashFlag
+		if options.TestConfig.CoverProfile != "" && !*testCompileOnlyFlag {
+			// Every tested package appends its coverage data to this file.
+			err := ioutil.WriteFile(options.TestConfig.CoverProfile, []byte("mode: set\n"), 0666)
+			handleCompilerError(err)
+		}
 		allTestsPassed := true
 		for _, pkgName := range pkgNames {
 			// TODO: parallelize building the test binaries
-			passed, err := Test(pkgName, options, *testCompileOnlyFlag, outpath)
+			passed, err := Test(pkgName, *port, options, *testCompileOnlyFlag, outpath)
 			handleCompilerError(err)
 			if !passed {
 				allTestsPassed = false
@@ -1127,19 +2203,45 @@ func main() {
 			os.Exit(1)
 		}
 	case "targets":
-		dir := filepath.Join(goenv.Get("TINYGOROOT"), "targets")
-		entries, err := ioutil.ReadDir(dir)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "could not list targets:", err)
-			os.Exit(1)
-			return
-		}
-		for _, entry := range entries {
-			if !entry.Mode().IsRegular() || !strings.HasSuffix(entry.Name(), ".json") {
-				// Only inspect JSON files.
-				continue
+		// Collect the target files in all target directories. Targets in the
+		// TINYGOTARGETS directories override built-in targets with the same
+		// name.
+		var paths []string
+		seen := make(map[string]bool)
+		for _, dir := range compileopts.TargetDirs() {
+			entries, err := ioutil.ReadDir(dir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "could not list targets:", err)
+				os.Exit(1)
+				return
 			}
-			path := filepath.Join(dir, entry.Name())
+			for _, entry := range entries {
+				if !entry.Mode().IsRegular() || !strings.HasSuffix(entry.Name(), ".json") || seen[entry.Name()] {
+					// Only inspect JSON files.
+					continue
+				}
+				seen[entry.Name()] = true
+				paths = append(paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			return filepath.Base(paths[i]) < filepath.Base(paths[j])
+		})
+		// Information printed for each target with -json.
+		type targetInfo struct {
+			Name        string   `json:"name"`
+			LLVMTarget  string   `json:"llvm-target"`
+			CPU         string   `json:"cpu,omitempty"`
+			GOOS        string   `json:"goos"`
+			GOARCH      string   `json:"goarch"`
+			BuildTags   []string `json:"build-tags"`
+			FlashMethod string   `json:"flash-method,omitempty"`
+			Programmer  string   `json:"programmer,omitempty"`
+			FlashSize   uint64   `json:"flash-size,omitempty"`
+			RAMSize     uint64   `json:"ram-size,omitempty"`
+		}
+		targets := []targetInfo{}
+		for _, path := range paths {
 			spec, err := compileopts.LoadTarget(path)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, "could not list target:", err)
@@ -1151,9 +2253,39 @@ func main() {
 				// a parent target (such as targets/cortex-m.json).
 				continue
 			}
-			name := entry.Name()
+			name := filepath.Base(path)
 			name = name[:len(name)-5]
-			fmt.Println(name)
+			if *flagArch != "" && spec.GOARCH != *flagArch && !strings.HasPrefix(strings.Split(spec.Triple, "-")[0], *flagArch) {
+				continue
+			}
+			if *flagFlashMethod != "" && spec.FlashMethod != *flagFlashMethod {
+				continue
+			}
+			if !*flagJSON {
+				fmt.Println(name)
+				continue
+			}
+			flash, ram := spec.MemorySizes()
+			targets = append(targets, targetInfo{
+				Name:        name,
+				LLVMTarget:  spec.Triple,
+				CPU:         spec.CPU,
+				GOOS:        spec.GOOS,
+				GOARCH:      spec.GOARCH,
+				BuildTags:   spec.BuildTags,
+				FlashMethod: spec.FlashMethod,
+				Programmer:  spec.OpenOCDInterface,
+				FlashSize:   flash,
+				RAMSize:     ram,
+			})
+		}
+		if *flagJSON {
+			data, err := json.MarshalIndent(targets, "", "\t")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "could not list targets:", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(data))
 		}
 	case "info":
 		if flag.NArg() == 1 {
@@ -1179,6 +2311,44 @@ func main() {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
+		if *flagJSON {
+			// Print the information in a form that editors can use to
+			// configure gopls: the cached GOROOT contains the TinyGo versions
+			// of packages like runtime, machine and device.
+			// The keys are the same as in the target JSON files.
+			data, err := json.MarshalIndent(struct {
+				Target     *compileopts.TargetSpec `json:"target"`
+				GOROOT     string                  `json:"goroot"`
+				GOOS       string                  `json:"goos"`
+				GOARCH     string                  `json:"goarch"`
+				BuildTags  []string                `json:"build-tags"`
+				GC         string                  `json:"gc"`
+				Scheduler  string                  `json:"scheduler"`
+				LLVMTriple string                  `json:"llvm-target"`
+				Env        map[string]string       `json:"env"` // environment for gopls and go list
+			}{
+				Target:     config.Target,
+				GOROOT:     cachedGOROOT,
+				GOOS:       config.GOOS(),
+				GOARCH:     config.GOARCH(),
+				BuildTags:  config.BuildTags(),
+				GC:         config.GC(),
+				Scheduler:  config.Scheduler(),
+				LLVMTriple: config.Triple(),
+				Env: map[string]string{
+					"GOROOT":  cachedGOROOT,
+					"GOOS":    config.GOOS(),
+					"GOARCH":  config.GOARCH(),
+					"GOFLAGS": "-tags=" + strings.Join(config.BuildTags(), ","),
+				},
+			}, "", "\t")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "could not print info:", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(data))
+			return
+		}
 		fmt.Printf("LLVM triple:       %s\n", config.Triple())
 		fmt.Printf("GOOS:              %s\n", config.GOOS())
 		fmt.Printf("GOARCH:            %s\n", config.GOARCH())
@@ -1216,12 +2386,69 @@ func main() {
 			os.Exit(1)
 		}
 	case "clean":
-		// remove cache directory
-		err := os.RemoveAll(goenv.Get("GOCACHE"))
+		// Remove the cache directory, or with -keep-libraries only the build
+		// outputs in it.
+		err := builder.CleanCache(*flagKeepLibraries)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "cannot clean cache:", err)
 			os.Exit(1)
 		}
+	case "cache":
+		stats, err := builder.ReadCacheStats()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "cannot read cache:", err)
+			os.Exit(1)
+		}
+		if *flagJSON {
+			data, err := json.MarshalIndent(stats, "", "\t")
+			if err != nil {
+				handleCompilerError(err)
+			}
+			fmt.Println(string(data))
+			return
+		}
+		fmt.Printf("cache directory: %s\n", stats.Dir)
+		fmt.Printf("files:           %d\n", stats.Files)
+		fmt.Printf("size:            %.1f MB\n", float64(stats.Size)/1024/1024)
+		fmt.Printf("hits:            %d\n", stats.Hits)
+		fmt.Printf("misses:          %d\n", stats.Misses)
+		if total := stats.Hits + stats.Misses; total != 0 {
+			fmt.Printf("hit rate:        %.0f%%\n", float64(stats.Hits)*100/float64(total))
+		}
+	case "size-diff":
+		if flag.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, "usage: tinygo size-diff [-size=full|symbols] old new")
+			os.Exit(1)
+		}
+		format := *printSize
+		if format == "" {
+			format = "full"
+		}
+		err := builder.SizeDiff(os.Stdout, flag.Arg(0), flag.Arg(1), format)
+		handleCompilerError(err)
+	case "trace":
+		// Convert the output of runtime/trace (for example, a log of the
+		// serial output) to the Chrome trace event format.
+		if flag.NArg() > 1 {
+			fmt.Fprintln(os.Stderr, "usage: tinygo trace [-o trace.json] [logfile]")
+			os.Exit(1)
+		}
+		var input io.Reader = os.Stdin
+		if flag.NArg() == 1 && flag.Arg(0) != "-" {
+			f, err := os.Open(flag.Arg(0))
+			handleCompilerError(err)
+			defer f.Close()
+			input = f
+		}
+		var output io.Writer = os.Stdout
+		if outpath != "" {
+			f, err := os.Create(outpath)
+			handleCompilerError(err)
+			defer f.Close()
+			output = f
+		}
+		err := convertTrace(input, output)
+		handleCompilerError(err)
 	case "help":
 		usage()
 	case "version":
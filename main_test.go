@@ -6,18 +6,24 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"debug/elf"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/blakesmith/ar"
+	"github.com/marcinbor85/gohex"
 	"github.com/tinygo-org/tinygo/builder"
 	"github.com/tinygo-org/tinygo/compileopts"
 	"github.com/tinygo-org/tinygo/goenv"
@@ -30,27 +36,35 @@ var testTarget = flag.String("target", "", "override test target")
 func TestCompiler(t *testing.T) {
 	tests := []string{
 		"alias.go",
+		"alignment.go",
 		"atomic.go",
+		"binary.go",
 		"binop.go",
 		"calls.go",
 		"cgo/",
 		"channel.go",
 		"coroutines.go",
+		"crashlog.go",
 		"float.go",
 		"gc.go",
+		"heapstats.go",
 		"init.go",
 		"init_multi.go",
 		"interface.go",
 		"json.go",
+		"linkname.go",
 		"map.go",
 		"math.go",
+		"ota.go",
 		"print.go",
 		"reflect.go",
 		"slice.go",
+		"softfloat.go",
 		"sort.go",
 		"stdlib.go",
 		"string.go",
 		"structs.go",
+		"watchpoint.go",
 		"zeroalloc.go",
 	}
 
@@ -76,6 +90,72 @@ func TestCompiler(t *testing.T) {
 		runPlatTests("cortex-m-qemu", tests, t)
 	})
 
+	t.Run("EmulatedCortexM0", func(t *testing.T) {
+		// Cortex-M0 uses hand-written assembly for float32 add/mul and
+		// integer division (see armv6mBuiltins in builder/builtins.go).
+		runPlatTests("microbit-qemu", []string{"float.go", "math.go", "softfloat.go"}, t)
+	})
+
+	t.Run("EmulatedAVR", func(t *testing.T) {
+		// Run in simavr, which exits when the program goes to sleep with
+		// interrupts disabled (see abort in runtime_avr.go). Only a few tests
+		// fit in the 8kB of RAM of the ATmega2560.
+		runPlatTests("arduino-mega2560", []string{"calls.go", "slice.go", "structs.go"}, t)
+	})
+
+	t.Run("EmulatedHeapRegions", func(t *testing.T) {
+		// The allocator with an extra heap region, in RAM that is left out of
+		// the linker script of cortex-m-qemu.
+		t.Parallel()
+		target := TESTDATA + "/heapregions/target.json"
+		runTestWithConfig("heapregions/", target, t, &compileopts.Options{
+			Target: target,
+			Opt:    "z",
+		}, nil, nil)
+	})
+
+	t.Run("EmulatedExternalMemory", func(t *testing.T) {
+		// The same target has an external heap region, for runtime/extmem.
+		t.Parallel()
+		target := TESTDATA + "/heapregions/target.json"
+		runTestWithConfig("extmem.go", target, t, &compileopts.Options{
+			Target: target,
+			Opt:    "z",
+		}, nil, nil)
+	})
+
+	t.Run("EmulatedCrashLog", func(t *testing.T) {
+		// The crash log in RAM, which only exists on Cortex-M.
+		t.Parallel()
+		runTestWithConfig("crashlog_ram.go", "cortex-m-qemu", t, &compileopts.Options{
+			Target:       "cortex-m-qemu",
+			Opt:          "z",
+			CrashLogSize: 64,
+		}, nil, nil)
+	})
+
+	t.Run("EmulatedStackCanary", func(t *testing.T) {
+		// The canaries at the bottom of the system stack and the goroutine
+		// stacks must survive a program with many goroutine switches.
+		t.Parallel()
+		runTestWithConfig("coroutines.go", "cortex-m-qemu", t, &compileopts.Options{
+			Target:      "cortex-m-qemu",
+			Opt:         "z",
+			StackCanary: true,
+		}, nil, nil)
+	})
+
+	t.Run("EmulatedSystemView", func(t *testing.T) {
+		// Goroutines must be registered as SystemView tasks when they start
+		// and exit, and on request of the host.
+		t.Parallel()
+		runTestWithConfig("systemview.go", "cortex-m-qemu", t, &compileopts.Options{
+			Target:     "cortex-m-qemu",
+			Opt:        "z",
+			TraceHooks: "systemview",
+		}, nil, nil)
+	})
+
 	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
 		// Note: running only on Windows and macOS because Linux (as of 2020)
 		// usually has an outdated QEMU version that doesn't support RISC-V yet.
@@ -139,17 +219,51 @@ func TestCompiler(t *testing.T) {
 			}, nil, nil)
 		})
 
+		t.Run("errortrace", func(t *testing.T) {
+			t.Parallel()
+			runTestWithConfig("errortrace.go", "", t, &compileopts.Options{
+				Opt:        "z",
+				ErrorTrace: true,
+			}, nil, nil)
+		})
+
+		t.Run("alloctrace", func(t *testing.T) {
+			t.Parallel()
+			runTestWithConfig("alloctrace.go", "", t, &compileopts.Options{
+				Opt:        "z",
+				AllocTrace: true,
+			}, nil, nil)
+		})
+
+		t.Run("scheduler=tasks", func(t *testing.T) {
+			t.Parallel()
+			runTestWithConfig("blocked.go", "", t, &compileopts.Options{
+				Opt:       "z",
+				Scheduler: "tasks",
+			}, nil, nil)
+		})
+
 		t.Run("ldflags", func(t *testing.T) {
 			t.Parallel()
 			runTestWithConfig("ldflags.go", "", t, &compileopts.Options{
 				Opt: "z",
 				GlobalValues: map[string]map[string]string{
 					"main": {
-						"someGlobal": "foobar",
+						"someGlobal":            "foobar",
+						"someInitializedGlobal": "1.2.3",
+						"doesNotExist":          "ignored",
 					},
 				},
 			}, nil, nil)
 		})
+
+		t.Run("fmt=light", func(t *testing.T) {
+			t.Parallel()
+			runTestWithConfig("fmtlight.go", "", t, &compileopts.Options{
+				Opt: "z",
+				Fmt: "light",
+			}, nil, nil)
+		})
 	})
 }
 
@@ -170,7 +284,39 @@ func runPlatTests(target string, tests []string, t *testing.T) {
 		})
 		t.Run("env.go", func(t *testing.T) {
 			t.Parallel()
-			runTest("env.go", target, t, []string{"first", "second"}, []string{"ENV1=VALUE1", "ENV2=VALUE2"})
+			runTest("env.go", target, t, []string{"first", "second"}, []string{"ENV1=VALUE1", "ENV2=VALUE2", "HOME=/home/gopher", "TMPDIR=/tmp/gopher"})
+		})
+	}
+	if (target == "" && runtime.GOOS == "linux") || strings.Contains(target, "-linux-") {
+		// System calls are lowered to inline assembly on Linux.
+		t.Run("syscall.go", func(t *testing.T) {
+			t.Parallel()
+			runTest("syscall.go", target, t, nil, nil)
+		})
+	}
+	if target == "" {
+		t.Run("mmap.go", func(t *testing.T) {
+			t.Parallel()
+			runTest("mmap.go", target, t, nil, nil)
+		})
+		t.Run("idlehook.go", func(t *testing.T) {
+			t.Parallel()
+			runTest("idlehook.go", target, t, nil, nil)
+		})
+		t.Run("simulator.go", func(t *testing.T) {
+			t.Parallel()
+			runTest("simulator.go", "simulator", t, nil, nil)
+		})
+		t.Run("embed.go", func(t *testing.T) {
+			t.Parallel()
+			_, minor, err := goenv.GetGorootVersion(goenv.Get("GOROOT"))
+			if err != nil {
+				t.Fatal("could not get Go version:", err)
+			}
+			if minor < 16 {
+				t.Skip("//go:embed requires Go 1.16")
+			}
+			runTest("embed.go", target, t, nil, nil)
 		})
 	}
 }
@@ -240,6 +386,7 @@ func runTestWithConfig(name, target string, t *testing.T, options *compileopts.O
 	// Run the test.
 	runComplete := make(chan struct{})
 	var cmd *exec.Cmd
+	var emulator string
 	ranTooLong := false
 	if target == "" {
 		cmd = exec.Command(binary)
@@ -253,8 +400,9 @@ func runTestWithConfig(name, target string, t *testing.T, options *compileopts.O
 		if len(spec.Emulator) == 0 {
 			cmd = exec.Command(binary)
 		} else {
+			emulator = spec.Emulator[0]
 			args := append(spec.Emulator[1:], binary)
-			cmd = exec.Command(spec.Emulator[0], args...)
+			cmd = exec.Command(emulator, args...)
 		}
 
 		if len(spec.Emulator) != 0 && spec.Emulator[0] == "wasmtime" {
@@ -302,6 +450,13 @@ func runTestWithConfig(name, target string, t *testing.T, options *compileopts.O
 
 	// putchar() prints CRLF, convert it to LF.
 	actual := bytes.Replace(stdout.Bytes(), []byte{'\r', '\n'}, []byte{'\n'}, -1)
+	if emulator == "simavr" {
+		// simavr prints each line of the UART in color, with the CR and LF
+		// replaced by dots.
+		actual = bytes.Replace(actual, []byte("\x1b[32m"), nil, -1)
+		actual = bytes.Replace(actual, []byte("\x1b[0m"), nil, -1)
+		actual = bytes.Replace(actual, []byte("..\n"), []byte("\n"), -1)
+	}
 	expected = bytes.Replace(expected, []byte{'\r', '\n'}, []byte{'\n'}, -1) // for Windows
 
 	// Check whether the command ran successfully.
@@ -327,6 +482,506 @@ func runTestWithConfig(name, target string, t *testing.T, options *compileopts.O
 	}
 }
 
+// Test -buildmode=c-archive on the host: link the archive into a C program and
+// check the output of that program.
+func TestCArchive(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("-buildmode=c-archive is only supported on Linux hosts")
+	}
+	t.Parallel()
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Build the archive, which also writes carchive.h next to it.
+	archive := filepath.Join(tmpdir, "carchive.a")
+	err = runBuild("./"+TESTDATA+"/carchive/", archive, &compileopts.Options{
+		Opt:       "z",
+		BuildMode: "c-archive",
+	})
+	if err != nil {
+		printCompilerError(t.Log, err)
+		t.FailNow()
+	}
+
+	// Link it into a C program.
+	binary := filepath.Join(tmpdir, "main")
+	cmd := exec.Command("cc", "-I"+tmpdir, "-o", binary, TESTDATA+"/carchive/main.c", archive)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal("could not link C program:", err)
+	}
+
+	expected, err := ioutil.ReadFile(TESTDATA + "/carchive/out.txt")
+	if err != nil {
+		t.Fatal("could not read expected output file:", err)
+	}
+	actual, err := exec.Command(binary).Output()
+	if err != nil {
+		t.Error("failed to run:", err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("output did not match:\n%s", actual)
+	}
+}
+
+// Test -buildmode=c-shared by loading the shared library with dlopen from a C
+// program, and calling the exported functions.
+func TestCShared(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only tested on Linux hosts")
+	}
+	t.Parallel()
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	library := filepath.Join(tmpdir, "cshared.so")
+	err = runBuild("./"+TESTDATA+"/cshared/", library, &compileopts.Options{
+		Opt:       "z",
+		BuildMode: "c-shared",
+	})
+	if err != nil {
+		printCompilerError(t.Log, err)
+		t.FailNow()
+	}
+
+	// Build the C program, which doesn't link against the library.
+	binary := filepath.Join(tmpdir, "main")
+	cmd := exec.Command("cc", "-o", binary, TESTDATA+"/cshared/main.c", "-ldl")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal("could not build C program:", err)
+	}
+
+	expected, err := ioutil.ReadFile(TESTDATA + "/cshared/out.txt")
+	if err != nil {
+		t.Fatal("could not read expected output file:", err)
+	}
+	cmd = exec.Command(binary, library)
+	cmd.Stderr = os.Stderr
+	actual, err := cmd.Output()
+	if err != nil {
+		t.Error("failed to run:", err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("output did not match:\n%s", actual)
+	}
+}
+
+// Test -panic=trace on an emulated Cortex-M: the traceback must contain the
+// functions in the call chain, which are looked up in the symbol table that is
+// added to the firmware after linking (see builder/symtab.go).
+func TestPanicTrace(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	binary := filepath.Join(tmpdir, "test")
+	err = runBuild("./"+TESTDATA+"/panictrace/", binary, &compileopts.Options{
+		Target:        "cortex-m-qemu",
+		Opt:           "z",
+		PanicStrategy: "trace",
+	})
+	if err != nil {
+		printCompilerError(t.Log, err)
+		t.FailNow()
+	}
+
+	spec, err := compileopts.LoadTarget("cortex-m-qemu")
+	if err != nil {
+		t.Fatal("failed to load target spec:", err)
+	}
+	cmd := exec.Command(spec.Emulator[0], append(spec.Emulator[1:], binary)...)
+	output := &bytes.Buffer{}
+	cmd.Stdout = output
+	cmd.Stderr = os.Stderr
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal("failed to start:", err)
+	}
+	timer := time.AfterFunc(10*time.Second, func() {
+		cmd.Process.Kill()
+	})
+	cmd.Wait() // QEMU exits with an error on a panic
+	timer.Stop()
+
+	actual := strings.Replace(output.String(), "\r\n", "\n", -1)
+	traceback := strings.Index(actual, "traceback:\n")
+	if !strings.HasPrefix(actual, "start\npanic: runtime error: index out of range") || traceback < 0 {
+		t.Fatalf("unexpected output:\n%s", actual)
+	}
+	// Each frame is printed as "  name+0xoffset", innermost first.
+	var frames []string
+	for _, line := range strings.Split(actual[traceback:], "\n")[1:] {
+		if !strings.HasPrefix(line, "  ") || !strings.Contains(line, "+0x") {
+			break
+		}
+		frames = append(frames, strings.TrimSpace(line[:strings.Index(line, "+0x")]))
+	}
+	// The runtime panic functions come first, and the stack scan may find a
+	// few stale frames, so only check that the functions in the call chain
+	// are found in order.
+	next := 0
+	expected := []string{"main.inner", "main.outer"}
+	for _, frame := range frames {
+		if next < len(expected) && frame == expected[next] {
+			next++
+		}
+	}
+	if next != len(expected) {
+		t.Errorf("expected %s in the traceback, got:\n%s", strings.Join(expected, ", "), actual)
+	}
+}
+
+// Test -deadlocktrace on the host: when the program deadlocks, every blocked
+// goroutine must be printed with the operation it is blocked on, most recently
+// blocked first.
+func TestDeadlockTrace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("can't test build options on Windows")
+	}
+	t.Parallel()
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	binary := filepath.Join(tmpdir, "test")
+	err = runBuild("./"+TESTDATA+"/deadlocktrace/", binary, &compileopts.Options{
+		Opt:           "z",
+		Scheduler:     "tasks",
+		DeadlockTrace: true,
+	})
+	if err != nil {
+		printCompilerError(t.Log, err)
+		t.FailNow()
+	}
+
+	// The program exits with an error after printing the deadlock.
+	output, _ := exec.Command(binary).Output()
+	actual := string(output)
+	lines := strings.Split(actual, "\n")
+	if len(lines) < 5 || lines[0] != "start" || lines[1] != "deadlock: all goroutines are blocked" {
+		t.Fatalf("unexpected output:\n%s", actual)
+	}
+	// Each goroutine is printed as "  goroutine 0x...: operation on 0x... at
+	// 0x...", with the addresses of the goroutine, the object it blocks on and
+	// the blocking call.
+	line := regexp.MustCompile(`^  goroutine 0x[0-9a-f]+: (.*) on 0x[0-9a-f]+ at 0x[0-9a-f]+$`)
+	for i, operation := range []string{"sync.WaitGroup wait", "sync.Mutex lock", "chan receive"} {
+		match := line.FindStringSubmatch(lines[2+i])
+		if match == nil || match[1] != operation {
+			t.Errorf("expected goroutine %d to be blocked on %s, got: %s", i, operation, lines[2+i])
+		}
+	}
+}
+
+// Test the merge-hex target option: the Intel hex file in the target directory
+// must be merged into the firmware image, next to the program.
+func TestMergeHex(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	firmware := filepath.Join(tmpdir, "firmware.hex")
+	err = runBuild("./"+TESTDATA+"/mergehex/", firmware, &compileopts.Options{
+		Target: TESTDATA + "/mergehex/target.json",
+		Opt:    "z",
+	})
+	if err != nil {
+		printCompilerError(t.Log, err)
+		t.FailNow()
+	}
+
+	f, err := os.Open(firmware)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	mem := gohex.NewMemory()
+	err = mem.ParseIntelHex(f)
+	if err != nil {
+		t.Fatal("could not parse firmware:", err)
+	}
+	segments := mem.GetDataSegments()
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Address < segments[j].Address
+	})
+	if len(segments) != 2 {
+		t.Fatalf("expected the program and the settings in the firmware, got %d segments", len(segments))
+	}
+	if segments[0].Address != 0 || len(segments[0].Data) < 0x40 {
+		t.Errorf("expected the program at address 0, got %d bytes at 0x%x", len(segments[0].Data), segments[0].Address)
+	}
+	if segments[1].Address != 0x3ff00 || string(segments[1].Data) != "settings" {
+		t.Errorf("expected the settings at 0x3ff00, got %q at 0x%x", segments[1].Data, segments[1].Address)
+	}
+}
+
+// Test that a program for the customos target builds, with a dummy OS backend
+// package. The result is an archive that defines the entry point called by the
+// OS and contains the backend.
+func TestCustomOS(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	archive := filepath.Join(tmpdir, "customos.a")
+	err = runBuild("./"+TESTDATA+"/customos/", archive, &compileopts.Options{
+		Target: TESTDATA + "/customos/target.json",
+		Opt:    "z",
+	})
+	if err != nil {
+		printCompilerError(t.Log, err)
+		t.FailNow()
+	}
+
+	// Find all symbols that are defined in the archive.
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	defined := map[string]bool{}
+	r := ar.NewReader(f)
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal("could not read archive:", err)
+		}
+		if hdr.Name == "/" {
+			continue // symbol table
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal("could not read archive:", err)
+		}
+		obj, err := elf.NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("could not read object file %s: %s", hdr.Name, err)
+		}
+		symbols, err := obj.Symbols()
+		if err != nil {
+			t.Fatalf("could not read symbols of %s: %s", hdr.Name, err)
+		}
+		for _, symbol := range symbols {
+			if symbol.Section != elf.SHN_UNDEF {
+				defined[symbol.Name] = true
+			}
+		}
+	}
+	for _, name := range []string{"tinygo_os_main", "tinygo_os_putchar", "tinygo_os_ticks_per_second"} {
+		if !defined[name] {
+			t.Errorf("symbol %s is not defined in the archive", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpdir, "customos.h")); err != nil {
+		t.Error("header was not written:", err)
+	}
+}
+
+// Test tinygo test -cover: the coverage data printed by the test binary must
+// end up in the coverage profile, even when it is larger than the buffers in
+// between.
+func TestTestCover(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("can't run tests on the host on Windows")
+	}
+	t.Parallel()
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	profile := filepath.Join(tmpdir, "cover.out")
+	err = ioutil.WriteFile(profile, []byte("mode: set\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buildLock.Lock()
+	passed, err := Test("./"+TESTDATA+"/cover", "", &compileopts.Options{
+		Opt: "z",
+		TestConfig: compileopts.TestConfig{
+			Cover:        true,
+			CoverProfile: profile,
+		},
+	}, false, "")
+	buildLock.Unlock()
+	if err != nil {
+		printCompilerError(t.Log, err)
+		t.FailNow()
+	}
+	if !passed {
+		t.Fatal("test did not pass")
+	}
+
+	// Find the coverage count of the block that starts at each line of
+	// cover.go.
+	data, err := ioutil.ReadFile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	counts := map[int]string{}
+	for _, line := range lines[1:] {
+		// Each line is of the form "file:line.col,line.col numStmt count".
+		var startLine, startCol, endLine, endCol, numStmt int
+		var count string
+		colon := strings.LastIndexByte(line, ':')
+		if colon < 0 {
+			t.Fatalf("invalid line in coverage profile: %#v", line)
+		}
+		file := line[:colon]
+		_, err := fmt.Sscanf(line[colon+1:], "%d.%d,%d.%d %d %s", &startLine, &startCol, &endLine, &endCol, &numStmt, &count)
+		if err != nil || !strings.HasSuffix(file, "/cover.go") || (count != "0" && count != "1") {
+			t.Fatalf("invalid line in coverage profile: %#v", line)
+		}
+		counts[startLine] = count
+	}
+	if len(lines) < 100 {
+		t.Errorf("expected coverage data for all cases of Big, got %d lines", len(lines))
+	}
+	for line, expected := range map[int]string{
+		5:  "1", // if x > 0
+		6:  "1", // return x
+		8:  "0", // return -x
+		13: "0", // return 42
+	} {
+		if counts[line] != expected {
+			t.Errorf("expected count %s for the block at line %d, got %#v", expected, line, counts[line])
+		}
+	}
+}
+
+func TestLLDBCommands(t *testing.T) {
+	commands := lldbCommands([]string{"target remote :3333", "monitor halt", "load", "monitor reset halt"})
+	expected := []string{"gdb-remote :3333", "process plugin packet monitor halt", "target modules load --load --slide 0", "process plugin packet monitor reset halt"}
+	if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected lldb commands: %#v", commands)
+	}
+}
+
+func TestCheckCompareSections(t *testing.T) {
+	matched := "Section .text, range 0x8000000 -- 0x8001234: matched.\nSection .data, range 0x8001234 -- 0x8001240: matched.\n"
+	if err := checkCompareSections([]byte(matched)); err != nil {
+		t.Errorf("unexpected error for matching sections: %s", err)
+	}
+	mismatched := "Section .text, range 0x8000000 -- 0x8001234: MIS-MATCHED!\nSection .data, range 0x8001234 -- 0x8001240: matched.\nwarning: One or more sections of the target image does not match\nthe loaded file\n"
+	err := checkCompareSections([]byte(mismatched))
+	if err == nil || !strings.Contains(err.Error(), "Section .text") {
+		t.Errorf("expected an error for the .text section, got %v", err)
+	}
+}
+
+func TestFlashUsesSerialPort(t *testing.T) {
+	for _, tc := range []struct {
+		flashMethod  string
+		flashCommand string
+		portReset    string
+		uses         bool
+	}{
+		{"openocd", "", "true", false},
+		{"msd", "", "", false},
+		{"msd", "", "true", true},
+		{"command", "nrfjprog --program {hex}", "", false},
+		{"command", "bossac --port={port} {bin}", "", true},
+		{"", "avrdude -P {port} -U flash:w:{hex}:i", "", true},
+	} {
+		config := &compileopts.Config{
+			Options: &compileopts.Options{},
+			Target:  &compileopts.TargetSpec{FlashCommand: tc.flashCommand, PortReset: tc.portReset},
+		}
+		if uses := flashUsesSerialPort(config, tc.flashMethod); uses != tc.uses {
+			t.Errorf("flash method %q with command %q and port reset %q: expected %v, got %v", tc.flashMethod, tc.flashCommand, tc.portReset, tc.uses, uses)
+		}
+	}
+}
+
+func TestSortPortNames(t *testing.T) {
+	for _, tc := range []struct {
+		ports    []string
+		expected []string
+	}{
+		{[]string{"COM10", "COM9", "COM11"}, []string{"COM9", "COM10", "COM11"}},
+		{[]string{"/dev/ttyACM10", "/dev/ttyACM2", "/dev/ttyACM1"}, []string{"/dev/ttyACM1", "/dev/ttyACM2", "/dev/ttyACM10"}},
+		{[]string{"/dev/cu.usbmodem7BB07991", "/dev/cu.usbmodem7BB07993"}, []string{"/dev/cu.usbmodem7BB07991", "/dev/cu.usbmodem7BB07993"}},
+		{[]string{"COM3", "COM03", "COM"}, []string{"COM", "COM03", "COM3"}},
+	} {
+		ports := append([]string(nil), tc.ports...)
+		sortPortNames(ports)
+		if strings.Join(ports, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("sorting %v: expected %v, got %v", tc.ports, tc.expected, ports)
+		}
+	}
+}
+
+func TestReadDeviceTestResult(t *testing.T) {
+	for _, tc := range []struct {
+		output string
+		passed bool
+		err    bool
+	}{
+		{"=== RUN   TestFoo\r\n--- PASS: TestFoo\r\nPASS\r\n", true, false},
+		{"--- FAIL: TestFoo\nFAIL\n", false, false},
+		{"panic: runtime error: index out of range\n", false, false},
+		{"=== RUN   TestFoo\n", false, true},
+	} {
+		// Output after the result must not be read anymore.
+		r := strings.NewReader(tc.output)
+		if !tc.err {
+			r = strings.NewReader(tc.output + "more output\n")
+		}
+		buf := &bytes.Buffer{}
+		passed, err := readDeviceTestResult(r, buf, false)
+		if passed != tc.passed || (err != nil) != tc.err {
+			t.Errorf("%#v: expected passed=%v err=%v, got passed=%v err=%v", tc.output, tc.passed, tc.err, passed, err)
+		}
+		if buf.String() != tc.output {
+			t.Errorf("%#v: unexpected output %#v", tc.output, buf.String())
+		}
+	}
+
+	// With -cover, the coverage data after the result must be read as well.
+	output := "PASS\ntinygo-coverage: foo/foo.go:3.2,4.5 2 1\ntinygo-coverage-end\n"
+	buf := &bytes.Buffer{}
+	passed, err := readDeviceTestResult(strings.NewReader(output+"more output\n"), buf, true)
+	if !passed || err != nil {
+		t.Errorf("expected passed=true err=nil with coverage data, got passed=%v err=%v", passed, err)
+	}
+	if buf.String() != output {
+		t.Errorf("unexpected output with coverage data %#v", buf.String())
+	}
+}
+
 // This TestMain is necessary because TinyGo may also be invoked to run certain
 // LLVM tools in a separate process. Not capturing these invocations would lead
 // to recursive tests.
@@ -347,3 +1002,26 @@ func TestMain(m *testing.M) {
 	// Run normal tests.
 	os.Exit(m.Run())
 }
+
+func TestParseGoLinkFlag(t *testing.T) {
+	globals, stripDebug, err := parseGoLinkFlag(`-s -w -X main.version=1.2.3 -X 'github.com/foo/bar.date=2021-01-02 15:04'`)
+	if err != nil {
+		t.Fatal("could not parse ldflags:", err)
+	}
+	if !stripDebug {
+		t.Error("expected -s and -w to strip debug information")
+	}
+	if globals["main"]["version"] != "1.2.3" {
+		t.Errorf("unexpected value for main.version: %#v", globals["main"]["version"])
+	}
+	if globals["github.com/foo/bar"]["date"] != "2021-01-02 15:04" {
+		t.Errorf("unexpected value for github.com/foo/bar.date: %#v", globals["github.com/foo/bar"]["date"])
+	}
+
+	for _, ldflags := range []string{"-X main.version", "-unknown", "-X main.a=b extra"} {
+		_, _, err := parseGoLinkFlag(ldflags)
+		if err == nil {
+			t.Errorf("expected an error for ldflags %#v", ldflags)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/goenv"
+	"go.bug.st/serial"
+)
+
+// Baud rate used by Monitor if the target doesn't specify one.
+const defaultBaudRate = 115200
+
+// Monitor opens the serial port of the device and copies everything it
+// receives to stdout, while sending stdin to the device. The port is detected
+// in the same way as for flashing. If executable is set, it must be the ELF
+// file running on the device: it is then used to decode the addresses printed
+// on a panic or fault to function names and source locations. Otherwise the
+// program that was last flashed for this target with tinygo flash is used, if
+// there is one. If crashLogPath is set, the crash logs printed by the device
+// (see runtime/crashlog.Dump) are also appended to that file.
+func Monitor(executable, port, crashLogPath string, config *compileopts.Config) error {
+	if path := lastFlashedPath(config); executable == "" && path != "" {
+		if _, err := os.Stat(path); err == nil {
+			fmt.Fprintln(os.Stderr, "Decoding addresses using the program last flashed for this target.")
+			executable = path
+		}
+	}
+	var decoder *addressDecoder
+	if executable != "" {
+		var err error
+		decoder, err = newAddressDecoder(executable)
+		if err != nil {
+			return err
+		}
+	}
+
+	p, err := openSerialPort(port, config)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	fmt.Fprintln(os.Stderr, "Press Ctrl-C to exit.")
+
+	go func() {
+		// Errors are ignored: the output of the device is what matters.
+		io.Copy(p, os.Stdin)
+	}()
+
+	w := &monitorWriter{w: os.Stdout}
+	if decoder != nil {
+		w.lookup = decoder.lookup
+	}
+	if crashLogPath != "" {
+		f, err := os.OpenFile(crashLogPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w.crashLog = f
+	}
+	buf := make([]byte, 1024)
+	for {
+		n, err := p.Read(buf)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errors.New("serial port was closed")
+		}
+		if _, err := w.Write(buf[:n]); err != nil {
+			return err
+		}
+	}
+}
+
+// openSerialPort opens the serial port of the device at the baud rate of the
+// target. The port is detected in the same way as for flashing. Opening is
+// retried for a few seconds, as the port may take a moment to appear, for
+// example right after the device has been flashed and reset.
+func openSerialPort(port string, config *compileopts.Config) (serial.Port, error) {
+	baudRate := config.Target.SerialBaudRate
+	if baudRate == 0 {
+		baudRate = defaultBaudRate
+	}
+
+	var p serial.Port
+	var err error
+	for i := 0; i < 10; i++ {
+		if i != 0 {
+			time.Sleep(500 * time.Millisecond)
+		}
+		var name string
+		name, err = getDefaultPort(strings.FieldsFunc(port, func(c rune) bool { return c == ',' }))
+		if err != nil {
+			continue
+		}
+		p, err = serial.Open(name, &serial.Mode{BaudRate: int(baudRate)})
+		if err != nil {
+			err = fmt.Errorf("could not open serial port %s: %w", name, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Connected to %s at %d baud.\n", name, baudRate)
+		return p, nil
+	}
+	return nil, err
+}
+
+// Symbolize copies r to w, adding the function name and source location after
+// every address printed by the runtime on a panic or fault, like Monitor. The
+// executable must be the ELF file that produced the output.
+func Symbolize(executable string, r io.Reader, w io.Writer) error {
+	decoder, err := newAddressDecoder(executable)
+	if err != nil {
+		return err
+	}
+	mw := &monitorWriter{w: w, lookup: decoder.lookup}
+	_, err = io.Copy(mw, r)
+	if err != nil {
+		return err
+	}
+	if len(mw.line) != 0 {
+		// Decode the last line as well, if it doesn't end with a newline.
+		_, err = mw.Write([]byte{'\n'})
+	}
+	return err
+}
+
+// lastFlashedPath returns the path where a copy of the program that was last
+// flashed for the configured target is stored, so that tinygo monitor can
+// decode its panics without having to pass the executable. It returns the empty
+// string if no target is set (the host), which can't be flashed.
+func lastFlashedPath(config *compileopts.Config) string {
+	if config.Options.Target == "" {
+		return ""
+	}
+	target := strings.TrimSuffix(filepath.Base(config.Options.Target), ".json")
+	return filepath.Join(goenv.Get("GOCACHE"), "last-flashed-"+target+".elf")
+}
+
+// rememberFlashedProgram stores a copy of the executable as the program last
+// flashed for the configured target. Errors are ignored, as this is only a
+// convenience.
+func rememberFlashedProgram(executable string, config *compileopts.Config) {
+	path := lastFlashedPath(config)
+	if path == "" || os.MkdirAll(filepath.Dir(path), 0777) != nil {
+		return
+	}
+	if copyFile(executable, path) != nil {
+		os.Remove(path)
+	}
+}
+
+// Addresses printed by the runtime that can be decoded: the addresses of an
+// error trace (one per line) and the PC of a Cortex-M fault.
+var (
+	monitorTraceAddress = regexp.MustCompile(`^\s+(0x[0-9a-f]+)\s*$`)
+	monitorFaultAddress = regexp.MustCompile(`^fatal error: .* pc=(0x[0-9a-f]+)`)
+)
+
+// Lines around a crash log printed by runtime/crashlog.Dump.
+const (
+	monitorCrashLogStart = "--- crashlog ---"
+	monitorCrashLogEnd   = "--- end of crashlog ---"
+)
+
+// monitorWriter writes serial output unmodified to w, but adds a line with the
+// function and source location after every line that contains an address
+// printed by the runtime on a panic or fault. If crashLog is set, the lines of
+// a crash log (and their locations) are copied to it as well.
+type monitorWriter struct {
+	w          io.Writer
+	lookup     func(addr uint64) (string, bool)
+	crashLog   io.Writer
+	inCrashLog bool   // currently between the start and end of a crash log
+	line       []byte // current (incomplete) line
+}
+
+func (mw *monitorWriter) Write(buf []byte) (int, error) {
+	if mw.lookup == nil && mw.crashLog == nil {
+		return mw.w.Write(buf)
+	}
+	written := 0
+	for len(buf) != 0 {
+		// Write everything up to and including the next newline.
+		index := bytes.IndexByte(buf, '\n')
+		if index < 0 {
+			n, err := mw.w.Write(buf)
+			if len(mw.line)+len(buf) <= 256 {
+				mw.line = append(mw.line, buf...)
+			}
+			return written + n, err
+		}
+		n, err := mw.w.Write(buf[:index+1])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		mw.line = append(mw.line, buf[:index]...)
+		line := strings.TrimRight(string(mw.line), "\r")
+		mw.line = mw.line[:0]
+		buf = buf[index+1:]
+
+		if mw.crashLog != nil {
+			switch {
+			case line == monitorCrashLogStart:
+				mw.inCrashLog = true
+			case line == monitorCrashLogEnd:
+				mw.inCrashLog = false
+			case mw.inCrashLog:
+				if _, err := io.WriteString(mw.crashLog, line+"\n"); err != nil {
+					return written, err
+				}
+			}
+		}
+		if mw.lookup == nil {
+			continue
+		}
+
+		// Add the location of the address in this line, if there is one.
+		match := monitorTraceAddress.FindStringSubmatch(line)
+		if match == nil {
+			match = monitorFaultAddress.FindStringSubmatch(line)
+		}
+		if match == nil {
+			continue
+		}
+		addr, err := strconv.ParseUint(match[1][2:], 16, 64)
+		if err != nil {
+			continue
+		}
+		if location, ok := mw.lookup(addr); ok {
+			fmt.Fprintf(mw.w, "        %s\n", location)
+			if mw.inCrashLog {
+				fmt.Fprintf(mw.crashLog, "        %s\n", location)
+			}
+		}
+	}
+	return written, nil
+}
+
+// addressDecoder converts addresses in an executable to function names and
+// source locations.
+type addressDecoder struct {
+	symbols []elf.Symbol // function symbols, sorted by address
+	lines   []addressLine
+}
+
+// addressLine is a single row of the DWARF line table.
+type addressLine struct {
+	addr uint64
+	file string
+	line int
+	end  bool // end of a sequence, not an actual location
+}
+
+// newAddressDecoder loads the symbol table and line table of the given ELF
+// file.
+func newAddressDecoder(executable string) (*addressDecoder, error) {
+	f, err := elf.Open(executable)
+	if err != nil {
+		return nil, fmt.Errorf("could not load executable for decoding addresses: %w", err)
+	}
+	defer f.Close()
+
+	decoder := &addressDecoder{}
+	symbols, err := f.Symbols()
+	if err != nil {
+		return nil, fmt.Errorf("could not load symbols of executable: %w", err)
+	}
+	for _, symbol := range symbols {
+		if elf.ST_TYPE(symbol.Info) != elf.STT_FUNC || symbol.Size == 0 {
+			continue
+		}
+		if f.Machine == elf.EM_ARM {
+			// Clear the Thumb bit.
+			symbol.Value &^= 1
+		}
+		decoder.symbols = append(decoder.symbols, symbol)
+	}
+	sort.Slice(decoder.symbols, func(i, j int) bool {
+		return decoder.symbols[i].Value < decoder.symbols[j].Value
+	})
+
+	// The line table is optional, as the program may have been built with
+	// -no-debug.
+	if data, err := f.DWARF(); err == nil {
+		r := data.Reader()
+		for {
+			entry, err := r.Next()
+			if err != nil || entry == nil {
+				break
+			}
+			if entry.Tag != dwarf.TagCompileUnit {
+				r.SkipChildren()
+				continue
+			}
+			lr, err := data.LineReader(entry)
+			if err != nil || lr == nil {
+				continue
+			}
+			var le dwarf.LineEntry
+			for lr.Next(&le) == nil {
+				decoder.lines = append(decoder.lines, addressLine{le.Address, le.File.Name, le.Line, le.EndSequence})
+			}
+		}
+		sort.SliceStable(decoder.lines, func(i, j int) bool {
+			a, b := decoder.lines[i], decoder.lines[j]
+			if a.addr != b.addr {
+				return a.addr < b.addr
+			}
+			// The end of one sequence may be the start of the next.
+			return a.end && !b.end
+		})
+	}
+	return decoder, nil
+}
+
+// lookup returns the function name and source location of a return address or
+// PC, for example "main.foo main.go:12".
+func (d *addressDecoder) lookup(addr uint64) (string, bool) {
+	if addr == 0 {
+		return "", false
+	}
+	// Return addresses point just after the call instruction, so look up the
+	// byte before it. This is also correct for a PC, except when it points to
+	// the first instruction of a function which is rarely the case.
+	addr--
+
+	i := sort.Search(len(d.symbols), func(i int) bool {
+		return d.symbols[i].Value > addr
+	}) - 1
+	if i < 0 || addr >= d.symbols[i].Value+d.symbols[i].Size {
+		return "", false
+	}
+	location := d.symbols[i].Name
+
+	j := sort.Search(len(d.lines), func(j int) bool {
+		return d.lines[j].addr > addr
+	}) - 1
+	if j >= 0 && !d.lines[j].end {
+		location += " " + d.lines[j].file + ":" + strconv.Itoa(d.lines[j].line)
+	}
+	return location, true
+}
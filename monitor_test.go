@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+)
+
+func TestMonitorWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &monitorWriter{
+		w: buf,
+		lookup: func(addr uint64) (string, bool) {
+			if addr == 0x1234 {
+				return "main.foo main.go:12", true
+			}
+			return "", false
+		},
+	}
+	// Write the output in small chunks, as it would be read from a serial
+	// port.
+	input := "hello\r\npanic: some error\nerror trace:\n  0x00001234\r\n  0x00005678\nfatal error: HardFault with sp=0x20001000 pc=0x1234\n0x1234\n"
+	for i := 0; i < len(input); i += 5 {
+		end := i + 5
+		if end > len(input) {
+			end = len(input)
+		}
+		w.Write([]byte(input[i:end]))
+	}
+	expected := strings.Join([]string{
+		"hello\r",
+		"panic: some error",
+		"error trace:",
+		"  0x00001234\r",
+		"        main.foo main.go:12",
+		"  0x00005678",
+		"fatal error: HardFault with sp=0x20001000 pc=0x1234",
+		"        main.foo main.go:12",
+		"0x1234", // not indented, so not part of an error trace
+		"",
+	}, "\n")
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestMonitorWriterCrashLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	crashLog := &bytes.Buffer{}
+	w := &monitorWriter{
+		w:        buf,
+		crashLog: crashLog,
+		lookup: func(addr uint64) (string, bool) {
+			if addr == 0x1234 {
+				return "main.foo main.go:12", true
+			}
+			return "", false
+		},
+	}
+	input := "booting\n--- crashlog ---\r\npanic: some error\nfatal error: HardFault pc=0x1234\n--- end of crashlog ---\nrunning\n"
+	for i := 0; i < len(input); i += 5 {
+		end := i + 5
+		if end > len(input) {
+			end = len(input)
+		}
+		w.Write([]byte(input[i:end]))
+	}
+	if !strings.HasPrefix(buf.String(), "booting\n--- crashlog ---\r\n") {
+		t.Errorf("serial output was modified:\n%s", buf.String())
+	}
+	expected := strings.Join([]string{
+		"panic: some error",
+		"fatal error: HardFault pc=0x1234",
+		"        main.foo main.go:12",
+		"",
+	}, "\n")
+	if crashLog.String() != expected {
+		t.Errorf("unexpected crash log:\n%s\nexpected:\n%s", crashLog.String(), expected)
+	}
+}
+
+func TestSymbolize(t *testing.T) {
+	// A program built with -no-debug: only the symbol table is used.
+	executable := filepath.Join(t.TempDir(), "test.elf")
+	writeSymbolELF(t, executable, "main.foo", 0x1001, 0x20) // Thumb function
+
+	// The last line has no newline, but must be decoded as well.
+	input := "panic: some error\nerror trace:\n  0x00001010\n  0x00002000\n  0x00001020"
+	buf := &bytes.Buffer{}
+	err := Symbolize(executable, strings.NewReader(input), buf)
+	if err != nil {
+		t.Fatal("could not symbolize:", err)
+	}
+	expected := strings.Join([]string{
+		"panic: some error",
+		"error trace:",
+		"  0x00001010",
+		"        main.foo",
+		"  0x00002000",
+		"  0x00001020", // return address just after the end of main.foo
+		"        main.foo",
+		"",
+	}, "\n")
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	if err := Symbolize(filepath.Join(t.TempDir(), "missing.elf"), strings.NewReader(input), buf); err == nil {
+		t.Error("expected an error for a missing executable")
+	}
+}
+
+// writeSymbolELF writes a 32-bit ARM ELF file that only contains a symbol table
+// with a single function.
+func writeSymbolELF(t *testing.T, path, name string, value, size uint32) {
+	strtab := "\x00" + name + "\x00"
+	shstrtab := "\x00.symtab\x00.strtab\x00.shstrtab\x00"
+	symtabOffset := uint32(binary.Size(elf.Header32{}))
+	symtabSize := uint32(2 * binary.Size(elf.Sym32{}))
+	strtabOffset := symtabOffset + symtabSize
+	shstrtabOffset := strtabOffset + uint32(len(strtab))
+	shoff := shstrtabOffset + uint32(len(shstrtab))
+
+	header := elf.Header32{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_ARM),
+		Version:   uint32(elf.EV_CURRENT),
+		Ehsize:    uint16(binary.Size(elf.Header32{})),
+		Shoff:     shoff,
+		Shentsize: uint16(binary.Size(elf.Section32{})),
+		Shnum:     4,
+		Shstrndx:  3,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS32)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, header)
+	binary.Write(buf, binary.LittleEndian, []elf.Sym32{
+		{}, // the first symbol is always the undefined symbol
+		{Name: 1, Value: value, Size: size, Info: elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC), Shndx: 1},
+	})
+	buf.WriteString(strtab)
+	buf.WriteString(shstrtab)
+	binary.Write(buf, binary.LittleEndian, []elf.Section32{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_SYMTAB), Off: symtabOffset, Size: symtabSize, Link: 2, Info: 1, Entsize: uint32(binary.Size(elf.Sym32{}))},
+		{Name: 9, Type: uint32(elf.SHT_STRTAB), Off: strtabOffset, Size: uint32(len(strtab))},
+		{Name: 17, Type: uint32(elf.SHT_STRTAB), Off: shstrtabOffset, Size: uint32(len(shstrtab))},
+	})
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		t.Fatal("could not write ELF file:", err)
+	}
+}
+
+func TestLastFlashedPath(t *testing.T) {
+	oldCache := os.Getenv("TINYGOCACHE")
+	defer os.Setenv("TINYGOCACHE", oldCache)
+	os.Setenv("TINYGOCACHE", filepath.Join("cache", "tinygo"))
+
+	for _, tc := range []struct {
+		target string
+		path   string
+	}{
+		{"pca10040", filepath.Join("cache", "tinygo", "last-flashed-pca10040.elf")},
+		{filepath.Join("boards", "custom.json"), filepath.Join("cache", "tinygo", "last-flashed-custom.elf")},
+		{"", ""}, // the host can't be flashed
+	} {
+		config := &compileopts.Config{Options: &compileopts.Options{Target: tc.target}}
+		if path := lastFlashedPath(config); path != tc.path {
+			t.Errorf("target %q: expected %q, got %q", tc.target, tc.path, path)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default UDP port of the ArduinoOTA protocol on the ESP32.
+const otaDefaultPort = "3232"
+
+// Commands of the ArduinoOTA protocol.
+const (
+	otaCommandFlash = 0
+	otaCommandAuth  = 200
+)
+
+// Timeout for the device to respond, or to connect back.
+const otaTimeout = 10 * time.Second
+
+// flashOTA sends the firmware image to a device over the network using the
+// ArduinoOTA protocol (as implemented by espota.py). The address is a host name
+// or IP address, optionally followed by a port. The device must run firmware
+// that implements the receiving side of the protocol. If the device requires a
+// password, it is read from the TINYGO_OTA_PASSWORD environment variable.
+//
+// The protocol works as follows: an invitation with the size and MD5 hash of
+// the image is sent to the device over UDP, after which the device connects
+// back over TCP to receive the image.
+func flashOTA(address, binary string) error {
+	if address == "" {
+		return errors.New("OTA flashing needs the address of the device - use -port flag")
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, otaDefaultPort)
+	}
+	data, err := ioutil.ReadFile(binary)
+	if err != nil {
+		return err
+	}
+	hash := md5.Sum(data)
+	hashString := hex.EncodeToString(hash[:])
+
+	// Listen for the device to connect back.
+	udpConn, err := net.Dial("udp", address)
+	if err != nil {
+		return err
+	}
+	defer udpConn.Close()
+	localIP := udpConn.LocalAddr().(*net.UDPAddr).IP
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: localIP})
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	localPort := listener.Addr().(*net.TCPAddr).Port
+
+	// Invite the device to receive the image.
+	reply, err := otaRequest(udpConn, fmt.Sprintf("%d %d %d %s\n", otaCommandFlash, localPort, len(data), hashString))
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(reply, "AUTH") {
+		password := os.Getenv("TINYGO_OTA_PASSWORD")
+		if password == "" {
+			return errors.New("device requires a password - set TINYGO_OTA_PASSWORD")
+		}
+		nonce := strings.TrimSpace(reply[len("AUTH"):])
+		remoteIP := udpConn.RemoteAddr().(*net.UDPAddr).IP.String()
+		cnonce := md5Hex(filepath.Base(binary) + strconv.Itoa(len(data)) + hashString + remoteIP)
+		result := md5Hex(md5Hex(password) + ":" + nonce + ":" + cnonce)
+		reply, err = otaRequest(udpConn, fmt.Sprintf("%d %s %s\n", otaCommandAuth, cnonce, result))
+		if err != nil {
+			return err
+		}
+		if reply != "OK" {
+			return errors.New("OTA authentication failed")
+		}
+	} else if reply != "OK" {
+		return fmt.Errorf("unexpected OTA reply: %#v", reply)
+	}
+
+	// Send the image over the connection the device opens.
+	listener.SetDeadline(time.Now().Add(otaTimeout))
+	conn, err := listener.Accept()
+	if err != nil {
+		return fmt.Errorf("device did not connect: %w", err)
+	}
+	defer conn.Close()
+	buf := make([]byte, 32)
+	var response []byte
+	for offset := 0; offset < len(data); offset += 1460 {
+		end := offset + 1460
+		if end > len(data) {
+			end = len(data)
+		}
+		conn.SetDeadline(time.Now().Add(otaTimeout))
+		if _, err := conn.Write(data[offset:end]); err != nil {
+			return err
+		}
+		// The device acknowledges every chunk with the number of bytes it
+		// received.
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		response = append(response, buf[:n]...)
+		fmt.Fprintf(os.Stderr, "\rUploading: %3d%%", end*100/len(data))
+	}
+	fmt.Fprintln(os.Stderr)
+
+	// Wait for the device to verify the image, which may take a while.
+	conn.SetDeadline(time.Now().Add(6 * otaTimeout))
+	for !strings.Contains(string(response), "OK") {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return fmt.Errorf("device did not accept the image: %w", err)
+		}
+		response = append(response, buf[:n]...)
+	}
+	return nil
+}
+
+// otaRequest sends a message to the device over UDP and returns its reply. The
+// message is sent again if there is no reply, as UDP packets may get lost.
+func otaRequest(conn net.Conn, message string) (string, error) {
+	buf := make([]byte, 64)
+	var err error
+	for i := 0; i < 10; i++ {
+		if _, err = conn.Write([]byte(message)); err != nil {
+			return "", err
+		}
+		conn.SetReadDeadline(time.Now().Add(otaTimeout / 10))
+		var n int
+		n, err = conn.Read(buf)
+		if err == nil {
+			return strings.TrimSpace(string(buf[:n])), nil
+		}
+	}
+	return "", fmt.Errorf("no response from device: %w", err)
+}
+
+// md5Hex returns the MD5 hash of s as a hexadecimal string.
+func md5Hex(s string) string {
+	hash := md5.Sum([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFlashOTA(t *testing.T) {
+	for _, password := range []string{"", "secret"} {
+		password := password
+		t.Run(fmt.Sprintf("password=%#v", password), func(t *testing.T) {
+			testFlashOTA(t, password)
+		})
+	}
+}
+
+func testFlashOTA(t *testing.T, password string) {
+	// Create a firmware image that needs several chunks.
+	image := bytes.Repeat([]byte("tinygo firmware\n"), 500)
+	dir, err := ioutil.TempDir("", "tinygo-ota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	binary := filepath.Join(dir, "firmware.bin")
+	if err := ioutil.WriteFile(binary, image, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// Run a fake device that implements the receiving side of the protocol.
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udpConn.Close()
+	received := make(chan []byte, 1)
+	deviceErr := make(chan error, 1)
+	go func() {
+		deviceErr <- func() error {
+			buf := make([]byte, 256)
+			n, addr, err := udpConn.ReadFromUDP(buf)
+			if err != nil {
+				return err
+			}
+			var command, port, size int
+			var hash string
+			if _, err := fmt.Sscanf(string(buf[:n]), "%d %d %d %s\n", &command, &port, &size, &hash); err != nil {
+				return err
+			}
+			if command != otaCommandFlash || size != len(image) || hash != md5Hex(string(image)) {
+				return fmt.Errorf("unexpected invitation: %#v", string(buf[:n]))
+			}
+			if password != "" {
+				udpConn.WriteToUDP([]byte("AUTH 1234"), addr)
+				n, addr, err = udpConn.ReadFromUDP(buf)
+				if err != nil {
+					return err
+				}
+				fields := strings.Fields(string(buf[:n]))
+				if len(fields) != 3 || fields[0] != strconv.Itoa(otaCommandAuth) || fields[2] != md5Hex(md5Hex(password)+":1234:"+fields[1]) {
+					return fmt.Errorf("unexpected authentication: %#v", string(buf[:n]))
+				}
+			}
+			udpConn.WriteToUDP([]byte("OK"), addr)
+
+			conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{IP: addr.IP, Port: port})
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			var data []byte
+			for len(data) < size {
+				n, err := conn.Read(buf)
+				if err != nil {
+					return err
+				}
+				data = append(data, buf[:n]...)
+				conn.Write([]byte(strconv.Itoa(n)))
+			}
+			conn.Write([]byte("OK"))
+			received <- data
+			return nil
+		}()
+	}()
+
+	os.Setenv("TINYGO_OTA_PASSWORD", password)
+	defer os.Unsetenv("TINYGO_OTA_PASSWORD")
+	err = flashOTA(udpConn.LocalAddr().String(), binary)
+	if err != nil {
+		t.Fatal("could not flash:", err)
+	}
+	if err := <-deviceErr; err != nil {
+		t.Fatal("device error:", err)
+	}
+	if data := <-received; !bytes.Equal(data, image) {
+		t.Errorf("received image differs: %d bytes instead of %d bytes", len(data), len(image))
+	}
+}
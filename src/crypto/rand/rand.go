@@ -0,0 +1,25 @@
+// Package rand implements a cryptographically secure random number generator.
+//
+// On hosted systems the random data comes from the operating system. On
+// microcontrollers it comes from the hardware random number generator when the
+// chip has one, and from an entropy pool fed by timing jitter otherwise. When
+// no usable entropy source is available, reads return an error instead of
+// predictable data.
+package rand
+
+import (
+	"errors"
+	"io"
+)
+
+// Reader is a global, shared instance of a cryptographically
+// secure random number generator.
+var Reader io.Reader = &reader{}
+
+// Read is a helper function that calls Reader.Read using io.ReadFull.
+// On return, n == len(b) if and only if err == nil.
+func Read(b []byte) (n int, err error) {
+	return io.ReadFull(Reader, b)
+}
+
+var errNoEntropy = errors.New("crypto/rand: no entropy source available")
@@ -0,0 +1,26 @@
+// +build nrf stm32f4 atsamd51 atsame5x
+
+package rand
+
+// This file reads random data from the hardware random number generator of the
+// chip.
+
+import "machine"
+
+type reader struct{}
+
+func (r *reader) Read(b []byte) (n int, err error) {
+	var value uint32
+	for i := range b {
+		if i%4 == 0 {
+			value, err = machine.GetRNG()
+			if err != nil {
+				return i, err
+			}
+		} else {
+			value >>= 8
+		}
+		b[i] = byte(value)
+	}
+	return len(b), nil
+}
@@ -0,0 +1,27 @@
+// +build !baremetal,!js,!nintendoswitch
+
+package rand
+
+// This file reads random data from the operating system using getentropy,
+// which is provided by glibc, musl, the macOS libSystem and wasi-libc.
+
+type reader struct{}
+
+func (r *reader) Read(b []byte) (n int, err error) {
+	// getentropy can read at most 256 bytes at a time.
+	for n < len(b) {
+		chunk := b[n:]
+		if len(chunk) > 256 {
+			chunk = chunk[:256]
+		}
+		if libc_getentropy(&chunk[0], uint(len(chunk))) != 0 {
+			return n, errNoEntropy
+		}
+		n += len(chunk)
+	}
+	return n, nil
+}
+
+// int getentropy(void *buf, size_t buflen);
+//export getentropy
+func libc_getentropy(buf *byte, buflen uint) int32
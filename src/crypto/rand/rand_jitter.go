@@ -0,0 +1,123 @@
+// +build baremetal,!nrf,!stm32f4,!atsamd51,!atsame5x nintendoswitch
+
+package rand
+
+// This file implements an entropy pool for chips without a hardware random
+// number generator. The pool is seeded from timing jitter: the number of loop
+// iterations that fit in a single tick of the system timer. This count varies
+// slightly when the CPU clock and the timer clock come from different
+// oscillators. If they don't (or the variation is too small to be useful),
+// reads fail instead of returning predictable data.
+//
+// Random data is produced by hashing the pool state together with a counter,
+// and fresh jitter samples are mixed in on every read.
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+const (
+	// Number of jitter samples used to seed the pool. Only the lowest bits of
+	// each sample carry entropy, so this is deliberately generous.
+	seedSamples = 256
+
+	// Number of jitter samples mixed in on every read.
+	reseedSamples = 16
+
+	// Minimum number of distinct sample values for the jitter source to be
+	// considered working.
+	minDistinctSamples = 8
+
+	// Give up on a sample after this many loop iterations. Some targets (such
+	// as emulators) have a clock that doesn't advance on its own.
+	maxSampleIterations = 1 << 24
+)
+
+var errLowEntropy = errors.New("crypto/rand: timing jitter too low to use as entropy source")
+
+type reader struct {
+	seeded  bool
+	pool    [sha256.Size]byte
+	counter uint64
+}
+
+func (r *reader) Read(b []byte) (n int, err error) {
+	if !r.seeded {
+		err = r.mix(seedSamples, true)
+		if err != nil {
+			return 0, err
+		}
+		r.seeded = true
+	} else {
+		// The pool has been seeded successfully before, so a failure to
+		// gather more samples is not fatal.
+		r.mix(reseedSamples, false)
+	}
+
+	var block [sha256.Size + 8]byte
+	copy(block[:], r.pool[:])
+	for n < len(b) {
+		r.counter++
+		binary.LittleEndian.PutUint64(block[sha256.Size:], r.counter)
+		out := sha256.Sum256(block[:])
+		n += copy(b[n:], out[:])
+	}
+
+	// Make sure the output that was just returned can't be used to
+	// reconstruct earlier or later output.
+	r.counter++
+	binary.LittleEndian.PutUint64(block[sha256.Size:], r.counter)
+	r.pool = sha256.Sum256(block[:])
+	return n, nil
+}
+
+// mix gathers the given number of jitter samples and hashes them into the
+// pool. If check is set, it returns an error when the samples look too regular
+// to contain any entropy.
+func (r *reader) mix(samples int, check bool) error {
+	h := sha256.New()
+	h.Write(r.pool[:])
+	var distinct [256]bool
+	numDistinct := 0
+	var buf [4]byte
+	for i := 0; i < samples; i++ {
+		sample, ok := jitterSample()
+		if !ok {
+			return errLowEntropy
+		}
+		if !distinct[byte(sample)] {
+			distinct[byte(sample)] = true
+			numDistinct++
+		}
+		binary.LittleEndian.PutUint32(buf[:], sample)
+		h.Write(buf[:])
+	}
+	if check && numDistinct < minDistinctSamples {
+		return errLowEntropy
+	}
+	h.Sum(r.pool[:0])
+	return nil
+}
+
+// jitterSample counts how many loop iterations fit in a single tick of the
+// system timer. It returns false if the timer doesn't seem to advance.
+func jitterSample() (uint32, bool) {
+	start := time.Now().UnixNano()
+	for i := 0; time.Now().UnixNano() == start; i++ {
+		if i >= maxSampleIterations {
+			return 0, false
+		}
+	}
+	start = time.Now().UnixNano()
+	count := uint32(0)
+	for time.Now().UnixNano() == start {
+		count++
+		if count >= maxSampleIterations {
+			return 0, false
+		}
+	}
+	return count, true
+}
@@ -0,0 +1,30 @@
+// +build js
+
+package rand
+
+// This file reads random data from the Web Crypto API, which is available in
+// browsers and in Node.js.
+
+import "syscall/js"
+
+type reader struct{}
+
+func (r *reader) Read(b []byte) (n int, err error) {
+	crypto := js.Global().Get("crypto")
+	if crypto.IsUndefined() {
+		return 0, errNoEntropy
+	}
+	// getRandomValues can fill at most 65536 bytes at a time.
+	array := js.Global().Get("Uint8Array").New(65536)
+	for n < len(b) {
+		chunk := b[n:]
+		if len(chunk) > 65536 {
+			chunk = chunk[:65536]
+		}
+		view := array.Call("subarray", 0, len(chunk))
+		crypto.Call("getRandomValues", view)
+		js.CopyBytesToGo(chunk, view)
+		n += len(chunk)
+	}
+	return n, nil
+}
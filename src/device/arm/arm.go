@@ -57,6 +57,26 @@ func Asm(asm string)
 // return value.
 func AsmFull(asm string, regs map[string]interface{}) uintptr
 
+// Run the given inline assembly with operands, in the style of GCC extended
+// asm. The constraints string lists the output constraints (like "=r"), then
+// the input constraints (like "r"), then the clobbers (like "~{memory}"),
+// separated by commas. There must be one operand for each output and input
+// constraint, in the same order: outputs are pointers that receive the result
+// and inputs are values. Operands are referenced in the asm string as $0, $1,
+// etc., and a literal $ is written as $$. For example:
+//
+//     var lo, hi uint32
+//     arm.AsmExtPure("umull $0, $1, $2, $3", "=r,=r,r,r", &lo, &hi, a, b)
+//
+// The compiler checks the constraints and operands. The code is marked as
+// having side effects, so it is never optimized away.
+func AsmExt(asm, constraints string, operands ...interface{})
+
+// AsmExtPure is like AsmExt, but the code is assumed to have no side effects
+// other than writing its outputs. Therefore it may be removed by the optimizer
+// when the outputs are unused, or merged with identical code.
+func AsmExtPure(asm, constraints string, operands ...interface{})
+
 // Run the following system call (SVCall) with 0 arguments.
 func SVCall0(num uintptr) uintptr
 
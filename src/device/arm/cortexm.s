@@ -4,12 +4,33 @@
 .section .text.HardFault_Handler
 .global  HardFault_Handler
 .type    HardFault_Handler, %function
+.global  MemoryManagement_Handler
+.type    MemoryManagement_Handler, %function
+.global  BusFault_Handler
+.type    BusFault_Handler, %function
+.global  UsageFault_Handler
+.type    UsageFault_Handler, %function
 HardFault_Handler:
+MemoryManagement_Handler:
+BusFault_Handler:
+UsageFault_Handler:
+    // The configurable faults (MemManage, BusFault, UsageFault) are escalated
+    // to a HardFault unless they are enabled in SHCSR, but if they are enabled
+    // they are handled in the same way. This is all valid Cortex-M0 code.
     .cfi_startproc
     // Put the old stack pointer in the first argument, for easy debugging. This
     // is especially useful on Cortex-M0, which supports far fewer debug
-    // facilities.
-    mov r0, sp
+    // facilities. Bit 2 of EXC_RETURN (in LR) indicates whether the registers
+    // were stacked on the MSP or on the PSP (the latter is used by goroutines).
+    movs r0, #4
+    mov  r1, lr
+    tst  r0, r1
+    bne  1f
+    mrs  r0, MSP
+    b    2f
+1:
+    mrs  r0, PSP
+2:
 
     // Load the default stack pointer from address 0 so that we can call normal
     // functions again that expect a working stack. However, it will corrupt the
@@ -19,11 +40,71 @@ HardFault_Handler:
     ldr r3, [r3]
     mov sp, r3
 
+    // Save r4-r11, which are not stacked by the processor, and put a pointer to
+    // them in the second argument. They're only needed for core dumps.
+    push {r4-r7}
+    mov  r4, r8
+    mov  r5, r9
+    mov  r6, r10
+    mov  r7, r11
+    push {r4-r7}
+    mov  r1, sp
+
     // Continue handling this error in Go.
     bl handleHardFault
     .cfi_endproc
 .size HardFault_Handler, .-HardFault_Handler
 
+// The DebugMonitor exception is raised when a watchpoint set with the
+// runtime/watchpoint package is hit (and no debugger is attached). It passes
+// the stack pointer with the stacked registers to tinygo_handleDebugMonitor,
+// which is only defined when that package is used. Otherwise, the exception is
+// ignored.
+.section .text.DebugMon_Handler
+.global  DebugMon_Handler
+.type    DebugMon_Handler, %function
+.weak    tinygo_handleDebugMonitor
+DebugMon_Handler:
+    .cfi_startproc
+    ldr  r2, =tinygo_handleDebugMonitor
+    cmp  r2, #0
+    beq  3f
+    movs r0, #4
+    mov  r1, lr
+    tst  r0, r1
+    bne  1f
+    mrs  r0, MSP
+    b    2f
+1:
+    mrs  r0, PSP
+2:
+    // Tail call, so that it returns from the exception.
+    bx   r2
+3:
+    bx   lr
+    .cfi_endproc
+.ltorg
+.size DebugMon_Handler, .-DebugMon_Handler
+
+// Run the panic handler set with runtime.SetPanicHandler on the stack in r0,
+// and switch back to the original stack afterwards.
+.section .text.tinygo_runPanicHandlerOnStack
+.global  tinygo_runPanicHandlerOnStack
+.type    tinygo_runPanicHandlerOnStack, %function
+tinygo_runPanicHandlerOnStack:
+    .cfi_startproc
+    push {r4, lr}
+    .cfi_def_cfa_offset 8
+    .cfi_offset lr, -4
+    .cfi_offset r4, -8
+    mov  r4, sp
+    mov  sp, r0
+    bl   tinygo_runPanicHandler
+    mov  sp, r4
+    pop  {r4, pc}
+    .cfi_endproc
+.size tinygo_runPanicHandlerOnStack, .-tinygo_runPanicHandlerOnStack
+
 // This is a convenience function for semihosting support.
 // At some point, this should be replaced by inline assembly.
 .section .text.SemihostingCall
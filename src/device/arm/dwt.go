@@ -0,0 +1,69 @@
+// Hand created file. DO NOT DELETE.
+// Cortex-M Data Watchpoint and Trace (DWT) definitions for ARMv7-M.
+
+// +build cortexm
+
+package arm
+
+import (
+	"runtime/volatile"
+	"unsafe"
+)
+
+const (
+	DWT_BASE   = 0xE0001000
+	DEMCR_BASE = SCS_BASE + 0x0DFC
+)
+
+// Data Watchpoint and Trace (DWT)
+//
+// DWT_Type provides the definitions for the DWT registers of ARMv7-M (Cortex-M3,
+// Cortex-M4 and Cortex-M7). The number of comparators is in the NUMCOMP field
+// of the CTRL register. The DWT must be enabled with the TRCENA bit in DEMCR
+// before it can be used. ARMv8-M cores have a different comparator layout.
+type DWT_Type struct {
+	CTRL     volatile.Register32 // 0x000: Control Register
+	CYCCNT   volatile.Register32 // 0x004: Cycle Count Register
+	CPICNT   volatile.Register32 // 0x008: CPI Count Register
+	EXCCNT   volatile.Register32 // 0x00C: Exception Overhead Count Register
+	SLEEPCNT volatile.Register32 // 0x010: Sleep Count Register
+	LSUCNT   volatile.Register32 // 0x014: LSU Count Register
+	FOLDCNT  volatile.Register32 // 0x018: Folded-instruction Count Register
+	PCSR     volatile.Register32 // 0x01C: Program Counter Sample Register
+	COMP     [16]DWT_COMP_Type   // 0x020: Comparators
+}
+
+// DWT_COMP_Type is a single DWT comparator.
+type DWT_COMP_Type struct {
+	COMP     volatile.Register32 // 0x0: Comparator Register
+	MASK     volatile.Register32 // 0x4: Mask Register
+	FUNCTION volatile.Register32 // 0x8: Function Register
+	_        uint32              // reserved
+}
+
+var DWT = (*DWT_Type)(unsafe.Pointer(uintptr(DWT_BASE)))
+
+// Debug Exception and Monitor Control Register
+var DEMCR = (*volatile.Register32)(unsafe.Pointer(uintptr(DEMCR_BASE)))
+
+const (
+	// CTRL: Control Register
+	DWT_CTRL_NUMCOMP_Pos = 0x1c       // Position of NUMCOMP field.
+	DWT_CTRL_NUMCOMP_Msk = 0xf0000000 // Bit mask of NUMCOMP field.
+
+	// FUNCTION: Comparator Function Register
+	DWT_FUNCTION_FUNCTION_Pos       = 0x0       // Position of FUNCTION field.
+	DWT_FUNCTION_FUNCTION_Msk       = 0xf       // Bit mask of FUNCTION field.
+	DWT_FUNCTION_FUNCTION_Disabled  = 0x0       // Comparator disabled.
+	DWT_FUNCTION_FUNCTION_Read      = 0x5       // Watchpoint on read access.
+	DWT_FUNCTION_FUNCTION_Write     = 0x6       // Watchpoint on write access.
+	DWT_FUNCTION_FUNCTION_ReadWrite = 0x7       // Watchpoint on read or write access.
+	DWT_FUNCTION_MATCHED_Pos        = 0x18      // Position of MATCHED field.
+	DWT_FUNCTION_MATCHED_Msk        = 0x1000000 // Bit mask of MATCHED field.
+
+	// DEMCR: Debug Exception and Monitor Control Register
+	DEMCR_MON_EN_Pos = 0x10      // Position of MON_EN field.
+	DEMCR_MON_EN_Msk = 0x10000   // Bit mask of MON_EN field: enable the DebugMonitor exception.
+	DEMCR_TRCENA_Pos = 0x18      // Position of TRCENA field.
+	DEMCR_TRCENA_Msk = 0x1000000 // Bit mask of TRCENA field: enable the DWT and ITM.
+)
@@ -0,0 +1,65 @@
+// Hand created file. DO NOT DELETE.
+// Cortex-M Instrumentation Trace Macrocell (ITM) definitions.
+
+// +build cortexm
+
+package arm
+
+import (
+	"runtime/volatile"
+	"unsafe"
+)
+
+const ITM_BASE = 0xE0000000
+
+// Instrumentation Trace Macrocell (ITM)
+//
+// ITM_Type provides the definitions for the ITM registers. The ITM sends data
+// written to its stimulus ports to the debugger, usually over the SWO pin. It
+// is only available on Cortex-M3 and higher, and must be enabled (usually by
+// the debugger) before it can be used.
+type ITM_Type struct {
+	STIM [32]volatile.Register32 // 0x000: Stimulus Port Registers
+	_    [864]uint32             // reserved
+	TER  volatile.Register32     // 0xE00: Trace Enable Register
+	_    [15]uint32              // reserved
+	TPR  volatile.Register32     // 0xE40: Trace Privilege Register
+	_    [15]uint32              // reserved
+	TCR  volatile.Register32     // 0xE80: Trace Control Register
+}
+
+var ITM = (*ITM_Type)(unsafe.Pointer(uintptr(ITM_BASE)))
+
+const (
+	// TCR: Trace Control Register
+	ITM_TCR_ITMENA = 0x1 // Bit ITMENA: enable the ITM
+)
+
+// ITMPortEnabled returns whether the ITM is enabled and data written to the
+// given stimulus port (0-31) will be sent to the debugger.
+func ITMPortEnabled(port uint8) bool {
+	return ITM.TCR.Get()&ITM_TCR_ITMENA != 0 && ITM.TER.Get()&(1<<port) != 0
+}
+
+// ITMSendWord sends a 32-bit value over the given stimulus port, waiting until
+// the port can accept more data. Nothing is sent if the port is not enabled.
+func ITMSendWord(port uint8, value uint32) {
+	if !ITMPortEnabled(port) {
+		return
+	}
+	for ITM.STIM[port].Get() == 0 {
+	}
+	ITM.STIM[port].Set(value)
+}
+
+// ITMSendByte sends a single byte over the given stimulus port, waiting until
+// the port can accept more data. Nothing is sent if the port is not enabled.
+func ITMSendByte(port uint8, value byte) {
+	if !ITMPortEnabled(port) {
+		return
+	}
+	for ITM.STIM[port].Get() == 0 {
+	}
+	// A byte write results in a single byte being sent.
+	volatile.StoreUint8((*uint8)(unsafe.Pointer(&ITM.STIM[port])), value)
+}
@@ -0,0 +1,69 @@
+// Hand created file. DO NOT DELETE.
+// Cortex-M Memory Protection Unit (MPU) definitions for ARMv6-M and ARMv7-M
+// (PMSAv7).
+
+// +build cortexm
+
+package arm
+
+import (
+	"runtime/volatile"
+	"unsafe"
+)
+
+const MPU_BASE = SCS_BASE + 0x0D90
+
+// Memory Protection Unit (MPU)
+//
+// MPU_Type provides the definitions for the MPU registers. The MPU is optional,
+// check the DREGION field of the TYPE register for the number of regions it
+// supports (zero if there is no MPU). ARMv8-M cores (Cortex-M23 and Cortex-M33)
+// have an MPU with a different register layout, which is not described here.
+type MPU_Type struct {
+	TYPE volatile.Register32 // 0xD90: MPU Type Register
+	CTRL volatile.Register32 // 0xD94: MPU Control Register
+	RNR  volatile.Register32 // 0xD98: MPU Region Number Register
+	RBAR volatile.Register32 // 0xD9C: MPU Region Base Address Register
+	RASR volatile.Register32 // 0xDA0: MPU Region Attribute and Size Register
+}
+
+var MPU = (*MPU_Type)(unsafe.Pointer(uintptr(MPU_BASE)))
+
+const (
+	// TYPE: MPU Type Register
+	MPU_TYPE_DREGION_Pos = 0x8    // Position of DREGION field.
+	MPU_TYPE_DREGION_Msk = 0xff00 // Bit mask of DREGION field.
+
+	// CTRL: MPU Control Register
+	MPU_CTRL_ENABLE_Pos     = 0x0 // Position of ENABLE field.
+	MPU_CTRL_ENABLE_Msk     = 0x1 // Bit mask of ENABLE field.
+	MPU_CTRL_HFNMIENA_Pos   = 0x1 // Position of HFNMIENA field.
+	MPU_CTRL_HFNMIENA_Msk   = 0x2 // Bit mask of HFNMIENA field.
+	MPU_CTRL_PRIVDEFENA_Pos = 0x2 // Position of PRIVDEFENA field.
+	MPU_CTRL_PRIVDEFENA_Msk = 0x4 // Bit mask of PRIVDEFENA field.
+
+	// RASR: MPU Region Attribute and Size Register
+	MPU_RASR_ENABLE_Pos = 0x0        // Position of ENABLE field.
+	MPU_RASR_ENABLE_Msk = 0x1        // Bit mask of ENABLE field.
+	MPU_RASR_SIZE_Pos   = 0x1        // Position of SIZE field.
+	MPU_RASR_SIZE_Msk   = 0x3e       // Bit mask of SIZE field.
+	MPU_RASR_SRD_Pos    = 0x8        // Position of SRD field.
+	MPU_RASR_SRD_Msk    = 0xff00     // Bit mask of SRD field.
+	MPU_RASR_B_Pos      = 0x10       // Position of B field.
+	MPU_RASR_B_Msk      = 0x10000    // Bit mask of B field.
+	MPU_RASR_C_Pos      = 0x11       // Position of C field.
+	MPU_RASR_C_Msk      = 0x20000    // Bit mask of C field.
+	MPU_RASR_S_Pos      = 0x12       // Position of S field.
+	MPU_RASR_S_Msk      = 0x40000    // Bit mask of S field.
+	MPU_RASR_TEX_Pos    = 0x13       // Position of TEX field.
+	MPU_RASR_TEX_Msk    = 0x380000   // Bit mask of TEX field.
+	MPU_RASR_AP_Pos     = 0x18       // Position of AP field.
+	MPU_RASR_AP_Msk     = 0x7000000  // Bit mask of AP field.
+	MPU_RASR_XN_Pos     = 0x1c       // Position of XN field.
+	MPU_RASR_XN_Msk     = 0x10000000 // Bit mask of XN field.
+
+	// Values of the AP field.
+	MPU_RASR_AP_NoAccess  = 0x0 // No access.
+	MPU_RASR_AP_ReadWrite = 0x3 // Read and write access.
+	MPU_RASR_AP_ReadOnly  = 0x6 // Read-only access, privileged and unprivileged.
+)
@@ -0,0 +1,57 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file replaces errors.go from the Go standard library. It is the same,
+// except that the returned error records the address Errorf was called from
+// when building with -errortrace.
+
+package fmt
+
+import (
+	"errors"
+	"internal/errortrace"
+)
+
+// Errorf formats according to a format specifier and returns the string as a
+// value that satisfies error.
+//
+// If the format specifier includes a %w verb with an error operand,
+// the returned error will implement an Unwrap method returning the operand. It is
+// invalid to include more than one %w verb or to supply it with an operand
+// that does not implement the error interface. The %w verb is otherwise
+// a synonym for %v.
+//go:noinline
+func Errorf(format string, a ...interface{}) error {
+	// Errorf must not be inlined, otherwise the return address would be that
+	// of the caller of Errorf.
+	trace := errortrace.New(errortrace.ReturnAddress(0), errortrace.FrameAddress(0))
+	p := newPrinter()
+	p.wrapErrs = true
+	p.doPrintf(format, a)
+	s := string(p.buf)
+	var err error
+	if p.wrappedErr == nil && !errortrace.Enabled {
+		err = errors.New(s)
+	} else {
+		// With -errortrace, errors.New would record the address of this
+		// function. Use a wrapError (that doesn't wrap anything) instead.
+		err = &wrapError{trace, s, p.wrappedErr}
+	}
+	p.free()
+	return err
+}
+
+type wrapError struct {
+	errortrace.Trace
+	msg string
+	err error
+}
+
+func (e *wrapError) Error() string {
+	return e.msg
+}
+
+func (e *wrapError) Unwrap() error {
+	return e.err
+}
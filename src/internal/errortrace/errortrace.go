@@ -0,0 +1,68 @@
+// +build errortrace
+
+// Package errortrace records where errors are created, for the -errortrace
+// build flag. It is used by the errors and fmt packages, and the recorded
+// addresses can be read back with runtime/debug.ErrorTrace.
+package errortrace
+
+import "unsafe"
+
+// Enabled is true when the program is built with -errortrace.
+const Enabled = true
+
+// Trace is embedded in error types to record the call chain the error was
+// created from, innermost function first.
+type Trace struct {
+	pcs [MaxDepth]uintptr
+}
+
+// maxFrameSize is the largest distance between two frame pointers that is
+// accepted while walking the call chain. The chain ends at a frame that wasn't
+// created by Go code (which may not have a frame pointer), and this check stops
+// the walk there instead of following a random value.
+const maxFrameSize = 64 * 1024
+
+// New returns a Trace for the given return address and frame address, which
+// are usually the results of ReturnAddress(0) and FrameAddress(0) in the
+// function that creates the error. The call chain is followed through the frame
+// pointers (all Go code is compiled with frame pointers with -errortrace), up
+// to MaxDepth functions.
+func New(pc, frame unsafe.Pointer) Trace {
+	var t Trace
+	t.pcs[0] = uintptr(pc)
+	fp := uintptr(frame)
+	for i := 1; i < MaxDepth && fp != 0; i++ {
+		next := callerFrame(fp)
+		if next <= fp || next-fp > maxFrameSize {
+			break
+		}
+		t.pcs[i] = returnAddress(next)
+		if t.pcs[i] == 0 {
+			break
+		}
+		fp = next
+	}
+	return t
+}
+
+// ErrorTraceAddress returns the address of the call at the given depth in the
+// call chain the error was created from (0 being the call that created the
+// error), or 0 if it is not known. The call chain is not known for errors that
+// were created during package initialization at compile time.
+func (t Trace) ErrorTraceAddress(depth int) uintptr {
+	if depth < 0 || depth >= MaxDepth {
+		return 0
+	}
+	return t.pcs[depth]
+}
+
+// ReturnAddress returns the return address of the calling function, for level
+// 0. It must be called directly from the function whose caller is of interest,
+// and that function must not be inlined.
+//export llvm.returnaddress
+func ReturnAddress(level uint32) unsafe.Pointer
+
+// FrameAddress returns the frame pointer of the calling function, for level 0.
+// It has the same restrictions as ReturnAddress.
+//export llvm.frameaddress.p0i8
+func FrameAddress(level uint32) unsafe.Pointer
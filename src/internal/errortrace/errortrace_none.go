@@ -0,0 +1,24 @@
+// +build !errortrace
+
+package errortrace
+
+import "unsafe"
+
+// Enabled is true when the program is built with -errortrace.
+const Enabled = false
+
+// Trace is an empty struct when error traces are disabled, so that it takes
+// up no space in errors.
+type Trace struct{}
+
+func New(pc, frame unsafe.Pointer) Trace {
+	return Trace{}
+}
+
+func ReturnAddress(level uint32) unsafe.Pointer {
+	return nil
+}
+
+func FrameAddress(level uint32) unsafe.Pointer {
+	return nil
+}
@@ -0,0 +1,16 @@
+// +build errortrace,!avr,!xtensa,!tinygo.riscv
+
+package errortrace
+
+import "unsafe"
+
+// On most architectures, the frame pointer points to the frame pointer of the
+// caller, followed by the return address.
+
+func callerFrame(fp uintptr) uintptr {
+	return *(*uintptr)(unsafe.Pointer(fp))
+}
+
+func returnAddress(fp uintptr) uintptr {
+	return *(*uintptr)(unsafe.Pointer(fp + unsafe.Sizeof(uintptr(0))))
+}
@@ -0,0 +1,14 @@
+// +build errortrace,avr errortrace,xtensa
+
+package errortrace
+
+// The call chain can't be followed on this architecture, so only the function
+// that created the error is recorded.
+
+func callerFrame(fp uintptr) uintptr {
+	return 0
+}
+
+func returnAddress(fp uintptr) uintptr {
+	return 0
+}
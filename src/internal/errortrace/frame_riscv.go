@@ -0,0 +1,16 @@
+// +build errortrace,tinygo.riscv
+
+package errortrace
+
+import "unsafe"
+
+// On RISC-V, the frame pointer points just above the return address, which is
+// preceded by the frame pointer of the caller.
+
+func callerFrame(fp uintptr) uintptr {
+	return *(*uintptr)(unsafe.Pointer(fp - 2*unsafe.Sizeof(uintptr(0))))
+}
+
+func returnAddress(fp uintptr) uintptr {
+	return *(*uintptr)(unsafe.Pointer(fp - unsafe.Sizeof(uintptr(0))))
+}
@@ -0,0 +1,22 @@
+package errortrace
+
+// MaxDepth is the maximum number of functions in the call chain that is
+// recorded for an error.
+const MaxDepth = 4
+
+// Tracer is implemented by errors that record the call chain they were created
+// from (see Trace). It is used by runtime/debug.ErrorTrace and by the runtime
+// to print the error trace on a panic.
+type Tracer interface {
+	ErrorTraceAddress(depth int) uintptr
+}
+
+// Unwrap returns the error wrapped by err, or nil if it doesn't wrap an error.
+// It is the same as errors.Unwrap, which can't be imported here.
+func Unwrap(err error) error {
+	wrapper, ok := err.(interface{ Unwrap() error })
+	if !ok {
+		return nil
+	}
+	return wrapper.Unwrap()
+}
@@ -15,6 +15,10 @@ type Task struct {
 	// Data is a field which can be used for storing state information.
 	Data uint
 
+	// Block records what the task is blocked on, for -deadlocktrace. It is
+	// empty otherwise.
+	Block BlockInfo
+
 	// state is the underlying running state of the task.
 	state state
 }
@@ -0,0 +1,24 @@
+// +build deadlocktrace
+
+package task
+
+import "unsafe"
+
+// BlockInfo describes the operation a task is blocked on. It is filled in by
+// the runtime and the sync package before pausing the task, so that the cause
+// of a deadlock can be printed.
+type BlockInfo struct {
+	// Next is the next task in the list of blocked tasks.
+	Next *Task
+
+	// Kind is the kind of operation (channel send, mutex lock, etc), or 0 if
+	// the task is not blocked.
+	Kind uint8
+
+	// Object is the channel, mutex or other object the task is blocked on, if
+	// any.
+	Object unsafe.Pointer
+
+	// PC is the return address of the blocking call.
+	PC uintptr
+}
@@ -0,0 +1,7 @@
+// +build !deadlocktrace
+
+package task
+
+// BlockInfo is empty when the program is not built with -deadlocktrace, so
+// that it takes up no space in tasks.
+type BlockInfo struct{}
@@ -0,0 +1,57 @@
+// +build scheduler.tasks,stackusage scheduler.tasks,gdb scheduler.tasks,tracehooks.systemview
+
+package task
+
+import "unsafe"
+
+// A list of all goroutines is only kept when something needs to find them: to
+// measure stack usage (-stackusage), to send the task list to SEGGER SystemView
+// (-trace-hooks=systemview) and for the GDB extension in
+// src/runtime/runtime-gdb.py (tinygo gdb). Otherwise a goroutine that is
+// blocked forever would be kept alive by this list, together with its stack.
+
+// taskListState links a task into the list of all tasks.
+type taskListState struct {
+	// next is the next task in the list of all tasks (see allTasks).
+	next *Task
+
+	// stackSize is the size of the goroutine stack in bytes.
+	stackSize uintptr
+}
+
+// allTasks is the list of goroutines that have been started and have not yet
+// exited, most recently started first.
+var allTasks *Task
+
+// taskListAdd adds a newly started goroutine to the list of all tasks.
+func taskListAdd(t *Task, stackSize uintptr) {
+	t.state.list.next = allTasks
+	t.state.list.stackSize = stackSize
+	allTasks = t
+}
+
+// taskListRemove removes a goroutine that is about to exit from the list of
+// all tasks.
+func taskListRemove(t *Task) {
+	for ptr := &allTasks; *ptr != nil; ptr = &(*ptr).state.list.next {
+		if *ptr == t {
+			*ptr = t.state.list.next
+			return
+		}
+	}
+}
+
+// ListTask returns the index-th goroutine that has been started and has not yet
+// exited (most recently started first), together with the lowest address and
+// the size of its stack. The last return value is false if there is no such
+// goroutine.
+func ListTask(index int) (t *Task, stackBase, stackSize uintptr, ok bool) {
+	t = allTasks
+	for i := 0; i < index && t != nil; i++ {
+		t = t.state.list.next
+	}
+	if t == nil {
+		return nil, 0, 0, false
+	}
+	return t, uintptr(unsafe.Pointer(t.state.canaryPtr)), t.state.list.stackSize, true
+}
@@ -0,0 +1,16 @@
+// +build scheduler.tasks,!stackusage,!gdb,!tracehooks.systemview
+
+package task
+
+// No list of all goroutines is kept, so that goroutines that are blocked
+// forever can be freed by the garbage collector.
+
+type taskListState struct{}
+
+//go:inline
+func taskListAdd(t *Task, stackSize uintptr) {
+}
+
+//go:inline
+func taskListRemove(t *Task) {
+}
@@ -21,9 +21,18 @@ type state struct {
 
 	// canaryPtr points to the top word of the stack (the lowest address).
 	// This is used to detect stack overflows.
-	// When initializing the goroutine, the stackCanary constant is stored there.
-	// If the stack overflowed, the word will likely no longer equal stackCanary.
+	// When initializing the goroutine, the stackCanary constant is stored there
+	// (and in the stackCanaryWords-1 words after it). If the stack overflowed,
+	// the word will likely no longer equal stackCanary.
 	canaryPtr *uintptr
+
+	// list links the task into the list of all tasks. It is empty when this
+	// list isn't kept (see task_list.go).
+	list taskListState
+
+	// usage is used to measure the stack usage of the task (see -stackusage).
+	// It is empty when stack usage isn't measured.
+	usage stackUsageState
 }
 
 // currentTask is the current running task, or nil if currently in the scheduler.
@@ -39,20 +48,36 @@ func Current() *Task {
 func Pause() {
 	// Check whether the canary (the lowest address of the stack) is still
 	// valid. If it is not, a stack overflow has occured.
-	if *currentTask.state.canaryPtr != stackCanary {
-		runtimePanic("goroutine stack overflow")
-	}
+	currentTask.state.checkCanary()
 	currentTask.state.pause()
 }
 
+// checkCanary panics if the stack canary at the bottom of the stack was
+// overwritten.
+func (s *state) checkCanary() {
+	for i := uintptr(0); i < stackCanaryWords; i++ {
+		word := (*uintptr)(unsafe.Pointer(uintptr(unsafe.Pointer(s.canaryPtr)) + i*unsafe.Sizeof(uintptr(0))))
+		if *word != stackCanary {
+			runtimePanic("goroutine stack overflow")
+		}
+	}
+}
+
+// pause is called by tinygo_startTask when the goroutine function returns, to
+// exit the goroutine.
 //export tinygo_pause
 func pause() {
+	taskListRemove(currentTask)
+	traceTaskExit(currentTask)
 	Pause()
 }
 
 // Resume the task until it pauses or completes.
 // This may only be called from the scheduler.
 func (t *Task) Resume() {
+	if stackCanaryCheckResume {
+		t.state.checkCanary()
+	}
 	currentTask = t
 	t.state.resume()
 	currentTask = nil
@@ -62,13 +87,16 @@ func (t *Task) Resume() {
 func (s *state) initialize(fn uintptr, args unsafe.Pointer, stackSize uintptr) {
 	// Create a stack.
 	stack := make([]uintptr, stackSize/unsafe.Sizeof(uintptr(0)))
+	paintStack(stack)
 
 	// Set up the stack canary, a random number that should be checked when
 	// switching from the task back to the scheduler. The stack canary pointer
 	// points to the first word of the stack. If it has changed between now and
 	// the next stack switch, there was a stack overflow.
 	s.canaryPtr = &stack[0]
-	*s.canaryPtr = stackCanary
+	for i := 0; i < stackCanaryWords; i++ {
+		stack[i] = stackCanary
+	}
 
 	// Get a pointer to the top of the stack, where the initial register values
 	// are stored. They will be popped off the stack on the first stack switch
@@ -92,11 +120,23 @@ var startTask [0]uint8
 //go:linkname runqueuePushBack runtime.runqueuePushBack
 func runqueuePushBack(*Task)
 
+// traceTaskCreate and traceTaskExit report goroutines that start and exit to
+// the trace hooks selected with -trace-hooks, if any.
+
+//go:linkname traceTaskCreate runtime.traceTaskCreate
+func traceTaskCreate(t *Task, stackBase, stackSize uintptr)
+
+//go:linkname traceTaskExit runtime.traceTaskExit
+func traceTaskExit(t *Task)
+
 // start creates and starts a new goroutine with the given function and arguments.
 // The new goroutine is scheduled to run later.
 func start(fn uintptr, args unsafe.Pointer, stackSize uintptr) {
 	t := &Task{}
 	t.state.initialize(fn, args, stackSize)
+	taskListAdd(t, stackSize)
+	stackUsageStart(t, fn, stackSize)
+	traceTaskCreate(t, uintptr(unsafe.Pointer(t.state.canaryPtr)), stackSize)
 	runqueuePushBack(t)
 }
 
@@ -10,6 +10,10 @@ var systemStack uintptr
 // switching between tasks. Also see task_stack_arm.S that relies on the exact
 // layout of this struct.
 type calleeSavedRegs struct {
+	// Callee-saved VFP registers d8-d15, which are only saved when the target
+	// has an FPU. The space is always reserved so that the layout is the same.
+	vfp [16]uintptr
+
 	r4  uintptr
 	r5  uintptr
 	r6  uintptr
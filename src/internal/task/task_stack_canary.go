@@ -0,0 +1,17 @@
+// +build scheduler.tasks,stackcanary
+
+package task
+
+// With -stackcanary, a larger part of the bottom of every goroutine stack is
+// filled with the stack canary, so that a stack overflow that skips over the
+// lowest word (a large stack frame) is still detected. The canary is checked
+// on every switch to and from the goroutine, which also detects stacks that
+// are overwritten by other code (for example through a heap buffer overflow).
+
+// stackCanaryWords is the number of words at the bottom of the stack that
+// hold the stack canary.
+const stackCanaryWords = 8
+
+// stackCanaryCheckResume indicates whether the stack canary is also checked
+// when switching to the goroutine.
+const stackCanaryCheckResume = true
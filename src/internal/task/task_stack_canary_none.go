@@ -0,0 +1,10 @@
+// +build scheduler.tasks,!stackcanary
+
+package task
+
+// Only the lowest word of the stack holds the stack canary, and it is only
+// checked when the goroutine pauses. Build with -stackcanary for more checks.
+
+const stackCanaryWords = 1
+
+const stackCanaryCheckResume = false
@@ -0,0 +1,66 @@
+// +build scheduler.tasks,stackusage
+
+package task
+
+// Stack usage measurement (-stackusage). Every goroutine stack is painted with
+// a known pattern when the goroutine is started. The peak usage of the stack
+// is then found by looking for the lowest word that was overwritten.
+
+import "unsafe"
+
+// stackPaint is stored in every word of a new goroutine stack. It is not a
+// valid pointer on most targets, so it is unlikely to be stored on the stack
+// by the program itself.
+const stackPaint = uintptr(uint64(0xa5a5a5a5a5a5a5a5) & uint64(^uintptr(0)))
+
+// stackUsageState holds the information needed to measure the stack usage of
+// a task.
+type stackUsageState struct {
+	// fn is the function the goroutine was started with.
+	fn uintptr
+
+	// size is the size of the stack in bytes.
+	size uintptr
+}
+
+// paintStack fills a newly created goroutine stack with stackPaint.
+func paintStack(stack []uintptr) {
+	for i := range stack {
+		stack[i] = stackPaint
+	}
+}
+
+// stackUsageStart records the information needed to measure the stack usage
+// of a newly started goroutine.
+func stackUsageStart(t *Task, fn uintptr, stackSize uintptr) {
+	t.state.usage.fn = fn
+	t.state.usage.size = stackSize
+}
+
+// StackUsage returns the index-th live goroutine (most recently started first)
+// together with the function it was started with, the peak number of bytes
+// used on its stack and the size of its stack. The last return value is false
+// if there is no such goroutine.
+func StackUsage(index int) (t *Task, fn, used, size uintptr, ok bool) {
+	t = allTasks
+	for i := 0; i < index && t != nil; i++ {
+		t = t.state.list.next
+	}
+	if t == nil {
+		return nil, 0, 0, 0, false
+	}
+
+	// The stack grows down, so the lowest words are the last to be used. The
+	// first stackCanaryWords words hold the stack canary.
+	words := t.state.usage.size / unsafe.Sizeof(uintptr(0))
+	unused := uintptr(stackCanaryWords)
+	for unused < words {
+		word := (*uintptr)(unsafe.Pointer(uintptr(unsafe.Pointer(t.state.canaryPtr)) + unused*unsafe.Sizeof(uintptr(0))))
+		if *word != stackPaint {
+			break
+		}
+		unused++
+	}
+	used = (words - unused) * unsafe.Sizeof(uintptr(0))
+	return t, t.state.usage.fn, used, t.state.usage.size, true
+}
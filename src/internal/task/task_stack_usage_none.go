@@ -0,0 +1,21 @@
+// +build scheduler.tasks,!stackusage
+
+package task
+
+// Stack usage is not measured: build with -stackusage to enable it.
+
+type stackUsageState struct{}
+
+//go:inline
+func paintStack(stack []uintptr) {
+}
+
+//go:inline
+func stackUsageStart(t *Task, fn uintptr, stackSize uintptr) {
+}
+
+// StackUsage always reports that there are no goroutines, as stack usage is
+// not measured.
+func StackUsage(index int) (t *Task, fn, used, size uintptr, ok bool) {
+	return
+}
@@ -0,0 +1,12 @@
+// +build nrf stm32f4
+
+package machine
+
+import "errors"
+
+// Errors returned by Flash.
+var (
+	ErrFlashOutOfRange = errors.New("machine: flash access out of range")
+	ErrFlashUnaligned  = errors.New("machine: flash write not aligned to the write block size")
+	ErrFlashWrite      = errors.New("machine: flash write or erase failed")
+)
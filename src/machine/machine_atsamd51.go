@@ -2712,3 +2712,15 @@ func syncDAC() {
 	for sam.DAC.SYNCBUSY.HasBits(sam.DAC_SYNCBUSY_DATA0) {
 	}
 }
+
+// GetRNG returns 32 bits of non-deterministic random data from the TRNG
+// peripheral.
+func GetRNG() (uint32, error) {
+	if !sam.TRNG.CTRLA.HasBits(sam.TRNG_CTRLA_ENABLE) {
+		sam.MCLK.APBCMASK.SetBits(sam.MCLK_APBCMASK_TRNG_)
+		sam.TRNG.CTRLA.SetBits(sam.TRNG_CTRLA_ENABLE)
+	}
+	for !sam.TRNG.INTFLAG.HasBits(sam.TRNG_INTFLAG_DATARDY) {
+	}
+	return sam.TRNG.DATA.Get(), nil
+}
@@ -1,4 +1,4 @@
-// +build !baremetal
+// +build !baremetal,!simulator
 
 package machine
 
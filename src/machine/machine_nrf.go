@@ -329,3 +329,22 @@ func (i2c *I2C) readByte() (byte, error) {
 	i2c.Bus.EVENTS_RXDREADY.Set(0)
 	return byte(i2c.Bus.RXD.Get()), nil
 }
+
+// GetRNG returns 32 bits of non-deterministic random data from the RNG
+// peripheral, which is based on internal thermal noise. Bias correction is
+// enabled so that the output is suitable for cryptographic purposes.
+func GetRNG() (ret uint32, err error) {
+	nrf.RNG.CONFIG.Set(nrf.RNG_CONFIG_DERCEN_Enabled << nrf.RNG_CONFIG_DERCEN_Pos)
+	nrf.RNG.TASKS_START.Set(1)
+
+	// The RNG produces a single byte at a time, so collect four of them.
+	for i := 0; i < 4; i++ {
+		for nrf.RNG.EVENTS_VALRDY.Get() == 0 {
+		}
+		ret = ret<<8 | nrf.RNG.VALUE.Get()&0xff
+		nrf.RNG.EVENTS_VALRDY.Set(0)
+	}
+
+	nrf.RNG.TASKS_STOP.Set(1)
+	return ret, nil
+}
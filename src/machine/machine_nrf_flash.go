@@ -0,0 +1,93 @@
+// +build nrf
+
+package machine
+
+import (
+	"device/nrf"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// Flash is the internal flash memory of the chip. Offsets are addresses, as
+// flash starts at address 0 on nRF chips. The program itself is stored in this
+// flash too, so be careful to only erase and write the parts that are not in
+// use, such as the secondary slot of a bootloader (see runtime/ota).
+//
+// Flash can't be written while the SoftDevice is enabled: the SoftDevice owns
+// the flash controller (NVMC) then.
+var Flash flashBlockDevice
+
+type flashBlockDevice struct{}
+
+// ReadAt reads len(p) bytes of flash starting at offset off.
+func (f flashBlockDevice) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 || off+int64(len(p)) > f.Size() {
+		return 0, ErrFlashOutOfRange
+	}
+	for i := range p {
+		p[i] = *(*byte)(unsafe.Pointer(uintptr(off) + uintptr(i)))
+	}
+	return len(p), nil
+}
+
+// WriteAt writes p to flash starting at offset off. Both off and len(p) must be
+// a multiple of WriteBlockSize, and the flash must have been erased first: a
+// write can only change bits from 1 to 0.
+func (f flashBlockDevice) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 || off+int64(len(p)) > f.Size() {
+		return 0, ErrFlashOutOfRange
+	}
+	if off%f.WriteBlockSize() != 0 || int64(len(p))%f.WriteBlockSize() != 0 {
+		return 0, ErrFlashUnaligned
+	}
+	waitForFlash()
+	nrf.NVMC.CONFIG.Set(nrf.NVMC_CONFIG_WEN_Wen)
+	for i := 0; i < len(p); i += 4 {
+		word := uint32(p[i]) | uint32(p[i+1])<<8 | uint32(p[i+2])<<16 | uint32(p[i+3])<<24
+		volatile.StoreUint32((*uint32)(unsafe.Pointer(uintptr(off)+uintptr(i))), word)
+		waitForFlash()
+	}
+	nrf.NVMC.CONFIG.Set(nrf.NVMC_CONFIG_WEN_Ren)
+	return len(p), nil
+}
+
+// Size returns the size of the flash in bytes.
+func (f flashBlockDevice) Size() int64 {
+	return int64(nrf.FICR.CODEPAGESIZE.Get()) * int64(nrf.FICR.CODESIZE.Get())
+}
+
+// WriteBlockSize returns the smallest unit of flash that can be written, in
+// bytes.
+func (f flashBlockDevice) WriteBlockSize() int64 {
+	return 4
+}
+
+// EraseBlockSize returns the smallest unit of flash that can be erased (a
+// page), in bytes.
+func (f flashBlockDevice) EraseBlockSize() int64 {
+	return int64(nrf.FICR.CODEPAGESIZE.Get())
+}
+
+// EraseBlocks erases the given number of pages, starting at page start. Erased
+// flash reads as 0xff.
+func (f flashBlockDevice) EraseBlocks(start, len int64) error {
+	pageSize := f.EraseBlockSize()
+	if start < 0 || len < 0 || (start+len)*pageSize > f.Size() {
+		return ErrFlashOutOfRange
+	}
+	waitForFlash()
+	nrf.NVMC.CONFIG.Set(nrf.NVMC_CONFIG_WEN_Een)
+	for page := start; page < start+len; page++ {
+		nrf.NVMC.ERASEPAGE.Set(uint32(page * pageSize))
+		waitForFlash()
+	}
+	nrf.NVMC.CONFIG.Set(nrf.NVMC_CONFIG_WEN_Ren)
+	return nil
+}
+
+// waitForFlash waits until the flash controller is ready for the next write or
+// erase operation.
+func waitForFlash() {
+	for nrf.NVMC.READY.Get() == nrf.NVMC_READY_READY_Busy {
+	}
+}
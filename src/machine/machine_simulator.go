@@ -0,0 +1,317 @@
+// +build simulator
+
+package machine
+
+// This file implements the machine package on the host, for use with
+// -target=simulator. Peripherals are simulated in memory so that firmware
+// logic can be run and unit tested without hardware. The behavior of the
+// outside world (buttons, sensors, other chips on a bus) can be scripted using
+// the Simulate* functions and methods, which only exist in this simulator.
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	SPI0  = SPI{0}
+	SPI1  = SPI{1}
+	I2C0  = &I2C{0}
+	I2C1  = &I2C{1}
+	UART0 = UART{0}
+	UART1 = UART{1}
+)
+
+// Number of simulated buses per peripheral type.
+const simBuses = 2
+
+var (
+	errI2CNoDevice = errors.New("machine: no simulated I2C device at this address")
+	errUARTEmpty   = errors.New("machine: UART buffer empty")
+)
+
+const (
+	PinInput PinMode = iota
+	PinOutput
+	PinInputPullup
+	PinInputPulldown
+)
+
+// PinChange is the kind of pin change that triggers a pin interrupt.
+type PinChange uint8
+
+// Pin change interrupt constants for SetInterrupt.
+const (
+	PinRising PinChange = 1 << iota
+	PinFalling
+	PinToggle = PinRising | PinFalling
+)
+
+// simPin is the state of a single simulated GPIO pin.
+type simPin struct {
+	mode     PinMode
+	output   bool // value driven by the firmware, when configured as output
+	input    bool // value driven by the simulation, when configured as input
+	driven   bool // whether the simulation drives this pin (see SimulatePin)
+	change   PinChange
+	callback func(Pin)
+}
+
+var (
+	simPins       [256]simPin
+	pinChangeHook func(pin Pin, value bool)
+	adcValues     [256]uint16
+)
+
+// Configure this pin with the given configuration.
+func (p Pin) Configure(config PinConfig) {
+	simPins[p].mode = config.Mode
+}
+
+// Set the pin to high or low. The pin should be configured as an output.
+func (p Pin) Set(value bool) {
+	pin := &simPins[p]
+	if pin.mode != PinOutput || pin.output == value {
+		pin.output = value
+		return
+	}
+	pin.output = value
+	if pinChangeHook != nil {
+		pinChangeHook(p, value)
+	}
+}
+
+// Get returns the current value of the pin: the value set with Set for an
+// output pin or the value set with SimulatePin for an input pin. Inputs that
+// are not driven by the simulation read as their pull-up or pull-down value.
+func (p Pin) Get() bool {
+	pin := &simPins[p]
+	switch {
+	case pin.mode == PinOutput:
+		return pin.output
+	case pin.driven:
+		return pin.input
+	default:
+		return pin.mode == PinInputPullup
+	}
+}
+
+// SetInterrupt sets an interrupt to be executed when a particular pin changes
+// state, as a result of SimulatePin. Passing a nil callback disables the
+// interrupt.
+func (p Pin) SetInterrupt(change PinChange, callback func(Pin)) error {
+	simPins[p].change = change
+	simPins[p].callback = callback
+	return nil
+}
+
+// SimulatePin sets the level of an input pin as seen by the firmware, for
+// example to simulate a button press. Pin interrupts are called when the level
+// changes.
+func SimulatePin(p Pin, value bool) {
+	pin := &simPins[p]
+	old := p.Get()
+	pin.input = value
+	pin.driven = true
+	if pin.callback == nil || old == value {
+		return
+	}
+	if (value && pin.change&PinRising != 0) || (!value && pin.change&PinFalling != 0) {
+		pin.callback(p)
+	}
+}
+
+// SimulatePinChangeHook sets a function that is called every time the
+// firmware changes the level of an output pin, for example to check the
+// blinking pattern of an LED. Passing nil removes the hook.
+func SimulatePinChangeHook(hook func(pin Pin, value bool)) {
+	pinChangeHook = hook
+}
+
+// SimulateAfter calls f in a separate goroutine after the given duration, for
+// example to press a button after a while or to trigger a timeout. It can be
+// used to script a sequence of events while the firmware runs.
+func SimulateAfter(d time.Duration, f func()) {
+	go func() {
+		time.Sleep(d)
+		f()
+	}()
+}
+
+// InitADC enables support for ADC peripherals.
+func InitADC() {
+	// Nothing to do here.
+}
+
+// Configure configures an ADC pin to be able to be used to read data.
+func (adc ADC) Configure(ADCConfig) {
+}
+
+// Get reads the current analog value from this ADC peripheral, as set with
+// SimulateADC.
+func (adc ADC) Get() uint16 {
+	return adcValues[adc.Pin]
+}
+
+// SimulateADC sets the analog value that is read from the given pin.
+func SimulateADC(pin Pin, value uint16) {
+	adcValues[pin] = value
+}
+
+// SPI is a simulated SPI bus. By default it works as a loopback: every byte
+// that is written is also read back.
+type SPI struct {
+	Bus uint8
+}
+
+type SPIConfig struct {
+	Frequency uint32
+	SCK       Pin
+	SDO       Pin
+	SDI       Pin
+	Mode      uint8
+}
+
+var spiDevices [simBuses]func(w byte) byte
+
+// Configure is intended to setup the SPI interface.
+func (spi SPI) Configure(config SPIConfig) {
+}
+
+// Transfer writes/reads a single byte using the SPI interface.
+func (spi SPI) Transfer(w byte) (byte, error) {
+	if device := spiDevices[spi.Bus]; device != nil {
+		return device(w), nil
+	}
+	return w, nil
+}
+
+// SimulateDevice connects a simulated device to the SPI bus, which is called
+// for every byte transferred and returns the byte that is read back. Passing
+// nil restores the loopback behavior.
+func (spi SPI) SimulateDevice(device func(w byte) byte) {
+	spiDevices[spi.Bus] = device
+}
+
+// I2C is a simulated I2C bus.
+type I2C struct {
+	Bus uint8
+}
+
+// I2CConfig is used to store config info for I2C.
+type I2CConfig struct {
+	Frequency uint32
+	SCL       Pin
+	SDA       Pin
+}
+
+var i2cDevices [simBuses]map[uint16]func(w, r []byte) error
+
+// Configure is intended to setup the I2C interface.
+func (i2c *I2C) Configure(config I2CConfig) error {
+	return nil
+}
+
+// Tx does a single I2C transaction at the specified address, with the
+// simulated device that was connected using SimulateDevice.
+func (i2c *I2C) Tx(addr uint16, w, r []byte) error {
+	device := i2cDevices[i2c.Bus][addr]
+	if device == nil {
+		return errI2CNoDevice
+	}
+	return device(w, r)
+}
+
+// SimulateDevice connects a simulated device to the I2C bus at the given
+// address. The device is called for every transaction with the written bytes
+// and must fill the read buffer. Passing nil disconnects the device.
+func (i2c *I2C) SimulateDevice(addr uint16, device func(w, r []byte) error) {
+	if i2cDevices[i2c.Bus] == nil {
+		i2cDevices[i2c.Bus] = make(map[uint16]func(w, r []byte) error)
+	}
+	if device == nil {
+		delete(i2cDevices[i2c.Bus], addr)
+		return
+	}
+	i2cDevices[i2c.Bus][addr] = device
+}
+
+// UART is a simulated serial port. Output is written to the standard output
+// by default, input is provided with SimulateInput.
+type UART struct {
+	Bus uint8
+}
+
+type UARTConfig struct {
+	BaudRate uint32
+	TX       Pin
+	RX       Pin
+}
+
+// simUART is the state of a single simulated UART.
+type simUART struct {
+	rx     []byte
+	output io.Writer
+}
+
+var simUARTs [simBuses]simUART
+
+// Configure the UART.
+func (uart UART) Configure(config UARTConfig) {
+}
+
+// Read from the UART. It returns the bytes that were provided with
+// SimulateInput and not yet read.
+func (uart UART) Read(data []byte) (n int, err error) {
+	sim := &simUARTs[uart.Bus]
+	n = copy(data, sim.rx)
+	sim.rx = sim.rx[n:]
+	return n, nil
+}
+
+// Write to the UART.
+func (uart UART) Write(data []byte) (n int, err error) {
+	output := simUARTs[uart.Bus].output
+	if output == nil {
+		output = os.Stdout
+	}
+	return output.Write(data)
+}
+
+// Buffered returns the number of bytes currently stored in the RX buffer.
+func (uart UART) Buffered() int {
+	return len(simUARTs[uart.Bus].rx)
+}
+
+// ReadByte reads a single byte from the UART.
+func (uart UART) ReadByte() (byte, error) {
+	sim := &simUARTs[uart.Bus]
+	if len(sim.rx) == 0 {
+		return 0, errUARTEmpty
+	}
+	b := sim.rx[0]
+	sim.rx = sim.rx[1:]
+	return b, nil
+}
+
+// WriteByte writes a single byte to the UART.
+func (uart UART) WriteByte(b byte) error {
+	_, err := uart.Write([]byte{b})
+	return err
+}
+
+// SimulateInput adds data to the receive buffer of the UART, as if it was
+// sent by the other side.
+func (uart UART) SimulateInput(data []byte) {
+	sim := &simUARTs[uart.Bus]
+	sim.rx = append(sim.rx, data...)
+}
+
+// SimulateOutput sets where the data written by the firmware to the UART goes,
+// for example a bytes.Buffer in a test. Passing nil restores the default
+// (standard output).
+func (uart UART) SimulateOutput(w io.Writer) {
+	simUARTs[uart.Bus].output = w
+}
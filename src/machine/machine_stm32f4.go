@@ -6,6 +6,7 @@ package machine
 
 import (
 	"device/stm32"
+	"errors"
 	"unsafe"
 )
 
@@ -227,3 +228,33 @@ func enableAltFuncClock(bus unsafe.Pointer) {
 		stm32.RCC.APB2ENR.SetBits(stm32.RCC_APB2ENR_TIM1EN)
 	}
 }
+
+var (
+	errRNGClock = errors.New("machine: RNG clock error")
+	errRNGSeed  = errors.New("machine: RNG seed error")
+)
+
+// GetRNG returns 32 bits of non-deterministic random data from the RNG
+// peripheral. An error is returned when the peripheral detects a faulty clock
+// or seed, in which case the returned value must not be used.
+func GetRNG() (uint32, error) {
+	if !stm32.RNG.CR.HasBits(stm32.RNG_CR_RNGEN) {
+		stm32.RCC.AHB2ENR.SetBits(stm32.RCC_AHB2ENR_RNGEN)
+		stm32.RNG.CR.SetBits(stm32.RNG_CR_RNGEN)
+	}
+	for {
+		status := stm32.RNG.SR.Get()
+		if status&stm32.RNG_SR_CECS != 0 {
+			return 0, errRNGClock
+		}
+		if status&stm32.RNG_SR_SECS != 0 {
+			// Recover from a seed error by resetting the peripheral. The
+			// caller may try again.
+			stm32.RNG.CR.ClearBits(stm32.RNG_CR_RNGEN)
+			return 0, errRNGSeed
+		}
+		if status&stm32.RNG_SR_DRDY != 0 {
+			return stm32.RNG.DR.Get(), nil
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// +build stm32f4
+
+package machine
+
+import (
+	"device/stm32"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// Flash is the internal flash memory of the chip. Offsets are relative to the
+// start of flash (0x08000000). The program itself is stored in this flash too,
+// so be careful to only erase and write the parts that are not in use, such as
+// the secondary slot of a bootloader (see runtime/ota).
+//
+// The sectors of the STM32F4 are not all the same size: every bank starts with
+// four 16kB sectors and a 64kB sector, followed by 128kB sectors. Flash is
+// erased in blocks of 128kB, so that the first erase block of a bank covers
+// the five small sectors. On chips with two banks (the STM32F42x/F43x with 2MB
+// of flash, or with 1MB and the DB1M option bit set), the second bank starts
+// at half the flash size and has the same layout.
+var Flash flashBlockDevice
+
+type flashBlockDevice struct{}
+
+const (
+	flashStart          = 0x08000000
+	flashEraseBlockSize = 128 * 1024
+
+	// Errors in the FLASH_SR register: OPERR, WRPERR, PGAERR, PGPERR and
+	// PGSERR.
+	flashSRErrors = 0xf2
+
+	// Size of the flash in kB, and the device ID in the lower 12 bits of the
+	// DBGMCU_IDCODE register.
+	flashSizeAddress = 0x1fff7a22
+	dbgmcuIDCODE     = 0xe0042000
+
+	// Dual-bank mode on STM32F42x/F43x chips with 1MB of flash.
+	flashOPTCRDB1M = 1 << 30
+)
+
+// ReadAt reads len(p) bytes of flash starting at offset off.
+func (f flashBlockDevice) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 || off+int64(len(p)) > f.Size() {
+		return 0, ErrFlashOutOfRange
+	}
+	for i := range p {
+		p[i] = *(*byte)(unsafe.Pointer(uintptr(flashStart+off) + uintptr(i)))
+	}
+	return len(p), nil
+}
+
+// WriteAt writes p to flash starting at offset off. Both off and len(p) must be
+// a multiple of WriteBlockSize, and the flash must have been erased first: a
+// write can only change bits from 1 to 0.
+func (f flashBlockDevice) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 || off+int64(len(p)) > f.Size() {
+		return 0, ErrFlashOutOfRange
+	}
+	if off%f.WriteBlockSize() != 0 || int64(len(p))%f.WriteBlockSize() != 0 {
+		return 0, ErrFlashUnaligned
+	}
+	unlockFlash()
+	defer lockFlash()
+	// Program 32 bits at a time, which needs a supply voltage of at least
+	// 2.7V.
+	stm32.FLASH.CR.Set(2<<stm32.FLASH_CR_PSIZE_Pos | stm32.FLASH_CR_PG)
+	for i := 0; i < len(p); i += 4 {
+		word := uint32(p[i]) | uint32(p[i+1])<<8 | uint32(p[i+2])<<16 | uint32(p[i+3])<<24
+		volatile.StoreUint32((*uint32)(unsafe.Pointer(uintptr(flashStart+off)+uintptr(i))), word)
+		if err := waitForFlash(); err != nil {
+			stm32.FLASH.CR.Set(0)
+			return i, err
+		}
+	}
+	stm32.FLASH.CR.Set(0)
+	return len(p), nil
+}
+
+// Size returns the size of the flash in bytes.
+func (f flashBlockDevice) Size() int64 {
+	return int64((*volatile.Register16)(unsafe.Pointer(uintptr(flashSizeAddress))).Get()) * 1024
+}
+
+// WriteBlockSize returns the smallest unit of flash that can be written, in
+// bytes.
+func (f flashBlockDevice) WriteBlockSize() int64 {
+	return 4
+}
+
+// EraseBlockSize returns the unit of flash that is erased by EraseBlocks, in
+// bytes. This is the size of the largest sectors, see Flash.
+func (f flashBlockDevice) EraseBlockSize() int64 {
+	return flashEraseBlockSize
+}
+
+// EraseBlocks erases the given number of 128kB blocks, starting at block start.
+// Erased flash reads as 0xff.
+func (f flashBlockDevice) EraseBlocks(start, len int64) error {
+	if start < 0 || len < 0 || (start+len)*flashEraseBlockSize > f.Size() {
+		return ErrFlashOutOfRange
+	}
+	bankSize := f.Size()
+	if f.dualBank() {
+		bankSize /= 2
+	}
+	unlockFlash()
+	defer lockFlash()
+	for block := start; block < start+len; block++ {
+		// Sector numbers of the second bank start at 12, which is encoded as
+		// 16 in the SNB field.
+		offset := block * flashEraseBlockSize
+		bank := offset / bankSize
+		offset %= bankSize
+		first, last := 4+offset/flashEraseBlockSize, 4+offset/flashEraseBlockSize
+		if offset == 0 {
+			first = 0 // the four 16kB sectors and the 64kB sector
+		}
+		for sector := first; sector <= last; sector++ {
+			snb := uint32(bank*16 + sector)
+			stm32.FLASH.CR.Set(2<<stm32.FLASH_CR_PSIZE_Pos | snb<<stm32.FLASH_CR_SNB_Pos | stm32.FLASH_CR_SER)
+			stm32.FLASH.CR.SetBits(stm32.FLASH_CR_STRT)
+			if err := waitForFlash(); err != nil {
+				stm32.FLASH.CR.Set(0)
+				return err
+			}
+		}
+	}
+	stm32.FLASH.CR.Set(0)
+
+	// Reset the data cache, which may still contain the old contents.
+	stm32.FLASH.ACR.ClearBits(stm32.FLASH_ACR_DCEN)
+	stm32.FLASH.ACR.SetBits(stm32.FLASH_ACR_DCRST)
+	stm32.FLASH.ACR.ClearBits(stm32.FLASH_ACR_DCRST)
+	stm32.FLASH.ACR.SetBits(stm32.FLASH_ACR_DCEN)
+	return nil
+}
+
+// dualBank returns whether the flash is split in two banks with their own
+// sectors.
+func (f flashBlockDevice) dualBank() bool {
+	deviceID := (*volatile.Register32)(unsafe.Pointer(uintptr(dbgmcuIDCODE))).Get() & 0xfff
+	if deviceID != 0x419 && deviceID != 0x434 {
+		// Only the STM32F42x/F43x and STM32F469/F479 have two banks.
+		return false
+	}
+	switch f.Size() {
+	case 2 * 1024 * 1024:
+		return true
+	case 1024 * 1024:
+		return stm32.FLASH.OPTCR.HasBits(flashOPTCRDB1M)
+	}
+	return false
+}
+
+// unlockFlash allows writes to the FLASH_CR register, which is locked after
+// reset and by lockFlash.
+func unlockFlash() {
+	waitForFlash()
+	if stm32.FLASH.CR.HasBits(stm32.FLASH_CR_LOCK) {
+		stm32.FLASH.KEYR.Set(0x45670123)
+		stm32.FLASH.KEYR.Set(0xcdef89ab)
+	}
+}
+
+// lockFlash locks the FLASH_CR register again.
+func lockFlash() {
+	stm32.FLASH.CR.SetBits(stm32.FLASH_CR_LOCK)
+}
+
+// waitForFlash waits until the last write or erase operation has finished, and
+// returns an error if it failed.
+func waitForFlash() error {
+	for stm32.FLASH.SR.HasBits(stm32.FLASH_SR_BSY) {
+	}
+	if errs := stm32.FLASH.SR.Get() & flashSRErrors; errs != 0 {
+		stm32.FLASH.SR.Set(errs) // clear the error flags
+		return ErrFlashWrite
+	}
+	return nil
+}
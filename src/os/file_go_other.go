@@ -40,7 +40,7 @@ const (
 	ModePerm FileMode = 0777 // Unix permission bits
 )
 
-// IsDir is a stub, always returning false
+// IsDir reports whether m describes a directory.
 func (m FileMode) IsDir() bool {
-	return false
+	return m&ModeDir != 0
 }
@@ -97,6 +97,11 @@ func (f unixFileHandle) Close() error {
 	return handleSyscallError(syscall.Close(int(f)))
 }
 
+// Fd returns the Unix file descriptor of this file.
+func (f unixFileHandle) Fd() uintptr {
+	return uintptr(f)
+}
+
 // handleSyscallError converts syscall errors into regular os package errors.
 // The err parameter must be either nil or of type syscall.Errno.
 func handleSyscallError(err error) error {
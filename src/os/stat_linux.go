@@ -0,0 +1,9 @@
+// +build linux,!baremetal,!wasi
+
+package os
+
+import "syscall"
+
+func statModTime(st *syscall.Stat_t) syscall.Timespec {
+	return st.Mtim
+}
@@ -442,7 +442,7 @@ func (v Value) Field(i int) Value {
 		ptr := unsafe.Pointer(uintptr(v.value) + structField.Offset)
 		value := unsafe.Pointer(loadValue(ptr, fieldSize))
 		return Value{
-			flags:    0,
+			flags:    flags,
 			typecode: fieldType,
 			value:    value,
 		}
@@ -497,8 +497,12 @@ func (v Value) Index(i int) Value {
 				flags:    v.flags,
 			}
 		}
-		if elemSize > unsafe.Sizeof(uintptr(0)) {
-			// The resulting value doesn't fit in a pointer so must be
+		if uint(i) >= uint(v.typecode.Len()) {
+			panic("reflect: array index out of range")
+		}
+		if v.isIndirect() || elemSize > unsafe.Sizeof(uintptr(0)) {
+			// The array is addressable (so the element must be addressable
+			// too), or the resulting value doesn't fit in a pointer so must be
 			// indirect. Also, because size != 0 this implies that the array
 			// length must be != 0, and thus that the total size is at least
 			// elemSize.
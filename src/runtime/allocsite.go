@@ -0,0 +1,58 @@
+// +build heapprofile alloctrace
+
+package runtime
+
+// Allocation sites, used by heap profiling (-heapprofile) and allocation
+// tracing (-alloctrace). The compiler stores the index of the allocation site
+// in heapProfileSite before every call to alloc, and sets heapProfileSites to a
+// description of each allocation site in the program.
+
+var (
+	heapProfileSite  uintptr
+	heapProfileSites string // one line per site: function, file and line, separated by tabs
+)
+
+// allocSite returns the description of the allocation site with the given
+// index. The last return value is false if there is no such site.
+func allocSite(index uintptr) (function, file string, line int, ok bool) {
+	// Find the line with the site description.
+	description := heapProfileSites
+	for i := uintptr(0); i < index; i++ {
+		end := stringIndexByte(description, '\n')
+		if end < 0 {
+			return
+		}
+		description = description[end+1:]
+	}
+	if end := stringIndexByte(description, '\n'); end >= 0 {
+		description = description[:end]
+	}
+
+	// Split the description in its three fields.
+	tab := stringIndexByte(description, '\t')
+	if tab < 0 {
+		return
+	}
+	function = description[:tab]
+	description = description[tab+1:]
+	tab = stringIndexByte(description, '\t')
+	if tab < 0 {
+		return
+	}
+	file = description[:tab]
+	for _, c := range description[tab+1:] {
+		line = line*10 + int(c-'0')
+	}
+	return function, file, line, true
+}
+
+// stringIndexByte returns the index of the first c in s, or -1 if it isn't
+// present.
+func stringIndexByte(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,111 @@
+// +build alloctrace
+
+package runtime
+
+// Allocation tracing support (-alloctrace). Every heap allocation is either
+// printed directly to the console, or recorded in a small ring buffer that can
+// be read with runtime/debug.WriteAllocTrace. Tracing is off by default and
+// is controlled at runtime with runtime/debug.SetAllocTrace. When it is off,
+// the only cost of an allocation is storing the site index and a check of
+// allocTraceMode.
+
+import (
+	"internal/task"
+	"runtime/interrupt"
+	"unsafe"
+)
+
+// Allocation tracing modes. These must be kept in sync with the runtime/debug
+// package.
+const (
+	allocTraceOff    = iota // allocations are not traced
+	allocTracePrint         // allocations are printed to the console
+	allocTraceBuffer        // allocations are recorded in allocTraceBuf
+)
+
+type allocTraceEvent struct {
+	time timeUnit
+	size uintptr
+	site uintptr
+	task uintptr
+}
+
+var (
+	allocTraceMode  int
+	allocTraceBuf   []allocTraceEvent
+	allocTraceCount uintptr // total number of allocations recorded in allocTraceBuf
+)
+
+// allocTraceAlloc traces an allocation of the given size at the current
+// allocation site. It is called from the allocator.
+func allocTraceAlloc(size uintptr) {
+	switch allocTraceMode {
+	case allocTracePrint:
+		printstring("tinygo-alloc: ")
+		printuint32(uint32(size))
+		printspace()
+		printptr(uintptr(unsafe.Pointer(task.Current())))
+		printspace()
+		if function, file, line, ok := allocSite(heapProfileSite); ok {
+			printstring(function)
+			printspace()
+			printstring(file)
+			putchar(':')
+			printint32(int32(line))
+		} else {
+			printstring("unknown")
+		}
+		printnl()
+	case allocTraceBuffer:
+		mask := interrupt.Disable()
+		ev := &allocTraceBuf[allocTraceCount%uintptr(len(allocTraceBuf))]
+		ev.time = ticks()
+		ev.size = size
+		ev.site = heapProfileSite
+		ev.task = uintptr(unsafe.Pointer(task.Current()))
+		allocTraceCount++
+		interrupt.Restore(mask)
+	}
+}
+
+// debug_setAllocTrace sets the allocation tracing mode and returns the previous
+// mode. When switching to the ring buffer mode, the buffer is emptied and
+// resized to hold the given number of allocations (at least one).
+//go:linkname debug_setAllocTrace runtime/debug.runtime_setAllocTrace
+func debug_setAllocTrace(mode, size int) int {
+	if size < 1 {
+		// The buffer is indexed modulo its length, so it can't be empty.
+		size = 1
+	}
+	previous := allocTraceMode
+	if mode == allocTraceBuffer && previous != allocTraceBuffer {
+		// Turn tracing off while allocating the buffer, so that this
+		// allocation doesn't end up in the old buffer.
+		allocTraceMode = allocTraceOff
+		if len(allocTraceBuf) != size {
+			allocTraceBuf = make([]allocTraceEvent, size)
+		}
+		allocTraceCount = 0
+	}
+	allocTraceMode = mode
+	return previous
+}
+
+// debug_allocTraceEvent returns the recorded allocation with the given index,
+// where index 0 is the oldest allocation still in the buffer. The number of
+// allocations that were overwritten because the buffer was full is returned
+// as well.
+//go:linkname debug_allocTraceEvent runtime/debug.runtime_allocTraceEvent
+func debug_allocTraceEvent(index int) (nanoseconds int64, size, goroutine uintptr, function, file string, line int, dropped uintptr, ok bool) {
+	count := allocTraceCount
+	if count > uintptr(len(allocTraceBuf)) {
+		dropped = count - uintptr(len(allocTraceBuf))
+		count = uintptr(len(allocTraceBuf))
+	}
+	if index < 0 || uintptr(index) >= count {
+		return 0, 0, 0, "", "", 0, dropped, false
+	}
+	ev := allocTraceBuf[(dropped+uintptr(index))%uintptr(len(allocTraceBuf))]
+	function, file, line, _ = allocSite(ev.site)
+	return ticksToNanoseconds(ev.time), ev.size, ev.task, function, file, line, dropped, true
+}
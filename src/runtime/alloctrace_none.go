@@ -0,0 +1,19 @@
+// +build !alloctrace
+
+package runtime
+
+// Allocation tracing is disabled: build with -alloctrace to enable it.
+
+//go:inline
+func allocTraceAlloc(size uintptr) {
+}
+
+//go:linkname debug_setAllocTrace runtime/debug.runtime_setAllocTrace
+func debug_setAllocTrace(mode, size int) int {
+	return 0
+}
+
+//go:linkname debug_allocTraceEvent runtime/debug.runtime_allocTraceEvent
+func debug_allocTraceEvent(index int) (nanoseconds int64, size, goroutine uintptr, function, file string, line int, dropped uintptr, ok bool) {
+	return
+}
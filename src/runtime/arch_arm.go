@@ -1,4 +1,4 @@
-// +build arm,!baremetal,!wasm arm,arm7tdmi
+// +build arm,!baremetal,!wasm arm,arm7tdmi arm,zephyr arm,customos
 
 package runtime
 
@@ -0,0 +1,13 @@
+// +build arduino.core
+
+package runtime
+
+// The init function of the Arduino core sets up the timers used by millis,
+// delay and analogWrite, and the ADC. It is normally called from the main
+// function of the core, which is replaced by the TinyGo runtime.
+//export init
+func arduino_init()
+
+func initArduinoCore() {
+	arduino_init()
+}
@@ -0,0 +1,5 @@
+// +build !arduino.core
+
+package runtime
+
+func initArduinoCore() {}
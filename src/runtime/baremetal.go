@@ -1,4 +1,4 @@
-// +build baremetal
+// +build baremetal,!zephyr,!freertos,!customos
 
 package runtime
 
@@ -21,6 +21,11 @@ var globalsEndSymbol [0]byte
 //go:extern _stack_top
 var stackTopSymbol [0]byte
 
+// The size of the system stack, which ends at _stack_top. This symbol is not
+// defined on all baremetal targets.
+//go:extern _stack_size
+var stackSizeSymbol [0]byte
+
 var (
 	heapStart    = uintptr(unsafe.Pointer(&heapStartSymbol))
 	heapEnd      = uintptr(unsafe.Pointer(&heapEndSymbol))
@@ -0,0 +1,17 @@
+// +build buildmode.carchive,baremetal
+
+package runtime
+
+// This file provides the entry point of a program built with
+// -buildmode=c-archive, which is linked into a C program as a static library.
+// The C program owns the reset handler and main function, so the runtime isn't
+// started in the usual way.
+
+// tinygo_init initializes the heap and runs all package initializers. It must
+// be called once by the C program, after its own startup code has initialized
+// the .data and .bss sections and before any exported Go function is called.
+//export tinygo_init
+func tinygo_init() {
+	initHeap()
+	initAll()
+}
@@ -0,0 +1,22 @@
+// +build buildmode.carchive,!baremetal
+
+package runtime
+
+// This file provides the entry point of a program built with
+// -buildmode=c-archive for a hosted system (Linux). The static library is
+// linked into a C program, which owns the main function and the threads that
+// call into Go.
+
+// Exported functions may be called from any thread of the C program, and at
+// any stack depth, so the stack top is looked up on every GC cycle just like
+// in a shared library.
+const isSharedLibrary = true
+
+// tinygo_init allocates the heap and runs all package initializers. It must be
+// called once by the C program before any exported Go function is called.
+//export tinygo_init
+func tinygo_init() {
+	preinit()
+	initHeap()
+	initAll()
+}
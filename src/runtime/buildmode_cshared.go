@@ -0,0 +1,22 @@
+// +build buildmode.cshared
+
+package runtime
+
+// This file provides the entry point of a program built with
+// -buildmode=c-shared, which is a shared library that is loaded by a program
+// on the host. The host program owns the main function and the threads that
+// call into the library, so the runtime isn't started in the usual way.
+
+// The stack top isn't known in advance, as exported functions may be called
+// from any thread of the host program. It is looked up on every GC cycle.
+const isSharedLibrary = true
+
+// tinygo_init initializes the heap and runs all package initializers. It is
+// called by the dynamic loader when the library is loaded, as the linker sets
+// it as the initialization function of the library.
+//export tinygo_init
+func tinygo_init() {
+	preinit()
+	initHeap()
+	initAll()
+}
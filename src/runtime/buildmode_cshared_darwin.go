@@ -0,0 +1,16 @@
+// +build buildmode.cshared,darwin
+
+package runtime
+
+import "unsafe"
+
+//export pthread_self
+func pthread_self() uintptr
+
+//export pthread_get_stackaddr_np
+func pthread_get_stackaddr_np(thread uintptr) unsafe.Pointer
+
+// threadStackTop returns the top of the stack of the current thread.
+func threadStackTop() uintptr {
+	return uintptr(pthread_get_stackaddr_np(pthread_self()))
+}
@@ -0,0 +1,30 @@
+// +build buildmode.cshared,linux buildmode.carchive,linux,!baremetal
+
+package runtime
+
+import "unsafe"
+
+//export pthread_self
+func pthread_self() uintptr
+
+//export pthread_getattr_np
+func pthread_getattr_np(thread uintptr, attr unsafe.Pointer) int32
+
+//export pthread_attr_getstack
+func pthread_attr_getstack(attr unsafe.Pointer, stackaddr, stacksize *uintptr) int32
+
+//export pthread_attr_destroy
+func pthread_attr_destroy(attr unsafe.Pointer) int32
+
+// threadStackTop returns the top of the stack of the current thread.
+func threadStackTop() uintptr {
+	// pthread_attr_t is opaque, but not bigger than this in any libc.
+	var attr [16]uintptr
+	var addr, size uintptr
+	if pthread_getattr_np(pthread_self(), unsafe.Pointer(&attr)) != 0 {
+		runtimePanic("could not get the stack of the current thread")
+	}
+	pthread_attr_getstack(unsafe.Pointer(&attr), &addr, &size)
+	pthread_attr_destroy(unsafe.Pointer(&attr))
+	return addr + size
+}
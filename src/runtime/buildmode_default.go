@@ -0,0 +1,11 @@
+// +build !buildmode.cshared,!buildmode.carchive buildmode.carchive,baremetal
+
+package runtime
+
+// The stack top is known at startup (or provided by the linker), so it doesn't
+// need to be looked up on every GC cycle.
+const isSharedLibrary = false
+
+func threadStackTop() uintptr {
+	return 0
+}
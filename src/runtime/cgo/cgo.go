@@ -1,3 +1,37 @@
+// Package cgo contains runtime support for code generated by CGo.
+//
+// Go functions can be called from C by exporting them with //export. Such a
+// function can be passed to C as a function pointer, for example to register a
+// callback or to use it as a qsort comparator, by referring to it as C.name:
+//
+//     //export compare
+//     func compare(a, b unsafe.Pointer) C.int {
+//         return C.int(*(*C.int)(a) - *(*C.int)(b))
+//     }
+//
+//     C.qsort(unsafe.Pointer(&values[0]), C.size_t(len(values)), 4, C.compare)
+//
+// The function doesn't need to be declared in the CGo preamble for this, but it
+// must be declared there (or in a header file) to call it directly from C in
+// the same package. Only top-level functions can be exported: to pass a closure
+// or other Go state to C, pass a Handle as the user data pointer of the C API
+// and retrieve the value with Handle.Value in the callback.
+//
+// Exported functions are called on the stack of the goroutine or interrupt
+// that called into C, and are subject to the following restrictions:
+//
+//   - With -scheduler=coroutines, an exported function (and everything it
+//     calls) must not block: it must not do channel operations that wait,
+//     lock a contended sync.Mutex, call time.Sleep and so on. The compiler
+//     reports such a function as a "blocking operation in exported function".
+//     With -scheduler=tasks blocking is allowed, as long as the C code that
+//     calls the function can be paused.
+//   - When called from an interrupt handler (for example by a vendor HAL), an
+//     exported function must follow the rules for interrupts: it must not
+//     allocate heap memory, block or sleep. Build with -interruptcheck to
+//     detect mistakes. NewHandle and Handle.Delete must not be called from
+//     interrupts.
+//   - C code must not keep a Go pointer it received after the call returns,
+//     unless the memory is kept alive from Go, as the garbage collector does
+//     not scan memory allocated by C.
 package cgo
-
-// dummy
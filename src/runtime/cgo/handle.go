@@ -0,0 +1,58 @@
+package cgo
+
+// Handle provides a way to pass values that contain Go pointers, such as a
+// closure, between Go and C without breaking the pointer passing rules. A
+// Handle is an integer that can be converted to a C pointer-sized type (for
+// example uintptr_t or void*) and back. It is typically used as the user data
+// of a callback:
+//
+//     h := cgo.NewHandle(func(n int) { println("got", n) })
+//     C.register_callback(C.callback_t(C.onEvent), C.uintptr_t(h))
+//
+//     //export onEvent
+//     func onEvent(userdata C.uintptr_t, n C.int) {
+//         f := cgo.Handle(userdata).Value().(func(int))
+//         f(int(n))
+//     }
+//
+// The value is kept alive until Delete is called, so that it is not freed by
+// the garbage collector while only C code refers to it.
+type Handle uintptr
+
+var (
+	handles    = map[Handle]interface{}{}
+	handleNext Handle
+)
+
+// NewHandle returns a handle for the given value. The handle is valid until
+// Delete is called on it. NewHandle allocates memory and must not be called
+// from an interrupt handler.
+func NewHandle(v interface{}) Handle {
+	// Handles are never 0, so that 0 can be used by C code as "no value".
+	handleNext++
+	if handleNext == 0 {
+		panic("runtime/cgo: ran out of handle space")
+	}
+	handles[handleNext] = v
+	return handleNext
+}
+
+// Value returns the value of a valid handle. It panics if the handle is not
+// valid.
+func (h Handle) Value() interface{} {
+	v, ok := handles[h]
+	if !ok {
+		panic("runtime/cgo: misuse of an invalid Handle")
+	}
+	return v
+}
+
+// Delete invalidates the handle, so that the value can be freed by the garbage
+// collector. It panics if the handle is not valid. A handle must not be used
+// after it has been deleted.
+func (h Handle) Delete() {
+	if _, ok := handles[h]; !ok {
+		panic("runtime/cgo: misuse of an invalid Handle")
+	}
+	delete(handles, h)
+}
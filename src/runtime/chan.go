@@ -32,7 +32,7 @@ import (
 func chanDebug(ch *channel) {
 	if schedulerDebug {
 		if ch.bufSize > 0 {
-			println("--- channel update:", ch, ch.state.String(), ch.bufSize, ch.bufUsed)
+			println("--- channel update:", ch, ch.state.String(), ch.bufSize, chanLen(ch))
 		} else {
 			println("--- channel update:", ch, ch.state.String())
 		}
@@ -120,6 +120,7 @@ type channel struct {
 	elementSize uintptr // the size of one value in this channel
 	bufSize     uintptr // size of buffer (in elements)
 	state       chanState
+	spsc        bool // single-producer single-consumer channel, see chan_spsc.go
 	blocked     *channelBlockedList
 	bufHead     uintptr        // head index of buffer (next push index)
 	bufTail     uintptr        // tail index of buffer (next pop index)
@@ -144,6 +145,9 @@ func chanLen(c *channel) int {
 	if c == nil {
 		return 0
 	}
+	if c.spsc {
+		return int(c.usedSPSC())
+	}
 	return int(c.bufUsed)
 }
 
@@ -195,6 +199,7 @@ func (ch *channel) resumeRX(ok bool) unsafe.Pointer {
 
 	// push task onto runqueue
 	runqueue.Push(b.t)
+	traceRecord(traceEvGoUnblock, b.t)
 
 	return dst
 }
@@ -222,6 +227,7 @@ func (ch *channel) resumeTX() unsafe.Pointer {
 
 	// push task onto runqueue
 	runqueue.Push(b.t)
+	traceRecord(traceEvGoUnblock, b.t)
 
 	return src
 }
@@ -309,6 +315,10 @@ func (ch *channel) trySend(value unsafe.Pointer) bool {
 		return false
 	}
 
+	if ch.spsc {
+		return ch.trySendSPSC(value)
+	}
+
 	i := interrupt.Disable()
 
 	switch ch.state {
@@ -361,6 +371,10 @@ func (ch *channel) tryRecv(value unsafe.Pointer) (bool, bool) {
 		return false, false
 	}
 
+	if ch.spsc {
+		return ch.tryRecvSPSC(value)
+	}
+
 	i := interrupt.Disable()
 
 	switch ch.state {
@@ -465,6 +479,11 @@ type chanSelectState struct {
 // This operation will block unless a value is immediately available.
 // May panic if the channel is closed.
 func chanSend(ch *channel, value unsafe.Pointer, blockedlist *channelBlockedList) {
+	if ch.trySendFast(value) {
+		// value sent without disabling interrupts
+		return
+	}
+
 	i := interrupt.Disable()
 
 	if ch.trySend(value) {
@@ -474,9 +493,12 @@ func chanSend(ch *channel, value unsafe.Pointer, blockedlist *channelBlockedList
 		return
 	}
 
+	interruptCheck("blocking channel operation")
+
 	if ch == nil {
 		// A nil channel blocks forever. Do not schedule this goroutine again.
 		interrupt.Restore(i)
+		blockRecord(blockChanSend, nil, returnAddress(0))
 		deadlock()
 	}
 
@@ -491,7 +513,10 @@ func chanSend(ch *channel, value unsafe.Pointer, blockedlist *channelBlockedList
 	ch.blocked = blockedlist
 	chanDebug(ch)
 	interrupt.Restore(i)
+	traceRecord(traceEvGoBlockSend, sender)
+	blockRecord(blockChanSend, unsafe.Pointer(ch), returnAddress(0))
 	task.Pause()
+	blockDone()
 	sender.Ptr = nil
 }
 
@@ -500,6 +525,11 @@ func chanSend(ch *channel, value unsafe.Pointer, blockedlist *channelBlockedList
 // The recieved value is copied into the value pointer.
 // Returns the comma-ok value.
 func chanRecv(ch *channel, value unsafe.Pointer, blockedlist *channelBlockedList) bool {
+	if ch.tryRecvFast(value) {
+		// value received without disabling interrupts
+		return true
+	}
+
 	i := interrupt.Disable()
 
 	if rx, ok := ch.tryRecv(value); rx {
@@ -509,9 +539,12 @@ func chanRecv(ch *channel, value unsafe.Pointer, blockedlist *channelBlockedList
 		return ok
 	}
 
+	interruptCheck("blocking channel operation")
+
 	if ch == nil {
 		// A nil channel blocks forever. Do not schedule this goroutine again.
 		interrupt.Restore(i)
+		blockRecord(blockChanRecv, nil, returnAddress(0))
 		deadlock()
 	}
 
@@ -526,7 +559,10 @@ func chanRecv(ch *channel, value unsafe.Pointer, blockedlist *channelBlockedList
 	ch.blocked = blockedlist
 	chanDebug(ch)
 	interrupt.Restore(i)
+	traceRecord(traceEvGoBlockRecv, receiver)
+	blockRecord(blockChanRecv, unsafe.Pointer(ch), returnAddress(0))
 	task.Pause()
+	blockDone()
 	ok := receiver.Data == 1
 	receiver.Ptr, receiver.Data = nil, 0
 	return ok
@@ -581,6 +617,8 @@ func chanSelect(recvbuf unsafe.Pointer, states []chanSelectState, ops []channelB
 		return selected, ok
 	}
 
+	interruptCheck("blocking select")
+
 	// construct blocked operations
 	for i, v := range states {
 		if v.ch == nil {
@@ -632,7 +670,10 @@ func chanSelect(recvbuf unsafe.Pointer, states []chanSelectState, ops []channelB
 
 	// wait for one case to fire
 	interrupt.Restore(istate)
+	traceRecord(traceEvGoBlockSelect, t)
+	blockRecord(blockSelect, nil, returnAddress(0))
 	task.Pause()
+	blockDone()
 
 	// figure out which one fired and return the ok value
 	return (uintptr(t.Ptr) - uintptr(unsafe.Pointer(&states[0]))) / unsafe.Sizeof(chanSelectState{}), t.Data != 0
@@ -0,0 +1,203 @@
+package runtime
+
+// This file implements single-producer single-consumer (SPSC) channels: a
+// buffered channel that is only sent to by one goroutine or interrupt and only
+// received from by one goroutine or interrupt can be marked as such with
+// interrupt.SPSC. Sends and receives on such a channel don't disable interrupts
+// when the value can be pushed to or popped from the buffer directly.
+//
+// The buffer of an SPSC channel is a ring buffer with one more element than the
+// channel capacity. The head index (next push index) is only written by the
+// producer and the tail index (next pop index) only by the consumer, so that a
+// full buffer can be told apart from an empty buffer without a counter that is
+// written by both sides. The bufUsed field is not used.
+//
+// The state of an SPSC channel is never chanStateBuf: it is chanStateEmpty
+// when no goroutine is blocked (whether or not there are values in the
+// buffer), chanStateRecv when the consumer is blocked on an empty buffer,
+// chanStateSend when the producer is blocked on a full buffer, or
+// chanStateClosed. The fast paths below only run in chanStateEmpty. They
+// don't need to disable interrupts because a goroutine can only be interrupted
+// by an interrupt, which can't block on the channel, and because goroutines
+// are only switched when they block.
+
+import (
+	"runtime/interrupt"
+	"sync/atomic"
+	"unsafe"
+)
+
+//go:linkname interrupt_chanSPSC runtime/interrupt.chanSPSC
+func interrupt_chanSPSC(ch interface{}) {
+	itf := (*_interface)(unsafe.Pointer(&ch))
+	if itf.typecode%2 == 0 || (itf.typecode>>1)%8 != 0 {
+		// Not a channel type, see the type code encoding in reflect.
+		runtimePanic("interrupt.SPSC: not a channel")
+	}
+	chanSetSPSC((*channel)(itf.value))
+}
+
+// chanSetSPSC turns a buffered channel into an SPSC channel. The channel must
+// not have been used yet.
+func chanSetSPSC(ch *channel) {
+	if ch == nil || ch.bufSize == 0 {
+		runtimePanic("interrupt.SPSC: channel must be buffered")
+	}
+	if ch.spsc {
+		return
+	}
+	buf := alloc(ch.elementSize * (ch.bufSize + 1))
+	i := interrupt.Disable()
+	if ch.state != chanStateEmpty || ch.bufUsed != 0 {
+		interrupt.Restore(i)
+		runtimePanic("interrupt.SPSC: channel must be empty")
+	}
+	ch.buf = buf
+	ch.bufHead = 0
+	ch.bufTail = 0
+	ch.spsc = true
+	interrupt.Restore(i)
+}
+
+// nextSPSC returns the ring buffer index that follows index i.
+//go:inline
+func (ch *channel) nextSPSC(i uintptr) uintptr {
+	i++
+	if i > ch.bufSize {
+		i = 0
+	}
+	return i
+}
+
+// usedSPSC returns the number of values in the ring buffer.
+func (ch *channel) usedSPSC() uintptr {
+	head := atomic.LoadUintptr(&ch.bufHead)
+	tail := atomic.LoadUintptr(&ch.bufTail)
+	if head >= tail {
+		return head - tail
+	}
+	return head + ch.bufSize + 1 - tail
+}
+
+// pushSPSC copies the value to the ring buffer if there is space for it. It
+// must only be called by the producer.
+func (ch *channel) pushSPSC(value unsafe.Pointer) bool {
+	head := ch.bufHead
+	next := ch.nextSPSC(head)
+	if next == atomic.LoadUintptr(&ch.bufTail) {
+		// buffer full
+		return false
+	}
+	memcpy(unsafe.Pointer(uintptr(ch.buf)+ch.elementSize*head), value, ch.elementSize)
+
+	// Publish the value to the consumer.
+	atomic.StoreUintptr(&ch.bufHead, next)
+	return true
+}
+
+// popSPSC moves a value from the ring buffer to the value pointer, if there is
+// one. It must only be called by the consumer.
+func (ch *channel) popSPSC(value unsafe.Pointer) bool {
+	tail := ch.bufTail
+	if tail == atomic.LoadUintptr(&ch.bufHead) {
+		// buffer empty
+		return false
+	}
+	addr := unsafe.Pointer(uintptr(ch.buf) + ch.elementSize*tail)
+	memcpy(value, addr, ch.elementSize)
+
+	// zero buffer element to allow garbage collection of value
+	memzero(addr, ch.elementSize)
+
+	// Hand the buffer element back to the producer.
+	atomic.StoreUintptr(&ch.bufTail, ch.nextSPSC(tail))
+	return true
+}
+
+// trySendFast is the lock-free send path of SPSC channels. It returns false if
+// the send must take the slow path, for example because the buffer is full or
+// the consumer is blocked.
+//go:inline
+func (ch *channel) trySendFast(value unsafe.Pointer) bool {
+	return ch != nil && ch.spsc && ch.state == chanStateEmpty && ch.pushSPSC(value)
+}
+
+// tryRecvFast is the lock-free receive path of SPSC channels. It returns false
+// if the receive must take the slow path, for example because the buffer is
+// empty or the producer is blocked.
+//go:inline
+func (ch *channel) tryRecvFast(value unsafe.Pointer) bool {
+	return ch != nil && ch.spsc && ch.state == chanStateEmpty && ch.popSPSC(value)
+}
+
+// trySendSPSC is trySend for SPSC channels.
+func (ch *channel) trySendSPSC(value unsafe.Pointer) bool {
+	if ch.trySendFast(value) {
+		return true
+	}
+
+	i := interrupt.Disable()
+
+	switch ch.state {
+	case chanStateEmpty:
+		ok := ch.pushSPSC(value)
+		interrupt.Restore(i)
+		return ok
+	case chanStateRecv:
+		// The consumer only blocks on an empty buffer, so the value can be
+		// handed over directly.
+		dst := ch.resumeRX(true)
+		memcpy(dst, value, ch.elementSize)
+		if ch.blocked == nil {
+			ch.state = chanStateEmpty
+		}
+		interrupt.Restore(i)
+		return true
+	case chanStateSend:
+		// the producer is already blocked (in a select)
+		interrupt.Restore(i)
+		return false
+	case chanStateClosed:
+		interrupt.Restore(i)
+		runtimePanic("send on closed channel")
+	default:
+		interrupt.Restore(i)
+		runtimePanic("invalid channel state")
+	}
+
+	interrupt.Restore(i)
+	return false
+}
+
+// tryRecvSPSC is tryRecv for SPSC channels.
+func (ch *channel) tryRecvSPSC(value unsafe.Pointer) (bool, bool) {
+	if ch.tryRecvFast(value) {
+		return true, true
+	}
+
+	i := interrupt.Disable()
+
+	if ch.popSPSC(value) {
+		if ch.state == chanStateSend {
+			// The producer was blocked on a full buffer: there is space for
+			// its value now. It can't push concurrently while it is blocked.
+			src := ch.resumeTX()
+			ch.pushSPSC(src)
+			if ch.blocked == nil {
+				ch.state = chanStateEmpty
+			}
+		}
+		interrupt.Restore(i)
+		return true, true
+	}
+
+	if ch.state == chanStateClosed {
+		// channel closed - nothing to recieve
+		memzero(value, ch.elementSize)
+		interrupt.Restore(i)
+		return true, false
+	}
+
+	interrupt.Restore(i)
+	return false, false
+}
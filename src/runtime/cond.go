@@ -35,6 +35,7 @@ func (c *Cond) Notify() bool {
 			// Unblock the waiting task.
 			if atomic.CompareAndSwapPointer((*unsafe.Pointer)(unsafe.Pointer(&c.t)), unsafe.Pointer(t), nil) {
 				runqueuePushBack(t)
+				traceRecord(traceEvGoUnblock, t)
 				return true
 			}
 		}
@@ -74,7 +75,10 @@ func (c *Cond) Wait() {
 			// Condition variable has not been notified.
 			// Block the current task on the condition variable.
 			if atomic.CompareAndSwapPointer((*unsafe.Pointer)(unsafe.Pointer(&c.t)), nil, unsafe.Pointer(cur)) {
+				traceRecord(traceEvGoBlockCond, cur)
+				blockRecord(blockCondition, unsafe.Pointer(c), returnAddress(0))
 				task.Pause()
+				blockDone()
 				return
 			}
 		case &notifiedPlaceholder:
@@ -0,0 +1,119 @@
+// +build coredump.serial
+
+package runtime
+
+// This file implements -coredump=serial. On a panic or fault, the registers
+// and the RAM in use (globals, heap and the system stack) are printed to the
+// console, so that the state of the program can be inspected afterwards with
+// tinygo coredump. The format is line based, with all numbers in hexadecimal:
+//
+//     tinygo-coredump: begin 1
+//     tinygo-coredump: regs <r0> <r1> ... <r12> <sp> <lr> <pc> <xpsr>
+//     tinygo-coredump: region <start> <end>
+//     tinygo-coredump: mem <address> <up to 32 bytes>
+//     tinygo-coredump: end
+//
+// Every region line is followed by the mem lines of that region. Lines that
+// would only contain zero bytes are left out to keep the dump small.
+//
+// The fault handler runs on the system stack from the top, so the outermost
+// frames of a fault on the system stack may be overwritten in the dump.
+
+import (
+	"device/arm"
+	"unsafe"
+)
+
+const coreDumpEnabled = true
+
+// coreDumpRegs are the registers written to a core dump: r0-r12, sp, lr, pc
+// and xpsr.
+type coreDumpRegs [17]uintptr
+
+// coreDumpPanic is set when a panic triggered a fault to write a core dump.
+var coreDumpPanic bool
+
+// coreDumpPanicking returns whether the current fault was triggered by
+// coreDumpOnPanic.
+func coreDumpPanicking() bool {
+	return coreDumpPanic
+}
+
+// coreDumpOnPanic is called after the panic message has been printed. It
+// executes an undefined instruction, so that the fault handler writes a core
+// dump with the exact registers of the panicking code.
+func coreDumpOnPanic() {
+	if coreDumpPanic {
+		// Panic while writing the core dump.
+		return
+	}
+	coreDumpPanic = true
+	arm.Asm("udf #0")
+}
+
+// coreDumpWrite writes the core dump with the given registers to the console.
+func coreDumpWrite(regs *coreDumpRegs) {
+	printstring("tinygo-coredump: begin 1")
+	printnl()
+	printstring("tinygo-coredump: regs")
+	for _, reg := range regs {
+		putchar(' ')
+		coreDumpHex(reg, 8)
+	}
+	printnl()
+
+	coreDumpRegion(globalsStart, globalsEnd)
+	coreDumpRegion(heapStart, heapEnd)
+	stackBottom := stackTop - uintptr(unsafe.Pointer(&stackSizeSymbol))
+	if sp := regs[13]; sp >= stackBottom && sp < stackTop {
+		// Only the used part of the system stack. Goroutine stacks are part of
+		// the heap.
+		coreDumpRegion(sp&^31, stackTop)
+	}
+	printstring("tinygo-coredump: end")
+	printnl()
+}
+
+// coreDumpRegion writes the memory between start and end.
+func coreDumpRegion(start, end uintptr) {
+	printstring("tinygo-coredump: region ")
+	coreDumpHex(start, 8)
+	putchar(' ')
+	coreDumpHex(end, 8)
+	printnl()
+	for addr := start; addr < end; addr += 32 {
+		n := end - addr
+		if n > 32 {
+			n = 32
+		}
+		zero := true
+		for i := uintptr(0); i < n; i++ {
+			if *(*byte)(unsafe.Pointer(addr + i)) != 0 {
+				zero = false
+				break
+			}
+		}
+		if zero {
+			continue
+		}
+		printstring("tinygo-coredump: mem ")
+		coreDumpHex(addr, 8)
+		putchar(' ')
+		for i := uintptr(0); i < n; i++ {
+			coreDumpHex(uintptr(*(*byte)(unsafe.Pointer(addr + i))), 2)
+		}
+		printnl()
+	}
+}
+
+// coreDumpHex prints the value with the given number of hexadecimal digits.
+func coreDumpHex(value uintptr, digits int) {
+	for shift := (digits - 1) * 4; shift >= 0; shift -= 4 {
+		nibble := byte(value>>uint(shift)) & 0xf
+		if nibble < 10 {
+			putchar(nibble + '0')
+		} else {
+			putchar(nibble - 10 + 'a')
+		}
+	}
+}
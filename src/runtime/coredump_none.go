@@ -0,0 +1,22 @@
+// +build !coredump.serial
+
+package runtime
+
+// Core dumps are disabled: build with -coredump to enable them.
+
+const coreDumpEnabled = false
+
+type coreDumpRegs [17]uintptr
+
+//go:inline
+func coreDumpPanicking() bool {
+	return false
+}
+
+//go:inline
+func coreDumpOnPanic() {
+}
+
+//go:inline
+func coreDumpWrite(regs *coreDumpRegs) {
+}
@@ -0,0 +1,19 @@
+package runtime
+
+// Code coverage support (tinygo test -cover). When building with coverage
+// enabled, the compiler instruments the basic blocks of the tested package and
+// the builder sets these globals to the counters and block table of that
+// package.
+var (
+	coverageEnabled  bool
+	coverageCounters []byte
+	coverageBlocks   string // one line per counter
+)
+
+// testing_coverageData returns the coverage counters and the block table of the
+// tested package, and whether the test binary was built with -cover. The
+// testing package prints them after the test result.
+//go:linkname testing_coverageData testing.runtime_coverageData
+func testing_coverageData() (enabled bool, counters []byte, blocks string) {
+	return coverageEnabled, coverageCounters, coverageBlocks
+}
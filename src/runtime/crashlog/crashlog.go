@@ -0,0 +1,145 @@
+// Package crashlog keeps a log that survives a reset, to find out why a device
+// in the field crashed or restarted. The log is a ring buffer: when it is full,
+// the oldest data is overwritten.
+//
+// There are two kinds of logs:
+//
+//   - RAM returns a log in RAM that is not initialized at startup, so that it
+//     keeps its contents across a reset (but not across a power cycle). It is
+//     fast and doesn't wear out the flash, which makes it a good fit for
+//     recording panics and faults. Its size is set with the -crashlog-size
+//     flag, for example -crashlog-size=1024.
+//   - NewFlash returns a log in a region of flash (machine.Flash on chips that
+//     support it), which also survives a power cycle. The erase blocks of the
+//     region are used in turn, so that they wear out evenly.
+//
+// Use CapturePanics to record panics and faults in a log, and Dump to print the
+// log after a reboot. tinygo monitor -crashlog=<file> saves the logs printed
+// by Dump to a file, and decodes the fault addresses like other output of the
+// runtime:
+//
+//     log, err := crashlog.RAM()
+//     if err == nil {
+//         crashlog.Dump(machine.Serial, log) // from the previous run
+//         log.Clear()
+//         crashlog.CapturePanics(log)
+//     }
+package crashlog
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"strconv"
+)
+
+var ErrNoRAMLog = errors.New("crashlog: no crash log in RAM (use -crashlog-size)")
+
+// Lines around the log printed by Dump. They are recognized by tinygo monitor.
+const (
+	dumpStart = "--- crashlog ---\n"
+	dumpEnd   = "--- end of crashlog ---\n"
+)
+
+// Log is a log that survives a reset.
+type Log interface {
+	// Write adds p to the log, overwriting the oldest data if the log is full.
+	Write(p []byte) (n int, err error)
+
+	// WriteTo writes the contents of the log to w, oldest first.
+	WriteTo(w io.Writer) (n int64, err error)
+
+	// Clear removes everything from the log.
+	Clear() error
+}
+
+// Dump prints the contents of the log to w (usually the serial console),
+// between marker lines that are recognized by tinygo monitor.
+func Dump(w io.Writer, log Log) error {
+	if _, err := io.WriteString(w, dumpStart); err != nil {
+		return err
+	}
+	lw := &lineWriter{w: w, last: '\n'}
+	if _, err := log.WriteTo(lw); err != nil {
+		return err
+	}
+	if lw.last != '\n' {
+		// Make sure the end marker is on its own line.
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, dumpEnd)
+	return err
+}
+
+// lineWriter remembers the last byte written to it.
+type lineWriter struct {
+	w    io.Writer
+	last byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	if len(p) != 0 {
+		lw.last = p[len(p)-1]
+	}
+	return lw.w.Write(p)
+}
+
+var (
+	panicLog Log
+	panicBuf [128]byte // the panic message is formatted here, to avoid allocating
+)
+
+// CapturePanics records every panic and fault in the given log, just before
+// the handler set with runtime.SetPanicHandler runs. A nil log stops recording
+// panics.
+func CapturePanics(log Log) {
+	panicLog = log
+	if log == nil {
+		runtime_setPanicLogger(nil)
+	} else {
+		runtime_setPanicLogger(logPanic)
+	}
+}
+
+// logPanic writes a panic or fault to the log in the same format as the
+// runtime prints it.
+func logPanic(info *runtime.PanicInfo) {
+	buf := panicBuf[:0]
+	switch {
+	case info.Fault:
+		buf = append(buf, "fatal error: "...)
+		buf = appendString(buf, info.Message)
+		buf = append(buf, " pc=0x"...)
+		buf = strconv.AppendUint(buf, uint64(info.PC), 16)
+	case info.Value == nil:
+		buf = append(buf, "panic: runtime error: "...)
+		buf = appendString(buf, info.Message)
+	default:
+		buf = append(buf, "panic: "...)
+		switch value := info.Value.(type) {
+		case string:
+			buf = appendString(buf, value)
+		case error:
+			buf = appendString(buf, value.Error())
+		case int:
+			buf = strconv.AppendInt(buf, int64(value), 10)
+		default:
+			buf = appendString(buf, "(non-string value)")
+		}
+	}
+	buf = append(buf, '\n')
+	panicLog.Write(buf)
+}
+
+// appendString appends s to buf, but not beyond the capacity of buf (keeping
+// room for a newline).
+func appendString(buf []byte, s string) []byte {
+	if n := cap(buf) - len(buf) - 1; len(s) > n {
+		s = s[:n]
+	}
+	return append(buf, s...)
+}
+
+func runtime_setPanicLogger(logger func(info *runtime.PanicInfo)) // in package runtime
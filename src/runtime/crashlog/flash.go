@@ -0,0 +1,253 @@
+package crashlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime/flash"
+)
+
+var ErrFlashRegion = errors.New("crashlog: flash region must be at least two erase blocks and aligned to the erase block size")
+
+// A log in flash is stored in a number of erase blocks, which are filled one
+// after the other. Each block starts with a sequence number, which is one
+// higher than that of the previous block, followed by the records. When the
+// last block is full, the first block is erased and used again. This way all
+// blocks are erased equally often, and at most one block of data is lost when
+// the log is full.
+//
+// A record is a 16-bit length, the inverse of the length (to detect records
+// that were partially written at the time of a reset) and the data, padded to
+// the write block size. Erased flash reads as 0xff, so a length of 0xffff marks
+// the end of the records in a block.
+const (
+	flashErased       = 0xffffffff
+	flashRecordHeader = 4
+)
+
+type flashLog struct {
+	flash      flash.Device
+	offset     int64 // start of the log in flash
+	blocks     int64 // number of erase blocks
+	blockSize  int64 // erase block size
+	headerSize int64 // size of the sequence number, padded to the write block size
+	current    int64 // index of the block that is being written
+	seq        uint32
+	next       int64  // offset of the next record in the current block
+	buf        []byte // a record is prepared here, to avoid allocating in Write
+}
+
+// NewFlash returns a log that is stored in the given region of flash, such as
+// machine.Flash on chips that support writing to their internal flash. The
+// region must be aligned to the erase block size of the flash and be at least
+// two erase blocks in size. The existing log in the region is kept, unless the
+// region doesn't contain a log yet: then it is erased.
+func NewFlash(device flash.Device, offset, size int64) (Log, error) {
+	blockSize := device.EraseBlockSize()
+	if offset < 0 || offset%blockSize != 0 || size%blockSize != 0 || size < 2*blockSize || offset+size > device.Size() {
+		return nil, ErrFlashRegion
+	}
+	writeSize := device.WriteBlockSize()
+	l := &flashLog{
+		flash:      device,
+		offset:     offset,
+		blocks:     size / blockSize,
+		blockSize:  blockSize,
+		headerSize: alignUp(4, writeSize),
+		buf:        make([]byte, alignUp(64, writeSize)),
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open finds the block that was written last, and the end of the records in
+// that block.
+func (l *flashLog) open() error {
+	found := false
+	for i := int64(0); i < l.blocks; i++ {
+		seq, err := l.blockSeq(i)
+		if err != nil {
+			return err
+		}
+		if seq == flashErased {
+			continue
+		}
+		if !found || seq > l.seq {
+			found = true
+			l.current = i
+			l.seq = seq
+		}
+	}
+	if !found {
+		return l.Clear()
+	}
+	l.next = l.headerSize
+	for {
+		length, ok, err := l.readRecord(l.current, l.next)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		l.next += alignUp(flashRecordHeader+int64(length), l.writeSize())
+	}
+	if l.next+flashRecordHeader <= l.blockSize {
+		// Check that the rest of the block is erased. If not, a record was
+		// only partially written: continue in a new block to be safe.
+		var header [flashRecordHeader]byte
+		if _, err := l.flash.ReadAt(header[:], l.blockStart(l.current)+l.next); err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(header[:]) != flashErased {
+			return l.advance()
+		}
+	}
+	return nil
+}
+
+func (l *flashLog) writeSize() int64 {
+	return l.flash.WriteBlockSize()
+}
+
+func (l *flashLog) blockStart(block int64) int64 {
+	return l.offset + block*l.blockSize
+}
+
+// blockSeq returns the sequence number of a block, or flashErased if the block
+// isn't in use.
+func (l *flashLog) blockSeq(block int64) (uint32, error) {
+	var header [4]byte
+	if _, err := l.flash.ReadAt(header[:], l.blockStart(block)); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(header[:]), nil
+}
+
+// readRecord returns the length of the record at the given offset in a block,
+// and whether there is a valid record.
+func (l *flashLog) readRecord(block, offset int64) (length uint16, ok bool, err error) {
+	if offset+flashRecordHeader > l.blockSize {
+		return 0, false, nil
+	}
+	var header [flashRecordHeader]byte
+	if _, err := l.flash.ReadAt(header[:], l.blockStart(block)+offset); err != nil {
+		return 0, false, err
+	}
+	length = binary.LittleEndian.Uint16(header[0:])
+	check := binary.LittleEndian.Uint16(header[2:])
+	if length != ^check || int(length) > len(l.buf)-flashRecordHeader || offset+flashRecordHeader+int64(length) > l.blockSize {
+		return 0, false, nil
+	}
+	return length, true, nil
+}
+
+// advance starts writing to the next block.
+func (l *flashLog) advance() error {
+	return l.startBlock((l.current+1)%l.blocks, l.seq+1)
+}
+
+// startBlock erases a block and writes its sequence number.
+func (l *flashLog) startBlock(block int64, seq uint32) error {
+	if err := l.flash.EraseBlocks(l.blockStart(block)/l.blockSize, 1); err != nil {
+		return err
+	}
+	header := l.buf[:l.headerSize]
+	for i := range header {
+		header[i] = 0xff
+	}
+	binary.LittleEndian.PutUint32(header, seq)
+	if _, err := l.flash.WriteAt(header, l.blockStart(block)); err != nil {
+		return err
+	}
+	l.current = block
+	l.seq = seq
+	l.next = l.headerSize
+	return nil
+}
+
+func (l *flashLog) Write(p []byte) (n int, err error) {
+	maxData := len(l.buf) - flashRecordHeader
+	for len(p) != 0 {
+		chunk := p
+		if len(chunk) > maxData {
+			chunk = chunk[:maxData]
+		}
+		size := alignUp(flashRecordHeader+int64(len(chunk)), l.writeSize())
+		if l.next+size > l.blockSize {
+			if err := l.advance(); err != nil {
+				return n, err
+			}
+		}
+		record := l.buf[:size]
+		binary.LittleEndian.PutUint16(record[0:], uint16(len(chunk)))
+		binary.LittleEndian.PutUint16(record[2:], ^uint16(len(chunk)))
+		padding := record[flashRecordHeader+copy(record[flashRecordHeader:], chunk):]
+		for i := range padding {
+			padding[i] = 0xff
+		}
+		if _, err := l.flash.WriteAt(record, l.blockStart(l.current)+l.next); err != nil {
+			return n, err
+		}
+		l.next += size
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+func (l *flashLog) WriteTo(w io.Writer) (n int64, err error) {
+	// The block after the current block is the oldest one.
+	for i := int64(1); i <= l.blocks; i++ {
+		block := (l.current + i) % l.blocks
+		seq, err := l.blockSeq(block)
+		if err != nil {
+			return n, err
+		}
+		if seq == flashErased || seq > l.seq || l.seq-seq >= uint32(l.blocks) {
+			// Not in use, or left over from an older log.
+			continue
+		}
+		written, err := l.writeBlockTo(w, block)
+		n += written
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// writeBlockTo writes the records in a block to w.
+func (l *flashLog) writeBlockTo(w io.Writer, block int64) (n int64, err error) {
+	offset := l.headerSize
+	for {
+		length, ok, err := l.readRecord(block, offset)
+		if err != nil || !ok {
+			return n, err
+		}
+		data := l.buf[:length]
+		if _, err := l.flash.ReadAt(data, l.blockStart(block)+offset+flashRecordHeader); err != nil {
+			return n, err
+		}
+		written, err := w.Write(data)
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+		offset += alignUp(flashRecordHeader+int64(length), l.writeSize())
+	}
+}
+
+func (l *flashLog) Clear() error {
+	// The first block is erased by startBlock.
+	if err := l.flash.EraseBlocks(l.offset/l.blockSize+1, l.blocks-1); err != nil {
+		return err
+	}
+	return l.startBlock(0, 0)
+}
+
+func alignUp(n, align int64) int64 {
+	return (n + align - 1) / align * align
+}
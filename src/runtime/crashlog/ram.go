@@ -0,0 +1,143 @@
+package crashlog
+
+import (
+	"io"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// The RAM log starts with a header, followed by the data as a ring buffer.
+// The header is updated after the data, and has a checksum so that a log that
+// was only partially updated at the time of a reset (or that contains random
+// data after power-on) is detected and cleared.
+type ramHeader struct {
+	magic    uint32
+	start    uint32 // offset of the oldest byte in the data
+	used     uint32 // number of bytes in use
+	checksum uint32
+}
+
+const ramMagic = 0x474f4c43 // "CLOG"
+
+type ramLog struct {
+	header *ramHeader
+	data   []byte
+}
+
+var ramLogInstance ramLog
+
+// RAM returns the log in RAM, which has the size set with the -crashlog-size
+// flag. It returns ErrNoRAMLog if there is no log in RAM.
+func RAM() (Log, error) {
+	if ramLogInstance.header != nil {
+		return &ramLogInstance, nil
+	}
+	start, end := ramRegion()
+	if end-start <= unsafe.Sizeof(ramHeader{}) {
+		return nil, ErrNoRAMLog
+	}
+	header := (*ramHeader)(unsafe.Pointer(start))
+	dataStart := start + unsafe.Sizeof(ramHeader{})
+	size := end - dataStart
+	ramLogInstance = ramLog{
+		header: header,
+		data:   (*[1 << 30]byte)(unsafe.Pointer(dataStart))[:size:size],
+	}
+	if !ramLogInstance.valid() {
+		ramLogInstance.Clear()
+	}
+	return &ramLogInstance, nil
+}
+
+// valid returns whether the header is consistent.
+func (l *ramLog) valid() bool {
+	h := l.header
+	return volatile.LoadUint32(&h.magic) == ramMagic &&
+		h.start < uint32(len(l.data)) && h.used <= uint32(len(l.data)) &&
+		h.checksum == ramChecksum(h.start, h.used)
+}
+
+func ramChecksum(start, used uint32) uint32 {
+	return ramMagic ^ start ^ (used << 16) ^ (used >> 16) ^ 0x5a5a5a5a
+}
+
+// update writes a new header.
+func (l *ramLog) update(start, used uint32) {
+	h := l.header
+	volatile.StoreUint32(&h.magic, 0) // invalid while updating
+	h.start = start
+	h.used = used
+	h.checksum = ramChecksum(start, used)
+	volatile.StoreUint32(&h.magic, ramMagic)
+}
+
+func (l *ramLog) Write(p []byte) (n int, err error) {
+	n = len(p)
+	size := uint32(len(l.data))
+	if uint32(len(p)) > size {
+		// Only the end fits.
+		p = p[uint32(len(p))-size:]
+	}
+	start, used := l.header.start, l.header.used
+	end := (start + used) % size
+	for len(p) != 0 {
+		chunk := copy(l.data[end:], p)
+		p = p[chunk:]
+		end = (end + uint32(chunk)) % size
+		used += uint32(chunk)
+	}
+	if used > size {
+		// The oldest data was overwritten.
+		start = end
+		used = size
+	}
+	l.update(start, used)
+	return n, nil
+}
+
+func (l *ramLog) WriteTo(w io.Writer) (n int64, err error) {
+	start, used := l.header.start, l.header.used
+	size := uint32(len(l.data))
+	first := l.data[start:]
+	if uint32(len(first)) > used {
+		first = first[:used]
+	}
+	second := l.data[:used-uint32(len(first))]
+	if used == size {
+		// The log has wrapped around, so the first line is probably
+		// incomplete. Skip it.
+		first, second = skipLine(first, second)
+	}
+	for _, part := range [2][]byte{first, second} {
+		if len(part) == 0 {
+			continue
+		}
+		written, err := w.Write(part)
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// skipLine removes everything up to and including the first newline from the
+// data in first and second.
+func skipLine(first, second []byte) ([]byte, []byte) {
+	for i, c := range first {
+		if c == '\n' {
+			return first[i+1:], second
+		}
+	}
+	for i, c := range second {
+		if c == '\n' {
+			return nil, second[i+1:]
+		}
+	}
+	return nil, nil
+}
+
+func (l *ramLog) Clear() error {
+	l.update(0, 0)
+	return nil
+}
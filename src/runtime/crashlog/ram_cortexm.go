@@ -0,0 +1,20 @@
+// +build cortexm,!mimxrt1062
+
+package crashlog
+
+import (
+	"unsafe"
+)
+
+// The crash log in RAM is reserved at the start of the .noinit section by the
+// linker script (see targets/arm.ld), with the size set by -crashlog-size.
+
+//go:extern _scrashlog
+var crashLogStartSymbol [0]byte
+
+//go:extern _ecrashlog
+var crashLogEndSymbol [0]byte
+
+func ramRegion() (start, end uintptr) {
+	return uintptr(unsafe.Pointer(&crashLogStartSymbol)), uintptr(unsafe.Pointer(&crashLogEndSymbol))
+}
@@ -0,0 +1,8 @@
+// +build !cortexm mimxrt1062
+
+package crashlog
+
+// There is no crash log in RAM on this target.
+func ramRegion() (start, end uintptr) {
+	return 0, 0
+}
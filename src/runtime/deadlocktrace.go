@@ -0,0 +1,124 @@
+// +build deadlocktrace
+
+package runtime
+
+// This file implements -deadlocktrace. Every goroutine that blocks on a
+// channel, mutex or similar records what it blocks on and where, and is kept
+// in a list of blocked goroutines. When the scheduler runs out of goroutines
+// to run while goroutines are still blocked, the list is printed to make the
+// cause of the deadlock findable.
+
+import (
+	"internal/task"
+	"unsafe"
+)
+
+// Kinds of blocking operations. These must be kept in sync with the sync
+// package.
+const (
+	blockChanSend  = 1
+	blockChanRecv  = 2
+	blockSelect    = 3
+	blockForever   = 4 // select{}
+	blockCondition = 5 // runtime.Cond
+	blockMutex     = 6
+	blockWaitGroup = 7
+	blockCond      = 8 // sync.Cond
+)
+
+var (
+	blockedTasks    *task.Task // list of blocked goroutines, most recent first
+	deadlockPrinted bool       // whether the current deadlock was already printed
+)
+
+// blockRecord records that the current goroutine is about to block on the
+// given kind of operation. The pc is the return address of the blocking call.
+// If the goroutine already recorded an operation (for example a send on a nil
+// channel, which then calls deadlock), the first one is kept.
+func blockRecord(kind uint8, object, pc unsafe.Pointer) {
+	t := task.Current()
+	if t == nil || t.Block.Kind != 0 {
+		return
+	}
+	t.Block = task.BlockInfo{
+		Next:   blockedTasks,
+		Kind:   kind,
+		Object: object,
+		PC:     uintptr(pc),
+	}
+	blockedTasks = t
+}
+
+// blockDone removes the current goroutine from the list of blocked goroutines,
+// after it was woken up.
+func blockDone() {
+	t := task.Current()
+	for ptr := &blockedTasks; *ptr != nil; ptr = &(*ptr).Block.Next {
+		if *ptr == t {
+			*ptr = t.Block.Next
+			t.Block = task.BlockInfo{}
+			return
+		}
+	}
+}
+
+// deadlockRunning must be called when a goroutine is about to be run. A
+// deadlock that is printed afterwards is a new one.
+//go:inline
+func deadlockRunning() {
+	deadlockPrinted = false
+}
+
+// deadlockCheck is called by the scheduler when there are no goroutines to
+// run or sleeping. If there are blocked goroutines, they are printed with the
+// operation they are blocked on. This is only done once until a goroutine
+// runs again: on bare metal targets an interrupt may still wake up a
+// goroutine.
+func deadlockCheck() {
+	if blockedTasks == nil || deadlockPrinted {
+		return
+	}
+	deadlockPrinted = true
+	printstring("deadlock: all goroutines are blocked")
+	printnl()
+	for t := blockedTasks; t != nil; t = t.Block.Next {
+		printstring("  goroutine ")
+		printptr(uintptr(unsafe.Pointer(t)))
+		printstring(": ")
+		switch t.Block.Kind {
+		case blockChanSend:
+			printstring("chan send")
+		case blockChanRecv:
+			printstring("chan receive")
+		case blockSelect:
+			printstring("select")
+		case blockForever:
+			printstring("select {}")
+		case blockCondition:
+			printstring("runtime.Cond wait")
+		case blockMutex:
+			printstring("sync.Mutex lock")
+		case blockWaitGroup:
+			printstring("sync.WaitGroup wait")
+		case blockCond:
+			printstring("sync.Cond wait")
+		}
+		if t.Block.Object != nil {
+			printstring(" on ")
+			printptr(uintptr(t.Block.Object))
+		} else if t.Block.Kind == blockChanSend || t.Block.Kind == blockChanRecv {
+			printstring(" on nil channel")
+		}
+		if t.Block.PC != 0 {
+			printstring(" at ")
+			printptr(t.Block.PC)
+			printPCSymbol(t.Block.PC)
+		}
+		printnl()
+	}
+}
+
+// returnAddress returns the return address of the calling function, for level
+// 0. It must be called directly from the function whose caller is of interest.
+//export llvm.returnaddress
+func returnAddress(level uint32) unsafe.Pointer
@@ -0,0 +1,37 @@
+// +build !deadlocktrace
+
+package runtime
+
+import "unsafe"
+
+// Blocking operations are not recorded: build with -deadlocktrace to enable
+// this.
+
+const (
+	blockChanSend  = 0
+	blockChanRecv  = 0
+	blockSelect    = 0
+	blockForever   = 0
+	blockCondition = 0
+)
+
+//go:inline
+func blockRecord(kind uint8, object, pc unsafe.Pointer) {
+}
+
+//go:inline
+func blockDone() {
+}
+
+//go:inline
+func deadlockRunning() {
+}
+
+//go:inline
+func deadlockCheck() {
+}
+
+//go:inline
+func returnAddress(level uint32) unsafe.Pointer {
+	return nil
+}
@@ -0,0 +1,87 @@
+package debug
+
+import (
+	"io"
+	"strconv"
+)
+
+// Allocation tracing modes, for SetAllocTrace. These must be kept in sync with
+// the runtime package.
+const (
+	AllocTraceOff    = 0 // heap allocations are not traced
+	AllocTracePrint  = 1 // heap allocations are printed to the console
+	AllocTraceBuffer = 2 // heap allocations are recorded in a ring buffer
+)
+
+// AllocTraceBufferSize is the number of allocations that are kept in the ring
+// buffer. It is read by SetAllocTrace. Values below 1 are treated as 1.
+var AllocTraceBufferSize = 64
+
+// SetAllocTrace sets the allocation tracing mode and returns the previous mode.
+// With AllocTracePrint, every heap allocation is printed as a line like the
+// following, with the size, the goroutine and the allocation site:
+//
+//     tinygo-alloc: 16 0x20000c40 main.readLine /src/main.go:42
+//
+// With AllocTraceBuffer, the last AllocTraceBufferSize allocations are kept in a
+// ring buffer, to be written later with WriteAllocTrace. Switching to this mode
+// empties the buffer.
+//
+// Allocations are only traced when the program is built with -alloctrace,
+// otherwise SetAllocTrace has no effect and always returns AllocTraceOff.
+func SetAllocTrace(mode int) int {
+	return runtime_setAllocTrace(mode, AllocTraceBufferSize)
+}
+
+// WriteAllocTrace writes the allocations in the ring buffer to w, oldest
+// first, in the format used by AllocTracePrint prefixed with the time in
+// nanoseconds. The buffer is emptied afterwards. Allocations are not traced
+// while the buffer is being written.
+func WriteAllocTrace(w io.Writer) error {
+	mode := runtime_setAllocTrace(AllocTraceOff, 0)
+	defer runtime_setAllocTrace(mode, AllocTraceBufferSize)
+
+	var buf []byte
+	for i := 0; ; i++ {
+		nanoseconds, size, goroutine, function, file, line, dropped, ok := runtime_allocTraceEvent(i)
+		if i == 0 && dropped != 0 {
+			buf = append(buf, "tinygo-alloc: dropped "...)
+			buf = strconv.AppendUint(buf, uint64(dropped), 10)
+			buf = append(buf, '\n')
+		}
+		if !ok {
+			break
+		}
+		buf = append(buf, "tinygo-alloc: "...)
+		buf = strconv.AppendInt(buf, nanoseconds, 10)
+		buf = append(buf, ' ')
+		buf = strconv.AppendUint(buf, uint64(size), 10)
+		buf = append(buf, " 0x"...)
+		buf = strconv.AppendUint(buf, uint64(goroutine), 16)
+		buf = append(buf, ' ')
+		if function != "" {
+			buf = append(buf, function...)
+			buf = append(buf, ' ')
+			buf = append(buf, file...)
+			buf = append(buf, ':')
+			buf = strconv.AppendInt(buf, int64(line), 10)
+		} else {
+			buf = append(buf, "unknown"...)
+		}
+		buf = append(buf, '\n')
+
+		// Write in small chunks, to avoid allocating a large buffer.
+		if len(buf) >= 256 {
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func runtime_setAllocTrace(mode, size int) int // in package runtime
+
+func runtime_allocTraceEvent(index int) (nanoseconds int64, size, goroutine uintptr, function, file string, line int, dropped uintptr, ok bool) // in package runtime
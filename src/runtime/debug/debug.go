@@ -1,2 +1,31 @@
-// Package debug is a dummy package that is not yet implemented.
+// Package debug contains facilities for programs to debug themselves while they
+// are running. Only a small part of the upstream package is implemented.
 package debug
+
+import "internal/errortrace"
+
+// ErrorTrace returns the call chains where err and the errors it wraps were
+// created by errors.New or fmt.Errorf, outermost error first. Each call chain
+// starts with the call that created the error, followed by at most a few of
+// its callers. These are return addresses, pointing just after the call.
+// Errors for which no call chain is known are skipped.
+//
+// Call chains are only recorded when the program is built with -errortrace,
+// otherwise ErrorTrace always returns nil.
+func ErrorTrace(err error) [][]uintptr {
+	var trace [][]uintptr
+	for ; err != nil; err = errortrace.Unwrap(err) {
+		t, ok := err.(errortrace.Tracer)
+		if !ok {
+			continue
+		}
+		var chain []uintptr
+		for depth := 0; depth < errortrace.MaxDepth && t.ErrorTraceAddress(depth) != 0; depth++ {
+			chain = append(chain, t.ErrorTraceAddress(depth))
+		}
+		if chain != nil {
+			trace = append(trace, chain)
+		}
+	}
+	return trace
+}
@@ -0,0 +1,46 @@
+package debug
+
+import "time"
+
+// HeapStats contains a few counters about the heap and the garbage collector.
+// It is a much smaller alternative to runtime.MemStats, meant for devices that
+// need to report their memory health.
+type HeapStats struct {
+	NumGC      uint32        // number of completed garbage collection cycles
+	PauseTotal time.Duration // total time spent in garbage collection
+	LastPause  time.Duration // time spent in the last garbage collection cycle
+	InUse      uintptr       // bytes currently allocated on the heap, including garbage
+	Live       uintptr       // bytes still allocated after the last garbage collection cycle
+	Peak       uintptr       // highest number of bytes ever allocated at the same time
+}
+
+// ReadHeapStats fills stats with the current heap statistics. Sizes include
+// the overhead of the allocator, such as rounding up to the block size.
+func ReadHeapStats(stats *HeapStats) {
+	numGC, pauseTotal, lastPause, inUse, live, peak := runtime_readHeapStats()
+	*stats = HeapStats{
+		NumGC:      numGC,
+		PauseTotal: time.Duration(pauseTotal),
+		LastPause:  time.Duration(lastPause),
+		InUse:      inUse,
+		Live:       live,
+		Peak:       peak,
+	}
+}
+
+// SetGCTrace makes the runtime print the heap statistics to the console after
+// every n garbage collection cycles, and returns the previous setting. A value
+// of 0 (the default) disables printing. Each line looks like this, with the
+// cycle number, the duration of the cycle, the live bytes and the peak usage:
+//
+//     gc 12: 340 us, 2048 B live, 4096 B peak
+func SetGCTrace(n int) int {
+	if n < 0 {
+		n = 0
+	}
+	return int(runtime_setGCTrace(uint32(n)))
+}
+
+func runtime_readHeapStats() (numGC uint32, pauseTotal, lastPause int64, inUse, live, peak uintptr) // in package runtime
+
+func runtime_setGCTrace(every uint32) uint32 // in package runtime
@@ -0,0 +1,106 @@
+package debug
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// StackUsage describes how much of its stack a goroutine has used.
+type StackUsage struct {
+	Goroutine uintptr // identifies the goroutine, as in allocation traces
+	Func      uintptr // address of the function the goroutine was started with
+	Used      uintptr // highest number of stack bytes used so far
+	Size      uintptr // size of the stack in bytes
+}
+
+// ReadStackUsage fills usage with the stack usage of the live goroutines, most
+// recently started first, and returns the number of live goroutines. This may
+// be more than len(usage), in which case only the first len(usage) goroutines
+// are stored.
+//
+// Stack usage is only measured when the program is built with -stackusage and
+// -scheduler=tasks, otherwise ReadStackUsage always returns 0. The measured
+// usage includes everything the goroutine has pushed on its stack since it
+// was started, including interrupts on targets where they use the goroutine
+// stack, so it can be used to check and shrink the stack sizes chosen by the
+// compiler.
+func ReadStackUsage(usage []StackUsage) int {
+	n := 0
+	for {
+		goroutine, fn, used, size, ok := runtime_stackUsage(n)
+		if !ok {
+			return n
+		}
+		if n < len(usage) {
+			usage[n] = StackUsage{
+				Goroutine: goroutine,
+				Func:      fn,
+				Used:      used,
+				Size:      size,
+			}
+		}
+		n++
+	}
+}
+
+// WriteStackUsage writes the stack usage of the live goroutines to w, one line
+// per goroutine with the goroutine, the start function, the used bytes and the
+// stack size:
+//
+//     tinygo-stack: 0x20000c40 0x1a2d 412 2048
+//
+// The start function can be turned into a name with addr2line.
+func WriteStackUsage(w io.Writer) error {
+	var buf []byte
+	for i := 0; ; i++ {
+		goroutine, fn, used, size, ok := runtime_stackUsage(i)
+		if !ok {
+			break
+		}
+		buf = append(buf, "tinygo-stack: 0x"...)
+		buf = strconv.AppendUint(buf, uint64(goroutine), 16)
+		buf = append(buf, " 0x"...)
+		buf = strconv.AppendUint(buf, uint64(fn), 16)
+		buf = append(buf, ' ')
+		buf = strconv.AppendUint(buf, uint64(used), 10)
+		buf = append(buf, ' ')
+		buf = strconv.AppendUint(buf, uint64(size), 10)
+		buf = append(buf, '\n')
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		buf = buf[:0]
+	}
+	return nil
+}
+
+var (
+	stackUsageInterval time.Duration
+	stackUsageReporter bool // whether the report goroutine was started
+)
+
+// SetStackUsageReport makes the program write the stack usage of all
+// goroutines to os.Stdout every interval, in the format of WriteStackUsage.
+// An interval of 0 stops the report. The report runs in its own goroutine,
+// which is included in the report.
+func SetStackUsageReport(interval time.Duration) {
+	stackUsageInterval = interval
+	if interval <= 0 || stackUsageReporter {
+		return
+	}
+	stackUsageReporter = true
+	go func() {
+		for {
+			time.Sleep(stackUsageInterval)
+			if stackUsageInterval <= 0 {
+				break
+			}
+			WriteStackUsage(os.Stdout)
+		}
+		stackUsageReporter = false
+	}()
+}
+
+func runtime_stackUsage(index int) (goroutine, fn, used, size uintptr, ok bool) // in package runtime
@@ -0,0 +1,9 @@
+// +build cortexm,!stm32f7
+
+package runtime
+
+// This chip has no separate section for DMA buffers, or it isn't supported yet.
+
+//go:inline
+func initDMA() {
+}
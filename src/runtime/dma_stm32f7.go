@@ -0,0 +1,24 @@
+// +build stm32f7
+
+package runtime
+
+// This file clears the buffers for DMA transfers (placed in SRAM2 with
+// //go:section ".dma") at startup. The section is defined in the linker script
+// of the chip.
+
+import "unsafe"
+
+//go:extern _sdma
+var _sdma [0]byte
+
+//go:extern _edma
+var _edma [0]byte
+
+// initDMA clears the .dma section.
+func initDMA() {
+	ptr := unsafe.Pointer(&_sdma)
+	for ptr != unsafe.Pointer(&_edma) {
+		*(*uint32)(ptr) = 0
+		ptr = unsafe.Pointer(uintptr(ptr) + 4)
+	}
+}
@@ -0,0 +1,143 @@
+// +build baremetal
+
+package runtime
+
+// Command line arguments and environment variables on baremetal systems. They
+// can be baked into the image at build time (with the -args and -env flags) and
+// can be changed without rebuilding by writing a settings region in flash, at
+// the address given with the -settings-addr flag.
+//
+// The settings region starts with the magic string "TGSETTINGS", followed by a
+// list of entries. Every entry is a type byte ('A' for an argument, 'E' for an
+// environment variable in the KEY=VALUE form) followed by a NUL terminated
+// string. The list ends with a zero byte or with an 0xff byte (erased flash).
+// Arguments in the settings region replace the ones baked in at build time,
+// environment variables are added to (or override) the ones baked in.
+
+import (
+	"unsafe"
+)
+
+const (
+	settingsMagic   = "TGSETTINGS"
+	settingsMaxSize = 4096 // upper bound, in case the list is not terminated
+)
+
+// These globals are set by the linker (see compileopts.Config.GlobalValues).
+var (
+	buildArgs       string // NUL separated arguments (-args)
+	buildEnv        string // NUL separated environment variables (-env)
+	settingsAddress string // address of the settings region (-settings-addr)
+)
+
+var envs []string
+
+func init() {
+	if buildArgs != "" {
+		args = append(args[:1:1], splitNUL(buildArgs)...)
+	}
+	if buildEnv != "" {
+		envs = splitNUL(buildEnv)
+	}
+	if settingsAddress != "" {
+		loadSettings(parseAddress(settingsAddress))
+	}
+}
+
+// loadSettings reads arguments and environment variables from the settings
+// region at the given address, if it contains valid settings.
+func loadSettings(addr uintptr) {
+	for i := 0; i < len(settingsMagic); i++ {
+		if *(*byte)(unsafe.Pointer(addr + uintptr(i))) != settingsMagic[i] {
+			return // no settings stored
+		}
+	}
+	var settingsArgs []string
+	ptr := addr + uintptr(len(settingsMagic))
+	end := addr + settingsMaxSize
+	for ptr < end {
+		kind := *(*byte)(unsafe.Pointer(ptr))
+		if kind == 0 || kind == 0xff {
+			break
+		}
+		ptr++
+		start := ptr
+		for ptr < end && *(*byte)(unsafe.Pointer(ptr)) != 0 {
+			ptr++
+		}
+		value := _string{
+			ptr:    (*byte)(unsafe.Pointer(start)),
+			length: ptr - start,
+		}
+		s := *(*string)(unsafe.Pointer(&value))
+		ptr++ // skip NUL terminator
+		switch kind {
+		case 'A':
+			settingsArgs = append(settingsArgs, s)
+		case 'E':
+			envs = setEnv(envs, s)
+		}
+	}
+	if len(settingsArgs) != 0 {
+		args = append(args[:1:1], settingsArgs...)
+	}
+}
+
+// setEnv adds the KEY=VALUE pair in kv to the list of environment variables,
+// replacing a previous value of the same key.
+func setEnv(envs []string, kv string) []string {
+	keyLen := 0
+	for keyLen < len(kv) && kv[keyLen] != '=' {
+		keyLen++
+	}
+	for i, env := range envs {
+		if len(env) > keyLen && env[keyLen] == '=' && env[:keyLen] == kv[:keyLen] {
+			envs[i] = kv
+			return envs
+		}
+	}
+	return append(envs, kv)
+}
+
+// splitNUL splits a string of NUL separated values.
+func splitNUL(s string) []string {
+	var values []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0 {
+			values = append(values, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(values, s[start:])
+}
+
+// parseAddress parses a decimal or hexadecimal (0x prefixed) address. It has
+// already been validated by the compiler.
+func parseAddress(s string) uintptr {
+	base := uintptr(10)
+	if len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		base = 16
+		s = s[2:]
+	}
+	addr := uintptr(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		var digit uintptr
+		switch {
+		case c >= '0' && c <= '9':
+			digit = uintptr(c - '0')
+		case c >= 'a' && c <= 'f':
+			digit = uintptr(c-'a') + 10
+		case c >= 'A' && c <= 'F':
+			digit = uintptr(c-'A') + 10
+		}
+		addr = addr*base + digit
+	}
+	return addr
+}
+
+//go:linkname syscall_runtime_envs syscall.runtime_envs
+func syscall_runtime_envs() []string {
+	return envs
+}
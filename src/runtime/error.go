@@ -6,3 +6,19 @@ type Error interface {
 
 	RuntimeError()
 }
+
+// runtimeError is a simple run time error with a fixed message.
+type runtimeError string
+
+func (e runtimeError) Error() string {
+	return "runtime error: " + string(e)
+}
+
+func (e runtimeError) RuntimeError() {}
+
+// These errors are used by the math/bits package, which refers to them using
+// //go:linkname.
+var (
+	overflowError = error(runtimeError("integer overflow"))
+	divideError   = error(runtimeError("integer divide by zero"))
+)
@@ -0,0 +1,35 @@
+// +build errortrace
+
+package runtime
+
+import "internal/errortrace"
+
+// printErrorTrace prints the call chains recorded by errors.New and fmt.Errorf
+// (when building with -errortrace) for the panic value and all the errors it
+// wraps, outermost error first. Each line is the call chain of one error,
+// innermost function first. These are return addresses, so they point just
+// after the call. They can be symbolized with a tool like addr2line.
+func printErrorTrace(message interface{}) {
+	err, ok := message.(error)
+	if !ok {
+		return
+	}
+	printed := false
+	for ; err != nil; err = errortrace.Unwrap(err) {
+		t, ok := err.(errortrace.Tracer)
+		if !ok || t.ErrorTraceAddress(0) == 0 {
+			continue
+		}
+		if !printed {
+			printstring("error trace:")
+			printnl()
+			printed = true
+		}
+		printstring(" ")
+		for depth := 0; depth < errortrace.MaxDepth && t.ErrorTraceAddress(depth) != 0; depth++ {
+			printstring(" ")
+			printptr(t.ErrorTraceAddress(depth))
+		}
+		printnl()
+	}
+}
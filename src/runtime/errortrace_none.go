@@ -0,0 +1,9 @@
+// +build !errortrace
+
+package runtime
+
+// Error traces are disabled: build with -errortrace to enable them.
+
+//go:inline
+func printErrorTrace(message interface{}) {
+}
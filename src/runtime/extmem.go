@@ -0,0 +1,23 @@
+// +build gc.conservative
+
+package runtime
+
+// Support for the runtime/extmem package, which adds external memory to the
+// heap and allocates from fast or slow memory explicitly.
+
+import (
+	"unsafe"
+)
+
+//go:linkname extmem_enable runtime/extmem.runtime_enable
+func extmem_enable() uintptr {
+	return enableExternalHeapRegions()
+}
+
+//go:linkname extmem_alloc runtime/extmem.runtime_alloc
+func extmem_alloc(size uintptr, slow bool) unsafe.Pointer {
+	if slow {
+		return allocMemory(size, heapMemorySlow)
+	}
+	return allocMemory(size, heapMemoryFast)
+}
@@ -0,0 +1,105 @@
+// Package extmem adds external memory, such as the PSRAM of ESP32 modules or
+// SDRAM connected to the FMC of larger STM32 chips, to the heap, and allocates
+// memory explicitly from fast (on-chip) or slow (external) memory.
+//
+// External memory is declared in the target specification as a heap region
+// with "external" set, usually in a board target that inherits from the chip:
+//
+//     "heap-regions": [
+//         {"name": "sdram", "origin": "0xc0000000", "size": "8M", "priority": -1, "external": true}
+//     ]
+//
+// No target declares external memory by default, as TinyGo doesn't set up any
+// memory controller itself. For example, the 4MB of PSRAM of the ESP32-WROVER
+// module can be declared at 0x3F800000 in a target that inherits from
+// esp32-wrover-kit, with an init function that enables the PSRAM and maps it
+// through the cache MMU.
+//
+// The memory controller must be set up before the memory can be used, which is
+// done with Init. Until then, all allocations come from on-chip RAM. After
+// that, ordinary allocations use the external memory according to the priority
+// of the region, while Alloc and MakeBytes place an allocation in a specific
+// kind of memory: for example a large frame buffer in slow memory, or a buffer
+// used by an interrupt handler or DMA in fast memory.
+//
+// External memory is only supported by the conservative garbage collector.
+// With other memory managers, all memory is fast memory.
+package extmem
+
+import (
+	"errors"
+	"unsafe"
+)
+
+var ErrNoExternalMemory = errors.New("extmem: no external memory on this target")
+
+// Memory is a kind of memory to allocate from.
+type Memory uint8
+
+const (
+	Fast Memory = iota // on-chip RAM
+	Slow               // external RAM
+)
+
+var externalSize uintptr
+
+// Init initializes the external memory and adds it to the heap. The init
+// function should set up the memory controller so that the external memory
+// declared in the target is accessible. It may be nil if the memory has
+// already been set up, for example by a bootloader.
+//
+// If init returns an error, Init returns it without using the external memory.
+// Otherwise, Init returns ErrNoExternalMemory if the target doesn't have
+// external memory. Calling Init again after it succeeded has no effect.
+func Init(init func() error) error {
+	if externalSize != 0 {
+		return nil
+	}
+	if init != nil {
+		if err := init(); err != nil {
+			return err
+		}
+	}
+	externalSize = runtime_enable()
+	if externalSize == 0 {
+		return ErrNoExternalMemory
+	}
+	return nil
+}
+
+// Size returns the number of bytes of external memory that were added to the
+// heap by Init, not including the space used for the metadata of the garbage
+// collector.
+func Size() uintptr {
+	return externalSize
+}
+
+// Alloc allocates size bytes of zeroed memory of the given kind. The memory is
+// managed by the garbage collector, like any other allocation. It returns nil
+// if there isn't enough free memory of this kind, even after a garbage
+// collection cycle.
+func Alloc(size uintptr, memory Memory) unsafe.Pointer {
+	return runtime_alloc(size, memory == Slow)
+}
+
+// MakeBytes is like make([]byte, n), but it allocates the slice in the given
+// kind of memory. It returns nil if there isn't enough free memory of this
+// kind.
+func MakeBytes(n int, memory Memory) []byte {
+	if n < 0 {
+		panic("extmem: negative size")
+	}
+	ptr := Alloc(uintptr(n), memory)
+	if ptr == nil {
+		return nil
+	}
+	slice := struct {
+		ptr      unsafe.Pointer
+		len, cap uintptr
+	}{ptr, uintptr(n), uintptr(n)}
+	return *(*[]byte)(unsafe.Pointer(&slice))
+}
+
+func runtime_enable() uintptr // in package runtime
+
+func runtime_alloc(size uintptr, slow bool) unsafe.Pointer // in package runtime
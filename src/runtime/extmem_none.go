@@ -0,0 +1,23 @@
+// +build !gc.conservative
+
+package runtime
+
+// The other memory managers don't support external memory: all memory is fast
+// memory.
+
+import (
+	"unsafe"
+)
+
+//go:linkname extmem_enable runtime/extmem.runtime_enable
+func extmem_enable() uintptr {
+	return 0
+}
+
+//go:linkname extmem_alloc runtime/extmem.runtime_alloc
+func extmem_alloc(size uintptr, slow bool) unsafe.Pointer {
+	if slow {
+		return nil
+	}
+	return alloc(size)
+}
@@ -0,0 +1,23 @@
+// Package flash defines the interface of a flash memory, as used by packages
+// that store data in flash: runtime/ota for firmware images and runtime/crashlog
+// for a log that survives a power cycle.
+//
+// The interface is implemented by machine.Flash on chips that support writing
+// to their internal flash: currently the nRF series and the STM32F4. It can
+// also be implemented for external flash.
+package flash
+
+import "io"
+
+// Device is a flash memory. Offsets are relative to the start of the flash.
+// Writes are a multiple of the write block size, at an offset that is a
+// multiple of the write block size, and only to flash that has been erased.
+// Erased flash reads as 0xff.
+type Device interface {
+	io.ReaderAt
+	io.WriterAt
+	Size() int64
+	WriteBlockSize() int64
+	EraseBlockSize() int64
+	EraseBlocks(start, len int64) error
+}
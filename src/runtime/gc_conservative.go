@@ -21,7 +21,9 @@ package runtime
 //
 // Metadata is stored in a special area at the end of the heap, in the area
 // metadataStart..heapEnd. The actual blocks are stored in
-// heapStart..metadataStart.
+// heapStart..metadataStart. Some targets have extra heap regions (see
+// gc_heapregions.go), whose blocks are numbered after the blocks of the main
+// heap and share its metadata.
 //
 // More information:
 // https://github.com/micropython/micropython/wiki/Memory-Manager
@@ -53,6 +55,8 @@ const (
 var (
 	metadataStart unsafe.Pointer // pointer to the start of the heap
 	nextAlloc     gcBlock        // the next block that should be tried by the allocator
+	heapEndBlock  gcBlock        // the block just past the end of the main heap
+	externalBlock gcBlock        // the first block in external memory, which has its own metadata
 	endBlock      gcBlock        // the block just past the end of the available space
 )
 
@@ -96,6 +100,9 @@ type gcBlock uintptr
 // blockFromAddr returns a block given an address somewhere in the heap (which
 // might not be heap-aligned).
 func blockFromAddr(addr uintptr) gcBlock {
+	if hasHeapRegions && (addr < heapStart || addr >= uintptr(metadataStart)) {
+		return heapRegionBlockFromAddr(addr)
+	}
 	if gcAsserts && (addr < heapStart || addr >= uintptr(metadataStart)) {
 		runtimePanic("gc: trying to get block from invalid address")
 	}
@@ -109,6 +116,9 @@ func (b gcBlock) pointer() unsafe.Pointer {
 
 // Return the address of the start of the allocated object.
 func (b gcBlock) address() uintptr {
+	if hasHeapRegions && b >= heapEndBlock {
+		return heapRegionBlockAddress(b)
+	}
 	return heapStart + uintptr(b)*bytesPerBlock
 }
 
@@ -139,9 +149,18 @@ func (b gcBlock) findNext() gcBlock {
 	return b
 }
 
+// stateByte returns a pointer to the metadata byte that contains the state of
+// this block.
+func (b gcBlock) stateByte() *uint8 {
+	if hasHeapRegions && b >= externalBlock {
+		return heapRegionStateByte(b)
+	}
+	return (*uint8)(unsafe.Pointer(uintptr(metadataStart) + uintptr(b/blocksPerStateByte)))
+}
+
 // State returns the current block state.
 func (b gcBlock) state() blockState {
-	stateBytePtr := (*uint8)(unsafe.Pointer(uintptr(metadataStart) + uintptr(b/blocksPerStateByte)))
+	stateBytePtr := b.stateByte()
 	return blockState(*stateBytePtr>>((b%blocksPerStateByte)*2)) % 4
 }
 
@@ -149,7 +168,7 @@ func (b gcBlock) state() blockState {
 // bits than the current state. Allowed transitions: from free to any state and
 // from head to mark.
 func (b gcBlock) setState(newState blockState) {
-	stateBytePtr := (*uint8)(unsafe.Pointer(uintptr(metadataStart) + uintptr(b/blocksPerStateByte)))
+	stateBytePtr := b.stateByte()
 	*stateBytePtr |= uint8(newState << ((b % blocksPerStateByte) * 2))
 	if gcAsserts && b.state() != newState {
 		runtimePanic("gc: setState() was not successful")
@@ -158,7 +177,7 @@ func (b gcBlock) setState(newState blockState) {
 
 // markFree sets the block state to free, no matter what state it was in before.
 func (b gcBlock) markFree() {
-	stateBytePtr := (*uint8)(unsafe.Pointer(uintptr(metadataStart) + uintptr(b/blocksPerStateByte)))
+	stateBytePtr := b.stateByte()
 	*stateBytePtr &^= uint8(blockStateMask << ((b % blocksPerStateByte) * 2))
 	if gcAsserts && b.state() != blockStateFree {
 		runtimePanic("gc: markFree() was not successful")
@@ -172,7 +191,7 @@ func (b gcBlock) unmark() {
 		runtimePanic("gc: unmark() on a block that is not marked")
 	}
 	clearMask := blockStateMask ^ blockStateHead // the bits to clear from the state
-	stateBytePtr := (*uint8)(unsafe.Pointer(uintptr(metadataStart) + uintptr(b/blocksPerStateByte)))
+	stateBytePtr := b.stateByte()
 	*stateBytePtr &^= uint8(clearMask << ((b % blocksPerStateByte) * 2))
 	if gcAsserts && b.state() != blockStateHead {
 		runtimePanic("gc: unmark() was not successful")
@@ -230,13 +249,17 @@ func setHeapEnd(newHeapEnd uintptr) {
 func calculateHeapAddresses() {
 	totalSize := heapEnd - heapStart
 
-	// Allocate some memory to keep 2 bits of information about every block.
-	metadataSize := totalSize / (blocksPerStateByte * bytesPerBlock)
+	// Allocate some memory to keep 2 bits of information about every block,
+	// including the blocks of the extra heap regions.
+	regionBlocks := heapRegionBlocks()
+	metadataSize := (totalSize + regionBlocks*bytesPerBlock) / (blocksPerStateByte * bytesPerBlock)
 	metadataStart = unsafe.Pointer(heapEnd - metadataSize)
 
 	// Use the rest of the available memory as heap.
 	numBlocks := (uintptr(metadataStart) - heapStart) / bytesPerBlock
-	endBlock = gcBlock(numBlocks)
+	heapEndBlock = gcBlock(numBlocks)
+	endBlock = heapEndBlock + gcBlock(regionBlocks)
+	externalBlock = endBlock
 	if gcDebug {
 		println("heapStart:        ", heapStart)
 		println("heapEnd:          ", heapEnd)
@@ -244,57 +267,105 @@ func calculateHeapAddresses() {
 		println("metadata size:    ", metadataSize)
 		println("metadataStart:    ", metadataStart)
 		println("# of blocks:      ", numBlocks)
+		println("# of region blocks:", regionBlocks)
 		println("# of block states:", metadataSize*blocksPerStateByte)
 	}
-	if gcAsserts && metadataSize*blocksPerStateByte < numBlocks {
+	if gcAsserts && metadataSize*blocksPerStateByte < uintptr(endBlock) {
 		// sanity check
 		runtimePanic("gc: metadata array is too small")
 	}
 }
 
+// heapMemory selects the memory an allocation may be placed in, on targets
+// with external memory (see gc_heapregions.go).
+type heapMemory uint8
+
+const (
+	heapMemoryAny  heapMemory = iota // any heap region
+	heapMemoryFast                   // only on-chip RAM
+	heapMemorySlow                   // only external RAM, such as PSRAM or SDRAM
+)
+
 // alloc tries to find some free space on the heap, possibly doing a garbage
 // collection cycle if needed. If no space is free, it panics.
 //go:noinline
 func alloc(size uintptr) unsafe.Pointer {
+	return allocMemory(size, heapMemoryAny)
+}
+
+// allocMemory is like alloc, but it only uses the given kind of memory. For
+// memory other than heapMemoryAny, it returns nil instead of panicking when
+// there is no space.
+func allocMemory(size uintptr, memory heapMemory) unsafe.Pointer {
 	if size == 0 {
 		return unsafe.Pointer(&zeroSizedAlloc)
 	}
+	interruptCheck("heap allocation")
+	heapProfileAlloc(size)
+	allocTraceAlloc(size)
 
 	neededBlocks := (size + (bytesPerBlock - 1)) / bytesPerBlock
 
 	// Continue looping until a run of free blocks has been found that fits the
 	// requested size.
-	index := nextAlloc
-	numFreeBlocks := uintptr(0)
-	heapScanCount := uint8(0)
+	collected := false
 	for {
-		if index == nextAlloc {
-			if heapScanCount == 0 {
-				heapScanCount = 1
-			} else if heapScanCount == 1 {
+		thisAlloc, ok := findFreeBlocks(neededBlocks, memory)
+		if !ok {
+			if !collected {
 				// The entire heap has been searched for free memory, but none
 				// could be found. Run a garbage collection cycle to reclaim
 				// free memory and try again.
-				heapScanCount = 2
+				collected = true
 				GC()
-			} else {
+			} else if memory != heapMemorySlow && growHeap() {
 				// Even after garbage collection, no free memory could be found.
-				// Try to increase heap size.
-				if growHeap() {
-					// Success, the heap was increased in size. Try again with a
-					// larger heap.
-				} else {
-					// Unfortunately the heap could not be increased. This
-					// happens on baremetal systems for example (where all
-					// available RAM has already been dedicated to the heap).
-					runtimePanic("out of memory")
-				}
+				// The heap was increased in size, try again with a larger heap.
+			} else if memory != heapMemoryAny {
+				// The caller handles a failed allocation.
+				return nil
+			} else {
+				// Unfortunately the heap could not be increased. This
+				// happens on baremetal systems for example (where all
+				// available RAM has already been dedicated to the heap).
+				runtimePanic("out of memory")
 			}
+			continue
 		}
 
+		// Found a big enough range of free blocks!
+		if gcDebug {
+			println("found memory:", thisAlloc.pointer(), int(size))
+		}
+
+		// Set the following blocks as being allocated.
+		thisAlloc.setState(blockStateHead)
+		for i := thisAlloc + 1; i != thisAlloc+gcBlock(neededBlocks); i++ {
+			i.setState(blockStateTail)
+		}
+
+		gcStatsAlloc(neededBlocks * bytesPerBlock)
+
+		// Return a pointer to this allocation.
+		pointer := thisAlloc.pointer()
+		memzero(pointer, size)
+		return pointer
+	}
+}
+
+// findFreeBlocksIn looks for a run of free blocks that fits the requested
+// number of blocks in the blocks start..end, starting at the block in next and
+// wrapping around the end once. If it finds one, it returns the first block and
+// updates next to point just past it.
+func findFreeBlocksIn(start, end gcBlock, next *gcBlock, neededBlocks uintptr) (gcBlock, bool) {
+	index := *next
+	numFreeBlocks := uintptr(0)
+	// Look at every block once, plus the blocks of a run that wraps around
+	// the starting point.
+	for n := uintptr(end-start) + neededBlocks - 1; n != 0; n-- {
 		// Wrap around the end of the heap.
-		if index == endBlock {
-			index = 0
+		if index >= end || index < start {
+			index = start
 			// Reset numFreeBlocks as allocations cannot wrap.
 			numFreeBlocks = 0
 		}
@@ -311,25 +382,11 @@ func alloc(size uintptr) unsafe.Pointer {
 
 		// Are we finished?
 		if numFreeBlocks == neededBlocks {
-			// Found a big enough range of free blocks!
-			nextAlloc = index
-			thisAlloc := index - gcBlock(neededBlocks)
-			if gcDebug {
-				println("found memory:", thisAlloc.pointer(), int(size))
-			}
-
-			// Set the following blocks as being allocated.
-			thisAlloc.setState(blockStateHead)
-			for i := thisAlloc + 1; i != nextAlloc; i++ {
-				i.setState(blockStateTail)
-			}
-
-			// Return a pointer to this allocation.
-			pointer := thisAlloc.pointer()
-			memzero(pointer, size)
-			return pointer
+			*next = index
+			return index - gcBlock(neededBlocks), true
 		}
 	}
+	return 0, false
 }
 
 func free(ptr unsafe.Pointer) {
@@ -341,6 +398,8 @@ func GC() {
 	if gcDebug {
 		println("running collection cycle...")
 	}
+	traceRecord(traceEvGCStart, nil)
+	start := ticks()
 
 	// Mark phase: mark all reachable objects, recursively.
 	markStack()
@@ -379,7 +438,9 @@ func GC() {
 
 	// Sweep phase: free all non-marked objects and unmark marked objects for
 	// the next collection cycle.
-	sweep()
+	live := sweep()
+	gcStatsCycle(start, live)
+	traceRecord(traceEvGCDone, nil)
 
 	// Show how much has been sweeped, for debugging.
 	if gcDebug {
@@ -426,7 +487,10 @@ func startMark(root gcBlock) {
 		}
 
 		// Scan all pointers inside the block.
-		start, end := block.address(), block.findNext().address()
+		// An object never crosses the end of a heap region, but the next
+		// block may be in another region: calculate the end from the size.
+		start := block.address()
+		end := start + uintptr(block.findNext()-block)*bytesPerBlock
 		for addr := start; addr != end; addr += unsafe.Alignof(addr) {
 			// Load the word.
 			word := *(*uintptr)(unsafe.Pointer(addr))
@@ -516,9 +580,11 @@ func markRoot(addr, root uintptr) {
 	}
 }
 
-// Sweep goes through all memory and frees unmarked memory.
-func sweep() {
+// Sweep goes through all memory and frees unmarked memory. It returns the
+// number of bytes that are still allocated.
+func sweep() uintptr {
 	freeCurrentObject := false
+	liveBlocks := uintptr(0)
 	for block := gcBlock(0); block < endBlock; block++ {
 		switch block.state() {
 		case blockStateHead:
@@ -530,6 +596,8 @@ func sweep() {
 				// This is a tail object following an unmarked head.
 				// Free it now.
 				block.markFree()
+			} else {
+				liveBlocks++
 			}
 		case blockStateMark:
 			// This is a marked object. The next tail blocks must not be freed,
@@ -537,14 +605,19 @@ func sweep() {
 			// collect this object if it is unreferenced then.
 			block.unmark()
 			freeCurrentObject = false
+			liveBlocks++
 		}
 	}
+	return liveBlocks * bytesPerBlock
 }
 
 // looksLikePointer returns whether this could be a pointer. Currently, it
 // simply returns whether it lies anywhere in the heap. Go allows interior
 // pointers so we can't check alignment or anything like that.
 func looksLikePointer(ptr uintptr) bool {
+	if hasHeapRegions && (ptr < heapStart || ptr >= uintptr(metadataStart)) {
+		return heapRegionContains(ptr)
+	}
 	return ptr >= heapStart && ptr < uintptr(metadataStart)
 }
 
@@ -443,6 +443,8 @@ func GC() {
 		}
 		gcrunning = true
 	}
+	traceRecord(traceEvGCStart, nil)
+	start := ticks()
 
 	if gcDebug {
 		println("pre-GC allocations:")
@@ -507,6 +509,8 @@ runqueueScan:
 		allocations.insert(activeMem.pop())
 	}
 
+	gcStatsCycle(start, usedMem)
+	traceRecord(traceEvGCDone, nil)
 	if gcDebug {
 		println("GC finished")
 	}
@@ -531,6 +535,9 @@ func alloc(size uintptr) unsafe.Pointer {
 	if size == 0 {
 		return unsafe.Pointer(&zeroSizedAlloc)
 	}
+	interruptCheck("heap allocation")
+	heapProfileAlloc(size)
+	allocTraceAlloc(size)
 
 	if gcAsserts && gcrunning {
 		runtimePanic("allocated inside the garbage collector")
@@ -620,6 +627,7 @@ func alloc(size uintptr) unsafe.Pointer {
 
 		// Update used memory.
 		usedMem += allocSize
+		gcStatsAlloc(allocSize)
 
 		if gcDebug {
 			println("allocated:", uintptr(ptr), "size:", size)
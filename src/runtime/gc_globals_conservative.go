@@ -1,5 +1,5 @@
 // +build gc.conservative gc.extalloc
-// +build baremetal wasm
+// +build baremetal,!zephyr,!freertos,!customos wasm
 
 package runtime
 
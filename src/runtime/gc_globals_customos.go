@@ -0,0 +1,18 @@
+// +build gc.conservative gc.extalloc
+// +build customos
+
+package runtime
+
+//export tinygo_os_globals_start
+func os_globals_start() uintptr
+
+//export tinygo_os_globals_end
+func os_globals_end() uintptr
+
+// markGlobals marks all globals, which are reachable by definition.
+//
+// The OS backend provides the memory range with the globals, which may include
+// the globals of the OS itself.
+func markGlobals() {
+	markRoots(os_globals_start(), os_globals_end())
+}
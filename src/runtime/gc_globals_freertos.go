@@ -0,0 +1,19 @@
+// +build gc.conservative gc.extalloc
+// +build freertos
+
+package runtime
+
+// The start and end of the .data and .bss sections of the FreeRTOS
+// application, provided by targets/freertos.c.
+//go:extern tinygo_freertos_globals
+var freertosGlobals [4]uintptr
+
+// markGlobals marks all globals, which are reachable by definition.
+//
+// The globals of the Go program are part of the .data and .bss sections of the
+// application, which are not next to each other. This marks both sections
+// conservatively, including the globals of FreeRTOS and the vendor SDK.
+func markGlobals() {
+	markRoots(freertosGlobals[0], freertosGlobals[1])
+	markRoots(freertosGlobals[2], freertosGlobals[3])
+}
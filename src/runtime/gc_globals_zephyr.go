@@ -0,0 +1,30 @@
+// +build gc.conservative gc.extalloc
+// +build zephyr
+
+package runtime
+
+import (
+	"unsafe"
+)
+
+//go:extern __data_region_start
+var dataStartSymbol [0]byte
+
+//go:extern __data_region_end
+var dataEndSymbol [0]byte
+
+//go:extern __bss_start
+var bssStartSymbol [0]byte
+
+//go:extern __bss_end
+var bssEndSymbol [0]byte
+
+// markGlobals marks all globals, which are reachable by definition.
+//
+// The globals of the Go program are part of the .data and .bss sections of the
+// Zephyr image, which are not next to each other. This marks both sections
+// conservatively, including the globals of Zephyr itself.
+func markGlobals() {
+	markRoots(uintptr(unsafe.Pointer(&dataStartSymbol)), uintptr(unsafe.Pointer(&dataEndSymbol)))
+	markRoots(uintptr(unsafe.Pointer(&bssStartSymbol)), uintptr(unsafe.Pointer(&bssEndSymbol)))
+}
@@ -0,0 +1,228 @@
+// +build gc.conservative,heapregions
+
+package runtime
+
+// Extra heap regions, for chips with RAM that is not part of the main RAM
+// region, such as the CCM RAM of the STM32F4. The regions are declared in the
+// target specification (see compileopts.TargetSpec.HeapRegionLayout).
+//
+// The blocks of the extra regions are numbered after the blocks of the main
+// heap, so that the block metadata and the mark and sweep phases don't need to
+// know about regions. Only the allocator does: it searches the regions in
+// priority order, and an allocation never crosses the end of a region.
+//
+// External memory (such as PSRAM or SDRAM) is different: it can only be used
+// after the program has initialized the memory controller, so these regions
+// are added to the heap by runtime/extmem.Init. Their blocks are numbered after
+// all other blocks, and their metadata is stored at the end of the region
+// itself instead of in the (much smaller) on-chip RAM.
+
+import (
+	"unsafe"
+)
+
+const hasHeapRegions = true
+
+// maxHeapRegions is the maximum number of extra heap regions. It must match
+// the limit in the compiler.
+const maxHeapRegions = 8
+
+// This global is set by the linker (see compileopts.Config.GlobalValues). It is
+// a NUL separated list of the heap regions in allocation order, where every
+// region is either "heap" for the main heap or a start-end address range,
+// prefixed with "ext:" for external memory.
+var heapRegions string
+
+type heapRegion struct {
+	start, end uintptr // address range, aligned to whole blocks (zero for the main heap)
+	blocks     gcBlock // number of blocks in use by the heap
+	firstBlock gcBlock // number of the first block, relative to heapEndBlock
+	next       gcBlock // the next block that should be tried by the allocator
+	external   bool    // whether this region is in external memory
+	metadata   uintptr // external memory: the block states, offset by the first block
+}
+
+var (
+	heapRegionList  [maxHeapRegions + 1]heapRegion // the main heap and the extra regions
+	numHeapRegions  int
+	heapRegionsRead bool
+)
+
+// heapRegionBlocks reads the list of heap regions, if it hasn't been read yet,
+// and returns the number of blocks in the extra heap regions that are not in
+// external memory. It is called before the heap is initialized, so it must
+// not allocate.
+func heapRegionBlocks() uintptr {
+	if !heapRegionsRead {
+		heapRegionsRead = true
+		firstBlock := gcBlock(0)
+		start := 0
+		for i := 0; i <= len(heapRegions); i++ {
+			if i < len(heapRegions) && heapRegions[i] != 0 {
+				continue
+			}
+			region := parseHeapRegion(heapRegions[start:i])
+			start = i + 1
+			if region.start != 0 && !region.external {
+				region.blocks = gcBlock((region.end - region.start) / bytesPerBlock)
+				region.firstBlock = firstBlock
+				firstBlock += region.blocks
+			}
+			heapRegionList[numHeapRegions] = region
+			numHeapRegions++
+		}
+	}
+	numBlocks := uintptr(0)
+	for i := 0; i < numHeapRegions; i++ {
+		region := &heapRegionList[i]
+		if !region.external {
+			numBlocks += uintptr(region.blocks)
+		}
+	}
+	return numBlocks
+}
+
+// parseHeapRegion parses a single entry of heapRegions, which has already been
+// validated by the compiler. The start and end of the region are aligned to
+// whole blocks.
+func parseHeapRegion(s string) heapRegion {
+	if s == "heap" {
+		return heapRegion{}
+	}
+	external := false
+	if len(s) > 4 && s[:4] == "ext:" {
+		external = true
+		s = s[4:]
+	}
+	dash := 0
+	for s[dash] != '-' {
+		dash++
+	}
+	start := parseAddress(s[:dash])
+	end := parseAddress(s[dash+1:])
+	start = (start + bytesPerBlock - 1) &^ (bytesPerBlock - 1)
+	end &^= bytesPerBlock - 1
+	if end < start {
+		end = start
+	}
+	return heapRegion{start: start, end: end, external: external}
+}
+
+// enableExternalHeapRegions adds the external memory regions to the heap, which
+// must be accessible by now. It returns the number of bytes added to the heap.
+func enableExternalHeapRegions() uintptr {
+	size := uintptr(0)
+	for i := 0; i < numHeapRegions; i++ {
+		region := &heapRegionList[i]
+		if !region.external || region.blocks != 0 {
+			continue
+		}
+
+		// Reserve space for the block states at the end of the region. Some
+		// space is wasted by calculating the metadata size from all blocks in
+		// the region, but it's at most a block or two.
+		first := endBlock
+		numBlocks := (region.end - region.start) / bytesPerBlock
+		metadataSize := (uintptr(first)%blocksPerStateByte + numBlocks + blocksPerStateByte - 1) / blocksPerStateByte
+		numBlocks -= (metadataSize + bytesPerBlock - 1) / bytesPerBlock
+		if numBlocks == 0 {
+			continue
+		}
+		metadataStart := region.start + numBlocks*bytesPerBlock
+		memzero(unsafe.Pointer(metadataStart), metadataSize)
+
+		// The state of a block is found by adding its block number to the
+		// metadata pointer, like for the main heap.
+		region.metadata = metadataStart - uintptr(first)/blocksPerStateByte
+		region.firstBlock = first - heapEndBlock
+		region.blocks = gcBlock(numBlocks)
+		endBlock = first + gcBlock(numBlocks)
+		size += numBlocks * bytesPerBlock
+	}
+	return size
+}
+
+// heapRegionStateByte returns a pointer to the metadata byte that contains the
+// state of a block in external memory.
+func heapRegionStateByte(b gcBlock) *uint8 {
+	offset := b - heapEndBlock
+	for i := 0; i < numHeapRegions; i++ {
+		region := &heapRegionList[i]
+		if region.external && offset >= region.firstBlock && offset < region.firstBlock+region.blocks {
+			return (*uint8)(unsafe.Pointer(region.metadata + uintptr(b/blocksPerStateByte)))
+		}
+	}
+	if gcAsserts {
+		runtimePanic("gc: block is not part of a heap region")
+	}
+	return nil
+}
+
+// findFreeBlocks looks for a run of free blocks that fits the requested number
+// of blocks, trying the heap regions in priority order.
+func findFreeBlocks(neededBlocks uintptr, memory heapMemory) (gcBlock, bool) {
+	for i := 0; i < numHeapRegions; i++ {
+		region := &heapRegionList[i]
+		if (memory == heapMemoryFast && region.external) || (memory == heapMemorySlow && !region.external) {
+			continue
+		}
+		if region.start == 0 {
+			if block, ok := findFreeBlocksIn(0, heapEndBlock, &nextAlloc, neededBlocks); ok {
+				return block, true
+			}
+			continue
+		}
+		if region.blocks == 0 {
+			// External memory that hasn't been added to the heap yet.
+			continue
+		}
+		start := heapEndBlock + region.firstBlock
+		if block, ok := findFreeBlocksIn(start, start+region.blocks, &region.next, neededBlocks); ok {
+			return block, true
+		}
+	}
+	return 0, false
+}
+
+// heapRegionBlockFromAddr returns the block that contains the given address,
+// which is outside of the main heap.
+func heapRegionBlockFromAddr(addr uintptr) gcBlock {
+	for i := 0; i < numHeapRegions; i++ {
+		region := &heapRegionList[i]
+		if addr >= region.start && addr < region.start+uintptr(region.blocks)*bytesPerBlock {
+			return heapEndBlock + region.firstBlock + gcBlock((addr-region.start)/bytesPerBlock)
+		}
+	}
+	if gcAsserts {
+		runtimePanic("gc: trying to get block from invalid address")
+	}
+	return 0
+}
+
+// heapRegionBlockAddress returns the address of a block that is not part of
+// the main heap.
+func heapRegionBlockAddress(b gcBlock) uintptr {
+	offset := b - heapEndBlock
+	for i := 0; i < numHeapRegions; i++ {
+		region := &heapRegionList[i]
+		if region.blocks != 0 && offset >= region.firstBlock && offset < region.firstBlock+region.blocks {
+			return region.start + uintptr(offset-region.firstBlock)*bytesPerBlock
+		}
+	}
+	if gcAsserts {
+		runtimePanic("gc: block is not part of a heap region")
+	}
+	return 0
+}
+
+// heapRegionContains returns whether the given address is part of one of the
+// extra heap regions.
+func heapRegionContains(ptr uintptr) bool {
+	for i := 0; i < numHeapRegions; i++ {
+		region := &heapRegionList[i]
+		if ptr >= region.start && ptr < region.start+uintptr(region.blocks)*bytesPerBlock {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+// +build gc.conservative,!heapregions
+
+package runtime
+
+// Stubs for targets without extra heap regions: the heap is a single region.
+
+const hasHeapRegions = false
+
+func heapRegionBlocks() uintptr {
+	return 0
+}
+
+func enableExternalHeapRegions() uintptr {
+	return 0
+}
+
+func heapRegionStateByte(b gcBlock) *uint8 {
+	return nil
+}
+
+func findFreeBlocks(neededBlocks uintptr, memory heapMemory) (gcBlock, bool) {
+	if memory == heapMemorySlow {
+		// There is no external memory.
+		return 0, false
+	}
+	return findFreeBlocksIn(0, endBlock, &nextAlloc, neededBlocks)
+}
+
+func heapRegionBlockFromAddr(addr uintptr) gcBlock {
+	return 0
+}
+
+func heapRegionBlockAddress(b gcBlock) uintptr {
+	return 0
+}
+
+func heapRegionContains(ptr uintptr) bool {
+	return false
+}
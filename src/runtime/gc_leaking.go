@@ -14,10 +14,14 @@ import (
 var heapptr = heapStart
 
 func alloc(size uintptr) unsafe.Pointer {
+	interruptCheck("heap allocation")
+	heapProfileAlloc(size)
+	allocTraceAlloc(size)
 	// TODO: this can be optimized by not casting between pointers and ints so
 	// much. And by using platform-native data types (e.g. *uint8 for 8-bit
 	// systems).
 	size = align(size)
+	gcStatsAlloc(size)
 	addr := heapptr
 	heapptr += size
 	for heapptr >= heapEnd {
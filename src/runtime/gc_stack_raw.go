@@ -11,6 +11,12 @@ import "internal/task"
 // the linker) and getting the current stack pointer from a register. Also, it
 // assumes a descending stack. Thus, it is not very portable.
 func markStack() {
+	if isSharedLibrary {
+		// The shared library may be called from any thread of the host
+		// program, so find the stack of the thread that is running now.
+		stackTop = threadStackTop()
+	}
+
 	// Scan the current stack, and all current registers.
 	scanCurrentStack()
 
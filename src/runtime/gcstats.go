@@ -0,0 +1,62 @@
+package runtime
+
+// This file keeps a few counters about the heap and the garbage collector, so
+// that programs can report memory health (see runtime/debug.ReadHeapStats)
+// without full runtime.ReadMemStats support. The counters are cheap enough to
+// be always kept up to date by the allocator and the garbage collector.
+
+var (
+	gcCount      uint32   // number of completed GC cycles
+	gcPauseTotal timeUnit // total time spent in GC cycles
+	gcLastPause  timeUnit // time spent in the last GC cycle
+	gcInUse      uintptr  // heap bytes currently allocated, including garbage
+	gcLiveBytes  uintptr  // heap bytes still allocated after the last GC cycle
+	gcPeakBytes  uintptr  // highest value of gcInUse
+	gcTraceEvery uint32   // print statistics after every gcTraceEvery GC cycles (0: never)
+)
+
+// gcStatsAlloc records an allocation of the given number of bytes (including
+// any overhead of the allocator).
+func gcStatsAlloc(size uintptr) {
+	gcInUse += size
+	if gcInUse > gcPeakBytes {
+		gcPeakBytes = gcInUse
+	}
+}
+
+// gcStatsCycle records a completed GC cycle that started at the given time,
+// after which the given number of heap bytes are still allocated.
+func gcStatsCycle(start timeUnit, live uintptr) {
+	gcLastPause = ticks() - start
+	gcPauseTotal += gcLastPause
+	gcCount++
+	gcInUse = live
+	gcLiveBytes = live
+	if gcTraceEvery != 0 && gcCount%gcTraceEvery == 0 {
+		printstring("gc ")
+		printuint32(gcCount)
+		printstring(": ")
+		printint64(ticksToNanoseconds(gcLastPause) / 1000)
+		printstring(" us, ")
+		printuint32(uint32(gcLiveBytes))
+		printstring(" B live, ")
+		printuint32(uint32(gcPeakBytes))
+		printstring(" B peak")
+		printnl()
+	}
+}
+
+// debug_readHeapStats returns the GC and heap counters.
+//go:linkname debug_readHeapStats runtime/debug.runtime_readHeapStats
+func debug_readHeapStats() (numGC uint32, pauseTotal, lastPause int64, inUse, live, peak uintptr) {
+	return gcCount, ticksToNanoseconds(gcPauseTotal), ticksToNanoseconds(gcLastPause), gcInUse, gcLiveBytes, gcPeakBytes
+}
+
+// debug_setGCTrace sets the number of GC cycles after which the counters are
+// printed, and returns the previous value.
+//go:linkname debug_setGCTrace runtime/debug.runtime_setGCTrace
+func debug_setGCTrace(every uint32) uint32 {
+	previous := gcTraceEvery
+	gcTraceEvery = every
+	return previous
+}
@@ -0,0 +1,43 @@
+// +build heapprofile
+
+package runtime
+
+// Heap profiling support (-heapprofile). Every allocation is counted in the
+// record of its allocation site (see allocsite.go). The compiler sets
+// heapProfileRecords to an array with a record for each allocation site in the
+// program.
+
+type heapProfileRecord struct {
+	allocObjects uintptr
+	allocBytes   uintptr
+}
+
+var heapProfileRecords []heapProfileRecord
+
+// heapProfileAlloc records an allocation of the given size at the current
+// allocation site. It is called from the allocator.
+func heapProfileAlloc(size uintptr) {
+	if heapProfileSite < uintptr(len(heapProfileRecords)) {
+		record := &heapProfileRecords[heapProfileSite]
+		record.allocObjects++
+		record.allocBytes += size
+	}
+}
+
+//go:linkname pprof_heapProfileEnabled runtime/pprof.runtime_heapProfileEnabled
+func pprof_heapProfileEnabled() bool {
+	return true
+}
+
+// pprof_heapProfileRecord returns the description and the number of allocated
+// objects and bytes of the allocation site with the given index. The last
+// return value is false if there is no such site.
+//go:linkname pprof_heapProfileRecord runtime/pprof.runtime_heapProfileRecord
+func pprof_heapProfileRecord(index int) (function, file string, line int, objects, bytes uintptr, ok bool) {
+	if index < 0 || index >= len(heapProfileRecords) {
+		return
+	}
+	function, file, line, ok = allocSite(uintptr(index))
+	record := heapProfileRecords[index]
+	return function, file, line, record.allocObjects, record.allocBytes, ok
+}
@@ -0,0 +1,19 @@
+// +build !heapprofile
+
+package runtime
+
+// Heap profiling is disabled: build with -heapprofile to enable it.
+
+//go:inline
+func heapProfileAlloc(size uintptr) {
+}
+
+//go:linkname pprof_heapProfileEnabled runtime/pprof.runtime_heapProfileEnabled
+func pprof_heapProfileEnabled() bool {
+	return false
+}
+
+//go:linkname pprof_heapProfileRecord runtime/pprof.runtime_heapProfileRecord
+func pprof_heapProfileRecord(index int) (function, file string, line int, objects, bytes uintptr, ok bool) {
+	return
+}
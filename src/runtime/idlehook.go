@@ -0,0 +1,40 @@
+package runtime
+
+var idleHook func(timeout int64) bool
+
+// SetIdleHook sets a function that is called by the scheduler every time no
+// goroutine is runnable, before it waits for the next timer or interrupt. The
+// timeout is the time in nanoseconds until the next sleeping goroutine should
+// wake up, or -1 if there is none (so only an interrupt can make a goroutine
+// runnable again).
+//
+// If the hook returns false, the scheduler waits as usual (for example with
+// the wfi instruction on Cortex-M). If it returns true, the scheduler doesn't
+// wait but checks for runnable goroutines right away, and calls the hook again
+// if there still are none. This way the hook can replace the wait: it can put
+// the chip in a different sleep mode, or poll a peripheral. It can also be used
+// to observe idle time, for example by toggling a debug pin.
+//
+// The hook doesn't run in a goroutine, so it must not block: it must not sleep,
+// use channels or lock a mutex. It should be short and not allocate memory, to
+// keep the latency of waking goroutines low. The hook is not called with
+// -scheduler=none (where there is no scheduler) or on WebAssembly (where the
+// scheduler returns to the JavaScript event loop instead).
+//
+// A nil hook removes the hook.
+func SetIdleHook(hook func(timeout int64) bool) {
+	idleHook = hook
+}
+
+// callIdleHook calls the hook set with SetIdleHook, if there is one, and
+// returns whether the scheduler should skip waiting. The time left until the
+// first sleeping goroutine wakes up is only used if sleeping is set.
+func callIdleHook(sleeping bool, timeLeft timeUnit) bool {
+	if idleHook == nil || asyncScheduler {
+		return false
+	}
+	if !sleeping {
+		return idleHook(-1)
+	}
+	return idleHook(ticksToNanoseconds(timeLeft))
+}
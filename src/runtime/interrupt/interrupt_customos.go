@@ -0,0 +1,36 @@
+// +build customos
+
+package interrupt
+
+// State represents the previous global interrupt state.
+type State uintptr
+
+//export tinygo_os_disable_interrupts
+func disableInterrupts() uintptr
+
+//export tinygo_os_restore_interrupts
+func restoreInterrupts(state uintptr)
+
+// Disable disables all interrupts and returns the previous interrupt state. It
+// can be used in a critical section like this:
+//
+//     state := interrupt.Disable()
+//     // critical section
+//     interrupt.Restore(state)
+//
+// Critical sections can be nested. Make sure to call Restore in the same order
+// as you called Disable (this happens naturally with the pattern above).
+//
+// How interrupts are disabled is up to the OS backend, which may also prevent
+// the OS from switching to another thread.
+func Disable() (state State) {
+	return State(disableInterrupts())
+}
+
+// Restore restores interrupts to what they were before. Give the previous state
+// returned by Disable as a parameter. If interrupts were disabled before
+// calling Disable, this will not re-enable interrupts, allowing for nested
+// critical sections.
+func Restore(state State) {
+	restoreInterrupts(uintptr(state))
+}
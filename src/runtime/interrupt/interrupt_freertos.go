@@ -0,0 +1,39 @@
+// +build freertos
+
+package interrupt
+
+// State represents the previous global interrupt state.
+type State uintptr
+
+//export tinygo_freertos_disable_interrupts
+func disableInterrupts() uintptr
+
+//export tinygo_freertos_restore_interrupts
+func restoreInterrupts(state uintptr)
+
+// Disable disables all interrupts and returns the previous interrupt state. It
+// can be used in a critical section like this:
+//
+//     state := interrupt.Disable()
+//     // critical section
+//     interrupt.Restore(state)
+//
+// Critical sections can be nested. Make sure to call Restore in the same order
+// as you called Disable (this happens naturally with the pattern above).
+//
+// This masks interrupts in the way the FreeRTOS port does it, which also
+// prevents FreeRTOS from switching to another task. Only interrupts of the
+// current core are masked: on a dual-core chip like the ESP32, tasks and
+// interrupts on the other core keep running, so this doesn't protect data that
+// is also used from there.
+func Disable() (state State) {
+	return State(disableInterrupts())
+}
+
+// Restore restores interrupts to what they were before. Give the previous state
+// returned by Disable as a parameter. If interrupts were disabled before
+// calling Disable, this will not re-enable interrupts, allowing for nested
+// cricital sections.
+func Restore(state State) {
+	restoreInterrupts(uintptr(state))
+}
@@ -1,4 +1,4 @@
-// +build xtensa
+// +build xtensa,!freertos
 
 package interrupt
 
@@ -0,0 +1,36 @@
+// +build zephyr
+
+package interrupt
+
+// State represents the previous global interrupt state.
+type State uintptr
+
+//export tinygo_zephyr_irq_lock
+func irqLock() uint32
+
+//export tinygo_zephyr_irq_unlock
+func irqUnlock(key uint32)
+
+// Disable disables all interrupts and returns the previous interrupt state. It
+// can be used in a critical section like this:
+//
+//     state := interrupt.Disable()
+//     // critical section
+//     interrupt.Restore(state)
+//
+// Critical sections can be nested. Make sure to call Restore in the same order
+// as you called Disable (this happens naturally with the pattern above).
+//
+// This locks interrupts with irq_lock, which also prevents Zephyr from
+// switching to another thread.
+func Disable() (state State) {
+	return State(irqLock())
+}
+
+// Restore restores interrupts to what they were before. Give the previous state
+// returned by Disable as a parameter. If interrupts were disabled before
+// calling Disable, this will not re-enable interrupts, allowing for nested
+// cricital sections.
+func Restore(state State) {
+	irqUnlock(uint32(state))
+}
@@ -0,0 +1,33 @@
+package interrupt
+
+// SPSC marks a buffered channel as a single-producer single-consumer channel:
+// a channel that is only sent to from one goroutine or interrupt handler, and
+// only received from by one goroutine or interrupt handler. This is the usual
+// way to pass data from an interrupt handler to a goroutine:
+//
+//     var rx = make(chan byte, 64)
+//
+//     func init() {
+//         interrupt.SPSC(rx)
+//     }
+//
+//     func handleUART(interrupt.Interrupt) {
+//         select {
+//         case rx <- uart.Bus.DATA.Get():
+//         default: // buffer full, drop the byte
+//         }
+//     }
+//
+// Sends and receives on such a channel use a lock-free ring buffer and only
+// disable interrupts when a goroutine needs to be blocked or woken up, which
+// reduces the interrupt latency and the jitter of both sides.
+//
+// SPSC must be called before the channel is used. It panics if ch is not a
+// buffered channel or is not empty. Sending from more than one goroutine or
+// interrupt handler (or receiving from more than one) results in lost or
+// duplicated values.
+func SPSC(ch interface{}) {
+	chanSPSC(ch)
+}
+
+func chanSPSC(ch interface{}) // in package runtime
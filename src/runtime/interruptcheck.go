@@ -0,0 +1,72 @@
+// +build interruptcheck
+
+package runtime
+
+// This file implements -interruptcheck. The compiler calls
+// interruptCheckEnter and interruptCheckExit around every interrupt handler
+// created with runtime/interrupt.New, so that the runtime knows when it runs
+// inside an interrupt and which one. Operations that must not happen there
+// (they would lock up the device or corrupt the heap) then panic with the name
+// of the interrupt handler instead.
+//
+// Interrupt handlers that are not created with runtime/interrupt.New, such as
+// the ones in the runtime itself, are not checked.
+
+import "unsafe"
+
+// Interrupts that are more deeply nested than this are still counted, but
+// their name isn't stored.
+const interruptCheckMaxDepth = 8
+
+var (
+	interruptCheckDepth uintptr
+	interruptCheckNames [interruptCheckMaxDepth]*byte // NUL-terminated function names
+)
+
+// interruptCheckEnter is called by the compiler at the start of every interrupt
+// handler, with the name of the Go function that handles the interrupt.
+//export tinygo_isrcheck_enter
+func interruptCheckEnter(name *byte) {
+	// Increment the depth before storing the name, so that a nested interrupt
+	// that happens in between uses the next slot.
+	depth := interruptCheckDepth
+	interruptCheckDepth = depth + 1
+	if depth < interruptCheckMaxDepth {
+		interruptCheckNames[depth] = name
+	}
+}
+
+// interruptCheckExit is called by the compiler at the end of every interrupt
+// handler.
+//export tinygo_isrcheck_exit
+func interruptCheckExit() {
+	interruptCheckDepth--
+}
+
+// interruptCheck panics when called from an interrupt handler. The operation
+// describes what is not allowed in an interrupt, such as "heap allocation".
+// The message is printed without allocating, as allocating is one of the
+// operations that is checked.
+func interruptCheck(operation string) {
+	depth := interruptCheckDepth
+	if depth == 0 {
+		return
+	}
+	printstring("panic: runtime error: ")
+	printstring(operation)
+	printstring(" in interrupt handler ")
+	if depth > interruptCheckMaxDepth {
+		printstring("(unknown)")
+	} else {
+		name := interruptCheckNames[depth-1]
+		for *name != 0 {
+			putchar(*name)
+			name = (*byte)(unsafe.Pointer(uintptr(unsafe.Pointer(name)) + 1))
+		}
+	}
+	printnl()
+	printTraceback()
+	callPanicHandler(PanicInfo{Message: operation})
+	coreDumpOnPanic()
+	abort()
+}
@@ -0,0 +1,9 @@
+// +build !interruptcheck
+
+package runtime
+
+// Interrupt checks are disabled: build with -interruptcheck to enable them.
+
+//go:inline
+func interruptCheck(operation string) {
+}
@@ -0,0 +1,222 @@
+package ota
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+// This file implements the parts of the MCUboot image and trailer formats that
+// are needed to install an update. See:
+// https://docs.mcuboot.com/design.html
+
+var (
+	ErrInvalidImage     = errors.New("ota: slot does not contain a valid MCUboot image")
+	ErrImageHash        = errors.New("ota: hash of the image in the slot does not match")
+	ErrUnsupportedFlash = errors.New("ota: write block size of the flash is too large for MCUboot")
+	ErrUpgradePending   = errors.New("ota: an upgrade has already been requested")
+)
+
+const (
+	mcubootImageMagic   = 0x96f3b83d
+	mcubootTLVInfoMagic = 0x6907
+	mcubootTLVSHA256    = 0x10
+
+	// Layout of the trailer at the end of a slot, with the default maximum
+	// alignment of MCUboot (BOOT_MAX_ALIGN).
+	mcubootMaxAlign     = 8
+	mcubootMagicSize    = 16
+	mcubootFlagSet      = 0x01
+	mcubootSwapTypeTest = 2
+	mcubootSwapTypePerm = 3
+)
+
+// mcubootTrailerMagic marks a slot trailer as valid.
+var mcubootTrailerMagic = [mcubootMagicSize]byte{
+	0x77, 0xc2, 0x95, 0xf3,
+	0x60, 0xd2, 0xef, 0x7f,
+	0x35, 0x52, 0x50, 0x0f,
+	0x2c, 0xb6, 0x79, 0x80,
+}
+
+// MCUboot describes the slots of an MCUboot bootloader that uses two slots per
+// image, for example with the swap or overwrite upgrade strategies. The slots
+// must match the flash partitions the bootloader was built with.
+type MCUboot struct {
+	Flash     Flash
+	Primary   Slot // the slot the program runs from
+	Secondary Slot // the slot new images are written to
+}
+
+// NewUpdate starts writing a new image to the secondary slot. The image must be
+// created by tinygo build -mcuboot or imgtool.py, and can be at most as large
+// as the slot minus one erase block, which is reserved for the trailer that is
+// used by the bootloader during the upgrade.
+func (m *MCUboot) NewUpdate() (*Update, error) {
+	if m.Flash.WriteBlockSize() > mcubootMaxAlign {
+		return nil, ErrUnsupportedFlash
+	}
+	eraseSize := m.Flash.EraseBlockSize()
+	u, err := newUpdate(m.Flash, m.Secondary, m.Secondary.Size-eraseSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Erase the trailer first, so that a trailer of an earlier update can't
+	// make the bootloader install a partially written image.
+	err = m.Flash.EraseBlocks((m.Secondary.Offset+m.Secondary.Size)/eraseSize-1, 1)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Validate checks whether the secondary slot contains a complete MCUboot image
+// with a valid hash. The signature is not checked: the bootloader does that
+// before installing the image.
+func (m *MCUboot) Validate() error {
+	var header [32]byte
+	if _, err := m.Flash.ReadAt(header[:], m.Secondary.Offset); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(header[0:]) != mcubootImageMagic {
+		return ErrInvalidImage
+	}
+	headerSize := int64(binary.LittleEndian.Uint16(header[8:]))
+	protectedSize := int64(binary.LittleEndian.Uint16(header[10:]))
+	imageSize := int64(binary.LittleEndian.Uint32(header[12:]))
+
+	// The hash covers the header, the program and the protected TLVs.
+	hashedSize := headerSize + imageSize + protectedSize
+	if hashedSize+4 > m.Secondary.Size {
+		return ErrInvalidImage
+	}
+	hash := sha256.New()
+	var buf [256]byte
+	for offset := int64(0); offset < hashedSize; {
+		chunk := buf[:]
+		if hashedSize-offset < int64(len(chunk)) {
+			chunk = chunk[:hashedSize-offset]
+		}
+		if _, err := m.Flash.ReadAt(chunk, m.Secondary.Offset+offset); err != nil {
+			return err
+		}
+		hash.Write(chunk)
+		offset += int64(len(chunk))
+	}
+	expected, err := m.readHashTLV(m.Secondary.Offset + hashedSize)
+	if err != nil {
+		return err
+	}
+	if string(hash.Sum(nil)) != string(expected[:]) {
+		return ErrImageHash
+	}
+	return nil
+}
+
+// readHashTLV reads the SHA-256 hash from the (unprotected) TLVs at the given
+// offset in flash.
+func (m *MCUboot) readHashTLV(offset int64) (hash [sha256.Size]byte, err error) {
+	var tlv [4]byte
+	if _, err := m.Flash.ReadAt(tlv[:], offset); err != nil {
+		return hash, err
+	}
+	if binary.LittleEndian.Uint16(tlv[0:]) != mcubootTLVInfoMagic {
+		return hash, ErrInvalidImage
+	}
+	end := offset + int64(binary.LittleEndian.Uint16(tlv[2:]))
+	if end > m.Secondary.Offset+m.Secondary.Size {
+		return hash, ErrInvalidImage
+	}
+	for offset += 4; offset+4 <= end; {
+		if _, err := m.Flash.ReadAt(tlv[:], offset); err != nil {
+			return hash, err
+		}
+		length := int64(binary.LittleEndian.Uint16(tlv[2:]))
+		if tlv[0] == mcubootTLVSHA256 && length == sha256.Size {
+			_, err := m.Flash.ReadAt(hash[:], offset+4)
+			return hash, err
+		}
+		offset += 4 + length
+	}
+	return hash, ErrInvalidImage
+}
+
+// RequestUpgrade marks the image in the secondary slot for installation by the
+// bootloader on the next reboot. The image should be checked with Validate
+// first. If permanent is false, the bootloader reverts to the current image on
+// the reboot after that, unless the new image calls Confirm.
+func (m *MCUboot) RequestUpgrade(permanent bool) error {
+	ok, err := m.hasTrailerMagic(m.Secondary)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return ErrUpgradePending
+	}
+	if err := m.writeTrailer(m.Secondary, m.Secondary.Size-mcubootMagicSize, mcubootTrailerMagic[:]); err != nil {
+		return err
+	}
+	swapType := byte(mcubootSwapTypeTest)
+	if permanent {
+		if err := m.writeTrailer(m.Secondary, imageOKOffset(m.Secondary), []byte{mcubootFlagSet}); err != nil {
+			return err
+		}
+		swapType = mcubootSwapTypePerm
+	}
+	// The swap info also contains the image number (0) in the upper 4 bits.
+	return m.writeTrailer(m.Secondary, imageOKOffset(m.Secondary)-2*mcubootMaxAlign, []byte{swapType})
+}
+
+// Confirm marks the running image in the primary slot as working, so that the
+// bootloader doesn't revert to the previous image. It does nothing if the
+// image has already been confirmed, or if it was installed permanently.
+func (m *MCUboot) Confirm() error {
+	ok, err := m.hasTrailerMagic(m.Primary)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// The image was not installed by a test upgrade, for example because
+		// it was flashed directly.
+		return nil
+	}
+	var imageOK [1]byte
+	if _, err := m.Flash.ReadAt(imageOK[:], m.Primary.Offset+imageOKOffset(m.Primary)); err != nil {
+		return err
+	}
+	if imageOK[0] != 0xff {
+		return nil // already confirmed
+	}
+	return m.writeTrailer(m.Primary, imageOKOffset(m.Primary), []byte{mcubootFlagSet})
+}
+
+// imageOKOffset returns the offset of the image-ok flag in a slot.
+func imageOKOffset(slot Slot) int64 {
+	return slot.Size - mcubootMagicSize - mcubootMaxAlign
+}
+
+// hasTrailerMagic returns whether the trailer of the given slot is valid.
+func (m *MCUboot) hasTrailerMagic(slot Slot) (bool, error) {
+	var magic [mcubootMagicSize]byte
+	if _, err := m.Flash.ReadAt(magic[:], slot.Offset+slot.Size-mcubootMagicSize); err != nil {
+		return false, err
+	}
+	return magic == mcubootTrailerMagic, nil
+}
+
+// writeTrailer writes a field of the trailer of a slot, padded to the write
+// block size with 0xff (like MCUboot does).
+func (m *MCUboot) writeTrailer(slot Slot, offset int64, data []byte) error {
+	size := int64(len(data))
+	if blockSize := m.Flash.WriteBlockSize(); size < blockSize {
+		size = blockSize
+	}
+	buf := make([]byte, size)
+	for i := range buf {
+		buf[i] = 0xff
+	}
+	copy(buf, data)
+	_, err := m.Flash.WriteAt(buf, slot.Offset+offset)
+	return err
+}
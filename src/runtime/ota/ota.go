@@ -0,0 +1,143 @@
+// Package ota implements firmware updates over the air (or over any other
+// connection): a new image is written to the inactive slot in flash while the
+// program keeps running, and the bootloader installs it on the next reboot.
+//
+// The image is written with an Update, which erases the slot as it goes and
+// takes care of the alignment required by the flash. How the new image is
+// validated and installed depends on the bootloader. For MCUboot (see
+// tinygo build -mcuboot), the MCUboot type implements the whole sequence:
+//
+//     boot := &ota.MCUboot{Flash: machine.Flash, Primary: primary, Secondary: secondary}
+//     update, err := boot.NewUpdate()
+//     // write the image (as created by tinygo build -mcuboot) to update
+//     err = update.Close()
+//     err = boot.Validate()
+//     err = boot.RequestUpgrade(false)
+//     ota.Reboot()
+//
+// After the reboot, the new program must call Confirm once it works, otherwise
+// MCUboot reverts to the old image on the next reboot.
+//
+// The Flash interface is implemented by machine.Flash on chips that support
+// writing to their internal flash: currently the nRF series and the STM32F4,
+// including the second bank of the dual-bank STM32F42x/F43x. It can also be
+// implemented for external flash. The RP2040 is not supported yet, as there is
+// no machine package for it.
+package ota
+
+import (
+	"errors"
+	"runtime/flash"
+)
+
+var (
+	ErrSlotAlignment = errors.New("ota: slot is not aligned to the erase block size of the flash")
+	ErrImageTooLarge = errors.New("ota: image is too large for the slot")
+	ErrUpdateClosed  = errors.New("ota: write to closed update")
+)
+
+// Flash is the flash memory the image slots are stored in (see package
+// runtime/flash).
+type Flash = flash.Device
+
+// Slot is a region of flash that holds a firmware image.
+type Slot struct {
+	Offset int64 // start of the slot in flash
+	Size   int64 // size of the slot in bytes
+}
+
+// Update writes a new image to a slot. It implements io.WriteCloser: the data
+// that is written to it is stored in the slot, and Close writes the last
+// partial write block.
+type Update struct {
+	flash  Flash
+	slot   Slot
+	limit  int64  // maximum size of the image
+	offset int64  // number of bytes written to the slot
+	erased int64  // number of bytes erased at the start of the slot
+	buf    []byte // data that doesn't fill a whole write block yet
+	closed bool
+}
+
+// NewUpdate starts writing a new image to the given slot. The slot must be
+// aligned to the erase block size of the flash. The slot is erased while the
+// image is written, so the current contents are lost even if the update is
+// never finished.
+func NewUpdate(flash Flash, slot Slot) (*Update, error) {
+	return newUpdate(flash, slot, slot.Size)
+}
+
+func newUpdate(flash Flash, slot Slot, limit int64) (*Update, error) {
+	eraseSize := flash.EraseBlockSize()
+	if slot.Offset%eraseSize != 0 || slot.Size%eraseSize != 0 || slot.Offset+slot.Size > flash.Size() {
+		return nil, ErrSlotAlignment
+	}
+	return &Update{
+		flash: flash,
+		slot:  slot,
+		limit: limit,
+	}, nil
+}
+
+// Write writes the next part of the image to the slot.
+func (u *Update) Write(p []byte) (n int, err error) {
+	if u.closed {
+		return 0, ErrUpdateClosed
+	}
+	if u.offset+int64(len(u.buf))+int64(len(p)) > u.limit {
+		return 0, ErrImageTooLarge
+	}
+	u.buf = append(u.buf, p...)
+	blockSize := u.flash.WriteBlockSize()
+	size := int64(len(u.buf)) / blockSize * blockSize
+	if size == 0 {
+		return len(p), nil
+	}
+	if err := u.write(u.buf[:size]); err != nil {
+		return 0, err
+	}
+	n = copy(u.buf, u.buf[size:])
+	u.buf = u.buf[:n]
+	return len(p), nil
+}
+
+// Close finishes writing the image. The last write block is padded with 0xff,
+// the value of erased flash.
+func (u *Update) Close() error {
+	if u.closed {
+		return nil
+	}
+	u.closed = true
+	if len(u.buf) == 0 {
+		return nil
+	}
+	for int64(len(u.buf)) < u.flash.WriteBlockSize() {
+		u.buf = append(u.buf, 0xff)
+	}
+	err := u.write(u.buf)
+	u.buf = nil
+	return err
+}
+
+// Size returns the number of bytes of the image that have been written to
+// flash so far.
+func (u *Update) Size() int64 {
+	return u.offset
+}
+
+// write erases the flash as needed and writes the data, which is a multiple of
+// the write block size, after the data written so far.
+func (u *Update) write(data []byte) error {
+	eraseSize := u.flash.EraseBlockSize()
+	for u.erased < u.offset+int64(len(data)) {
+		if err := u.flash.EraseBlocks((u.slot.Offset+u.erased)/eraseSize, 1); err != nil {
+			return err
+		}
+		u.erased += eraseSize
+	}
+	if _, err := u.flash.WriteAt(data, u.slot.Offset+u.offset); err != nil {
+		return err
+	}
+	u.offset += int64(len(data))
+	return nil
+}
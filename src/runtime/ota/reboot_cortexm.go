@@ -0,0 +1,10 @@
+// +build cortexm
+
+package ota
+
+import "device/arm"
+
+// Reboot resets the chip, so that the bootloader can install the new image.
+func Reboot() {
+	arm.SystemReset()
+}
@@ -0,0 +1,9 @@
+// +build !cortexm
+
+package ota
+
+// Reboot resets the chip, so that the bootloader can install the new image.
+// It is only supported on Cortex-M targets.
+func Reboot() {
+	panic("ota: reboot is not supported on this target")
+}
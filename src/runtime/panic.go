@@ -10,6 +10,10 @@ func _panic(message interface{}) {
 	printstring("panic: ")
 	printitf(message)
 	printnl()
+	printErrorTrace(message)
+	printTraceback()
+	callPanicHandler(PanicInfo{Value: message})
+	coreDumpOnPanic()
 	abort()
 }
 
@@ -17,6 +21,9 @@ func _panic(message interface{}) {
 func runtimePanic(msg string) {
 	printstring("panic: runtime error: ")
 	println(msg)
+	printTraceback()
+	callPanicHandler(PanicInfo{Message: msg})
+	coreDumpOnPanic()
 	abort()
 }
 
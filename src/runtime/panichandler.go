@@ -0,0 +1,84 @@
+package runtime
+
+// PanicInfo describes a panic or a hardware fault, as passed to the handler
+// set with SetPanicHandler.
+type PanicInfo struct {
+	// Value is the value passed to panic. It is nil for run time errors and
+	// faults.
+	Value interface{}
+
+	// Message describes a run time error (such as "nil pointer dereference")
+	// or fault (such as "stack overflow"). It is empty for calls to panic.
+	Message string
+
+	// Fault indicates a hardware fault instead of a panic. Faults are only
+	// detected on Cortex-M.
+	Fault bool
+
+	// PC is the address of the instruction that caused a fault, or 0 if it is
+	// not known (or for panics).
+	PC uintptr
+}
+
+var (
+	panicHandler        func(*PanicInfo)
+	panicLogger         func(*PanicInfo) // set by runtime/crashlog
+	panicHandlerInfo    PanicInfo
+	panicHandlerRunning bool
+)
+
+// SetPanicHandler sets a function to call when the program panics or hits a
+// hardware fault. It is called after the panic has been printed and before the
+// default behavior, which is to halt (panics) or to reset the chip (faults).
+// If it returns, the default behavior continues. It can be used to log the
+// reason of a crash, to flush state, or to enter a safe mode by resetting the
+// chip in a different way.
+//
+// On Cortex-M, the handler runs on a small dedicated stack (see
+// PanicHandlerStackSize), so that it also works after a stack overflow. A
+// fault handler runs inside the fault exception, so interrupts are not
+// handled: it must not sleep, block or rely on interrupt driven I/O. As the
+// program may be in any state, the handler should not allocate memory either.
+// If the handler for a panic panics or faults itself, the handler is not called
+// again and the default behavior for the new panic or fault continues right
+// away. This is not possible for a fault in the handler of a
+// fault, as it happens inside the HardFault exception: the processor locks up
+// instead. Depending on the chip, it is then reset right away or it stays
+// locked up until it is reset (for example by a watchdog).
+//
+// A nil handler removes the handler.
+func SetPanicHandler(handler func(info *PanicInfo)) {
+	setPanicHandlerStack(handler != nil || panicLogger != nil)
+	panicHandler = handler
+}
+
+// crashlog_setPanicLogger sets a function that records a panic or fault in the
+// crash log. It runs like the handler set with SetPanicHandler, just before it.
+//go:linkname crashlog_setPanicLogger runtime/crashlog.runtime_setPanicLogger
+func crashlog_setPanicLogger(logger func(info *PanicInfo)) {
+	setPanicHandlerStack(logger != nil || panicHandler != nil)
+	panicLogger = logger
+}
+
+// callPanicHandler calls the crash logger and the handler set with
+// SetPanicHandler, if there are any and they are not already running.
+func callPanicHandler(info PanicInfo) {
+	if (panicHandler == nil && panicLogger == nil) || panicHandlerRunning {
+		return
+	}
+	panicHandlerRunning = true
+	panicHandlerInfo = info
+	runPanicHandlerOnStack()
+}
+
+// runPanicHandler is called by callPanicHandler, possibly on a different
+// stack.
+//export tinygo_runPanicHandler
+func runPanicHandler() {
+	if panicLogger != nil {
+		panicLogger(&panicHandlerInfo)
+	}
+	if panicHandler != nil {
+		panicHandler(&panicHandlerInfo)
+	}
+}
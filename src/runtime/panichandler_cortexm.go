@@ -0,0 +1,25 @@
+// +build cortexm
+
+package runtime
+
+import "unsafe"
+
+// PanicHandlerStackSize is the size in bytes of the stack the handler set with
+// SetPanicHandler runs on. It is allocated when the handler is set.
+const PanicHandlerStackSize = 1024
+
+var panicHandlerStack []uint64 // 8-byte aligned, as required by the ABI
+
+func setPanicHandlerStack(enable bool) {
+	if enable && panicHandlerStack == nil {
+		panicHandlerStack = make([]uint64, PanicHandlerStackSize/8)
+	}
+}
+
+func runPanicHandlerOnStack() {
+	top := uintptr(unsafe.Pointer(&panicHandlerStack[0])) + PanicHandlerStackSize
+	runPanicHandlerOnStackAsm(top)
+}
+
+//export tinygo_runPanicHandlerOnStack
+func runPanicHandlerOnStackAsm(sp uintptr)
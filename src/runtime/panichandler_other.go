@@ -0,0 +1,17 @@
+// +build !cortexm
+
+package runtime
+
+// PanicHandlerStackSize is the size in bytes of the stack the handler set with
+// SetPanicHandler runs on. It is 0 on this target, where the handler runs on
+// the stack of the code that panicked.
+const PanicHandlerStackSize = 0
+
+//go:inline
+func setPanicHandlerStack(enable bool) {
+}
+
+//go:inline
+func runPanicHandlerOnStack() {
+	runPanicHandler()
+}
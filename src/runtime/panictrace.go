@@ -0,0 +1,127 @@
+// +build panictrace
+
+package runtime
+
+// This file implements the call chain printed on a panic with -panic=trace.
+// There are no unwind tables on bare metal targets, so the stack is scanned
+// for values that look like return addresses: they point just after a call
+// instruction inside a known function. This may print a few stale frames, but
+// is usually good enough to see where a panic happened.
+//
+// The function names come from a symbol table that is added to the firmware
+// by the linker (see builder/symtab.go).
+
+import "unsafe"
+
+//go:extern tinygo_symtab
+var symtabSymbol [0]uint32
+
+const (
+	maxTraceFrames = 16  // maximum number of functions to print
+	maxTraceWords  = 512 // maximum number of stack words to scan
+)
+
+// printTraceback prints the functions in the call chain of the current
+// goroutine, innermost first.
+func printTraceback() {
+	table := unsafe.Pointer(&symtabSymbol)
+	count := *(*uint32)(table)
+	if count == 0 {
+		return
+	}
+	printstring("traceback:")
+	printnl()
+
+	const wordSize = unsafe.Sizeof(uintptr(0))
+	sp := getCurrentStackPointer() &^ (wordSize - 1)
+	end := stackTop
+	if sp >= stackTop {
+		// This is a goroutine stack, which is allocated on the heap.
+		end = heapEnd
+	}
+	frames := 0
+	for i := uintptr(0); i < maxTraceWords && frames < maxTraceFrames; i++ {
+		addr := sp + i*wordSize
+		if addr >= end {
+			break
+		}
+		pc, ok := tracebackPC(*(*uintptr)(unsafe.Pointer(addr)))
+		if !ok {
+			continue
+		}
+		entry := findSymbol(table, count, pc-1)
+		if entry == nil || !isCallSite(pc) {
+			continue
+		}
+		printstring("  ")
+		printSymbolName(table, entry[2])
+		printstring("+0x")
+		printhex(uint32(pc - uintptr(entry[0])))
+		printnl()
+		frames++
+	}
+}
+
+// printPCSymbol prints the function that contains pc and the offset into it,
+// as " (name+0x12)", if it is in the symbol table.
+func printPCSymbol(pc uintptr) {
+	table := unsafe.Pointer(&symtabSymbol)
+	count := *(*uint32)(table)
+	entry := findSymbol(table, count, pc-1)
+	if entry == nil {
+		return
+	}
+	printstring(" (")
+	printSymbolName(table, entry[2])
+	printstring("+0x")
+	printhex(uint32(pc - uintptr(entry[0])))
+	printstring(")")
+}
+
+// findSymbol returns the symbol table entry (address, size, name offset) of
+// the function that contains the given address, or nil if there is none.
+func findSymbol(table unsafe.Pointer, count uint32, addr uintptr) *[3]uint32 {
+	// Binary search over the entries, which are sorted by address.
+	low, high := uint32(0), count
+	for low < high {
+		mid := low + (high-low)/2
+		entry := (*[3]uint32)(unsafe.Pointer(uintptr(table) + 4 + uintptr(mid)*12))
+		if uintptr(entry[0]) > addr {
+			high = mid
+		} else if addr >= uintptr(entry[0])+uintptr(entry[1]) {
+			low = mid + 1
+		} else {
+			return entry
+		}
+	}
+	return nil
+}
+
+// printSymbolName prints the NUL-terminated name at the given offset in the
+// symbol table.
+func printSymbolName(table unsafe.Pointer, offset uint32) {
+	for p := uintptr(table) + uintptr(offset); ; p++ {
+		c := *(*byte)(unsafe.Pointer(p))
+		if c == 0 {
+			return
+		}
+		putchar(c)
+	}
+}
+
+// printhex prints the value in hexadecimal, without leading zeroes.
+func printhex(value uint32) {
+	started := false
+	for shift := 28; shift >= 0; shift -= 4 {
+		nibble := byte(value>>uint(shift)) & 0xf
+		if nibble == 0 && !started && shift != 0 {
+			continue
+		}
+		started = true
+		if nibble < 10 {
+			putchar(nibble + '0')
+		} else {
+			putchar(nibble - 10 + 'a')
+		}
+	}
+}
@@ -0,0 +1,27 @@
+// +build panictrace,cortexm
+
+package runtime
+
+import "unsafe"
+
+// tracebackPC returns the address of the instruction a value on the stack
+// would return to, if it looks like a return address. Return addresses of
+// Thumb code have the lowest bit set.
+func tracebackPC(value uintptr) (uintptr, bool) {
+	if value&1 == 0 || value < 4 {
+		return 0, false
+	}
+	return value &^ 1, true
+}
+
+// isCallSite returns whether the instruction before the given return address
+// is a call: a 32-bit BL or a 16-bit BLX with a register. It must only be
+// called for addresses inside a known function.
+func isCallSite(pc uintptr) bool {
+	last := *(*uint16)(unsafe.Pointer(pc - 2))
+	if last&0xff87 == 0x4780 {
+		return true // blx rm
+	}
+	first := *(*uint16)(unsafe.Pointer(pc - 4))
+	return first&0xf800 == 0xf000 && last&0xd000 == 0xd000 // bl label
+}
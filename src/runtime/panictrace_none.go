@@ -0,0 +1,13 @@
+// +build !panictrace
+
+package runtime
+
+// Tracebacks are disabled: build with -panic=trace to enable them.
+
+//go:inline
+func printTraceback() {
+}
+
+//go:inline
+func printPCSymbol(pc uintptr) {
+}
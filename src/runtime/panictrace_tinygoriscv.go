@@ -0,0 +1,30 @@
+// +build panictrace,tinygo.riscv
+
+package runtime
+
+import "unsafe"
+
+// tracebackPC returns the address of the instruction a value on the stack
+// would return to, if it looks like a return address. Instructions are at
+// least 16-bit aligned.
+func tracebackPC(value uintptr) (uintptr, bool) {
+	if value&1 != 0 || value < 4 {
+		return 0, false
+	}
+	return value, true
+}
+
+// isCallSite returns whether the instruction before the given return address
+// is a call that stores the return address in ra: jal or jalr, or the
+// compressed c.jalr. It must only be called for addresses inside a known
+// function.
+func isCallSite(pc uintptr) bool {
+	last := *(*uint16)(unsafe.Pointer(pc - 2))
+	if last&0xf07f == 0x9002 && last&0x0f80 != 0 {
+		return true // c.jalr rs1
+	}
+	insn := uint32(*(*uint16)(unsafe.Pointer(pc - 4))) | uint32(last)<<16
+	opcode := insn & 0x7f
+	rd := (insn >> 7) & 0x1f
+	return (opcode == 0x6f || opcode == 0x67) && rd == 1 // jal/jalr ra, ...
+}
@@ -1,16 +1,24 @@
+// Package pprof writes heap profiles in the format expected by the pprof
+// visualization tool.
+//
+// TinyGo does not support CPU profiling. Heap profiles are only available when
+// the program has been built with the -heapprofile flag, in which case every
+// heap allocation is attributed to its allocation site. Only allocations are
+// recorded (the alloc_objects and alloc_space sample types), not whether the
+// allocated objects are still in use.
 package pprof
 
-// TinyGo does not implement pprof. However, a dummy shell is needed for the
-// testing package (and testing/internal/pprof).
-
 import (
 	"errors"
 	"io"
+	"strconv"
 )
 
 var ErrUnimplemented = errors.New("runtime/pprof: unimplemented")
 
+// Profile is a collection of samples that can be written in the pprof format.
 type Profile struct {
+	name string
 }
 
 func StartCPUProfile(w io.Writer) error {
@@ -20,10 +28,106 @@ func StartCPUProfile(w io.Writer) error {
 func StopCPUProfile() {
 }
 
+// Lookup returns the profile with the given name, or nil if no such profile
+// exists. The "heap" and "allocs" profiles are both available when the program
+// has been built with -heapprofile.
 func Lookup(name string) *Profile {
+	switch name {
+	case "heap", "allocs":
+		if runtime_heapProfileEnabled() {
+			return &Profile{name: name}
+		}
+	}
 	return nil
 }
 
+// Name returns the name of this profile.
+func (p *Profile) Name() string {
+	return p.name
+}
+
+// WriteTo writes the profile to w. With debug set to 0, a profile in the
+// (uncompressed) protocol buffer format used by pprof is written. Otherwise, a
+// human readable list of allocation sites is written, which is more convenient
+// to read directly from a serial console.
 func (p *Profile) WriteTo(w io.Writer, debug int) error {
-	return ErrUnimplemented
+	if p == nil {
+		return ErrUnimplemented
+	}
+	sites := heapProfileSites()
+	if debug != 0 {
+		return writeHeapText(w, sites)
+	}
+	return writeHeapProto(w, sites)
+}
+
+// WriteHeapProfile writes a heap profile in the pprof format to w. It returns
+// ErrUnimplemented if the program has not been built with -heapprofile.
+func WriteHeapProfile(w io.Writer) error {
+	return Lookup("heap").WriteTo(w, 0)
+}
+
+// heapSite is a single allocation site with the number of allocations done at
+// this site.
+type heapSite struct {
+	function string
+	file     string
+	line     int
+	objects  uintptr
+	bytes    uintptr
 }
+
+// heapProfileSites returns all allocation sites that have been used at least
+// once.
+func heapProfileSites() []heapSite {
+	var sites []heapSite
+	for i := 0; ; i++ {
+		function, file, line, objects, bytes, ok := runtime_heapProfileRecord(i)
+		if !ok {
+			break
+		}
+		if objects == 0 {
+			continue
+		}
+		sites = append(sites, heapSite{function, file, line, objects, bytes})
+	}
+	return sites
+}
+
+// writeHeapText writes the allocation sites as text, sorted by the number of
+// allocated bytes (largest first).
+func writeHeapText(w io.Writer, sites []heapSite) error {
+	// Insertion sort, to avoid a dependency on the sort package.
+	for i := 1; i < len(sites); i++ {
+		for j := i; j > 0 && sites[j].bytes > sites[j-1].bytes; j-- {
+			sites[j], sites[j-1] = sites[j-1], sites[j]
+		}
+	}
+
+	var totalObjects, totalBytes uintptr
+	for _, site := range sites {
+		totalObjects += site.objects
+		totalBytes += site.bytes
+	}
+	buf := []byte("heap profile: " + strconv.FormatUint(uint64(totalObjects), 10) + " objects, " + strconv.FormatUint(uint64(totalBytes), 10) + " bytes allocated\n")
+	for _, site := range sites {
+		buf = append(buf, strconv.FormatUint(uint64(site.objects), 10)...)
+		buf = append(buf, '\t')
+		buf = append(buf, strconv.FormatUint(uint64(site.bytes), 10)...)
+		buf = append(buf, '\t')
+		buf = append(buf, site.function...)
+		if site.file != "" {
+			buf = append(buf, ' ')
+			buf = append(buf, site.file...)
+			buf = append(buf, ':')
+			buf = append(buf, strconv.Itoa(site.line)...)
+		}
+		buf = append(buf, '\n')
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func runtime_heapProfileEnabled() bool // in package runtime
+
+func runtime_heapProfileRecord(index int) (function, file string, line int, objects, bytes uintptr, ok bool) // in package runtime
@@ -0,0 +1,149 @@
+package pprof
+
+// This file writes heap profiles in the protocol buffer format described in
+// profile.proto of the pprof project. Only the fields needed for a heap profile
+// are written. The output is not gzip compressed, which pprof accepts as well.
+
+import (
+	"io"
+)
+
+// Field numbers of the Profile message and the messages it contains.
+const (
+	profileSampleType        = 1
+	profileSample            = 2
+	profileLocation          = 4
+	profileFunction          = 5
+	profileStringTable       = 6
+	profilePeriodType        = 11
+	profilePeriod            = 12
+	profileDefaultSampleType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+)
+
+// protoBuffer is a very small protocol buffer encoder.
+type protoBuffer struct {
+	data    []byte
+	strings []string
+	indices map[string]int64
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+// uint64 writes an integer field (wire type 0).
+func (b *protoBuffer) uint64(field int, x uint64) {
+	b.varint(uint64(field) << 3)
+	b.varint(x)
+}
+
+// int64 writes a signed integer field (wire type 0).
+func (b *protoBuffer) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+// bytes writes a length-delimited field (wire type 2).
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+// message writes an embedded message, which is created by calling fn on a
+// separate buffer that shares the string table.
+func (b *protoBuffer) message(field int, fn func(m *protoBuffer)) {
+	m := &protoBuffer{strings: b.strings, indices: b.indices}
+	fn(m)
+	b.strings = m.strings
+	b.bytes(field, m.data)
+}
+
+// stringIndex returns the index of the string in the string table, adding it
+// if needed.
+func (b *protoBuffer) stringIndex(s string) int64 {
+	if index, ok := b.indices[s]; ok {
+		return index
+	}
+	index := int64(len(b.strings))
+	b.strings = append(b.strings, s)
+	b.indices[s] = index
+	return index
+}
+
+// writeHeapProto writes a heap profile with the given allocation sites to w.
+// Every allocation site is written as a location with a single line.
+func writeHeapProto(w io.Writer, sites []heapSite) error {
+	b := &protoBuffer{
+		strings: []string{""}, // the first string must be the empty string
+		indices: map[string]int64{"": 0},
+	}
+	valueType := func(field int, typ, unit string) {
+		b.message(field, func(m *protoBuffer) {
+			m.int64(valueTypeType, m.stringIndex(typ))
+			m.int64(valueTypeUnit, m.stringIndex(unit))
+		})
+	}
+	valueType(profileSampleType, "alloc_objects", "count")
+	valueType(profileSampleType, "alloc_space", "bytes")
+
+	functionIDs := make(map[string]uint64)
+	for i, site := range sites {
+		locID := uint64(i + 1)
+		b.message(profileSample, func(m *protoBuffer) {
+			m.uint64(sampleLocationID, locID)
+			m.int64(sampleValue, int64(site.objects))
+			m.int64(sampleValue, int64(site.bytes))
+		})
+
+		fnID, ok := functionIDs[site.function]
+		if !ok {
+			fnID = uint64(len(functionIDs) + 1)
+			functionIDs[site.function] = fnID
+			b.message(profileFunction, func(m *protoBuffer) {
+				m.uint64(functionID, fnID)
+				m.int64(functionName, m.stringIndex(site.function))
+				m.int64(functionSystemName, m.stringIndex(site.function))
+				m.int64(functionFilename, m.stringIndex(site.file))
+			})
+		}
+		b.message(profileLocation, func(m *protoBuffer) {
+			m.uint64(locationID, locID)
+			m.message(locationLine, func(l *protoBuffer) {
+				l.uint64(lineFunctionID, fnID)
+				l.int64(lineLine, int64(site.line))
+			})
+		})
+	}
+
+	valueType(profilePeriodType, "space", "bytes")
+	b.int64(profilePeriod, 1)
+	b.int64(profileDefaultSampleType, b.stringIndex("alloc_space"))
+
+	// The string table must come last, as all strings have been added by now.
+	for _, s := range b.strings {
+		b.bytes(profileStringTable, []byte(s))
+	}
+	_, err := w.Write(b.data)
+	return err
+}
@@ -0,0 +1,9 @@
+// +build !darwin,!wasm nintendoswitch
+// +build !linux baremetal nintendoswitch
+// +build !freebsd baremetal nintendoswitch
+
+package runtime
+
+// printflush does nothing on these targets: either putchar doesn't buffer its
+// output, or (on the Nintendo Switch) it can only write whole lines.
+func printflush() {}
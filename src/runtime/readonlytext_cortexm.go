@@ -0,0 +1,87 @@
+// +build readonlytext,cortexm
+
+package runtime
+
+// This file implements -readonlytext: code and read-only data are made
+// read-only with the MPU at startup, so that a write through a corrupted
+// pointer faults right away instead of silently changing (or trying to change)
+// the program. Writes to flash are usually ignored or raise a bus fault much
+// later, if at all.
+//
+// Only the ARMv6-M and ARMv7-M MPU (PMSAv7) is supported. Without such an MPU,
+// nothing is changed.
+
+import (
+	"device/arm"
+	"unsafe"
+)
+
+//go:extern _text_start
+var textStartSymbol [0]byte
+
+//go:extern _text_end
+var textEndSymbol [0]byte
+
+// protectText configures MPU regions to cover the code and read-only data as
+// read-only memory, and enables the MPU. The rest of the memory map is left as
+// it is (the default memory map is used for privileged code).
+//
+// MPU regions are a power of two in size (at least 256 bytes) and aligned to
+// their size, so a single region usually covers much more than the program,
+// such as the rest of flash that may be written with machine.Flash later on.
+// Therefore, each region is split into its eight subregions, and only the
+// subregions that lie entirely within the code and read-only data are enabled.
+// Multiple regions are used to cover what is left at the end, up to the number
+// of regions of the MPU. A small part at the end may stay writable.
+func protectText() {
+	numRegions := (arm.MPU.TYPE.Get() & arm.MPU_TYPE_DREGION_Msk) >> arm.MPU_TYPE_DREGION_Pos
+	if numRegions == 0 {
+		return // no MPU
+	}
+	if (arm.SCB.MMFR[0].Get()>>4)&0xf == 4 {
+		return // PMSAv8 (ARMv8-M), which has a different register layout
+	}
+
+	start := uintptr(unsafe.Pointer(&textStartSymbol))
+	end := uintptr(unsafe.Pointer(&textEndSymbol))
+	for region := uint32(0); region < numRegions; region++ {
+		// Find the subregion size (1<<subBits): make the region big enough to
+		// reach the end, as long as start stays aligned to a subregion. The
+		// smallest region that can be split into subregions is 256 bytes.
+		subBits := uint32(5)
+		for start&^(1<<(subBits+3)-1)+1<<(subBits+3) < end && start&(1<<(subBits+1)-1) == 0 {
+			subBits++
+		}
+		base := start &^ (1<<(subBits+3) - 1)
+
+		// Disable all subregions that are not entirely within [start, end).
+		srd := uint32(0xff)
+		next := start
+		for i := uint32(0); i < 8; i++ {
+			subStart := base + uintptr(i)<<subBits
+			subEnd := subStart + 1<<subBits
+			if subStart >= start && subEnd <= end {
+				srd &^= 1 << i
+				next = subEnd
+			}
+		}
+		if srd == 0xff {
+			break // the rest is smaller than a subregion
+		}
+
+		arm.MPU.RNR.Set(region)
+		arm.MPU.RBAR.Set(uint32(base))
+		arm.MPU.RASR.Set(arm.MPU_RASR_AP_ReadOnly<<arm.MPU_RASR_AP_Pos |
+			arm.MPU_RASR_C_Msk | // normal memory, write-through (as is usual for flash)
+			srd<<arm.MPU_RASR_SRD_Pos |
+			(subBits+3-1)<<arm.MPU_RASR_SIZE_Pos |
+			arm.MPU_RASR_ENABLE_Msk)
+		start = next
+		if start >= end {
+			break
+		}
+	}
+	arm.MPU.CTRL.Set(arm.MPU_CTRL_PRIVDEFENA_Msk | arm.MPU_CTRL_ENABLE_Msk)
+	arm.Asm("dsb")
+	arm.Asm("isb")
+}
@@ -0,0 +1,9 @@
+// +build !readonlytext !cortexm
+
+package runtime
+
+// Code is not made read-only: build with -readonlytext to enable it.
+
+//go:inline
+func protectText() {
+}
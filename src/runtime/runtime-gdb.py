@@ -0,0 +1,176 @@
+# GDB extension for TinyGo programs that use -scheduler=tasks. It is loaded
+# automatically by tinygo gdb, and can be loaded by hand with:
+#
+#     source /path/to/tinygo/src/runtime/runtime-gdb.py
+#
+# It adds the following commands:
+#
+#     info goroutines          list all goroutines
+#     goroutine <n> <command>  run a command (such as bt) on goroutine n
+#
+# Goroutines are found through the internal/task.allTasks list, which is only
+# kept in programs built by tinygo gdb (or with -stackusage). A goroutine
+# that is not running has its callee-saved registers and its program counter
+# stored on its own stack, at the address in task.state.sp, in the layout of
+# the internal/task.calleeSavedRegs struct. To look at such a goroutine, the
+# registers are temporarily replaced with the saved ones.
+
+import gdb
+
+# Layout of calleeSavedRegs, for when it can't be read from the debug
+# information, one name per word. Words that are not restored (None) are
+# skipped. Keep in sync with src/internal/task/task_stack_*.go.
+fallbackLayouts = [
+    ('i386:x86-64', ['rbx', 'rbp', 'r12', 'r13', 'r14', 'r15', 'pc']),
+    ('i386', ['ebx', 'esi', 'edi', 'ebp', 'pc']),
+    ('aarch64', ['x19', 'x20', 'x21', 'x22', 'x23', 'x24', 'x25', 'x26', 'x27', 'x28', 'x29', 'pc']),
+    # The ARM layout starts with space for the VFP registers d8-d15.
+    ('arm', [None] * 16 + ['r4', 'r5', 'r6', 'r7', 'r8', 'r9', 'r10', 'r11', 'pc']),
+]
+
+# Functions that are part of blocking and scheduling, skipped when looking for
+# the place where a goroutine is blocked.
+runtimePrefixes = ('runtime.', 'internal/task.', 'sync.', 'tinygo_')
+
+
+def allTasks():
+    """Return the pointers to all goroutines, most recently started first."""
+    try:
+        t = gdb.parse_and_eval("'internal/task.allTasks'")
+    except gdb.error:
+        raise gdb.GdbError('no goroutine list found: goroutines are only listed with -scheduler=tasks when built by tinygo gdb or with -stackusage')
+    tasks = []
+    while int(t) != 0:
+        tasks.append(t)
+        t = t.dereference()['state']['list']['next']
+    return tasks
+
+
+def currentTask():
+    """Return the address of the running goroutine, or 0 in the scheduler."""
+    return int(gdb.parse_and_eval("'internal/task.currentTask'"))
+
+
+def savedLayout():
+    """Return the register names in the saved register area with their offsets,
+    and the size of the area. The VFP registers of ARM are not restored, as
+    they are only saved on targets with an FPU."""
+    try:
+        typ = gdb.lookup_type('internal/task.calleeSavedRegs')
+        return [(field.name, field.bitpos // 8) for field in typ.fields() if field.name != 'vfp'], typ.sizeof
+    except gdb.error:
+        pass
+    arch = gdb.selected_frame().architecture().name()
+    wordSize = gdb.lookup_type('void').pointer().sizeof
+    for prefix, names in fallbackLayouts:
+        if arch.startswith(prefix):
+            return [(name, i * wordSize) for i, name in enumerate(names) if name is not None], len(names) * wordSize
+    raise gdb.GdbError('switching goroutines is not supported on ' + arch)
+
+
+class TaskRegisters(object):
+    """Context manager that makes the given goroutine the current one in GDB,
+    by loading its saved registers. The original registers are restored
+    afterwards."""
+
+    def __init__(self, task):
+        self.task = task
+        self.saved = []
+
+    def __enter__(self):
+        if int(self.task) == currentTask():
+            return
+        layout, size = savedLayout()
+        wordType = gdb.lookup_type('void').pointer()
+        sp = int(self.task.dereference()['state']['sp'])
+        frame = gdb.newest_frame()
+        frame.select()
+        values = {}
+        for name, offset in layout:
+            try:
+                frame.read_register(name)
+            except ValueError:
+                continue  # not a single register, such as locals on ESP32
+            addr = sp + offset
+            values[name] = int(gdb.Value(addr).cast(wordType.pointer()).dereference())
+        if 'pc' not in values:
+            raise gdb.GdbError('switching goroutines is not supported on ' + frame.architecture().name())
+        if frame.architecture().name().startswith('arm'):
+            values['pc'] &= ~1  # clear the Thumb bit
+        values['sp'] = sp + size
+        for name, value in values.items():
+            self.saved.append((name, int(gdb.parse_and_eval('$' + name))))
+            gdb.execute('set $%s = %d' % (name, value), to_string=True)
+
+    def __exit__(self, *args):
+        gdb.newest_frame().select()
+        for name, value in reversed(self.saved):
+            gdb.execute('set $%s = %d' % (name, value), to_string=True)
+        self.saved = []
+        return False
+
+
+def blockedAt():
+    """Return a description of the innermost frame outside the runtime."""
+    frame = gdb.newest_frame()
+    while frame is not None:
+        name = frame.name() or ''
+        if name and not name.startswith(runtimePrefixes):
+            sal = frame.find_sal()
+            if sal.symtab is not None:
+                return '%s (%s:%d)' % (name, sal.symtab.filename, sal.line)
+            return name
+        frame = frame.older()
+    return '?'
+
+
+def findTask(arg):
+    """Return the goroutine for the given number or address."""
+    tasks = allTasks()
+    try:
+        n = int(arg, 0)
+    except ValueError:
+        raise gdb.GdbError('invalid goroutine: ' + arg)
+    if 1 <= n <= len(tasks):
+        return tasks[n - 1]
+    for t in tasks:
+        if int(t) == n:
+            return t
+    raise gdb.GdbError('no such goroutine: ' + arg)
+
+
+class InfoGoroutines(gdb.Command):
+    """List all goroutines. The running goroutine is marked with a *.
+Usage: info goroutines"""
+
+    def __init__(self):
+        super(InfoGoroutines, self).__init__('info goroutines', gdb.COMMAND_STACK, gdb.COMPLETE_NONE)
+
+    def invoke(self, arg, from_tty):
+        current = currentTask()
+        for i, t in enumerate(allTasks()):
+            with TaskRegisters(t):
+                location = blockedAt()
+            marker = '*' if int(t) == current else ' '
+            print('%s %d 0x%x %s' % (marker, i + 1, int(t), location))
+
+
+class GoroutineCmd(gdb.Command):
+    """Run a command on a goroutine, as listed by info goroutines.
+Usage: goroutine <number or address> <command>
+For example: goroutine 2 bt"""
+
+    def __init__(self):
+        super(GoroutineCmd, self).__init__('goroutine', gdb.COMMAND_STACK, gdb.COMPLETE_NONE)
+
+    def invoke(self, arg, from_tty):
+        args = arg.split(None, 1)
+        if len(args) != 2:
+            raise gdb.GdbError('usage: goroutine <number or address> <command>')
+        t = findTask(args[0])
+        with TaskRegisters(t):
+            gdb.execute(args[1], from_tty)
+
+
+InfoGoroutines()
+GoroutineCmd()
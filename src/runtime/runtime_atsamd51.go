@@ -34,6 +34,10 @@ func init() {
 }
 
 func putchar(c byte) {
+	if serialITM {
+		putcharITM(c)
+		return
+	}
 	machine.UART0.WriteByte(c)
 }
 
@@ -50,6 +50,9 @@ func preinit() {
 }
 
 func postinit() {
+	// Initialize the Arduino core, when it is linked in with -arduino.
+	initArduinoCore()
+
 	// Enable interrupts after initialization.
 	avr.Asm("sei")
 }
@@ -85,7 +88,11 @@ func ticks() timeUnit {
 }
 
 func abort() {
+	// Disable interrupts and go to sleep. The chip won't wake up again until it
+	// is reset. This is also how simavr recognizes the end of a program, so
+	// that tinygo run and tinygo test return when the program exits.
+	avr.Asm("cli")
 	for {
-		sleepWDT(WDT_PERIOD_2S)
+		avr.Asm("sleep")
 	}
 }
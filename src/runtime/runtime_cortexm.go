@@ -22,6 +22,10 @@ var _sidata [0]byte
 var _edata [0]byte
 
 func preinit() {
+	// Use the vector table of this program (and not the one of a bootloader)
+	// for interrupts and faults, if the target asks for it.
+	relocateVectors()
+
 	// Initialize .bss: zero-initialized global variables.
 	ptr := unsafe.Pointer(&_sbss)
 	for ptr != unsafe.Pointer(&_ebss) {
@@ -37,6 +41,17 @@ func preinit() {
 		dst = unsafe.Pointer(uintptr(dst) + 4)
 		src = unsafe.Pointer(uintptr(src) + 4)
 	}
+
+	// Copy functions that run from tightly coupled memory, on chips that have
+	// it.
+	initTCM()
+
+	// Clear the buffers for DMA transfers, on chips that keep them in a
+	// separate section.
+	initDMA()
+
+	// Make code and read-only data read-only, with -readonlytext.
+	protectText()
 }
 
 // The stack layout at the moment an interrupt occurs.
@@ -52,3 +67,76 @@ type interruptStack struct {
 	PC  uintptr
 	PSR uintptr
 }
+
+// printFaultRegisters prints the registers that were pushed on the stack when
+// a fault occurred. The stack pointer must have been checked to be valid.
+func printFaultRegisters(sp *interruptStack) {
+	printFaultRegister("  r0", sp.R0)
+	printFaultRegister(" r1", sp.R1)
+	printFaultRegister(" r2", sp.R2)
+	printFaultRegister(" r3", sp.R3)
+	printnl()
+	printFaultRegister("  r12", sp.R12)
+	printFaultRegister(" lr", sp.LR)
+	printFaultRegister(" pc", sp.PC)
+	printFaultRegister(" psr", sp.PSR)
+	printnl()
+}
+
+// The registers r4-r11 at the moment of a fault, in the order they're pushed
+// by the fault handler in src/device/arm/cortexm.s.
+type faultRegisters struct {
+	R8  uintptr
+	R9  uintptr
+	R10 uintptr
+	R11 uintptr
+	R4  uintptr
+	R5  uintptr
+	R6  uintptr
+	R7  uintptr
+}
+
+// coreDumpFault writes a core dump with the registers at the moment of a fault
+// (with -coredump). The stack pointer must have been checked to be valid.
+func coreDumpFault(sp *interruptStack, regs *faultRegisters) {
+	if !coreDumpEnabled {
+		return
+	}
+	// The processor pushed 8 registers, and an extra word to align the stack
+	// if bit 9 of the stacked xPSR is set.
+	oldSP := uintptr(unsafe.Pointer(sp)) + unsafe.Sizeof(interruptStack{})
+	if sp.PSR&(1<<9) != 0 {
+		oldSP += 4
+	}
+	coreDumpWrite(&coreDumpRegs{
+		sp.R0, sp.R1, sp.R2, sp.R3,
+		regs.R4, regs.R5, regs.R6, regs.R7,
+		regs.R8, regs.R9, regs.R10, regs.R11,
+		sp.R12, oldSP, sp.LR, sp.PC, sp.PSR,
+	})
+}
+
+// printFaultRegister prints a single register value with all 8 hexadecimal
+// digits. Unlike printptr, it doesn't print zero as nil.
+func printFaultRegister(name string, value uintptr) {
+	printstring(name)
+	printstring("=0x")
+	for shift := 28; shift >= 0; shift -= 4 {
+		nibble := byte(value>>uint(shift)) & 0xf
+		if nibble < 10 {
+			putchar(nibble + '0')
+		} else {
+			putchar(nibble - 10 + 'a')
+		}
+	}
+}
+
+// watchpointFault is called by the runtime/watchpoint package in the
+// DebugMonitor exception when a watchpoint was hit, after it printed which one.
+// The stack pointer points to the registers stacked by the exception.
+//go:linkname watchpointFault runtime/watchpoint.runtime_watchpointFault
+func watchpointFault(sp *interruptStack) {
+	printFaultRegisters(sp)
+	callPanicHandler(PanicInfo{Fault: true, Message: "watchpoint", PC: sp.PC})
+	resetAfterFault()
+}
@@ -6,6 +6,9 @@ import (
 	"device/arm"
 )
 
+// abort is not inlined, so that emulators like Renode can stop when the program
+// reaches it (for example when main returns).
+//go:noinline
 func abort() {
 	// disable all interrupts
 	arm.DisableInterrupts()
@@ -0,0 +1,25 @@
+// +build cortexm,!qemu
+
+package runtime
+
+import (
+	"device/arm"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// Debug Halting Control and Status Register, see the ARMv7-M Architecture
+// Reference Manual, section C1.6.2. It is also present on ARMv6-M.
+var dhcsr = (*volatile.Register32)(unsafe.Pointer(uintptr(0xE000EDF0)))
+
+const dhcsrDebugEnabled = 1 << 0 // C_DEBUGEN: a debugger is attached
+
+// resetAfterFault resets the chip after a fault has been reported, so that
+// the device recovers on its own. When a debugger is attached the chip is
+// halted instead, so that the fault can be inspected.
+func resetAfterFault() {
+	if dhcsr.Get()&dhcsrDebugEnabled != 0 {
+		abort()
+	}
+	arm.SystemReset()
+}
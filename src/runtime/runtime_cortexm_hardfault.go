@@ -8,8 +8,8 @@ import (
 
 // This function is called at HardFault.
 // Before this function is called, the stack pointer is reset to the initial
-// stack pointer (loaded from addres 0x0) and the previous stack pointer is
-// passed as an argument to this function. This allows for easy inspection of
+// stack pointer (loaded from addres 0x0) and the stack pointer at the time of
+// the fault (MSP or PSP) is passed as an argument to this function. This allows for easy inspection of
 // the stack the moment a HardFault occurs, but it means that the stack will be
 // corrupted by this function and thus this handler must not attempt to recover.
 //
@@ -17,10 +17,17 @@ import (
 // https://community.arm.com/developer/ip-products/system/f/embedded-forum/3257/debugging-a-cortex-m0-hard-fault
 // https://blog.feabhas.com/2013/02/developing-a-generic-hard-fault-handler-for-arm-cortex-m3cortex-m4/
 //export handleHardFault
-func handleHardFault(sp *interruptStack) {
+func handleHardFault(sp *interruptStack, regs *faultRegisters) {
+	if coreDumpPanicking() {
+		// The fault was triggered on purpose by a panic, to write a core dump.
+		coreDumpFault(sp, regs)
+		resetAfterFault()
+	}
 	print("fatal error: ")
+	info := PanicInfo{Fault: true, Message: "HardFault"}
 	if uintptr(unsafe.Pointer(sp)) < 0x20000000 {
 		print("stack overflow")
+		info.Message = "stack overflow"
 	} else {
 		// TODO: try to find the cause of the hard fault. Especially on
 		// Cortex-M3 and higher it is possible to find more detailed information
@@ -33,7 +40,14 @@ func handleHardFault(sp *interruptStack) {
 		// It may not point into memory during a stack overflow, so check that
 		// first before accessing the stack.
 		print(" pc=", sp.PC)
+		println()
+		printFaultRegisters(sp)
+		info.PC = sp.PC
+		callPanicHandler(info)
+		coreDumpFault(sp, regs)
+	} else {
+		println()
+		callPanicHandler(info)
 	}
-	println()
-	abort()
+	resetAfterFault()
 }
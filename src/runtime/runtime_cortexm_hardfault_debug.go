@@ -18,13 +18,31 @@ const (
 
 // See runtime_cortexm_hardfault.go
 //go:export handleHardFault
-func handleHardFault(sp *interruptStack) {
+func handleHardFault(sp *interruptStack, regs *faultRegisters) {
+	if coreDumpPanicking() {
+		// The fault was triggered on purpose by a panic, to write a core dump.
+		coreDumpFault(sp, regs)
+		resetAfterFault()
+	}
 	fault := GetFaultStatus()
 	spValid := !fault.Bus().ImpreciseDataBusError()
 
 	print("fatal error: ")
+	info := PanicInfo{Fault: true, Message: "HardFault"}
+	switch arm.AsmFull("mrs {}, IPSR", nil) & 0x1ff {
+	case 4:
+		print("MemManage: ")
+		info.Message = "MemManage"
+	case 5:
+		print("BusFault: ")
+		info.Message = "BusFault"
+	case 6:
+		print("UsageFault: ")
+		info.Message = "UsageFault"
+	}
 	if spValid && uintptr(unsafe.Pointer(sp)) < 0x20000000 {
 		print("stack overflow? ")
+		info.Message = "stack overflow"
 	}
 	if fault.Mem().InstructionAccessViolation() {
 		print("instruction access violation")
@@ -91,6 +109,7 @@ func handleHardFault(sp *interruptStack) {
 	if addr, ok := fault.Bus().Address(); ok {
 		print(" with bus fault address ", addr)
 	}
+	stackValid := false
 	if spValid {
 		print(" with sp=", sp)
 		if uintptr(unsafe.Pointer(&sp.PC)) >= 0x20000000 {
@@ -98,10 +117,30 @@ func handleHardFault(sp *interruptStack) {
 			// It may not point into memory during a stack overflow, so check that
 			// first before accessing the stack.
 			print(" pc=", sp.PC)
+			stackValid = true
 		}
 	}
 	println()
-	abort()
+
+	hfsr := arm.SCB.HFSR.Get()
+	if hfsr&arm.SCB_HFSR_VECTTBL != 0 {
+		println("  bus fault on vector table read")
+	}
+	if hfsr&arm.SCB_HFSR_FORCED != 0 {
+		println("  escalated to a HardFault from a configurable fault")
+	}
+	printFaultRegister("  cfsr", uintptr(fault))
+	printFaultRegister(" hfsr", uintptr(hfsr))
+	printnl()
+	if stackValid {
+		printFaultRegisters(sp)
+		info.PC = sp.PC
+	}
+	callPanicHandler(info)
+	if stackValid {
+		coreDumpFault(sp, regs)
+	}
+	resetAfterFault()
 }
 
 // Descriptions are sourced from the K66 SVD and
@@ -2,13 +2,12 @@
 
 package runtime
 
-// This file implements the Stellaris LM3S6965 Cortex-M3 chip as implemented by
-// QEMU.
+// This file implements the Cortex-M chips as emulated by QEMU. Output is
+// written either to the UART of the chip (see runtime_cortexm_qemu_lm3s6965.go)
+// or using semihosting, and the program exits using semihosting.
 
 import (
 	"device/arm"
-	"runtime/volatile"
-	"unsafe"
 )
 
 type timeUnit int64
@@ -44,13 +43,6 @@ func ticks() timeUnit {
 	return timestamp
 }
 
-// UART0 output register.
-var stdoutWrite = (*volatile.Register8)(unsafe.Pointer(uintptr(0x4000c000)))
-
-func putchar(c byte) {
-	stdoutWrite.Set(uint8(c))
-}
-
 func waitForEvents() {
 	arm.Asm("wfe")
 }
@@ -64,3 +56,9 @@ func abort() {
 		arm.Asm("wfi")
 	}
 }
+
+// resetAfterFault exits QEMU with an error, instead of restarting the program
+// as would happen on real hardware.
+func resetAfterFault() {
+	abort()
+}
@@ -0,0 +1,18 @@
+// +build cortexm,qemu,lm3s6965
+
+package runtime
+
+// This file implements output for the Stellaris LM3S6965 Cortex-M3 chip as
+// implemented by QEMU.
+
+import (
+	"runtime/volatile"
+	"unsafe"
+)
+
+// UART0 output register.
+var stdoutWrite = (*volatile.Register8)(unsafe.Pointer(uintptr(0x4000c000)))
+
+func putchar(c byte) {
+	stdoutWrite.Set(uint8(c))
+}
@@ -0,0 +1,20 @@
+// +build cortexm,qemu,!lm3s6965
+
+package runtime
+
+// This file implements output using semihosting, for Cortex-M chips emulated by
+// QEMU where the UART is not (fully) emulated or needs initialization.
+
+import (
+	"device/arm"
+	"unsafe"
+)
+
+// The character to write. The semihosting call needs a pointer to it, and a
+// global avoids a heap allocation for every character.
+var semihostingChar byte
+
+func putchar(c byte) {
+	semihostingChar = c
+	arm.SemihostingCall(arm.SemihostingWriteByte, uintptr(unsafe.Pointer(&semihostingChar)))
+}
@@ -0,0 +1,159 @@
+// +build customos
+
+package runtime
+
+// This file implements the runtime on top of an OS backend that lives outside
+// of TinyGo, for example to port TinyGo to an in-house RTOS without forking the
+// runtime. The backend is usually a Go package, set with the os-package
+// property in the target JSON file, but it may also be written in C. Either
+// way, it must implement the following functions with these C names:
+//
+//     tinygo_os_putchar(c byte)            write a byte to the console
+//     tinygo_os_ticks() uint64             monotonic clock
+//     tinygo_os_ticks_per_second() uint64  frequency of the monotonic clock
+//     tinygo_os_sleep(ticks uint64)        block the current thread
+//     tinygo_os_wait()                     block until an interrupt or another thread may have woken up a goroutine
+//     tinygo_os_abort()                    stop the program, must not return
+//     tinygo_os_heap_start() uintptr       start of the memory for the Go heap
+//     tinygo_os_heap_end() uintptr         end of the memory for the Go heap
+//     tinygo_os_globals_start() uintptr    start of the globals, scanned by the GC
+//     tinygo_os_globals_end() uintptr      end of the globals
+//     tinygo_os_task_switch(task uintptr)  context switch hook
+//     tinygo_os_disable_interrupts() uintptr
+//     tinygo_os_restore_interrupts(state uintptr)
+//
+// In a Go package, a function is implemented with a C name using //export:
+//
+//     //export tinygo_os_putchar
+//     func putchar(c byte) {
+//         uart.WriteByte(c)
+//     }
+//
+// The program is built as a static library (-buildmode=customos) that is linked
+// into the OS image together with the backend. The OS is expected to start a
+// thread that calls tinygo_os_main, which runs the Go program and returns when
+// main.main returns. All goroutines run inside
+// this thread, using the TinyGo scheduler. Before the scheduler resumes a
+// goroutine, it calls tinygo_os_task_switch with a pointer that identifies the
+// goroutine, and with 0 when the goroutine pauses. This can be used to update
+// a stack limit or per-thread state of the OS.
+
+import "unsafe"
+
+//export tinygo_os_putchar
+func os_putchar(c byte)
+
+//export tinygo_os_ticks
+func os_ticks() uint64
+
+//export tinygo_os_ticks_per_second
+func os_ticks_per_second() uint64
+
+//export tinygo_os_sleep
+func os_sleep(ticks uint64)
+
+//export tinygo_os_wait
+func os_wait()
+
+//export tinygo_os_abort
+func os_abort()
+
+//export tinygo_os_heap_start
+func os_heap_start() uintptr
+
+//export tinygo_os_heap_end
+func os_heap_end() uintptr
+
+//export tinygo_os_task_switch
+func os_task_switch(task uintptr)
+
+type timeUnit int64
+
+var (
+	heapStart      uintptr
+	heapEnd        uintptr
+	stackTop       uintptr
+	ticksPerSecond uint64
+)
+
+const baremetal = true
+
+// tinygo_os_main initializes the runtime and runs the Go program. It must be
+// called once by the OS backend, from the thread that runs all goroutines.
+//export tinygo_os_main
+func main() {
+	heapStart = os_heap_start()
+	heapEnd = os_heap_end()
+	ticksPerSecond = os_ticks_per_second()
+	if ticksPerSecond == 0 {
+		// The tick conversions below divide by this value.
+		runtimePanic("tinygo_os_ticks_per_second returned 0")
+	}
+
+	// Scan the stack of the thread up to this point.
+	stackTop = getCurrentStackPointer()
+	runMain()
+}
+
+// Must be a separate function to get the correct stack pointer.
+//go:noinline
+func runMain() {
+	run()
+}
+
+func postinit() {}
+
+func putchar(c byte) {
+	os_putchar(c)
+}
+
+func ticksToNanoseconds(ticks timeUnit) int64 {
+	// Split the conversion to avoid overflowing for large tick values.
+	t := uint64(ticks)
+	return int64(t/ticksPerSecond*1e9 + t%ticksPerSecond*1e9/ticksPerSecond)
+}
+
+func nanosecondsToTicks(ns int64) timeUnit {
+	n := uint64(ns)
+	return timeUnit(n/1e9*ticksPerSecond + n%1e9*ticksPerSecond/1e9)
+}
+
+func ticks() timeUnit {
+	return timeUnit(os_ticks())
+}
+
+func sleepTicks(d timeUnit) {
+	if d <= 0 {
+		return
+	}
+	os_sleep(uint64(d))
+}
+
+// waitForEvents is called by the scheduler when no goroutine can run.
+func waitForEvents() {
+	os_wait()
+}
+
+// taskSwitchHook is called by the scheduler right before resuming a goroutine
+// (with the goroutine as parameter) and right after it paused (with nil).
+func taskSwitchHook(t unsafe.Pointer) {
+	os_task_switch(uintptr(t))
+}
+
+func abort() {
+	os_abort()
+	for {
+	}
+}
+
+// growHeap tries to grow the heap size. It returns true if it succeeds, false
+// otherwise.
+func growHeap() bool {
+	// The heap is provided by the OS backend and has a fixed size.
+	return false
+}
+
+//go:linkname syscall_Exit syscall.Exit
+func syscall_Exit(code int) {
+	abort()
+}
@@ -1,4 +1,4 @@
-// +build esp32
+// +build esp32,!freertos
 
 package runtime
 
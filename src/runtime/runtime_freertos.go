@@ -0,0 +1,110 @@
+// +build freertos
+
+package runtime
+
+// This file implements the runtime for programs that run as a task of
+// FreeRTOS, for chips where the vendor SDK requires FreeRTOS (such as the WiFi
+// and Bluetooth stacks of ESP-IDF). The program is built as a static library
+// that is linked into the FreeRTOS application together with
+// targets/freertos.c, which creates the task that calls tinygo_freertos_main.
+//
+// The TinyGo scheduler runs inside this task. Whenever all goroutines are
+// sleeping or blocked, the task blocks in FreeRTOS so that other tasks (such as
+// the network stack) can run.
+
+import (
+	"unsafe"
+)
+
+//export tinygo_freertos_putchar
+func freertos_putchar(c byte)
+
+//export tinygo_freertos_uptime_ns
+func freertos_uptime_ns() int64
+
+//export tinygo_freertos_sleep_ns
+func freertos_sleep_ns(ns int64)
+
+//export tinygo_freertos_wait
+func freertos_wait()
+
+//export tinygo_freertos_abort
+func freertos_abort()
+
+type timeUnit int64
+
+var (
+	heapStart uintptr
+	heapEnd   uintptr
+	stackTop  uintptr
+)
+
+const baremetal = true
+
+// tinygo_freertos_main initializes the runtime and runs the Go program. It is
+// called from the task created by targets/freertos.c, with a heap that was
+// allocated from the FreeRTOS heap. It returns once main.main returns, after
+// which the task is deleted.
+//export tinygo_freertos_main
+func main(heap unsafe.Pointer, heapSize uintptr) {
+	heapStart = uintptr(heap)
+	heapEnd = heapStart + heapSize
+
+	// Scan the stack of the task up to this point.
+	stackTop = getCurrentStackPointer()
+	runMain()
+}
+
+// Must be a separate function to get the correct stack pointer.
+//go:noinline
+func runMain() {
+	run()
+}
+
+func postinit() {}
+
+func putchar(c byte) {
+	freertos_putchar(c)
+}
+
+func ticksToNanoseconds(ticks timeUnit) int64 {
+	return int64(ticks)
+}
+
+func nanosecondsToTicks(ns int64) timeUnit {
+	return timeUnit(ns)
+}
+
+func ticks() timeUnit {
+	return timeUnit(freertos_uptime_ns())
+}
+
+func sleepTicks(d timeUnit) {
+	// Block the task, so that other FreeRTOS tasks can run.
+	freertos_sleep_ns(int64(d))
+}
+
+// waitForEvents is called by the scheduler when no goroutine can run. Block the
+// task for a short while, after which the scheduler checks again whether an
+// interrupt or another task made a goroutine runnable.
+func waitForEvents() {
+	freertos_wait()
+}
+
+func abort() {
+	freertos_abort()
+	for {
+	}
+}
+
+// growHeap tries to grow the heap size. It returns true if it succeeds, false
+// otherwise.
+func growHeap() bool {
+	// The heap has a fixed size, set with TINYGO_HEAP_SIZE.
+	return false
+}
+
+//go:linkname syscall_Exit syscall.Exit
+func syscall_Exit(code int) {
+	abort()
+}
@@ -124,6 +124,10 @@ func initUART() {
 }
 
 func putchar(c byte) {
+	if serialITM {
+		putcharITM(c)
+		return
+	}
 	machine.UART1.WriteByte(c)
 }
 
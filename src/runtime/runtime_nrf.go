@@ -64,6 +64,10 @@ func initRTC() {
 }
 
 func putchar(c byte) {
+	if serialITM {
+		putcharITM(c)
+		return
+	}
 	machine.UART0.WriteByte(c)
 }
 
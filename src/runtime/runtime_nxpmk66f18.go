@@ -229,6 +229,10 @@ func initInternal() {
 func postinit() {}
 
 func putchar(c byte) {
+	if serialITM {
+		putcharITM(c)
+		return
+	}
 	machine.PutcharUART(&machine.UART0, c)
 }
 
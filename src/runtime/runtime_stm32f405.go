@@ -186,5 +186,9 @@ func initCOM() {
 }
 
 func putchar(c byte) {
+	if serialITM {
+		putcharITM(c)
+		return
+	}
 	machine.UART0.WriteByte(c)
 }
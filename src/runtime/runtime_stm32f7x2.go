@@ -60,6 +60,10 @@ func init() {
 }
 
 func putchar(c byte) {
+	if serialITM {
+		putcharITM(c)
+		return
+	}
 	machine.UART0.WriteByte(c)
 }
 
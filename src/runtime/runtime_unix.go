@@ -10,6 +10,9 @@ import (
 //export putchar
 func _putchar(c int) int
 
+//export fflush
+func fflush(stream unsafe.Pointer) int
+
 //export usleep
 func usleep(usec uint) int
 
@@ -123,6 +126,11 @@ func putchar(c byte) {
 	_putchar(int(c))
 }
 
+// printflush writes out the output of putchar, which is buffered by libc.
+func printflush() {
+	fflush(nil)
+}
+
 func ticksToNanoseconds(ticks timeUnit) int64 {
 	// The OS API works in nanoseconds so no conversion necessary.
 	return int64(ticks)
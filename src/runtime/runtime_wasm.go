@@ -44,12 +44,20 @@ func putchar(c byte) {
 	putcharPosition++
 
 	if c == '\n' || putcharPosition >= putcharBufferSize {
-		putcharIOVec.bufLen = putcharPosition
-		fd_write(stdout, &putcharIOVec, 1, &putcharNWritten)
-		putcharPosition = 0
+		printflush()
 	}
 }
 
+// printflush writes out the buffered output of putchar.
+func printflush() {
+	if putcharPosition == 0 {
+		return
+	}
+	putcharIOVec.bufLen = putcharPosition
+	fd_write(stdout, &putcharIOVec, 1, &putcharNWritten)
+	putcharPosition = 0
+}
+
 // Abort executes the wasm 'unreachable' instruction.
 func abort() {
 	trap()
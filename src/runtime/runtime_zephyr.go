@@ -0,0 +1,118 @@
+// +build zephyr
+
+package runtime
+
+// This file implements the runtime for programs that run as a thread of the
+// Zephyr RTOS. The program is built as a static library that is linked into a
+// Zephyr application together with targets/zephyr.c, which starts a thread that
+// calls tinygo_zephyr_main and wraps the Zephyr APIs used here (many of them
+// are macros or inline functions).
+
+import (
+	"unsafe"
+)
+
+//export tinygo_zephyr_putchar
+func zephyr_putchar(c byte)
+
+//export tinygo_zephyr_uptime_ns
+func zephyr_uptime_ns() int64
+
+//export tinygo_zephyr_sleep_ns
+func zephyr_sleep_ns(ns int64)
+
+//export tinygo_zephyr_abort
+func zephyr_abort()
+
+// The heap is a buffer in targets/zephyr.c. It is placed in the .noinit
+// section, so that it isn't scanned as part of the globals.
+//go:extern tinygo_zephyr_heap
+var heapStartSymbol [0]byte
+
+//go:extern tinygo_zephyr_heap_size
+var heapSizeSymbol uintptr
+
+type timeUnit int64
+
+var (
+	heapStart = uintptr(unsafe.Pointer(&heapStartSymbol))
+	heapEnd   uintptr
+	stackTop  uintptr
+)
+
+const baremetal = true
+
+// tinygo_zephyr_main initializes the runtime and runs the Go program. It is
+// called from the thread started by targets/zephyr.c, and returns (ending the
+// thread) once main.main returns.
+//export tinygo_zephyr_main
+func main() {
+	preinit()
+
+	// Scan the stack of the thread up to this point.
+	stackTop = getCurrentStackPointer()
+	runMain()
+}
+
+// Must be a separate function to get the correct stack pointer.
+//go:noinline
+func runMain() {
+	run()
+}
+
+func preinit() {
+	heapEnd = heapStart + heapSizeSymbol
+}
+
+func postinit() {}
+
+func putchar(c byte) {
+	zephyr_putchar(c)
+}
+
+func ticksToNanoseconds(ticks timeUnit) int64 {
+	return int64(ticks)
+}
+
+func nanosecondsToTicks(ns int64) timeUnit {
+	return timeUnit(ns)
+}
+
+func ticks() timeUnit {
+	return timeUnit(zephyr_uptime_ns())
+}
+
+func sleepTicks(d timeUnit) {
+	// Let other Zephyr threads run while the Go program is sleeping.
+	zephyr_sleep_ns(int64(d))
+}
+
+func abort() {
+	// Report a fatal error to Zephyr, which halts or resets the system
+	// depending on its configuration.
+	zephyr_abort()
+	for {
+	}
+}
+
+// growHeap tries to grow the heap size. It returns true if it succeeds, false
+// otherwise.
+func growHeap() bool {
+	// The heap has a fixed size, set with TINYGO_HEAP_SIZE.
+	return false
+}
+
+//go:linkname syscall_Exit syscall.Exit
+func syscall_Exit(code int) {
+	abort()
+}
+
+// The Go program runs in a single Zephyr thread, so these can be left empty.
+
+//go:linkname procPin sync/atomic.runtime_procPin
+func procPin() {
+}
+
+//go:linkname procUnpin sync/atomic.runtime_procUnpin
+func procUnpin() {
+}
@@ -16,6 +16,7 @@ package runtime
 
 import (
 	"internal/task"
+	"unsafe"
 )
 
 const schedulerDebug = false
@@ -61,6 +62,13 @@ func scheduleLogChan(msg string, ch *channel, t *task.Task) {
 //     select{}
 //go:noinline
 func deadlock() {
+	blockRecord(blockForever, nil, returnAddress(0))
+	pauseForever()
+}
+
+// pauseForever pauses the current goroutine without ever resuming it.
+//go:noinline
+func pauseForever() {
 	// call yield without requesting a wakeup
 	task.Pause()
 	panic("unreachable")
@@ -71,8 +79,9 @@ func deadlock() {
 // Unlike the main Go implementation, no deffered calls will be run.
 //go:inline
 func Goexit() {
-	// its really just a deadlock
-	deadlock()
+	// its really just a deadlock, but the goroutine isn't blocked on anything
+	// so it isn't reported with -deadlocktrace
+	pauseForever()
 }
 
 // Add this task to the end of the run queue.
@@ -136,6 +145,7 @@ func scheduler() {
 			sleepQueue = t.Next
 			t.Next = nil
 			runqueue.Push(t)
+			traceRecord(traceEvGoUnblock, t)
 		}
 
 		t := runqueue.Pop()
@@ -145,10 +155,17 @@ func scheduler() {
 					// JavaScript is treated specially, see below.
 					return
 				}
+				if callIdleHook(false, 0) {
+					continue
+				}
+				deadlockCheck()
 				waitForEvents()
 				continue
 			}
 			timeLeft := timeUnit(sleepQueue.Data) - (now - sleepQueueBaseTime)
+			if callIdleHook(true, timeLeft) {
+				continue
+			}
 			if schedulerDebug {
 				println("  sleeping...", sleepQueue, uint(timeLeft))
 				for t := sleepQueue; t != nil; t = t.Next {
@@ -168,11 +185,18 @@ func scheduler() {
 
 		// Run the given task.
 		scheduleLogTask("  run:", t)
+		deadlockRunning()
+		traceRecord(traceEvGoStart, t)
+		taskSwitchHook(unsafe.Pointer(t))
 		t.Resume()
+		taskSwitchHook(nil)
+		stackCanaryCheck()
+		traceRecord(traceEvGoStop, t)
 	}
 }
 
 func Gosched() {
+	traceRecord(traceEvGoSched, task.Current())
 	runqueue.Push(task.Current())
 	task.Pause()
 }
@@ -7,6 +7,8 @@ import "internal/task"
 // Pause the current task for a given time.
 //go:linkname sleep time.Sleep
 func sleep(duration int64) {
+	interruptCheck("sleep")
+	traceRecord(traceEvGoSleep, task.Current())
 	addSleepTask(task.Current(), nanosecondsToTicks(duration))
 	task.Pause()
 }
@@ -14,6 +16,7 @@ func sleep(duration int64) {
 // run is called by the program entry point to execute the go program.
 // With a scheduler, init and the main function are invoked in a goroutine before starting the scheduler.
 func run() {
+	stackCanaryInit()
 	initHeap()
 	go func() {
 		initAll()
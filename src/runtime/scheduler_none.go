@@ -4,6 +4,8 @@ package runtime
 
 //go:linkname sleep time.Sleep
 func sleep(duration int64) {
+	interruptCheck("sleep")
+	stackCanaryCheck()
 	sleepTicks(nanosecondsToTicks(duration))
 }
 
@@ -16,6 +18,7 @@ func getSystemStackPointer() uintptr {
 // run is called by the program entry point to execute the go program.
 // With the "none" scheduler, init and the main function are invoked directly.
 func run() {
+	stackCanaryInit()
 	initHeap()
 	initAll()
 	postinit()
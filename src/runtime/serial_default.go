@@ -0,0 +1,10 @@
+// +build !serial.itm
+
+package runtime
+
+// The console is the default serial console of the target.
+const serialITM = false
+
+//go:inline
+func putcharITM(c byte) {
+}
@@ -0,0 +1,40 @@
+// +build stackcanary,baremetal,!esp8266,!gameboyadvance,!zephyr,!freertos,!customos
+
+package runtime
+
+// With -stackcanary, the bottom of the system stack is filled with a canary
+// at startup, which is checked every time a goroutine switches back to the
+// scheduler (and on every sleep with -scheduler=none). The system stack is
+// used by the scheduler, by interrupts on most targets, and by the whole
+// program with -scheduler=none. Goroutine stacks have their own canary, see
+// src/internal/task/task_stack.go.
+//
+// The bottom of the system stack is found with the _stack_size symbol, which
+// is defined by the linker script (or with --defsym in the AVR targets).
+
+import "unsafe"
+
+// The same number as the goroutine stack canary in internal/task.
+const systemStackCanary = uintptr(uint64(0x670c1333b83bf575) & uint64(^uintptr(0)))
+
+const systemStackCanaryWords = 8
+
+// stackCanaryInit stores the canary at the bottom of the system stack. It is
+// called at startup, while only the top of the system stack is in use.
+func stackCanaryInit() {
+	bottom := stackTop - uintptr(unsafe.Pointer(&stackSizeSymbol))
+	for i := uintptr(0); i < systemStackCanaryWords; i++ {
+		*(*uintptr)(unsafe.Pointer(bottom + i*unsafe.Sizeof(uintptr(0)))) = systemStackCanary
+	}
+}
+
+// stackCanaryCheck panics if the canary at the bottom of the system stack was
+// overwritten.
+func stackCanaryCheck() {
+	bottom := stackTop - uintptr(unsafe.Pointer(&stackSizeSymbol))
+	for i := uintptr(0); i < systemStackCanaryWords; i++ {
+		if *(*uintptr)(unsafe.Pointer(bottom + i*unsafe.Sizeof(uintptr(0)))) != systemStackCanary {
+			runtimePanic("system stack overflow")
+		}
+	}
+}
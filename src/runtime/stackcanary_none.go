@@ -0,0 +1,14 @@
+// +build !stackcanary !baremetal esp8266 gameboyadvance zephyr freertos customos
+
+package runtime
+
+// The system stack has no canary: build with -stackcanary to add one (on
+// baremetal targets).
+
+//go:inline
+func stackCanaryInit() {
+}
+
+//go:inline
+func stackCanaryCheck() {
+}
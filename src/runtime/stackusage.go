@@ -0,0 +1,16 @@
+// +build scheduler.tasks
+
+package runtime
+
+import (
+	"internal/task"
+	"unsafe"
+)
+
+// debug_stackUsage returns the stack usage of the index-th live goroutine, if
+// the program was built with -stackusage.
+//go:linkname debug_stackUsage runtime/debug.runtime_stackUsage
+func debug_stackUsage(index int) (goroutine, fn, used, size uintptr, ok bool) {
+	t, fn, used, size, ok := task.StackUsage(index)
+	return uintptr(unsafe.Pointer(t)), fn, used, size, ok
+}
@@ -0,0 +1,11 @@
+// +build !scheduler.tasks
+
+package runtime
+
+// Goroutines don't have their own stack without -scheduler=tasks, so there is
+// no stack usage to report.
+
+//go:linkname debug_stackUsage runtime/debug.runtime_stackUsage
+func debug_stackUsage(index int) (goroutine, fn, used, size uintptr, ok bool) {
+	return
+}
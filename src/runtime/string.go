@@ -137,6 +137,41 @@ func stringFromUnicode(x rune) _string {
 	return _string{ptr: (*byte)(unsafe.Pointer(&array)), length: length}
 }
 
+// Create a string from a signed integer, in base 10. Used by the lightweight
+// fmt mode (-fmt=light) to lower fmt.Sprintf calls.
+func formatInt(n int64) string {
+	if n < 0 {
+		// Note: uint64(-n) also works for the most negative number.
+		return "-" + formatUint(uint64(-n))
+	}
+	return formatUint(uint64(n))
+}
+
+// Create a string from an unsigned integer, in base 10. Used by the
+// lightweight fmt mode (-fmt=light) to lower fmt.Sprintf calls.
+func formatUint(n uint64) string {
+	var digits [20]byte // enough to hold (2^64)-1
+	i := len(digits)
+	for {
+		i--
+		digits[i] = byte(n%10) + '0'
+		n /= 10
+		if n == 0 {
+			break
+		}
+	}
+	return string(digits[i:])
+}
+
+// Create a string from a boolean. Used by the lightweight fmt mode
+// (-fmt=light) to lower fmt.Sprintf calls.
+func formatBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
 // Iterate over a string.
 // Returns (ok, key, value).
 func stringNext(s string, it *stringIterator) (bool, int, rune) {
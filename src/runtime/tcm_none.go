@@ -0,0 +1,10 @@
+// +build cortexm,!stm32f7
+
+package runtime
+
+// This chip has no tightly coupled memory for functions, or it isn't supported
+// yet.
+
+//go:inline
+func initTCM() {
+}
@@ -0,0 +1,36 @@
+// +build stm32f7
+
+package runtime
+
+// This file copies functions that run from ITCM RAM (placed there with
+// //go:section ".itcm") from flash at startup. The section is defined in the
+// linker script of the chip.
+
+import (
+	"device/arm"
+	"unsafe"
+)
+
+//go:extern _sitcm
+var _sitcm [0]byte
+
+//go:extern _eitcm
+var _eitcm [0]byte
+
+//go:extern _siitcm
+var _siitcm [0]byte
+
+// initTCM copies the .itcm section from flash to ITCM RAM.
+func initTCM() {
+	src := unsafe.Pointer(&_siitcm)
+	dst := unsafe.Pointer(&_sitcm)
+	for dst != unsafe.Pointer(&_eitcm) {
+		*(*uint32)(dst) = *(*uint32)(src)
+		dst = unsafe.Pointer(uintptr(dst) + 4)
+		src = unsafe.Pointer(uintptr(src) + 4)
+	}
+
+	// Make sure the copied code is visible to instruction fetches.
+	arm.Asm("dsb")
+	arm.Asm("isb")
+}
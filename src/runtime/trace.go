@@ -0,0 +1,102 @@
+package runtime
+
+// This file implements a lightweight execution tracer (see runtime/trace). When
+// tracing is enabled, goroutine switches, blocking events and garbage
+// collection cycles are recorded in a small ring buffer. When tracing is
+// disabled the only cost is a check of traceEnabled.
+
+import (
+	"internal/task"
+	"runtime/interrupt"
+	"unsafe"
+)
+
+// Kinds of trace events. These must be kept in sync with the runtime/trace
+// package.
+const (
+	traceEvGoStart       = iota + 1 // goroutine starts running
+	traceEvGoStop                   // goroutine paused
+	traceEvGoUnblock                // goroutine made runnable by another goroutine or interrupt
+	traceEvGoBlockSend              // goroutine blocks on a channel send
+	traceEvGoBlockRecv              // goroutine blocks on a channel receive
+	traceEvGoBlockSelect            // goroutine blocks in a select statement
+	traceEvGoBlockCond              // goroutine blocks on a condition (such as a sync.Mutex)
+	traceEvGoSleep                  // goroutine calls time.Sleep
+	traceEvGoSched                  // goroutine calls runtime.Gosched
+	traceEvGCStart                  // garbage collection cycle starts
+	traceEvGCDone                   // garbage collection cycle ends
+)
+
+type traceEvent struct {
+	time timeUnit
+	arg  uintptr // task pointer, if any
+	kind uint8
+}
+
+var (
+	traceEnabled bool
+	traceBuf     []traceEvent
+	traceCount   uintptr // total number of events recorded since tracing was started
+)
+
+// traceRecord adds a new event to the trace buffer, overwriting the oldest
+// event if the buffer is full. The event is also passed to the trace hooks
+// selected with -trace-hooks, if any.
+func traceRecord(kind uint8, t *task.Task) {
+	traceHook(kind, t)
+	if !traceEnabled {
+		return
+	}
+	mask := interrupt.Disable()
+	ev := &traceBuf[traceCount%uintptr(len(traceBuf))]
+	ev.time = ticks()
+	ev.arg = uintptr(unsafe.Pointer(t))
+	ev.kind = kind
+	traceCount++
+	interrupt.Restore(mask)
+}
+
+// trace_start starts recording events in a buffer with room for the given
+// number of events. It returns false if tracing was already enabled.
+//go:linkname trace_start runtime/trace.runtime_start
+func trace_start(size int) bool {
+	if traceEnabled {
+		return false
+	}
+	if len(traceBuf) != size {
+		traceBuf = make([]traceEvent, size)
+	}
+	traceCount = 0
+	traceEnabled = true
+	return true
+}
+
+// trace_stop stops recording events. The recorded events can still be read
+// with trace_event.
+//go:linkname trace_stop runtime/trace.runtime_stop
+func trace_stop() {
+	traceEnabled = false
+}
+
+// trace_enabled returns whether events are currently being recorded.
+//go:linkname trace_enabled runtime/trace.runtime_enabled
+func trace_enabled() bool {
+	return traceEnabled
+}
+
+// trace_event returns the recorded event with the given index, where index 0
+// is the oldest event still in the buffer. The number of events that were
+// overwritten because the buffer was full is returned as well.
+//go:linkname trace_event runtime/trace.runtime_event
+func trace_event(index int) (nanoseconds int64, kind uint8, task uintptr, dropped uintptr, ok bool) {
+	count := traceCount
+	if count > uintptr(len(traceBuf)) {
+		dropped = count - uintptr(len(traceBuf))
+		count = uintptr(len(traceBuf))
+	}
+	if index < 0 || uintptr(index) >= count {
+		return 0, 0, 0, dropped, false
+	}
+	ev := traceBuf[(dropped+uintptr(index))%uintptr(len(traceBuf))]
+	return ticksToNanoseconds(ev.time), ev.kind, ev.arg, dropped, true
+}
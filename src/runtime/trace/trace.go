@@ -0,0 +1,116 @@
+// Package trace contains a lightweight execution tracer for TinyGo programs.
+//
+// Unlike the trace package of the main Go implementation, events are not
+// streamed while tracing but recorded in a small ring buffer of BufferSize
+// events, so that tracing can be used on microcontrollers with very little RAM.
+// When the buffer is full, the oldest events are overwritten. The events are
+// written to the writer passed to Start when Stop is called.
+//
+// The recorded events are goroutine switches, the reason a goroutine blocked
+// (channel operations, select, sleep, condition variables) and garbage
+// collection cycles. The output is a text format in which every line starts
+// with "tinygo-trace:", so it can be written to a serial port together with
+// other output. Use the tinygo trace command to convert it to the Chrome trace
+// event format, which can be opened in Perfetto or chrome://tracing:
+//
+//     tinygo trace -o trace.json serial.log
+package trace
+
+import (
+	"errors"
+	"io"
+	"strconv"
+)
+
+// BufferSize is the number of events that are kept in the trace buffer. It is
+// read by Start.
+var BufferSize = 128
+
+// Names of the trace events, indexed by event kind. These must be kept in sync
+// with the event kinds in the runtime package.
+var eventNames = [...]string{
+	1:  "start",
+	2:  "stop",
+	3:  "unblock",
+	4:  "block-send",
+	5:  "block-recv",
+	6:  "block-select",
+	7:  "block-cond",
+	8:  "sleep",
+	9:  "sched",
+	10: "gc-start",
+	11: "gc-done",
+}
+
+var (
+	output     io.Writer
+	errRunning = errors.New("tracing is already enabled")
+)
+
+// Start enables tracing. The trace is written to w when Stop is called.
+func Start(w io.Writer) error {
+	if BufferSize <= 0 {
+		return errors.New("trace: invalid BufferSize")
+	}
+	if !runtime_start(BufferSize) {
+		return errRunning
+	}
+	output = w
+	return nil
+}
+
+// Stop stops the current trace, if any, and writes all recorded events to the
+// writer that was passed to Start.
+func Stop() {
+	if !runtime_enabled() {
+		return
+	}
+	runtime_stop()
+	w := output
+	output = nil
+
+	var buf []byte
+	for i := 0; ; i++ {
+		nanoseconds, kind, task, dropped, ok := runtime_event(i)
+		if i == 0 {
+			buf = append(buf, "tinygo-trace: begin "...)
+			buf = strconv.AppendUint(buf, uint64(dropped), 10)
+			buf = append(buf, '\n')
+		}
+		if !ok {
+			break
+		}
+		buf = append(buf, "tinygo-trace: "...)
+		buf = strconv.AppendInt(buf, nanoseconds, 10)
+		buf = append(buf, ' ')
+		if int(kind) < len(eventNames) && eventNames[kind] != "" {
+			buf = append(buf, eventNames[kind]...)
+		} else {
+			buf = append(buf, "unknown"...)
+		}
+		buf = append(buf, ' ')
+		buf = strconv.AppendUint(buf, uint64(task), 16)
+		buf = append(buf, '\n')
+
+		// Write in small chunks, to avoid allocating a large buffer.
+		if len(buf) >= 256 {
+			w.Write(buf)
+			buf = buf[:0]
+		}
+	}
+	buf = append(buf, "tinygo-trace: end\n"...)
+	w.Write(buf)
+}
+
+// IsEnabled reports whether tracing is enabled.
+func IsEnabled() bool {
+	return runtime_enabled()
+}
+
+func runtime_start(size int) bool // in package runtime
+
+func runtime_stop() // in package runtime
+
+func runtime_enabled() bool // in package runtime
+
+func runtime_event(index int) (nanoseconds int64, kind uint8, task uintptr, dropped uintptr, ok bool) // in package runtime
@@ -0,0 +1,52 @@
+// +build tracehooks.itm
+
+package runtime
+
+// This file streams scheduler and interrupt events over ITM stimulus port 1
+// (-trace-hooks=itm), where they can be timestamped and recorded by a debug
+// probe that captures the SWO output. Each event is a single 32-bit word with
+// the event kind in the upper 8 bits and the lower 24 bits of the goroutine
+// pointer or the interrupt number in the rest. Goroutine pointers are unique in
+// their lower 24 bits as long as RAM is smaller than 16MB.
+//
+// The event kinds are the ones in trace.go, plus the traceEvISR* kinds below.
+
+import (
+	"device/arm"
+	"internal/task"
+	"unsafe"
+)
+
+const traceITMPort = 1
+
+const (
+	traceEvISREnter = 0x80 // interrupt handler starts
+	traceEvISRExit  = 0x81 // interrupt handler returns
+)
+
+func traceHook(kind uint8, t *task.Task) {
+	arm.ITMSendWord(traceITMPort, uint32(kind)<<24|uint32(uintptr(unsafe.Pointer(t)))&0xffffff)
+}
+
+// Goroutines are identified by their pointer, so they don't need to be
+// registered.
+
+func traceTaskCreate(t *task.Task, stackBase, stackSize uintptr) {
+}
+
+func traceTaskExit(t *task.Task) {
+}
+
+// traceISREnter is called by the compiler at the start of every interrupt
+// handler created with runtime/interrupt.New.
+//export tinygo_trace_isr_enter
+func traceISREnter(num uint32) {
+	arm.ITMSendWord(traceITMPort, traceEvISREnter<<24|num&0xffffff)
+}
+
+// traceISRExit is called by the compiler at the end of every interrupt handler
+// created with runtime/interrupt.New.
+//export tinygo_trace_isr_exit
+func traceISRExit(num uint32) {
+	arm.ITMSendWord(traceITMPort, traceEvISRExit<<24|num&0xffffff)
+}
@@ -0,0 +1,19 @@
+// +build !tracehooks.itm,!tracehooks.systemview
+
+package runtime
+
+import "internal/task"
+
+// Trace hooks are disabled: build with -trace-hooks to enable them.
+
+//go:inline
+func traceHook(kind uint8, t *task.Task) {
+}
+
+//go:inline
+func traceTaskCreate(t *task.Task, stackBase, stackSize uintptr) {
+}
+
+//go:inline
+func traceTaskExit(t *task.Task) {
+}
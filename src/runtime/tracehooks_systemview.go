@@ -0,0 +1,126 @@
+// +build tracehooks.systemview
+
+package runtime
+
+// This file reports scheduler and interrupt events to SEGGER SystemView
+// (-trace-hooks=systemview). Every goroutine is shown as a task, identified by
+// its pointer. The SystemView target sources are not part of TinyGo: they must
+// be compiled into the program (for example using CGo) and initialized by the
+// program with SEGGER_SYSVIEW_Conf before any events are recorded.
+//
+// Goroutines are registered as tasks when they start. SystemView only records
+// this while the host is connected, so the program should also pass
+// tinygo_systemview_send_task_list as pfSendTaskList in the OS API given to
+// SEGGER_SYSVIEW_Init: SystemView calls it to get the list of existing tasks
+// when recording starts.
+
+import (
+	"internal/task"
+	"unsafe"
+)
+
+//export SEGGER_SYSVIEW_OnTaskStartExec
+func systemviewOnTaskStartExec(taskID uint32)
+
+//export SEGGER_SYSVIEW_OnTaskStopExec
+func systemviewOnTaskStopExec()
+
+//export SEGGER_SYSVIEW_OnTaskStartReady
+func systemviewOnTaskStartReady(taskID uint32)
+
+//export SEGGER_SYSVIEW_OnTaskStopReady
+func systemviewOnTaskStopReady(taskID uint32, cause uint32)
+
+//export SEGGER_SYSVIEW_OnTaskCreate
+func systemviewOnTaskCreate(taskID uint32)
+
+//export SEGGER_SYSVIEW_OnTaskTerminate
+func systemviewOnTaskTerminate(taskID uint32)
+
+//export SEGGER_SYSVIEW_SendTaskInfo
+func systemviewSendTaskInfo(info *systemviewTaskInfo)
+
+//export SEGGER_SYSVIEW_RecordEnterISR
+func systemviewRecordEnterISR()
+
+//export SEGGER_SYSVIEW_RecordExitISR
+func systemviewRecordExitISR()
+
+// systemviewTaskInfo is SEGGER_SYSVIEW_TASKINFO.
+type systemviewTaskInfo struct {
+	taskID    uint32
+	name      *byte
+	prio      uint32
+	stackBase uint32
+	stackSize uint32
+}
+
+// systemviewTaskName is the NUL terminated name of every goroutine task.
+var systemviewTaskName = [...]byte{'g', 'o', 'r', 'o', 'u', 't', 'i', 'n', 'e', 0}
+
+// traceTaskCreate is called by the internal/task package when a goroutine is
+// started.
+func traceTaskCreate(t *task.Task, stackBase, stackSize uintptr) {
+	id := uint32(uintptr(unsafe.Pointer(t)))
+	systemviewOnTaskCreate(id)
+	systemviewSendTask(id, stackBase, stackSize)
+}
+
+// traceTaskExit is called by the internal/task package when a goroutine exits.
+func traceTaskExit(t *task.Task) {
+	systemviewOnTaskTerminate(uint32(uintptr(unsafe.Pointer(t))))
+}
+
+// systemviewSendTask sends the name and stack of a task to SystemView.
+func systemviewSendTask(id uint32, stackBase, stackSize uintptr) {
+	info := systemviewTaskInfo{
+		taskID:    id,
+		name:      &systemviewTaskName[0],
+		stackBase: uint32(stackBase),
+		stackSize: uint32(stackSize),
+	}
+	systemviewSendTaskInfo(&info)
+}
+
+// systemviewSendTaskList sends all goroutines that have not yet exited to
+// SystemView. It is meant to be used as the pfSendTaskList callback of the
+// SystemView OS API.
+//export tinygo_systemview_send_task_list
+func systemviewSendTaskList() {
+	for i := 0; ; i++ {
+		t, stackBase, stackSize, ok := task.ListTask(i)
+		if !ok {
+			break
+		}
+		systemviewSendTask(uint32(uintptr(unsafe.Pointer(t))), stackBase, stackSize)
+	}
+}
+
+func traceHook(kind uint8, t *task.Task) {
+	id := uint32(uintptr(unsafe.Pointer(t)))
+	switch kind {
+	case traceEvGoStart:
+		systemviewOnTaskStartExec(id)
+	case traceEvGoStop:
+		systemviewOnTaskStopExec()
+	case traceEvGoUnblock:
+		systemviewOnTaskStartReady(id)
+	case traceEvGoBlockSend, traceEvGoBlockRecv, traceEvGoBlockSelect, traceEvGoBlockCond, traceEvGoSleep:
+		// The cause is shown by SystemView as a number, use the event kind.
+		systemviewOnTaskStopReady(id, uint32(kind))
+	}
+}
+
+// traceISREnter is called by the compiler at the start of every interrupt
+// handler created with runtime/interrupt.New.
+//export tinygo_trace_isr_enter
+func traceISREnter(num uint32) {
+	systemviewRecordEnterISR()
+}
+
+// traceISRExit is called by the compiler at the end of every interrupt handler
+// created with runtime/interrupt.New.
+//export tinygo_trace_isr_exit
+func traceISRExit(num uint32) {
+	systemviewRecordExitISR()
+}
@@ -0,0 +1,27 @@
+// +build relocatevectors,cortexm
+
+package runtime
+
+// This file implements the relocate-vectors target option: the vector table
+// offset register (VTOR) is pointed at the vector table of this program at
+// startup. This is needed when the program is started by a bootloader that
+// doesn't do this itself, because the chip otherwise keeps using the vector
+// table of the bootloader for interrupts and faults.
+
+import (
+	"device/arm"
+	"unsafe"
+)
+
+//go:extern _svectors
+var vectorTableSymbol [0]byte
+
+// relocateVectors sets VTOR to the start of the vector table of this program.
+// The vector table must be aligned to its size rounded up to a power of two (at
+// least 128 bytes), which is usually the case for the app-offset of a
+// bootloader.
+func relocateVectors() {
+	arm.SCB.VTOR.Set(uint32(uintptr(unsafe.Pointer(&vectorTableSymbol))))
+	arm.Asm("dsb")
+	arm.Asm("isb")
+}
@@ -0,0 +1,10 @@
+// +build cortexm,!relocatevectors
+
+package runtime
+
+// The vector table is left where it is: set relocate-vectors in the target to
+// change this.
+
+//go:inline
+func relocateVectors() {
+}
@@ -1,5 +1,7 @@
 // +build !tinygo.riscv
 // +build !cortexm
+// +build !freertos
+// +build !customos
 
 package runtime
 
@@ -0,0 +1,45 @@
+// Package watchpoint sets data watchpoints from the program itself, without a
+// debugger attached. A watchpoint stops the program with a fatal error when the
+// watched memory is accessed, which helps to find out what overwrites a
+// variable:
+//
+//     w, err := watchpoint.Set(unsafe.Pointer(&counter), unsafe.Sizeof(counter), watchpoint.Write)
+//
+// The error is printed like a fault, with the registers at that moment, after
+// which the handler set with runtime.SetPanicHandler is called and the chip is
+// reset. The program counter points a few instructions after the one that
+// accessed the memory, as watchpoints are only reported once that instruction
+// has completed.
+//
+// Watchpoints are only supported on Cortex-M3, Cortex-M4 and Cortex-M7, with the
+// comparators of the Data Watchpoint and Trace unit (DWT). When a debugger is
+// attached, it gets to handle the watchpoint instead.
+package watchpoint
+
+import "errors"
+
+var (
+	ErrNotSupported  = errors.New("watchpoint: not supported on this chip")
+	ErrNoneAvailable = errors.New("watchpoint: all comparators are in use")
+	ErrInvalidRange  = errors.New("watchpoint: size must be a power of two and the address must be aligned to it")
+)
+
+// Access is the kind of memory access that triggers a watchpoint.
+type Access uint8
+
+const (
+	Write Access = iota + 1
+	Read
+	ReadWrite
+)
+
+// Watchpoint is a watchpoint that was set with Set.
+type Watchpoint struct {
+	index int
+	valid bool // false for the zero value and when Set returned an error
+}
+
+// validRange returns whether a watchpoint can cover the given memory range.
+func validRange(addr, size uintptr) bool {
+	return size != 0 && size&(size-1) == 0 && addr&(size-1) == 0
+}
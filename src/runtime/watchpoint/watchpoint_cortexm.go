@@ -0,0 +1,119 @@
+// +build cortexm
+
+package watchpoint
+
+import (
+	"device/arm"
+	"unsafe"
+)
+
+// The memory range that is watched by each comparator (there are at most 16),
+// to print it when the watchpoint is hit.
+var watched [16]struct {
+	addr   uintptr
+	size   uintptr
+	access Access
+}
+
+// supported returns whether the chip has an ARMv7-M DWT with a DebugMonitor
+// exception.
+func supported() bool {
+	switch (arm.SCB.CPUID.Get() & arm.SCB_CPUID_PARTNO_Msk) >> arm.SCB_CPUID_PARTNO_Pos {
+	case 0xc23, 0xc24, 0xc27: // Cortex-M3, Cortex-M4, Cortex-M7
+		return true
+	}
+	return false
+}
+
+// Count returns the number of watchpoints that can be set at the same time. It
+// returns 0 if watchpoints are not supported.
+func Count() int {
+	if !supported() {
+		return 0
+	}
+	arm.DEMCR.SetBits(arm.DEMCR_TRCENA_Msk)
+	return int((arm.DWT.CTRL.Get() & arm.DWT_CTRL_NUMCOMP_Msk) >> arm.DWT_CTRL_NUMCOMP_Pos)
+}
+
+// Set sets a watchpoint on size bytes at addr, for the given kind of access.
+// The size must be a power of two, and the address must be aligned to it.
+func Set(addr unsafe.Pointer, size uintptr, access Access) (Watchpoint, error) {
+	if !validRange(uintptr(addr), size) {
+		return Watchpoint{}, ErrInvalidRange
+	}
+	if !supported() {
+		return Watchpoint{}, ErrNotSupported
+	}
+	var function uint32
+	switch access {
+	case Write:
+		function = arm.DWT_FUNCTION_FUNCTION_Write
+	case Read:
+		function = arm.DWT_FUNCTION_FUNCTION_Read
+	default:
+		function = arm.DWT_FUNCTION_FUNCTION_ReadWrite
+	}
+
+	// Look for a free comparator. Some of them may be in use by a debugger.
+	for i := 0; i < Count(); i++ {
+		comp := &arm.DWT.COMP[i]
+		if comp.FUNCTION.Get()&arm.DWT_FUNCTION_FUNCTION_Msk != arm.DWT_FUNCTION_FUNCTION_Disabled {
+			continue
+		}
+		watched[i].addr = uintptr(addr)
+		watched[i].size = size
+		watched[i].access = access
+		mask := uint32(0) // number of address bits to ignore
+		for 1<<mask < size {
+			mask++
+		}
+		comp.COMP.Set(uint32(uintptr(addr)))
+		comp.MASK.Set(mask)
+		comp.FUNCTION.Set(function)
+		// Raise a DebugMonitor exception when the watchpoint is hit. This has
+		// no effect when a debugger is attached, which halts the chip instead.
+		arm.DEMCR.SetBits(arm.DEMCR_MON_EN_Msk)
+		return Watchpoint{index: i, valid: true}, nil
+	}
+	return Watchpoint{}, ErrNoneAvailable
+}
+
+// Clear removes the watchpoint. It does nothing for a watchpoint that was not
+// set (such as the one returned with an error by Set), so that it never
+// touches a comparator in use by a debugger or by another watchpoint.
+func (w Watchpoint) Clear() {
+	if !w.valid || !supported() {
+		return
+	}
+	arm.DWT.COMP[w.index].FUNCTION.Set(arm.DWT_FUNCTION_FUNCTION_Disabled)
+	watched[w.index].size = 0
+}
+
+// handleDebugMonitor is called by the DebugMon_Handler in
+// src/device/arm/cortexm.s, with the stack pointer of the stacked registers.
+//export tinygo_handleDebugMonitor
+func handleDebugMonitor(sp unsafe.Pointer) {
+	for i := 0; i < Count(); i++ {
+		// Reading the FUNCTION register clears the MATCHED bit.
+		if arm.DWT.COMP[i].FUNCTION.Get()&arm.DWT_FUNCTION_MATCHED_Msk == 0 || watched[i].size == 0 {
+			continue
+		}
+		print("fatal error: watchpoint ", i, " hit: ")
+		switch watched[i].access {
+		case Write:
+			print("write to ")
+		case Read:
+			print("read from ")
+		default:
+			print("access to ")
+		}
+		// The PC is the 7th stacked register, after r0-r3, r12 and lr.
+		pc := *(*uintptr)(unsafe.Pointer(uintptr(sp) + 6*4))
+		print(watched[i].size, " bytes at ", unsafe.Pointer(watched[i].addr), " near pc=", unsafe.Pointer(pc))
+		println()
+		runtime_watchpointFault(sp)
+	}
+	// Not one of our watchpoints (or a breakpoint instruction): continue.
+}
+
+func runtime_watchpointFault(sp unsafe.Pointer) // in package runtime
@@ -0,0 +1,25 @@
+// +build !cortexm
+
+package watchpoint
+
+import "unsafe"
+
+// Count returns the number of watchpoints that can be set at the same time. It
+// returns 0 if watchpoints are not supported.
+func Count() int {
+	return 0
+}
+
+// Set sets a watchpoint on size bytes at addr, for the given kind of access.
+// Watchpoints are not supported on this target, so it returns ErrNotSupported
+// for every valid memory range.
+func Set(addr unsafe.Pointer, size uintptr, access Access) (Watchpoint, error) {
+	if !validRange(uintptr(addr), size) {
+		return Watchpoint{}, ErrInvalidRange
+	}
+	return Watchpoint{}, ErrNotSupported
+}
+
+// Clear removes the watchpoint.
+func (w Watchpoint) Clear() {
+}
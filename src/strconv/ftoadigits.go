@@ -0,0 +1,362 @@
+package strconv
+
+// This file generates the decimal digits of a floating point number, both for
+// the shortest representation (like Ryu) and for a fixed number of digits. It
+// is used instead of the Grisu3 and multiprecision decimal code from the Go
+// standard library, to reduce code size and stack usage.
+//
+// Like Ryu, the shortest representation is the shortest decimal that lies
+// within the rounding interval of the float, picking the closest such decimal
+// (ties to even) and treating the interval bounds as inclusive when the
+// mantissa is even. Unlike Ryu, no precomputed tables of powers of five are
+// used. Instead, the digits are computed exactly using a small fixed-size
+// bignum, as described in "Printing Floating-Point Numbers Quickly and
+// Accurately" by Burger and Dybvig. This is slower, but a lot smaller and
+// still fast enough for printing sensor values and the like.
+
+// Number of 32-bit limbs in a bignum. The largest value that needs to be stored
+// is around 2^1080 (for the smallest denormal float64, scaled by 10^324).
+const bignumLimbs = 36
+
+// bignum is a simple unsigned multiprecision integer, stored as little endian
+// 32-bit limbs.
+type bignum struct {
+	n int // number of used limbs (the top one is non-zero)
+	d [bignumLimbs]uint32
+}
+
+// setUint64 sets b to v.
+func (b *bignum) setUint64(v uint64) {
+	b.n = 0
+	for v != 0 {
+		b.d[b.n] = uint32(v)
+		b.n++
+		v >>= 32
+	}
+}
+
+// shiftLeft multiplies b by 2^shift.
+func (b *bignum) shiftLeft(shift uint) {
+	if b.n == 0 {
+		return
+	}
+	limbs := int(shift / 32)
+	shift %= 32
+	if shift != 0 {
+		carry := uint32(0)
+		for i := 0; i < b.n; i++ {
+			v := b.d[i]
+			b.d[i] = v<<shift | carry
+			carry = v >> (32 - shift)
+		}
+		if carry != 0 {
+			b.d[b.n] = carry
+			b.n++
+		}
+	}
+	if limbs != 0 {
+		for i := b.n - 1; i >= 0; i-- {
+			b.d[i+limbs] = b.d[i]
+		}
+		for i := 0; i < limbs; i++ {
+			b.d[i] = 0
+		}
+		b.n += limbs
+	}
+}
+
+// mulSmall multiplies b by m.
+func (b *bignum) mulSmall(m uint32) {
+	carry := uint64(0)
+	for i := 0; i < b.n; i++ {
+		v := uint64(b.d[i])*uint64(m) + carry
+		b.d[i] = uint32(v)
+		carry = v >> 32
+	}
+	if carry != 0 {
+		b.d[b.n] = uint32(carry)
+		b.n++
+	}
+}
+
+// mulPow10 multiplies b by 10^k.
+func (b *bignum) mulPow10(k int) {
+	for ; k >= 9; k -= 9 {
+		b.mulSmall(1e9)
+	}
+	m := uint32(1)
+	for ; k > 0; k-- {
+		m *= 10
+	}
+	b.mulSmall(m)
+}
+
+// add adds x to b.
+func (b *bignum) add(x *bignum) {
+	n := b.n
+	if x.n > n {
+		n = x.n
+	}
+	carry := uint64(0)
+	for i := 0; i < n; i++ {
+		v := carry
+		if i < b.n {
+			v += uint64(b.d[i])
+		}
+		if i < x.n {
+			v += uint64(x.d[i])
+		}
+		b.d[i] = uint32(v)
+		carry = v >> 32
+	}
+	b.n = n
+	if carry != 0 {
+		b.d[b.n] = uint32(carry)
+		b.n++
+	}
+}
+
+// sub subtracts x from b. The value of x must not be larger than b.
+func (b *bignum) sub(x *bignum) {
+	borrow := uint64(0)
+	for i := 0; i < b.n; i++ {
+		y := borrow
+		if i < x.n {
+			y += uint64(x.d[i])
+		}
+		v := uint64(b.d[i]) - y
+		b.d[i] = uint32(v)
+		borrow = v >> 63 // the result wrapped around
+	}
+	for b.n > 0 && b.d[b.n-1] == 0 {
+		b.n--
+	}
+}
+
+// cmp compares b and x and returns -1, 0, or +1.
+func (b *bignum) cmp(x *bignum) int {
+	if b.n != x.n {
+		if b.n < x.n {
+			return -1
+		}
+		return 1
+	}
+	for i := b.n - 1; i >= 0; i-- {
+		if b.d[i] != x.d[i] {
+			if b.d[i] < x.d[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// cmpTwice compares 2*b and x and returns -1, 0, or +1. It avoids a temporary
+// bignum, to save stack space.
+func (b *bignum) cmpTwice(x *bignum) int {
+	for i := bignumLimbs - 1; i >= 0; i-- {
+		var v, low uint32
+		if i < b.n {
+			v = b.d[i] << 1
+		}
+		if i > 0 && i-1 < b.n {
+			low = b.d[i-1] >> 31
+		}
+		v |= low
+		y := uint32(0)
+		if i < x.n {
+			y = x.d[i]
+		}
+		if v != y {
+			if v < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// floatBignums initializes r and s such that r/s is the value of the float with
+// the given mantissa and (unbiased) exponent, and returns an estimate of its
+// decimal exponent k, such that 10^(k-1) <= value < 10^k. The estimate is never
+// too high, but may be one or two too low.
+func floatBignums(r, s *bignum, mant uint64, exp int, flt *floatInfo) int {
+	e2 := exp - int(flt.mantbits)
+	r.setUint64(mant)
+	s.setUint64(1)
+	if e2 >= 0 {
+		r.shiftLeft(uint(e2))
+	} else {
+		s.shiftLeft(uint(-e2))
+	}
+
+	// Estimate the decimal exponent using log10(2) ≈ 1233/4096.
+	log2 := e2 - 1
+	for m := mant; m != 0; m >>= 1 {
+		log2++
+	}
+	return log2 * 1233 >> 12
+}
+
+// scale divides the value of r/s by 10^k, by multiplying either r (and the
+// others) or s.
+func scale(k int, s *bignum, others ...*bignum) {
+	if k >= 0 {
+		s.mulPow10(k)
+		return
+	}
+	for _, b := range others {
+		b.mulPow10(-k)
+	}
+}
+
+// shortestDigits stores in d the shortest decimal that is closer to the float
+// with the given mantissa and (unbiased) exponent than to any other float.
+func shortestDigits(d *decimalSlice, mant uint64, exp int, flt *floatInfo) {
+	d.nd = 0
+	d.dp = 0
+	if mant == 0 {
+		return
+	}
+
+	// The rounding interval is [r-mminus, r+mplus]/s. The float lies halfway
+	// between its neighbors, except when the mantissa is a power of two: then
+	// the float below is closer. All values are multiplied by 4 to keep them
+	// integers. Instead of mplus, the upper bound rhigh = r+mplus is stored
+	// which saves some stack space.
+	var r, s, rhigh, mminus bignum
+	k := floatBignums(&r, &s, mant, exp, flt)
+	e2 := exp - int(flt.mantbits)
+	mminus.setUint64(2)
+	if mant == 1<<flt.mantbits && exp > flt.bias+1 {
+		mminus.setUint64(1)
+	}
+	rhigh.setUint64(2)
+	if e2 >= 0 {
+		mminus.shiftLeft(uint(e2))
+		rhigh.shiftLeft(uint(e2))
+	}
+	r.shiftLeft(2)
+	s.shiftLeft(2)
+	rhigh.add(&r)
+	scale(k, &s, &r, &rhigh, &mminus)
+
+	// When the mantissa is even, the bounds of the rounding interval round to
+	// this float (round half to even) and are therefore allowed.
+	inclusive := mant%2 == 0
+
+	// Fix up the estimate of k, so that the upper bound is below 10^k.
+	for {
+		c := rhigh.cmp(&s)
+		if c < 0 || c == 0 && !inclusive {
+			break
+		}
+		s.mulSmall(10)
+		k++
+	}
+	d.dp = k
+
+	// Generate digits until the remaining value is within the rounding
+	// interval.
+	for {
+		r.mulSmall(10)
+		rhigh.mulSmall(10)
+		mminus.mulSmall(10)
+		digit := byte('0')
+		for r.cmp(&s) >= 0 {
+			r.sub(&s)
+			rhigh.sub(&s)
+			digit++
+		}
+		c := r.cmp(&mminus)
+		low := c < 0 || c == 0 && inclusive
+		c = rhigh.cmp(&s)
+		high := c > 0 || c == 0 && inclusive
+		if low && high {
+			// Both digit and digit+1 are in the rounding interval, pick the
+			// closest one.
+			c := r.cmpTwice(&s)
+			if c > 0 || c == 0 && (digit-'0')%2 == 1 {
+				digit++
+			}
+		} else if high {
+			digit++
+		}
+		d.d = append(d.d, digit)
+		d.nd++
+		if low || high {
+			break
+		}
+	}
+}
+
+// fixedDigits stores in d the float with the given mantissa and (unbiased)
+// exponent, correctly rounded (half to even) to n digits. If fromPoint is set,
+// n is the number of digits after the decimal point instead of the number of
+// significant digits. Trailing zeros are removed.
+func fixedDigits(d *decimalSlice, mant uint64, exp int, flt *floatInfo, n int, fromPoint bool) {
+	d.nd = 0
+	d.dp = 0
+	if mant == 0 {
+		return
+	}
+
+	// Scale so that r/s is the value divided by 10^k, which is in [0.1, 1).
+	var r, s bignum
+	k := floatBignums(&r, &s, mant, exp, flt)
+	scale(k, &s, &r)
+	for r.cmp(&s) >= 0 {
+		s.mulSmall(10)
+		k++
+	}
+	if fromPoint {
+		n += k
+	}
+	if n < 0 {
+		// All digits are rounded away, and the value is less than half of the
+		// last digit.
+		return
+	}
+	d.dp = k
+
+	// Generate the digits. Stop early when the value is exact.
+	for d.nd < n && r.n != 0 {
+		r.mulSmall(10)
+		digit := byte('0')
+		for r.cmp(&s) >= 0 {
+			r.sub(&s)
+			digit++
+		}
+		d.d = append(d.d, digit)
+		d.nd++
+	}
+
+	// Round the last digit.
+	c := r.cmpTwice(&s)
+	if r.n != 0 && (c > 0 || c == 0 && d.nd > 0 && (d.d[d.nd-1]-'0')%2 == 1) {
+		i := d.nd - 1
+		for i >= 0 && d.d[i] == '9' {
+			i--
+		}
+		if i < 0 {
+			// All digits are 9 (or there are no digits at all).
+			d.d = append(d.d[:0], '1')
+			d.nd = 1
+			d.dp++
+			return
+		}
+		d.d[i]++
+		d.nd = i + 1
+	}
+
+	// Remove trailing zeros.
+	for d.nd > 0 && d.d[d.nd-1] == '0' {
+		d.nd--
+	}
+	if d.nd == 0 {
+		d.dp = 0
+	}
+	d.d = d.d[:d.nd]
+}
@@ -1,6 +1,9 @@
 package sync
 
-import "internal/task"
+import (
+	"internal/task"
+	"unsafe"
+)
 
 type Cond struct {
 	L Locker
@@ -76,5 +79,7 @@ func (c *Cond) Wait() {
 
 	// Wait for a signal.
 	c.blocked.Push(task.Current())
+	blockRecord(blockCond, unsafe.Pointer(c), returnAddress(0))
 	task.Pause()
+	blockDone()
 }
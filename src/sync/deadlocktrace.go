@@ -0,0 +1,24 @@
+// +build deadlocktrace
+
+package sync
+
+import "unsafe"
+
+// Kinds of blocking operations, for -deadlocktrace. These must be kept in sync
+// with the runtime package.
+const (
+	blockMutex     = 6
+	blockWaitGroup = 7
+	blockCond      = 8
+)
+
+//go:linkname blockRecord runtime.blockRecord
+func blockRecord(kind uint8, object, pc unsafe.Pointer)
+
+//go:linkname blockDone runtime.blockDone
+func blockDone()
+
+// returnAddress returns the return address of the calling function, for level
+// 0.
+//export llvm.returnaddress
+func returnAddress(level uint32) unsafe.Pointer
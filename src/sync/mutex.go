@@ -2,7 +2,7 @@ package sync
 
 import (
 	"internal/task"
-	_ "unsafe"
+	"unsafe"
 )
 
 // These mutexes assume there is only one thread of operation: no goroutines,
@@ -20,7 +20,9 @@ func (m *Mutex) Lock() {
 	if m.locked {
 		// Push self onto stack of blocked tasks, and wait to be resumed.
 		m.blocked.Push(task.Current())
+		blockRecord(blockMutex, unsafe.Pointer(m), returnAddress(0))
 		task.Pause()
+		blockDone()
 		return
 	}
 
@@ -1,6 +1,9 @@
 package sync
 
-import "internal/task"
+import (
+	"internal/task"
+	"unsafe"
+)
 
 type WaitGroup struct {
 	counter uint
@@ -48,7 +51,9 @@ func (wg *WaitGroup) Wait() {
 
 	// Push the current goroutine onto the waiter stack.
 	wg.waiters.Push(task.Current())
+	blockRecord(blockWaitGroup, unsafe.Pointer(wg), returnAddress(0))
 
 	// Pause until the waiters are awoken by Add/Done.
 	task.Pause()
+	blockDone()
 }
@@ -48,9 +48,18 @@ const (
 )
 
 func Getenv(key string) (value string, found bool) {
-	return "", false // stub
+	// The environment is set at build time or read from flash, see the
+	// runtime package.
+	for _, env := range runtime_envs() {
+		if len(env) > len(key) && env[len(key)] == '=' && env[:len(key)] == key {
+			return env[len(key)+1:], true
+		}
+	}
+	return "", false
 }
 
+func runtime_envs() []string // in package runtime
+
 func Open(path string, mode int, perm uint32) (fd int, err error) {
 	return 0, ENOSYS
 }
@@ -2,6 +2,10 @@
 
 package syscall
 
+import (
+	"unsafe"
+)
+
 // This file defines errno and constants to match the darwin libsystem ABI.
 // Values have been copied from src/syscall/zerrors_darwin_amd64.go.
 
@@ -71,3 +75,91 @@ const (
 	O_TRUNC  = 0x400
 	O_EXCL   = 0x800
 )
+
+const (
+	PROT_NONE  = 0x0
+	PROT_READ  = 0x1
+	PROT_WRITE = 0x2
+	PROT_EXEC  = 0x4
+
+	MAP_SHARED  = 0x1
+	MAP_PRIVATE = 0x2
+	MAP_FIXED   = 0x10
+	MAP_ANON    = 0x1000
+)
+
+const (
+	S_IFMT   = 0xf000
+	S_IFBLK  = 0x6000
+	S_IFCHR  = 0x2000
+	S_IFDIR  = 0x4000
+	S_IFIFO  = 0x1000
+	S_IFLNK  = 0xa000
+	S_IFREG  = 0x8000
+	S_IFSOCK = 0xc000
+	S_ISGID  = 0x400
+	S_ISUID  = 0x800
+	S_ISVTX  = 0x200
+)
+
+type Timespec struct {
+	Sec  int64
+	Nsec int64
+}
+
+// Source: upstream ztypes_darwin_amd64.go, which is the same for arm64.
+type Stat_t struct {
+	Dev           int32
+	Mode          uint16
+	Nlink         uint16
+	Ino           uint64
+	Uid           uint32
+	Gid           uint32
+	Rdev          int32
+	Pad_cgo_0     [4]byte
+	Atimespec     Timespec
+	Mtimespec     Timespec
+	Ctimespec     Timespec
+	Birthtimespec Timespec
+	Size          int64
+	Blocks        int64
+	Blksize       int32
+	Flags         uint32
+	Gen           uint32
+	Lspare        int32
+	Qspare        [2]int64
+}
+
+func Fstat(fd int, st *Stat_t) (err error) {
+	if libc_fstat(fd, st) < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+// Mmap maps length bytes of the file referenced by fd, starting at offset,
+// into memory. The returned slice must be unmapped with Munmap.
+func Mmap(fd int, offset int64, length int, prot int, flags int) (data []byte, err error) {
+	addr := libc_mmap(nil, uintptr(length), prot, flags, fd, offset)
+	if addr == unsafe.Pointer(^uintptr(0)) { // MAP_FAILED
+		return nil, getErrno()
+	}
+	return *(*[]byte)(unsafe.Pointer(&sliceHeader{buf: (*byte)(addr), len: uintptr(length), cap: uintptr(length)})), nil
+}
+
+// Munmap unmaps memory that was mapped with Mmap.
+func Munmap(b []byte) (err error) {
+	buf, length := splitSlice(b)
+	if libc_munmap(unsafe.Pointer(buf), length) < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+// void *mmap(void *addr, size_t len, int prot, int flags, int fd, off_t offset);
+//export mmap
+func libc_mmap(addr unsafe.Pointer, length uintptr, prot, flags, fd int, offset int64) unsafe.Pointer
+
+// int munmap(void *addr, size_t len);
+//export munmap
+func libc_munmap(addr unsafe.Pointer, length uintptr) int
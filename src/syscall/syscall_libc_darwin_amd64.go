@@ -0,0 +1,10 @@
+// +build darwin
+
+package syscall
+
+// The fstat function with a 64-bit inode number, which matches Stat_t. The
+// plain fstat symbol uses a legacy struct layout on amd64.
+//
+// int fstat(int fd, struct stat *buf);
+//export fstat$INODE64
+func libc_fstat(fd int, st *Stat_t) int
@@ -0,0 +1,7 @@
+// +build darwin
+
+package syscall
+
+// int fstat(int fd, struct stat *buf);
+//export fstat
+func libc_fstat(fd int, st *Stat_t) int
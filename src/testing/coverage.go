@@ -0,0 +1,47 @@
+package testing
+
+import (
+	"bufio"
+	"os"
+)
+
+// The coverage data is printed as lines with this prefix, followed by a line
+// that marks the end of the data. This is how the tinygo command extracts the
+// coverage data from the rest of the test output, which may come over a serial
+// connection.
+const (
+	coverageLinePrefix = "tinygo-coverage: "
+	coverageEndLine    = "tinygo-coverage-end"
+)
+
+func runtime_coverageData() (enabled bool, counters []byte, blocks string) // in package runtime
+
+// printCoverage prints the coverage counters as lines of a coverage profile, if
+// the test binary was built with -cover. All lines go through a single buffered
+// writer on os.Stdout, so they are not mixed up with other output.
+func printCoverage() {
+	enabled, counters, blocks := runtime_coverageData()
+	if !enabled {
+		return
+	}
+	w := bufio.NewWriter(os.Stdout)
+	for i := 0; i < len(counters); i++ {
+		end := 0
+		for end < len(blocks) && blocks[end] != '\n' {
+			end++
+		}
+		w.WriteString(coverageLinePrefix)
+		w.WriteString(blocks[:end])
+		if counters[i] != 0 {
+			w.WriteString(" 1\n")
+		} else {
+			w.WriteString(" 0\n")
+		}
+		if end < len(blocks) {
+			end++ // skip newline
+		}
+		blocks = blocks[end:]
+	}
+	w.WriteString(coverageEndLine + "\n")
+	w.Flush()
+}
@@ -10,20 +10,44 @@ package testing
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"io"
 	"os"
 )
 
+// Testing flags.
+var (
+	flagVerbose   *bool
+	flagShort     *bool
+	flagRunRegexp *string
+
+	initRan bool
+)
+
+// Init registers testing flags. It has no effect if it has already run.
+func Init() {
+	if initRan {
+		return
+	}
+	initRan = true
+
+	flagVerbose = flag.Bool("test.v", false, "verbose: print additional output")
+	flagShort = flag.Bool("test.short", false, "run smaller test suite to save time")
+	flagRunRegexp = flag.String("test.run", "", "run only tests and examples matching `regexp`")
+}
+
 // common holds the elements common between T and B and
 // captures common methods such as Errorf.
 type common struct {
 	output io.Writer
+	indent string
 
-	failed   bool   // Test or benchmark has failed.
-	skipped  bool   // Test of benchmark has been skipped.
-	finished bool   // Test function has completed.
-	name     string // Name of test or benchmark.
+	failed   bool     // Test or benchmark has failed.
+	skipped  bool     // Test of benchmark has been skipped.
+	finished bool     // Test function has completed.
+	cleanups []func() // Functions registered with Cleanup, in order.
+	name     string   // Name of test or benchmark.
 }
 
 // TB is the interface common to T and B.
@@ -43,6 +67,7 @@ type TB interface {
 	Skipf(format string, args ...interface{})
 	Skipped() bool
 	Helper()
+	Cleanup(func())
 }
 
 var _ TB = (*T)(nil)
@@ -53,7 +78,12 @@ var _ TB = (*B)(nil)
 //
 type T struct {
 	common
-	indent string
+	context *testContext // For running tests and subtests.
+}
+
+// testContext holds all fields that are common to all tests.
+type testContext struct {
+	match *matcher
 }
 
 // Name returns the name of the running test or benchmark.
@@ -84,9 +114,12 @@ func (c *common) FailNow() {
 
 // log generates the output.
 func (c *common) log(s string) {
-	// This doesn't print the same as in upstream go, but works for now.
-	fmt.Fprintf(c.output, "\t")
-	fmt.Fprintln(c.output, s)
+	// This doesn't print the same as in upstream go (there is no file and line
+	// information), but works for now.
+	if len(s) != 0 && s[len(s)-1] == '\n' {
+		s = s[:len(s)-1]
+	}
+	fmt.Fprintf(c.output, "%s    %s\n", c.indent, s)
 }
 
 // Log formats its arguments using default formatting, analogous to Println,
@@ -155,38 +188,101 @@ func (c *common) Skipped() bool {
 	return c.skipped
 }
 
-// Helper is not implemented, it is only provided for compatibility.
+// Helper marks the calling function as a test helper function. Log messages
+// don't include file and line information in TinyGo, so there is nothing to
+// skip and this is a no-op.
 func (c *common) Helper() {
-	// Unimplemented.
 }
 
-// Run runs a subtest of f t called name. It waits until the subtest is finished
-// and returns whether the subtest succeeded.
+// Cleanup registers a function to be called when the test (or subtest) and all
+// its subtests complete. Cleanup functions will be called in last added,
+// first called order.
+func (c *common) Cleanup(f func()) {
+	c.cleanups = append(c.cleanups, f)
+}
+
+// runCleanup calls all registered cleanup functions, in reverse order.
+func (c *common) runCleanup() {
+	for i := len(c.cleanups) - 1; i >= 0; i-- {
+		c.cleanups[i]()
+	}
+	c.cleanups = nil
+}
+
+// report writes the result of the test (and the output of the test itself) to
+// w. Passing and skipped tests are only reported in verbose mode.
+func (c *common) report(w io.Writer) {
+	switch {
+	case c.failed:
+		fmt.Fprintf(w, "%s--- FAIL: %s\n", c.indent, c.name)
+	case !*flagVerbose:
+		return
+	case c.skipped:
+		fmt.Fprintf(w, "%s--- SKIP: %s\n", c.indent, c.name)
+	default:
+		fmt.Fprintf(w, "%s--- PASS: %s\n", c.indent, c.name)
+	}
+	fmt.Fprint(w, c.output)
+}
+
+// tRunner runs a test function and its cleanup functions, and then reports the
+// result to w.
+func tRunner(t *T, fn func(t *T), w io.Writer) {
+	if *flagVerbose {
+		fmt.Printf("=== RUN   %s\n", t.name)
+	}
+	fn(t)
+	t.runCleanup()
+	t.finished = true
+	t.report(w)
+}
+
+// Run runs f as a subtest of t called name. It waits until the subtest is
+// finished and returns whether the subtest succeeded. Subtests that don't match
+// the -test.run flag are not run and are reported as succeeded.
 func (t *T) Run(name string, f func(t *T)) bool {
-	// Create a subtest.
+	testName, ok, _ := t.context.match.fullName(&t.common, name)
+	if !ok {
+		return true
+	}
+
+	// Create a subtest. Its output is written to the output of the parent
+	// test, so that it is shown after the result of the parent test.
 	sub := T{
-		indent: t.indent + "    ",
 		common: common{
-			name:   t.name + "/" + name,
+			name:   testName,
+			indent: t.indent + "    ",
 			output: &bytes.Buffer{},
 		},
+		context: t.context,
 	}
 
 	// Run the test.
-	fmt.Printf("=== RUN   %s\n", sub.name)
-	f(&sub)
+	tRunner(&sub, f, t.output)
 
 	// Process the result (pass or fail).
 	if sub.failed {
 		t.failed = true
-		fmt.Printf(sub.indent+"--- FAIL: %s\n", sub.name)
-	} else {
-		fmt.Printf(sub.indent+"--- PASS: %s\n", sub.name)
 	}
-	fmt.Print(sub.output)
 	return !sub.failed
 }
 
+// Short reports whether the -test.short flag is set.
+func Short() bool {
+	if flagShort == nil {
+		panic("testing: Short called before Init")
+	}
+	return *flagShort
+}
+
+// Verbose reports whether the -test.v flag is set.
+func Verbose() bool {
+	if flagVerbose == nil {
+		panic("testing: Verbose called before Init")
+	}
+	return *flagVerbose
+}
+
 // InternalTest is a reference to a test that should be called during a test suite run.
 type InternalTest struct {
 	Name string
@@ -197,43 +293,55 @@ type InternalTest struct {
 type M struct {
 	// tests is a list of the test names to execute
 	Tests []InternalTest
+
+	deps interface{}
 }
 
 // Run the test suite.
 func (m *M) Run() int {
-	if len(m.Tests) == 0 {
-		fmt.Fprintln(os.Stderr, "testing: warning: no tests to run")
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+
+	ctx := &testContext{
+		match: newMatcher(m.deps, *flagRunRegexp, "-test.run"),
 	}
 
 	failures := 0
+	ran := false
 	for _, test := range m.Tests {
+		testName, ok, _ := ctx.match.fullName(nil, test.Name)
+		if !ok {
+			continue
+		}
+		ran = true
 		t := &T{
 			common: common{
-				name:   test.Name,
+				name:   testName,
 				output: &bytes.Buffer{},
 			},
+			context: ctx,
 		}
 
-		fmt.Printf("=== RUN   %s\n", test.Name)
-		test.F(t)
-
-		if t.failed {
-			fmt.Printf("--- FAIL: %s\n", test.Name)
-		} else {
-			fmt.Printf("--- PASS: %s\n", test.Name)
-		}
-		fmt.Print(t.output)
+		tRunner(t, test.F, os.Stdout)
 
 		if t.failed {
 			failures++
 		}
 	}
+	if !ran {
+		fmt.Fprintln(os.Stderr, "testing: warning: no tests to run")
+	}
 
 	if failures > 0 {
 		fmt.Println("FAIL")
 	} else {
 		fmt.Println("PASS")
 	}
+
+	// Print coverage data after the result, if the test binary was built
+	// with -cover.
+	printCoverage()
 	return failures
 }
 
@@ -242,8 +350,10 @@ func TestMain(m *M) {
 }
 
 func MainStart(deps interface{}, tests []InternalTest, benchmarks []InternalBenchmark, examples []InternalExample) *M {
+	Init()
 	return &M{
 		Tests: tests,
+		deps:  deps,
 	}
 }
 
@@ -0,0 +1,113 @@
+package unicode
+
+// This file implements simple case mapping using the compressed tables in
+// casemap_tables.go, which are generated by the loader (loader/unicode.go) from
+// the CaseRanges table of the GOROOT in use, so that they match its Unicode
+// version. The CaseRanges table itself is only kept if a program
+// references it directly, which saves several kilobytes of flash in programs
+// that use functions like strings.ToUpper.
+//
+// The case ranges are stored per block of 1<<caseBlockShift runes. Ranges that
+// cross a block boundary are split in two. The data of a block is a list of
+// ranges, each encoded as follows:
+//
+//   - the distance from the end of the previous range (or the start of the
+//     block) to the start of this range, as an unsigned varint
+//   - the number of runes in the range minus one, as an unsigned varint
+//   - one byte with the kind of range (see below)
+//   - depending on the kind, zero, one or three deltas as zigzag encoded
+//     signed varints
+
+// Kinds of case ranges in caseData. These must be kept in sync with
+// loader/unicode.go.
+const (
+	caseKindUpperLower    = iota // {UpperLower, UpperLower, UpperLower}
+	caseKindUpperLowerOdd        // same, but the range starts at a lower case rune
+	caseKindUpper                // {0, x, 0}
+	caseKindLower                // {x, 0, x}
+	caseKindOther                // {x, y, z}
+)
+
+// lookupCase returns the case range that contains r, or false if there is no
+// case mapping for r.
+func lookupCase(r rune) (cr CaseRange, ok bool) {
+	block := uint32(r) >> caseBlockShift // negative runes result in a large block number
+	if block >= uint32(len(caseBlocks)) || caseBlocks[block] == 0 {
+		return CaseRange{}, false
+	}
+	n := int(caseBlocks[block]) - 1
+	p := int(caseIndex[n*2]) | int(caseIndex[n*2+1])<<8
+	end := int(caseIndex[n*2+2]) | int(caseIndex[n*2+3])<<8
+	next := rune(block) << caseBlockShift
+	for p < end {
+		var gap, length uint32
+		gap, p = caseUvarint(p)
+		length, p = caseUvarint(p)
+		lo := next + rune(gap)
+		hi := lo + rune(length)
+		kind := caseData[p]
+		p++
+		var delta d
+		switch kind {
+		case caseKindUpperLower, caseKindUpperLowerOdd:
+			delta = d{UpperLower, UpperLower, UpperLower}
+		case caseKindUpper:
+			delta[LowerCase], p = caseVarint(p)
+		case caseKindLower:
+			delta[UpperCase], p = caseVarint(p)
+			delta[TitleCase] = delta[UpperCase]
+		default:
+			for i := range delta {
+				delta[i], p = caseVarint(p)
+			}
+		}
+		if r < lo {
+			// The ranges are sorted, so r is not in any of them.
+			break
+		}
+		if r <= hi {
+			if kind == caseKindUpperLowerOdd {
+				// The sequence really starts one rune earlier (in the previous
+				// block). Only the parity of Lo matters in convertCase.
+				lo--
+			}
+			return CaseRange{Lo: uint32(lo), Hi: uint32(hi), Delta: delta}, true
+		}
+		next = hi + 1
+	}
+	return CaseRange{}, false
+}
+
+// toCase maps the rune using the compressed case tables. It is equivalent to
+// to(_case, r, CaseRanges).
+func toCase(_case int, r rune) (mappedRune rune, foundMapping bool) {
+	if _case < 0 || MaxCase <= _case {
+		return ReplacementChar, false // as reasonable an error as any
+	}
+	if cr, ok := lookupCase(r); ok {
+		return convertCase(_case, r, &cr), true
+	}
+	return r, false
+}
+
+// caseUvarint decodes an unsigned varint in caseData at offset p. It returns
+// the value and the offset just after it.
+func caseUvarint(p int) (uint32, int) {
+	var x uint32
+	var shift uint
+	for {
+		c := caseData[p]
+		p++
+		x |= uint32(c&0x7f) << shift
+		if c < 0x80 {
+			return x, p
+		}
+		shift += 7
+	}
+}
+
+// caseVarint decodes a zigzag encoded signed varint in caseData at offset p.
+func caseVarint(p int) (rune, int) {
+	x, p := caseUvarint(p)
+	return rune(x>>1) ^ -rune(x&1), p
+}
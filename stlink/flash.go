@@ -0,0 +1,497 @@
+package stlink
+
+// This file implements flash programming of STM32 chips, by directly writing
+// to the registers of the flash controller over SWD. Only the STM32F1 and
+// STM32F4 families are supported for now.
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Address of the DBGMCU_IDCODE register on Cortex-M3/M4 based STM32 chips.
+const regDBGMCUIDCode = 0xe0042000
+
+// Keys that must be written to the KEYR register to unlock the flash
+// controller. They are the same for all STM32 families.
+const (
+	flashKey1 = 0x45670123
+	flashKey2 = 0xcdef89ab
+)
+
+// chipFamily is a group of STM32 chips with the same flash controller.
+type chipFamily int
+
+const (
+	familySTM32F1 chipFamily = iota + 1
+	familySTM32F4
+)
+
+// STM32F1 flash controller (see RM0008).
+const (
+	f1FlashKEYR = 0x40022004
+	f1FlashSR   = 0x4002200c
+	f1FlashCR   = 0x40022010
+	f1FlashAR   = 0x40022014
+
+	f1SRBusy     = 1 << 0
+	f1SRPgErr    = 1 << 2
+	f1SRWrPrtErr = 1 << 4
+	f1SREOP      = 1 << 5
+
+	f1CRPG   = 1 << 0
+	f1CRPER  = 1 << 1
+	f1CRMER  = 1 << 2
+	f1CRSTRT = 1 << 6
+	f1CRLock = 1 << 7
+
+	// Flash size in kilobytes, as a 16-bit value.
+	f1FlashSizeReg = 0x1ffff7e0
+)
+
+// STM32F4 flash controller (see RM0090).
+const (
+	f4FlashKEYR  = 0x40023c04
+	f4FlashSR    = 0x40023c0c
+	f4FlashCR    = 0x40023c10
+	f4FlashOPTCR = 0x40023c14
+
+	f4SRErrors = 0xf2 // OPERR, WRPERR, PGAERR, PGPERR and PGSERR
+	f4SRBusy   = 1 << 16
+
+	f4CRPG      = 1 << 0
+	f4CRSER     = 1 << 1
+	f4CRMER     = 1 << 2
+	f4CRPSize32 = 2 << 8
+	f4CRMER1    = 1 << 15
+	f4CRSTRT    = 1 << 16
+	f4CRLock    = 1 << 31
+
+	// Dual bank mode of 1MB STM32F42x/43x and STM32F469/479 chips.
+	f4OPTCRDB1M = 1 << 30
+
+	// Flash size in kilobytes, in the upper 16 bits of this word.
+	f4FlashSizeReg = 0x1fff7a20
+)
+
+// Start of the flash memory on all STM32 chips.
+const flashBase = 0x08000000
+
+// chip describes the flash layout of a connected STM32 chip.
+type chip struct {
+	name      string
+	family    chipFamily
+	flashSize uint32 // in bytes
+	pageSize  uint32 // erase page size (STM32F1 only)
+	dualBank  bool   // flash is split in two banks (STM32F4 only)
+}
+
+// f1PageSizes maps the STM32F1 device IDs to the size of a flash page.
+var f1PageSizes = map[uint32]uint32{
+	0x410: 1024, // medium-density
+	0x412: 1024, // low-density
+	0x414: 2048, // high-density
+	0x418: 2048, // connectivity line
+	0x420: 1024, // medium-density value line
+	0x428: 2048, // high-density value line
+	0x430: 2048, // XL-density
+}
+
+// f4DeviceIDs lists the device IDs of STM32F4 chips.
+var f4DeviceIDs = map[uint32]string{
+	0x413: "STM32F405/407/415/417",
+	0x419: "STM32F42x/43x",
+	0x421: "STM32F446",
+	0x423: "STM32F401xB/C",
+	0x431: "STM32F411",
+	0x433: "STM32F401xD/E",
+	0x434: "STM32F469/479",
+	0x441: "STM32F412",
+	0x458: "STM32F410",
+	0x463: "STM32F413/423",
+}
+
+// detectChip reads the device ID of the target and returns its flash layout.
+func (dev *Device) detectChip() (*chip, error) {
+	idcode, err := dev.ReadRegister(regDBGMCUIDCode)
+	if err != nil {
+		return nil, err
+	}
+	deviceID := idcode & 0xfff
+	if pageSize, ok := f1PageSizes[deviceID]; ok {
+		size, err := dev.ReadRegister(f1FlashSizeReg)
+		if err != nil {
+			return nil, err
+		}
+		flashSize := (size & 0xffff) * 1024
+		if deviceID == 0x430 && flashSize > 512*1024 {
+			// Only the first bank of XL-density devices is supported.
+			flashSize = 512 * 1024
+		}
+		return &chip{
+			name:      fmt.Sprintf("STM32F1 (device ID %#03x)", deviceID),
+			family:    familySTM32F1,
+			flashSize: flashSize,
+			pageSize:  pageSize,
+		}, nil
+	}
+	if name, ok := f4DeviceIDs[deviceID]; ok {
+		size, err := dev.ReadRegister(f4FlashSizeReg)
+		if err != nil {
+			return nil, err
+		}
+		flashSize := (size >> 16) * 1024
+		optcr, err := dev.ReadRegister(f4FlashOPTCR)
+		if err != nil {
+			return nil, err
+		}
+		return &chip{
+			name:      name,
+			family:    familySTM32F4,
+			flashSize: flashSize,
+			dualBank:  f4DualBank(deviceID, flashSize, optcr),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported chip with device ID %#03x: only STM32F1 and STM32F4 chips can be flashed with the built-in ST-Link driver, use openocd instead", deviceID)
+}
+
+// f4DualBank returns whether the flash of the STM32F4 with the given device
+// ID, flash size and FLASH_OPTCR value is split in two banks. Only the
+// STM32F42x/43x and STM32F469/479 have two banks: always with 2MB of flash and
+// with 1MB of flash when the DB1M option bit is set. Other chips, such as the
+// STM32F413/423 with 1.5MB of flash, have a single bank.
+func f4DualBank(deviceID, flashSize, optcr uint32) bool {
+	if deviceID != 0x419 && deviceID != 0x434 {
+		return false
+	}
+	switch flashSize {
+	case 2048 * 1024:
+		return true
+	case 1024 * 1024:
+		return optcr&f4OPTCRDB1M != 0
+	default:
+		return false
+	}
+}
+
+// f4Sectors returns the sector numbers (as used in the SNB field of the
+// FLASH_CR register) and the address ranges of the sectors of an STM32F4 with
+// the given flash size. Each bank has 4 sectors of 16kB, one of 64kB and any
+// number of 128kB sectors to fill the bank.
+func f4Sectors(flashSize uint32, dualBank bool) (numbers []uint32, starts []uint32, sizes []uint32) {
+	bankSize := flashSize
+	banks := uint32(1)
+	if dualBank {
+		bankSize = flashSize / 2
+		banks = 2
+	}
+	address := uint32(flashBase)
+	for bank := uint32(0); bank < banks; bank++ {
+		var offset uint32
+		for n := uint32(0); offset < bankSize; n++ {
+			size := uint32(128 * 1024)
+			if n < 4 {
+				size = 16 * 1024
+			} else if n == 4 {
+				size = 64 * 1024
+			}
+			// Sectors in the second bank are numbered starting at 0x10.
+			numbers = append(numbers, bank<<4|n)
+			starts = append(starts, address)
+			sizes = append(sizes, size)
+			address += size
+			offset += size
+		}
+	}
+	return
+}
+
+// Flash writes the given data to the flash memory of the target at the
+// given address. Only the pages or sectors that are written to are erased
+// first. The target is left halted.
+func (dev *Device) Flash(address uint32, data []byte) error {
+	err := dev.ResetHalt()
+	if err != nil {
+		return err
+	}
+	chip, err := dev.detectChip()
+	if err != nil {
+		return err
+	}
+	if address < flashBase || address+uint32(len(data)) > flashBase+chip.flashSize {
+		return fmt.Errorf("cannot write %d bytes at %#08x: %s has %dkB of flash at %#08x", len(data), address, chip.name, chip.flashSize/1024, flashBase)
+	}
+	// Pad the data to a multiple of 4 bytes, with the value of erased flash.
+	padded := bytes.Repeat([]byte{0xff}, (len(data)+3)&^3)
+	copy(padded, data)
+	data = padded
+	switch chip.family {
+	case familySTM32F1:
+		return dev.flashF1(chip, address, data)
+	case familySTM32F4:
+		return dev.flashF4(chip, address, data)
+	default:
+		panic("unreachable")
+	}
+}
+
+// MassErase erases the entire flash memory of the target. The target is left
+// halted.
+func (dev *Device) MassErase() error {
+	err := dev.ResetHalt()
+	if err != nil {
+		return err
+	}
+	chip, err := dev.detectChip()
+	if err != nil {
+		return err
+	}
+	switch chip.family {
+	case familySTM32F1:
+		err = dev.unlock(f1FlashKEYR, f1FlashCR, f1CRLock)
+		if err != nil {
+			return err
+		}
+		err = dev.f1Command(f1CRMER, 0)
+		if err != nil {
+			return err
+		}
+		return dev.WriteRegister(f1FlashCR, f1CRLock)
+	case familySTM32F4:
+		err = dev.unlock(f4FlashKEYR, f4FlashCR, f4CRLock)
+		if err != nil {
+			return err
+		}
+		cr := uint32(f4CRPSize32 | f4CRMER)
+		if chip.dualBank {
+			cr |= f4CRMER1
+		}
+		err = dev.f4Command(cr, 60*time.Second)
+		if err != nil {
+			return err
+		}
+		return dev.WriteRegister(f4FlashCR, f4CRLock)
+	default:
+		panic("unreachable")
+	}
+}
+
+// Verify reads back the flash memory of the target at the given address and
+// returns an error if it doesn't match data.
+func (dev *Device) Verify(address uint32, data []byte) error {
+	readback := make([]byte, (len(data)+3)&^3)
+	err := dev.ReadMemory(address, readback)
+	if err != nil {
+		return err
+	}
+	readback = readback[:len(data)]
+	if !bytes.Equal(readback, data) {
+		for i := range data {
+			if data[i] != readback[i] {
+				return fmt.Errorf("verify failed: flash at %#08x is %#02x instead of %#02x", address+uint32(i), readback[i], data[i])
+			}
+		}
+	}
+	return nil
+}
+
+// unlock unlocks the flash controller for erasing and programming, if it
+// isn't already unlocked.
+func (dev *Device) unlock(keyr, cr, lockBit uint32) error {
+	value, err := dev.ReadRegister(cr)
+	if err != nil {
+		return err
+	}
+	if value&lockBit == 0 {
+		return nil
+	}
+	err = dev.WriteRegister(keyr, flashKey1)
+	if err != nil {
+		return err
+	}
+	err = dev.WriteRegister(keyr, flashKey2)
+	if err != nil {
+		return err
+	}
+	value, err = dev.ReadRegister(cr)
+	if err != nil {
+		return err
+	}
+	if value&lockBit != 0 {
+		return fmt.Errorf("could not unlock the flash controller")
+	}
+	return nil
+}
+
+// flashF1 erases and programs the flash of an STM32F1. The flash controller
+// only supports 16-bit writes.
+func (dev *Device) flashF1(chip *chip, address uint32, data []byte) error {
+	err := dev.unlock(f1FlashKEYR, f1FlashCR, f1CRLock)
+	if err != nil {
+		return err
+	}
+
+	// Erase all pages that will be written to.
+	start := address &^ (chip.pageSize - 1)
+	for page := start; page < address+uint32(len(data)); page += chip.pageSize {
+		err = dev.f1Command(f1CRPER, page)
+		if err != nil {
+			return fmt.Errorf("could not erase page at %#08x: %w", page, err)
+		}
+	}
+
+	// Program the data, a chunk at a time. The bus stalls while a half-word
+	// is being programmed, so the writes don't need to poll the busy flag.
+	err = dev.WriteRegister(f1FlashCR, f1CRPG)
+	if err != nil {
+		return err
+	}
+	for offset := 0; offset < len(data); offset += maxTransferSize {
+		chunk := data[offset:]
+		if len(chunk) > maxTransferSize {
+			chunk = chunk[:maxTransferSize]
+		}
+		err = dev.writeMemory16(address+uint32(offset), chunk)
+		if err != nil {
+			return err
+		}
+		err = dev.f1Wait(time.Second)
+		if err != nil {
+			return fmt.Errorf("could not program flash at %#08x: %w", address+uint32(offset), err)
+		}
+	}
+	return dev.WriteRegister(f1FlashCR, f1CRLock)
+}
+
+// f1Command starts an erase operation (page erase or mass erase) on an
+// STM32F1 and waits for it to finish.
+func (dev *Device) f1Command(cr, address uint32) error {
+	err := dev.WriteRegister(f1FlashCR, cr)
+	if err != nil {
+		return err
+	}
+	if cr&f1CRPER != 0 {
+		err = dev.WriteRegister(f1FlashAR, address)
+		if err != nil {
+			return err
+		}
+	}
+	err = dev.WriteRegister(f1FlashCR, cr|f1CRSTRT)
+	if err != nil {
+		return err
+	}
+	err = dev.f1Wait(10 * time.Second)
+	if err != nil {
+		return err
+	}
+	return dev.WriteRegister(f1FlashCR, 0)
+}
+
+// f1Wait waits until the STM32F1 flash controller is no longer busy and
+// checks for errors.
+func (dev *Device) f1Wait(timeout time.Duration) error {
+	err := dev.waitFor(f1FlashSR, f1SRBusy, 0, timeout)
+	if err != nil {
+		return err
+	}
+	sr, err := dev.ReadRegister(f1FlashSR)
+	if err != nil {
+		return err
+	}
+	// Clear the status flags by writing ones to them.
+	err = dev.WriteRegister(f1FlashSR, f1SREOP|f1SRPgErr|f1SRWrPrtErr)
+	if err != nil {
+		return err
+	}
+	if sr&f1SRWrPrtErr != 0 {
+		return fmt.Errorf("flash is write protected")
+	}
+	if sr&f1SRPgErr != 0 {
+		return fmt.Errorf("programming error (flash not erased?)")
+	}
+	return nil
+}
+
+// flashF4 erases and programs the flash of an STM32F4, using 32-bit writes.
+// This requires a supply voltage of at least 2.7V.
+func (dev *Device) flashF4(chip *chip, address uint32, data []byte) error {
+	err := dev.unlock(f4FlashKEYR, f4FlashCR, f4CRLock)
+	if err != nil {
+		return err
+	}
+
+	// Erase all sectors that will be written to.
+	end := address + uint32(len(data))
+	numbers, starts, sizes := f4Sectors(chip.flashSize, chip.dualBank)
+	for i, number := range numbers {
+		if starts[i]+sizes[i] <= address || starts[i] >= end {
+			continue
+		}
+		err = dev.f4Command(f4CRPSize32|f4CRSER|number<<3, 10*time.Second)
+		if err != nil {
+			return fmt.Errorf("could not erase sector %d: %w", number, err)
+		}
+	}
+
+	// Program the data, a chunk at a time.
+	err = dev.WriteRegister(f4FlashCR, f4CRPSize32|f4CRPG)
+	if err != nil {
+		return err
+	}
+	for offset := 0; offset < len(data); offset += maxTransferSize {
+		chunk := data[offset:]
+		if len(chunk) > maxTransferSize {
+			chunk = chunk[:maxTransferSize]
+		}
+		err = dev.WriteMemory(address+uint32(offset), chunk)
+		if err != nil {
+			return err
+		}
+		err = dev.f4Wait(time.Second)
+		if err != nil {
+			return fmt.Errorf("could not program flash at %#08x: %w", address+uint32(offset), err)
+		}
+	}
+	return dev.WriteRegister(f4FlashCR, f4CRLock)
+}
+
+// f4Command starts an erase operation (sector erase or mass erase) on an
+// STM32F4 and waits for it to finish.
+func (dev *Device) f4Command(cr uint32, timeout time.Duration) error {
+	err := dev.WriteRegister(f4FlashCR, cr)
+	if err != nil {
+		return err
+	}
+	err = dev.WriteRegister(f4FlashCR, cr|f4CRSTRT)
+	if err != nil {
+		return err
+	}
+	err = dev.f4Wait(timeout)
+	if err != nil {
+		return err
+	}
+	return dev.WriteRegister(f4FlashCR, 0)
+}
+
+// f4Wait waits until the STM32F4 flash controller is no longer busy and
+// checks for errors.
+func (dev *Device) f4Wait(timeout time.Duration) error {
+	err := dev.waitFor(f4FlashSR, f4SRBusy, 0, timeout)
+	if err != nil {
+		return err
+	}
+	sr, err := dev.ReadRegister(f4FlashSR)
+	if err != nil {
+		return err
+	}
+	// Clear the status flags by writing ones to them.
+	err = dev.WriteRegister(f4FlashSR, sr)
+	if err != nil {
+		return err
+	}
+	if sr&f4SRErrors != 0 {
+		return fmt.Errorf("flash error (FLASH_SR=%#08x)", sr)
+	}
+	return nil
+}
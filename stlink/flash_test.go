@@ -0,0 +1,46 @@
+package stlink
+
+import "testing"
+
+func TestF4Sectors(t *testing.T) {
+	for _, tc := range []struct {
+		deviceID  uint32
+		flashSize uint32
+		optcr     uint32 // value of FLASH_OPTCR
+		sectors   int
+		last      uint32 // number of the last sector
+		end       uint32 // end address of the last sector
+	}{
+		{0x423, 256 * 1024, 0, 6, 5, 0x08040000},            // STM32F401xC
+		{0x433, 512 * 1024, 0, 8, 7, 0x08080000},            // STM32F401xE
+		{0x413, 1024 * 1024, 0, 12, 11, 0x08100000},         // STM32F407xG
+		{0x419, 1024 * 1024, 0, 12, 11, 0x08100000},         // STM32F429xG, single bank
+		{0x419, 1024 * 1024, 1 << 30, 16, 0x17, 0x08100000}, // STM32F429xG, DB1M set
+		{0x463, 1536 * 1024, 0, 16, 15, 0x08180000},         // STM32F413xH, single bank
+		{0x419, 2048 * 1024, 0, 24, 0x1b, 0x08200000},       // STM32F429xI
+		{0x434, 2048 * 1024, 0, 24, 0x1b, 0x08200000},       // STM32F469xI
+	} {
+		dualBank := f4DualBank(tc.deviceID, tc.flashSize, tc.optcr)
+		numbers, starts, sizes := f4Sectors(tc.flashSize, dualBank)
+		name := f4DeviceIDs[tc.deviceID]
+		if len(numbers) != tc.sectors {
+			t.Errorf("%s with %dkB: expected %d sectors, got %d", name, tc.flashSize/1024, tc.sectors, len(numbers))
+			continue
+		}
+		last := len(numbers) - 1
+		if numbers[last] != tc.last {
+			t.Errorf("%s with %dkB: expected last sector %#x, got %#x", name, tc.flashSize/1024, tc.last, numbers[last])
+		}
+		if end := starts[last] + sizes[last]; end != tc.end {
+			t.Errorf("%s with %dkB: expected end of flash at %#08x, got %#08x", name, tc.flashSize/1024, tc.end, end)
+		}
+		if starts[4] != 0x08010000 || sizes[4] != 64*1024 {
+			t.Errorf("%s with %dkB: unexpected sector 4 at %#08x (%d bytes)", name, tc.flashSize/1024, starts[4], sizes[4])
+		}
+		for i := 1; i < len(numbers); i++ {
+			if starts[i] != starts[i-1]+sizes[i-1] {
+				t.Errorf("%s with %dkB: sector %#x does not start at the end of the previous sector", name, tc.flashSize/1024, numbers[i])
+			}
+		}
+	}
+}
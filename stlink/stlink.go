@@ -0,0 +1,445 @@
+// Package stlink implements a small driver for ST-Link v2 and v3 debug probes.
+// It talks to the probe directly over USB, so that STM32 chips can be flashed
+// and reset without an OpenOCD installation.
+//
+// Only the parts of the ST-Link protocol that are needed for flashing are
+// implemented: entering SWD mode, reading and writing target memory and
+// resetting the target. Flash programming itself is done by writing to the
+// flash controller registers of the chip, see flash.go.
+package stlink
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// USB vendor ID of STMicroelectronics.
+const vendorID = 0x0483
+
+// probeInfo describes a known ST-Link product.
+type probeInfo struct {
+	productID uint16
+	name      string
+	epOut     uint8 // endpoint for commands and data to the probe
+	epIn      uint8 // endpoint for data from the probe
+}
+
+// knownProbes lists all supported ST-Link variants. The ST-Link v2 uses a
+// different OUT endpoint than the later versions.
+var knownProbes = []probeInfo{
+	{0x3748, "ST-Link/V2", 0x02, 0x81},
+	{0x374b, "ST-Link/V2-1", 0x01, 0x81},
+	{0x3752, "ST-Link/V2-1", 0x01, 0x81},
+	{0x374e, "STLINK-V3", 0x01, 0x81},
+	{0x374f, "STLINK-V3", 0x01, 0x81},
+	{0x3753, "STLINK-V3", 0x01, 0x81},
+	{0x3754, "STLINK-V3", 0x01, 0x81},
+}
+
+// ST-Link commands. The first byte of every command selects the command
+// group, the second byte (if any) the command within that group.
+const (
+	cmdGetVersion     = 0xf1
+	cmdDebug          = 0xf2
+	cmdDFU            = 0xf3
+	cmdSWIM           = 0xf4
+	cmdGetCurrentMode = 0xf5
+
+	dfuExit  = 0x07
+	swimExit = 0x01
+
+	debugReadMem32    = 0x07
+	debugWriteMem32   = 0x08
+	debugExit         = 0x21
+	debugEnter        = 0x30
+	debugWriteDebugRg = 0x35
+	debugReadDebugRg  = 0x36
+	debugLastRWStatus = 0x3b
+	debugWriteMem16   = 0x48
+	debugEnterSWD     = 0xa3
+)
+
+// Modes the probe can be in, as returned by cmdGetCurrentMode.
+const (
+	modeDFU   = 0x00
+	modeDebug = 0x02
+	modeSWIM  = 0x03
+)
+
+// Status code returned by the probe on success.
+const statusOK = 0x80
+
+// Maximum number of bytes transferred in a single memory read or write. The
+// probe supports somewhat larger transfers but this size works on all probe
+// versions.
+const maxTransferSize = 1024
+
+// Cortex-M debug registers used to halt and reset the core.
+const (
+	regAIRCR = 0xe000ed0c
+	regDHCSR = 0xe000edf0
+	regDEMCR = 0xe000edfc
+
+	dhcsrKey     = 0xa05f0000
+	dhcsrDebugEn = 1 << 0
+	dhcsrHalt    = 1 << 1
+	dhcsrSHalt   = 1 << 17
+
+	aircrKey         = 0x05fa0000
+	aircrSysResetReq = 1 << 2
+
+	demcrVCCoreReset = 1 << 0
+)
+
+// usbDevice is the platform specific connection to the probe: a pair of bulk
+// endpoints.
+type usbDevice interface {
+	write(ep uint8, data []byte) error
+	read(ep uint8, data []byte) (int, error)
+	Close() error
+}
+
+// Device is an open connection to an ST-Link probe.
+type Device struct {
+	usb         usbDevice
+	info        probeInfo
+	version     int // major version of the probe (2 or 3)
+	jtagVersion int // version of the JTAG/SWD firmware
+}
+
+// errNotFound is returned by Open when no ST-Link is connected.
+var errNotFound = errors.New("no ST-Link probe found")
+
+// Open opens the first ST-Link probe that is connected to the system and puts
+// it in SWD debug mode.
+func Open() (*Device, error) {
+	usb, info, err := openUSB()
+	if err != nil {
+		return nil, err
+	}
+	dev := &Device{
+		usb:  usb,
+		info: info,
+	}
+	err = dev.init()
+	if err != nil {
+		usb.Close()
+		return nil, err
+	}
+	return dev, nil
+}
+
+// init reads the probe version and enters SWD mode.
+func (dev *Device) init() error {
+	buf := make([]byte, 6)
+	err := dev.command([]byte{cmdGetVersion}, buf)
+	if err != nil {
+		return fmt.Errorf("could not read ST-Link version: %w", err)
+	}
+	version := binary.BigEndian.Uint16(buf)
+	dev.version = int(version>>12) & 0xf
+	dev.jtagVersion = int(version>>6) & 0x3f
+	if dev.version == 2 && dev.jtagVersion < 22 {
+		// Older firmware does not support the commands used here, such as
+		// reading the status of the last memory access.
+		return fmt.Errorf("ST-Link firmware too old (V%dJ%d), please upgrade it using the ST-Link firmware upgrade tool", dev.version, dev.jtagVersion)
+	}
+
+	// Leave whatever mode the probe is in and enter the debug mode.
+	mode, err := dev.currentMode()
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case modeDFU:
+		err = dev.command([]byte{cmdDFU, dfuExit}, nil)
+	case modeSWIM:
+		err = dev.command([]byte{cmdSWIM, swimExit}, nil)
+	case modeDebug:
+		err = dev.command([]byte{cmdDebug, debugExit}, nil)
+	}
+	if err != nil {
+		return err
+	}
+	err = dev.checkedCommand([]byte{cmdDebug, debugEnter, debugEnterSWD})
+	if err != nil {
+		return fmt.Errorf("could not enter SWD mode: %w", err)
+	}
+	return nil
+}
+
+// String returns a human readable name of the probe, including its firmware
+// version.
+func (dev *Device) String() string {
+	return fmt.Sprintf("%s (V%dJ%d)", dev.info.name, dev.version, dev.jtagVersion)
+}
+
+// Close leaves the debug mode, so that the target continues running, and
+// closes the connection to the probe.
+func (dev *Device) Close() error {
+	err := dev.command([]byte{cmdDebug, debugExit}, nil)
+	closeErr := dev.usb.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// currentMode returns the mode the probe is currently in.
+func (dev *Device) currentMode() (byte, error) {
+	buf := make([]byte, 2)
+	err := dev.command([]byte{cmdGetCurrentMode}, buf)
+	if err != nil {
+		return 0, fmt.Errorf("could not read ST-Link mode: %w", err)
+	}
+	return buf[0], nil
+}
+
+// command sends a command to the probe and reads the response into response,
+// if it is not empty. Commands are always sent as a 16-byte packet.
+func (dev *Device) command(cmd []byte, response []byte) error {
+	packet := make([]byte, 16)
+	copy(packet, cmd)
+	err := dev.usb.write(dev.info.epOut, packet)
+	if err != nil {
+		return err
+	}
+	if len(response) == 0 {
+		return nil
+	}
+	return dev.readFull(response)
+}
+
+// checkedCommand sends a command that returns a 2-byte status and returns an
+// error if the status is not OK.
+func (dev *Device) checkedCommand(cmd []byte) error {
+	status := make([]byte, 2)
+	err := dev.command(cmd, status)
+	if err != nil {
+		return err
+	}
+	if status[0] != statusOK {
+		return fmt.Errorf("ST-Link command %#02x failed with status %#02x", cmd[1], status[0])
+	}
+	return nil
+}
+
+// readFull reads exactly len(data) bytes from the probe.
+func (dev *Device) readFull(data []byte) error {
+	for len(data) > 0 {
+		n, err := dev.usb.read(dev.info.epIn, data)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errors.New("ST-Link: short read")
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// lastRWStatus returns an error if the last memory read or write failed, for
+// example because of a bus fault on the target.
+func (dev *Device) lastRWStatus() error {
+	return dev.checkedCommand([]byte{cmdDebug, debugLastRWStatus})
+}
+
+// memoryCommand builds a memory read or write command for the given address
+// and length.
+func memoryCommand(cmd byte, address uint32, length int) []byte {
+	packet := make([]byte, 8)
+	packet[0] = cmdDebug
+	packet[1] = cmd
+	binary.LittleEndian.PutUint32(packet[2:], address)
+	binary.LittleEndian.PutUint16(packet[6:], uint16(length))
+	return packet
+}
+
+// ReadMemory reads len(data) bytes from the target memory at the given
+// address. The address and length must be a multiple of 4.
+func (dev *Device) ReadMemory(address uint32, data []byte) error {
+	if address%4 != 0 || len(data)%4 != 0 {
+		return fmt.Errorf("ST-Link: unaligned memory read of %d bytes at %#08x", len(data), address)
+	}
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > maxTransferSize {
+			chunk = chunk[:maxTransferSize]
+		}
+		err := dev.command(memoryCommand(debugReadMem32, address, len(chunk)), chunk)
+		if err != nil {
+			return err
+		}
+		err = dev.lastRWStatus()
+		if err != nil {
+			return fmt.Errorf("could not read memory at %#08x: %w", address, err)
+		}
+		address += uint32(len(chunk))
+		data = data[len(chunk):]
+	}
+	return nil
+}
+
+// WriteMemory writes data to the target memory at the given address. The
+// address and length must be a multiple of 4.
+func (dev *Device) WriteMemory(address uint32, data []byte) error {
+	if address%4 != 0 || len(data)%4 != 0 {
+		return fmt.Errorf("ST-Link: unaligned memory write of %d bytes at %#08x", len(data), address)
+	}
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > maxTransferSize {
+			chunk = chunk[:maxTransferSize]
+		}
+		err := dev.command(memoryCommand(debugWriteMem32, address, len(chunk)), nil)
+		if err != nil {
+			return err
+		}
+		err = dev.usb.write(dev.info.epOut, chunk)
+		if err != nil {
+			return err
+		}
+		err = dev.lastRWStatus()
+		if err != nil {
+			return fmt.Errorf("could not write memory at %#08x: %w", address, err)
+		}
+		address += uint32(len(chunk))
+		data = data[len(chunk):]
+	}
+	return nil
+}
+
+// writeMemory16 writes data to the target memory using 16-bit accesses, which
+// is needed for the flash controller of the STM32F1. The address and length
+// must be a multiple of 2.
+func (dev *Device) writeMemory16(address uint32, data []byte) error {
+	if address%2 != 0 || len(data)%2 != 0 {
+		return fmt.Errorf("ST-Link: unaligned memory write of %d bytes at %#08x", len(data), address)
+	}
+	if dev.version == 2 && dev.jtagVersion < 26 {
+		return fmt.Errorf("ST-Link firmware too old (V%dJ%d) for 16-bit memory access, please upgrade it using the ST-Link firmware upgrade tool", dev.version, dev.jtagVersion)
+	}
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > maxTransferSize {
+			chunk = chunk[:maxTransferSize]
+		}
+		err := dev.command(memoryCommand(debugWriteMem16, address, len(chunk)), nil)
+		if err != nil {
+			return err
+		}
+		err = dev.usb.write(dev.info.epOut, chunk)
+		if err != nil {
+			return err
+		}
+		err = dev.lastRWStatus()
+		if err != nil {
+			return fmt.Errorf("could not write memory at %#08x: %w", address, err)
+		}
+		address += uint32(len(chunk))
+		data = data[len(chunk):]
+	}
+	return nil
+}
+
+// ReadRegister reads a single 32-bit word from the target, usually a memory
+// mapped register.
+func (dev *Device) ReadRegister(address uint32) (uint32, error) {
+	cmd := make([]byte, 6)
+	cmd[0] = cmdDebug
+	cmd[1] = debugReadDebugRg
+	binary.LittleEndian.PutUint32(cmd[2:], address)
+	buf := make([]byte, 8)
+	err := dev.command(cmd, buf)
+	if err != nil {
+		return 0, err
+	}
+	if buf[0] != statusOK {
+		return 0, fmt.Errorf("could not read register %#08x: status %#02x", address, buf[0])
+	}
+	return binary.LittleEndian.Uint32(buf[4:]), nil
+}
+
+// WriteRegister writes a single 32-bit word to the target, usually a memory
+// mapped register.
+func (dev *Device) WriteRegister(address, value uint32) error {
+	cmd := make([]byte, 10)
+	cmd[0] = cmdDebug
+	cmd[1] = debugWriteDebugRg
+	binary.LittleEndian.PutUint32(cmd[2:], address)
+	binary.LittleEndian.PutUint32(cmd[6:], value)
+	err := dev.checkedCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("could not write register %#08x: %w", address, err)
+	}
+	return nil
+}
+
+// Halt stops the core of the target.
+func (dev *Device) Halt() error {
+	err := dev.WriteRegister(regDHCSR, dhcsrKey|dhcsrDebugEn|dhcsrHalt)
+	if err != nil {
+		return err
+	}
+	return dev.waitFor(regDHCSR, dhcsrSHalt, dhcsrSHalt, time.Second)
+}
+
+// Reset resets the target using a system reset request and lets it run.
+func (dev *Device) Reset() error {
+	// Make sure the core doesn't halt directly after the reset.
+	err := dev.WriteRegister(regDEMCR, 0)
+	if err != nil {
+		return err
+	}
+	err = dev.WriteRegister(regDHCSR, dhcsrKey|dhcsrDebugEn)
+	if err != nil {
+		return err
+	}
+	// The probe may not get a response while the target resets, so ignore
+	// the status of this write.
+	dev.WriteRegister(regAIRCR, aircrKey|aircrSysResetReq)
+	time.Sleep(10 * time.Millisecond)
+	return nil
+}
+
+// ResetHalt resets the target and halts it before it executes the first
+// instruction.
+func (dev *Device) ResetHalt() error {
+	err := dev.WriteRegister(regDHCSR, dhcsrKey|dhcsrDebugEn|dhcsrHalt)
+	if err != nil {
+		return err
+	}
+	err = dev.WriteRegister(regDEMCR, demcrVCCoreReset)
+	if err != nil {
+		return err
+	}
+	dev.WriteRegister(regAIRCR, aircrKey|aircrSysResetReq)
+	time.Sleep(10 * time.Millisecond)
+	err = dev.waitFor(regDHCSR, dhcsrSHalt, dhcsrSHalt, time.Second)
+	if err != nil {
+		return err
+	}
+	return dev.WriteRegister(regDEMCR, 0)
+}
+
+// waitFor polls the register at the given address until the bits in mask
+// have the given value, or returns an error after the timeout.
+func (dev *Device) waitFor(address, mask, value uint32, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		reg, err := dev.ReadRegister(address)
+		if err != nil {
+			return err
+		}
+		if reg&mask == value {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for register %#08x (value %#08x)", address, reg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,152 @@
+package stlink
+
+// This file implements the USB connection to the probe on Linux, using the
+// usbfs interface of the kernel.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// bulkTransfer is struct usbdevfs_bulktransfer from linux/usbdevice_fs.h.
+type bulkTransfer struct {
+	ep      uint32
+	len     uint32
+	timeout uint32 // in milliseconds
+	data    unsafe.Pointer
+}
+
+// ioctl numbers from linux/usbdevice_fs.h.
+var (
+	usbdevfsBulk             = ioc(3, 2, unsafe.Sizeof(bulkTransfer{}))
+	usbdevfsClaimInterface   = ioc(2, 15, 4)
+	usbdevfsReleaseInterface = ioc(2, 16, 4)
+)
+
+// ioc calculates an ioctl number for usbfs, like the _IOC macro in C.
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 'U'<<8 | nr
+}
+
+// usbTimeout is the timeout of a single bulk transfer in milliseconds.
+const usbTimeout = 3000
+
+type linuxUSBDevice struct {
+	fd int
+}
+
+// openUSB looks for a known ST-Link probe in sysfs and opens it.
+func openUSB() (usbDevice, probeInfo, error) {
+	devices, err := filepath.Glob("/sys/bus/usb/devices/*/idVendor")
+	if err != nil {
+		return nil, probeInfo{}, err
+	}
+	for _, path := range devices {
+		dir := filepath.Dir(path)
+		if readSysfsHex(filepath.Join(dir, "idVendor")) != vendorID {
+			continue
+		}
+		productID := readSysfsHex(filepath.Join(dir, "idProduct"))
+		for _, info := range knownProbes {
+			if uint64(info.productID) != productID {
+				continue
+			}
+			busnum := readSysfsInt(filepath.Join(dir, "busnum"))
+			devnum := readSysfsInt(filepath.Join(dir, "devnum"))
+			dev, err := openUSBDevice(fmt.Sprintf("/dev/bus/usb/%03d/%03d", busnum, devnum))
+			if err != nil {
+				return nil, probeInfo{}, err
+			}
+			return dev, info, nil
+		}
+	}
+	return nil, probeInfo{}, errNotFound
+}
+
+// openUSBDevice opens the usbfs device node and claims the debug interface.
+func openUSBDevice(path string) (*linuxUSBDevice, error) {
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		if os.IsPermission(err) {
+			return nil, fmt.Errorf("could not open ST-Link at %s: %w (you may need to install udev rules for the ST-Link)", path, err)
+		}
+		return nil, fmt.Errorf("could not open ST-Link at %s: %w", path, err)
+	}
+	var iface uint32 // the debug interface is always interface 0
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), usbdevfsClaimInterface, uintptr(unsafe.Pointer(&iface)))
+	if errno != 0 {
+		unix.Close(fd)
+		return nil, fmt.Errorf("could not claim ST-Link interface: %w", errno)
+	}
+	return &linuxUSBDevice{fd: fd}, nil
+}
+
+// bulk does a single bulk transfer, in the direction given by the endpoint.
+func (dev *linuxUSBDevice) bulk(ep uint8, data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	transfer := bulkTransfer{
+		ep:      uint32(ep),
+		len:     uint32(len(data)),
+		timeout: usbTimeout,
+		data:    unsafe.Pointer(&data[0]),
+	}
+	n, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(dev.fd), usbdevfsBulk, uintptr(unsafe.Pointer(&transfer)))
+	runtime.KeepAlive(data)
+	if errno != 0 {
+		return 0, fmt.Errorf("ST-Link USB transfer failed: %w", errno)
+	}
+	return int(n), nil
+}
+
+func (dev *linuxUSBDevice) write(ep uint8, data []byte) error {
+	n, err := dev.bulk(ep, data)
+	if err != nil {
+		return err
+	}
+	if n != len(data) {
+		return fmt.Errorf("ST-Link USB transfer: wrote %d of %d bytes", n, len(data))
+	}
+	return nil
+}
+
+func (dev *linuxUSBDevice) read(ep uint8, data []byte) (int, error) {
+	return dev.bulk(ep, data)
+}
+
+func (dev *linuxUSBDevice) Close() error {
+	var iface uint32
+	unix.Syscall(unix.SYS_IOCTL, uintptr(dev.fd), usbdevfsReleaseInterface, uintptr(unsafe.Pointer(&iface)))
+	return unix.Close(dev.fd)
+}
+
+// readSysfsHex reads a hexadecimal number (such as a vendor ID) from sysfs.
+// It returns 0 if the file cannot be read.
+func readSysfsHex(path string) uint64 {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.ParseUint(strings.TrimSpace(string(data)), 16, 32)
+	return n
+}
+
+// readSysfsInt reads a decimal number (such as a bus number) from sysfs. It
+// returns 0 if the file cannot be read.
+func readSysfsInt(path string) uint64 {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32)
+	return n
+}
@@ -0,0 +1,10 @@
+// +build !linux,!windows
+
+package stlink
+
+import "errors"
+
+// openUSB is not yet implemented on this operating system.
+func openUSB() (usbDevice, probeInfo, error) {
+	return nil, probeInfo{}, errors.New("the built-in ST-Link driver is not supported on this operating system, use openocd instead")
+}
@@ -0,0 +1,187 @@
+package stlink
+
+// This file implements the USB connection to the probe on Windows, using
+// WinUSB. The ST-Link driver package from ST (STSW-LINK009) binds the probe
+// to WinUSB, so no other driver is needed.
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modSetupAPI = windows.NewLazySystemDLL("setupapi.dll")
+	modWinUSB   = windows.NewLazySystemDLL("winusb.dll")
+
+	procSetupDiGetClassDevsW             = modSetupAPI.NewProc("SetupDiGetClassDevsW")
+	procSetupDiEnumDeviceInterfaces      = modSetupAPI.NewProc("SetupDiEnumDeviceInterfaces")
+	procSetupDiGetDeviceInterfaceDetailW = modSetupAPI.NewProc("SetupDiGetDeviceInterfaceDetailW")
+	procSetupDiDestroyDeviceInfoList     = modSetupAPI.NewProc("SetupDiDestroyDeviceInfoList")
+
+	procWinUsbInitialize    = modWinUSB.NewProc("WinUsb_Initialize")
+	procWinUsbFree          = modWinUSB.NewProc("WinUsb_Free")
+	procWinUsbReadPipe      = modWinUSB.NewProc("WinUsb_ReadPipe")
+	procWinUsbWritePipe     = modWinUSB.NewProc("WinUsb_WritePipe")
+	procWinUsbSetPipePolicy = modWinUSB.NewProc("WinUsb_SetPipePolicy")
+)
+
+// Device interface GUIDs to look for the probe. The first is registered by
+// the ST-Link driver, the second is the generic GUID of all USB devices which
+// works for probes that are directly bound to WinUSB (for example using
+// Zadig).
+var deviceInterfaceGUIDs = []windows.GUID{
+	{Data1: 0xdbce1cd9, Data2: 0xa320, Data3: 0x4b51, Data4: [8]byte{0xa3, 0x65, 0xa0, 0xc3, 0xf3, 0xc5, 0xfb, 0x29}},
+	{Data1: 0xa5dcbf10, Data2: 0x6530, Data3: 0x11d2, Data4: [8]byte{0x90, 0x1f, 0x00, 0xc0, 0x4f, 0xb9, 0x51, 0xed}},
+}
+
+const (
+	digcfPresent         = 0x02
+	digcfDeviceInterface = 0x10
+
+	pipeTransferTimeout = 0x03
+)
+
+// usbTimeout is the timeout of a single bulk transfer in milliseconds.
+const usbTimeout = 3000
+
+// spDeviceInterfaceData is SP_DEVICE_INTERFACE_DATA from setupapi.h.
+type spDeviceInterfaceData struct {
+	cbSize             uint32
+	interfaceClassGUID windows.GUID
+	flags              uint32
+	reserved           uintptr
+}
+
+type windowsUSBDevice struct {
+	file   windows.Handle
+	handle uintptr // WINUSB_INTERFACE_HANDLE
+}
+
+// openUSB looks for a known ST-Link probe and opens it using WinUSB.
+func openUSB() (usbDevice, probeInfo, error) {
+	for _, guid := range deviceInterfaceGUIDs {
+		paths, err := devicePaths(guid)
+		if err != nil {
+			return nil, probeInfo{}, err
+		}
+		for _, path := range paths {
+			lowerPath := strings.ToLower(path)
+			for _, info := range knownProbes {
+				id := fmt.Sprintf("vid_%04x&pid_%04x", vendorID, info.productID)
+				if !strings.Contains(lowerPath, id) {
+					continue
+				}
+				dev, err := openUSBDevice(path)
+				if err != nil {
+					// This may be the composite parent device instead of
+					// the debug interface, try the next one.
+					continue
+				}
+				return dev, info, nil
+			}
+		}
+	}
+	return nil, probeInfo{}, errNotFound
+}
+
+// devicePaths returns the paths of all present devices with the given device
+// interface GUID.
+func devicePaths(guid windows.GUID) ([]string, error) {
+	set, _, err := procSetupDiGetClassDevsW.Call(uintptr(unsafe.Pointer(&guid)), 0, 0, digcfPresent|digcfDeviceInterface)
+	if windows.Handle(set) == windows.InvalidHandle {
+		return nil, fmt.Errorf("could not list USB devices: %w", err)
+	}
+	defer procSetupDiDestroyDeviceInfoList.Call(set)
+
+	var paths []string
+	for index := uintptr(0); ; index++ {
+		data := spDeviceInterfaceData{}
+		data.cbSize = uint32(unsafe.Sizeof(data))
+		ok, _, _ := procSetupDiEnumDeviceInterfaces.Call(set, 0, uintptr(unsafe.Pointer(&guid)), index, uintptr(unsafe.Pointer(&data)))
+		if ok == 0 {
+			break // ERROR_NO_MORE_ITEMS
+		}
+
+		// Ask for the size of SP_DEVICE_INTERFACE_DETAIL_DATA_W first.
+		var size uint32
+		procSetupDiGetDeviceInterfaceDetailW.Call(set, uintptr(unsafe.Pointer(&data)), 0, 0, uintptr(unsafe.Pointer(&size)), 0)
+		if size < 8 {
+			continue
+		}
+		// Use a []uint64 for proper alignment of the struct.
+		buf := make([]uint64, (size+7)/8)
+		detail := unsafe.Pointer(&buf[0])
+		// The cbSize field is the size of the fixed part of the struct: a
+		// uint32 and a single WCHAR, padded to the struct alignment.
+		if unsafe.Sizeof(uintptr(0)) == 8 {
+			*(*uint32)(detail) = 8
+		} else {
+			*(*uint32)(detail) = 6
+		}
+		ok, _, _ = procSetupDiGetDeviceInterfaceDetailW.Call(set, uintptr(unsafe.Pointer(&data)), uintptr(detail), uintptr(size), 0, 0)
+		if ok == 0 {
+			continue
+		}
+		path := (*[1 << 16]uint16)(unsafe.Pointer(uintptr(detail) + 4))[:(size-4)/2]
+		paths = append(paths, windows.UTF16ToString(path))
+	}
+	return paths, nil
+}
+
+// openUSBDevice opens the device at the given path and initializes WinUSB.
+func openUSBDevice(path string) (*windowsUSBDevice, error) {
+	pathp, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := windows.CreateFile(pathp, windows.GENERIC_READ|windows.GENERIC_WRITE, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL|windows.FILE_FLAG_OVERLAPPED, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not open ST-Link: %w", err)
+	}
+	dev := &windowsUSBDevice{file: file}
+	ok, _, err := procWinUsbInitialize.Call(uintptr(file), uintptr(unsafe.Pointer(&dev.handle)))
+	if ok == 0 {
+		windows.CloseHandle(file)
+		return nil, fmt.Errorf("could not open ST-Link using WinUSB: %w", err)
+	}
+	for _, ep := range []uint8{0x01, 0x02, 0x81} {
+		timeout := uint32(usbTimeout)
+		procWinUsbSetPipePolicy.Call(dev.handle, uintptr(ep), pipeTransferTimeout, unsafe.Sizeof(timeout), uintptr(unsafe.Pointer(&timeout)))
+	}
+	return dev, nil
+}
+
+func (dev *windowsUSBDevice) write(ep uint8, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	var transferred uint32
+	ok, _, err := procWinUsbWritePipe.Call(dev.handle, uintptr(ep), uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), uintptr(unsafe.Pointer(&transferred)), 0)
+	if ok == 0 {
+		return fmt.Errorf("ST-Link USB transfer failed: %w", err)
+	}
+	if int(transferred) != len(data) {
+		return fmt.Errorf("ST-Link USB transfer: wrote %d of %d bytes", transferred, len(data))
+	}
+	return nil
+}
+
+func (dev *windowsUSBDevice) read(ep uint8, data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	var transferred uint32
+	ok, _, err := procWinUsbReadPipe.Call(dev.handle, uintptr(ep), uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), uintptr(unsafe.Pointer(&transferred)), 0)
+	if ok == 0 {
+		return 0, fmt.Errorf("ST-Link USB transfer failed: %w", err)
+	}
+	return int(transferred), nil
+}
+
+func (dev *windowsUSBDevice) Close() error {
+	procWinUsbFree.Call(dev.handle)
+	return windows.CloseHandle(dev.file)
+}
@@ -0,0 +1,38 @@
+// Startup code for a TinyGo program that is built as an ESP-IDF component (see
+// targets/esp-idf.cmake). ESP-IDF calls app_main once the system has been
+// initialized. This initializes the parts of ESP-IDF that the WiFi and
+// Bluetooth drivers depend on, and then starts the Go program in its own
+// FreeRTOS task (see targets/freertos.c).
+//
+// Define TINYGO_NO_APP_MAIN to write app_main in C instead, for example to
+// initialize other components first. It must call tinygo_freertos_start.
+
+#ifndef TINYGO_NO_APP_MAIN
+
+#include "esp_err.h"
+#include "esp_event.h"
+#include "esp_netif.h"
+#include "nvs_flash.h"
+
+void tinygo_freertos_start(void);
+
+void app_main(void) {
+    // The WiFi and Bluetooth drivers store their calibration data and
+    // configuration in NVS, so it must be initialized before they're used.
+    esp_err_t err = nvs_flash_init();
+    if (err == ESP_ERR_NVS_NO_FREE_PAGES || err == ESP_ERR_NVS_NEW_VERSION_FOUND) {
+        // The NVS partition was truncated or has an incompatible format.
+        ESP_ERROR_CHECK(nvs_flash_erase());
+        err = nvs_flash_init();
+    }
+    ESP_ERROR_CHECK(err);
+
+    // The WiFi driver sends its events to the default event loop, and needs
+    // the TCP/IP stack to be initialized.
+    ESP_ERROR_CHECK(esp_netif_init());
+    ESP_ERROR_CHECK(esp_event_loop_create_default());
+
+    tinygo_freertos_start();
+}
+
+#endif
@@ -0,0 +1,64 @@
+# CMake helper to build a TinyGo program as an ESP-IDF component, so that it can
+# use the WiFi, Bluetooth and NVS drivers of ESP-IDF through CGo. Use it as the
+# CMakeLists.txt of a component in the project, for example:
+#
+#     include($ENV{TINYGOROOT}/targets/esp-idf.cmake)
+#     tinygo_idf_component(${CMAKE_CURRENT_SOURCE_DIR}/go REQUIRES esp_wifi)
+#
+# The include paths of the required components (and their dependencies) and
+# sdkconfig.h are passed to CGo, so the Go program can #include "esp_wifi.h".
+# The Go program is started from app_main, after NVS, the TCP/IP stack and the
+# default event loop have been initialized (see targets/esp-idf.c).
+#
+# The garbage collector only scans the globals between _bss_start and _bss_end
+# (and the .data section), which are in internal RAM. ESP-IDF only moves .bss
+# to external RAM for libraries that are mapped to the extram_bss scheme by a
+# linker fragment, so don't add such a mapping for libtinygo.a. Options:
+#
+#     TARGET    TinyGo target to build for (default esp32-freertos)
+#     REQUIRES  ESP-IDF components used by the Go program
+
+set(TINYGO_IDF_DIR ${CMAKE_CURRENT_LIST_DIR})
+
+# This is a macro and not a function, as idf_component_register sets variables
+# in the scope of the component.
+macro(tinygo_idf_component dir)
+  cmake_parse_arguments(TINYGO "" "TARGET" "REQUIRES" ${ARGN})
+  if(NOT TINYGO_TARGET)
+    set(TINYGO_TARGET esp32-freertos)
+  endif()
+
+  idf_component_register(
+    SRCS ${TINYGO_IDF_DIR}/freertos.c ${TINYGO_IDF_DIR}/esp-idf.c
+    INCLUDE_DIRS ${CMAKE_CURRENT_BINARY_DIR}
+    REQUIRES ${TINYGO_REQUIRES} esp_event esp_netif esp_timer nvs_flash
+  )
+
+  # The C library headers of the toolchain, which are not part of a component.
+  execute_process(
+    COMMAND ${CMAKE_C_COMPILER} -print-sysroot
+    OUTPUT_VARIABLE TINYGO_SYSROOT
+    OUTPUT_STRIP_TRAILING_WHITESPACE
+  )
+
+  find_program(TINYGO tinygo REQUIRED)
+  set(TINYGO_ARCHIVE ${CMAKE_CURRENT_BINARY_DIR}/libtinygo.a)
+  file(GLOB_RECURSE TINYGO_SOURCES ${dir}/*.go ${dir}/go.mod)
+  set(TINYGO_INCLUDES "$<TARGET_PROPERTY:${COMPONENT_LIB},INCLUDE_DIRECTORIES>")
+  add_custom_command(
+    OUTPUT ${TINYGO_ARCHIVE} ${CMAKE_CURRENT_BINARY_DIR}/libtinygo.h
+    COMMAND ${CMAKE_COMMAND} -E env
+      "CGO_CFLAGS=-DESP_PLATFORM -isystem ${TINYGO_SYSROOT}/include $<$<BOOL:${TINYGO_INCLUDES}>:-I$<JOIN:${TINYGO_INCLUDES}, -I>>"
+      ${TINYGO} build -target=${TINYGO_TARGET} -o ${TINYGO_ARCHIVE} .
+    WORKING_DIRECTORY ${dir}
+    DEPENDS ${TINYGO_SOURCES}
+    COMMENT "Building TinyGo program in ${dir}"
+    VERBATIM
+  )
+  add_custom_target(tinygo_program DEPENDS ${TINYGO_ARCHIVE})
+  add_dependencies(${COMPONENT_LIB} tinygo_program)
+
+  # The shim and the Go program call each other, so link them as a group.
+  target_link_libraries(${COMPONENT_LIB} INTERFACE
+    "-Wl,--start-group" ${TINYGO_ARCHIVE} $<TARGET_FILE:${COMPONENT_LIB}> "-Wl,--end-group")
+endmacro()
@@ -0,0 +1,115 @@
+// Shim that runs a TinyGo program as a FreeRTOS task. Link it into the FreeRTOS
+// application together with the static library created by tinygo build
+// -target=esp32-freertos (or another target with -buildmode=freertos), and
+// call tinygo_freertos_start once the FreeRTOS scheduler is running. Many of
+// the FreeRTOS APIs used by the TinyGo runtime are macros, so they are wrapped
+// here.
+//
+// The following can be overridden with compile definitions:
+//
+//     TINYGO_HEAP_SIZE   size of the Go heap in bytes
+//     TINYGO_STACK_SIZE  size of the stack of the Go task in bytes
+//     TINYGO_PRIORITY    priority of the Go task
+//     TINYGO_DATA_START, TINYGO_DATA_END, TINYGO_BSS_START, TINYGO_BSS_END
+//                        linker symbols around the .data and .bss sections,
+//                        which are scanned by the garbage collector
+
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include "freertos/FreeRTOS.h"
+#include "freertos/task.h"
+
+#ifdef ESP_PLATFORM
+#include "esp_timer.h"
+#endif
+
+#ifndef TINYGO_HEAP_SIZE
+#define TINYGO_HEAP_SIZE (32 * 1024)
+#endif
+
+#ifndef TINYGO_STACK_SIZE
+#define TINYGO_STACK_SIZE 8192
+#endif
+
+#ifndef TINYGO_PRIORITY
+#define TINYGO_PRIORITY 5
+#endif
+
+// The default symbols are those of the ESP-IDF linker scripts.
+#ifndef TINYGO_DATA_START
+#define TINYGO_DATA_START _data_start
+#define TINYGO_DATA_END _data_end
+#define TINYGO_BSS_START _bss_start
+#define TINYGO_BSS_END _bss_end
+#endif
+
+extern char TINYGO_DATA_START[], TINYGO_DATA_END[], TINYGO_BSS_START[], TINYGO_BSS_END[];
+
+const uintptr_t tinygo_freertos_globals[4] = {
+    (uintptr_t)TINYGO_DATA_START,
+    (uintptr_t)TINYGO_DATA_END,
+    (uintptr_t)TINYGO_BSS_START,
+    (uintptr_t)TINYGO_BSS_END,
+};
+
+// Implemented in the TinyGo runtime.
+void tinygo_freertos_main(void *heap, uintptr_t heapSize);
+
+void tinygo_freertos_putchar(uint8_t c) {
+    putchar(c);
+    if (c == '\n') {
+        fflush(stdout);
+    }
+}
+
+int64_t tinygo_freertos_uptime_ns(void) {
+#ifdef ESP_PLATFORM
+    return esp_timer_get_time() * 1000;
+#else
+    return (int64_t)xTaskGetTickCount() * (1000000000 / configTICK_RATE_HZ);
+#endif
+}
+
+void tinygo_freertos_sleep_ns(int64_t ns) {
+    // Round up, so that the task always blocks and lower priority tasks get a
+    // chance to run.
+    const int64_t tickNs = 1000000000 / configTICK_RATE_HZ;
+    int64_t ticks = (ns + tickNs - 1) / tickNs;
+    if (ticks > portMAX_DELAY - 1) {
+        ticks = portMAX_DELAY - 1;
+    }
+    vTaskDelay(ticks > 0 ? ticks : 1);
+}
+
+void tinygo_freertos_wait(void) {
+    vTaskDelay(1);
+}
+
+void tinygo_freertos_abort(void) {
+    abort();
+}
+
+uintptr_t tinygo_freertos_disable_interrupts(void) {
+    return (uintptr_t)portSET_INTERRUPT_MASK_FROM_ISR();
+}
+
+void tinygo_freertos_restore_interrupts(uintptr_t state) {
+    portCLEAR_INTERRUPT_MASK_FROM_ISR(state);
+}
+
+static void tinygo_freertos_task(void *arg) {
+    // Allocate the heap from the FreeRTOS heap, so that it isn't part of .bss
+    // and isn't scanned as part of the globals.
+    void *heap = pvPortMalloc(TINYGO_HEAP_SIZE);
+    if (heap == NULL) {
+        printf("tinygo: could not allocate a heap of %d bytes\n", TINYGO_HEAP_SIZE);
+        abort();
+    }
+    tinygo_freertos_main(heap, TINYGO_HEAP_SIZE);
+    vTaskDelete(NULL);
+}
+
+void tinygo_freertos_start(void) {
+    xTaskCreate(tinygo_freertos_task, "tinygo", TINYGO_STACK_SIZE / sizeof(StackType_t), NULL, TINYGO_PRIORITY, NULL);
+}
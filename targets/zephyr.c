@@ -0,0 +1,67 @@
+// Shim that runs a TinyGo program as a Zephyr thread. Link it into the Zephyr
+// application together with the static library created by tinygo build
+// -target=zephyr-cortex-m4 (see targets/zephyr.cmake). Most of the Zephyr APIs
+// used by the TinyGo runtime are macros or inline functions, so they are
+// wrapped here.
+//
+// The following can be overridden with compile definitions:
+//
+//     TINYGO_HEAP_SIZE   size of the Go heap in bytes
+//     TINYGO_STACK_SIZE  size of the stack of the Go thread in bytes
+//     TINYGO_PRIORITY    priority of the Go thread
+
+#include <stddef.h>
+#include <stdint.h>
+#include <zephyr/kernel.h>
+#include <zephyr/sys/printk.h>
+
+#ifndef TINYGO_HEAP_SIZE
+#define TINYGO_HEAP_SIZE (32 * 1024)
+#endif
+
+#ifndef TINYGO_STACK_SIZE
+#define TINYGO_STACK_SIZE 4096
+#endif
+
+#ifndef TINYGO_PRIORITY
+#define TINYGO_PRIORITY 7
+#endif
+
+// The Go heap. It is not part of .bss, so that it isn't scanned by the GC as
+// part of the globals.
+__noinit __aligned(8) uint8_t tinygo_zephyr_heap[TINYGO_HEAP_SIZE];
+const size_t tinygo_zephyr_heap_size = TINYGO_HEAP_SIZE;
+
+// Implemented in the TinyGo runtime.
+void tinygo_zephyr_main(void);
+
+void tinygo_zephyr_putchar(uint8_t c) {
+    // printk goes to the console that is configured in Zephyr.
+    printk("%c", c);
+}
+
+int64_t tinygo_zephyr_uptime_ns(void) {
+    return (int64_t)k_ticks_to_ns_floor64(k_uptime_ticks());
+}
+
+void tinygo_zephyr_sleep_ns(int64_t ns) {
+    k_sleep(K_NSEC(ns));
+}
+
+void tinygo_zephyr_abort(void) {
+    k_panic();
+}
+
+uint32_t tinygo_zephyr_irq_lock(void) {
+    return irq_lock();
+}
+
+void tinygo_zephyr_irq_unlock(uint32_t key) {
+    irq_unlock(key);
+}
+
+static void tinygo_zephyr_thread(void *p1, void *p2, void *p3) {
+    tinygo_zephyr_main();
+}
+
+K_THREAD_DEFINE(tinygo_thread, TINYGO_STACK_SIZE, tinygo_zephyr_thread, NULL, NULL, NULL, TINYGO_PRIORITY, 0, 0);
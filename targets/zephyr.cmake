@@ -0,0 +1,35 @@
+# CMake helper to add a TinyGo program to a Zephyr application. Include it in
+# the CMakeLists.txt of the application after find_package(Zephyr), for
+# example:
+#
+#     include($ENV{TINYGOROOT}/targets/zephyr.cmake)
+#     tinygo_add_program(${CMAKE_CURRENT_SOURCE_DIR}/go zephyr-cortex-m4)
+#
+# The zephyr-cortex-m4 target uses the soft float ABI. Use zephyr-cortex-m4f
+# instead for applications built with CONFIG_FPU and CONFIG_FP_HARDABI, as the
+# float ABI of the Go code must match that of the application.
+#
+# The Go program runs in its own thread, its heap and stack size can be changed
+# with the TINYGO_HEAP_SIZE and TINYGO_STACK_SIZE compile definitions.
+
+set(TINYGO_ZEPHYR_DIR ${CMAKE_CURRENT_LIST_DIR})
+
+function(tinygo_add_program dir target)
+  find_program(TINYGO tinygo REQUIRED)
+  set(archive ${CMAKE_CURRENT_BINARY_DIR}/tinygo.a)
+  file(GLOB_RECURSE sources ${dir}/*.go ${dir}/go.mod)
+  add_custom_command(
+    OUTPUT ${archive} ${CMAKE_CURRENT_BINARY_DIR}/tinygo.h
+    COMMAND ${TINYGO} build -target=${target} -o ${archive} .
+    WORKING_DIRECTORY ${dir}
+    DEPENDS ${sources}
+    COMMENT "Building TinyGo program in ${dir}"
+  )
+  add_custom_target(tinygo_program DEPENDS ${archive})
+  add_library(tinygo STATIC IMPORTED GLOBAL)
+  set_target_properties(tinygo PROPERTIES IMPORTED_LOCATION ${archive})
+  add_dependencies(tinygo tinygo_program)
+  target_sources(app PRIVATE ${TINYGO_ZEPHYR_DIR}/zephyr.c)
+  target_include_directories(app PRIVATE ${CMAKE_CURRENT_BINARY_DIR})
+  target_link_libraries(app PRIVATE tinygo)
+endfunction()
@@ -0,0 +1,16 @@
+package main
+
+import "unsafe"
+
+//go:align 256
+var descriptors [4]uint32
+
+//go:align 16
+var buf [3]byte
+
+func main() {
+	descriptors[0] = 1
+	buf[0] = 2
+	println("descriptors aligned:", uintptr(unsafe.Pointer(&descriptors))%256 == 0)
+	println("buf aligned:", uintptr(unsafe.Pointer(&buf))%16 == 0)
+}
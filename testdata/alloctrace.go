@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"runtime/debug"
+)
+
+var sink []byte
+
+func main() {
+	// The ring buffer holds at least one allocation, even when a smaller
+	// size is requested.
+	for _, size := range []int{0, -1, 4} {
+		debug.AllocTraceBufferSize = size
+		debug.SetAllocTrace(debug.AllocTraceBuffer)
+		for i := 0; i < 10; i++ {
+			sink = make([]byte, 16+i)
+		}
+		debug.SetAllocTrace(debug.AllocTraceOff)
+
+		var buf bytes.Buffer
+		debug.WriteAllocTrace(&buf)
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+		println("buffer size", size, "lines:", len(lines), "dropped:", bytes.HasPrefix(lines[0], []byte("tinygo-alloc: dropped ")))
+	}
+}
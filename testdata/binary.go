@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+type header struct {
+	Magic   [4]byte
+	Version uint16
+	Flags   uint8
+	_       uint8
+	Length  uint32
+}
+
+type sample struct {
+	Timestamp int64
+	Channel   int8
+	Valid     bool
+	Values    [3]int16
+	Scale     float32
+	Offset    float64
+}
+
+type point struct {
+	X, Y int16
+}
+
+func main() {
+	println("header:")
+	h := header{
+		Magic:   [4]byte{'T', 'G', 'O', '!'},
+		Version: 0x0102,
+		Flags:   0x80,
+		Length:  0xdeadbeef,
+	}
+	println("  size:", binary.Size(h))
+	roundtrip(binary.BigEndian, &h, &header{})
+	roundtrip(binary.LittleEndian, &h, &header{})
+
+	println("sample:")
+	s := sample{
+		Timestamp: -1234567890123,
+		Channel:   -3,
+		Valid:     true,
+		Values:    [3]int16{100, -200, 300},
+		Scale:     0.5,
+		Offset:    -2.25,
+	}
+	println("  size:", binary.Size(&s))
+	var s2 sample
+	roundtrip(binary.LittleEndian, &s, &s2)
+	println("  timestamp:", s2.Timestamp)
+	println("  channel:", s2.Channel)
+	println("  valid:", s2.Valid)
+	println("  values:", s2.Values[0], s2.Values[1], s2.Values[2])
+	println("  scale:", s2.Scale == 0.5)
+	println("  offset:", s2.Offset == -2.25)
+
+	println("struct by value:")
+	write(binary.BigEndian, point{X: 1, Y: -1})
+	write(binary.BigEndian, s)
+
+	println("slice of structs:")
+	points := []point{{1, 2}, {3, 4}, {-5, -6}}
+	println("  size:", binary.Size(points))
+	points2 := make([]point, len(points))
+	roundtrip(binary.BigEndian, points, points2)
+	for _, p := range points2 {
+		println("  point:", p.X, p.Y)
+	}
+
+	println("short read:")
+	err := binary.Read(bytes.NewReader([]byte{1, 2, 3}), binary.BigEndian, &header{})
+	println("  error:", err.Error())
+}
+
+// write encodes v and prints the result as hex.
+func write(order binary.ByteOrder, v interface{}) []byte {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, order, v); err != nil {
+		panic("failed to write: " + err.Error())
+	}
+	println("  encoded:", hex.EncodeToString(buf.Bytes()))
+	return buf.Bytes()
+}
+
+// roundtrip encodes v, decodes it into out, and checks that encoding out
+// results in the same bytes.
+func roundtrip(order binary.ByteOrder, v, out interface{}) {
+	data := write(order, v)
+	if err := binary.Read(bytes.NewReader(data), order, out); err != nil {
+		panic("failed to read: " + err.Error())
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, order, out)
+	println("  roundtrip:", bytes.Equal(data, buf.Bytes()))
+}
@@ -0,0 +1,54 @@
+package main
+
+// Goroutines that are blocked forever on a channel that is no longer
+// referenced can never run again, so they must be freed by the GC together
+// with their stack.
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+const numGoroutines = 50
+
+var keep []chan int
+
+func main() {
+	base := liveBytes()
+
+	startBlocked(false)
+	unreachable := liveBytes() - base
+
+	startBlocked(true)
+	reachable := liveBytes() - base - unreachable
+
+	println("started goroutines:", 2*numGoroutines)
+	println("unreachable goroutines freed:", unreachable < reachable/4)
+	println("reachable goroutines kept:", len(keep) == numGoroutines && reachable != 0)
+}
+
+// startBlocked starts goroutines that block forever on a channel. The channels
+// are only kept in the keep slice when reachable is set.
+//go:noinline
+func startBlocked(reachable bool) {
+	for i := 0; i < numGoroutines; i++ {
+		ch := make(chan int)
+		if reachable {
+			keep = append(keep, ch)
+		}
+		go func() {
+			<-ch
+		}()
+	}
+	// Let all goroutines run until they block.
+	runtime.Gosched()
+}
+
+// liveBytes returns the number of heap bytes that are still in use after a GC
+// cycle.
+func liveBytes() int {
+	runtime.GC()
+	var stats debug.HeapStats
+	debug.ReadHeapStats(&stats)
+	return int(stats.Live)
+}
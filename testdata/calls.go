@@ -44,6 +44,10 @@ func main() {
 	// defers in loop
 	testDeferLoop()
 
+	// defers that are only executed in some cases
+	testDeferConditional(true)
+	testDeferConditional(false)
+
 	//defer func variable call
 	testDeferFuncVar()
 
@@ -119,6 +123,19 @@ func testDeferLoop() {
 	}
 }
 
+func testDeferConditional(cond bool) {
+	defer deferred("conditional first", 0)
+	if cond {
+		defer deferred("conditional taken", 1)
+	} else {
+		defer deferred("conditional not taken", 2)
+	}
+	if !cond {
+		return
+	}
+	defer deferred("conditional last", 3)
+}
+
 func testDeferFuncVar() {
 	dummy, f := deferFunc()
 	dummy++
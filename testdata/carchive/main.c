@@ -0,0 +1,19 @@
+#include <stdio.h>
+#include "carchive.h"
+
+// Call into Go from a deeper stack frame than tinygo_init.
+static int32_t nested(int depth) {
+	if (depth == 0) {
+		return sum(1000);
+	}
+	return nested(depth - 1);
+}
+
+int main(void) {
+	tinygo_init();
+	printf("initialized: %d\n", is_initialized());
+	printf("add: %d\n", add(3, 4));
+	printf("sum: %d\n", sum(100));
+	printf("nested sum: %d\n", nested(10));
+	return 0;
+}
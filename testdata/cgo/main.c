@@ -1,3 +1,4 @@
+#include <stdarg.h>
 #include "main.h"
 
 int global = 3;
@@ -19,6 +20,8 @@ joined_t globalUnion;
 int globalUnionSize = sizeof(globalUnion);
 option_t globalOption = optionG;
 bitfield_t globalBitfield = {244, 15, 1, 2, 47, 5};
+can_frame_t globalCANFrame = {3, {0xf955}, 8};
+nibble_t globalNibble = {0xa5};
 
 int cflagsConstant = SOME_CONSTANT;
 
@@ -36,6 +39,10 @@ int doCallback(int a, int b, binop_t callback) {
 	return callback(a, b);
 }
 
+int doCallbackData(int a, int b, binop_data_t callback, uintptr_t data) {
+	return callback(data, a, b);
+}
+
 int variadic0() {
 	return 1;
 }
@@ -44,6 +51,28 @@ int variadic2(int x, int y, ...) {
 	return x * y;
 }
 
+int variadicSum(int n, ...) {
+	va_list args;
+	va_start(args, n);
+	int sum = 0;
+	for (int i = 0; i < n; i++) {
+		sum += va_arg(args, int);
+	}
+	va_end(args);
+	return sum;
+}
+
+double variadicSumDouble(int n, ...) {
+	va_list args;
+	va_start(args, n);
+	double sum = 0;
+	for (int i = 0; i < n; i++) {
+		sum += va_arg(args, double);
+	}
+	va_end(args);
+	return sum;
+}
+
 void store(int value, int *ptr) {
 	*ptr = value;
 }
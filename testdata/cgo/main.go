@@ -11,7 +11,10 @@ import "C"
 
 import "C"
 
-import "unsafe"
+import (
+	"runtime/cgo"
+	"unsafe"
+)
 
 func main() {
 	println("fortytwo:", C.fortytwo())
@@ -36,10 +39,17 @@ func main() {
 	println("callback 1:", C.doCallback(20, 30, cb))
 	cb = C.binop_t(C.mul)
 	println("callback 2:", C.doCallback(20, 30, cb))
+	cb = C.binop_t(C.sub) // not declared in C
+	println("callback 3:", C.doCallback(20, 30, cb))
+	h := cgo.NewHandle(func(a, b int) int { return a*10 + b })
+	println("callback 4:", C.doCallbackData(2, 3, C.binop_data_t(C.callHandle), C.uintptr_t(h)))
+	h.Delete()
 
 	// variadic functions
 	println("variadic0:", C.variadic0())
 	println("variadic2:", C.variadic2(3, 5))
+	println("variadic sum:", C.variadicSum(4, C.int(1), int8(-2), uint16(300), true))
+	println("variadic double:", C.variadicSumDouble(2, float32(1.5), 2.25))
 
 	// equivalent types
 	var goInt8 int8 = 5
@@ -78,6 +88,17 @@ func main() {
 	C.globalBitfield.set_bitfield_c(0xff)
 	printBitfield(&C.globalBitfield)
 
+	// bitfields in anonymous structs and unions
+	frame := &C.globalCANFrame
+	id := frame.anon0.unionfield_anon0()
+	println("CAN frame:", frame.flags, *frame.anon0.unionfield_raw(), frame.len)
+	println("CAN frame id:", id.bitfield_id(), id.bitfield_rtr(), id.bitfield_offset())
+	id.set_bitfield_offset(-3)
+	println("CAN frame offset:", id.bitfield_offset(), *frame.anon0.unionfield_raw())
+	println("nibble:", C.globalNibble.bitfield_low())
+	C.globalNibble.set_bitfield_low(3)
+	println("nibble all:", *C.globalNibble.unionfield_all())
+
 	// elaborated type
 	p := C.struct_point2d{x: 3, y: 5}
 	println("struct:", p.x, p.y)
@@ -144,10 +165,21 @@ func mul(a, b C.int) C.int {
 	return a * b
 }
 
+//export sub
+func sub(a, b C.int) C.int {
+	return a - b
+}
+
+//export callHandle
+func callHandle(data C.uintptr_t, a, b C.int) C.int {
+	f := cgo.Handle(data).Value().(func(a, b int) int)
+	return C.int(f(int(a), int(b)))
+}
+
 func printBitfield(bitfield *C.bitfield_t) {
 	println("bitfield a:", bitfield.bitfield_a())
 	println("bitfield b:", bitfield.bitfield_b())
 	println("bitfield c:", bitfield.bitfield_c())
-	println("bitfield d:", bitfield.d)
-	println("bitfield e:", bitfield.e)
+	println("bitfield d:", bitfield.bitfield_d())
+	println("bitfield e:", bitfield.bitfield_e())
 }
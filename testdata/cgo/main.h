@@ -7,11 +7,15 @@ int add(int a, int b);
 int unusedFunction(void);
 typedef int (*binop_t) (int, int);
 int doCallback(int a, int b, binop_t cb);
+typedef int (*binop_data_t) (uintptr_t data, int, int);
+int doCallbackData(int a, int b, binop_data_t cb, uintptr_t data);
 typedef int * intPointer;
 void store(int value, int *ptr);
 
 int variadic0();
 int variadic2(int x, int y, ...);
+int variadicSum(int n, ...);
+double variadicSumDouble(int n, ...);
 
 # define CONST_INT 5
 # define CONST_INT2 5llu
@@ -115,6 +119,27 @@ typedef struct {
 	// Note that C++ allows bitfields bigger than the underlying type.
 } bitfield_t;
 
+// Bitfields in an anonymous struct inside an anonymous union, as is common for
+// the identifier of a CAN frame.
+typedef struct {
+	unsigned char flags;
+	union {
+		uint32_t raw;
+		struct {
+			uint32_t id : 11;
+			uint32_t rtr : 1;
+			int32_t  offset : 4;
+		};
+	};
+	unsigned char len;
+} can_frame_t;
+
+// Bitfield directly inside a union.
+typedef union {
+	uint8_t all;
+	uint8_t low : 4;
+} nibble_t;
+
 // test globals and datatypes
 extern int global;
 extern int unusedGlobal;
@@ -136,6 +161,8 @@ extern joined_t globalUnion;
 extern int globalUnionSize;
 extern option_t globalOption;
 extern bitfield_t globalBitfield;
+extern can_frame_t globalCANFrame;
+extern nibble_t globalNibble;
 
 extern int smallEnumWidth;
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"runtime"
+	"runtime/interrupt"
 	"sync"
 	"time"
 )
@@ -229,6 +230,37 @@ func main() {
 	}
 	wg.Wait()
 	println("blocking select sum:", sum)
+
+	// test single-producer single-consumer channels
+	ch = make(chan int, 2)
+	interrupt.SPSC(ch)
+	ch <- 1
+	ch <- 2
+	println("len, cap of SPSC channel:", len(ch), cap(ch))
+	println("SPSC channel recieve:", <-ch, len(ch))
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// fills the buffer and blocks until the receiver catches up
+		for i := 3; i <= 10; i++ {
+			ch <- i
+		}
+		close(ch)
+	}()
+	time.Sleep(time.Millisecond)
+	println("len of full SPSC channel:", len(ch))
+	sum = 0
+	for {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				wg.Wait()
+				println("SPSC channel sum:", sum)
+				return
+			}
+			sum += v
+		}
+	}
 }
 
 func send(ch chan<- int) {
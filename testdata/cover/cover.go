@@ -0,0 +1,222 @@
+package cover
+
+// Covered is called by the test.
+func Covered(x int) int {
+	if x > 0 {
+		return x
+	}
+	return -x
+}
+
+// Uncovered is never called.
+func Uncovered() int {
+	return 42
+}
+
+// Big has many basic blocks, so that the coverage data is a lot larger than
+// the buffers it passes through.
+func Big(x int) int {
+	switch x {
+	case 0:
+		return 1
+	case 1:
+		return 4
+	case 2:
+		return 7
+	case 3:
+		return 10
+	case 4:
+		return 13
+	case 5:
+		return 16
+	case 6:
+		return 19
+	case 7:
+		return 22
+	case 8:
+		return 25
+	case 9:
+		return 28
+	case 10:
+		return 31
+	case 11:
+		return 34
+	case 12:
+		return 37
+	case 13:
+		return 40
+	case 14:
+		return 43
+	case 15:
+		return 46
+	case 16:
+		return 49
+	case 17:
+		return 52
+	case 18:
+		return 55
+	case 19:
+		return 58
+	case 20:
+		return 61
+	case 21:
+		return 64
+	case 22:
+		return 67
+	case 23:
+		return 70
+	case 24:
+		return 73
+	case 25:
+		return 76
+	case 26:
+		return 79
+	case 27:
+		return 82
+	case 28:
+		return 85
+	case 29:
+		return 88
+	case 30:
+		return 91
+	case 31:
+		return 94
+	case 32:
+		return 97
+	case 33:
+		return 100
+	case 34:
+		return 103
+	case 35:
+		return 106
+	case 36:
+		return 109
+	case 37:
+		return 112
+	case 38:
+		return 115
+	case 39:
+		return 118
+	case 40:
+		return 121
+	case 41:
+		return 124
+	case 42:
+		return 127
+	case 43:
+		return 130
+	case 44:
+		return 133
+	case 45:
+		return 136
+	case 46:
+		return 139
+	case 47:
+		return 142
+	case 48:
+		return 145
+	case 49:
+		return 148
+	case 50:
+		return 151
+	case 51:
+		return 154
+	case 52:
+		return 157
+	case 53:
+		return 160
+	case 54:
+		return 163
+	case 55:
+		return 166
+	case 56:
+		return 169
+	case 57:
+		return 172
+	case 58:
+		return 175
+	case 59:
+		return 178
+	case 60:
+		return 181
+	case 61:
+		return 184
+	case 62:
+		return 187
+	case 63:
+		return 190
+	case 64:
+		return 193
+	case 65:
+		return 196
+	case 66:
+		return 199
+	case 67:
+		return 202
+	case 68:
+		return 205
+	case 69:
+		return 208
+	case 70:
+		return 211
+	case 71:
+		return 214
+	case 72:
+		return 217
+	case 73:
+		return 220
+	case 74:
+		return 223
+	case 75:
+		return 226
+	case 76:
+		return 229
+	case 77:
+		return 232
+	case 78:
+		return 235
+	case 79:
+		return 238
+	case 80:
+		return 241
+	case 81:
+		return 244
+	case 82:
+		return 247
+	case 83:
+		return 250
+	case 84:
+		return 253
+	case 85:
+		return 256
+	case 86:
+		return 259
+	case 87:
+		return 262
+	case 88:
+		return 265
+	case 89:
+		return 268
+	case 90:
+		return 271
+	case 91:
+		return 274
+	case 92:
+		return 277
+	case 93:
+		return 280
+	case 94:
+		return 283
+	case 95:
+		return 286
+	case 96:
+		return 289
+	case 97:
+		return 292
+	case 98:
+		return 295
+	case 99:
+		return 298
+	}
+	return 0
+}
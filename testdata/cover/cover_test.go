@@ -0,0 +1,12 @@
+package cover
+
+import "testing"
+
+func TestCovered(t *testing.T) {
+	if Covered(3) != 3 {
+		t.Error("unexpected result of Covered(3)")
+	}
+	if Big(2) != 7 {
+		t.Error("unexpected result of Big(2)")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+// Test the crash log in flash of runtime/crashlog on a flash memory that is
+// emulated in RAM: records must be found again after a reset, and the oldest
+// records must be dropped when the log wraps around.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime/crashlog"
+	"strings"
+)
+
+// memFlash is flash memory in RAM, which checks that writes are aligned and
+// only go to erased flash, like real flash.
+type memFlash struct {
+	data       []byte
+	writeBlock int64
+	eraseBlock int64
+}
+
+func newFlash(size, writeBlock, eraseBlock int64) *memFlash {
+	f := &memFlash{data: make([]byte, size), writeBlock: writeBlock, eraseBlock: eraseBlock}
+	f.EraseBlocks(0, size/eraseBlock)
+	return f
+}
+
+func (f *memFlash) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > f.Size() {
+		return 0, errors.New("read out of range")
+	}
+	return copy(p, f.data[off:]), nil
+}
+
+func (f *memFlash) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > f.Size() {
+		return 0, errors.New("write out of range")
+	}
+	if off%f.writeBlock != 0 || int64(len(p))%f.writeBlock != 0 {
+		return 0, errors.New("unaligned write")
+	}
+	for i := range p {
+		if f.data[off+int64(i)] != 0xff {
+			return 0, fmt.Errorf("write to flash that is not erased at 0x%x", off+int64(i))
+		}
+	}
+	return copy(f.data[off:], p), nil
+}
+
+func (f *memFlash) Size() int64           { return int64(len(f.data)) }
+func (f *memFlash) WriteBlockSize() int64 { return f.writeBlock }
+func (f *memFlash) EraseBlockSize() int64 { return f.eraseBlock }
+
+func (f *memFlash) EraseBlocks(start, len int64) error {
+	if start < 0 || len < 0 || (start+len)*f.eraseBlock > f.Size() {
+		return errors.New("erase out of range")
+	}
+	for i := start * f.eraseBlock; i < (start+len)*f.eraseBlock; i++ {
+		f.data[i] = 0xff
+	}
+	return nil
+}
+
+// The log uses three erase blocks of 256 bytes, after the first block.
+const (
+	logOffset = 256
+	logSize   = 3 * 256
+)
+
+// contents returns the lines in the log.
+func contents(log crashlog.Log) []string {
+	buf := &bytes.Buffer{}
+	if _, err := log.WriteTo(buf); err != nil {
+		fmt.Println("read:", err.Error())
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+// reopen opens the log again, as after a reset.
+func reopen(flash *memFlash) crashlog.Log {
+	log, err := crashlog.NewFlash(flash, logOffset, logSize)
+	if err != nil {
+		fmt.Println("open:", err.Error())
+	}
+	return log
+}
+
+func main() {
+	for _, writeBlock := range []int64{4, 8} {
+		fmt.Println("write block size:", writeBlock)
+		flash := newFlash(4*256, writeBlock, 256)
+
+		// A new log is empty.
+		log := reopen(flash)
+		fmt.Printf("new: %q\n", contents(log))
+		log.Write([]byte("first line\n"))
+		log.Write([]byte("second line\n"))
+
+		// The records are found again after a reset, and new records are
+		// added after them.
+		log = reopen(flash)
+		fmt.Printf("recovered: %q\n", contents(log))
+		log.Write([]byte("third line\n"))
+		log = reopen(flash)
+		fmt.Printf("recovered: %q\n", contents(log))
+
+		// A record that was only partially written at the time of a reset is
+		// ignored, and the log continues in the next block.
+		end := bytes.LastIndex(flash.data[logOffset:logOffset+256], []byte("third line\n")) + logOffset + len("third line\n")
+		for end%int(writeBlock) != 0 {
+			end++
+		}
+		flash.data[end] = 0x20
+		log = reopen(flash)
+		log.Write([]byte("after reset\n"))
+		log = reopen(flash)
+		fmt.Printf("partial record: %q\n", contents(log))
+
+		// When the log is full, the oldest block is erased.
+		for i := 0; i < 100; i++ {
+			log.Write([]byte(fmt.Sprintf("line %d\n", i)))
+		}
+		lines := contents(log)
+		fmt.Println("wrapped:", len(lines), lines[0], lines[len(lines)-1])
+		log = reopen(flash)
+		recovered := contents(log)
+		fmt.Println("recovered after wrap:", len(recovered), recovered[0], recovered[len(recovered)-1])
+
+		// A write larger than a record is split over multiple records.
+		long := strings.Repeat("x", 150) + "\n"
+		log.Write([]byte(long))
+		lines = contents(reopen(flash))
+		fmt.Println("long line:", lines[len(lines)-1] == long[:len(long)-1])
+
+		// Clear removes everything, also after a reset.
+		log.Clear()
+		fmt.Printf("cleared: %q\n", contents(reopen(flash)))
+
+		// The flash before the log is never touched.
+		untouched := true
+		for _, c := range flash.data[:logOffset] {
+			untouched = untouched && c == 0xff
+		}
+		fmt.Println("untouched:", untouched)
+
+		// The region must be aligned to the erase block size, and at least
+		// two erase blocks in size.
+		_, err := crashlog.NewFlash(flash, 100, logSize)
+		fmt.Println("unaligned region:", err == crashlog.ErrFlashRegion)
+		_, err = crashlog.NewFlash(flash, logOffset, 256)
+		fmt.Println("small region:", err == crashlog.ErrFlashRegion)
+		_, err = crashlog.NewFlash(flash, logOffset, 4*256)
+		fmt.Println("region too large:", err == crashlog.ErrFlashRegion)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+// Test the crash log in RAM of runtime/crashlog, built with -crashlog-size=64:
+// a 16 byte header and 48 bytes of data. When the log wraps around, the oldest
+// (partial) line must be dropped.
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime/crashlog"
+	"strings"
+)
+
+// contents returns the contents of the log.
+func contents(log crashlog.Log) string {
+	buf := &bytes.Buffer{}
+	if _, err := log.WriteTo(buf); err != nil {
+		fmt.Println("read:", err.Error())
+	}
+	return buf.String()
+}
+
+func main() {
+	// The RAM is zero after power-on in QEMU, which is not a valid log, so
+	// the log starts empty.
+	log, err := crashlog.RAM()
+	if err != nil {
+		fmt.Println("open:", err.Error())
+		return
+	}
+	fmt.Printf("new: %q\n", contents(log))
+
+	log.Write([]byte("one\n"))
+	log.Write([]byte("two\n"))
+	fmt.Printf("written: %q\n", contents(log))
+
+	// Opening the log again returns the same log.
+	again, _ := crashlog.RAM()
+	fmt.Printf("reopened: %q\n", contents(again))
+
+	// The oldest lines are overwritten when the log is full, and the line
+	// that was partially overwritten is skipped.
+	for i := 0; i < 20; i++ {
+		log.Write([]byte(fmt.Sprintf("line %d\n", i)))
+	}
+	fmt.Printf("wrapped: %q\n", contents(log))
+
+	// Only the end of a write that is larger than the log is kept.
+	log.Write([]byte(strings.Repeat("x", 60) + "\nend\n"))
+	fmt.Printf("large write: %q\n", contents(log))
+
+	// A partial line that continues at the start of the buffer is skipped
+	// as well.
+	log.Clear()
+	log.Write([]byte("a\n"))
+	log.Write([]byte(strings.Repeat("b", 50) + "\n"))
+	fmt.Printf("partial line: %q\n", contents(log))
+
+	log.Clear()
+	fmt.Printf("cleared: %q\n", contents(log))
+
+	// Dump adds a newline before the end marker if needed.
+	log.Write([]byte("no newline"))
+	crashlog.Dump(os.Stdout, log)
+}
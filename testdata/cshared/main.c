@@ -0,0 +1,31 @@
+#include <dlfcn.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+
+// Load the shared library at run time, like a plugin, and call the exported
+// functions. The runtime must already be initialized when dlopen returns.
+int main(int argc, char **argv) {
+	if (argc != 2) {
+		fprintf(stderr, "usage: %s library\n", argv[0]);
+		return 1;
+	}
+	void *lib = dlopen(argv[1], RTLD_NOW);
+	if (lib == NULL) {
+		fprintf(stderr, "dlopen: %s\n", dlerror());
+		return 1;
+	}
+	bool (*is_initialized)(void) = (bool (*)(void))dlsym(lib, "is_initialized");
+	int32_t (*add)(int32_t, int32_t) = (int32_t (*)(int32_t, int32_t))dlsym(lib, "add");
+	int32_t (*sum)(int32_t) = (int32_t (*)(int32_t))dlsym(lib, "sum");
+	if (is_initialized == NULL || add == NULL || sum == NULL) {
+		fprintf(stderr, "dlsym: %s\n", dlerror());
+		return 1;
+	}
+	printf("initialized: %d\n", is_initialized());
+	printf("add: %d\n", add(3, 4));
+	printf("sum: %d\n", sum(100));
+	printf("main hidden: %d\n", dlsym(lib, "main") == NULL);
+	dlclose(lib);
+	return 0;
+}
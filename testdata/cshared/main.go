@@ -0,0 +1,39 @@
+package main
+
+import "runtime"
+
+var initialized bool
+
+func init() {
+	initialized = true
+}
+
+//export add
+func add(a, b int32) int32 {
+	return a + b
+}
+
+//export is_initialized
+func isInitialized() bool {
+	return initialized
+}
+
+// sum allocates a slice on the heap and runs the GC while it is in use, to
+// check that the heap and the stack top are set up correctly when called from
+// the host program.
+//export sum
+func sum(n int32) int32 {
+	var values []int32
+	for i := int32(1); i <= n; i++ {
+		values = append(values, i)
+	}
+	runtime.GC()
+	total := int32(0)
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+func main() {
+}
@@ -0,0 +1,68 @@
+// Package backend is a dummy OS backend for the customos target. It only
+// exists to check that a program for this target can be built.
+package backend
+
+import "unsafe"
+
+//export tinygo_os_putchar
+func putchar(c byte) {
+}
+
+//export tinygo_os_ticks
+func ticks() uint64 {
+	return 0
+}
+
+//export tinygo_os_ticks_per_second
+func ticksPerSecond() uint64 {
+	return 1000
+}
+
+//export tinygo_os_sleep
+func sleep(ticks uint64) {
+}
+
+//export tinygo_os_wait
+func wait() {
+}
+
+//export tinygo_os_abort
+func abort() {
+	for {
+	}
+}
+
+var heap [4096]byte
+
+//export tinygo_os_heap_start
+func heapStart() uintptr {
+	return uintptr(unsafe.Pointer(&heap[0]))
+}
+
+//export tinygo_os_heap_end
+func heapEnd() uintptr {
+	return heapStart() + uintptr(len(heap))
+}
+
+//export tinygo_os_globals_start
+func globalsStart() uintptr {
+	return 0
+}
+
+//export tinygo_os_globals_end
+func globalsEnd() uintptr {
+	return 0
+}
+
+//export tinygo_os_task_switch
+func taskSwitch(task uintptr) {
+}
+
+//export tinygo_os_disable_interrupts
+func disableInterrupts() uintptr {
+	return 0
+}
+
+//export tinygo_os_restore_interrupts
+func restoreInterrupts(state uintptr) {
+}
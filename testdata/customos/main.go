@@ -0,0 +1,11 @@
+package main
+
+import "time"
+
+func main() {
+	go func() {
+		println("goroutine")
+	}()
+	time.Sleep(time.Millisecond)
+	println("done")
+}
@@ -0,0 +1,29 @@
+package main
+
+// Deadlocks with goroutines that are blocked on different operations, so that
+// -deadlocktrace prints each of them.
+
+import (
+	"runtime"
+	"sync"
+)
+
+var mu sync.Mutex
+
+func main() {
+	ch := make(chan int)
+	mu.Lock()
+	go func() {
+		<-ch
+	}()
+	go func() {
+		mu.Lock()
+	}()
+	// Let both goroutines run until they block.
+	runtime.Gosched()
+
+	println("start")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	wg.Wait()
+}
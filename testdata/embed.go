@@ -0,0 +1,46 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed embed/hello.txt
+var helloString string
+
+//go:embed embed/hello.txt
+var helloBytes []byte
+
+//go:embed embed
+var files embed.FS
+
+func main() {
+	println("string:", helloString)
+	println("bytes:", string(helloBytes))
+
+	// A []byte can be modified.
+	helloBytes[0] = 'H'
+	println("modified:", string(helloBytes))
+
+	data, err := files.ReadFile("embed/hello.txt")
+	if err != nil {
+		println("could not read file:", err.Error())
+	}
+	println("file:", string(data))
+
+	entries, err := files.ReadDir("embed/dir")
+	if err != nil {
+		println("could not read directory:", err.Error())
+	}
+	for _, entry := range entries {
+		println("entry:", entry.Name(), entry.IsDir())
+	}
+
+	_, err = files.Open("embed/dir/.hidden")
+	println("hidden file exists:", err == nil)
+
+	fs.WalkDir(files, ".", func(path string, d fs.DirEntry, err error) error {
+		println("walk:", path)
+		return nil
+	})
+}
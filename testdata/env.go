@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"strings"
 )
 
 func main() {
@@ -13,6 +14,16 @@ func main() {
 	}
 	println("ENV2:", v)
 
+	// Check for helpers built on top of environment variables.
+	home, err := os.UserHomeDir()
+	println("home:", home, err == nil)
+	configDir, err := os.UserConfigDir()
+	println("config dir in home:", strings.HasPrefix(configDir, home+"/"), err == nil)
+	cacheDir, err := os.UserCacheDir()
+	println("cache dir in home:", strings.HasPrefix(cacheDir, home+"/"), err == nil)
+	println("temp dir:", os.TempDir())
+	println("expanded:", os.ExpandEnv("$ENV1/${ENV2}/$UNDEFINED."))
+
 	// Check for command line arguments.
 	// Argument 0 is skipped because it is the program name, which varies by
 	// test run.
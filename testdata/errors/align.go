@@ -0,0 +1,31 @@
+package main
+
+// The alignment must be a power of two.
+//go:align 3
+var notPowerOfTwo [12]byte
+
+//go:align 0
+var zero [4]byte
+
+//go:align
+var missing [4]byte
+
+// Functions cannot be aligned.
+//go:align 16
+func alignedFunc() {
+}
+
+// Valid alignment.
+//go:align 16
+var aligned [16]byte
+
+func main() {
+	alignedFunc()
+	println(notPowerOfTwo[0], zero[0], missing[0], aligned[0])
+}
+
+// ERROR: # command-line-arguments
+// ERROR: align.go:4:1: global variable alignment must be a positive power of two
+// ERROR: align.go:7:1: global variable alignment must be a positive power of two
+// ERROR: align.go:10:1: usage: //go:align n
+// ERROR: align.go:14:1: //go:align is not supported on functions
@@ -0,0 +1,45 @@
+package main
+
+import "device/arm"
+
+// An input tied to an output must have the same type.
+func tiedMismatch(x uint32) uint8 {
+	var result uint8
+	arm.AsmExtPure("adds $0, $0, #1", "=r,0", &result, x)
+	return result
+}
+
+// An input can only be tied to an output that exists.
+func tiedMissing(x uint32) uint32 {
+	var result uint32
+	arm.AsmExtPure("adds $0, $1, #1", "=r,1", &result, x)
+	return result
+}
+
+// A correctly tied input.
+func tiedOK(x uint32) uint32 {
+	var result uint32
+	arm.AsmExtPure("adds $0, $0, #1", "=r,0", &result, x)
+	return result
+}
+
+// A $$ is a literal $, not a reference to an operand.
+func literalDollar() {
+	arm.AsmExt("# $$1", "")
+}
+
+// Operands referenced in the asm string must exist.
+func missingOperand(x uint32) {
+	arm.AsmExt("# $0 $1", "r", x)
+}
+
+func main() {
+	println(tiedMismatch(1), tiedMissing(2), tiedOK(3))
+	literalDollar()
+	missingOperand(4)
+}
+
+// ERROR: # command-line-arguments
+// ERROR: asm.go:8:16: inline assembly input operand 1 has type uint32, but is tied to output operand 0 of type uint8
+// ERROR: asm.go:15:16: inline assembly input operand 1 is tied to output operand 1, which does not exist
+// ERROR: asm.go:33:12: inline assembly refers to operand $1, but there are only 1 operands
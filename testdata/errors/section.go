@@ -0,0 +1,33 @@
+package main
+
+// Not placed by the linker script of cortex-m-qemu.
+//go:section .dma
+var dmaBuffer [64]byte
+
+// Functions in a NOLOAD section would never be loaded.
+//go:section .noinit
+func noinitFunction() {
+}
+
+// Globals in a NOLOAD section keep their value across a reset, so they cannot
+// have an initial value.
+//go:section .noinit
+var bootCount = 1
+
+//go:section .noinit
+var table = [2]int{1, 2}
+
+// Globals without an initial value can be placed in a NOLOAD section.
+//go:section .noinit
+var resetReason uint32
+
+func main() {
+	noinitFunction()
+	println(dmaBuffer[0], bootCount, table[0], resetReason)
+}
+
+// ERROR: # command-line-arguments
+// ERROR: section.go:4:1: unknown section ".dma": it is not placed by the linker script of this target
+// ERROR: section.go:9:6: function noinitFunction is placed in section ".noinit", which is not loaded from the binary
+// ERROR: section.go:15:5: global bootCount is placed in section ".noinit", which is not loaded from the binary, so it cannot have an initial value
+// ERROR: section.go:18:5: global table is placed in section ".noinit", which is not loaded from the binary, so it cannot have an initial value
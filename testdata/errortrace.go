@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// Created during package initialization, so no address is known.
+var errGlobal = errors.New("global error")
+
+// makeError creates an error in a helper function, so that the call chain of
+// the error contains both the helper and the function that called it.
+//go:noinline
+func makeError() error {
+	return errors.New("helper error")
+}
+
+func main() {
+	err := errors.New("some error")
+	println("errors.New:", err.Error(), len(debug.ErrorTrace(err)))
+
+	err = fmt.Errorf("formatted error %d", 3)
+	println("fmt.Errorf:", err.Error(), len(debug.ErrorTrace(err)), errors.Unwrap(err) == nil)
+
+	wrapped := fmt.Errorf("wrapped: %w", err)
+	trace := debug.ErrorTrace(wrapped)
+	println("wrapped:", wrapped.Error(), len(trace), errors.Is(wrapped, err))
+	println("distinct addresses:", len(trace) == 2 && trace[0][0] != trace[1][0] && trace[0][0] != 0)
+
+	wrapped = fmt.Errorf("wrapped global: %w", errGlobal)
+	println("wrapped global:", len(debug.ErrorTrace(wrapped)), errors.Is(wrapped, errGlobal))
+
+	// Errors created by the same helper from two places have the same
+	// innermost address, but a different caller.
+	first := debug.ErrorTrace(makeError())[0]
+	second := debug.ErrorTrace(makeError())[0]
+	println("call chain:", len(first) >= 2 && len(second) >= 2)
+	println("same helper:", first[0] == second[0])
+	println("different caller:", len(first) >= 2 && len(second) >= 2 && first[1] != second[1])
+}
@@ -0,0 +1,55 @@
+package main
+
+// Test runtime/extmem with the external heap region of the target in
+// testdata/heapregions, which is ordinary RAM in QEMU.
+
+import (
+	"errors"
+	"runtime/extmem"
+	"unsafe"
+)
+
+// The external heap region.
+const (
+	externalStart = 0x2000c000
+	externalEnd   = 0x20010000
+)
+
+func inExternal(ptr unsafe.Pointer) bool {
+	return uintptr(ptr) >= externalStart && uintptr(ptr) < externalEnd
+}
+
+func main() {
+	// The external memory is only used after Init.
+	println("slow alloc before init:", extmem.Alloc(64, extmem.Slow) == nil)
+	err := extmem.Init(func() error {
+		return errors.New("memory controller not ready")
+	})
+	println("failed init:", err.Error(), extmem.Size())
+
+	err = extmem.Init(nil)
+	println("init:", err == nil, extmem.Size() > 12*1024 && extmem.Size() < 16*1024)
+
+	slow := extmem.MakeBytes(1024, extmem.Slow)
+	println("slow bytes:", len(slow), cap(slow), inExternal(unsafe.Pointer(&slow[0])))
+	zeroed := true
+	for _, b := range slow {
+		if b != 0 {
+			zeroed = false
+		}
+	}
+	println("zeroed:", zeroed)
+	fast := extmem.MakeBytes(1024, extmem.Fast)
+	println("fast bytes:", len(fast), inExternal(unsafe.Pointer(&fast[0])))
+	println("too large:", extmem.MakeBytes(32*1024, extmem.Slow) == nil)
+
+	// The external region has a lower priority than the main heap.
+	ordinary := new([16]int)
+	println("ordinary alloc in external memory:", inExternal(unsafe.Pointer(ordinary)))
+
+	// Calling Init again has no effect.
+	err = extmem.Init(func() error {
+		panic("init called again")
+	})
+	println("init again:", err == nil)
+}
@@ -0,0 +1,35 @@
+package main
+
+// Test the lightweight fmt mode (-fmt=light). Lowered calls must print the same
+// as the fmt package, and in the same order relative to calls that are not
+// lowered and to other writes to os.Stdout.
+
+import (
+	"fmt"
+	"os"
+)
+
+type number int
+
+func main() {
+	n := 42
+	s := "foo"
+	fmt.Printf("int: %d, string: %s, bool: %t\n", n, s, true)
+	fmt.Printf("value: %v %v %v, named: %d\n", -n, s, false, number(3))
+	fmt.Printf("percent: 100%%\n")
+	fmt.Println("println:", n, s, true)
+	fmt.Println()
+
+	// Lowered output without a newline, mixed with output that doesn't go
+	// through the runtime print functions.
+	fmt.Printf("lowered %d, ", n)
+	fmt.Printf("not lowered %5d, ", n)
+	os.Stdout.WriteString("os.Stdout, ")
+	fmt.Printf("lowered %s", s)
+	fmt.Print(", fmt.Print\n")
+	fmt.Printf("%s", "no newline, ")
+	fmt.Println("println")
+
+	str := fmt.Sprintf("%s=%d (%v)", s, n, true)
+	fmt.Println(str, len(str))
+}
@@ -0,0 +1,72 @@
+package main
+
+// Test the allocator with an extra heap region (see target.json). Allocations
+// go to the region with the highest priority first and continue in the main
+// heap when it is full. The GC must keep objects in both alive, and free them
+// again.
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// The sram-high heap region.
+const (
+	regionStart = 0x2000a000
+	regionEnd   = 0x2000c000
+)
+
+type node struct {
+	next  *node
+	value int
+	data  [56]byte
+}
+
+var list *node
+
+func inRegion(n *node) bool {
+	return uintptr(unsafe.Pointer(n)) >= regionStart && uintptr(unsafe.Pointer(n)) < regionEnd
+}
+
+func main() {
+	list = &node{}
+	println("first allocation in region:", inRegion(list))
+	fill()
+
+	// The list points from the main heap into the region. All of it must
+	// survive a GC cycle.
+	runtime.GC()
+	check()
+
+	// After freeing the list, the region is used again.
+	list = nil
+	runtime.GC()
+	list = &node{}
+	println("allocation after GC in region:", inRegion(list))
+}
+
+// fill adds nodes to the list. The region has room for 128 nodes (minus the
+// earlier allocations), so the rest goes to the main heap. This is a separate
+// function, so that no stale pointers to the nodes stay on the stack.
+//go:noinline
+func fill() {
+	nodesInRegion := 0
+	for i := 1; i < 200; i++ {
+		list = &node{next: list, value: i}
+		if inRegion(list) {
+			nodesInRegion++
+		}
+	}
+	println("region filled:", nodesInRegion > 100)
+	println("continued in main heap:", !inRegion(list))
+}
+
+//go:noinline
+func check() {
+	count, sum := 0, 0
+	for n := list; n != nil; n = n.next {
+		count++
+		sum += n.value
+	}
+	println("nodes:", count, "sum:", sum)
+}
@@ -0,0 +1,58 @@
+package main
+
+// The heap statistics of runtime/debug must follow the allocations and the GC
+// cycles of the program.
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+const numAllocs = 10
+
+var keep [][]byte
+
+func main() {
+	runtime.GC()
+	var start debug.HeapStats
+	debug.ReadHeapStats(&start)
+
+	allocate()
+	var allocated debug.HeapStats
+	debug.ReadHeapStats(&allocated)
+	println("in use after allocating:", allocated.InUse >= start.InUse+numAllocs*100)
+	println("peak after allocating:", allocated.Peak >= allocated.InUse)
+	println("no GC cycle while allocating:", allocated.NumGC == start.NumGC)
+
+	runtime.GC()
+	var collected debug.HeapStats
+	debug.ReadHeapStats(&collected)
+	println("GC cycle counted:", collected.NumGC == start.NumGC+1)
+	println("allocations still live:", collected.Live >= start.Live+numAllocs*100)
+	println("in use is live after GC:", collected.InUse == collected.Live)
+	println("pause time counted:", collected.PauseTotal >= start.PauseTotal+collected.LastPause)
+
+	release()
+	runtime.GC()
+	var freed debug.HeapStats
+	debug.ReadHeapStats(&freed)
+	println("allocations freed:", freed.Live < collected.Live)
+	println("peak kept:", freed.Peak >= collected.Live)
+
+	println("GC trace default:", debug.SetGCTrace(5))
+	println("GC trace previous:", debug.SetGCTrace(-1))
+	println("GC trace disabled:", debug.SetGCTrace(0))
+}
+
+//go:noinline
+func allocate() {
+	keep = make([][]byte, numAllocs)
+	for i := range keep {
+		keep[i] = make([]byte, 100)
+	}
+}
+
+//go:noinline
+func release() {
+	keep = nil
+}
@@ -0,0 +1,42 @@
+package main
+
+// The idle hook must be called by the scheduler while all goroutines sleep,
+// with the time until the first one wakes up.
+
+import (
+	"runtime"
+	"time"
+)
+
+var (
+	calls        int
+	firstTimeout int64
+	skipWait     bool
+)
+
+func idle(timeout int64) bool {
+	if calls == 0 {
+		firstTimeout = timeout
+	}
+	calls++
+	return skipWait
+}
+
+func main() {
+	runtime.SetIdleHook(idle)
+	time.Sleep(10 * time.Millisecond)
+	println("called while sleeping:", calls != 0)
+	println("timeout until wakeup:", firstTimeout > 0 && firstTimeout <= int64(10*time.Millisecond))
+
+	// When the hook returns true, the scheduler doesn't wait but calls the
+	// hook again until the goroutine can run.
+	skipWait = true
+	before := calls
+	time.Sleep(time.Millisecond)
+	println("called repeatedly:", calls > before+1)
+
+	runtime.SetIdleHook(nil)
+	before = calls
+	time.Sleep(time.Millisecond)
+	println("removed:", calls == before)
+}
@@ -1,9 +1,16 @@
 package main
 
 // These globals can be changed using -ldflags="-X main.someGlobal=value".
-// At the moment, only globals without an initializer can be replaced this way.
+// Like with the Go linker, this works for globals without an initializer and
+// for globals that are initialized to a constant string.
 var someGlobal string
 
+var someInitializedGlobal = "default"
+
+var notChanged = "default"
+
 func main() {
 	println("someGlobal:", someGlobal)
+	println("someInitializedGlobal:", someInitializedGlobal)
+	println("notChanged:", notChanged)
 }
@@ -0,0 +1,26 @@
+package main
+
+import _ "unsafe"
+
+// Reference a function in the runtime.
+//go:linkname stringEqual runtime.stringEqual
+func stringEqual(x, y string) bool
+
+// Reference a global in the runtime.
+//go:linkname overflowError runtime.overflowError
+var overflowError error
+
+// Define a function under a different name, and call it using that name.
+//go:linkname double main.twice
+func double(n int) int {
+	return n * 2
+}
+
+//go:linkname twice main.twice
+func twice(n int) int
+
+func main() {
+	println("stringEqual:", stringEqual("foo", "foo"), stringEqual("foo", "bar"))
+	println("overflowError:", overflowError.Error())
+	println("twice:", twice(21))
+}
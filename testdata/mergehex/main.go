@@ -0,0 +1,8 @@
+package main
+
+// The settings in settings.hex, at the end of flash, are merged into the
+// firmware image by the merge-hex option of target.json.
+
+func main() {
+	println("hello")
+}
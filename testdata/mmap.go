@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+func main() {
+	f, err := os.Open("testdata/filesystem.txt")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		panic(err)
+	}
+	println("name:", info.Name())
+	println("size:", info.Size())
+	println("dir: ", info.IsDir())
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		panic(err)
+	}
+	print(string(data))
+	if err := syscall.Munmap(data); err != nil {
+		panic(err)
+	}
+}
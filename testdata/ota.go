@@ -0,0 +1,170 @@
+package main
+
+// Test the MCUboot update sequence of runtime/ota on a flash memory that is
+// emulated in RAM, including the offsets of the trailer fields that are read
+// by the bootloader.
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime/ota"
+)
+
+// memFlash is flash memory in RAM, which checks that writes are aligned and
+// only go to erased flash, like real flash.
+type memFlash struct {
+	data       []byte
+	writeBlock int64
+	eraseBlock int64
+}
+
+func newFlash(size, writeBlock, eraseBlock int64) *memFlash {
+	f := &memFlash{data: make([]byte, size), writeBlock: writeBlock, eraseBlock: eraseBlock}
+	f.EraseBlocks(0, size/eraseBlock)
+	return f
+}
+
+func (f *memFlash) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > f.Size() {
+		return 0, errors.New("read out of range")
+	}
+	return copy(p, f.data[off:]), nil
+}
+
+func (f *memFlash) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > f.Size() {
+		return 0, errors.New("write out of range")
+	}
+	if off%f.writeBlock != 0 || int64(len(p))%f.writeBlock != 0 {
+		return 0, errors.New("unaligned write")
+	}
+	for i := range p {
+		if f.data[off+int64(i)] != 0xff {
+			return 0, fmt.Errorf("write to flash that is not erased at 0x%x", off+int64(i))
+		}
+	}
+	return copy(f.data[off:], p), nil
+}
+
+func (f *memFlash) Size() int64           { return int64(len(f.data)) }
+func (f *memFlash) WriteBlockSize() int64 { return f.writeBlock }
+func (f *memFlash) EraseBlockSize() int64 { return f.eraseBlock }
+
+func (f *memFlash) EraseBlocks(start, len int64) error {
+	if start < 0 || len < 0 || (start+len)*f.eraseBlock > f.Size() {
+		return errors.New("erase out of range")
+	}
+	for i := start * f.eraseBlock; i < (start+len)*f.eraseBlock; i++ {
+		f.data[i] = 0xff
+	}
+	return nil
+}
+
+const slotSize = 4096
+
+// makeImage returns an MCUboot image with the given program size: a 32-byte
+// header, the program and the TLVs with the SHA-256 hash.
+func makeImage(programSize int) []byte {
+	image := make([]byte, 32+programSize)
+	binary.LittleEndian.PutUint32(image[0:], 0x96f3b83d) // magic
+	binary.LittleEndian.PutUint16(image[8:], 32)         // header size
+	binary.LittleEndian.PutUint32(image[12:], uint32(programSize))
+	for i := 32; i < len(image); i++ {
+		image[i] = byte(i * 7)
+	}
+	hash := sha256.Sum256(image)
+	tlv := make([]byte, 4+4+len(hash))
+	binary.LittleEndian.PutUint16(tlv[0:], 0x6907) // TLV info magic
+	binary.LittleEndian.PutUint16(tlv[2:], uint16(len(tlv)))
+	tlv[4] = 0x10 // SHA-256
+	binary.LittleEndian.PutUint16(tlv[6:], uint16(len(hash)))
+	copy(tlv[8:], hash[:])
+	return append(image, tlv...)
+}
+
+// writeImage writes the image to the secondary slot in chunks of an odd size,
+// so that the writes are not aligned to the write block size.
+func writeImage(boot *ota.MCUboot, image []byte) error {
+	update, err := boot.NewUpdate()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(image); i += 13 {
+		end := i + 13
+		if end > len(image) {
+			end = len(image)
+		}
+		if _, err := update.Write(image[i:end]); err != nil {
+			return err
+		}
+	}
+	if err := update.Close(); err != nil {
+		return err
+	}
+	fmt.Println("written:", update.Size())
+	return nil
+}
+
+// printTrailer prints the fields of the trailer at the end of a slot: the
+// swap info, copy done and image ok flags and whether the magic is present.
+func printTrailer(flash *memFlash, slot ota.Slot) {
+	end := slot.Offset + slot.Size
+	magic := flash.data[end-16 : end]
+	hasMagic := magic[0] == 0x77 && magic[15] == 0x80
+	fmt.Printf("  swap info: 0x%02x, copy done: 0x%02x, image ok: 0x%02x, magic: %v\n", flash.data[end-40], flash.data[end-32], flash.data[end-24], hasMagic)
+}
+
+func main() {
+	for _, writeBlock := range []int64{4, 8} {
+		fmt.Println("write block size:", writeBlock)
+		flash := newFlash(2*slotSize, writeBlock, 256)
+		boot := &ota.MCUboot{
+			Flash:     flash,
+			Primary:   ota.Slot{Offset: 0, Size: slotSize},
+			Secondary: ota.Slot{Offset: slotSize, Size: slotSize},
+		}
+
+		// Write a new image and check it.
+		image := makeImage(1001)
+		if err := writeImage(boot, image); err != nil {
+			fmt.Println("write:", err.Error())
+		}
+		fmt.Println("validate:", boot.Validate() == nil)
+		flash.data[slotSize+100] ^= 1
+		fmt.Println("validate corrupted:", boot.Validate() == ota.ErrImageHash)
+		flash.data[slotSize+100] ^= 1
+
+		// Request a test upgrade. It can only be requested once.
+		fmt.Println("request upgrade:", boot.RequestUpgrade(false) == nil)
+		printTrailer(flash, boot.Secondary)
+		fmt.Println("request again:", boot.RequestUpgrade(false) == ota.ErrUpgradePending)
+
+		// A new update erases the trailer of the previous one.
+		if err := writeImage(boot, image); err != nil {
+			fmt.Println("write:", err.Error())
+		}
+		printTrailer(flash, boot.Secondary)
+		fmt.Println("request permanent upgrade:", boot.RequestUpgrade(true) == nil)
+		printTrailer(flash, boot.Secondary)
+
+		// Confirm does nothing for an image that wasn't installed by a test
+		// upgrade.
+		fmt.Println("confirm flashed image:", boot.Confirm() == nil)
+		printTrailer(flash, boot.Primary)
+
+		// Pretend the bootloader installed the image with a test upgrade,
+		// which leaves the magic in the primary trailer.
+		copy(flash.data[slotSize-16:], flash.data[2*slotSize-16:])
+		fmt.Println("confirm:", boot.Confirm() == nil)
+		printTrailer(flash, boot.Primary)
+		fmt.Println("confirm again:", boot.Confirm() == nil)
+
+		// The last erase block of the slot is reserved for the trailer.
+		_, err := ota.NewUpdate(flash, ota.Slot{Offset: 100, Size: slotSize})
+		fmt.Println("unaligned slot:", err == ota.ErrSlotAlignment)
+		err = writeImage(boot, make([]byte, slotSize-256+1))
+		fmt.Println("image too large:", err == ota.ErrImageTooLarge)
+	}
+}
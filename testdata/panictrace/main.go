@@ -0,0 +1,21 @@
+package main
+
+// Panics a few calls deep, so that the traceback printed with -panic=trace
+// contains the names of these functions.
+
+func main() {
+	println("start")
+	outer()
+}
+
+//go:noinline
+func outer() {
+	inner()
+	println("not reached")
+}
+
+//go:noinline
+func inner() {
+	var s []int
+	println(s[3])
+}
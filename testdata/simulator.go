@@ -0,0 +1,100 @@
+package main
+
+// Test the simulated peripherals of the machine package (-target=simulator).
+
+import (
+	"bytes"
+	"machine"
+	"time"
+)
+
+const (
+	led    = machine.Pin(13)
+	button = machine.Pin(2)
+)
+
+func main() {
+	// GPIO: output changes are reported through the hook.
+	machine.SimulatePinChangeHook(func(pin machine.Pin, value bool) {
+		println("pin", pin, "set to", value)
+	})
+	led.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	led.High()
+	led.High() // no change
+	led.Low()
+	println("led:", led.Get())
+
+	// GPIO: inputs with interrupts.
+	button.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	println("button (pull-up):", button.Get())
+	button.SetInterrupt(machine.PinFalling, func(pin machine.Pin) {
+		println("button pressed")
+	})
+	machine.SimulatePin(button, false)
+	machine.SimulatePin(button, true)
+	println("button:", button.Get())
+
+	// Scripted events.
+	pressed := make(chan struct{})
+	button.SetInterrupt(machine.PinToggle, func(pin machine.Pin) {
+		pressed <- struct{}{}
+	})
+	machine.SimulateAfter(time.Millisecond, func() {
+		machine.SimulatePin(button, false)
+	})
+	<-pressed
+	println("button after timer:", button.Get())
+
+	// ADC.
+	machine.InitADC()
+	adc := machine.ADC{Pin: 3}
+	adc.Configure(machine.ADCConfig{})
+	machine.SimulateADC(3, 0x1234)
+	println("adc:", adc.Get())
+
+	// SPI: loopback by default.
+	spi := machine.SPI0
+	spi.Configure(machine.SPIConfig{})
+	rx := make([]byte, 3)
+	spi.Tx([]byte{1, 2, 3}, rx)
+	println("spi loopback:", rx[0], rx[1], rx[2])
+	spi.SimulateDevice(func(w byte) byte {
+		return w + 100
+	})
+	spi.Tx([]byte{1, 2, 3}, rx)
+	println("spi device:", rx[0], rx[1], rx[2])
+
+	// I2C.
+	i2c := machine.I2C0
+	i2c.Configure(machine.I2CConfig{})
+	i2c.SimulateDevice(0x76, func(w, r []byte) error {
+		for i := range r {
+			r[i] = w[0] + byte(i)
+		}
+		return nil
+	})
+	buf := make([]byte, 2)
+	err := i2c.Tx(0x76, []byte{0xd0}, buf)
+	println("i2c:", buf[0], buf[1], err == nil)
+	err = i2c.Tx(0x77, []byte{0xd0}, buf)
+	println("i2c missing device:", err != nil)
+
+	// UART.
+	uart := machine.UART0
+	uart.Configure(machine.UARTConfig{})
+	var output bytes.Buffer
+	uart.SimulateOutput(&output)
+	uart.Write([]byte("hello"))
+	uart.WriteByte('!')
+	println("uart output:", output.String())
+	uart.SimulateInput([]byte("ab"))
+	println("uart buffered:", uart.Buffered())
+	for {
+		b, err := uart.ReadByte()
+		if err != nil {
+			println("uart empty")
+			break
+		}
+		println("uart read:", string(b))
+	}
+}
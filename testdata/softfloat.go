@@ -0,0 +1,70 @@
+package main
+
+// Test vectors for the soft-float and integer division routines, which are
+// implemented in assembly on some targets (see lib/tinygo-builtins). Values
+// are stored in globals so that the operations are not constant folded.
+
+import "math"
+
+var f32s = []float32{
+	0,
+	float32(math.Copysign(0, -1)),
+	1,
+	-1,
+	1.5,
+	3,
+	0.1,
+	1e-45,          // smallest subnormal
+	1.1754942e-38,  // largest subnormal
+	1.17549435e-38, // smallest normal
+	16777216,       // 2**24: adding 1 needs rounding
+	16777218,
+	5.9604645e-08, // 2**-24: adding it to 1 is a tie that rounds to even
+	5.960465e-08,  // just above 2**-24: adding it to 1 rounds up
+	3.4028235e+38, // largest float32
+	float32(math.Inf(1)),
+	float32(math.Inf(-1)),
+	float32(math.NaN()),
+}
+
+var i32s = []int32{0, 1, -1, 7, -7, 3, 1000000007, math.MaxInt32, math.MinInt32}
+
+var i64s = []int64{0, 1, -1, 7, -7, 3, 1 << 32, 1000000000000000003, 0x123456789abcdef, math.MaxInt64, math.MinInt64}
+
+func main() {
+	println("float32:")
+	for _, a := range f32s {
+		for _, b := range f32s {
+			println(f32bits(a), f32bits(b), f32bits(a+b), f32bits(a-b), f32bits(a*b))
+		}
+	}
+
+	println("int32:")
+	for _, a := range i32s {
+		for _, b := range i32s {
+			if b == 0 {
+				continue
+			}
+			println(a, b, a/b, a%b, uint32(a)/uint32(b), uint32(a)%uint32(b))
+		}
+	}
+
+	println("int64:")
+	for _, a := range i64s {
+		for _, b := range i64s {
+			if b == 0 {
+				continue
+			}
+			println(a, b, a/b, a%b, uint64(a)/uint64(b), uint64(a)%uint64(b))
+		}
+	}
+}
+
+// f32bits returns the bits of a float32, with all NaNs replaced by the same
+// quiet NaN as the NaN payload is not specified.
+func f32bits(f float32) uint32 {
+	if f != f {
+		return 0x7fc00000
+	}
+	return math.Float32bits(f)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -19,6 +20,13 @@ func main() {
 	// package strings
 	fmt.Println("strings.IndexByte:", strings.IndexByte("asdf", 'd'))
 	fmt.Println("strings.Replace:", strings.Replace("An example string", " ", "-", -1))
+	fmt.Println("strings.ToUpper:", strings.ToUpper("Ünïcödé ǆ ȿ ꙋ 𐐨"))
+	fmt.Println("strings.ToLower:", strings.ToLower("ÜNÏCÖDÉ ǅ Ȿ Ꙋ 𐐀"))
+	fmt.Println("strings.EqualFold:", strings.EqualFold("Σίσυφος", "ΣΊΣΥΦΟΣ"), strings.EqualFold("kelvin", "\u212Aelvin"))
+
+	// package strconv
+	fmt.Println("strconv.FormatFloat:", strconv.FormatFloat(0.1, 'g', -1, 64), strconv.FormatFloat(1e23, 'e', -1, 64), strconv.FormatFloat(3.14159, 'f', 2, 32))
+	fmt.Println("strconv.FormatFloat:", strconv.FormatFloat(2.5, 'f', 0, 64), strconv.FormatFloat(5e-324, 'g', -1, 64), strconv.FormatFloat(123456789, 'g', 4, 64))
 
 	// Exit the program normally.
 	os.Exit(0)
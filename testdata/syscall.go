@@ -0,0 +1,35 @@
+package main
+
+// Test system calls that are lowered to inline assembly by the compiler, using
+// the different variants and numbers of arguments.
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func main() {
+	// syscall.Getpid uses a system call variant without an error result.
+	pid, _, errno := syscall.RawSyscall(syscall.SYS_GETPID, 0, 0, 0)
+	println("getpid:", int(pid) == syscall.Getpid(), errno == 0)
+
+	var fds [2]int
+	err := syscall.Pipe(fds[:])
+	if err != nil {
+		println("could not create pipe:", err.Error())
+		return
+	}
+
+	// Pass all six arguments, the kernel ignores the last three.
+	msg := []byte("hello")
+	n, _, errno := syscall.Syscall6(syscall.SYS_WRITE, uintptr(fds[1]), uintptr(unsafe.Pointer(&msg[0])), uintptr(len(msg)), 0, 0, 0)
+	println("write:", n, errno == 0)
+
+	buf := make([]byte, 16)
+	n, _, errno = syscall.Syscall(syscall.SYS_READ, uintptr(fds[0]), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	println("read:", string(buf[:n]), errno == 0)
+
+	// A failing system call returns the error number.
+	_, _, errno = syscall.Syscall(syscall.SYS_CLOSE, ^uintptr(0), 0, 0)
+	println("close:", errno == syscall.EBADF)
+}
@@ -0,0 +1,108 @@
+package main
+
+// This program is built with -trace-hooks=systemview. Instead of the SEGGER
+// SystemView target sources, it implements the SystemView functions itself to
+// check that goroutines are registered as tasks.
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// taskInfo is SEGGER_SYSVIEW_TASKINFO.
+type taskInfo struct {
+	taskID    uint32
+	name      *byte
+	prio      uint32
+	stackBase uint32
+	stackSize uint32
+}
+
+var (
+	created    []uint32
+	terminated []uint32
+	infos      []taskInfo
+)
+
+//export SEGGER_SYSVIEW_OnTaskCreate
+func onTaskCreate(taskID uint32) {
+	created = append(created, taskID)
+}
+
+//export SEGGER_SYSVIEW_OnTaskTerminate
+func onTaskTerminate(taskID uint32) {
+	terminated = append(terminated, taskID)
+}
+
+//export SEGGER_SYSVIEW_SendTaskInfo
+func sendTaskInfo(info *taskInfo) {
+	infos = append(infos, *info)
+}
+
+//export SEGGER_SYSVIEW_OnTaskStartExec
+func onTaskStartExec(taskID uint32) {
+}
+
+//export SEGGER_SYSVIEW_OnTaskStopExec
+func onTaskStopExec() {
+}
+
+//export SEGGER_SYSVIEW_OnTaskStartReady
+func onTaskStartReady(taskID uint32) {
+}
+
+//export SEGGER_SYSVIEW_OnTaskStopReady
+func onTaskStopReady(taskID uint32, cause uint32) {
+}
+
+//export SEGGER_SYSVIEW_RecordEnterISR
+func recordEnterISR() {
+}
+
+//export SEGGER_SYSVIEW_RecordExitISR
+func recordExitISR() {
+}
+
+//export tinygo_systemview_send_task_list
+func sendTaskList()
+
+func main() {
+	// The main goroutine was registered before main was called.
+	println("created before main:", len(created))
+
+	done := make(chan struct{})
+	go func() {
+		done <- struct{}{}
+	}()
+	<-done
+	runtime.Gosched()
+	println("created:", len(created))
+	println("terminated:", len(terminated))
+	println("terminated the new goroutine:", len(terminated) == 1 && terminated[0] == created[1])
+
+	println("task infos:", len(infos))
+	for _, info := range infos {
+		if info.taskID == 0 || name(info.name) != "goroutine" || info.stackBase == 0 || info.stackSize == 0 {
+			println("invalid task info for task", info.taskID)
+		}
+	}
+
+	// Only the main goroutine is still running.
+	infos = nil
+	sendTaskList()
+	println("listed:", len(infos))
+	println("listed the main goroutine:", len(infos) == 1 && infos[0].taskID == created[0])
+}
+
+// name returns the Go string for a NUL terminated C string.
+func name(s *byte) string {
+	var buf []byte
+	for i := uintptr(0); ; i++ {
+		c := *(*byte)(unsafe.Pointer(uintptr(unsafe.Pointer(s)) + i))
+		if c == 0 {
+			break
+		}
+		buf = append(buf, c)
+	}
+	return string(buf)
+}
@@ -0,0 +1,38 @@
+package main
+
+// Test the memory ranges accepted by runtime/watchpoint. The ranges are
+// checked before anything else, so that the same errors are returned on every
+// target, also when watchpoints are not supported.
+
+import (
+	"runtime/watchpoint"
+	"unsafe"
+)
+
+var buf [64]byte
+
+func main() {
+	// Start at an address aligned to 16 bytes.
+	start := (16 - uintptr(unsafe.Pointer(&buf[0]))%16) % 16
+	for _, tc := range []struct {
+		offset uintptr
+		size   uintptr
+	}{
+		{0, 0},  // empty
+		{0, 3},  // not a power of two
+		{0, 12}, // not a power of two
+		{4, 8},  // not aligned to the size
+		{1, 2},  // not aligned to the size
+	} {
+		w, err := watchpoint.Set(unsafe.Pointer(&buf[start+tc.offset]), tc.size, watchpoint.Write)
+		println("offset", tc.offset, "size", tc.size, "invalid range:", err == watchpoint.ErrInvalidRange)
+
+		// Clearing a watchpoint that was not set has no effect.
+		w.Clear()
+	}
+
+	// The zero value can be cleared too.
+	var w watchpoint.Watchpoint
+	w.Clear()
+	println("done")
+}
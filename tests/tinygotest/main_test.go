@@ -23,3 +23,24 @@ func TestPass(t *testing.T) {
 
 func BenchmarkNotImplemented(b *testing.B) {
 }
+
+func TestSubtests(t *testing.T) {
+	t.Cleanup(func() {
+		t.Log("TestSubtests cleanup")
+	})
+	for _, tc := range []struct {
+		name string
+		in   int
+		out  int
+	}{
+		{"double one", 1, 2},
+		{"double two", 2, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Helper()
+			if got := tc.in * 2; got != tc.out {
+				t.Errorf("got %d, want %d", got, tc.out)
+			}
+		})
+	}
+}
@@ -32,12 +32,15 @@ type SVDFile struct {
 }
 
 type SVDPeripheral struct {
-	Name        string `xml:"name"`
-	Description string `xml:"description"`
-	BaseAddress string `xml:"baseAddress"`
-	GroupName   string `xml:"groupName"`
-	DerivedFrom string `xml:"derivedFrom,attr"`
-	Interrupts  []struct {
+	Name         string  `xml:"name"`
+	Description  string  `xml:"description"`
+	BaseAddress  string  `xml:"baseAddress"`
+	GroupName    string  `xml:"groupName"`
+	DerivedFrom  string  `xml:"derivedFrom,attr"`
+	Dim          *int    `xml:"dim"`
+	DimIncrement string  `xml:"dimIncrement"`
+	DimIndex     *string `xml:"dimIndex"`
+	Interrupts   []struct {
 		Name  string `xml:"name"`
 		Index int    `xml:"value"`
 	} `xml:"interrupt"`
@@ -47,6 +50,7 @@ type SVDPeripheral struct {
 
 type SVDRegister struct {
 	Name          string      `xml:"name"`
+	DerivedFrom   string      `xml:"derivedFrom,attr"`
 	Description   string      `xml:"description"`
 	Dim           *string     `xml:"dim"`
 	DimIndex      *string     `xml:"dimIndex"`
@@ -77,14 +81,15 @@ type SVDField struct {
 }
 
 type SVDCluster struct {
-	Dim           *int           `xml:"dim"`
-	DimIncrement  string         `xml:"dimIncrement"`
-	DimIndex      *string        `xml:"dimIndex"`
-	Name          string         `xml:"name"`
-	Description   string         `xml:"description"`
-	Registers     []*SVDRegister `xml:"register"`
-	Clusters      []*SVDCluster  `xml:"cluster"`
-	AddressOffset string         `xml:"addressOffset"`
+	Dim              *int           `xml:"dim"`
+	DimIncrement     string         `xml:"dimIncrement"`
+	DimIndex         *string        `xml:"dimIndex"`
+	Name             string         `xml:"name"`
+	HeaderStructName string         `xml:"headerStructName"`
+	Description      string         `xml:"description"`
+	Registers        []*SVDRegister `xml:"register"`
+	Clusters         []*SVDCluster  `xml:"cluster"`
+	AddressOffset    string         `xml:"addressOffset"`
 }
 
 type Device struct {
@@ -135,6 +140,8 @@ type PeripheralField struct {
 	Array       int
 	ElementSize int
 	Bitfields   []Bitfield
+	Fields      []*RegisterField // fields in this register, for typed accessors
+	TypeName    string           // name of the register type with field accessors
 }
 
 type Bitfield struct {
@@ -143,6 +150,25 @@ type Bitfield struct {
 	Value       uint32
 }
 
+// A RegisterField is a single field within a register, as described in the SVD
+// file. It is used to generate typed accessor methods for the field.
+type RegisterField struct {
+	Name        string
+	Description string
+	Lsb         uint32
+	Msb         uint32
+	EnumType    string // name of the enum type, if this field has enumerated values
+	Enums       []*EnumValue
+}
+
+// An EnumValue is a single enumerated value of a register field.
+type EnumValue struct {
+	Name        string // name of the value within the field, such as Div2
+	Constant    string // name of the untyped bitfield constant for this value
+	Description string
+	Value       uint32
+}
+
 func formatText(text string) string {
 	text = regexp.MustCompile(`[ \t\n]+`).ReplaceAllString(text, " ") // Collapse whitespace (like in HTML)
 	text = strings.ReplaceAll(text, "\\n ", "\n")
@@ -204,7 +230,7 @@ func readSVD(path, sourceURL string) (*Device, error) {
 	// Some SVD files have peripheral elements derived from a peripheral that
 	// comes later in the file. To make sure this works, sort the peripherals if
 	// needed.
-	orderedPeripherals := orderPeripherals(device.Peripherals)
+	orderedPeripherals := orderPeripherals(expandPeripherals(device.Peripherals))
 
 	for _, periphEl := range orderedPeripherals {
 		description := formatText(periphEl.Description)
@@ -233,6 +259,9 @@ func readSVD(path, sourceURL string) (*Device, error) {
 			var derivedFrom *Peripheral
 			if periphEl.DerivedFrom != "" {
 				derivedFrom = peripheralDict[periphEl.DerivedFrom]
+				if derivedFrom == nil {
+					return nil, fmt.Errorf("peripheral %s: unknown derivedFrom peripheral %s", periphEl.Name, periphEl.DerivedFrom)
+				}
 			} else {
 				derivedFrom = groups[groupName]
 			}
@@ -275,6 +304,7 @@ func readSVD(path, sourceURL string) (*Device, error) {
 			groups[groupName] = p
 		}
 
+		resolveDerivedRegisters(periphEl.Registers)
 		for _, register := range periphEl.Registers {
 			regName := groupName // preferably use the group name
 			if regName == "" {
@@ -283,126 +313,53 @@ func readSVD(path, sourceURL string) (*Device, error) {
 			p.Registers = append(p.Registers, parseRegister(regName, register, baseAddress, "")...)
 		}
 		for _, cluster := range periphEl.Clusters {
-			clusterName := strings.ReplaceAll(cluster.Name, "[%s]", "")
-			if cluster.DimIndex != nil {
-				clusterName = strings.ReplaceAll(clusterName, "%s", "")
-			}
-			clusterPrefix := clusterName + "_"
 			clusterOffset, err := strconv.ParseUint(cluster.AddressOffset, 0, 32)
 			if err != nil {
 				panic(err)
 			}
-			var dim, dimIncrement int
-			if cluster.Dim == nil {
-				if clusterOffset == 0 {
-					// make this a separate peripheral
-					cpRegisters := []*PeripheralField{}
-					for _, regEl := range cluster.Registers {
-						cpRegisters = append(cpRegisters, parseRegister(groupName, regEl, baseAddress, clusterName+"_")...)
-					}
-					// handle sub-clusters of registers
-					for _, subClusterEl := range cluster.Clusters {
-						subclusterName := strings.ReplaceAll(subClusterEl.Name, "[%s]", "")
-						subclusterPrefix := subclusterName + "_"
-						subclusterOffset, err := strconv.ParseUint(subClusterEl.AddressOffset, 0, 32)
-						if err != nil {
-							panic(err)
-						}
-						subdim := *subClusterEl.Dim
-						subdimIncrement, err := strconv.ParseInt(subClusterEl.DimIncrement, 0, 32)
-						if err != nil {
-							panic(err)
-						}
-
-						if subdim > 1 {
-							subcpRegisters := []*PeripheralField{}
-							subregSize := 0
-							for _, regEl := range subClusterEl.Registers {
-								size, err := strconv.ParseInt(*regEl.Size, 0, 32)
-								if err != nil {
-									panic(err)
-								}
-								subregSize += int(size)
-								subcpRegisters = append(subcpRegisters, parseRegister(groupName, regEl, baseAddress+subclusterOffset, subclusterPrefix)...)
-							}
-							cpRegisters = append(cpRegisters, &PeripheralField{
-								Name:        subclusterName,
-								Address:     baseAddress + subclusterOffset,
-								Description: subClusterEl.Description,
-								Registers:   subcpRegisters,
-								Array:       subdim,
-								ElementSize: int(subdimIncrement),
-							})
-						} else {
-							for _, regEl := range subClusterEl.Registers {
-								cpRegisters = append(cpRegisters, parseRegister(regEl.Name, regEl, baseAddress+subclusterOffset, subclusterPrefix)...)
-							}
-						}
-					}
-
-					sort.SliceStable(cpRegisters, func(i, j int) bool {
-						return cpRegisters[i].Address < cpRegisters[j].Address
-					})
-					clusterPeripheral := &Peripheral{
-						Name:        periphEl.Name + "_" + clusterName,
-						GroupName:   groupName + "_" + clusterName,
-						Description: description + " - " + clusterName,
-						ClusterName: clusterName,
-						BaseAddress: baseAddress,
-						Registers:   cpRegisters,
-					}
-					peripheralsList = append(peripheralsList, clusterPeripheral)
-					peripheralDict[clusterPeripheral.Name] = clusterPeripheral
-					p.Subtypes = append(p.Subtypes, clusterPeripheral)
-					continue
+			if cluster.Dim == nil && clusterOffset == 0 {
+				// make this a separate peripheral
+				clusterName := strings.ReplaceAll(cluster.Name, "[%s]", "")
+				cpRegisters := []*PeripheralField{}
+				resolveDerivedRegisters(cluster.Registers)
+				for _, regEl := range cluster.Registers {
+					cpRegisters = append(cpRegisters, parseRegister(groupName, regEl, baseAddress, clusterName+"_")...)
 				}
-				dim = -1
-				dimIncrement = -1
-			} else {
-				dim = *cluster.Dim
-				if dim == 1 {
-					dimIncrement = -1
-				} else {
-					inc, err := strconv.ParseUint(cluster.DimIncrement, 0, 32)
+				// handle sub-clusters of registers
+				for _, subClusterEl := range cluster.Clusters {
+					if subClusterEl.Dim != nil && *subClusterEl.Dim > 1 {
+						cpRegisters = append(cpRegisters, parseCluster(groupName, subClusterEl, baseAddress, ""))
+						continue
+					}
+					subclusterName := strings.ReplaceAll(subClusterEl.Name, "[%s]", "")
+					subclusterPrefix := subclusterName + "_"
+					subclusterOffset, err := strconv.ParseUint(subClusterEl.AddressOffset, 0, 32)
 					if err != nil {
 						panic(err)
 					}
-					dimIncrement = int(inc)
-				}
-			}
-			clusterRegisters := []*PeripheralField{}
-			for _, regEl := range cluster.Registers {
-				regName := groupName
-				if regName == "" {
-					regName = periphEl.Name
-				}
-				clusterRegisters = append(clusterRegisters, parseRegister(regName, regEl, baseAddress+clusterOffset, clusterPrefix)...)
-			}
-			sort.SliceStable(clusterRegisters, func(i, j int) bool {
-				return clusterRegisters[i].Address < clusterRegisters[j].Address
-			})
-			if dimIncrement == -1 && len(clusterRegisters) > 0 {
-				lastReg := clusterRegisters[len(clusterRegisters)-1]
-				lastAddress := lastReg.Address
-				if lastReg.Array != -1 {
-					lastAddress = lastReg.Address + uint64(lastReg.Array*lastReg.ElementSize)
+					resolveDerivedRegisters(subClusterEl.Registers)
+					for _, regEl := range subClusterEl.Registers {
+						cpRegisters = append(cpRegisters, parseRegister(regEl.Name, regEl, baseAddress+subclusterOffset, subclusterPrefix)...)
+					}
 				}
-				firstAddress := clusterRegisters[0].Address
-				dimIncrement = int(lastAddress - firstAddress)
-			}
 
-			if !unicode.IsUpper(rune(clusterName[0])) && !unicode.IsDigit(rune(clusterName[0])) {
-				clusterName = strings.ToUpper(clusterName)
+				sort.SliceStable(cpRegisters, func(i, j int) bool {
+					return cpRegisters[i].Address < cpRegisters[j].Address
+				})
+				clusterPeripheral := &Peripheral{
+					Name:        periphEl.Name + "_" + clusterName,
+					GroupName:   groupName + "_" + clusterName,
+					Description: description + " - " + clusterName,
+					ClusterName: clusterName,
+					BaseAddress: baseAddress,
+					Registers:   cpRegisters,
+				}
+				peripheralsList = append(peripheralsList, clusterPeripheral)
+				peripheralDict[clusterPeripheral.Name] = clusterPeripheral
+				p.Subtypes = append(p.Subtypes, clusterPeripheral)
+				continue
 			}
-
-			p.Registers = append(p.Registers, &PeripheralField{
-				Name:        clusterName,
-				Address:     baseAddress + clusterOffset,
-				Description: cluster.Description,
-				Registers:   clusterRegisters,
-				Array:       dim,
-				ElementSize: dimIncrement,
-			})
+			p.Registers = append(p.Registers, parseCluster(groupName, cluster, baseAddress, ""))
 		}
 		sort.SliceStable(p.Registers, func(i, j int) bool {
 			return p.Registers[i].Address < p.Registers[j].Address
@@ -449,6 +406,46 @@ func readSVD(path, sourceURL string) (*Device, error) {
 	}, nil
 }
 
+// expandPeripherals replaces peripheral arrays (peripherals with a dim element,
+// such as UART[%s]) with a separate peripheral for each element. All but the
+// first element are derived from the first, so they share the same type.
+func expandPeripherals(input []SVDPeripheral) []SVDPeripheral {
+	var peripherals []SVDPeripheral
+	for _, p := range input {
+		if p.Dim == nil {
+			peripherals = append(peripherals, p)
+			continue
+		}
+		dimIncrement, err := strconv.ParseUint(p.DimIncrement, 0, 32)
+		if err != nil {
+			panic(err)
+		}
+		baseAddress, err := strconv.ParseUint(p.BaseAddress, 0, 32)
+		if err != nil {
+			panic(err)
+		}
+		if p.GroupName == "" {
+			p.GroupName = strings.ReplaceAll(strings.ReplaceAll(p.Name, "[%s]", ""), "%s", "")
+		}
+		var firstName string
+		for i, index := range dimIndex(*p.Dim, p.DimIndex) {
+			element := p
+			element.Name = strings.ReplaceAll(strings.ReplaceAll(p.Name, "[%s]", "%s"), "%s", index)
+			element.BaseAddress = fmt.Sprintf("0x%x", baseAddress+uint64(i)*dimIncrement)
+			element.Dim = nil
+			if i == 0 {
+				firstName = element.Name
+			} else if element.DerivedFrom == "" {
+				element.DerivedFrom = firstName
+				element.Registers = nil
+				element.Clusters = nil
+			}
+			peripherals = append(peripherals, element)
+		}
+	}
+	return peripherals
+}
+
 // orderPeripherals sorts the peripherals so that derived peripherals come after
 // base peripherals. This is necessary for some SVD files.
 func orderPeripherals(input []SVDPeripheral) []*SVDPeripheral {
@@ -506,8 +503,9 @@ func addInterrupt(interrupts map[string]*Interrupt, name, interruptName string,
 	}
 }
 
-func parseBitfields(groupName, regName string, fieldEls []*SVDField, bitfieldPrefix string) []Bitfield {
+func parseBitfields(groupName, regName string, fieldEls []*SVDField, bitfieldPrefix string) ([]Bitfield, []*RegisterField) {
 	var fields []Bitfield
+	var registerFields []*RegisterField
 	enumSeen := map[string]int64{}
 	for _, fieldEl := range fieldEls {
 		// Some bitfields (like the STM32H7x7) contain invalid bitfield
@@ -592,6 +590,13 @@ func parseBitfields(groupName, regName string, fieldEls []*SVDField, bitfieldPre
 				Value:       1 << lsb,
 			})
 		}
+		registerField := &RegisterField{
+			Name:        fieldName,
+			Description: formatText(fieldEl.Description),
+			Lsb:         lsb,
+			Msb:         msb,
+		}
+		registerFields = append(registerFields, registerField)
 		for _, enumEl := range enumeratedValues.EnumeratedValue {
 			enumName := enumEl.Name
 			if strings.EqualFold(enumName, "reserved") || !validName.MatchString(enumName) {
@@ -600,6 +605,7 @@ func parseBitfields(groupName, regName string, fieldEls []*SVDField, bitfieldPre
 			if !unicode.IsUpper(rune(enumName[0])) && !unicode.IsDigit(rune(enumName[0])) {
 				enumName = strings.ToUpper(enumName)
 			}
+			enumShortName := enumName
 			enumDescription := formatText(enumEl.Description)
 			var enumValue uint64
 			var err error
@@ -655,9 +661,135 @@ func parseBitfields(groupName, regName string, fieldEls []*SVDField, bitfieldPre
 				Description: enumDescription,
 				Value:       uint32(enumValue),
 			})
+			registerField.Enums = append(registerField.Enums, &EnumValue{
+				Name:        enumShortName,
+				Constant:    enumName,
+				Description: enumDescription,
+				Value:       uint32(enumValue),
+			})
+		}
+	}
+
+	// Only keep the enumerated values that were not removed as duplicates
+	// above, and give the fields that still have some an enum type.
+	for _, registerField := range registerFields {
+		var enums []*EnumValue
+		for _, enum := range registerField.Enums {
+			if enumSeen[enum.Constant] >= 0 {
+				enums = append(enums, enum)
+			}
+		}
+		registerField.Enums = enums
+		if len(enums) != 0 {
+			registerField.EnumType = fmt.Sprintf("%s_%s%s_%s_Value", groupName, bitfieldPrefix, regName, registerField.Name)
+		}
+	}
+	return fields, registerFields
+}
+
+// size returns the number of bytes this field spans in the peripheral.
+func (f *PeripheralField) size() uint64 {
+	if f.Array != -1 {
+		return uint64(f.Array * f.ElementSize)
+	}
+	return uint64(f.ElementSize)
+}
+
+// resolveDerivedRegisters fills in the missing properties of registers that
+// are derived from another register in the same list, using the derivedFrom
+// attribute.
+func resolveDerivedRegisters(regEls []*SVDRegister) {
+	for _, regEl := range regEls {
+		if regEl.DerivedFrom == "" {
+			continue
+		}
+		var base *SVDRegister
+		for _, otherEl := range regEls {
+			if otherEl.Name == regEl.DerivedFrom {
+				base = otherEl
+				break
+			}
+		}
+		if base == nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not find register.derivedFrom of %s for register %s\n", regEl.DerivedFrom, regEl.Name)
+			continue
+		}
+		if regEl.Description == "" {
+			regEl.Description = base.Description
+		}
+		if regEl.Size == nil {
+			regEl.Size = base.Size
+		}
+		if len(regEl.Fields) == 0 {
+			regEl.Fields = base.Fields
+		}
+	}
+}
+
+// parseCluster parses a cluster of registers, which may itself contain
+// clusters. A cluster with dim elements results in a Go array of structs, even
+// when its name is of the "CH%s" form.
+func parseCluster(groupName string, clusterEl *SVDCluster, baseAddress uint64, bitfieldPrefix string) *PeripheralField {
+	clusterOffset, err := strconv.ParseUint(clusterEl.AddressOffset, 0, 32)
+	if err != nil {
+		panic(err)
+	}
+	clusterName := strings.ReplaceAll(strings.ReplaceAll(clusterEl.Name, "[%s]", ""), "%s", "")
+	if clusterName == "" {
+		// The name is only a placeholder (such as "%s"), which is replaced by
+		// the index. Use the name of the struct type instead, or make up a
+		// name from the offset.
+		clusterName = clusterEl.HeaderStructName
+		if clusterName == "" {
+			clusterName = fmt.Sprintf("CLUSTER%X", clusterOffset)
+		}
+	}
+	clusterPrefix := bitfieldPrefix + clusterName + "_"
+	address := baseAddress + clusterOffset
+
+	registers := []*PeripheralField{}
+	resolveDerivedRegisters(clusterEl.Registers)
+	for _, regEl := range clusterEl.Registers {
+		registers = append(registers, parseRegister(groupName, regEl, address, clusterPrefix)...)
+	}
+	for _, subClusterEl := range clusterEl.Clusters {
+		registers = append(registers, parseCluster(groupName, subClusterEl, address, clusterPrefix))
+	}
+	sort.SliceStable(registers, func(i, j int) bool {
+		return registers[i].Address < registers[j].Address
+	})
+
+	dim := -1
+	dimIncrement := -1
+	if clusterEl.Dim != nil {
+		dim = *clusterEl.Dim
+		if dim != 1 {
+			inc, err := strconv.ParseUint(clusterEl.DimIncrement, 0, 32)
+			if err != nil {
+				panic(err)
+			}
+			dimIncrement = int(inc)
 		}
 	}
-	return fields
+	if dimIncrement == -1 && len(registers) > 0 {
+		// Not an array (or an array of one element): the element size is the
+		// size of all registers in the cluster.
+		lastReg := registers[len(registers)-1]
+		dimIncrement = int(lastReg.Address + lastReg.size() - address)
+	}
+
+	if !unicode.IsUpper(rune(clusterName[0])) && !unicode.IsDigit(rune(clusterName[0])) {
+		clusterName = strings.ToUpper(clusterName)
+	}
+
+	return &PeripheralField{
+		Name:        clusterName,
+		Address:     address,
+		Description: clusterEl.Description,
+		Registers:   registers,
+		Array:       dim,
+		ElementSize: dimIncrement,
+	}
 }
 
 type Register struct {
@@ -711,8 +843,13 @@ func (r *Register) dimIndex() []string {
 		}
 	}()
 
-	dim := r.dim()
-	if r.element.DimIndex == nil {
+	return dimIndex(r.dim(), r.element.DimIndex)
+}
+
+// dimIndex returns the names of the elements of a dim array, from the dimIndex
+// element if there is one.
+func dimIndex(dim int, index *string) []string {
+	if index == nil {
 		if dim <= 0 {
 			return nil
 		}
@@ -724,7 +861,7 @@ func (r *Register) dimIndex() []string {
 		return idx
 	}
 
-	t := strings.Split(*r.element.DimIndex, "-")
+	t := strings.Split(*index, "-")
 	if len(t) == 2 {
 		x, err := strconv.ParseInt(t[0], 0, 32)
 		if err != nil {
@@ -748,7 +885,7 @@ func (r *Register) dimIndex() []string {
 		panic("invalid dimIndex")
 	}
 
-	s := strings.Split(*r.element.DimIndex, ",")
+	s := strings.Split(*index, ",")
 	if len(s) != dim {
 		panic("invalid dimIndex")
 	}
@@ -791,7 +928,13 @@ func parseRegister(groupName string, regEl *SVDRegister, baseAddress uint64, bit
 			}
 			// set first result bitfield
 			shortName := strings.ToUpper(strings.ReplaceAll(strings.ReplaceAll(reg.name(), "_%s", ""), "%s", ""))
-			results[0].Bitfields = parseBitfields(groupName, shortName, regEl.Fields, bitfieldPrefix)
+			bitfields, fields := parseBitfields(groupName, shortName, regEl.Fields, bitfieldPrefix)
+			results[0].Bitfields = bitfields
+			// all elements share the same fields
+			for _, result := range results {
+				result.Fields = fields
+				result.TypeName = fmt.Sprintf("%s_%s%s", groupName, bitfieldPrefix, shortName)
+			}
 			return results
 		}
 	}
@@ -801,12 +944,14 @@ func parseRegister(groupName string, regEl *SVDRegister, baseAddress uint64, bit
 	}
 	regName = cleanName(regName)
 
-	bitfields := parseBitfields(groupName, regName, regEl.Fields, bitfieldPrefix)
+	bitfields, fields := parseBitfields(groupName, regName, regEl.Fields, bitfieldPrefix)
 	return []*PeripheralField{&PeripheralField{
 		Name:        regName,
 		Address:     reg.address(),
 		Description: reg.description(),
 		Bitfields:   bitfields,
+		Fields:      fields,
+		TypeName:    fmt.Sprintf("%s_%s%s", groupName, bitfieldPrefix, regName),
 		Array:       reg.dim(),
 		ElementSize: reg.size(),
 	}}
@@ -908,6 +1053,7 @@ var (
 	}
 
 	// Define peripheral struct types.
+	emitted := map[*PeripheralField]bool{}
 	for _, peripheral := range device.Peripherals {
 		if peripheral.Registers == nil {
 			// This peripheral was derived from another peripheral. No new type
@@ -959,65 +1105,19 @@ var (
 			lastCluster := false
 			if register.Registers != nil {
 				// This is a cluster, not a register. Create the cluster type.
-				regType = "struct {\n"
-				subaddress := register.Address
-				for _, subregister := range register.Registers {
-					var subregType string
-					switch subregister.ElementSize {
-					case 8:
-						subregType = "volatile.Register64"
-					case 4:
-						subregType = "volatile.Register32"
-					case 2:
-						subregType = "volatile.Register16"
-					case 1:
-						subregType = "volatile.Register8"
-					}
-					if subregType == "" {
-						panic("unknown element size")
-					}
-
-					if subregister.Array != -1 {
-						subregType = fmt.Sprintf("[%d]%s", subregister.Array, subregType)
-					}
-					if subaddress != subregister.Address {
-						bytesNeeded := subregister.Address - subaddress
-						if bytesNeeded == 1 {
-							regType += "\t\t_ byte\n"
-						} else {
-							regType += fmt.Sprintf("\t\t_ [%d]byte\n", bytesNeeded)
-						}
-						subaddress += bytesNeeded
-					}
-					var subregSize uint64
-					if subregister.Array != -1 {
-						subregSize = uint64(subregister.Array * subregister.ElementSize)
-					} else {
-						subregSize = uint64(subregister.ElementSize)
-					}
-					subaddress += subregSize
-					regType += fmt.Sprintf("\t\t%s %s\n", subregister.Name, subregType)
-				}
-				if register.Array != -1 {
-					if subaddress != register.Address+uint64(register.ElementSize) {
-						bytesNeeded := (register.Address + uint64(register.ElementSize)) - subaddress
-						if bytesNeeded == 1 {
-							regType += "\t_ byte\n"
-						} else {
-							regType += fmt.Sprintf("\t_ [%d]byte\n", bytesNeeded)
-						}
-					}
-				} else {
+				var size uint64
+				regType, size = goClusterType(register, 1)
+				if register.Array == -1 {
 					lastCluster = true
 				}
-				regType += "\t}"
-				address = subaddress
+				address = register.Address + size
 			}
 
 			if register.Array != -1 {
 				regType = fmt.Sprintf("[%d]%s", register.Array, regType)
 			}
 			fmt.Fprintf(w, "\t%s %s // 0x%X\n", register.Name, regType, register.Address-peripheral.BaseAddress)
+			emitted[register] = true
 
 			// next address
 			if lastCluster {
@@ -1055,16 +1155,233 @@ var (
 			if register.Registers == nil {
 				continue
 			}
-			for _, subregister := range register.Registers {
-				writeGoRegisterBitfields(w, subregister, register.Name+"."+subregister.Name)
-			}
+			writeGoClusterBitfields(w, register, register.Name)
 		}
 		w.WriteString(")\n")
 	}
 
+	// Define register types with typed accessors for their fields. Names that
+	// are already in use by a constant or peripheral can't be used for these
+	// types and functions.
+	usedNames := map[string]bool{}
+	for _, peripheral := range device.Peripherals {
+		usedNames[peripheral.Name] = true
+		usedNames[peripheral.GroupName+"_Type"] = true
+		addBitfieldNames(usedNames, peripheral.Registers)
+	}
+	for _, peripheral := range device.Peripherals {
+		if peripheral.Registers == nil {
+			// This peripheral was derived from another peripheral. Accessors
+			// are already defined.
+			continue
+		}
+		writeGoRegisterAccessors(w, peripheral, peripheral.Registers, emitted, usedNames)
+	}
+
 	return w.Flush()
 }
 
+// writeGoRegisterAccessors writes a register type with a getter and setter for
+// each field, for every register in the given peripheral (including registers
+// in clusters) that has fields. Fields with enumerated values get an enum type
+// with typed constants for the values. For example, for the CKD field in the
+// CR1 register of TIM peripherals:
+//
+//     type TIM_CR1_Register struct{ volatile.Register32 }
+//     func TIM_CR1(reg *volatile.Register32) *TIM_CR1_Register
+//     func (r *TIM_CR1_Register) SetCKD(value TIM_CR1_CKD_Value)
+//     func (r *TIM_CR1_Register) GetCKD() TIM_CR1_CKD_Value
+//
+// The registers in the peripheral structs keep their volatile.Register32 (etc.)
+// type, so the register type is obtained with a conversion function:
+//
+//     stm32.TIM_CR1(&stm32.TIM3.CR1).SetCKD(stm32.TIM_CR1_CKD_Value_Div2)
+func writeGoRegisterAccessors(w *bufio.Writer, peripheral *Peripheral, registers []*PeripheralField, emitted map[*PeripheralField]bool, usedNames map[string]bool) {
+	for _, register := range registers {
+		if emitted != nil && !emitted[register] {
+			// Not part of the peripheral struct.
+			continue
+		}
+		if register.Registers != nil {
+			// All registers in a cluster are part of the cluster struct.
+			writeGoRegisterAccessors(w, peripheral, register.Registers, nil, usedNames)
+			continue
+		}
+		if len(register.Fields) == 0 || usedNames[register.TypeName] || usedNames[register.TypeName+"_Register"] {
+			continue
+		}
+		usedNames[register.TypeName] = true
+		usedNames[register.TypeName+"_Register"] = true
+
+		var uintType, volatileType string
+		switch register.ElementSize {
+		case 8:
+			uintType, volatileType = "uint64", "Register64"
+		case 2:
+			uintType, volatileType = "uint16", "Register16"
+		case 1:
+			uintType, volatileType = "uint8", "Register8"
+		default:
+			uintType, volatileType = "uint32", "Register32"
+		}
+
+		// The name of the register, including the cluster. Registers in a
+		// spaced array (such as CCR1, CCR2) share a type, so the name is taken
+		// from the type.
+		regName := strings.TrimPrefix(register.TypeName, peripheral.GroupName+"_")
+		typeName := register.TypeName + "_Register"
+		fmt.Fprintf(w, "\n// %s is the %s register of %s, with accessors for its fields.\n", typeName, regName, peripheral.GroupName)
+		fmt.Fprintf(w, "type %s struct {\n\tvolatile.%s\n}\n", typeName, volatileType)
+		fmt.Fprintf(w, "\n// %s returns the %s register at the given address, with accessors for its\n// fields.\n", register.TypeName, regName)
+		fmt.Fprintf(w, "func %s(reg *volatile.%s) *%s {\n", register.TypeName, volatileType, typeName)
+		fmt.Fprintf(w, "\treturn (*%s)(unsafe.Pointer(reg))\n", typeName)
+		fmt.Fprintf(w, "}\n")
+
+		// Methods of the embedded register can't be used as accessor names.
+		methods := map[string]bool{
+			"Get":         true,
+			"Set":         true,
+			"SetBits":     true,
+			"ClearBits":   true,
+			"HasBits":     true,
+			"ReplaceBits": true,
+		}
+		for _, field := range register.Fields {
+			if field.Msb < field.Lsb || field.Msb >= uint32(register.ElementSize)*8 {
+				// Doesn't fit in the register, probably a bug in the SVD file.
+				continue
+			}
+			setter := "Set" + field.Name
+			getter := "Get" + field.Name
+			if methods[setter] || methods[getter] {
+				continue
+			}
+			methods[setter] = true
+			methods[getter] = true
+
+			valueType := uintType
+			if field.EnumType != "" && !usedNames[field.EnumType] {
+				usedNames[field.EnumType] = true
+				valueType = field.EnumType
+				fmt.Fprintf(w, "\n// %s is the type of the %s field in %s.%s.\n", field.EnumType, field.Name, peripheral.GroupName, regName)
+				fmt.Fprintf(w, "type %s %s\n", field.EnumType, uintType)
+				fmt.Fprintf(w, "\n// Values of the %s field in %s.%s.\n", field.Name, peripheral.GroupName, regName)
+				fmt.Fprintf(w, "const (\n")
+				for _, enum := range field.Enums {
+					name := field.EnumType + "_" + enum.Name
+					if usedNames[name] {
+						continue
+					}
+					usedNames[name] = true
+					if enum.Description != "" {
+						for _, l := range splitLine(enum.Description) {
+							fmt.Fprintf(w, "\t// %s\n", l)
+						}
+					}
+					fmt.Fprintf(w, "\t%s %s = 0x%x\n", name, field.EnumType, enum.Value)
+				}
+				fmt.Fprintf(w, ")\n")
+			}
+
+			mask := uint64(1)<<(field.Msb-field.Lsb+1) - 1
+			fmt.Fprintf(w, "\n// %s sets the %s field.\n", setter, field.Name)
+			if field.Description != "" {
+				fmt.Fprintf(w, "//\n")
+				for _, l := range splitLine(field.Description) {
+					fmt.Fprintf(w, "// %s\n", l)
+				}
+			}
+			fmt.Fprintf(w, "func (r *%s) %s(value %s) {\n", typeName, setter, valueType)
+			fmt.Fprintf(w, "\tr.ReplaceBits(%s(value), 0x%x, %d)\n", uintType, mask, field.Lsb)
+			fmt.Fprintf(w, "}\n")
+
+			fmt.Fprintf(w, "\n// %s returns the %s field.\n", getter, field.Name)
+			fmt.Fprintf(w, "func (r *%s) %s() %s {\n", typeName, getter, valueType)
+			fmt.Fprintf(w, "\treturn %s((r.Get() >> %d) & 0x%x)\n", valueType, field.Lsb, mask)
+			fmt.Fprintf(w, "}\n")
+		}
+	}
+}
+
+// addBitfieldNames adds the names of the bitfield constants of the given
+// registers, including registers in clusters, to names.
+func addBitfieldNames(names map[string]bool, registers []*PeripheralField) {
+	for _, register := range registers {
+		for _, bitfield := range register.Bitfields {
+			names[bitfield.Name] = true
+		}
+		addBitfieldNames(names, register.Registers)
+	}
+}
+
+// goClusterType returns the struct type for a cluster of registers, which may
+// contain nested clusters, and the size in bytes of a single element of it.
+func goClusterType(cluster *PeripheralField, depth int) (string, uint64) {
+	indent := strings.Repeat("\t", depth)
+	regType := "struct {\n"
+	subaddress := cluster.Address
+	for _, subregister := range cluster.Registers {
+		var subregType string
+		if subregister.Registers != nil {
+			subregType, _ = goClusterType(subregister, depth+1)
+		} else {
+			switch subregister.ElementSize {
+			case 8:
+				subregType = "volatile.Register64"
+			case 4:
+				subregType = "volatile.Register32"
+			case 2:
+				subregType = "volatile.Register16"
+			case 1:
+				subregType = "volatile.Register8"
+			}
+		}
+		if subregType == "" {
+			panic("unknown element size")
+		}
+
+		if subregister.Array != -1 {
+			subregType = fmt.Sprintf("[%d]%s", subregister.Array, subregType)
+		}
+		if subaddress != subregister.Address {
+			bytesNeeded := subregister.Address - subaddress
+			if bytesNeeded == 1 {
+				regType += indent + "\t_ byte\n"
+			} else {
+				regType += fmt.Sprintf("%s\t_ [%d]byte\n", indent, bytesNeeded)
+			}
+			subaddress += bytesNeeded
+		}
+		subaddress += subregister.size()
+		regType += fmt.Sprintf("%s\t%s %s\n", indent, subregister.Name, subregType)
+	}
+	size := subaddress - cluster.Address
+	if cluster.Array != -1 {
+		if size < uint64(cluster.ElementSize) {
+			bytesNeeded := uint64(cluster.ElementSize) - size
+			if bytesNeeded == 1 {
+				regType += indent + "_ byte\n"
+			} else {
+				regType += fmt.Sprintf("%s_ [%d]byte\n", indent, bytesNeeded)
+			}
+		}
+		size = uint64(cluster.ElementSize)
+	}
+	regType += indent + "}"
+	return regType, size
+}
+
+// writeGoClusterBitfields writes the bitfields of all registers in a cluster,
+// including the registers in nested clusters.
+func writeGoClusterBitfields(w *bufio.Writer, cluster *PeripheralField, name string) {
+	for _, subregister := range cluster.Registers {
+		writeGoRegisterBitfields(w, subregister, name+"."+subregister.Name)
+		if subregister.Registers != nil {
+			writeGoClusterBitfields(w, subregister, name+"."+subregister.Name)
+		}
+	}
+}
+
 func writeGoRegisterBitfields(w *bufio.Writer, register *PeripheralField, name string) {
 	w.WriteString("\n\t// " + name)
 	if register.Description != "" {
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Pass -update to go test to update the output of the test files.
+var flagUpdate = flag.Bool("update", false, "update tests based on test output")
+
+// TestGenerate generates the Go file for testdata/test.svd and compares it to
+// testdata/test.go. The generated file is also type checked, to make sure it
+// compiles.
+func TestGenerate(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "gen-device-svd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	outdir := filepath.Join(tmpdir, "device")
+	err = generate("testdata", outdir, "https://example.com/test.svd", "software")
+	if err != nil {
+		t.Fatal("could not generate:", err)
+	}
+	output, err := ioutil.ReadFile(filepath.Join(outdir, "test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedPath := filepath.Join("testdata", "test.go")
+	if *flagUpdate {
+		err := ioutil.WriteFile(expectedPath, output, 0666)
+		if err != nil {
+			t.Fatal("could not write updated output:", err)
+		}
+	}
+	expected, err := ioutil.ReadFile(expectedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != strings.ReplaceAll(string(expected), "\r\n", "\n") {
+		t.Errorf("output does not match %s, run go test -update to update it", expectedPath)
+	}
+
+	// Type check the generated file against the runtime/volatile package.
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "test.go", output, 0)
+	if err != nil {
+		t.Fatal("could not parse generated file:", err)
+	}
+	config := types.Config{Importer: volatileImporter{fset: fset}}
+	_, err = config.Check("device", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Error("generated file does not type check:", err)
+	}
+}
+
+// volatileImporter imports runtime/volatile from the TinyGo source tree and
+// all other packages from the standard library.
+type volatileImporter struct {
+	fset *token.FileSet
+}
+
+func (i volatileImporter) Import(path string) (*types.Package, error) {
+	if path != "runtime/volatile" {
+		return importer.Default().Import(path)
+	}
+	var files []*ast.File
+	for _, name := range []string{"register.go", "volatile.go"} {
+		file, err := parser.ParseFile(i.fset, filepath.Join("..", "..", "src", "runtime", "volatile", name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	config := types.Config{}
+	return config.Check(path, i.fset, files, nil)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Prefix of lines with trace data, as written by the runtime/trace package.
+const traceLinePrefix = "tinygo-trace: "
+
+// chromeTraceEvent is a single event in the Chrome trace event format, which
+// is understood by chrome://tracing and Perfetto.
+type chromeTraceEvent struct {
+	Name string            `json:"name"`
+	Cat  string            `json:"cat,omitempty"`
+	Ph   string            `json:"ph"`
+	Ts   float64           `json:"ts"` // in microseconds
+	Dur  float64           `json:"dur,omitempty"`
+	Pid  int               `json:"pid"`
+	Tid  int               `json:"tid"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// Descriptions of the state a goroutine is in after a trace event.
+var traceBlockReasons = map[string]string{
+	"block-send":   "blocked: chan send",
+	"block-recv":   "blocked: chan receive",
+	"block-select": "blocked: select",
+	"block-cond":   "blocked: sync",
+	"sleep":        "sleeping",
+	"sched":        "runnable",
+}
+
+// convertTrace reads the output of runtime/trace from r (which may be mixed
+// with other program output) and writes it to w in the Chrome trace event
+// format. Every goroutine is shown as a separate thread, with slices for the
+// time it was running, blocked or waiting to be run. Garbage collection cycles
+// are shown as a separate thread.
+func convertTrace(r io.Reader, w io.Writer) error {
+	type goroutine struct {
+		tid   int
+		state string // running, blocked, runnable, or "" when unknown
+		since float64
+	}
+	var events []chromeTraceEvent
+	goroutines := make(map[string]*goroutine)
+	var goroutineList []*goroutine // in order of appearance
+	var gcStart, start, last float64
+	gcRunning, started := false, false
+
+	// endState ends the slice of the current state of this goroutine, if any.
+	endState := func(g *goroutine, ts float64) {
+		if g.state != "" {
+			events = append(events, chromeTraceEvent{Name: g.state, Cat: "goroutine", Ph: "X", Ts: g.since, Dur: ts - g.since, Pid: 1, Tid: g.tid})
+		}
+		g.state = ""
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		index := strings.Index(line, traceLinePrefix)
+		if index < 0 {
+			continue
+		}
+		fields := strings.Fields(line[index+len(traceLinePrefix):])
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "begin":
+			if len(fields) > 1 && fields[1] != "0" {
+				events = append(events, chromeTraceEvent{Name: "trace buffer overflow", Ph: "i", Pid: 1, Args: map[string]string{"dropped events": fields[1]}})
+			}
+			continue
+		case "end":
+			continue
+		}
+		if len(fields) != 3 {
+			return fmt.Errorf("invalid trace line: %#v", line)
+		}
+		nanoseconds, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid trace line: %#v", line)
+		}
+		if !started {
+			start = float64(nanoseconds) / 1000
+			started = true
+		}
+		ts := float64(nanoseconds)/1000 - start
+		last = ts
+		kind, task := fields[1], fields[2]
+
+		switch kind {
+		case "gc-start":
+			gcStart, gcRunning = ts, true
+			continue
+		case "gc-done":
+			if gcRunning {
+				events = append(events, chromeTraceEvent{Name: "GC", Cat: "gc", Ph: "X", Ts: gcStart, Dur: ts - gcStart, Pid: 1, Tid: 0})
+			}
+			gcRunning = false
+			continue
+		}
+
+		g := goroutines[task]
+		if g == nil {
+			g = &goroutine{tid: len(goroutines) + 1}
+			goroutines[task] = g
+			goroutineList = append(goroutineList, g)
+			events = append(events, chromeTraceEvent{Name: "thread_name", Ph: "M", Pid: 1, Tid: g.tid, Args: map[string]string{"name": "goroutine " + strconv.Itoa(g.tid) + " (0x" + task + ")"}})
+		}
+		switch kind {
+		case "start":
+			endState(g, ts)
+			g.state, g.since = "running", ts
+		case "stop":
+			if g.state == "running" {
+				// Paused without a known reason, for example because the
+				// goroutine exited.
+				endState(g, ts)
+			}
+		case "unblock":
+			endState(g, ts)
+			g.state, g.since = "runnable", ts
+		default:
+			reason, ok := traceBlockReasons[kind]
+			if !ok {
+				return fmt.Errorf("unknown trace event: %#v", kind)
+			}
+			endState(g, ts)
+			g.state, g.since = reason, ts
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// Close all slices that were still open at the end of the trace.
+	for _, g := range goroutineList {
+		endState(g, last)
+	}
+	if gcRunning {
+		events = append(events, chromeTraceEvent{Name: "GC", Cat: "gc", Ph: "X", Ts: gcStart, Dur: last - gcStart, Pid: 1, Tid: 0})
+	}
+	events = append(events, chromeTraceEvent{Name: "thread_name", Ph: "M", Pid: 1, Tid: 0, Args: map[string]string{"name": "GC"}})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+		DisplayTimeUnit string             `json:"displayTimeUnit"`
+	}{events, "ns"})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestConvertTrace(t *testing.T) {
+	// Trace output mixed with regular program output, as it would be read from
+	// a serial port.
+	input := strings.Join([]string{
+		"hello world",
+		"tinygo-trace: begin 0",
+		"tinygo-trace: 1000 start 2000",
+		"tinygo-trace: 3000 block-recv 2000",
+		"tinygo-trace: 3500 stop 2000",
+		"tinygo-trace: 4000 start 3000",
+		"tinygo-trace: 5000 gc-start 0",
+		"tinygo-trace: 6000 gc-done 0\r",
+		"tinygo-trace: 7000 unblock 2000",
+		"tinygo-trace: 8000 sleep 3000",
+		"tinygo-trace: 8500 stop 3000",
+		"tinygo-trace: 9000 start 2000",
+		"tinygo-trace: end",
+		"bye",
+	}, "\n")
+	buf := &bytes.Buffer{}
+	err := convertTrace(strings.NewReader(input), buf)
+	if err != nil {
+		t.Fatal("could not convert trace:", err)
+	}
+
+	var output struct {
+		TraceEvents []chromeTraceEvent `json:"traceEvents"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &output)
+	if err != nil {
+		t.Fatal("could not parse output:", err)
+	}
+	var slices []string
+	for _, ev := range output.TraceEvents {
+		if ev.Ph == "X" {
+			slices = append(slices, ev.Name)
+			if ev.Name == "blocked: chan receive" && (ev.Ts != 2 || ev.Dur != 4) {
+				t.Errorf("unexpected time for blocked slice: ts=%v dur=%v", ev.Ts, ev.Dur)
+			}
+		}
+	}
+	expected := []string{"running", "GC", "blocked: chan receive", "running", "runnable", "running", "sleeping"}
+	if strings.Join(slices, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected slices:\nexpected: %v\nactual:   %v", expected, slices)
+	}
+}
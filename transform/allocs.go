@@ -3,11 +3,17 @@ package transform
 // This file implements an escape analysis pass. It looks for calls to
 // runtime.alloc and replaces these calls with a stack allocation if the
 // allocated value does not escape. It uses the LLVM nocapture flag for
-// interprocedural escape analysis.
+// interprocedural escape analysis. When a parameter doesn't have this flag, the
+// called function is analyzed as well, which is possible because the whole
+// program is available. This also finds values that are returned by the called
+// function (like a slice passed to append-like functions), which LLVM
+// considers captured.
 
 import (
+	"encoding/json"
 	"fmt"
 	"go/token"
+	"io"
 	"regexp"
 
 	"tinygo.org/x/go-llvm"
@@ -20,14 +26,87 @@ import (
 // TODO: tune this, this is just a random value.
 const maxStackAlloc = 256
 
+// AllocInfo explains why an object had to be allocated on the heap. It is
+// passed to the logger of OptimizeAllocs.
+type AllocInfo struct {
+	Pos       token.Position   // position of the allocation
+	Function  string           // function that contains the allocation
+	InlinedAt []token.Position // call sites the allocation was inlined through, innermost first
+	Reason    string           // why the object is allocated on the heap
+	Escape    []AllocUse       // chain of uses through which the object escapes
+}
+
+// AllocUse is a single use of an object in the chain of uses through which it
+// escapes. The last use in the chain is where the object escapes.
+type AllocUse struct {
+	Pos         token.Position
+	Description string
+}
+
+// Message returns the one-line message for this allocation, without position.
+func (info AllocInfo) Message() string {
+	return "object allocated on the heap: " + info.Reason
+}
+
+// WriteText writes the allocation in the format used by -print-allocs: the
+// message on one line, followed by an indented line for each call site the
+// allocation was inlined through and for each use through which it escapes.
+func (info AllocInfo) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%s: %s\n", info.Pos, info.Message())
+	for _, pos := range info.InlinedAt {
+		fmt.Fprintf(w, "\t%s: inlined here\n", pos)
+	}
+	for _, use := range info.Escape {
+		fmt.Fprintf(w, "\t%s: %s\n", use.Pos, use.Description)
+	}
+}
+
+// allocJSON is the JSON form of AllocInfo, with positions in the same form as
+// the JSON diagnostics of the compiler.
+type allocJSON struct {
+	File      string         `json:"file,omitempty"`
+	Line      int            `json:"line,omitempty"`
+	Column    int            `json:"column,omitempty"`
+	Function  string         `json:"function"`
+	Message   string         `json:"message"`
+	InlinedAt []allocJSONUse `json:"inlined-at,omitempty"`
+	Escape    []allocJSONUse `json:"escape,omitempty"`
+}
+
+type allocJSONUse struct {
+	File        string `json:"file,omitempty"`
+	Line        int    `json:"line,omitempty"`
+	Column      int    `json:"column,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// WriteJSON writes the allocation to w as a single line of JSON, so that
+// editors can show heap allocations in the source code.
+func (info AllocInfo) WriteJSON(w io.Writer) error {
+	out := allocJSON{
+		File:     info.Pos.Filename,
+		Line:     info.Pos.Line,
+		Column:   info.Pos.Column,
+		Function: info.Function,
+		Message:  info.Message(),
+	}
+	for _, pos := range info.InlinedAt {
+		out.InlinedAt = append(out.InlinedAt, allocJSONUse{File: pos.Filename, Line: pos.Line, Column: pos.Column})
+	}
+	for _, use := range info.Escape {
+		out.Escape = append(out.Escape, allocJSONUse{File: use.Pos.Filename, Line: use.Pos.Line, Column: use.Pos.Column, Description: use.Description})
+	}
+	return json.NewEncoder(w).Encode(out)
+}
+
 // OptimizeAllocs tries to replace heap allocations with stack allocations
-// whenever possible. It relies on the LLVM 'nocapture' flag for interprocedural
-// escape analysis, and within a function looks whether an allocation can escape
-// to the heap.
+// whenever possible. It relies on the LLVM 'nocapture' flag and on an analysis
+// of called functions for interprocedural escape analysis, and within a
+// function looks whether an allocation can escape to the heap.
 // If printAllocs is non-nil, it indicates the regexp of functions for which a
 // heap allocation explanation should be printed (why the object can't be stack
 // allocated).
-func OptimizeAllocs(mod llvm.Module, printAllocs *regexp.Regexp, logger func(token.Position, string)) {
+func OptimizeAllocs(mod llvm.Module, printAllocs *regexp.Regexp, logger func(AllocInfo)) {
 	allocator := mod.NamedFunction("runtime.alloc")
 	if allocator.IsNil() {
 		// nothing to optimize
@@ -37,6 +116,9 @@ func OptimizeAllocs(mod llvm.Module, printAllocs *regexp.Regexp, logger func(tok
 	targetData := llvm.NewTargetData(mod.DataLayout())
 	i8ptrType := llvm.PointerType(mod.Context().Int8Type(), 0)
 	builder := mod.Context().NewBuilder()
+	analysis := &escapeAnalysis{
+		params: make(map[llvm.Value]*paramEscapeInfo),
+	}
 
 	for _, heapalloc := range getUses(allocator) {
 		logAllocs := printAllocs != nil && printAllocs.MatchString(heapalloc.InstructionParent().Parent().Name())
@@ -82,14 +164,14 @@ func OptimizeAllocs(mod llvm.Module, printAllocs *regexp.Regexp, logger func(tok
 			bitcast = uses[0]
 		}
 
-		if at := valueEscapesAt(bitcast); !at.IsNil() {
+		if path := analysis.escapePath(bitcast, nil); path != nil {
 			if logAllocs {
-				atPos := getPosition(at)
+				atPos := getPosition(path[len(path)-1])
 				msg := "escapes at unknown line"
 				if atPos.Line != 0 {
 					msg = fmt.Sprintf("escapes at line %d", atPos.Line)
 				}
-				logAlloc(logger, heapalloc, msg)
+				logEscape(logger, heapalloc, msg, path)
 			}
 			continue
 		}
@@ -119,9 +201,28 @@ func OptimizeAllocs(mod llvm.Module, printAllocs *regexp.Regexp, logger func(tok
 	}
 }
 
-// valueEscapesAt returns the instruction where the given value may escape and a
-// nil llvm.Value if it definitely doesn't. The value must be an instruction.
-func valueEscapesAt(value llvm.Value) llvm.Value {
+// escapeAnalysis keeps the state of the interprocedural escape analysis. Every
+// function parameter is analyzed at most once.
+type escapeAnalysis struct {
+	params map[llvm.Value]*paramEscapeInfo
+}
+
+// paramEscapeInfo is the result of the escape analysis of a function
+// parameter.
+type paramEscapeInfo struct {
+	escapes  bool         // the parameter may escape
+	returned bool         // the parameter may be (part of) the return value
+	path     []llvm.Value // chain of uses through which the parameter escapes
+}
+
+// escapePath returns the chain of uses from the given value to the instruction
+// where it may escape, ending with that instruction, and nil if it definitely
+// doesn't escape. The value must be an instruction or a function parameter.
+//
+// If returned is nil, returning the value lets it escape. Otherwise, *returned
+// is set to true when the value may be returned, and returning it is not
+// considered an escape: this is used when analyzing function parameters.
+func (a *escapeAnalysis) escapePath(value llvm.Value, returned *bool) []llvm.Value {
 	uses := getUses(value)
 	for _, use := range uses {
 		if use.IsAInstruction().IsNil() {
@@ -129,13 +230,28 @@ func valueEscapesAt(value llvm.Value) llvm.Value {
 		}
 		switch use.InstructionOpcode() {
 		case llvm.GetElementPtr:
-			if at := valueEscapesAt(use); !at.IsNil() {
-				return at
+			if path := a.escapePath(use, returned); path != nil {
+				return append([]llvm.Value{use}, path...)
 			}
 		case llvm.BitCast:
 			// A bitcast escapes if the casted-to value escapes.
-			if at := valueEscapesAt(use); !at.IsNil() {
-				return at
+			if path := a.escapePath(use, returned); path != nil {
+				return append([]llvm.Value{use}, path...)
+			}
+		case llvm.InsertValue:
+			// A struct or array value (like a slice) that contains the pointer
+			// escapes if the pointer escapes.
+			if path := a.escapePath(use, returned); path != nil {
+				return append([]llvm.Value{use}, path...)
+			}
+		case llvm.ExtractValue:
+			// Only a pointer or another struct or array can contain the
+			// pointer, other values like the length of a slice can't.
+			switch use.Type().TypeKind() {
+			case llvm.PointerTypeKind, llvm.StructTypeKind, llvm.ArrayTypeKind:
+				if path := a.escapePath(use, returned); path != nil {
+					return append([]llvm.Value{use}, path...)
+				}
 			}
 		case llvm.Load:
 			// Load does not escape.
@@ -143,27 +259,154 @@ func valueEscapesAt(value llvm.Value) llvm.Value {
 			// Store only escapes when the value is stored to, not when the
 			// value is stored into another value.
 			if use.Operand(0) == value {
-				return use
+				return []llvm.Value{use}
 			}
 		case llvm.Call:
 			if !hasFlag(use, value, "nocapture") {
-				return use
+				if path := a.callEscapePath(use, value, returned); path != nil {
+					return path
+				}
 			}
 		case llvm.ICmp:
 			// Comparing pointers don't let the pointer escape.
 			// This is often a compiler-inserted nil check.
+		case llvm.Ret:
+			if returned == nil {
+				return []llvm.Value{use}
+			}
+			*returned = true
 		default:
 			// Unknown instruction, might escape.
-			return use
+			return []llvm.Value{use}
 		}
 	}
 
 	// Checked all uses, and none let the pointer value escape.
-	return llvm.Value{}
+	return nil
 }
 
-// logAlloc prints a message to stderr explaining why the given object had to be
-// allocated on the heap.
-func logAlloc(logger func(token.Position, string), allocCall llvm.Value, reason string) {
-	logger(getPosition(allocCall), "object allocated on the heap: "+reason)
+// callEscapePath returns the chain of uses through which the value escapes when
+// it is passed to the given call, starting with the call, or nil if it doesn't
+// escape. The called function is analyzed for this purpose. When the function
+// returns the value, the return value of the call is checked as well.
+func (a *escapeAnalysis) callEscapePath(call, value llvm.Value, returned *bool) []llvm.Value {
+	fn := call.CalledValue()
+	if fn.IsAFunction().IsNil() || fn.IsDeclaration() {
+		// A function pointer, or a function that isn't known.
+		return []llvm.Value{call}
+	}
+	switch fn.Linkage() {
+	case llvm.WeakAnyLinkage, llvm.LinkOnceAnyLinkage:
+		// The function may be replaced by a different one at link time.
+		return []llvm.Value{call}
+	}
+
+	isReturned := false
+	for i := 0; i < call.OperandsCount()-1; i++ {
+		if call.Operand(i) != value {
+			continue
+		}
+		if i >= fn.ParamsCount() {
+			// Passed as a variadic parameter.
+			return []llvm.Value{call}
+		}
+		info := a.paramEscape(fn.Param(i))
+		if info.escapes {
+			return append([]llvm.Value{call}, info.path...)
+		}
+		isReturned = isReturned || info.returned
+	}
+	if isReturned {
+		// The result of the call may be the value itself.
+		if path := a.escapePath(call, returned); path != nil {
+			return append([]llvm.Value{call}, path...)
+		}
+	}
+	return nil
+}
+
+// paramEscape returns whether the given function parameter escapes, and
+// whether it may be returned.
+func (a *escapeAnalysis) paramEscape(param llvm.Value) *paramEscapeInfo {
+	if info, ok := a.params[param]; ok {
+		return info
+	}
+
+	// Assume the parameter escapes while it is being analyzed. This is needed
+	// for (mutually) recursive functions.
+	info := &paramEscapeInfo{escapes: true}
+	a.params[param] = info
+
+	returned := false
+	path := a.escapePath(param, &returned)
+	info.escapes = path != nil
+	info.returned = returned
+	info.path = path
+	return info
+}
+
+// logAlloc passes an explanation of why the given object had to be allocated
+// on the heap to the logger.
+func logAlloc(logger func(AllocInfo), allocCall llvm.Value, reason string) {
+	logger(allocInfo(allocCall, reason))
+}
+
+// logEscape is like logAlloc, but also includes the chain of uses through which
+// the object escapes.
+func logEscape(logger func(AllocInfo), allocCall llvm.Value, reason string, path []llvm.Value) {
+	info := allocInfo(allocCall, reason)
+	for _, use := range path {
+		info.Escape = append(info.Escape, AllocUse{
+			Pos:         getPosition(use),
+			Description: describeUse(use),
+		})
+	}
+	logger(info)
+}
+
+// allocInfo returns the AllocInfo for the given allocation, including the
+// call sites it was inlined through.
+func allocInfo(allocCall llvm.Value, reason string) AllocInfo {
+	info := AllocInfo{
+		Pos:      getPosition(allocCall),
+		Function: allocCall.InstructionParent().Parent().Name(),
+		Reason:   reason,
+	}
+	if loc := allocCall.InstructionDebugLoc(); !loc.IsNil() {
+		for at := loc.LocationInlinedAt(); !at.IsNil(); at = at.LocationInlinedAt() {
+			info.InlinedAt = append(info.InlinedAt, getLocationPosition(at))
+		}
+	}
+	return info
+}
+
+// describeUse returns a short description of how the given instruction uses
+// the pointer in the escape chain of an allocation.
+func describeUse(use llvm.Value) string {
+	switch use.InstructionOpcode() {
+	case llvm.GetElementPtr:
+		return "address of a field or element is taken"
+	case llvm.BitCast:
+		return "pointer is converted to another type"
+	case llvm.InsertValue:
+		return "pointer is put in a struct or array value"
+	case llvm.ExtractValue:
+		return "pointer is taken out of a struct or array value"
+	case llvm.Store:
+		return "pointer is stored in memory"
+	case llvm.Call:
+		callee := use.CalledValue()
+		if !callee.IsAFunction().IsNil() && callee.Name() != "" {
+			return "pointer is passed to " + callee.Name()
+		}
+		return "pointer is passed to a function pointer"
+	case llvm.Ret:
+		return "pointer is returned"
+	case llvm.PHI, llvm.Select:
+		return "pointer is merged with another value"
+	case llvm.PtrToInt:
+		return "pointer is converted to an integer"
+	default:
+		return "pointer is used by an unknown instruction"
+	}
 }
@@ -1,6 +1,8 @@
 package transform_test
 
 import (
+	"bytes"
+	"errors"
 	"go/token"
 	"io/ioutil"
 	"path/filepath"
@@ -46,12 +48,19 @@ func TestAllocs2(t *testing.T) {
 
 	// Run heap to stack transform.
 	var testOutputs []allocsTestOutput
-	transform.OptimizeAllocs(mod, regexp.MustCompile("."), func(pos token.Position, msg string) {
+	var escape []transform.AllocUse
+	transform.OptimizeAllocs(mod, regexp.MustCompile("."), func(info transform.AllocInfo) {
 		testOutputs = append(testOutputs, allocsTestOutput{
-			filename: filepath.Base(pos.Filename),
-			line:     pos.Line,
-			msg:      msg,
+			filename: filepath.Base(info.Pos.Filename),
+			line:     info.Pos.Line,
+			msg:      info.Message(),
 		})
+		if len(info.InlinedAt) != 0 {
+			t.Errorf("line %d: unexpected inlined call sites: %v", info.Pos.Line, info.InlinedAt)
+		}
+		if info.Pos.Line == 46 {
+			escape = info.Escape
+		}
 	})
 	sort.Slice(testOutputs, func(i, j int) bool {
 		return testOutputs[i].line < testOutputs[j].line
@@ -77,4 +86,62 @@ func TestAllocs2(t *testing.T) {
 	if testOutput != expectedTestOutput {
 		t.Errorf("output does not match expected output:\n%s", testOutput)
 	}
+
+	// The object allocated at line 46 escapes through a call at line 47 and
+	// is stored in a global at line 73.
+	passed := false
+	for _, use := range escape {
+		if use.Pos.Line == 47 && strings.HasPrefix(use.Description, "pointer is passed to ") {
+			passed = true
+		}
+	}
+	if !passed || len(escape) == 0 || escape[len(escape)-1].Pos.Line != 73 || escape[len(escape)-1].Description != "pointer is stored in memory" {
+		t.Errorf("unexpected escape chain for line 46: %v", escape)
+	}
+}
+
+// Test the -print-allocs output of an allocation that was inlined and escapes.
+func TestAllocInfoOutput(t *testing.T) {
+	info := transform.AllocInfo{
+		Pos:       token.Position{Filename: "main.go", Line: 10, Column: 7},
+		Function:  "main.newBuffer",
+		InlinedAt: []token.Position{{Filename: "main.go", Line: 20, Column: 15}},
+		Reason:    "escapes at line 12",
+		Escape: []transform.AllocUse{
+			{Pos: token.Position{Filename: "main.go", Line: 11, Column: 2}, Description: "pointer is passed to main.store"},
+			{Pos: token.Position{Filename: "main.go", Line: 12, Column: 9}, Description: "pointer is stored in memory"},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	info.WriteText(buf)
+	expectedText := "main.go:10:7: object allocated on the heap: escapes at line 12\n" +
+		"\tmain.go:20:15: inlined here\n" +
+		"\tmain.go:11:2: pointer is passed to main.store\n" +
+		"\tmain.go:12:9: pointer is stored in memory\n"
+	if buf.String() != expectedText {
+		t.Errorf("unexpected text output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := info.WriteJSON(buf); err != nil {
+		t.Fatal("could not write JSON:", err)
+	}
+	expectedJSON := `{"file":"main.go","line":10,"column":7,"function":"main.newBuffer","message":"object allocated on the heap: escapes at line 12",` +
+		`"inlined-at":[{"file":"main.go","line":20,"column":15}],` +
+		`"escape":[{"file":"main.go","line":11,"column":2,"description":"pointer is passed to main.store"},{"file":"main.go","line":12,"column":9,"description":"pointer is stored in memory"}]}` + "\n"
+	if buf.String() != expectedJSON {
+		t.Errorf("unexpected JSON output:\n%s", buf.String())
+	}
+
+	// Errors of the writer are returned.
+	if err := info.WriteJSON(errorWriter{}); err == nil {
+		t.Error("expected an error from WriteJSON")
+	}
+}
+
+type errorWriter struct{}
+
+func (errorWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
 }
@@ -26,12 +26,7 @@ func getPosition(val llvm.Value) token.Position {
 		if loc.IsNil() {
 			return token.Position{}
 		}
-		file := loc.LocationScope().ScopeFile()
-		return token.Position{
-			Filename: filepath.Join(file.FileDirectory(), file.FileFilename()),
-			Line:     int(loc.LocationLine()),
-			Column:   int(loc.LocationColumn()),
-		}
+		return getLocationPosition(loc)
 	} else if !val.IsAFunction().IsNil() {
 		loc := val.Subprogram()
 		if loc.IsNil() {
@@ -55,3 +50,13 @@ type ErrMissingIntrinsic struct {
 func (err ErrMissingIntrinsic) Error() string {
 	return "missing intrinsic: " + err.Name
 }
+
+// getLocationPosition returns the position of the given debug location.
+func getLocationPosition(loc llvm.Metadata) token.Position {
+	file := loc.LocationScope().ScopeFile()
+	return token.Position{
+		Filename: filepath.Join(file.FileDirectory(), file.FileFilename()),
+		Line:     int(loc.LocationLine()),
+		Column:   int(loc.LocationColumn()),
+	}
+}
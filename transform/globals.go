@@ -7,11 +7,12 @@ import "tinygo.org/x/go-llvm"
 
 // ApplyFunctionSections puts every function in a separate section. This makes
 // it possible for the linker to remove dead code. It is the equivalent of
-// passing -ffunction-sections to a C compiler.
+// passing -ffunction-sections to a C compiler. Functions that already have a
+// section (set with //go:section) are left in that section.
 func ApplyFunctionSections(mod llvm.Module) {
 	llvmFn := mod.FirstFunction()
 	for !llvmFn.IsNil() {
-		if !llvmFn.IsDeclaration() {
+		if !llvmFn.IsDeclaration() && llvmFn.Section() == "" {
 			name := llvmFn.Name()
 			llvmFn.SetSection(".text." + name)
 		}
@@ -0,0 +1,98 @@
+package transform
+
+// This file implements instrumentation for heap profiling (-heapprofile) and
+// allocation tracing (-alloctrace). Every remaining call to runtime.alloc is an
+// allocation site. Before each of these calls, the index of the site is stored
+// in runtime.heapProfileSite so that the allocator can attribute the allocation
+// to the site. A table with a description of each site and, for heap
+// profiling, an array of counters are added to the module and made available
+// to the runtime.
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/compiler/llvmutil"
+	"tinygo.org/x/go-llvm"
+)
+
+// InstrumentHeapProfile assigns an index to every call to runtime.alloc, and
+// fills in runtime.heapProfileSites and runtime.heapProfileRecords (if the
+// runtime has it, which is not the case with only -alloctrace). It should
+// be run after the program has been linked and interpreted, but before the
+// heap-to-stack transform to make sure the runtime globals are still present.
+// Allocations that are later moved to the stack will simply never be counted.
+func InstrumentHeapProfile(mod llvm.Module) error {
+	allocator := mod.NamedFunction("runtime.alloc")
+	if allocator.IsNil() {
+		// Nothing is allocated on the heap.
+		return nil
+	}
+	site := mod.NamedGlobal("runtime.heapProfileSite")
+	records := mod.NamedGlobal("runtime.heapProfileRecords")
+	sites := mod.NamedGlobal("runtime.heapProfileSites")
+	if site.IsNil() || sites.IsNil() {
+		return errors.New("allocation sites are not supported by the runtime")
+	}
+
+	ctx := mod.Context()
+	builder := ctx.NewBuilder()
+	defer builder.Dispose()
+
+	// Find all allocation sites, in the order in which they appear in the
+	// module, and store the site index before each of them.
+	var descriptions []string
+	for fn := mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+		for bb := fn.FirstBasicBlock(); !bb.IsNil(); bb = llvm.NextBasicBlock(bb) {
+			for inst := bb.FirstInstruction(); !inst.IsNil(); inst = llvm.NextInstruction(inst) {
+				if inst.IsACallInst().IsNil() || inst.CalledValue() != allocator {
+					continue
+				}
+				pos := getPosition(inst)
+				index := llvm.ConstInt(site.Type().ElementType(), uint64(len(descriptions)), false)
+				descriptions = append(descriptions, fn.Name()+"\t"+filepath.ToSlash(pos.Filename)+"\t"+strconv.Itoa(pos.Line))
+				builder.SetInsertPointBefore(inst)
+				builder.CreateStore(index, site)
+			}
+		}
+	}
+	if len(descriptions) == 0 {
+		return nil
+	}
+
+	// Create the array of records, one for each site, and point the
+	// runtime.heapProfileRecords slice to it.
+	zero := llvm.ConstInt(ctx.Int32Type(), 0, false)
+	if !records.IsNil() {
+		sliceType := records.Type().ElementType()
+		lenType := sliceType.StructElementTypes()[1]
+		recordType := sliceType.StructElementTypes()[0].ElementType()
+		bufType := llvm.ArrayType(recordType, len(descriptions))
+		buf := llvm.AddGlobal(mod, bufType, "runtime.heapProfileRecords.buf")
+		buf.SetInitializer(llvm.ConstNull(bufType))
+		buf.SetLinkage(llvm.InternalLinkage)
+		numRecords := llvm.ConstInt(lenType, uint64(len(descriptions)), false)
+		records.SetInitializer(llvmutil.ConstStruct(sliceType, []llvm.Value{
+			llvm.ConstInBoundsGEP(buf, []llvm.Value{zero, zero}),
+			numRecords,
+			numRecords,
+		}))
+	}
+
+	// Create the site table, with one line per site.
+	stringType := sites.Type().ElementType()
+	table := ctx.ConstString(strings.Join(descriptions, "\n"), false)
+	tableGlobal := llvm.AddGlobal(mod, table.Type(), "runtime.heapProfileSites.buf")
+	tableGlobal.SetInitializer(table)
+	tableGlobal.SetLinkage(llvm.InternalLinkage)
+	tableGlobal.SetGlobalConstant(true)
+	tableGlobal.SetUnnamedAddr(true)
+	tableGlobal.SetAlignment(1)
+	sites.SetInitializer(llvmutil.ConstStruct(stringType, []llvm.Value{
+		llvm.ConstInBoundsGEP(tableGlobal, []llvm.Value{zero, zero}),
+		llvm.ConstInt(stringType.StructElementTypes()[1], uint64(table.Type().ArrayLength()), false),
+	}))
+	return nil
+}
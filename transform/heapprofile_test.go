@@ -0,0 +1,18 @@
+package transform_test
+
+import (
+	"testing"
+
+	"github.com/tinygo-org/tinygo/transform"
+	"tinygo.org/x/go-llvm"
+)
+
+func TestInstrumentHeapProfile(t *testing.T) {
+	t.Parallel()
+	testTransform(t, "testdata/heapprofile", func(mod llvm.Module) {
+		err := transform.InstrumentHeapProfile(mod)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,219 @@
+package transform
+
+// This file implements inline caches for interface method calls. They are used
+// with -opt=2 for calls on interfaces that are implemented by many types, such
+// as io.Writer, where the method thunk (see interface-lowering.go) would
+// compare the type code with every implementing type on each call.
+//
+// Every call site gets a small cache with the types it has seen last, and
+// calls a function that looks like this:
+//
+//     if entry := cache[0]; entry.typecode == actualType {
+//         return entry.method(receiver, params...)
+//     }
+//     if entry := cache[1]; entry.typecode == actualType {
+//         return entry.method(receiver, params...)
+//     }
+//     cache[1] = cache[0]
+//     entry := lookup(actualType) // full dispatch
+//     cache[0] = entry
+//     return entry.method(receiver, params...)
+//
+// The function is usually inlined in the caller. A cache entry is a constant
+// global with a type code and a function that calls the method of that type,
+// so that the cache only needs to be updated with a single pointer store and
+// an interrupt that uses the same call site can't observe a type code with the
+// method of another type. The cache starts out with an entry for the nil type
+// code, which calls the thunk so that it panics as usual.
+
+import (
+	"tinygo.org/x/go-llvm"
+)
+
+// inlineCacheSize is the number of types that are remembered at a call site: 1
+// makes a monomorphic inline cache, higher numbers a polymorphic inline cache.
+// Interfaces with at most this many implementations don't need an inline
+// cache, as the method thunk would do the same number of comparisons.
+const inlineCacheSize = 2
+
+// inlineCacheInfo contains the functions and globals that are shared between
+// the inline caches of all call sites of a single interface method.
+type inlineCacheInfo struct {
+	entryType llvm.Type  // {typecode, method} struct
+	nilEntry  llvm.Value // initial entry of a cache, for the nil type code
+	lookup    llvm.Value // returns the entry for a type code
+}
+
+// createInlineCache returns a function with the same signature as the given
+// method thunk, that uses a new inline cache to call the method. It should be
+// called once for every call site.
+func (p *lowerInterfacesPass) createInlineCache(itf *interfaceInfo, signature *signatureInfo, thunk llvm.Value) llvm.Value {
+	info := p.getInlineCacheInfo(itf, signature, thunk)
+	entryPtrType := llvm.PointerType(info.entryType, 0)
+	pointerAlignment := p.uintptrType.IntTypeWidth() / 8
+
+	// Create the cache itself.
+	cacheType := llvm.ArrayType(entryPtrType, inlineCacheSize)
+	cacheEntries := make([]llvm.Value, inlineCacheSize)
+	for i := range cacheEntries {
+		cacheEntries[i] = info.nilEntry
+	}
+	cache := llvm.AddGlobal(p.mod, cacheType, thunk.Name()+"$iccache")
+	cache.SetInitializer(llvm.ConstArray(entryPtrType, cacheEntries))
+	cache.SetLinkage(llvm.InternalLinkage)
+	cache.SetAlignment(pointerAlignment)
+
+	fn := llvm.AddFunction(p.mod, thunk.Name()+"$ic", thunk.Type().ElementType())
+	fn.SetLinkage(llvm.InternalLinkage)
+	fn.SetUnnamedAddr(true)
+	actualType := llvm.PrevParam(fn.LastParam())
+
+	// All parameters except for the type code, which are the parameters of
+	// the method functions in the cache entries.
+	var methodParams []llvm.Value
+	for param := fn.FirstParam(); !param.IsNil(); param = llvm.NextParam(param) {
+		if param != actualType {
+			methodParams = append(methodParams, param)
+		}
+	}
+
+	entry := p.ctx.AddBasicBlock(fn, "entry")
+	p.builder.SetInsertPointAtEnd(entry)
+	zero := llvm.ConstInt(p.ctx.Int32Type(), 0, false)
+	slots := make([]llvm.Value, inlineCacheSize)
+	for i := range slots {
+		// Load the entry. The load is atomic (but unordered), so that it isn't
+		// split on targets with 16-bit pointers and an 8-bit bus.
+		slots[i] = p.builder.CreateInBoundsGEP(cache, []llvm.Value{zero, llvm.ConstInt(p.ctx.Int32Type(), uint64(i), false)}, "")
+		cacheEntry := p.builder.CreateLoad(slots[i], "entry")
+		cacheEntry.SetOrdering(llvm.AtomicOrderingUnordered)
+		cacheEntry.SetAlignment(pointerAlignment)
+		typecode := p.builder.CreateLoad(p.builder.CreateStructGEP(cacheEntry, 0, ""), "entry.typecode")
+		hit := p.ctx.AddBasicBlock(fn, "hit")
+		next := p.ctx.AddBasicBlock(fn, "next")
+		cmp := p.builder.CreateICmp(llvm.IntEQ, typecode, actualType, "")
+		p.builder.CreateCondBr(cmp, hit, next)
+
+		// Call the method in the cache entry.
+		p.builder.SetInsertPointAtEnd(hit)
+		method := p.builder.CreateLoad(p.builder.CreateStructGEP(cacheEntry, 1, ""), "entry.method")
+		retval := p.builder.CreateCall(method, methodParams, "")
+		p.createReturn(retval)
+
+		p.builder.SetInsertPointAtEnd(next)
+	}
+
+	// Cache miss: move the other entries down, look up the entry for this
+	// type and put it at the front. The method is called through the new
+	// entry, so that the type is only compared with all types once.
+	for i := len(slots) - 1; i > 0; i-- {
+		prev := p.builder.CreateLoad(slots[i-1], "")
+		prev.SetOrdering(llvm.AtomicOrderingUnordered)
+		prev.SetAlignment(pointerAlignment)
+		store := p.builder.CreateStore(prev, slots[i])
+		store.SetOrdering(llvm.AtomicOrderingUnordered)
+		store.SetAlignment(pointerAlignment)
+	}
+	newEntry := p.builder.CreateCall(info.lookup, []llvm.Value{actualType}, "")
+	store := p.builder.CreateStore(newEntry, slots[0])
+	store.SetOrdering(llvm.AtomicOrderingUnordered)
+	store.SetAlignment(pointerAlignment)
+	method := p.builder.CreateLoad(p.builder.CreateStructGEP(newEntry, 1, ""), "entry.method")
+	retval := p.builder.CreateCall(method, methodParams, "")
+	p.createReturn(retval)
+
+	return fn
+}
+
+// createReturn returns the result of the given call (if any) from the current
+// function.
+func (p *lowerInterfacesPass) createReturn(retval llvm.Value) {
+	if retval.Type().TypeKind() == llvm.VoidTypeKind {
+		p.builder.CreateRetVoid()
+	} else {
+		p.builder.CreateRet(retval)
+	}
+}
+
+// getInlineCacheInfo returns the cache entries and the lookup function for the
+// inline caches of the given interface method, creating them if needed.
+func (p *lowerInterfacesPass) getInlineCacheInfo(itf *interfaceInfo, signature *signatureInfo, thunk llvm.Value) *inlineCacheInfo {
+	if info, ok := itf.inlineCaches[signature]; ok {
+		return info
+	}
+	if itf.inlineCaches == nil {
+		itf.inlineCaches = make(map[*signatureInfo]*inlineCacheInfo)
+	}
+
+	// The methods in the cache entries have the signature of the thunk, except
+	// for the type code parameter.
+	thunkType := thunk.Type().ElementType()
+	thunkParamTypes := thunkType.ParamTypes()
+	methodParamTypes := append(append([]llvm.Type{}, thunkParamTypes[:len(thunkParamTypes)-2]...), thunkParamTypes[len(thunkParamTypes)-1])
+	methodType := llvm.FunctionType(thunkType.ReturnType(), methodParamTypes, false)
+	info := &inlineCacheInfo{
+		entryType: p.ctx.StructType([]llvm.Type{p.uintptrType, llvm.PointerType(methodType, 0)}, false),
+	}
+	itf.inlineCaches[signature] = info
+
+	// The entry for nil interfaces calls the thunk, which panics.
+	nilMethod := p.createInlineCacheMethod(thunk.Name()+"$icmethod:nil", methodType, func(params []llvm.Value) llvm.Value {
+		params = append(params[:len(params)-1:len(params)-1], llvm.ConstInt(p.uintptrType, 0, false), params[len(params)-1])
+		return p.builder.CreateCall(thunk, params, "")
+	})
+	info.nilEntry = p.createInlineCacheEntry(info, thunk.Name()+"$icentry:nil", llvm.ConstInt(p.uintptrType, 0, false), nilMethod)
+
+	// Create the lookup function, which is an if/else chain like the thunk
+	// but returns a cache entry instead of calling the method.
+	entryPtrType := llvm.PointerType(info.entryType, 0)
+	info.lookup = llvm.AddFunction(p.mod, thunk.Name()+"$iclookup", llvm.FunctionType(entryPtrType, []llvm.Type{p.uintptrType}, false))
+	info.lookup.SetLinkage(llvm.InternalLinkage)
+	info.lookup.SetUnnamedAddr(true)
+	info.lookup.Param(0).SetName("actualType")
+	entries := make([]llvm.Value, len(itf.types))
+	for i, typ := range itf.types {
+		function := typ.getMethod(signature).function
+		method := p.createInlineCacheMethod(thunk.Name()+"$icmethod:"+typ.name, methodType, func(params []llvm.Value) llvm.Value {
+			// Leave out the parent handle, like the thunk does.
+			return p.createMethodCall(function, params[0], params[1:len(params)-1])
+		})
+		entries[i] = p.createInlineCacheEntry(info, thunk.Name()+"$icentry:"+typ.name, llvm.ConstPtrToInt(typ.typecode, p.uintptrType), method)
+	}
+	entry := p.ctx.AddBasicBlock(info.lookup, "entry")
+	p.builder.SetInsertPointAtEnd(entry)
+	for i, typ := range itf.types {
+		found := p.ctx.AddBasicBlock(info.lookup, typ.name)
+		next := p.ctx.AddBasicBlock(info.lookup, typ.name+".next")
+		cmp := p.builder.CreateICmp(llvm.IntEQ, info.lookup.Param(0), llvm.ConstPtrToInt(typ.typecode, p.uintptrType), typ.name+".icmp")
+		p.builder.CreateCondBr(cmp, found, next)
+		p.builder.SetInsertPointAtEnd(found)
+		p.builder.CreateRet(entries[i])
+		p.builder.SetInsertPointAtEnd(next)
+	}
+	p.builder.CreateRet(info.nilEntry)
+
+	return info
+}
+
+// createInlineCacheMethod creates a function of the given type for a cache
+// entry. The body is created by the create callback, which gets the function
+// parameters and returns the return value.
+func (p *lowerInterfacesPass) createInlineCacheMethod(name string, fnType llvm.Type, create func(params []llvm.Value) llvm.Value) llvm.Value {
+	fn := llvm.AddFunction(p.mod, name, fnType)
+	fn.SetLinkage(llvm.InternalLinkage)
+	fn.SetUnnamedAddr(true)
+	p.builder.SetInsertPointAtEnd(p.ctx.AddBasicBlock(fn, "entry"))
+	p.createReturn(create(fn.Params()))
+	return fn
+}
+
+// createInlineCacheEntry creates a constant cache entry global with the given
+// type code and method.
+func (p *lowerInterfacesPass) createInlineCacheEntry(info *inlineCacheInfo, name string, typecode, method llvm.Value) llvm.Value {
+	global := llvm.AddGlobal(p.mod, info.entryType, name)
+	global.SetInitializer(p.ctx.ConstStruct([]llvm.Value{typecode, method}, false))
+	global.SetLinkage(llvm.InternalLinkage)
+	global.SetGlobalConstant(true)
+	global.SetUnnamedAddr(true)
+	return global
+}
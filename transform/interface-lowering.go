@@ -95,12 +95,13 @@ func (t *typeInfo) getMethod(signature *signatureInfo) *methodInfo {
 // interfaceInfo keeps information about a Go interface type, including all
 // methods it has.
 type interfaceInfo struct {
-	name        string                        // name with $interface suffix
-	methodSet   llvm.Value                    // global which this interfaceInfo describes
-	signatures  []*signatureInfo              // method set
-	types       []*typeInfo                   // types this interface implements
-	assertFunc  llvm.Value                    // runtime.interfaceImplements replacement
-	methodFuncs map[*signatureInfo]llvm.Value // runtime.interfaceMethod replacements for each signature
+	name         string                              // name with $interface suffix
+	methodSet    llvm.Value                          // global which this interfaceInfo describes
+	signatures   []*signatureInfo                    // method set
+	types        []*typeInfo                         // types this interface implements
+	assertFunc   llvm.Value                          // runtime.interfaceImplements replacement
+	methodFuncs  map[*signatureInfo]llvm.Value       // runtime.interfaceMethod replacements for each signature
+	inlineCaches map[*signatureInfo]*inlineCacheInfo // inline cache state for each signature, with -opt=2
 }
 
 // id removes the $interface suffix from the name and returns the clean
@@ -116,30 +117,37 @@ func (itf *interfaceInfo) id() string {
 // pass has been implemented as an object type because of its complexity, but
 // should be seen as a regular function call (see LowerInterfaces).
 type lowerInterfacesPass struct {
-	mod         llvm.Module
-	sizeLevel   int // LLVM optimization size level, 1 means -opt=s and 2 means -opt=z
-	builder     llvm.Builder
-	ctx         llvm.Context
-	uintptrType llvm.Type
-	types       map[string]*typeInfo
-	signatures  map[string]*signatureInfo
-	interfaces  map[string]*interfaceInfo
+	mod          llvm.Module
+	sizeLevel    int  // LLVM optimization size level, 1 means -opt=s and 2 means -opt=z
+	inlineCaches bool // use inline caches for interface method calls
+	builder      llvm.Builder
+	ctx          llvm.Context
+	uintptrType  llvm.Type
+	types        map[string]*typeInfo
+	signatures   map[string]*signatureInfo
+	interfaces   map[string]*interfaceInfo
 }
 
 // LowerInterfaces lowers all intermediate interface calls and globals that are
 // emitted by the compiler as higher-level intrinsics. They need some lowering
 // before LLVM can work on them. This is done so that a few cleanup passes can
 // run before assigning the final type codes.
-func LowerInterfaces(mod llvm.Module, sizeLevel int) error {
+//
+// When inlineCaches is set, interface method calls on interfaces with many
+// implementations go through an inline cache (see interface-inlinecache.go)
+// instead of directly calling the method thunk. This is faster when a call
+// site usually sees the same few types, at the cost of some code size and RAM.
+func LowerInterfaces(mod llvm.Module, sizeLevel int, inlineCaches bool) error {
 	p := &lowerInterfacesPass{
-		mod:         mod,
-		sizeLevel:   sizeLevel,
-		builder:     mod.Context().NewBuilder(),
-		ctx:         mod.Context(),
-		uintptrType: mod.Context().IntType(llvm.NewTargetData(mod.DataLayout()).PointerSize() * 8),
-		types:       make(map[string]*typeInfo),
-		signatures:  make(map[string]*signatureInfo),
-		interfaces:  make(map[string]*interfaceInfo),
+		mod:          mod,
+		sizeLevel:    sizeLevel,
+		inlineCaches: inlineCaches,
+		builder:      mod.Context().NewBuilder(),
+		ctx:          mod.Context(),
+		uintptrType:  mod.Context().IntType(llvm.NewTargetData(mod.DataLayout()).PointerSize() * 8),
+		types:        make(map[string]*typeInfo),
+		signatures:   make(map[string]*signatureInfo),
+		interfaces:   make(map[string]*interfaceInfo),
 	}
 	return p.run()
 }
@@ -259,6 +267,17 @@ func (p *lowerInterfacesPass) run() error {
 		methodSet := use.Operand(1).Operand(0) // global variable
 		itf := p.interfaces[methodSet.Name()]
 
+		if len(itf.types) == 1 {
+			// Only one type implements this interface, so call its method
+			// directly. This allows the method to be inlined, and code that
+			// is only used by other methods of this interface to be removed.
+			err := p.replaceInvokeWithCall(use, itf.types[0], signature)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
 		// Delegate calling the right function to a special wrapper function.
 		inttoptrs := getUses(use)
 		if len(inttoptrs) != 1 || inttoptrs[0].IsAIntToPtrInst().IsNil() {
@@ -281,6 +300,10 @@ func (p *lowerInterfacesPass) run() error {
 			// Create a function that redirects the call to the destination
 			// call, after selecting the right concrete type.
 			redirector := p.getInterfaceMethodFunc(itf, signature, call.Type(), paramTypes)
+			if p.inlineCaches && len(itf.types) > inlineCacheSize {
+				// Try the types last seen at this call site first.
+				redirector = p.createInlineCache(itf, signature, redirector)
+			}
 
 			// Replace the old lookup/inttoptr/call with the new call.
 			p.builder.SetInsertPointBefore(call)
@@ -406,47 +429,84 @@ func (p *lowerInterfacesPass) getSignature(name string, global llvm.Value) *sign
 
 // replaceInvokeWithCall replaces a runtime.interfaceMethod + inttoptr with a
 // concrete method. This can be done when only one type implements the
-// interface.
+// interface. The type code is still checked, as the interface may be nil: in
+// that case, the call panics like it would in the method thunk.
 func (p *lowerInterfacesPass) replaceInvokeWithCall(use llvm.Value, typ *typeInfo, signature *signatureInfo) error {
 	inttoptrs := getUses(use)
 	if len(inttoptrs) != 1 || inttoptrs[0].IsAIntToPtrInst().IsNil() {
 		return errorAt(use, "internal error: expected exactly one inttoptr use of runtime.interfaceMethod")
 	}
 	inttoptr := inttoptrs[0]
+	typecode := use.Operand(0)
 	function := typ.getMethod(signature).function
-	if inttoptr.Type() == function.Type() {
-		// Easy case: the types are the same. Simply replace the inttoptr
-		// result (which is directly called) with the actual function.
-		inttoptr.ReplaceAllUsesWith(function)
-	} else {
-		// Harder case: the type is not actually the same. Go through each call
-		// (of which there should be only one), extract the receiver params for
-		// this call and replace the call with a direct call to the target
-		// function.
-		for _, call := range getUses(inttoptr) {
-			if call.IsACallInst().IsNil() || call.CalledValue() != inttoptr {
-				return errorAt(call, "internal error: expected the inttoptr to be called as a method, this is not a method call")
-			}
-			operands := make([]llvm.Value, call.OperandsCount()-1)
-			for i := range operands {
-				operands[i] = call.Operand(i)
-			}
-			paramTypes := function.Type().ElementType().ParamTypes()
-			receiverParamTypes := paramTypes[:len(paramTypes)-(len(operands)-1)]
-			methodParamTypes := paramTypes[len(paramTypes)-(len(operands)-1):]
-			for i, methodParamType := range methodParamTypes {
-				if methodParamType != operands[i+1].Type() {
-					return errorAt(call, "internal error: expected method call param type and function param type to be the same")
-				}
+	nilPanic := p.mod.NamedFunction("runtime.nilPanic")
+	i8ptrType := llvm.PointerType(p.ctx.Int8Type(), 0)
+	for _, call := range getUses(inttoptr) {
+		if call.IsACallInst().IsNil() || call.CalledValue() != inttoptr {
+			return errorAt(call, "internal error: expected the inttoptr to be called as a method, this is not a method call")
+		}
+		// The method may be inlined, which requires a debug location if it
+		// has debug information.
+		loc := call.InstructionDebugLoc()
+		setDebugLoc := func(inst llvm.Value) {
+			if !loc.IsNil() {
+				inst.InstructionSetDebugLoc(loc)
 			}
-			p.builder.SetInsertPointBefore(call)
-			receiverParams := llvmutil.EmitPointerUnpack(p.builder, p.mod, operands[0], receiverParamTypes)
-			result := p.builder.CreateCall(function, append(receiverParams, operands[1:]...), "")
-			if result.Type().TypeKind() != llvm.VoidTypeKind {
-				call.ReplaceAllUsesWith(result)
+		}
+
+		// Check that the interface isn't nil: the type code can only be the
+		// type code of this type or zero.
+		prev := llvm.PrevInstruction(call)
+		p.builder.SetInsertPointBefore(call)
+		isValid := p.builder.CreateICmp(llvm.IntEQ, typecode, llvm.ConstPtrToInt(typ.typecode, p.uintptrType), "invoke.valid")
+
+		// Call the method directly.
+		params := make([]llvm.Value, call.OperandsCount()-2)
+		for i := range params {
+			params[i] = call.Operand(i + 1)
+		}
+		retval := p.createMethodCall(function, call.Operand(0), params)
+
+		// Values may have been folded to constants by the builder, so find
+		// the new instructions by walking back from the call.
+		first := call
+		for inst := llvm.PrevInstruction(call); inst != prev; inst = llvm.PrevInstruction(inst) {
+			setDebugLoc(inst)
+			first = inst
+		}
+		if retval.Type().TypeKind() != llvm.VoidTypeKind {
+			call.ReplaceAllUsesWith(retval)
+		}
+		call.EraseFromParentAsInstruction()
+
+		if !isValid.IsAConstantInt().IsNil() {
+			// The type code is a constant, so it is already known whether the
+			// interface is nil.
+			if isValid.ZExtValue() == 0 {
+				p.builder.SetInsertPointBefore(first)
+				setDebugLoc(p.builder.CreateCall(nilPanic, []llvm.Value{llvm.Undef(i8ptrType), llvm.Undef(i8ptrType)}, ""))
 			}
-			call.EraseFromParentAsInstruction()
+			continue
+		}
+
+		// Branch to the direct call or to a nil panic. The check may have been
+		// folded to a constant expression, in which case the block is split
+		// right before the new instructions.
+		splitAfter := isValid
+		if isValid.IsAInstruction().IsNil() {
+			splitAfter = prev
 		}
+		if splitAfter.IsNil() {
+			return errorAt(first, "internal error: expected an instruction before the interface method call")
+		}
+		oldBlock := splitAfter.InstructionParent()
+		panicBlock := p.ctx.AddBasicBlock(oldBlock.Parent(), "invoke.nil")
+		callBlock := llvmutil.SplitBasicBlock(p.builder, splitAfter, llvm.NextBasicBlock(oldBlock), "invoke.call")
+		p.builder.SetInsertPointAtEnd(oldBlock)
+		setDebugLoc(p.builder.CreateCondBr(isValid, callBlock, panicBlock))
+		p.builder.SetInsertPointAtEnd(panicBlock)
+		setDebugLoc(p.builder.CreateCall(nilPanic, []llvm.Value{llvm.Undef(i8ptrType), llvm.Undef(i8ptrType)}, ""))
+		p.builder.CreateUnreachable()
 	}
 	inttoptr.EraseFromParentAsInstruction()
 	use.EraseFromParentAsInstruction()
@@ -562,28 +622,7 @@ func (p *lowerInterfacesPass) getInterfaceMethodFunc(itf *interfaceInfo, signatu
 		function := typ.getMethod(signature).function
 
 		p.builder.SetInsertPointAtEnd(bb)
-		receiver := fn.FirstParam()
-		if receiver.Type() != function.FirstParam().Type() {
-			// When the receiver is a pointer, it is not wrapped. This means the
-			// i8* has to be cast to the correct pointer type of the target
-			// function.
-			receiver = p.builder.CreateBitCast(receiver, function.FirstParam().Type(), "")
-		}
-
-		// Check whether the called function has the same signature as would be
-		// expected from the parameters. This can happen in rare cases when
-		// named struct types are renamed after merging multiple LLVM modules.
-		paramTypes := []llvm.Type{receiver.Type()}
-		for _, param := range params {
-			paramTypes = append(paramTypes, param.Type())
-		}
-		calledFunctionType := function.Type()
-		sig := llvm.PointerType(llvm.FunctionType(calledFunctionType.ElementType().ReturnType(), paramTypes, false), calledFunctionType.PointerAddressSpace())
-		if sig != function.Type() {
-			function = p.builder.CreateBitCast(function, sig, "")
-		}
-
-		retval := p.builder.CreateCall(function, append([]llvm.Value{receiver}, params...), "")
+		retval := p.createMethodCall(function, fn.FirstParam(), params)
 		if retval.Type().TypeKind() == llvm.VoidTypeKind {
 			p.builder.CreateRetVoid()
 		} else {
@@ -611,3 +650,30 @@ func (p *lowerInterfacesPass) getInterfaceMethodFunc(itf *interfaceInfo, signatu
 
 	return fn
 }
+
+// createMethodCall calls the method function of a concrete type with the
+// receiver (as an i8*) and the other parameters of an interface method call, at
+// the current insert point of the builder.
+func (p *lowerInterfacesPass) createMethodCall(function, receiver llvm.Value, params []llvm.Value) llvm.Value {
+	if receiver.Type() != function.FirstParam().Type() {
+		// When the receiver is a pointer, it is not wrapped. This means the
+		// i8* has to be cast to the correct pointer type of the target
+		// function.
+		receiver = p.builder.CreateBitCast(receiver, function.FirstParam().Type(), "")
+	}
+
+	// Check whether the called function has the same signature as would be
+	// expected from the parameters. This can happen in rare cases when
+	// named struct types are renamed after merging multiple LLVM modules.
+	paramTypes := []llvm.Type{receiver.Type()}
+	for _, param := range params {
+		paramTypes = append(paramTypes, param.Type())
+	}
+	calledFunctionType := function.Type()
+	sig := llvm.PointerType(llvm.FunctionType(calledFunctionType.ElementType().ReturnType(), paramTypes, false), calledFunctionType.PointerAddressSpace())
+	if sig != function.Type() {
+		function = p.builder.CreateBitCast(function, sig, "")
+	}
+
+	return p.builder.CreateCall(function, append([]llvm.Value{receiver}, params...), "")
+}
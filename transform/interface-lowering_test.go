@@ -10,7 +10,7 @@ import (
 func TestInterfaceLowering(t *testing.T) {
 	t.Parallel()
 	testTransform(t, "testdata/interface", func(mod llvm.Module) {
-		err := transform.LowerInterfaces(mod, 0)
+		err := transform.LowerInterfaces(mod, 0, false)
 		if err != nil {
 			t.Error(err)
 		}
@@ -21,3 +21,21 @@ func TestInterfaceLowering(t *testing.T) {
 		pm.Run(mod)
 	})
 }
+
+func TestInterfaceInlineCache(t *testing.T) {
+	t.Parallel()
+	testTransform(t, "testdata/interface-inlinecache", func(mod llvm.Module) {
+		err := transform.LowerInterfaces(mod, 0, true)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := llvm.VerifyModule(mod, llvm.ReturnStatusAction); err != nil {
+			t.Error(err)
+		}
+
+		pm := llvm.NewPassManager()
+		defer pm.Dispose()
+		pm.AddGlobalDCEPass()
+		pm.Run(mod)
+	})
+}
@@ -73,6 +73,18 @@ func LowerInterrupts(mod llvm.Module, sizeLevel int) []error {
 	// Create a function type with the signature of an interrupt handler.
 	fnType := llvm.FunctionType(ctx.VoidType(), nil, false)
 
+	// The runtime defines these functions when interrupts must be traced
+	// (-trace-hooks). They are called with the interrupt number at the start
+	// and the end of each interrupt handler.
+	traceISREnter := mod.NamedFunction("tinygo_trace_isr_enter")
+	traceISRExit := mod.NamedFunction("tinygo_trace_isr_exit")
+
+	// The runtime defines these functions with -interruptcheck. They are
+	// called with the name of the handler function at the start, and without
+	// parameters at the end of each interrupt handler.
+	isrCheckEnter := mod.NamedFunction("tinygo_isrcheck_enter")
+	isrCheckExit := mod.NamedFunction("tinygo_isrcheck_exit")
+
 	// Collect a slice of interrupt handle objects. The fact that they still
 	// exist in the IR indicates that they could not be optimized away,
 	// therefore we need to make real interrupt handlers for them.
@@ -164,6 +176,11 @@ func LowerInterrupts(mod llvm.Module, sizeLevel int) []error {
 			// instruction (which should be a call) whether this handler would
 			// be identical anyway.
 			firstInst := fn.FirstBasicBlock().FirstInstruction()
+			for _, hook := range []llvm.Value{traceISREnter, isrCheckEnter} {
+				if !hook.IsNil() && !firstInst.IsACallInst().IsNil() && firstInst.CalledValue() == hook {
+					firstInst = llvm.NextInstruction(firstInst)
+				}
+			}
 			if !firstInst.IsACallInst().IsNil() && firstInst.OperandsCount() == 4 && firstInst.CalledValue() == handlerFuncPtr && firstInst.Operand(0) == num && firstInst.Operand(1) == handlerContext {
 				// Already defined and apparently identical, so assume this is
 				// fine.
@@ -207,7 +224,19 @@ func LowerInterrupts(mod llvm.Module, sizeLevel int) []error {
 		// Fill the function declaration with the forwarding call.
 		// In practice, the called function will often be inlined which avoids
 		// the extra indirection.
+		if !traceISREnter.IsNil() {
+			builder.CreateCall(traceISREnter, []llvm.Value{traceISRNum(traceISREnter, num)}, "")
+		}
+		if !isrCheckEnter.IsNil() {
+			builder.CreateCall(isrCheckEnter, []llvm.Value{isrCheckName(mod, isrCheckEnter, handlerFuncPtr)}, "")
+		}
 		builder.CreateCall(handlerFuncPtr, []llvm.Value{num, handlerContext, nullptr}, "")
+		if !isrCheckExit.IsNil() {
+			builder.CreateCall(isrCheckExit, nil, "")
+		}
+		if !traceISRExit.IsNil() {
+			builder.CreateCall(traceISRExit, []llvm.Value{traceISRNum(traceISRExit, num)}, "")
+		}
 		builder.CreateRetVoid()
 
 		// Replace all ptrtoint uses of the global with the interrupt constant.
@@ -294,3 +323,25 @@ func LowerInterrupts(mod llvm.Module, sizeLevel int) []error {
 
 	return errs
 }
+
+// traceISRNum returns the interrupt number as the parameter type of the given
+// interrupt trace hook.
+func traceISRNum(hook, num llvm.Value) llvm.Value {
+	paramType := hook.Type().ElementType().ParamTypes()[0]
+	return llvm.ConstInt(paramType, uint64(num.SExtValue()), false)
+}
+
+// isrCheckName returns a NUL-terminated string with the name of the given
+// interrupt handler function, as the parameter type of the given interrupt
+// check hook.
+func isrCheckName(mod llvm.Module, hook, handler llvm.Value) llvm.Value {
+	value := mod.Context().ConstString(handler.Name(), true)
+	global := llvm.AddGlobal(mod, value.Type(), handler.Name()+"$isrname")
+	global.SetInitializer(value)
+	global.SetGlobalConstant(true)
+	global.SetLinkage(llvm.PrivateLinkage)
+	global.SetUnnamedAddr(true)
+	global.SetAlignment(1)
+	paramType := hook.Type().ElementType().ParamTypes()[0]
+	return llvm.ConstBitCast(global, paramType)
+}
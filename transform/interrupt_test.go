@@ -9,7 +9,7 @@ import (
 
 func TestInterruptLowering(t *testing.T) {
 	t.Parallel()
-	for _, subtest := range []string{"avr", "cortexm"} {
+	for _, subtest := range []string{"avr", "cortexm", "isrcheck"} {
 		t.Run(subtest, func(t *testing.T) {
 			testTransform(t, "testdata/interrupt-"+subtest, func(mod llvm.Module) {
 				errs := transform.LowerInterrupts(mod, 0)
@@ -3,7 +3,6 @@ package transform
 import (
 	"errors"
 	"fmt"
-	"go/token"
 	"os"
 
 	"github.com/tinygo-org/tinygo/compileopts"
@@ -68,7 +67,11 @@ func Optimize(mod llvm.Module, config *compileopts.Config, optLevel, sizeLevel i
 		OptimizeStringToBytes(mod)
 		OptimizeReflectImplements(mod)
 		OptimizeAllocs(mod, nil, nil)
-		err := LowerInterfaces(mod, sizeLevel)
+		// Inline caches speed up interface method calls at the cost of code
+		// size, so only use them with -opt=2. They call methods through
+		// function pointers, which the coroutine lowering pass can't handle.
+		inlineCaches := optLevel >= 2 && sizeLevel == 0 && config.Scheduler() != "coroutines"
+		err := LowerInterfaces(mod, sizeLevel, inlineCaches)
 		if err != nil {
 			return []error{err}
 		}
@@ -89,15 +92,23 @@ func Optimize(mod llvm.Module, config *compileopts.Config, optLevel, sizeLevel i
 
 		// Run TinyGo-specific interprocedural optimizations.
 		LowerReflect(mod)
-		OptimizeAllocs(mod, config.Options.PrintAllocs, func(pos token.Position, msg string) {
-			fmt.Fprintln(os.Stderr, pos.String()+": "+msg)
+		var printErr error
+		OptimizeAllocs(mod, config.Options.PrintAllocs, func(info AllocInfo) {
+			if !config.Options.PrintAllocsJSON {
+				info.WriteText(os.Stderr)
+			} else if err := info.WriteJSON(os.Stdout); err != nil && printErr == nil {
+				printErr = err
+			}
 		})
+		if printErr != nil {
+			return []error{printErr}
+		}
 		OptimizeStringToBytes(mod)
 		OptimizeStringEqual(mod)
 
 	} else {
 		// Must be run at any optimization level.
-		err := LowerInterfaces(mod, sizeLevel)
+		err := LowerInterfaces(mod, sizeLevel, false)
 		if err != nil {
 			return []error{err}
 		}
@@ -175,6 +186,19 @@ func Optimize(mod llvm.Module, config *compileopts.Config, optLevel, sizeLevel i
 	builder.Populate(modPasses)
 	modPasses.Run(mod)
 
+	// Move constant data to program memory, and report what is left in RAM.
+	// This is done after the last LLVM passes, so that only the loads that
+	// remain after optimization need to be supported.
+	if config.ProgramMemoryData() || config.Options.PrintRAMData {
+		var logger func(RAMDataInfo)
+		if config.Options.PrintRAMData {
+			logger = func(info RAMDataInfo) {
+				info.WriteText(os.Stdout)
+			}
+		}
+		OptimizeConstantData(mod, config.ProgramMemoryData(), config.ReadOnlyDataInRAM(), logger)
+	}
+
 	hasGCPass := AddGlobalsBitmap(mod)
 	hasGCPass = MakeGCStackSlots(mod) || hasGCPass
 	if hasGCPass {
@@ -0,0 +1,179 @@
+package transform
+
+// This file keeps constant data out of RAM where the architecture allows it.
+// On AVR, which is a Harvard architecture, data in flash can only be read with
+// special instructions (LPM). LLVM uses these for loads from address space 1,
+// so constant globals that are only read directly (and never used as a
+// generic pointer, which always points to RAM) are moved to that address space.
+// String data never qualifies, as strings are always passed around as a
+// pointer. The linker script places the moved globals right after the interrupt
+// vectors, as LPM can only read the first 64kB of flash.
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"tinygo.org/x/go-llvm"
+)
+
+// programMemoryAddressSpace is the address space of data in flash on AVR.
+const programMemoryAddressSpace = 1
+
+// RAMDataInfo describes a global with initialized data that is copied to RAM at
+// startup. It is passed to the logger of OptimizeConstantData.
+type RAMDataInfo struct {
+	Name   string // name of the global
+	Size   uint64 // size of the global in bytes
+	Reason string // why the global is in RAM
+}
+
+// WriteText writes the global in the format used by -print-ramdata.
+func (info RAMDataInfo) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%7d %s: %s\n", info.Size, info.Name, info.Reason)
+}
+
+// OptimizeConstantData moves constant globals to program memory, if progmem is
+// set and they are only read with loads of a supported size. If logger is
+// non-nil, it is called for every global with initialized data that remains in
+// RAM, largest first. Read-only data is only reported if readOnlyInRAM is set,
+// which means the linker script places it in RAM.
+func OptimizeConstantData(mod llvm.Module, progmem, readOnlyInRAM bool, logger func(RAMDataInfo)) {
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	builder := mod.Context().NewBuilder()
+	defer builder.Dispose()
+
+	// Collect the globals first, as moving a global adds a new one.
+	var globals []llvm.Value
+	for global := mod.FirstGlobal(); !global.IsNil(); global = llvm.NextGlobal(global) {
+		globals = append(globals, global)
+	}
+
+	var infos []RAMDataInfo
+	for _, global := range globals {
+		if global.IsDeclaration() || global.Section() != "" || global.IsThreadLocal() {
+			// Declared elsewhere or explicitly placed in a section.
+			continue
+		}
+		if global.Type().PointerAddressSpace() != 0 {
+			continue
+		}
+		initializer := global.Initializer()
+		if initializer.IsNull() {
+			// Zero initialized data is not copied from flash.
+			continue
+		}
+
+		var reason string
+		if !global.IsGlobalConstant() {
+			reason = "not constant (may be modified)"
+		} else if !readOnlyInRAM {
+			continue // in flash already
+		} else if !progmem {
+			reason = "read-only data is kept in RAM on this target"
+		} else if linkage := global.Linkage(); linkage != llvm.InternalLinkage && linkage != llvm.PrivateLinkage {
+			reason = "may be used outside of Go code"
+		} else {
+			reason = programMemoryUseError(global)
+			if reason == "" {
+				moveToProgramMemory(builder, global)
+				continue
+			}
+		}
+		if logger != nil {
+			infos = append(infos, RAMDataInfo{
+				Name:   global.Name(),
+				Size:   targetData.TypeAllocSize(initializer.Type()),
+				Reason: reason,
+			})
+		}
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].Size > infos[j].Size
+	})
+	for _, info := range infos {
+		logger(info)
+	}
+}
+
+// programMemoryUseError returns why the given pointer to a constant global
+// cannot be moved to program memory, or the empty string if it can. That is
+// only possible if all uses are loads, possibly after getelementptr.
+func programMemoryUseError(value llvm.Value) string {
+	for _, use := range getUses(value) {
+		switch {
+		case !use.IsALoadInst().IsNil():
+			typ := use.Type()
+			if typ.TypeKind() != llvm.IntegerTypeKind || (typ.IntTypeWidth() != 8 && typ.IntTypeWidth() != 16) {
+				return "loaded as a value other than an 8-bit or 16-bit integer"
+			}
+			if use.IsVolatile() {
+				return "loaded with a volatile load"
+			}
+		case !use.IsAGetElementPtrInst().IsNil() || (!use.IsAConstantExpr().IsNil() && use.Opcode() == llvm.GetElementPtr):
+			if use.Operand(0) != value {
+				return "address is used as an index"
+			}
+			if reason := programMemoryUseError(use); reason != "" {
+				return reason
+			}
+		case !use.IsACallInst().IsNil():
+			return "address is passed to a function"
+		case !use.IsAStoreInst().IsNil():
+			return "address is stored in memory"
+		case !use.IsAConstant().IsNil():
+			return "address is stored in another global"
+		default:
+			return "address is used as a pointer"
+		}
+	}
+	return ""
+}
+
+// moveToProgramMemory replaces the global with a copy in program memory, and
+// updates all loads from it.
+func moveToProgramMemory(builder llvm.Builder, global llvm.Value) {
+	name := global.Name()
+	global.SetName(name + ".ram")
+	newGlobal := llvm.AddGlobalInAddressSpace(global.GlobalParent(), global.Type().ElementType(), name, programMemoryAddressSpace)
+	newGlobal.SetInitializer(global.Initializer())
+	newGlobal.SetGlobalConstant(true)
+	newGlobal.SetLinkage(global.Linkage())
+	newGlobal.SetUnnamedAddr(true)
+	newGlobal.SetAlignment(global.Alignment())
+	replaceWithProgramMemory(builder, global, newGlobal)
+
+	// Only unused constant expressions are left, if any.
+	global.ReplaceAllUsesWith(llvm.ConstPointerCast(newGlobal, global.Type()))
+	global.EraseFromParentAsGlobal()
+}
+
+// replaceWithProgramMemory replaces the loads from oldValue (possibly through
+// getelementptr) with loads from newValue, which points to program memory.
+func replaceWithProgramMemory(builder llvm.Builder, oldValue, newValue llvm.Value) {
+	for _, use := range getUses(oldValue) {
+		var indices []llvm.Value
+		for i := 1; i < use.OperandsCount(); i++ {
+			indices = append(indices, use.Operand(i))
+		}
+		switch {
+		case !use.IsALoadInst().IsNil():
+			builder.SetInsertPointBefore(use)
+			load := builder.CreateLoad(newValue, "")
+			load.SetAlignment(use.Alignment())
+			use.ReplaceAllUsesWith(load)
+			use.EraseFromParentAsInstruction()
+		case !use.IsAGetElementPtrInst().IsNil():
+			builder.SetInsertPointBefore(use)
+			gep := builder.CreateInBoundsGEP(newValue, indices, "")
+			replaceWithProgramMemory(builder, use, gep)
+			use.EraseFromParentAsInstruction()
+		default:
+			// Constant getelementptr expression.
+			gep := llvm.ConstInBoundsGEP(newValue, indices)
+			replaceWithProgramMemory(builder, use, gep)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package transform_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/transform"
+	"tinygo.org/x/go-llvm"
+)
+
+func TestOptimizeConstantData(t *testing.T) {
+	t.Parallel()
+	var infos []transform.RAMDataInfo
+	testTransform(t, "testdata/progmem", func(mod llvm.Module) {
+		transform.OptimizeConstantData(mod, true, true, func(info transform.RAMDataInfo) {
+			infos = append(infos, info)
+		})
+	})
+	expected := []transform.RAMDataInfo{
+		{Name: "main.message", Size: 4, Reason: "address is passed to a function"},
+		{Name: "main.exported", Size: 2, Reason: "may be used outside of Go code"},
+		{Name: "main.counter", Size: 1, Reason: "not constant (may be modified)"},
+	}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Errorf("unexpected globals in RAM:\nexpected: %v\nactual:   %v", expected, infos)
+	}
+}
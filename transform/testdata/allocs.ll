@@ -2,6 +2,7 @@ target datalayout = "e-m:e-p:32:32-i64:64-v128:64:128-a:0:32-n32-S64"
 target triple = "armv7m-none-eabi"
 
 @runtime.zeroSizedAlloc = internal global i8 0, align 1
+@slice = global i8* null
 
 declare nonnull i8* @runtime.alloc(i32)
 
@@ -78,6 +79,75 @@ define void @testZeroSizedAlloc() {
   ret void
 }
 
+; Call a function that returns the pointer. The returned pointer doesn't
+; escape, so the heap-to-stack transform can be applied.
+define i32 @testReturnedCall() {
+  %1 = call i8* @runtime.alloc(i32 4)
+  %2 = bitcast i8* %1 to i32*
+  %3 = call i32* @returnIntPtr(i32* %2)
+  %4 = load i32, i32* %3
+  ret i32 %4
+}
+
+; Call a function that returns the pointer, and return it from the caller,
+; which lets it escape.
+define i32* @testEscapingReturnedCall() {
+  %1 = call i8* @runtime.alloc(i32 4)
+  %2 = bitcast i8* %1 to i32*
+  %3 = call i32* @returnIntPtr(i32* %2)
+  ret i32* %3
+}
+
+; Pass a slice to a function that only reads from it.
+define i8 @testNonEscapingSlice() {
+  %1 = call i8* @runtime.alloc(i32 16)
+  %2 = call i8 @readByteSlice(i8* %1, i32 16, i32 16)
+  ret i8 %2
+}
+
+; Pass a slice to a function that returns it, and read from the result.
+define i8 @testReturnedSlice() {
+  %1 = call i8* @runtime.alloc(i32 16)
+  %2 = call { i8*, i32, i32 } @returnByteSlice(i8* %1, i32 16, i32 16)
+  %3 = extractvalue { i8*, i32, i32 } %2, 0
+  %4 = load i8, i8* %3
+  ret i8 %4
+}
+
+; Pass a slice to a function that stores it in a global, which lets it escape.
+define void @testEscapingSlice() {
+  %1 = call i8* @runtime.alloc(i32 16)
+  call void @storeByteSlice(i8* %1, i32 16, i32 16)
+  ret void
+}
+
+define i32* @returnIntPtr(i32* %ptr) {
+  ret i32* %ptr
+}
+
+define i8 @readByteSlice(i8* %ptr, i32 %len, i32 %cap) {
+  %slice.ptr = insertvalue { i8*, i32, i32 } undef, i8* %ptr, 0
+  %slice.len = insertvalue { i8*, i32, i32 } %slice.ptr, i32 %len, 1
+  %slice = insertvalue { i8*, i32, i32 } %slice.len, i32 %cap, 2
+  %buf = extractvalue { i8*, i32, i32 } %slice, 0
+  %len2 = extractvalue { i8*, i32, i32 } %slice, 1
+  %elem.ptr = getelementptr i8, i8* %buf, i32 1
+  %elem = load i8, i8* %elem.ptr
+  ret i8 %elem
+}
+
+define { i8*, i32, i32 } @returnByteSlice(i8* %ptr, i32 %len, i32 %cap) {
+  %slice.ptr = insertvalue { i8*, i32, i32 } undef, i8* %ptr, 0
+  %slice.len = insertvalue { i8*, i32, i32 } %slice.ptr, i32 %len, 1
+  %slice = insertvalue { i8*, i32, i32 } %slice.len, i32 %cap, 2
+  ret { i8*, i32, i32 } %slice
+}
+
+define void @storeByteSlice(i8* %ptr, i32 %len, i32 %cap) {
+  store i8* %ptr, i8** @slice
+  ret void
+}
+
 declare i32* @escapeIntPtr(i32*)
 
 declare i32* @noescapeIntPtr(i32* nocapture)
@@ -4,8 +4,8 @@ func main() {
 	n1 := 5
 	derefInt(&n1)
 
-	// This should eventually be modified to not escape.
-	n2 := 6 // OUT: object allocated on the heap: escapes at line 9
+	// The pointer is returned, but the return value doesn't escape.
+	n2 := 6
 	returnIntPtr(&n2)
 
 	s1 := make([]int, 3)
@@ -14,8 +14,8 @@ func main() {
 	s2 := [3]int{}
 	readIntSlice(s2[:])
 
-	// This should also be modified to not escape.
-	s3 := make([]int, 3) // OUT: object allocated on the heap: escapes at line 19
+	// The same, for a slice.
+	s3 := make([]int, 3)
 	returnIntSlice(s3)
 
 	_ = make([]int, getUnknownNumber()) // OUT: object allocated on the heap: size is not constant
@@ -33,7 +33,7 @@ func main() {
 	c1 := getComplex128() // OUT: object allocated on the heap: escapes at line 34
 	useInterface(c1)
 
-	n3 := 5 // OUT: object allocated on the heap: escapes at line 39
+	n3 := 5 // only read by the closure, so it doesn't escape
 	func() int {
 		return n3
 	}()
@@ -42,6 +42,9 @@ func main() {
 
 	s8 := []int{3, 5, 8} // OUT: object allocated on the heap: escapes at line 44
 	callVariadic(s8...)
+
+	s9 := make([]byte, 8) // OUT: object allocated on the heap: escapes at line 73
+	storeByteSlice(s9)
 }
 
 func derefInt(x *int) int {
@@ -64,6 +67,12 @@ func returnIntSlice(s []int) []int {
 	return s
 }
 
+var globalBytes []byte
+
+func storeByteSlice(s []byte) {
+	globalBytes = s
+}
+
 func getUnknownNumber() int
 
 func copySlice(out, in []int) {
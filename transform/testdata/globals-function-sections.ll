@@ -6,3 +6,7 @@ declare void @foo()
 define void @bar() {
   ret void
 }
+
+define void @baz() section ".ramfuncs" {
+  ret void
+}
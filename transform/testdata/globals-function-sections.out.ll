@@ -6,3 +6,7 @@ declare void @foo()
 define void @bar() section ".text.bar" {
   ret void
 }
+
+define void @baz() section ".ramfuncs" {
+  ret void
+}
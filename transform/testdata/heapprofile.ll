@@ -0,0 +1,30 @@
+target datalayout = "e-m:e-p:32:32-i64:64-v128:64:128-a:0:32-n32-S64"
+target triple = "armv7m-none-eabi"
+
+%runtime._string = type { i8*, i32 }
+%runtime.heapProfileRecord = type { i32, i32 }
+
+@runtime.heapProfileSite = internal global i32 0
+@runtime.heapProfileRecords = internal global { %runtime.heapProfileRecord*, i32, i32 } zeroinitializer
+@runtime.heapProfileSites = internal global %runtime._string zeroinitializer
+
+declare nonnull i8* @runtime.alloc(i32)
+
+define i8* @main.newBuffer(i32 %size) {
+entry:
+  %buf = call i8* @runtime.alloc(i32 %size)
+  ret i8* %buf
+}
+
+define i8* @main.newPair(i1 %big) {
+entry:
+  br i1 %big, label %large, label %small
+
+large:
+  %large.buf = call i8* @runtime.alloc(i32 64)
+  ret i8* %large.buf
+
+small:
+  %small.buf = call i8* @runtime.alloc(i32 8)
+  ret i8* %small.buf
+}
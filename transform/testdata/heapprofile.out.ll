@@ -0,0 +1,35 @@
+target datalayout = "e-m:e-p:32:32-i64:64-v128:64:128-a:0:32-n32-S64"
+target triple = "armv7m-none-eabi"
+
+%runtime.heapProfileRecord = type { i32, i32 }
+%runtime._string = type { i8*, i32 }
+
+@runtime.heapProfileSite = internal global i32 0
+@runtime.heapProfileRecords = internal global { %runtime.heapProfileRecord*, i32, i32 } { %runtime.heapProfileRecord* getelementptr inbounds ([3 x %runtime.heapProfileRecord], [3 x %runtime.heapProfileRecord]* @runtime.heapProfileRecords.buf, i32 0, i32 0), i32 3, i32 3 }
+@runtime.heapProfileSites = internal global %runtime._string { i8* getelementptr inbounds ([49 x i8], [49 x i8]* @runtime.heapProfileSites.buf, i32 0, i32 0), i32 49 }
+@runtime.heapProfileRecords.buf = internal global [3 x %runtime.heapProfileRecord] zeroinitializer
+@runtime.heapProfileSites.buf = internal unnamed_addr constant [49 x i8] c"main.newBuffer\09\090\0Amain.newPair\09\090\0Amain.newPair\09\090", align 1
+
+declare nonnull i8* @runtime.alloc(i32)
+
+define i8* @main.newBuffer(i32 %size) {
+entry:
+  store i32 0, i32* @runtime.heapProfileSite, align 4
+  %buf = call i8* @runtime.alloc(i32 %size)
+  ret i8* %buf
+}
+
+define i8* @main.newPair(i1 %big) {
+entry:
+  br i1 %big, label %large, label %small
+
+large:
+  store i32 1, i32* @runtime.heapProfileSite, align 4
+  %large.buf = call i8* @runtime.alloc(i32 64)
+  ret i8* %large.buf
+
+small:
+  store i32 2, i32* @runtime.heapProfileSite, align 4
+  %small.buf = call i8* @runtime.alloc(i32 8)
+  ret i8* %small.buf
+}
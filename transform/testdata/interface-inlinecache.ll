@@ -0,0 +1,78 @@
+target datalayout = "e-m:e-p:32:32-i64:64-v128:64:128-a:0:32-n32-S64"
+target triple = "armv7m-none-eabi"
+
+%runtime.typecodeID = type { %runtime.typecodeID*, i32, %runtime.interfaceMethodInfo* }
+%runtime.interfaceMethodInfo = type { i8*, i32 }
+
+@"reflect/types.type:basic:int" = private constant %runtime.typecodeID zeroinitializer
+@"func Double() int" = external constant i8
+@"Doubler$interface" = private constant [1 x i8*] [i8* @"func Double() int"]
+@"Number$methodset" = private constant [1 x %runtime.interfaceMethodInfo] [%runtime.interfaceMethodInfo { i8* @"func Double() int", i32 ptrtoint (i32 (i8*, i8*)* @"(Number).Double$invoke" to i32) }]
+@"reflect/types.type:named:Number" = private constant %runtime.typecodeID { %runtime.typecodeID* @"reflect/types.type:basic:int", i32 0, %runtime.interfaceMethodInfo* getelementptr inbounds ([1 x %runtime.interfaceMethodInfo], [1 x %runtime.interfaceMethodInfo]* @"Number$methodset", i32 0, i32 0) }
+@"Twice$methodset" = private constant [1 x %runtime.interfaceMethodInfo] [%runtime.interfaceMethodInfo { i8* @"func Double() int", i32 ptrtoint (i32 (i8*, i8*)* @"(Twice).Double$invoke" to i32) }]
+@"reflect/types.type:named:Twice" = private constant %runtime.typecodeID { %runtime.typecodeID* @"reflect/types.type:basic:int", i32 0, %runtime.interfaceMethodInfo* getelementptr inbounds ([1 x %runtime.interfaceMethodInfo], [1 x %runtime.interfaceMethodInfo]* @"Twice$methodset", i32 0, i32 0) }
+@"reflect/types.type:named:Counter" = private constant %runtime.typecodeID zeroinitializer
+@"*Counter$methodset" = private constant [1 x %runtime.interfaceMethodInfo] [%runtime.interfaceMethodInfo { i8* @"func Double() int", i32 ptrtoint (i32 (i32*, i8*)* @"(*Counter).Double" to i32) }]
+@"reflect/types.type:pointer:named:Counter" = private constant %runtime.typecodeID { %runtime.typecodeID* @"reflect/types.type:named:Counter", i32 0, %runtime.interfaceMethodInfo* getelementptr inbounds ([1 x %runtime.interfaceMethodInfo], [1 x %runtime.interfaceMethodInfo]* @"*Counter$methodset", i32 0, i32 0) }
+
+declare i32 @runtime.interfaceMethod(i32, i8**, i8*)
+declare void @runtime.printint32(i32)
+declare void @runtime.nilPanic(i8*, i8*)
+
+; Call Double on three types, which is one more than fits in the inline cache:
+; the first two calls miss and fill the cache, the third call hits it. The
+; fourth call (on Twice) evicts Number from the cache, so that the fifth call
+; misses again. A nil *Counter is a valid receiver, unlike a nil interface
+; which panics.
+define void @printDoubles() {
+  call void @printDouble(i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Number" to i32), i8* inttoptr (i32 5 to i8*))
+  call void @printDouble(i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:pointer:named:Counter" to i32), i8* null)
+  call void @printDouble(i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Number" to i32), i8* inttoptr (i32 7 to i8*))
+  call void @printDouble(i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Twice" to i32), i8* inttoptr (i32 3 to i8*))
+  call void @printDouble(i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Number" to i32), i8* inttoptr (i32 9 to i8*))
+  call void @printDouble(i32 0, i8* null)
+  ret void
+}
+
+define void @printDouble(i32 %typecode, i8* %value) {
+  %doubler.func = call i32 @runtime.interfaceMethod(i32 %typecode, i8** getelementptr inbounds ([1 x i8*], [1 x i8*]* @"Doubler$interface", i32 0, i32 0), i8* nonnull @"func Double() int")
+  %doubler.func.cast = inttoptr i32 %doubler.func to i32 (i8*, i8*)*
+  %doubler.result = call i32 %doubler.func.cast(i8* %value, i8* null)
+  call void @runtime.printint32(i32 %doubler.result)
+  ret void
+}
+
+define i32 @"(Number).Double"(i32 %receiver, i8* %parentHandle) {
+  %ret = mul i32 %receiver, 2
+  ret i32 %ret
+}
+
+define i32 @"(Number).Double$invoke"(i8* %receiverPtr, i8* %parentHandle) {
+  %receiver = ptrtoint i8* %receiverPtr to i32
+  %ret = call i32 @"(Number).Double"(i32 %receiver, i8* null)
+  ret i32 %ret
+}
+
+define i32 @"(Twice).Double"(i32 %receiver, i8* %parentHandle) {
+  %ret = shl i32 %receiver, 1
+  ret i32 %ret
+}
+
+define i32 @"(Twice).Double$invoke"(i8* %receiverPtr, i8* %parentHandle) {
+  %receiver = ptrtoint i8* %receiverPtr to i32
+  %ret = call i32 @"(Twice).Double"(i32 %receiver, i8* null)
+  ret i32 %ret
+}
+
+define i32 @"(*Counter).Double"(i32* %receiver, i8* %parentHandle) {
+  %isnil = icmp eq i32* %receiver, null
+  br i1 %isnil, label %nil, label %notnil
+
+nil:
+  ret i32 0
+
+notnil:
+  %value = load i32, i32* %receiver
+  %ret = mul i32 %value, 2
+  ret i32 %ret
+}
@@ -0,0 +1,191 @@
+target datalayout = "e-m:e-p:32:32-i64:64-v128:64:128-a:0:32-n32-S64"
+target triple = "armv7m-none-eabi"
+
+%runtime.typecodeID = type { %runtime.typecodeID*, i32, %runtime.interfaceMethodInfo* }
+%runtime.interfaceMethodInfo = type { i8*, i32 }
+
+@"reflect/types.type:basic:int" = private constant %runtime.typecodeID zeroinitializer
+@"reflect/types.type:named:Number" = private constant %runtime.typecodeID { %runtime.typecodeID* @"reflect/types.type:basic:int", i32 0, %runtime.interfaceMethodInfo* null }
+@"reflect/types.type:named:Twice" = private constant %runtime.typecodeID { %runtime.typecodeID* @"reflect/types.type:basic:int", i32 0, %runtime.interfaceMethodInfo* null }
+@"reflect/types.type:named:Counter" = private constant %runtime.typecodeID zeroinitializer
+@"reflect/types.type:pointer:named:Counter" = private constant %runtime.typecodeID { %runtime.typecodeID* @"reflect/types.type:named:Counter", i32 0, %runtime.interfaceMethodInfo* null }
+@"(Doubler).Double$icentry:nil" = internal unnamed_addr constant { i32, i32 (i8*, i8*, i8*)* } { i32 0, i32 (i8*, i8*, i8*)* @"(Doubler).Double$icmethod:nil" }
+@"(Doubler).Double$icentry:pointer:named:Counter" = internal unnamed_addr constant { i32, i32 (i8*, i8*, i8*)* } { i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:pointer:named:Counter" to i32), i32 (i8*, i8*, i8*)* @"(Doubler).Double$icmethod:pointer:named:Counter" }
+@"(Doubler).Double$icentry:named:Twice" = internal unnamed_addr constant { i32, i32 (i8*, i8*, i8*)* } { i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Twice" to i32), i32 (i8*, i8*, i8*)* @"(Doubler).Double$icmethod:named:Twice" }
+@"(Doubler).Double$icentry:named:Number" = internal unnamed_addr constant { i32, i32 (i8*, i8*, i8*)* } { i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Number" to i32), i32 (i8*, i8*, i8*)* @"(Doubler).Double$icmethod:named:Number" }
+@"(Doubler).Double$iccache" = internal global [2 x { i32, i32 (i8*, i8*, i8*)* }*] [{ i32, i32 (i8*, i8*, i8*)* }* @"(Doubler).Double$icentry:nil", { i32, i32 (i8*, i8*, i8*)* }* @"(Doubler).Double$icentry:nil"], align 4
+
+declare void @runtime.printint32(i32)
+
+declare void @runtime.nilPanic(i8*, i8*)
+
+define void @printDoubles() {
+  call void @printDouble(i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Number" to i32), i8* inttoptr (i32 5 to i8*))
+  call void @printDouble(i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:pointer:named:Counter" to i32), i8* null)
+  call void @printDouble(i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Number" to i32), i8* inttoptr (i32 7 to i8*))
+  call void @printDouble(i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Twice" to i32), i8* inttoptr (i32 3 to i8*))
+  call void @printDouble(i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Number" to i32), i8* inttoptr (i32 9 to i8*))
+  call void @printDouble(i32 0, i8* null)
+  ret void
+}
+
+define void @printDouble(i32 %typecode, i8* %value) {
+  %1 = call i32 @"(Doubler).Double$ic"(i8* %value, i8* null, i32 %typecode, i8* null)
+  call void @runtime.printint32(i32 %1)
+  ret void
+}
+
+define i32 @"(Number).Double"(i32 %receiver, i8* %parentHandle) {
+  %ret = mul i32 %receiver, 2
+  ret i32 %ret
+}
+
+define i32 @"(Number).Double$invoke"(i8* %receiverPtr, i8* %parentHandle) {
+  %receiver = ptrtoint i8* %receiverPtr to i32
+  %ret = call i32 @"(Number).Double"(i32 %receiver, i8* null)
+  ret i32 %ret
+}
+
+define i32 @"(Twice).Double"(i32 %receiver, i8* %parentHandle) {
+  %ret = shl i32 %receiver, 1
+  ret i32 %ret
+}
+
+define i32 @"(Twice).Double$invoke"(i8* %receiverPtr, i8* %parentHandle) {
+  %receiver = ptrtoint i8* %receiverPtr to i32
+  %ret = call i32 @"(Twice).Double"(i32 %receiver, i8* null)
+  ret i32 %ret
+}
+
+define i32 @"(*Counter).Double"(i32* %receiver, i8* %parentHandle) {
+  %isnil = icmp eq i32* %receiver, null
+  br i1 %isnil, label %nil, label %notnil
+
+nil:                                              ; preds = %0
+  ret i32 0
+
+notnil:                                           ; preds = %0
+  %value = load i32, i32* %receiver, align 4
+  %ret = mul i32 %value, 2
+  ret i32 %ret
+}
+
+define internal i32 @"(Doubler).Double"(i8* %0, i8* %1, i32 %actualType, i8* %parentHandle) unnamed_addr {
+entry:
+  %"pointer:named:Counter.icmp" = icmp eq i32 %actualType, ptrtoint (%runtime.typecodeID* @"reflect/types.type:pointer:named:Counter" to i32)
+  br i1 %"pointer:named:Counter.icmp", label %"pointer:named:Counter", label %"pointer:named:Counter.next"
+
+"pointer:named:Counter":                          ; preds = %entry
+  %2 = bitcast i8* %0 to i32*
+  %3 = call i32 @"(*Counter).Double"(i32* %2, i8* %1)
+  ret i32 %3
+
+"pointer:named:Counter.next":                     ; preds = %entry
+  %"named:Twice.icmp" = icmp eq i32 %actualType, ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Twice" to i32)
+  br i1 %"named:Twice.icmp", label %"named:Twice", label %"named:Twice.next"
+
+"named:Twice":                                    ; preds = %"pointer:named:Counter.next"
+  %4 = call i32 @"(Twice).Double$invoke"(i8* %0, i8* %1)
+  ret i32 %4
+
+"named:Twice.next":                               ; preds = %"pointer:named:Counter.next"
+  %"named:Number.icmp" = icmp eq i32 %actualType, ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Number" to i32)
+  br i1 %"named:Number.icmp", label %"named:Number", label %"named:Number.next"
+
+"named:Number":                                   ; preds = %"named:Twice.next"
+  %5 = call i32 @"(Number).Double$invoke"(i8* %0, i8* %1)
+  ret i32 %5
+
+"named:Number.next":                              ; preds = %"named:Twice.next"
+  call void @runtime.nilPanic(i8* undef, i8* undef)
+  unreachable
+}
+
+define internal i32 @"(Doubler).Double$icmethod:nil"(i8* %0, i8* %1, i8* %2) unnamed_addr {
+entry:
+  %3 = call i32 @"(Doubler).Double"(i8* %0, i8* %1, i32 0, i8* %2)
+  ret i32 %3
+}
+
+define internal { i32, i32 (i8*, i8*, i8*)* }* @"(Doubler).Double$iclookup"(i32 %actualType) unnamed_addr {
+entry:
+  %"pointer:named:Counter.icmp" = icmp eq i32 %actualType, ptrtoint (%runtime.typecodeID* @"reflect/types.type:pointer:named:Counter" to i32)
+  br i1 %"pointer:named:Counter.icmp", label %"pointer:named:Counter", label %"pointer:named:Counter.next"
+
+"pointer:named:Counter":                          ; preds = %entry
+  ret { i32, i32 (i8*, i8*, i8*)* }* @"(Doubler).Double$icentry:pointer:named:Counter"
+
+"pointer:named:Counter.next":                     ; preds = %entry
+  %"named:Twice.icmp" = icmp eq i32 %actualType, ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Twice" to i32)
+  br i1 %"named:Twice.icmp", label %"named:Twice", label %"named:Twice.next"
+
+"named:Twice":                                    ; preds = %"pointer:named:Counter.next"
+  ret { i32, i32 (i8*, i8*, i8*)* }* @"(Doubler).Double$icentry:named:Twice"
+
+"named:Twice.next":                               ; preds = %"pointer:named:Counter.next"
+  %"named:Number.icmp" = icmp eq i32 %actualType, ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Number" to i32)
+  br i1 %"named:Number.icmp", label %"named:Number", label %"named:Number.next"
+
+"named:Number":                                   ; preds = %"named:Twice.next"
+  ret { i32, i32 (i8*, i8*, i8*)* }* @"(Doubler).Double$icentry:named:Number"
+
+"named:Number.next":                              ; preds = %"named:Twice.next"
+  ret { i32, i32 (i8*, i8*, i8*)* }* @"(Doubler).Double$icentry:nil"
+}
+
+define internal i32 @"(Doubler).Double$icmethod:pointer:named:Counter"(i8* %0, i8* %1, i8* %2) unnamed_addr {
+entry:
+  %3 = bitcast i8* %0 to i32*
+  %4 = call i32 @"(*Counter).Double"(i32* %3, i8* %1)
+  ret i32 %4
+}
+
+define internal i32 @"(Doubler).Double$icmethod:named:Twice"(i8* %0, i8* %1, i8* %2) unnamed_addr {
+entry:
+  %3 = call i32 @"(Twice).Double$invoke"(i8* %0, i8* %1)
+  ret i32 %3
+}
+
+define internal i32 @"(Doubler).Double$icmethod:named:Number"(i8* %0, i8* %1, i8* %2) unnamed_addr {
+entry:
+  %3 = call i32 @"(Number).Double$invoke"(i8* %0, i8* %1)
+  ret i32 %3
+}
+
+define internal i32 @"(Doubler).Double$ic"(i8* %0, i8* %1, i32 %2, i8* %3) unnamed_addr {
+entry:
+  %entry1 = load atomic { i32, i32 (i8*, i8*, i8*)* }*, { i32, i32 (i8*, i8*, i8*)* }** getelementptr inbounds ([2 x { i32, i32 (i8*, i8*, i8*)* }*], [2 x { i32, i32 (i8*, i8*, i8*)* }*]* @"(Doubler).Double$iccache", i32 0, i32 0) unordered, align 4
+  %4 = getelementptr inbounds { i32, i32 (i8*, i8*, i8*)* }, { i32, i32 (i8*, i8*, i8*)* }* %entry1, i32 0, i32 0
+  %entry.typecode = load i32, i32* %4, align 4
+  %5 = icmp eq i32 %entry.typecode, %2
+  br i1 %5, label %hit, label %next
+
+hit:                                              ; preds = %entry
+  %6 = getelementptr inbounds { i32, i32 (i8*, i8*, i8*)* }, { i32, i32 (i8*, i8*, i8*)* }* %entry1, i32 0, i32 1
+  %entry.method = load i32 (i8*, i8*, i8*)*, i32 (i8*, i8*, i8*)** %6, align 4
+  %7 = call i32 %entry.method(i8* %0, i8* %1, i8* %3)
+  ret i32 %7
+
+next:                                             ; preds = %entry
+  %entry2 = load atomic { i32, i32 (i8*, i8*, i8*)* }*, { i32, i32 (i8*, i8*, i8*)* }** getelementptr inbounds ([2 x { i32, i32 (i8*, i8*, i8*)* }*], [2 x { i32, i32 (i8*, i8*, i8*)* }*]* @"(Doubler).Double$iccache", i32 0, i32 1) unordered, align 4
+  %8 = getelementptr inbounds { i32, i32 (i8*, i8*, i8*)* }, { i32, i32 (i8*, i8*, i8*)* }* %entry2, i32 0, i32 0
+  %entry.typecode3 = load i32, i32* %8, align 4
+  %9 = icmp eq i32 %entry.typecode3, %2
+  br i1 %9, label %hit4, label %next5
+
+hit4:                                             ; preds = %next
+  %10 = getelementptr inbounds { i32, i32 (i8*, i8*, i8*)* }, { i32, i32 (i8*, i8*, i8*)* }* %entry2, i32 0, i32 1
+  %entry.method6 = load i32 (i8*, i8*, i8*)*, i32 (i8*, i8*, i8*)** %10, align 4
+  %11 = call i32 %entry.method6(i8* %0, i8* %1, i8* %3)
+  ret i32 %11
+
+next5:                                            ; preds = %next
+  %12 = load atomic { i32, i32 (i8*, i8*, i8*)* }*, { i32, i32 (i8*, i8*, i8*)* }** getelementptr inbounds ([2 x { i32, i32 (i8*, i8*, i8*)* }*], [2 x { i32, i32 (i8*, i8*, i8*)* }*]* @"(Doubler).Double$iccache", i32 0, i32 0) unordered, align 4
+  store atomic { i32, i32 (i8*, i8*, i8*)* }* %12, { i32, i32 (i8*, i8*, i8*)* }** getelementptr inbounds ([2 x { i32, i32 (i8*, i8*, i8*)* }*], [2 x { i32, i32 (i8*, i8*, i8*)* }*]* @"(Doubler).Double$iccache", i32 0, i32 1) unordered, align 4
+  %13 = call { i32, i32 (i8*, i8*, i8*)* }* @"(Doubler).Double$iclookup"(i32 %2)
+  store atomic { i32, i32 (i8*, i8*, i8*)* }* %13, { i32, i32 (i8*, i8*, i8*)* }** getelementptr inbounds ([2 x { i32, i32 (i8*, i8*, i8*)* }*], [2 x { i32, i32 (i8*, i8*, i8*)* }*]* @"(Doubler).Double$iccache", i32 0, i32 0) unordered, align 4
+  %14 = getelementptr inbounds { i32, i32 (i8*, i8*, i8*)* }, { i32, i32 (i8*, i8*, i8*)* }* %13, i32 0, i32 1
+  %entry.method7 = load i32 (i8*, i8*, i8*)*, i32 (i8*, i8*, i8*)** %14, align 4
+  %15 = call i32 %entry.method7(i8* %0, i8* %1, i8* %3)
+  ret i32 %15
+}
@@ -14,6 +14,10 @@ target triple = "armv7m-none-eabi"
 @"Doubler$interface" = private constant [1 x i8*] [i8* @"func Double() int"]
 @"Number$methodset" = private constant [1 x %runtime.interfaceMethodInfo] [%runtime.interfaceMethodInfo { i8* @"func Double() int", i32 ptrtoint (i32 (i8*, i8*)* @"(Number).Double$invoke" to i32) }]
 @"reflect/types.type:named:Number" = private constant %runtime.typecodeID { %runtime.typecodeID* @"reflect/types.type:basic:int", i32 0, %runtime.interfaceMethodInfo* getelementptr inbounds ([1 x %runtime.interfaceMethodInfo], [1 x %runtime.interfaceMethodInfo]* @"Number$methodset", i32 0, i32 0) }
+@"func Increment()" = external constant i8
+@"Incrementer$interface" = private constant [1 x i8*] [i8* @"func Increment()"]
+@"*Counter$methodset" = private constant [1 x %runtime.interfaceMethodInfo] [%runtime.interfaceMethodInfo { i8* @"func Increment()", i32 ptrtoint (void (i32*, i8*)* @"(*Counter).Increment" to i32) }]
+@"reflect/types.type:pointer:named:Counter" = private constant %runtime.typecodeID { %runtime.typecodeID* @"reflect/types.type:basic:int", i32 0, %runtime.interfaceMethodInfo* getelementptr inbounds ([1 x %runtime.interfaceMethodInfo], [1 x %runtime.interfaceMethodInfo]* @"*Counter$methodset", i32 0, i32 0) }
 
 declare i1 @runtime.interfaceImplements(i32, i8**)
 declare i1 @runtime.typeAssert(i32, i8*)
@@ -89,3 +93,45 @@ define i32 @"(Number).Double$invoke"(i8* %receiverPtr, i8* %parentHandle) {
   %ret = call i32 @"(Number).Double"(i32 %receiver, i8* null)
   ret i32 %ret
 }
+
+; Incrementer is only implemented by *Counter, so the call is replaced with a
+; direct call that needs a bitcast of the receiver. The PHI node must be
+; updated for the new block.
+define void @increment(i32 %typecode, i8* %value, i1 %cond) {
+entry:
+  br i1 %cond, label %then, label %done
+
+then:
+  %incrementer.func = call i32 @runtime.interfaceMethod(i32 %typecode, i8** getelementptr inbounds ([1 x i8*], [1 x i8*]* @"Incrementer$interface", i32 0, i32 0), i8* nonnull @"func Increment()")
+  %incrementer.func.cast = inttoptr i32 %incrementer.func to void (i8*, i8*)*
+  call void %incrementer.func.cast(i8* %value, i8* null)
+  br label %done
+
+done:
+  %x = phi i32 [ 0, %entry ], [ 1, %then ]
+  call void @runtime.printint32(i32 %x)
+  ret void
+}
+
+; The type code is a constant, so the nil check is folded away.
+define void @incrementConstant(i8* %value) {
+  %incrementer.func = call i32 @runtime.interfaceMethod(i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:pointer:named:Counter" to i32), i8** getelementptr inbounds ([1 x i8*], [1 x i8*]* @"Incrementer$interface", i32 0, i32 0), i8* nonnull @"func Increment()")
+  %incrementer.func.cast = inttoptr i32 %incrementer.func to void (i8*, i8*)*
+  call void %incrementer.func.cast(i8* %value, i8* null)
+  ret void
+}
+
+; The interface is always nil, so the call always panics.
+define void @incrementNil(i8* %value) {
+  %incrementer.func = call i32 @runtime.interfaceMethod(i32 0, i8** getelementptr inbounds ([1 x i8*], [1 x i8*]* @"Incrementer$interface", i32 0, i32 0), i8* nonnull @"func Increment()")
+  %incrementer.func.cast = inttoptr i32 %incrementer.func to void (i8*, i8*)*
+  call void %incrementer.func.cast(i8* %value, i8* null)
+  ret void
+}
+
+define void @"(*Counter).Increment"(i32* %counter, i8* %parentHandle) {
+  %old = load i32, i32* %counter
+  %new = add i32 %old, 1
+  store i32 %new, i32* %counter
+  ret void
+}
@@ -7,6 +7,7 @@ target triple = "armv7m-none-eabi"
 @"reflect/types.type:basic:uint8" = private constant %runtime.typecodeID zeroinitializer
 @"reflect/types.type:basic:int" = private constant %runtime.typecodeID zeroinitializer
 @"reflect/types.type:named:Number" = private constant %runtime.typecodeID { %runtime.typecodeID* @"reflect/types.type:basic:int", i32 0, %runtime.interfaceMethodInfo* null }
+@"reflect/types.type:pointer:named:Counter" = private constant %runtime.typecodeID { %runtime.typecodeID* @"reflect/types.type:basic:int", i32 0, %runtime.interfaceMethodInfo* null }
 
 declare void @runtime.printuint8(i8)
 
@@ -42,7 +43,11 @@ typeswitch.notUnmatched:                          ; preds = %0
   br i1 %typeassert.ok, label %typeswitch.Doubler, label %typeswitch.notDoubler
 
 typeswitch.Doubler:                               ; preds = %typeswitch.notUnmatched
-  %1 = call i32 @"(Doubler).Double"(i8* %value, i8* null, i32 %typecode, i8* null)
+  %invoke.valid = icmp eq i32 %typecode, ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Number" to i32)
+  br i1 %invoke.valid, label %invoke.call, label %invoke.nil
+
+invoke.call:                                      ; preds = %typeswitch.Doubler
+  %1 = call i32 @"(Number).Double$invoke"(i8* %value, i8* null)
   call void @runtime.printint32(i32 %1)
   ret void
 
@@ -67,6 +72,10 @@ typeswitch.int16:                                 ; preds = %typeswitch.notByte
 
 typeswitch.notInt16:                              ; preds = %typeswitch.notByte
   ret void
+
+invoke.nil:                                       ; preds = %typeswitch.Doubler
+  call void @runtime.nilPanic(i8* undef, i8* undef)
+  unreachable
 }
 
 define i32 @"(Number).Double"(i32 %receiver, i8* %parentHandle) {
@@ -80,20 +89,55 @@ define i32 @"(Number).Double$invoke"(i8* %receiverPtr, i8* %parentHandle) {
   ret i32 %ret
 }
 
-define internal i32 @"(Doubler).Double"(i8* %0, i8* %1, i32 %actualType, i8* %parentHandle) unnamed_addr {
+define void @increment(i32 %typecode, i8* %value, i1 %cond) {
 entry:
-  %"named:Number.icmp" = icmp eq i32 %actualType, ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Number" to i32)
-  br i1 %"named:Number.icmp", label %"named:Number", label %"named:Number.next"
+  br i1 %cond, label %then, label %done
+
+then:                                             ; preds = %entry
+  %invoke.valid = icmp eq i32 %typecode, ptrtoint (%runtime.typecodeID* @"reflect/types.type:pointer:named:Counter" to i32)
+  br i1 %invoke.valid, label %invoke.call, label %invoke.nil
 
-"named:Number":                                   ; preds = %entry
-  %2 = call i32 @"(Number).Double$invoke"(i8* %0, i8* %1)
-  ret i32 %2
+invoke.call:                                      ; preds = %then
+  %0 = bitcast i8* %value to i32*
+  call void @"(*Counter).Increment"(i32* %0, i8* null)
+  br label %done
 
-"named:Number.next":                              ; preds = %entry
+done:                                             ; preds = %invoke.call, %entry
+  %1 = phi i32 [ 0, %entry ], [ 1, %invoke.call ]
+  call void @runtime.printint32(i32 %1)
+  ret void
+
+invoke.nil:                                       ; preds = %then
+  call void @runtime.nilPanic(i8* undef, i8* undef)
+  unreachable
+}
+
+define void @incrementConstant(i8* %value) {
+  %1 = bitcast i8* %value to i32*
+  call void @"(*Counter).Increment"(i32* %1, i8* null)
+  ret void
+}
+
+define void @incrementNil(i8* %value) {
+  br i1 icmp eq (i32 ptrtoint (%runtime.typecodeID* @"reflect/types.type:pointer:named:Counter" to i32), i32 0), label %invoke.call, label %invoke.nil
+
+invoke.call:                                      ; preds = %0
+  %1 = bitcast i8* %value to i32*
+  call void @"(*Counter).Increment"(i32* %1, i8* null)
+  ret void
+
+invoke.nil:                                       ; preds = %0
   call void @runtime.nilPanic(i8* undef, i8* undef)
   unreachable
 }
 
+define void @"(*Counter).Increment"(i32* %counter, i8* %parentHandle) {
+  %old = load i32, i32* %counter, align 4
+  %new = add i32 %old, 1
+  store i32 %new, i32* %counter, align 4
+  ret void
+}
+
 define internal i1 @"Doubler$typeassert"(i32 %actualType) unnamed_addr {
 entry:
   %"named:Number.icmp" = icmp eq i32 %actualType, ptrtoint (%runtime.typecodeID* @"reflect/types.type:named:Number" to i32)
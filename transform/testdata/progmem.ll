@@ -0,0 +1,33 @@
+target datalayout = "e-P1-p:16:8-i8:8-i16:8-i32:8-i64:8-f32:8-f64:8-n8-a:8"
+target triple = "avr-unknown-unknown"
+
+@main.table = internal unnamed_addr constant [4 x i8] c"\01\02\03\04"
+@main.words = internal unnamed_addr constant [2 x i16] [i16 1000, i16 2000]
+@main.message = internal unnamed_addr constant [4 x i8] c"abcd"
+@main.exported = constant [2 x i8] c"xy"
+@main.counter = internal global i8 5
+@main.zero = internal global [8 x i8] zeroinitializer
+
+declare void @runtime.printstring(i8*, i16) addrspace(1)
+
+define i8 @main.lookup(i16 %index) addrspace(1) {
+entry:
+  %0 = getelementptr inbounds [4 x i8], [4 x i8]* @main.table, i16 0, i16 %index
+  %1 = load i8, i8* %0
+  ret i8 %1
+}
+
+define i16 @main.secondWord() addrspace(1) {
+entry:
+  %0 = load i16, i16* getelementptr inbounds ([2 x i16], [2 x i16]* @main.words, i16 0, i16 1)
+  ret i16 %0
+}
+
+define i8 @main.print() addrspace(1) {
+entry:
+  call addrspace(1) void @runtime.printstring(i8* getelementptr inbounds ([4 x i8], [4 x i8]* @main.message, i16 0, i16 0), i16 4)
+  %0 = load i8, i8* getelementptr inbounds ([2 x i8], [2 x i8]* @main.exported, i16 0, i16 0)
+  %1 = load i8, i8* @main.counter
+  %2 = add i8 %0, %1
+  ret i8 %2
+}
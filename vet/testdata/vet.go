@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"machine"
+	"runtime/interrupt"
+	"sync"
+	"time"
+)
+
+var (
+	events  chan int
+	buffer  []byte
+	name    string
+	mu      sync.Mutex
+	counter int
+)
+
+func init() {
+	go worker()
+}
+
+func main() {
+	interrupt.New(1, handleTimer)
+	machine.Pin(3).SetInterrupt(1, func(p machine.Pin) {
+		events <- int(p)
+	})
+
+	for i := 0; i < 10; i++ {
+		fmt.Println("count:", i)
+	}
+	fmt.Println("done") // not in a loop
+	for {
+		counter++
+		time.Sleep(10)
+	}
+}
+
+func handleTimer(intr interrupt.Interrupt) {
+	counter++ // fine
+	buffer = append(buffer, 1)
+	name = "timer " + name
+	record()
+}
+
+func record() {
+	mu.Lock()
+	p := new(int)
+	*p = counter
+	mu.Unlock()
+	buffer = []byte(name)
+}
+
+func worker() {
+	for v := range events {
+		counter += v
+	}
+}
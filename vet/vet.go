@@ -0,0 +1,375 @@
+// Package vet implements tinygo vet, a static analyzer that looks for code
+// patterns that are valid Go but dangerous or slow on microcontrollers.
+//
+// The following checks are implemented:
+//
+//   isr-alloc       heap allocations in interrupt handlers
+//   isr-blocking    blocking operations (channels, sleeps, locks) in interrupt handlers
+//   fmt-in-loop     calls to the fmt package inside loops
+//   init-goroutine  goroutines started from init functions
+//
+// Interrupt handlers are the functions passed to interrupt.New and to
+// machine.Pin.SetInterrupt. Functions called from an interrupt handler are
+// checked as well, as long as they're part of the checked packages.
+package vet
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Diagnostic is a single problem found by the analyzer.
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// String returns the diagnostic in the usual file:line:column: message form.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s (%s)", d.File, d.Line, d.Column, d.Message, d.Check)
+}
+
+// checker holds the state of a single vet run.
+type checker struct {
+	prog        *ssa.Program
+	pkgs        map[*ssa.Package]struct{}
+	diagnostics []Diagnostic
+	seen        map[Diagnostic]struct{}
+}
+
+// Run checks the given packages, which must be part of prog and must have been
+// built (with ssa.Package.Build), and returns the problems found sorted by
+// position.
+func Run(prog *ssa.Program, pkgs []*ssa.Package) []Diagnostic {
+	c := &checker{
+		prog: prog,
+		pkgs: make(map[*ssa.Package]struct{}),
+		seen: make(map[Diagnostic]struct{}),
+	}
+	for _, pkg := range pkgs {
+		c.pkgs[pkg] = struct{}{}
+	}
+
+	// Collect all functions in the checked packages, including methods and
+	// anonymous functions.
+	var functions []*ssa.Function
+	for _, pkg := range pkgs {
+		for _, member := range pkg.Members {
+			switch member := member.(type) {
+			case *ssa.Function:
+				functions = appendFunction(functions, member)
+			case *ssa.Type:
+				for _, typ := range []types.Type{member.Type(), types.NewPointer(member.Type())} {
+					methods := prog.MethodSets.MethodSet(typ)
+					for i := 0; i < methods.Len(); i++ {
+						fn := prog.MethodValue(methods.At(i))
+						if fn != nil && fn.Pkg == pkg {
+							functions = appendFunction(functions, fn)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	handlers := make(map[*ssa.Function]struct{})
+	for _, fn := range functions {
+		c.checkLoops(fn)
+		if fn.Parent() == nil && fn.Signature.Recv() == nil && (fn.Name() == "init" || strings.HasPrefix(fn.Name(), "init#")) {
+			c.checkInit(fn)
+		}
+		for _, handler := range findInterruptHandlers(fn) {
+			handlers[handler] = struct{}{}
+		}
+	}
+	var handlerList []*ssa.Function
+	for handler := range handlers {
+		handlerList = append(handlerList, handler)
+	}
+	sort.Slice(handlerList, func(i, j int) bool {
+		return handlerList[i].Pos() < handlerList[j].Pos()
+	})
+	for _, handler := range handlerList {
+		c.checkInterruptHandler(handler)
+	}
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i], c.diagnostics[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return c.diagnostics
+}
+
+// appendFunction appends the function and all anonymous functions defined in
+// it to the list.
+func appendFunction(functions []*ssa.Function, fn *ssa.Function) []*ssa.Function {
+	functions = append(functions, fn)
+	for _, anon := range fn.AnonFuncs {
+		functions = appendFunction(functions, anon)
+	}
+	return functions
+}
+
+// report adds a new diagnostic at the given position, or at the start of the
+// function if the position is unknown.
+func (c *checker) report(fn *ssa.Function, pos token.Pos, check, format string, args ...interface{}) {
+	if !pos.IsValid() {
+		pos = fn.Pos()
+	}
+	position := c.prog.Fset.Position(pos)
+	d := Diagnostic{
+		File:    position.Filename,
+		Line:    position.Line,
+		Column:  position.Column,
+		Check:   check,
+		Message: fmt.Sprintf(format, args...),
+	}
+	if _, ok := c.seen[d]; ok {
+		return
+	}
+	c.seen[d] = struct{}{}
+	c.diagnostics = append(c.diagnostics, d)
+}
+
+// findInterruptHandlers returns the interrupt handlers that are registered in
+// the given function.
+func findInterruptHandlers(fn *ssa.Function) []*ssa.Function {
+	var handlers []*ssa.Function
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			call, ok := instr.(ssa.CallInstruction)
+			if !ok {
+				continue
+			}
+			callee := call.Common().StaticCallee()
+			if callee == nil || callee.Pkg == nil {
+				continue
+			}
+			args := call.Common().Args
+			var handler ssa.Value
+			switch {
+			case callee.Pkg.Pkg.Path() == "runtime/interrupt" && callee.Name() == "New" && len(args) == 2:
+				handler = args[1]
+			case callee.Pkg.Pkg.Path() == "machine" && callee.Name() == "SetInterrupt" && len(args) != 0:
+				handler = args[len(args)-1]
+			default:
+				continue
+			}
+			switch handler := handler.(type) {
+			case *ssa.Function:
+				handlers = append(handlers, handler)
+			case *ssa.MakeClosure:
+				handlers = append(handlers, handler.Fn.(*ssa.Function))
+			}
+		}
+	}
+	return handlers
+}
+
+// checkInterruptHandler checks the interrupt handler and all functions called
+// from it in the checked packages for allocations and blocking operations.
+func (c *checker) checkInterruptHandler(handler *ssa.Function) {
+	visited := make(map[*ssa.Function]struct{})
+	worklist := []*ssa.Function{handler}
+	for len(worklist) != 0 {
+		fn := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		if _, ok := visited[fn]; ok {
+			continue
+		}
+		visited[fn] = struct{}{}
+		if _, ok := c.pkgs[fn.Pkg]; !ok && fn.Pkg != nil {
+			continue
+		}
+		context := "in interrupt handler"
+		if fn != handler {
+			context = "in " + fn.Name() + ", called from interrupt handler " + handler.Name()
+		}
+		for _, block := range fn.Blocks {
+			for _, instr := range block.Instrs {
+				c.checkInterruptInstruction(fn, instr, context)
+				if call, ok := instr.(ssa.CallInstruction); ok {
+					if callee := call.Common().StaticCallee(); callee != nil {
+						worklist = append(worklist, callee)
+					}
+				}
+			}
+		}
+	}
+}
+
+// checkInterruptInstruction reports the instruction if it may allocate or
+// block, which must not be done in an interrupt.
+func (c *checker) checkInterruptInstruction(fn *ssa.Function, instr ssa.Instruction, context string) {
+	switch instr := instr.(type) {
+	case *ssa.Alloc:
+		if instr.Heap {
+			c.report(fn, instr.Pos(), "isr-alloc", "heap allocation of %s %s", deref(instr.Type()), context)
+		}
+	case *ssa.MakeSlice:
+		c.report(fn, instr.Pos(), "isr-alloc", "make of %s %s", instr.Type(), context)
+	case *ssa.MakeMap:
+		c.report(fn, instr.Pos(), "isr-alloc", "make of %s %s", instr.Type(), context)
+	case *ssa.MakeChan:
+		c.report(fn, instr.Pos(), "isr-alloc", "make of %s %s", instr.Type(), context)
+	case *ssa.MakeClosure:
+		if len(instr.Bindings) != 0 {
+			c.report(fn, instr.Pos(), "isr-alloc", "closure allocation %s", context)
+		}
+	case *ssa.BinOp:
+		if instr.Op == token.ADD && isString(instr.Type()) {
+			c.report(fn, instr.Pos(), "isr-alloc", "string concatenation %s", context)
+		}
+	case *ssa.Convert:
+		// Conversions between strings and byte or rune slices copy the data.
+		_, fromSlice := instr.X.Type().Underlying().(*types.Slice)
+		_, toSlice := instr.Type().Underlying().(*types.Slice)
+		if (fromSlice && isString(instr.Type())) || (toSlice && isString(instr.X.Type())) {
+			c.report(fn, instr.Pos(), "isr-alloc", "conversion from %s to %s %s", instr.X.Type(), instr.Type(), context)
+		}
+	case *ssa.Send:
+		c.report(fn, instr.Pos(), "isr-blocking", "channel send %s", context)
+	case *ssa.UnOp:
+		if instr.Op == token.ARROW {
+			c.report(fn, instr.Pos(), "isr-blocking", "channel receive %s", context)
+		}
+	case *ssa.Select:
+		if instr.Blocking {
+			c.report(fn, instr.Pos(), "isr-blocking", "blocking select %s", context)
+		}
+	case *ssa.Go:
+		c.report(fn, instr.Pos(), "isr-alloc", "goroutine started %s", context)
+	case ssa.CallInstruction:
+		common := instr.Common()
+		if builtin, ok := common.Value.(*ssa.Builtin); ok && builtin.Name() == "append" {
+			c.report(fn, instr.Pos(), "isr-alloc", "append %s", context)
+			return
+		}
+		if callee := common.StaticCallee(); callee != nil && isBlockingCall(callee) {
+			c.report(fn, instr.Pos(), "isr-blocking", "call to %s %s", calleeName(callee), context)
+		}
+	}
+}
+
+// isBlockingCall returns whether the given function may block the current
+// goroutine.
+func isBlockingCall(fn *ssa.Function) bool {
+	if fn.Pkg == nil {
+		return false
+	}
+	name := calleeName(fn)
+	switch name {
+	case "time.Sleep", "(*sync.Mutex).Lock", "(*sync.RWMutex).Lock", "(*sync.RWMutex).RLock", "(*sync.WaitGroup).Wait", "(*sync.Cond).Wait", "(*sync.Once).Do":
+		return true
+	}
+	return false
+}
+
+// calleeName returns a readable name of the function, such as fmt.Println or
+// (*sync.Mutex).Lock.
+func calleeName(fn *ssa.Function) string {
+	if recv := fn.Signature.Recv(); recv != nil {
+		return "(" + types.TypeString(recv.Type(), func(pkg *types.Package) string { return pkg.Name() }) + ")." + fn.Name()
+	}
+	if fn.Pkg != nil {
+		return fn.Pkg.Pkg.Name() + "." + fn.Name()
+	}
+	return fn.Name()
+}
+
+// checkInit reports goroutines started from an init function. Init functions
+// run before main, so such a goroutine doesn't start running until init
+// returns and it isn't supported at all with -scheduler=none.
+func (c *checker) checkInit(fn *ssa.Function) {
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			if instr, ok := instr.(*ssa.Go); ok {
+				c.report(fn, instr.Pos(), "init-goroutine", "goroutine started from init function: it only starts running once init returns and is not supported with -scheduler=none")
+			}
+		}
+	}
+}
+
+// checkLoops reports calls to the fmt package inside loops. The fmt package is
+// large, slow and allocates, so it shouldn't be used in a loop that runs often
+// (such as the main loop of a program).
+func (c *checker) checkLoops(fn *ssa.Function) {
+	for _, block := range loopBlocks(fn) {
+		for _, instr := range block.Instrs {
+			call, ok := instr.(ssa.CallInstruction)
+			if !ok {
+				continue
+			}
+			callee := call.Common().StaticCallee()
+			if callee == nil || callee.Pkg == nil || callee.Pkg.Pkg.Path() != "fmt" {
+				continue
+			}
+			c.report(fn, instr.Pos(), "fmt-in-loop", "call to %s in a loop: fmt is slow and allocates, consider println or strconv", calleeName(callee))
+		}
+	}
+}
+
+// loopBlocks returns all blocks of the function that are part of a loop, in
+// order.
+func loopBlocks(fn *ssa.Function) []*ssa.BasicBlock {
+	inLoop := make(map[*ssa.BasicBlock]struct{})
+	for _, block := range fn.Blocks {
+		for _, succ := range block.Succs {
+			if !succ.Dominates(block) {
+				continue
+			}
+			// This is a back edge from block to the loop header succ. The
+			// loop consists of all blocks that reach block without going
+			// through the header.
+			loop := map[*ssa.BasicBlock]struct{}{succ: {}}
+			worklist := []*ssa.BasicBlock{block}
+			for len(worklist) != 0 {
+				b := worklist[len(worklist)-1]
+				worklist = worklist[:len(worklist)-1]
+				if _, ok := loop[b]; ok {
+					continue
+				}
+				loop[b] = struct{}{}
+				worklist = append(worklist, b.Preds...)
+			}
+			for b := range loop {
+				inLoop[b] = struct{}{}
+			}
+		}
+	}
+	var blocks []*ssa.BasicBlock
+	for _, block := range fn.Blocks {
+		if _, ok := inLoop[block]; ok {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// isString returns whether the type is a string type.
+func isString(typ types.Type) bool {
+	basic, ok := typ.Underlying().(*types.Basic)
+	return ok && basic.Info()&types.IsString != 0
+}
+
+// deref returns the element type of a pointer type.
+func deref(typ types.Type) types.Type {
+	if ptr, ok := typ.Underlying().(*types.Pointer); ok {
+		return ptr.Elem()
+	}
+	return typ
+}
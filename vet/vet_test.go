@@ -0,0 +1,98 @@
+package vet
+
+import (
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+var flagUpdate = flag.Bool("update", false, "update tests based on test output")
+
+// Minimal versions of the packages used in the test, so that the test doesn't
+// depend on a TinyGo or Go installation. Only the package paths and names
+// matter to the checks.
+var fakePackages = map[string]string{
+	"fmt": `package fmt
+		func Println(a ...interface{}) (n int, err error) { return 0, nil }`,
+	"machine": `package machine
+		type Pin uint8
+		type PinChange uint8
+		func (p Pin) SetInterrupt(change PinChange, callback func(Pin)) error { return nil }`,
+	"runtime/interrupt": `package interrupt
+		type Interrupt struct{ num int }
+		func New(id int, handler func(Interrupt)) Interrupt { return Interrupt{id} }`,
+	"sync": `package sync
+		type Mutex struct{ locked bool }
+		func (m *Mutex) Lock() {}
+		func (m *Mutex) Unlock() {}`,
+	"time": `package time
+		type Duration int64
+		func Sleep(d Duration) {}`,
+}
+
+// fakeImporter type checks the packages in fakePackages on demand.
+type fakeImporter struct {
+	fset     *token.FileSet
+	packages map[string]*types.Package
+}
+
+func (i *fakeImporter) Import(path string) (*types.Package, error) {
+	if pkg, ok := i.packages[path]; ok {
+		return pkg, nil
+	}
+	file, err := parser.ParseFile(i.fset, path+".go", fakePackages[path], 0)
+	if err != nil {
+		return nil, err
+	}
+	config := types.Config{Importer: i}
+	pkg, err := config.Check(path, i.fset, []*ast.File{file}, nil)
+	i.packages[path] = pkg
+	return pkg, err
+}
+
+func TestVet(t *testing.T) {
+	fset := token.NewFileSet()
+	importer := &fakeImporter{fset: fset, packages: make(map[string]*types.Package)}
+
+	file, err := parser.ParseFile(fset, "testdata/vet.go", nil, 0)
+	if err != nil {
+		t.Fatal("could not parse test case:", err)
+	}
+	pkg := types.NewPackage("main", "main")
+	ssaPkg, _, err := ssautil.BuildPackage(&types.Config{Importer: importer}, fset, pkg, []*ast.File{file}, ssa.BareInits)
+	if err != nil {
+		t.Fatal("could not build test case:", err)
+	}
+
+	var lines []string
+	for _, d := range Run(ssaPkg.Prog, []*ssa.Package{ssaPkg}) {
+		d.File = filepath.ToSlash(d.File)
+		lines = append(lines, d.String())
+	}
+	actual := strings.Join(lines, "\n") + "\n"
+
+	outpath := "testdata/vet.txt"
+	if *flagUpdate {
+		err := ioutil.WriteFile(outpath, []byte(actual), 0666)
+		if err != nil {
+			t.Error("could not write output file:", err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(outpath)
+	if err != nil {
+		t.Fatal("could not read expected output:", err)
+	}
+	if actual != strings.Replace(string(expected), "\r\n", "\n", -1) {
+		t.Errorf("output did not match:\n%s", actual)
+	}
+}